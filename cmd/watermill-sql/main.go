@@ -0,0 +1,169 @@
+// Command watermill-sql provides operational commands for SQLite databases of watermill-sql.
+//
+// Usage:
+//
+//	watermill-sql doctor -db /path/to/database.sqlite?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)
+//	watermill-sql profile -db /path/to/database.sqlite?_pragma=busy_timeout(5000)
+//
+// The doctor command checks the database with sql.SQLiteDoctor and prints the report.
+// It exits with status 1 if errors were found, and with status 2 if the database couldn't be checked.
+//
+// The profile command samples the messages of the topics with sql.SQLiteProfiler and prints their profiles
+// with the advice. It exits with status 2 if the database couldn't be profiled.
+package main
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	_ "modernc.org/sqlite"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "doctor":
+		os.Exit(doctor(os.Args[2:]))
+	case "profile":
+		os.Exit(profile(os.Args[2:]))
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: watermill-sql doctor -db <data source name> [flags]")
+	fmt.Fprintln(os.Stderr, "       watermill-sql profile -db <data source name> [flags]")
+}
+
+func doctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	dataSourceName := flags.String("db", "", "data source name of the SQLite database, with the pragmas used by the publishers and subscribers")
+	topics := flags.String("topics", "", "comma-separated topics to check (default: all topics)")
+	maxWALSize := flags.Int64("max-wal-size", 0, "size of the write-ahead log in bytes above which a warning is reported (default: 64 MiB)")
+	processesTable := flags.String("processes-table", "", "table name of SQLiteSettingsGuard, if it's overridden")
+	timeout := flags.Duration("timeout", time.Minute, "timeout of the checks")
+	_ = flags.Parse(args)
+
+	if *dataSourceName == "" {
+		fmt.Fprintln(os.Stderr, "-db is required")
+		return 2
+	}
+
+	db, err := stdSQL.Open("sqlite", *dataSourceName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open database: %v\n", err)
+		return 2
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	d := sql.SQLiteDoctor{
+		DB:                 sql.BeginnerFromStdSQL(db),
+		MaxWALSize:         *maxWALSize,
+		ProcessesTableName: *processesTable,
+	}
+	if *topics != "" {
+		d.Topics = strings.Split(*topics, ",")
+	}
+
+	report, err := d.Check(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not check database: %v\n", err)
+		return 2
+	}
+
+	fmt.Println(report)
+	if !report.Healthy() {
+		return 1
+	}
+
+	return 0
+}
+
+func profile(args []string) int {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	dataSourceName := flags.String("db", "", "data source name of the SQLite database")
+	topics := flags.String("topics", "", "comma-separated topics to profile (default: all topics)")
+	sampleSize := flags.Int("sample-size", 0, "maximum number of sampled messages of every topic (default: 200)")
+	timeout := flags.Duration("timeout", time.Minute, "timeout of profiling")
+	_ = flags.Parse(args)
+
+	if *dataSourceName == "" {
+		fmt.Fprintln(os.Stderr, "-db is required")
+		return 2
+	}
+
+	db, err := stdSQL.Open("sqlite", *dataSourceName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open database: %v\n", err)
+		return 2
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	p := sql.SQLiteProfiler{
+		DB:         sql.BeginnerFromStdSQL(db),
+		SampleSize: *sampleSize,
+	}
+
+	var profiles []sql.TopicProfile
+	if *topics == "" {
+		profiles, err = sql.ProfileTopics(ctx, p.DB)
+	} else {
+		for _, topic := range strings.Split(*topics, ",") {
+			var topicProfile sql.TopicProfile
+			topicProfile, err = p.Profile(ctx, topic)
+			if err != nil {
+				break
+			}
+			profiles = append(profiles, topicProfile)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not profile database: %v\n", err)
+		return 2
+	}
+
+	for _, topicProfile := range profiles {
+		printProfile(topicProfile)
+	}
+
+	return 0
+}
+
+func printProfile(p sql.TopicProfile) {
+	fmt.Printf("%s: %d messages, %d sampled\n", p.Topic, p.Messages, p.SampledMessages)
+	if p.SampledMessages == 0 {
+		return
+	}
+
+	s := p.PayloadSize
+	fmt.Printf("  payload size: min %d, p50 %d, p90 %d, p99 %d, max %d, mean %.0f bytes\n", s.Min, s.P50, s.P90, s.P99, s.Max, s.Mean)
+	fmt.Printf("  compression ratio: %.1fx\n", p.CompressionRatio)
+	for _, key := range p.MetadataKeys {
+		values := fmt.Sprint(key.DistinctValues)
+		if key.ValuesCapped {
+			values += "+"
+		}
+		fmt.Printf("  metadata %s: %d messages, %s distinct values\n", key.Key, key.Messages, values)
+	}
+	for _, advice := range p.Advice() {
+		fmt.Printf("  advice: %s\n", advice)
+	}
+}
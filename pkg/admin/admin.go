@@ -0,0 +1,286 @@
+// Package admin provides an embeddable web UI for inspecting topics backed by sql.TopicAdmin:
+// the list of topics with message counts, lag of consumer groups, peeking at messages,
+// requeueing messages parked by sql.PoisonPillDetector, and annotating messages
+// (if the topic admin implements sql.AnnotatingTopicAdmin).
+//
+// The handler can be mounted under any prefix with http.StripPrefix:
+//
+//	mux.Handle("/admin/", http.StripPrefix("/admin", admin.NewHandler(topicAdmin, logger)))
+//
+// The UI doesn't authenticate the users, and requeueing and annotating change the data,
+// so it should be wrapped with an authenticating middleware protecting against cross-site requests.
+package admin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+)
+
+const peekLimit = 20
+
+// Handler is the http.Handler serving the admin UI.
+type Handler struct {
+	admin  sql.TopicAdmin
+	logger watermill.LoggerAdapter
+}
+
+func NewHandler(admin sql.TopicAdmin, logger watermill.LoggerAdapter) *Handler {
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Handler{
+		admin:  admin,
+		logger: logger,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "" && r.Method == http.MethodGet:
+		h.topics(w, r)
+	case len(parts) == 2 && parts[0] == "topics" && r.Method == http.MethodGet:
+		h.topic(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "topics" && parts[2] == "requeue" && r.Method == http.MethodPost:
+		h.requeue(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "topics" && parts[2] == "annotate" && r.Method == http.MethodPost:
+		h.annotate(w, r, parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) topics(w http.ResponseWriter, r *http.Request) {
+	topics, err := h.admin.Topics(r.Context())
+	if err != nil {
+		h.respondError(w, "Could not get topics", err)
+		return
+	}
+
+	h.render(w, topicsTemplate, topics)
+}
+
+type topicPage struct {
+	Topic          string
+	ConsumerGroups []sql.ConsumerGroupLag
+	Messages       []peekedMessage
+	NextOffset     int64
+	Requeued       string
+	Annotated      string
+	Annotating     bool
+}
+
+type peekedMessage struct {
+	Offset      int64
+	UUID        string
+	Payload     string
+	Metadata    map[string]string
+	Parked      bool
+	Annotations []sql.MessageAnnotation
+}
+
+func (h *Handler) topic(w http.ResponseWriter, r *http.Request, topic string) {
+	ctx := r.Context()
+
+	var after int64
+	if value := r.URL.Query().Get("after"); value != "" {
+		var err error
+		after, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid after offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	groups, err := h.admin.ConsumerGroups(ctx, topic)
+	if err != nil {
+		h.respondError(w, "Could not get consumer groups", err)
+		return
+	}
+
+	messages, err := h.admin.PeekMessages(ctx, topic, after, peekLimit)
+	if err != nil {
+		h.respondError(w, "Could not peek messages", err)
+		return
+	}
+
+	page := topicPage{
+		Topic:          topic,
+		ConsumerGroups: groups,
+		Requeued:       r.URL.Query().Get("requeued"),
+		Annotated:      r.URL.Query().Get("annotated"),
+	}
+	_, page.Annotating = h.admin.(sql.AnnotatingTopicAdmin)
+	for _, m := range messages {
+		page.Messages = append(page.Messages, peekedMessage{
+			Offset:      m.Offset,
+			UUID:        m.Msg.UUID,
+			Payload:     prettyPayload(m.Msg.Payload),
+			Metadata:    m.Msg.Metadata,
+			Parked:      m.Msg.Metadata.Get(sql.PoisonPillTopicMetadataKey) != "",
+			Annotations: m.Annotations,
+		})
+	}
+	if len(messages) == peekLimit {
+		page.NextOffset = messages[len(messages)-1].Offset
+	}
+
+	h.render(w, topicTemplate, page)
+}
+
+func (h *Handler) requeue(w http.ResponseWriter, r *http.Request, topic string) {
+	uuid := r.PostFormValue("uuid")
+	if uuid == "" {
+		http.Error(w, "uuid is empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.admin.RequeueParkedMessage(r.Context(), topic, uuid); err != nil {
+		if errors.Is(err, sql.ErrMessageNotFound) {
+			http.Error(w, "message not found", http.StatusNotFound)
+			return
+		}
+		h.respondError(w, "Could not requeue message", err)
+		return
+	}
+
+	// The location is kept relative, as http.Redirect would resolve it against the path stripped of the mount prefix.
+	query := url.Values{"requeued": {uuid}}
+	w.Header().Set("Location", "../"+url.PathEscape(topic)+"?"+query.Encode())
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+func (h *Handler) annotate(w http.ResponseWriter, r *http.Request, topic string) {
+	annotatingAdmin, ok := h.admin.(sql.AnnotatingTopicAdmin)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	uuid := r.PostFormValue("uuid")
+	if uuid == "" {
+		http.Error(w, "uuid is empty", http.StatusBadRequest)
+		return
+	}
+	key := r.PostFormValue("key")
+	if key == "" {
+		http.Error(w, "key is empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := annotatingAdmin.Annotate(r.Context(), topic, uuid, key, r.PostFormValue("value")); err != nil {
+		if errors.Is(err, sql.ErrMessageNotFound) {
+			http.Error(w, "message not found", http.StatusNotFound)
+			return
+		}
+		h.respondError(w, "Could not annotate message", err)
+		return
+	}
+
+	query := url.Values{"annotated": {uuid}}
+	w.Header().Set("Location", "../"+url.PathEscape(topic)+"?"+query.Encode())
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+func (h *Handler) render(w http.ResponseWriter, tmpl *template.Template, data any) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		h.respondError(w, "Could not render page", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
+
+func (h *Handler) respondError(w http.ResponseWriter, msg string, err error) {
+	h.logger.Error(msg, err, nil)
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+// prettyPayload indents JSON payloads. Payloads which are not valid UTF-8 are shown in hex.
+func prettyPayload(payload []byte) string {
+	var indented bytes.Buffer
+	if json.Valid(payload) && json.Indent(&indented, payload, "", "  ") == nil {
+		return indented.String()
+	}
+	if utf8.Valid(payload) {
+		return string(payload)
+	}
+
+	return "0x" + hex.EncodeToString(payload)
+}
+
+const layout = `{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Watermill SQL</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+pre { margin: 0; max-width: 60em; overflow: auto; }
+.notice { background: #e6ffe6; padding: 0.5em; }
+.annotation { background: #fff5cc; }
+</style>
+</head>
+<body>
+{{end}}
+{{define "footer"}}</body>
+</html>
+{{end}}`
+
+var topicsTemplate = template.Must(template.Must(template.New("layout").Parse(layout)).New("topics").Parse(
+	`{{template "header"}}
+<h1>Topics</h1>
+<table>
+<tr><th>Topic</th><th>Messages</th><th>Last offset</th></tr>
+{{range .}}<tr><td><a href="topics/{{.Topic}}">{{.Topic}}</a></td><td>{{.Messages}}</td><td>{{.LastOffset}}</td></tr>
+{{else}}<tr><td colspan="3">No topics</td></tr>
+{{end}}</table>
+{{template "footer"}}`,
+))
+
+var topicTemplate = template.Must(template.Must(template.New("layout").Parse(layout)).New("topic").Parse(
+	`{{template "header"}}
+<p><a href="../">All topics</a></p>
+<h1>{{.Topic}}</h1>
+{{if .Requeued}}<p class="notice">Message {{.Requeued}} was requeued.</p>{{end}}
+{{if .Annotated}}<p class="notice">Message {{.Annotated}} was annotated.</p>{{end}}
+<h2>Consumer groups</h2>
+<table>
+<tr><th>Consumer group</th><th>Acked offset</th><th>Lag</th></tr>
+{{range .ConsumerGroups}}<tr><td>{{if .ConsumerGroup}}{{.ConsumerGroup}}{{else}}<i>default</i>{{end}}</td><td>{{.OffsetAcked}}</td><td>{{.Lag}}</td></tr>
+{{else}}<tr><td colspan="3">No consumer groups</td></tr>
+{{end}}</table>
+<h2>Messages</h2>
+<table>
+<tr><th>Offset</th><th>UUID</th><th>Metadata</th><th>Payload</th><th>Annotations</th><th></th></tr>
+{{range .Messages}}<tr>
+<td>{{.Offset}}</td>
+<td>{{.UUID}}</td>
+<td>{{range $key, $value := .Metadata}}{{$key}}: {{$value}}<br>{{end}}</td>
+<td><pre>{{.Payload}}</pre></td>
+<td>{{range .Annotations}}<span class="annotation" title="{{.AnnotatedAt.Format "2006-01-02 15:04:05 MST"}}">{{.Key}}: {{.Value}}</span><br>{{end}}
+{{if $.Annotating}}<form method="post" action="{{$.Topic}}/annotate"><input type="hidden" name="uuid" value="{{.UUID}}"><input name="key" placeholder="key" required><input name="value" placeholder="value (empty removes)"><button type="submit">Annotate</button></form>{{end}}</td>
+<td>{{if .Parked}}<form method="post" action="{{$.Topic}}/requeue"><input type="hidden" name="uuid" value="{{.UUID}}"><button type="submit">Requeue</button></form>{{end}}</td>
+</tr>
+{{else}}<tr><td colspan="6">No messages</td></tr>
+{{end}}</table>
+{{if .NextOffset}}<p><a href="?after={{.NextOffset}}">Next messages</a></p>{{end}}
+{{template "footer"}}`,
+))
@@ -0,0 +1,154 @@
+package admin_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/admin"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func TestHandler(t *testing.T) {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "admin.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer db.Close()
+
+	logger := watermill.NewStdLogger(false, false)
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		ConsumerGroup:    "workers",
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	topic := "orders"
+	parkTopic := "orders_poison_pills"
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte(`{"id":1}`))))
+
+	parked := message.NewMessage(watermill.NewUUID(), []byte(`{"id":2}`))
+	parked.Metadata.Set(sql.PoisonPillTopicMetadataKey, topic)
+	parked.Metadata.Set(sql.PoisonPillFingerprintMetadataKey, sql.PayloadFingerprint(parked))
+	require.NoError(t, publisher.Publish(parkTopic, parked))
+
+	messages, err := subscriber.Subscribe(context.Background(), topic)
+	require.NoError(t, err)
+
+	select {
+	case msg := <-messages:
+		msg.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("no message received")
+	}
+
+	// Wait until the ack is committed, as the transaction of an unacked message is discarded on close.
+	require.Eventually(t, func() bool {
+		var offsetAcked int64
+		err := db.QueryRow(`SELECT offset_acked FROM "watermill_offsets_orders" WHERE consumer_group = 'workers'`).Scan(&offsetAcked)
+		return err == nil && offsetAcked == 1
+	}, time.Second*5, time.Millisecond*10)
+	require.NoError(t, subscriber.Close())
+
+	// The reporting consumer group hasn't acked anything, so it lags.
+	require.NoError(t, sql.ImportCheckpoint(context.Background(), sql.BeginnerFromStdSQL(db), nil, sql.DefaultSQLiteOffsetsAdapter{}, topic, sql.Checkpoint{
+		ConsumerGroups: []sql.ConsumerGroupCheckpoint{{ConsumerGroup: "reporting", OffsetAcked: 0}},
+	}))
+
+	topicAdmin := sql.SQLiteTopicAdmin{
+		DB:        sql.BeginnerFromStdSQL(db),
+		Publisher: publisher,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", http.StripPrefix("/admin", admin.NewHandler(topicAdmin, logger)))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string) string {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return string(body)
+	}
+
+	topicsPage := get("/admin/")
+	assert.Contains(t, topicsPage, `href="topics/orders"`)
+	assert.Contains(t, topicsPage, `href="topics/orders_poison_pills"`)
+	assert.NotContains(t, topicsPage, "watermill_offsets")
+
+	topicPage := get("/admin/topics/orders")
+	assert.Contains(t, topicPage, "<td>workers</td><td>1</td><td>0</td>")
+	assert.Contains(t, topicPage, "<td>reporting</td><td>0</td><td>1</td>", "lagging consumer group should be displayed with its lag")
+	assert.Contains(t, topicPage, "&#34;id&#34;: 1")
+	assert.NotContains(t, topicPage, "Requeue")
+
+	assert.Contains(t, topicPage, "Annotate")
+
+	resp, err := http.PostForm(server.URL+"/admin/topics/orders/annotate", url.Values{
+		"uuid":  {peekedOrders(t, topicAdmin)},
+		"key":   {"status"},
+		"value": {"skipped manually"},
+	})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/admin/topics/orders", resp.Request.URL.Path)
+	assert.Contains(t, get("/admin/topics/orders"), "status: skipped manually")
+
+	parkPage := get("/admin/topics/orders_poison_pills")
+	assert.Contains(t, parkPage, "Requeue")
+
+	resp, err = http.PostForm(server.URL+"/admin/topics/orders_poison_pills/requeue", url.Values{"uuid": {parked.UUID}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/admin/topics/orders_poison_pills", resp.Request.URL.Path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	peeked, err := topicAdmin.PeekMessages(ctx, topic, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, peeked, 1)
+	assert.Equal(t, parked.UUID, peeked[0].Msg.UUID)
+	assert.Empty(t, peeked[0].Msg.Metadata.Get(sql.PoisonPillTopicMetadataKey))
+
+	resp, err = http.PostForm(server.URL+"/admin/topics/orders_poison_pills/requeue", url.Values{"uuid": {"missing"}})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func peekedOrders(t *testing.T, topicAdmin sql.TopicAdmin) string {
+	peeked, err := topicAdmin.PeekMessages(context.Background(), "orders", 0, 1)
+	require.NoError(t, err)
+	require.Len(t, peeked, 1)
+
+	return peeked[0].Msg.UUID
+}
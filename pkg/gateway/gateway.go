@@ -0,0 +1,296 @@
+// Package gateway exposes Watermill publishers and subscribers (for example, the SQL Publisher and Subscriber)
+// over HTTP and gRPC, so processes which can't use the Go library (scripts, services written in other languages)
+// can produce and consume messages of the same topics.
+//
+// Messages are published with:
+//
+//	POST /topics/{topic}/messages
+//	{"messages": [{"uuid": "...", "payload": "<base64>", "metadata": {"key": "value"}}]}
+//
+// and consumed as a stream of Server-Sent Events with:
+//
+//	GET /topics/{topic}/messages
+//
+// Every event has the message's UUID as its ID and the JSON-encoded message as its data.
+// A message is acked once the event is written to the client, so messages may be re-delivered
+// to another client if the connection breaks.
+//
+// Payloads are base64-encoded in JSON (as encoding/json encodes []byte), so binary payloads are preserved.
+//
+// The same Server serves the Publish and the server-streaming Subscribe methods of the gRPC service
+// defined in gateway.proto to requests with the application/grpc content type. gRPC runs over HTTP/2,
+// so the Server must be served with TLS (like with http.Server.ServeTLS) for gRPC clients.
+// The gRPC transport is implemented with the standard library only, so the module doesn't depend
+// on the gRPC and protobuf modules; compressed gRPC messages are not supported.
+//
+// The gateway doesn't authenticate the clients, so it should be wrapped with an authenticating middleware,
+// or served only on a trusted network.
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	// Publisher publishes the messages posted by clients. It's required.
+	Publisher message.Publisher
+
+	// Subscriber subscribes to the topics streamed to clients. It's required.
+	//
+	// All clients streaming a topic share the subscriber's consumer group, so every message
+	// is delivered to one of them.
+	Subscriber message.Subscriber
+
+	// AllowTopic may be used to restrict the topics available to clients.
+	// By default, all topics are available.
+	AllowTopic func(r *http.Request, topic string) bool
+
+	// KeepAliveInterval is the interval of comments sent to idle streams, so proxies don't close them.
+	//
+	// Default value is 15s.
+	KeepAliveInterval time.Duration
+
+	// MaxPublishedBytes limits the size of the body of publish requests.
+	//
+	// Default value is 10 MiB.
+	MaxPublishedBytes int64
+}
+
+func (c *Config) setDefaults() {
+	if c.AllowTopic == nil {
+		c.AllowTopic = func(r *http.Request, topic string) bool {
+			return true
+		}
+	}
+	if c.KeepAliveInterval == 0 {
+		c.KeepAliveInterval = 15 * time.Second
+	}
+	if c.MaxPublishedBytes == 0 {
+		c.MaxPublishedBytes = 10 << 20
+	}
+}
+
+func (c Config) validate() error {
+	if c.Publisher == nil {
+		return errors.New("publisher is nil")
+	}
+	if c.Subscriber == nil {
+		return errors.New("subscriber is nil")
+	}
+	if c.KeepAliveInterval <= 0 {
+		return errors.New("keep alive interval must be a positive duration")
+	}
+
+	return nil
+}
+
+// Server is the http.Handler exposing publishing and subscribing over HTTP and gRPC.
+type Server struct {
+	config Config
+	logger watermill.LoggerAdapter
+}
+
+func NewServer(config Config, logger watermill.LoggerAdapter) (*Server, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Server{
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// Message is the representation of a message exchanged with clients.
+type Message struct {
+	// UUID of the message. When publishing, a new UUID is generated if it's empty.
+	UUID string `json:"uuid"`
+
+	Payload  []byte            `json:"payload"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// PublishRequest is the body of publish requests.
+type PublishRequest struct {
+	Messages []Message `json:"messages"`
+}
+
+// PublishResponse is the body of responses to publish requests.
+type PublishResponse struct {
+	// UUIDs of the published messages.
+	UUIDs []string `json:"uuids"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isGRPCRequest(r) {
+		s.serveGRPC(w, r)
+		return
+	}
+
+	topic, ok := topicFromPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.config.AllowTopic(r, topic) {
+		http.Error(w, "topic not allowed", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		s.publish(w, r, topic)
+	case http.MethodGet:
+		s.subscribe(w, r, topic)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// topicFromPath extracts the topic from the /topics/{topic}/messages path.
+func topicFromPath(path string) (string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "topics" || parts[1] == "" || parts[2] != "messages" {
+		return "", false
+	}
+
+	return parts[1], true
+}
+
+func (s *Server) publish(w http.ResponseWriter, r *http.Request, topic string) {
+	var req PublishRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.config.MaxPublishedBytes)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Messages) == 0 {
+		http.Error(w, "no messages", http.StatusBadRequest)
+		return
+	}
+
+	msgs, uuids, err := newMessages(r, req.Messages)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.config.Publisher.Publish(topic, msgs...); err != nil {
+		s.logger.Error("Could not publish messages", err, watermill.LogFields{"topic": topic})
+		http.Error(w, "could not publish messages", http.StatusInternalServerError)
+		return
+	}
+	resp := PublishResponse{UUIDs: uuids}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.logger.Error("Could not write publish response", err, nil)
+	}
+}
+
+// newMessages creates the published messages, returning their UUIDs.
+func newMessages(r *http.Request, messages []Message) ([]*message.Message, []string, error) {
+	msgs := make([]*message.Message, len(messages))
+	uuids := make([]string, len(messages))
+	for i, m := range messages {
+		uuid := m.UUID
+		if uuid == "" {
+			uuid = watermill.NewUUID()
+		}
+		if strings.ContainsAny(uuid, "\r\n") {
+			return nil, nil, errors.New("invalid message uuid")
+		}
+
+		msg := message.NewMessage(uuid, m.Payload)
+		for k, v := range m.Metadata {
+			msg.Metadata.Set(k, v)
+		}
+		msg.SetContext(r.Context())
+
+		msgs[i] = msg
+		uuids[i] = uuid
+	}
+
+	return msgs, uuids, nil
+}
+
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request, topic string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	logger := s.logger.With(watermill.LogFields{"topic": topic})
+
+	messages, err := s.config.Subscriber.Subscribe(ctx, topic)
+	if err != nil {
+		logger.Error("Could not subscribe", err, nil)
+		http.Error(w, "could not subscribe", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(s.config.KeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			if err := writeEvent(w, msg); err != nil {
+				logger.Debug("Could not write message to client, nacking", watermill.LogFields{
+					"uuid": msg.UUID,
+					"err":  err.Error(),
+				})
+				msg.Nack()
+				return
+			}
+			flusher.Flush()
+			msg.Ack()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, msg *message.Message) error {
+	data, err := json.Marshal(Message{
+		UUID:     msg.UUID,
+		Payload:  msg.Payload,
+		Metadata: msg.Metadata,
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not marshal message")
+	}
+
+	// UUIDs and JSON don't contain new lines, so the event doesn't need to be split into multiple data lines.
+	_, err = fmt.Fprintf(w, "id: %s\nevent: message\ndata: %s\n\n", msg.UUID, data)
+	return err
+}
@@ -0,0 +1,119 @@
+package gateway_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	stdSQL "database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/gateway"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+// binaryPayload isn't valid UTF-8, so it would be mangled if payloads were passed as JSON strings.
+var binaryPayload = []byte{0xff, 0x00, 0xfe, '\n'}
+
+func TestServer(t *testing.T) {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "gateway.sqlite"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	logger := watermill.NewStdLogger(false, false)
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	server, err := gateway.NewServer(gateway.Config{
+		Publisher:  publisher,
+		Subscriber: subscriber,
+		AllowTopic: func(r *http.Request, topic string) bool {
+			return topic != "forbidden"
+		},
+	}, logger)
+	require.NoError(t, err)
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	topic := "topic_" + watermill.NewShortUUID()
+	messagesURL := httpServer.URL + "/topics/" + topic + "/messages"
+
+	body, err := json.Marshal(gateway.PublishRequest{
+		Messages: []gateway.Message{
+			{UUID: "first", Payload: []byte(`{"n":1}`), Metadata: map[string]string{"key": "value"}},
+			{Payload: binaryPayload},
+		},
+	})
+	require.NoError(t, err)
+
+	resp, err := http.Post(messagesURL, "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var published gateway.PublishResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&published))
+	_ = resp.Body.Close()
+	require.Len(t, published.UUIDs, 2)
+	assert.Equal(t, "first", published.UUIDs[0])
+	assert.NotEmpty(t, published.UUIDs[1])
+
+	resp, err = http.Post(httpServer.URL+"/topics/forbidden/messages", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, messagesURL, nil)
+	require.NoError(t, err)
+
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var received []gateway.Message
+	var ids []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(received) < 2 && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			ids = append(ids, strings.TrimPrefix(line, "id: "))
+		case strings.HasPrefix(line, "data: "):
+			var msg gateway.Message
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &msg))
+			received = append(received, msg)
+		}
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, received, 2)
+	assert.Equal(t, published.UUIDs, ids)
+	assert.Equal(t, gateway.Message{UUID: "first", Payload: []byte(`{"n":1}`), Metadata: map[string]string{"key": "value"}}, received[0])
+	assert.Equal(t, binaryPayload, received[1].Payload)
+}
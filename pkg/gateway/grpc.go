@@ -0,0 +1,227 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// Paths of the methods of the Gateway service of gateway.proto.
+const (
+	grpcPublishPath   = "/watermill.sql.gateway.v1.Gateway/Publish"
+	grpcSubscribePath = "/watermill.sql.gateway.v1.Gateway/Subscribe"
+)
+
+// gRPC status codes, see https://grpc.github.io/grpc/core/md_doc_statuscodes.html.
+const (
+	grpcCodeOK                = 0
+	grpcCodeInvalidArgument   = 3
+	grpcCodePermissionDenied  = 7
+	grpcCodeResourceExhausted = 8
+	grpcCodeUnimplemented     = 12
+	grpcCodeInternal          = 13
+	grpcCodeUnavailable       = 14
+)
+
+type grpcStatus struct {
+	code    int
+	message string
+}
+
+func (s grpcStatus) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", s.code, s.message)
+}
+
+func isGRPCRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// serveGRPC serves the request of a gRPC client, following https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md.
+func (s *Server) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	var err error
+	switch contentType := r.Header.Get("Content-Type"); {
+	case contentType != "application/grpc" && contentType != "application/grpc+proto":
+		err = grpcStatus{grpcCodeUnimplemented, "unsupported content type " + contentType}
+	case r.URL.Path == grpcPublishPath:
+		err = s.grpcPublish(w, r)
+	case r.URL.Path == grpcSubscribePath:
+		err = s.grpcSubscribe(w, r)
+	default:
+		err = grpcStatus{grpcCodeUnimplemented, "unknown method " + r.URL.Path}
+	}
+
+	status := grpcStatus{code: grpcCodeOK}
+	if err != nil && !errors.As(err, &status) {
+		status = grpcStatus{grpcCodeInternal, err.Error()}
+	}
+
+	w.Header().Set("Grpc-Status", strconv.Itoa(status.code))
+	if status.message != "" {
+		w.Header().Set("Grpc-Message", encodeGRPCMessage(status.message))
+	}
+}
+
+func (s *Server) grpcPublish(w http.ResponseWriter, r *http.Request) error {
+	body, err := readGRPCMessage(r.Body, s.config.MaxPublishedBytes)
+	if err != nil {
+		return err
+	}
+
+	topic, req, err := unmarshalProtoPublishRequest(body)
+	if err != nil {
+		return grpcStatus{grpcCodeInvalidArgument, "invalid request: " + err.Error()}
+	}
+	if err := s.allowGRPCTopic(r, topic); err != nil {
+		return err
+	}
+	if len(req.Messages) == 0 {
+		return grpcStatus{grpcCodeInvalidArgument, "no messages"}
+	}
+
+	msgs, uuids, err := newMessages(r, req.Messages)
+	if err != nil {
+		return grpcStatus{grpcCodeInvalidArgument, err.Error()}
+	}
+
+	if err := s.config.Publisher.Publish(topic, msgs...); err != nil {
+		s.logger.Error("Could not publish messages", err, watermill.LogFields{"topic": topic})
+		return grpcStatus{grpcCodeInternal, "could not publish messages"}
+	}
+
+	if err := writeGRPCMessage(w, marshalProtoPublishResponse(PublishResponse{UUIDs: uuids})); err != nil {
+		s.logger.Error("Could not write publish response", err, nil)
+	}
+
+	return nil
+}
+
+func (s *Server) grpcSubscribe(w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return grpcStatus{grpcCodeInternal, "streaming is not supported"}
+	}
+
+	body, err := readGRPCMessage(r.Body, s.config.MaxPublishedBytes)
+	if err != nil {
+		return err
+	}
+
+	topic, err := unmarshalProtoSubscribeRequest(body)
+	if err != nil {
+		return grpcStatus{grpcCodeInvalidArgument, "invalid request: " + err.Error()}
+	}
+	if err := s.allowGRPCTopic(r, topic); err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	logger := s.logger.With(watermill.LogFields{"topic": topic})
+
+	messages, err := s.config.Subscriber.Subscribe(ctx, topic)
+	if err != nil {
+		logger.Error("Could not subscribe", err, nil)
+		return grpcStatus{grpcCodeInternal, "could not subscribe"}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return grpcStatus{grpcCodeUnavailable, "subscriber closed"}
+			}
+
+			err := writeGRPCMessage(w, marshalProtoMessage(nil, Message{
+				UUID:     msg.UUID,
+				Payload:  msg.Payload,
+				Metadata: msg.Metadata,
+			}))
+			if err != nil {
+				logger.Debug("Could not write message to client, nacking", watermill.LogFields{
+					"uuid": msg.UUID,
+					"err":  err.Error(),
+				})
+				msg.Nack()
+				return nil
+			}
+			flusher.Flush()
+			msg.Ack()
+		}
+	}
+}
+
+func (s *Server) allowGRPCTopic(r *http.Request, topic string) error {
+	if topic == "" {
+		return grpcStatus{grpcCodeInvalidArgument, "topic is empty"}
+	}
+	if !s.config.AllowTopic(r, topic) {
+		return grpcStatus{grpcCodePermissionDenied, "topic not allowed"}
+	}
+
+	return nil
+}
+
+// readGRPCMessage reads a length-prefixed message of a gRPC stream.
+func readGRPCMessage(r io.Reader, maxBytes int64) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, grpcStatus{grpcCodeInvalidArgument, "could not read message: " + err.Error()}
+	}
+	if prefix[0] != 0 {
+		return nil, grpcStatus{grpcCodeUnimplemented, "compressed messages are not supported"}
+	}
+
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if int64(length) > maxBytes {
+		return nil, grpcStatus{grpcCodeResourceExhausted, "message is too large"}
+	}
+
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, grpcStatus{grpcCodeInvalidArgument, "could not read message: " + err.Error()}
+	}
+
+	return msg, nil
+}
+
+// writeGRPCMessage writes a length-prefixed, uncompressed message of a gRPC stream.
+func writeGRPCMessage(w io.Writer, msg []byte) error {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+
+	_, err := w.Write(append(b, msg...))
+	return err
+}
+
+// encodeGRPCMessage percent-encodes the status message, as required for the grpc-message trailer.
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	stdSQL "database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func TestServer_grpc(t *testing.T) {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "gateway.sqlite"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	logger := watermill.NewStdLogger(false, false)
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	server, err := NewServer(Config{
+		Publisher:  publisher,
+		Subscriber: subscriber,
+		AllowTopic: func(r *http.Request, topic string) bool {
+			return topic != "forbidden"
+		},
+	}, logger)
+	require.NoError(t, err)
+
+	httpServer := httptest.NewUnstartedServer(server)
+	httpServer.EnableHTTP2 = true
+	httpServer.StartTLS()
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	call := func(ctx context.Context, path string, request []byte) *http.Response {
+		var body bytes.Buffer
+		require.NoError(t, writeGRPCMessage(&body, request))
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, httpServer.URL+path, &body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("TE", "trailers")
+
+		resp, err := httpServer.Client().Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, 2, resp.ProtoMajor)
+
+		return resp
+	}
+
+	topic := "topic_" + watermill.NewShortUUID()
+	binaryPayload := []byte{0xff, 0x00, 0xfe, '\n'}
+
+	publishRequest := appendProtoString(nil, 1, topic)
+	publishRequest = appendProtoBytes(publishRequest, 2, marshalProtoMessage(nil, Message{
+		UUID:     "first",
+		Payload:  []byte(`{"n":1}`),
+		Metadata: map[string]string{"key": "value"},
+	}))
+	publishRequest = appendProtoBytes(publishRequest, 2, marshalProtoMessage(nil, Message{Payload: binaryPayload}))
+
+	resp := call(ctx, grpcPublishPath, publishRequest)
+	msg, err := readGRPCMessage(resp.Body, 1<<20)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, "0", resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message"))
+
+	var uuids []string
+	require.NoError(t, readProtoFields(msg, func(field int, value []byte) error {
+		if field == 1 {
+			uuids = append(uuids, string(value))
+		}
+		return nil
+	}))
+	require.Len(t, uuids, 2)
+	assert.Equal(t, "first", uuids[0])
+	assert.NotEmpty(t, uuids[1])
+
+	resp = call(ctx, grpcSubscribePath, appendProtoString(nil, 1, "forbidden"))
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, "7", resp.Trailer.Get("Grpc-Status"))
+	assert.Equal(t, "topic not allowed", resp.Trailer.Get("Grpc-Message"))
+
+	subscribeCtx, cancelSubscribe := context.WithCancel(ctx)
+	defer cancelSubscribe()
+
+	resp = call(subscribeCtx, grpcSubscribePath, appendProtoString(nil, 1, topic))
+	defer resp.Body.Close()
+
+	var received []Message
+	for len(received) < 2 {
+		msg, err := readGRPCMessage(resp.Body, 1<<20)
+		require.NoError(t, err)
+
+		m, err := unmarshalProtoMessage(msg)
+		require.NoError(t, err)
+		received = append(received, m)
+	}
+
+	assert.Equal(t, Message{UUID: "first", Payload: []byte(`{"n":1}`), Metadata: map[string]string{"key": "value"}}, received[0])
+	assert.Equal(t, uuids[1], received[1].UUID)
+	assert.Equal(t, binaryPayload, received[1].Payload)
+}
+
+func TestEncodeGRPCMessage(t *testing.T) {
+	assert.Equal(t, "topic not allowed", encodeGRPCMessage("topic not allowed"))
+	assert.Equal(t, "100%25 %0A%C3%A9", encodeGRPCMessage("100% \né"))
+}
@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// The messages of gateway.proto are encoded and decoded by hand, as they only have string, bytes
+// and embedded message fields, all of which use the length-delimited wire type.
+// See https://protobuf.dev/programming-guides/encoding/.
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+func appendProtoBytes(b []byte, field int, value []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|protoWireBytes)
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func appendProtoString(b []byte, field int, value string) []byte {
+	if value == "" {
+		return b
+	}
+
+	return appendProtoBytes(b, field, []byte(value))
+}
+
+// readProtoFields calls fn with the number and the value of every length-delimited field of the encoded message.
+// Fields of other wire types are skipped.
+func readProtoFields(b []byte, fn func(field int, value []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		b = b[n:]
+
+		switch key & 7 {
+		case protoWireVarint:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return errors.New("invalid varint field")
+			}
+			b = b[n:]
+		case protoWireFixed64:
+			if len(b) < 8 {
+				return errors.New("invalid fixed64 field")
+			}
+			b = b[8:]
+		case protoWireFixed32:
+			if len(b) < 4 {
+				return errors.New("invalid fixed32 field")
+			}
+			b = b[4:]
+		case protoWireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || length > uint64(len(b)-n) {
+				return errors.New("invalid length-delimited field")
+			}
+			value := b[n : n+int(length)]
+			b = b[n+int(length):]
+
+			if err := fn(int(key>>3), value); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("unsupported wire type %d", key&7)
+		}
+	}
+
+	return nil
+}
+
+func marshalProtoMessage(b []byte, m Message) []byte {
+	b = appendProtoString(b, 1, m.UUID)
+	if len(m.Payload) > 0 {
+		b = appendProtoBytes(b, 2, m.Payload)
+	}
+	for k, v := range m.Metadata {
+		var entry []byte
+		entry = appendProtoString(entry, 1, k)
+		entry = appendProtoString(entry, 2, v)
+		b = appendProtoBytes(b, 3, entry)
+	}
+
+	return b
+}
+
+func unmarshalProtoMessage(b []byte) (Message, error) {
+	var m Message
+	err := readProtoFields(b, func(field int, value []byte) error {
+		switch field {
+		case 1:
+			m.UUID = string(value)
+		case 2:
+			m.Payload = append([]byte(nil), value...)
+		case 3:
+			var k, v string
+			err := readProtoFields(value, func(field int, value []byte) error {
+				switch field {
+				case 1:
+					k = string(value)
+				case 2:
+					v = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return errors.Wrap(err, "invalid metadata entry")
+			}
+
+			if m.Metadata == nil {
+				m.Metadata = map[string]string{}
+			}
+			m.Metadata[k] = v
+		}
+		return nil
+	})
+
+	return m, err
+}
+
+func unmarshalProtoPublishRequest(b []byte) (string, PublishRequest, error) {
+	var topic string
+	var req PublishRequest
+	err := readProtoFields(b, func(field int, value []byte) error {
+		switch field {
+		case 1:
+			topic = string(value)
+		case 2:
+			m, err := unmarshalProtoMessage(value)
+			if err != nil {
+				return errors.Wrap(err, "invalid message")
+			}
+			req.Messages = append(req.Messages, m)
+		}
+		return nil
+	})
+
+	return topic, req, err
+}
+
+func marshalProtoPublishResponse(resp PublishResponse) []byte {
+	var b []byte
+	for _, uuid := range resp.UUIDs {
+		b = appendProtoBytes(b, 1, []byte(uuid))
+	}
+
+	return b
+}
+
+func unmarshalProtoSubscribeRequest(b []byte) (string, error) {
+	var topic string
+	err := readProtoFields(b, func(field int, value []byte) error {
+		if field == 1 {
+			topic = string(value)
+		}
+		return nil
+	})
+
+	return topic, err
+}
@@ -0,0 +1,486 @@
+// Package simulation provides a harness running publishers and subscribers of a topic with controlled scheduling
+// and checking the delivery guarantees of the Pub/Sub: no lost messages, no duplicates and ordering.
+//
+// Only one step (handing a message to a publisher, or receiving and acking or nacking a message by a subscriber)
+// runs at a time, and the next actor is chosen with a seeded random source. The decisions made by the harness
+// are reproducible with the same seed, while the goroutines of the subscribers (and the database) are not controlled,
+// so a failing run may need to be repeated a few times.
+//
+// Every publishing actor publishes in its own goroutine, in the order in which the harness hands it the messages.
+// Publishing doesn't block the harness, as a subscriber holding a delivered message may hold a lock
+// blocking the publishers, like the write lock of SQLite.
+//
+// The guarantees provided by the sql package depend on the offsets adapter:
+//
+//   - Default offsets adapters consuming in a transaction (DefaultMySQLOffsetsAdapter, DefaultPostgreSQLOffsetsAdapter,
+//     DefaultSQLiteOffsetsAdapter, DefaultMSSQLOffsetsAdapter and DialectOffsetsAdapter) provide GuaranteeExactlyOnce:
+//     the offset is acked in the same transaction which locks the consumer group, so every message is acked once,
+//     and the messages of a consumer group are acked in the order of publishing by any number of subscribers.
+//     A nacked message is re-delivered before any later message.
+//   - NonTransactionalOffsetsAdapter and OptimisticOffsetsAdapter implementations (like DefaultD1OffsetsAdapter)
+//     provide GuaranteeAtLeastOnce: no message is lost, but a message is re-delivered when its ack
+//     fails or when handling it takes longer than the claim timeout, and messages may be acked out of order
+//     by concurrent subscribers.
+//
+// Messages are acked in the order of publishing only within a single publisher: messages published concurrently
+// are ordered by the offsets assigned by the database.
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PublisherMetadataKey is the metadata key with the index of the simulated publisher which published the message.
+	PublisherMetadataKey = "_watermill_simulation_publisher"
+
+	// SequenceMetadataKey is the metadata key with the sequence number of the message within its publisher.
+	SequenceMetadataKey = "_watermill_simulation_sequence"
+)
+
+// Guarantee is the set of invariants checked by Report.Check.
+type Guarantee int
+
+const (
+	// GuaranteeAtLeastOnce checks that every published message was acked.
+	GuaranteeAtLeastOnce Guarantee = iota
+
+	// GuaranteeExactlyOnce checks that every published message was acked exactly once,
+	// and that the messages of every publisher were acked in the order of publishing.
+	GuaranteeExactlyOnce
+)
+
+type Config struct {
+	// Topic is the topic used by the simulation. It's required.
+	Topic string
+
+	// NewPublisher creates a publisher of a simulated publishing actor. It's required.
+	NewPublisher func() (message.Publisher, error)
+
+	// NewSubscriber creates a subscriber of a simulated consuming actor. It's required.
+	// All subscribers should consume the topic as one consumer group.
+	NewSubscriber func() (message.Subscriber, error)
+
+	// Publishers is the number of publishing actors.
+	//
+	// Default value is 2.
+	Publishers int
+
+	// Subscribers is the number of consuming actors.
+	//
+	// Default value is 2.
+	Subscribers int
+
+	// MessagesPerPublisher is the number of messages published by every publishing actor.
+	//
+	// Default value is 50.
+	MessagesPerPublisher int
+
+	// NackProbability is the probability (from 0 to 1) of nacking a received message instead of acking it.
+	NackProbability float64
+
+	// Seed seeds the random source choosing the actors and nacked messages.
+	//
+	// If it's 0, the current time is used. The used seed is returned in Report.
+	Seed int64
+
+	// StepTimeout is the time a consuming actor waits for a message in its step.
+	//
+	// Default value is 10ms.
+	StepTimeout time.Duration
+
+	// DrainDuration is the time for which subscribers keep consuming after all messages were acked,
+	// so duplicates delivered late are detected.
+	//
+	// Default value is 200ms.
+	DrainDuration time.Duration
+
+	// Timeout is the maximum duration of the simulation. Messages which were not acked
+	// within it are reported as lost.
+	//
+	// Default value is 30s.
+	Timeout time.Duration
+}
+
+func (c *Config) setDefaults() {
+	if c.Publishers == 0 {
+		c.Publishers = 2
+	}
+	if c.Subscribers == 0 {
+		c.Subscribers = 2
+	}
+	if c.MessagesPerPublisher == 0 {
+		c.MessagesPerPublisher = 50
+	}
+	if c.Seed == 0 {
+		c.Seed = time.Now().UnixNano()
+	}
+	if c.StepTimeout == 0 {
+		c.StepTimeout = time.Millisecond * 10
+	}
+	if c.DrainDuration == 0 {
+		c.DrainDuration = time.Millisecond * 200
+	}
+	if c.Timeout == 0 {
+		c.Timeout = time.Second * 30
+	}
+}
+
+func (c Config) validate() error {
+	if c.Topic == "" {
+		return errors.New("topic is empty")
+	}
+	if c.NewPublisher == nil {
+		return errors.New("new publisher func is nil")
+	}
+	if c.NewSubscriber == nil {
+		return errors.New("new subscriber func is nil")
+	}
+	if c.Publishers < 0 || c.Subscribers <= 0 || c.MessagesPerPublisher < 0 {
+		return errors.New("numbers of publishers and messages must be non-negative, and number of subscribers positive")
+	}
+	if c.NackProbability < 0 || c.NackProbability >= 1 {
+		return errors.New("nack probability must be between 0 and 1 (exclusive)")
+	}
+	if c.StepTimeout < 0 || c.DrainDuration < 0 || c.Timeout < 0 {
+		return errors.New("durations must be non-negative")
+	}
+
+	return nil
+}
+
+// Report is the outcome of the simulation.
+type Report struct {
+	// Seed is the seed of the random source used by the simulation.
+	Seed int64
+
+	Published int
+	Delivered int
+	Acked     int
+	Nacked    int
+
+	// Lost are the UUIDs of messages handed to the publishers which were never acked.
+	Lost []string
+
+	// Duplicated are the UUIDs of messages which were acked more than once.
+	Duplicated []string
+
+	// OutOfOrder are the UUIDs of messages acked before an earlier message of the same publisher.
+	OutOfOrder []string
+}
+
+// Check returns an error describing violations of the guarantee.
+func (r Report) Check(guarantee Guarantee) error {
+	var violations []string
+
+	if len(r.Lost) > 0 {
+		violations = append(violations, fmt.Sprintf("%d lost messages: %s", len(r.Lost), strings.Join(r.Lost, ", ")))
+	}
+	if guarantee == GuaranteeExactlyOnce {
+		if len(r.Duplicated) > 0 {
+			violations = append(violations, fmt.Sprintf("%d duplicated messages: %s", len(r.Duplicated), strings.Join(r.Duplicated, ", ")))
+		}
+		if len(r.OutOfOrder) > 0 {
+			violations = append(violations, fmt.Sprintf("%d messages out of order: %s", len(r.OutOfOrder), strings.Join(r.OutOfOrder, ", ")))
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return errors.Errorf("guarantees violated (seed %d): %s", r.Seed, strings.Join(violations, "; "))
+}
+
+type publishingActor struct {
+	index     int
+	publisher message.Publisher
+
+	// scheduled is the number of messages handed to the publisher by the harness.
+	scheduled int
+	messages  chan *message.Message
+}
+
+type consumingActor struct {
+	subscriber message.Subscriber
+	messages   <-chan *message.Message
+}
+
+type simulation struct {
+	config Config
+	logger watermill.LoggerAdapter
+	rand   *rand.Rand
+
+	publishers  []*publishingActor
+	subscribers []*consumingActor
+
+	report Report
+
+	published       int64
+	publishErrs     chan error
+	publishersGroup sync.WaitGroup
+
+	// acks counts acks of published messages.
+	acks map[string]int
+
+	// lastAckedSequence is the sequence of the last acked message of every publisher.
+	lastAckedSequence map[int]int
+}
+
+// Run runs the simulation and returns its report. Use Report.Check to verify the guarantees.
+// Errors are returned only when the publishers or subscribers fail.
+func Run(ctx context.Context, config Config, logger watermill.LoggerAdapter) (Report, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return Report{}, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+
+	s := &simulation{
+		config:            config,
+		logger:            logger,
+		rand:              rand.New(rand.NewSource(config.Seed)),
+		report:            Report{Seed: config.Seed},
+		acks:              map[string]int{},
+		lastAckedSequence: map[int]int{},
+		publishErrs:       make(chan error, config.Publishers),
+	}
+	defer s.close()
+
+	if err := s.start(ctx); err != nil {
+		return s.report, err
+	}
+
+	if err := s.run(ctx); err != nil {
+		return s.report, err
+	}
+
+	s.finishReport()
+
+	return s.report, nil
+}
+
+func (s *simulation) start(ctx context.Context) error {
+	for i := 0; i < s.config.Publishers; i++ {
+		publisher, err := s.config.NewPublisher()
+		if err != nil {
+			return errors.Wrap(err, "could not create publisher")
+		}
+
+		p := &publishingActor{
+			index:     i,
+			publisher: publisher,
+			messages:  make(chan *message.Message, s.config.MessagesPerPublisher),
+		}
+		s.publishers = append(s.publishers, p)
+
+		s.publishersGroup.Add(1)
+		go s.runPublisher(p)
+	}
+
+	for i := 0; i < s.config.Subscribers; i++ {
+		subscriber, err := s.config.NewSubscriber()
+		if err != nil {
+			return errors.Wrap(err, "could not create subscriber")
+		}
+
+		messages, err := subscriber.Subscribe(ctx, s.config.Topic)
+		if err != nil {
+			_ = subscriber.Close()
+			return errors.Wrap(err, "could not subscribe")
+		}
+		s.subscribers = append(s.subscribers, &consumingActor{subscriber: subscriber, messages: messages})
+	}
+
+	return nil
+}
+
+func (s *simulation) run(ctx context.Context) error {
+	var drainUntil time.Time
+
+	for ctx.Err() == nil {
+		select {
+		case err := <-s.publishErrs:
+			return err
+		default:
+		}
+
+		if drainUntil.IsZero() && s.allPublished() && s.allAcked() {
+			drainUntil = time.Now().Add(s.config.DrainDuration)
+		}
+		if !drainUntil.IsZero() && time.Now().After(drainUntil) {
+			return nil
+		}
+
+		actor := s.rand.Intn(len(s.publishers) + len(s.subscribers))
+		if actor < len(s.publishers) {
+			s.schedulePublish(s.publishers[actor])
+			continue
+		}
+
+		s.consume(ctx, s.subscribers[actor-len(s.publishers)])
+	}
+
+	return nil
+}
+
+func (s *simulation) schedulePublish(p *publishingActor) {
+	if p.scheduled == s.config.MessagesPerPublisher {
+		return
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte(fmt.Sprintf("%d/%d", p.index, p.scheduled)))
+	msg.Metadata.Set(PublisherMetadataKey, strconv.Itoa(p.index))
+	msg.Metadata.Set(SequenceMetadataKey, strconv.Itoa(p.scheduled))
+
+	s.acks[msg.UUID] = 0
+	p.scheduled++
+	p.messages <- msg
+}
+
+func (s *simulation) runPublisher(p *publishingActor) {
+	defer s.publishersGroup.Done()
+
+	for msg := range p.messages {
+		if err := p.publisher.Publish(s.config.Topic, msg); err != nil {
+			s.publishErrs <- errors.Wrapf(err, "publisher %d could not publish message %s", p.index, msg.Metadata.Get(SequenceMetadataKey))
+			return
+		}
+		atomic.AddInt64(&s.published, 1)
+	}
+}
+
+func (s *simulation) consume(ctx context.Context, c *consumingActor) {
+	timer := time.NewTimer(s.config.StepTimeout)
+	defer timer.Stop()
+
+	var msg *message.Message
+	select {
+	case msg = <-c.messages:
+	case <-timer.C:
+		return
+	case <-ctx.Done():
+		return
+	}
+	if msg == nil {
+		return
+	}
+
+	s.report.Delivered++
+
+	if s.rand.Float64() < s.config.NackProbability {
+		s.report.Nacked++
+		msg.Nack()
+		return
+	}
+
+	// The ack is recorded before acking, so the order of acks is not affected by the subscriber's goroutines.
+	s.recordAck(msg)
+	msg.Ack()
+}
+
+func (s *simulation) recordAck(msg *message.Message) {
+	s.report.Acked++
+
+	acks, published := s.acks[msg.UUID]
+	if !published {
+		s.logger.Info("Acked message which was not published by the simulation", watermill.LogFields{
+			"uuid": msg.UUID,
+		})
+		return
+	}
+	s.acks[msg.UUID] = acks + 1
+	if acks > 0 {
+		// Order is checked only for the first ack, the duplicate is reported separately.
+		return
+	}
+
+	publisher, err := strconv.Atoi(msg.Metadata.Get(PublisherMetadataKey))
+	if err != nil {
+		return
+	}
+	sequence, err := strconv.Atoi(msg.Metadata.Get(SequenceMetadataKey))
+	if err != nil {
+		return
+	}
+
+	last, ok := s.lastAckedSequence[publisher]
+	if ok && sequence < last {
+		s.report.OutOfOrder = append(s.report.OutOfOrder, msg.UUID)
+		return
+	}
+	s.lastAckedSequence[publisher] = sequence
+}
+
+func (s *simulation) allPublished() bool {
+	for _, p := range s.publishers {
+		if p.scheduled < s.config.MessagesPerPublisher {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *simulation) allAcked() bool {
+	for _, acks := range s.acks {
+		if acks == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *simulation) finishReport() {
+	s.report.Published = int(atomic.LoadInt64(&s.published))
+
+	for uuid, acks := range s.acks {
+		switch {
+		case acks == 0:
+			s.report.Lost = append(s.report.Lost, uuid)
+		case acks > 1:
+			s.report.Duplicated = append(s.report.Duplicated, uuid)
+		}
+	}
+
+	sort.Strings(s.report.Lost)
+	sort.Strings(s.report.Duplicated)
+}
+
+func (s *simulation) close() {
+	for _, c := range s.subscribers {
+		if err := c.subscriber.Close(); err != nil {
+			s.logger.Error("Could not close subscriber", err, nil)
+		}
+	}
+
+	for _, p := range s.publishers {
+		close(p.messages)
+	}
+	s.publishersGroup.Wait()
+
+	for _, p := range s.publishers {
+		if err := p.publisher.Close(); err != nil {
+			s.logger.Error("Could not close publisher", err, nil)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package simulation_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/simulation"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		OffsetsAdapter sql.OffsetsAdapter
+		Guarantee      simulation.Guarantee
+	}{
+		{
+			Name:           "transactional",
+			OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+			Guarantee:      simulation.GuaranteeExactlyOnce,
+		},
+		{
+			Name:           "non_transactional",
+			OffsetsAdapter: sql.DefaultD1OffsetsAdapter{},
+			Guarantee:      simulation.GuaranteeAtLeastOnce,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "simulation.sqlite")+"?_pragma=busy_timeout(10000)")
+			require.NoError(t, err)
+			defer db.Close()
+
+			logger := watermill.NewStdLogger(false, false)
+
+			report, err := simulation.Run(context.Background(), simulation.Config{
+				Topic: "simulation_" + watermill.NewShortUUID(),
+				NewPublisher: func() (message.Publisher, error) {
+					return sql.NewPublisher(db, sql.PublisherConfig{
+						SchemaAdapter:        sql.DefaultSQLiteSchema{},
+						AutoInitializeSchema: true,
+					}, logger)
+				},
+				NewSubscriber: func() (message.Subscriber, error) {
+					return sql.NewSubscriber(db, sql.SubscriberConfig{
+						SchemaAdapter:    sql.DefaultSQLiteSchema{SubscribeBatchSize: 5},
+						OffsetsAdapter:   tc.OffsetsAdapter,
+						InitializeSchema: true,
+						PollInterval:     time.Millisecond * 10,
+						ResendInterval:   time.Millisecond * 10,
+						RetryInterval:    time.Millisecond * 10,
+					}, logger)
+				},
+				Publishers:           2,
+				Subscribers:          3,
+				MessagesPerPublisher: 20,
+				NackProbability:      0.2,
+				Seed:                 1,
+			}, logger)
+			require.NoError(t, err)
+
+			assert.Equal(t, 40, report.Published)
+			assert.NotZero(t, report.Nacked)
+			assert.NoError(t, report.Check(tc.Guarantee))
+		})
+	}
+}
+
+func TestReport_Check(t *testing.T) {
+	report := simulation.Report{
+		Seed:       7,
+		Duplicated: []string{"duplicated"},
+		OutOfOrder: []string{"out_of_order"},
+	}
+
+	assert.NoError(t, report.Check(simulation.GuaranteeAtLeastOnce))
+
+	err := report.Check(simulation.GuaranteeExactlyOnce)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "seed 7")
+	assert.Contains(t, err.Error(), "duplicated")
+	assert.Contains(t, err.Error(), "out_of_order")
+
+	report.Lost = []string{"lost"}
+	assert.ErrorContains(t, report.Check(simulation.GuaranteeAtLeastOnce), "1 lost messages: lost")
+}
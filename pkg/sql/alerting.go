@@ -0,0 +1,255 @@
+package sql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// AlertKind is the kind of the threshold exceeded by a topic.
+type AlertKind string
+
+const (
+	// AlertRedeliveries is raised when more messages than AlerterConfig.MaxRedeliveries were nacked
+	// by the subscriber's handlers since the previous check.
+	AlertRedeliveries AlertKind = "redeliveries"
+
+	// AlertParkedMessages is raised when PoisonPillDetector parked more messages than
+	// AlerterConfig.MaxParkedMessages since the previous check.
+	AlertParkedMessages AlertKind = "parked_messages"
+
+	// AlertLag is raised when a consumer group has more unacked messages than AlerterConfig.MaxLag.
+	AlertLag AlertKind = "lag"
+)
+
+// Alert describes the topic which exceeded a threshold of AlerterConfig.
+type Alert struct {
+	Kind  AlertKind
+	Topic string
+
+	// ConsumerGroup is the consumer group of the subscriber (AlertRedeliveries)
+	// or the lagging consumer group (AlertLag). It's empty for AlertParkedMessages.
+	ConsumerGroup string
+
+	// Value is the value which exceeded the threshold.
+	Value     int64
+	Threshold int64
+}
+
+// AlertFunc is called by Alerter when a topic exceeds a threshold.
+type AlertFunc func(ctx context.Context, alert Alert)
+
+type AlerterConfig struct {
+	// AlertFunc is called when a topic exceeds a threshold, for example, to page about stuck topics. It's required.
+	//
+	// It's called once when the threshold is exceeded, and again only after the value dropped
+	// below the threshold at a check, so it's not called at every check of a stuck topic.
+	AlertFunc AlertFunc
+
+	// Subscriber provides the numbers of redelivered (nacked) messages. It's required by MaxRedeliveries.
+	Subscriber *Subscriber
+
+	// MaxRedeliveries is the number of messages of a topic nacked between two checks,
+	// above which AlertRedeliveries is raised. If it's 0, redeliveries are not checked.
+	MaxRedeliveries int64
+
+	// PoisonPillDetector provides the numbers of parked messages. It's required by MaxParkedMessages.
+	PoisonPillDetector *PoisonPillDetector
+
+	// MaxParkedMessages is the number of messages of a topic parked between two checks,
+	// above which AlertParkedMessages is raised. If it's 0, parked messages are not checked.
+	MaxParkedMessages int64
+
+	// TopicAdmin provides the lag of consumer groups of Topics. It's required by MaxLag.
+	TopicAdmin TopicAdmin
+
+	// Topics are the topics of which the lag is checked.
+	Topics []string
+
+	// MaxLag is the lag of a consumer group, above which AlertLag is raised. If it's 0, lag is not checked.
+	MaxLag int64
+
+	// Interval is the interval between checks done by Run.
+	//
+	// Default value is 1 minute.
+	Interval time.Duration
+}
+
+func (c *AlerterConfig) setDefaults() {
+	if c.Interval == 0 {
+		c.Interval = time.Minute
+	}
+}
+
+func (c AlerterConfig) validate() error {
+	if c.AlertFunc == nil {
+		return errors.New("alert func is nil")
+	}
+	if c.MaxRedeliveries < 0 || c.MaxParkedMessages < 0 || c.MaxLag < 0 {
+		return errors.New("thresholds must be non-negative")
+	}
+	if c.MaxRedeliveries == 0 && c.MaxParkedMessages == 0 && c.MaxLag == 0 {
+		return errors.New("at least one threshold must be set")
+	}
+	if c.MaxRedeliveries > 0 && c.Subscriber == nil {
+		return errors.New("subscriber is required to check redeliveries")
+	}
+	if c.MaxParkedMessages > 0 && c.PoisonPillDetector == nil {
+		return errors.New("poison pill detector is required to check parked messages")
+	}
+	if c.MaxLag > 0 {
+		if c.TopicAdmin == nil {
+			return errors.New("topic admin is required to check lag")
+		}
+		if len(c.Topics) == 0 {
+			return errors.New("topics are required to check lag")
+		}
+	}
+	if c.Interval <= 0 {
+		return errors.New("interval must be a positive duration")
+	}
+
+	return nil
+}
+
+// Alerter checks the statistics of topics and calls AlertFunc when they exceed the thresholds,
+// so stuck topics can be detected without external monitoring.
+//
+// Redeliveries are counted from the statistics of the subscriber (see Subscriber.Stats) and parked messages from
+// PoisonPillDetector, so only messages handled by this instance are counted. Lag is queried from the database.
+type Alerter struct {
+	config AlerterConfig
+	logger watermill.LoggerAdapter
+
+	nacked   map[string]int64
+	parked   map[string]int64
+	alerting map[alertKey]bool
+	lock     sync.Mutex
+}
+
+type alertKey struct {
+	kind          AlertKind
+	topic         string
+	consumerGroup string
+}
+
+func NewAlerter(config AlerterConfig, logger watermill.LoggerAdapter) (*Alerter, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Alerter{
+		config:   config,
+		logger:   logger,
+		nacked:   map[string]int64{},
+		parked:   map[string]int64{},
+		alerting: map[alertKey]bool{},
+	}, nil
+}
+
+// Run checks the thresholds every Interval, until ctx is canceled.
+// Errors of checks are logged, so a failing lag query doesn't stop checking the other thresholds.
+func (a *Alerter) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(a.config.Interval):
+		}
+
+		if err := a.Check(ctx); err != nil {
+			a.logger.Error("Could not check alert thresholds", err, nil)
+		}
+	}
+}
+
+// Check compares the statistics with the thresholds once, calling AlertFunc for newly exceeded thresholds.
+// Redeliveries and parked messages are counted since the previous check.
+func (a *Alerter) Check(ctx context.Context) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.config.MaxRedeliveries > 0 {
+		for topic, stats := range a.config.Subscriber.Stats() {
+			redeliveries := stats.Nacked - a.nacked[topic]
+			a.nacked[topic] = stats.Nacked
+
+			a.update(ctx, Alert{
+				Kind:          AlertRedeliveries,
+				Topic:         topic,
+				ConsumerGroup: a.config.Subscriber.config.ConsumerGroup,
+				Value:         redeliveries,
+				Threshold:     a.config.MaxRedeliveries,
+			})
+		}
+	}
+
+	if a.config.MaxParkedMessages > 0 {
+		for topic, parked := range a.config.PoisonPillDetector.ParkedMessages() {
+			newlyParked := parked - a.parked[topic]
+			a.parked[topic] = parked
+
+			a.update(ctx, Alert{
+				Kind:      AlertParkedMessages,
+				Topic:     topic,
+				Value:     newlyParked,
+				Threshold: a.config.MaxParkedMessages,
+			})
+		}
+	}
+
+	if a.config.MaxLag > 0 {
+		for _, topic := range a.config.Topics {
+			groups, err := a.config.TopicAdmin.ConsumerGroups(ctx, topic)
+			if err != nil {
+				return errors.Wrapf(err, "could not get consumer groups of topic %s", topic)
+			}
+
+			for _, group := range groups {
+				a.update(ctx, Alert{
+					Kind:          AlertLag,
+					Topic:         topic,
+					ConsumerGroup: group.ConsumerGroup,
+					Value:         group.Lag,
+					Threshold:     a.config.MaxLag,
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// update calls AlertFunc if the alert's value exceeds the threshold, and it didn't at the previous check.
+func (a *Alerter) update(ctx context.Context, alert Alert) {
+	key := alertKey{kind: alert.Kind, topic: alert.Topic, consumerGroup: alert.ConsumerGroup}
+
+	exceeded := alert.Value > alert.Threshold
+	wasExceeded := a.alerting[key]
+	if exceeded {
+		a.alerting[key] = true
+	} else {
+		delete(a.alerting, key)
+	}
+
+	if !exceeded || wasExceeded {
+		return
+	}
+
+	a.logger.Info("Alert threshold exceeded", watermill.LogFields{
+		"kind":           alert.Kind,
+		"topic":          alert.Topic,
+		"consumer_group": alert.ConsumerGroup,
+		"value":          alert.Value,
+		"threshold":      alert.Threshold,
+	})
+	a.config.AlertFunc(ctx, alert)
+}
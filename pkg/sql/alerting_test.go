@@ -0,0 +1,130 @@
+package sql_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lagTopicAdmin returns the configured lag of consumer groups.
+type lagTopicAdmin struct {
+	sql.TopicAdmin
+	lag map[string][]sql.ConsumerGroupLag
+}
+
+func (a lagTopicAdmin) ConsumerGroups(ctx context.Context, topic string) ([]sql.ConsumerGroupLag, error) {
+	return a.lag[topic], nil
+}
+
+func TestAlerter(t *testing.T) {
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topicName := "alerts_" + watermill.NewShortUUID()
+	schemaAdapter := newSQLiteSchemaAdapter(1)
+
+	publisher := newCheckpointPublisher(t, db, schemaAdapter)
+	require.NoError(t, publisher.Publish(topicName, message.NewMessage(watermill.NewUUID(), nil)))
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "alerts",
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		ResendInterval:   time.Millisecond,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	detector, err := sql.NewPoisonPillDetector(sql.PoisonPillDetectorConfig{
+		ParkPublisher: publishedMessages{},
+		MaxFailures:   1,
+	}, logger)
+	require.NoError(t, err)
+
+	topicAdmin := lagTopicAdmin{lag: map[string][]sql.ConsumerGroupLag{
+		topicName: {{ConsumerGroup: "lagging", Lag: 100}, {ConsumerGroup: "current", Lag: 1}},
+	}}
+
+	var alerts []sql.Alert
+	alerter, err := sql.NewAlerter(sql.AlerterConfig{
+		AlertFunc: func(ctx context.Context, alert sql.Alert) {
+			alerts = append(alerts, alert)
+		},
+		Subscriber:         subscriber,
+		MaxRedeliveries:    2,
+		PoisonPillDetector: detector,
+		MaxParkedMessages:  1,
+		TopicAdmin:         topicAdmin,
+		Topics:             []string{topicName},
+		MaxLag:             10,
+	}, logger)
+	require.NoError(t, err)
+
+	consumed, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		select {
+		case msg := <-consumed:
+			if i < 3 {
+				msg.Nack()
+			} else {
+				msg.Ack()
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("timeout waiting for message")
+		}
+	}
+	require.Eventually(t, func() bool {
+		return subscriber.Stats()[topicName].Acked == 1
+	}, time.Second*5, time.Millisecond*10)
+
+	handler := detector.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, errors.New("malformed payload")
+	})
+	for i := 0; i < 3; i++ {
+		_, _ = handler(message.NewMessage(watermill.NewUUID(), []byte("malformed")))
+	}
+
+	require.NoError(t, alerter.Check(ctx))
+	assert.ElementsMatch(t, []sql.Alert{
+		{Kind: sql.AlertRedeliveries, Topic: topicName, ConsumerGroup: "alerts", Value: 3, Threshold: 2},
+		{Kind: sql.AlertParkedMessages, Topic: "", Value: 2, Threshold: 1},
+		{Kind: sql.AlertLag, Topic: topicName, ConsumerGroup: "lagging", Value: 100, Threshold: 10},
+	}, alerts)
+
+	alerts = nil
+	require.NoError(t, alerter.Check(ctx))
+	assert.Empty(t, alerts, "alerts should not be repeated while the lag is still exceeded")
+
+	topicAdmin.lag[topicName] = []sql.ConsumerGroupLag{{ConsumerGroup: "lagging", Lag: 5}}
+	require.NoError(t, alerter.Check(ctx))
+	topicAdmin.lag[topicName] = []sql.ConsumerGroupLag{{ConsumerGroup: "lagging", Lag: 50}}
+	require.NoError(t, alerter.Check(ctx))
+	assert.Equal(t, []sql.Alert{
+		{Kind: sql.AlertLag, Topic: topicName, ConsumerGroup: "lagging", Value: 50, Threshold: 10},
+	}, alerts, "alert should be raised again after the lag recovered")
+}
+
+func TestAlerterConfig_validation(t *testing.T) {
+	alertFunc := func(ctx context.Context, alert sql.Alert) {}
+
+	_, err := sql.NewAlerter(sql.AlerterConfig{MaxLag: 10}, logger)
+	assert.Error(t, err, "alert func should be required")
+
+	_, err = sql.NewAlerter(sql.AlerterConfig{AlertFunc: alertFunc}, logger)
+	assert.Error(t, err, "at least one threshold should be required")
+
+	_, err = sql.NewAlerter(sql.AlerterConfig{AlertFunc: alertFunc, MaxRedeliveries: 1}, logger)
+	assert.Error(t, err, "subscriber should be required to check redeliveries")
+
+	_, err = sql.NewAlerter(sql.AlerterConfig{AlertFunc: alertFunc, MaxLag: 1, TopicAdmin: lagTopicAdmin{}}, logger)
+	assert.Error(t, err, "topics should be required to check lag")
+}
@@ -0,0 +1,148 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AnnotatingTopicAdmin is implemented by topic admins which can store annotations of messages.
+// The admin UI (pkg/admin) allows annotating messages only when the topic admin implements it.
+type AnnotatingTopicAdmin interface {
+	TopicAdmin
+
+	// Annotate sets the annotation of the message, for example, to record that it was "skipped manually"
+	// or "refunded" during an incident investigation. Annotations are returned with peeked messages
+	// (see PeekedMessage.Annotations). An empty value removes the annotation.
+	Annotate(ctx context.Context, topic string, uuid string, key string, value string) error
+}
+
+// MessageAnnotation is a note of an operator about a message, stored with AnnotatingTopicAdmin.Annotate.
+type MessageAnnotation struct {
+	Key         string
+	Value       string
+	AnnotatedAt time.Time
+}
+
+// Annotate stores the annotation in the annotations table (see SQLiteTopicAdmin.AnnotationsTableName),
+// which is created when the first message is annotated. Annotated messages are not changed.
+func (a SQLiteTopicAdmin) Annotate(ctx context.Context, topic string, uuid string, key string, value string) error {
+	if err := validateTopicName(topic); err != nil {
+		return err
+	}
+	if key == "" {
+		return errors.New("annotation key is empty")
+	}
+
+	rows, err := a.DB.QueryContext(ctx, `SELECT 1 FROM `+a.SchemaAdapter.MessagesTable(topic)+` WHERE "uuid" = ?`, uuid)
+	if err != nil {
+		return errors.Wrap(err, "could not query message")
+	}
+	found := rows.Next()
+	err = rows.Err()
+	_ = rows.Close()
+	if err != nil {
+		return errors.Wrap(err, "could not query message")
+	}
+	if !found {
+		return ErrMessageNotFound
+	}
+
+	_, err = a.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+a.annotationsTable()+` (
+		"topic" TEXT NOT NULL,
+		"uuid" TEXT NOT NULL,
+		"key" TEXT NOT NULL,
+		"value" TEXT NOT NULL,
+		"annotated_at" INTEGER NOT NULL,
+		PRIMARY KEY ("topic", "uuid", "key")
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "could not create annotations table")
+	}
+
+	if value == "" {
+		_, err = a.DB.ExecContext(
+			ctx,
+			`DELETE FROM `+a.annotationsTable()+` WHERE "topic" = ? AND "uuid" = ? AND "key" = ?`,
+			topic, uuid, key,
+		)
+		if err != nil {
+			return errors.Wrap(err, "could not delete annotation")
+		}
+		return nil
+	}
+
+	_, err = a.DB.ExecContext(
+		ctx,
+		`INSERT INTO `+a.annotationsTable()+` ("topic", "uuid", "key", "value", "annotated_at") VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT ("topic", "uuid", "key") DO UPDATE SET "value" = excluded."value", "annotated_at" = excluded."annotated_at"`,
+		topic, uuid, key, value, time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not insert annotation")
+	}
+
+	return nil
+}
+
+// annotations returns the annotations of the messages by their UUIDs.
+func (a SQLiteTopicAdmin) annotations(ctx context.Context, topic string, uuids []string) (map[string][]MessageAnnotation, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+
+	exists, err := a.tableExists(ctx, a.annotationsTableName())
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		// No messages were annotated yet.
+		return nil, nil
+	}
+
+	args := []any{topic}
+	for _, uuid := range uuids {
+		args = append(args, uuid)
+	}
+
+	rows, err := a.DB.QueryContext(
+		ctx,
+		`SELECT "uuid", "key", "value", "annotated_at" FROM `+a.annotationsTable()+`
+		WHERE "topic" = ? AND "uuid" IN (?`+strings.Repeat(", ?", len(uuids)-1)+`)
+		ORDER BY "uuid", "key"`,
+		args...,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query annotations")
+	}
+	defer rows.Close()
+
+	annotations := map[string][]MessageAnnotation{}
+	for rows.Next() {
+		var uuid string
+		var annotation MessageAnnotation
+		var annotatedAt int64
+		if err := rows.Scan(&uuid, &annotation.Key, &annotation.Value, &annotatedAt); err != nil {
+			return nil, errors.Wrap(err, "could not scan annotation")
+		}
+		annotation.AnnotatedAt = time.UnixMilli(annotatedAt).UTC()
+
+		annotations[uuid] = append(annotations[uuid], annotation)
+	}
+
+	return annotations, rows.Err()
+}
+
+func (a SQLiteTopicAdmin) annotationsTableName() string {
+	if a.AnnotationsTableName != "" {
+		return a.AnnotationsTableName
+	}
+	return "watermill_annotations"
+}
+
+func (a SQLiteTopicAdmin) annotationsTable() string {
+	return fmt.Sprintf(`"%s"`, a.annotationsTableName())
+}
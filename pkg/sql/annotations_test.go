@@ -0,0 +1,63 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteTopicAdmin_Annotate(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "annotate.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topic := "annotate_" + watermill.NewShortUUID()
+
+	first := message.NewMessage(watermill.NewUUID(), nil)
+	second := message.NewMessage(watermill.NewUUID(), nil)
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+	require.NoError(t, publisher.Publish(topic, first, second))
+
+	var admin sql.AnnotatingTopicAdmin = sql.SQLiteTopicAdmin{DB: db}
+
+	peeked, err := admin.PeekMessages(ctx, topic, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, peeked, 2)
+	assert.Empty(t, peeked[0].Annotations, "messages should be peeked before the annotations table exists")
+
+	require.NoError(t, admin.Annotate(ctx, topic, first.UUID, "status", "skipped manually"))
+	require.NoError(t, admin.Annotate(ctx, topic, first.UUID, "status", "refunded"))
+	require.NoError(t, admin.Annotate(ctx, topic, first.UUID, "ticket", "INC-42"))
+	require.NoError(t, admin.Annotate(ctx, topic, second.UUID, "ticket", "INC-42"))
+
+	assert.ErrorIs(t, admin.Annotate(ctx, topic, "missing", "status", "refunded"), sql.ErrMessageNotFound)
+	assert.Error(t, admin.Annotate(ctx, topic, first.UUID, "", "refunded"))
+
+	require.NoError(t, admin.Annotate(ctx, topic, second.UUID, "ticket", ""))
+
+	peeked, err = admin.PeekMessages(ctx, topic, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, peeked, 2)
+
+	require.Len(t, peeked[0].Annotations, 2)
+	assert.Equal(t, "status", peeked[0].Annotations[0].Key)
+	assert.Equal(t, "refunded", peeked[0].Annotations[0].Value)
+	assert.False(t, peeked[0].Annotations[0].AnnotatedAt.IsZero())
+	assert.Equal(t, "ticket", peeked[0].Annotations[1].Key)
+	assert.Empty(t, peeked[1].Annotations, "empty value should remove the annotation")
+
+	topics, err := admin.Topics(ctx)
+	require.NoError(t, err)
+	for _, stats := range topics {
+		assert.NotEqual(t, "annotations", stats.Topic, "annotations table should not be listed as a topic")
+	}
+}
@@ -0,0 +1,155 @@
+package sql
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ArchivedTablePrefix prefixes the names of the tables of topics archived by SQLiteTopicAdmin.Archive.
+const ArchivedTablePrefix = "archived_"
+
+// Archive retires the topic reversibly: its messages and offsets tables are renamed to the archived namespace
+// (prefixed with ArchivedTablePrefix), so the topic is not listed by Topics, and can't be published or subscribed,
+// until it's restored with Restore. Annotations of the messages are kept.
+//
+// Publishers and subscribers of the topic should be stopped first. Otherwise, they fail with missing tables,
+// or recreate the tables if they initialize the schema, in which case the topic can't be restored
+// until the new tables are dropped. Indexes keep their names, so the topic shouldn't be recreated while it's archived.
+func (a SQLiteTopicAdmin) Archive(ctx context.Context, topic string) error {
+	if err := validateTopicName(topic); err != nil {
+		return err
+	}
+
+	return a.inTx(ctx, func(ctx context.Context, db QueryExecutor) error {
+		admin := a
+		admin.DB = db
+
+		messagesTable := unquotedTableName(a.SchemaAdapter.MessagesTable(topic))
+		exists, err := admin.tableExists(ctx, messagesTable)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.Wrap(ErrTopicNotFound, topic)
+		}
+
+		archived, err := admin.tableExists(ctx, ArchivedTablePrefix+messagesTable)
+		if err != nil {
+			return err
+		}
+		if archived {
+			return errors.Errorf("topic %s is already archived, the archived tables must be dropped before archiving it again", topic)
+		}
+
+		return admin.renameTopicTables(ctx, topic, "", ArchivedTablePrefix)
+	})
+}
+
+// Restore restores the topic archived with Archive, so it can be published and subscribed again.
+// Consumer groups continue from their acked offsets.
+func (a SQLiteTopicAdmin) Restore(ctx context.Context, topic string) error {
+	if err := validateTopicName(topic); err != nil {
+		return err
+	}
+
+	return a.inTx(ctx, func(ctx context.Context, db QueryExecutor) error {
+		admin := a
+		admin.DB = db
+
+		messagesTable := unquotedTableName(a.SchemaAdapter.MessagesTable(topic))
+		archived, err := admin.tableExists(ctx, ArchivedTablePrefix+messagesTable)
+		if err != nil {
+			return err
+		}
+		if !archived {
+			return errors.Wrapf(ErrTopicNotFound, "archived topic %s", topic)
+		}
+
+		exists, err := admin.tableExists(ctx, messagesTable)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return errors.Errorf("topic %s was recreated since it was archived, its tables must be dropped before restoring it", topic)
+		}
+
+		return admin.renameTopicTables(ctx, topic, ArchivedTablePrefix, "")
+	})
+}
+
+// ArchivedTopics returns the topics archived with Archive.
+func (a SQLiteTopicAdmin) ArchivedTopics(ctx context.Context) ([]string, error) {
+	rows, err := a.DB.QueryContext(
+		ctx,
+		`SELECT "name" FROM "sqlite_master"
+		WHERE "type" = 'table' AND "name" LIKE ? ESCAPE '\' AND "name" NOT LIKE ? ESCAPE '\'
+		ORDER BY "name"`,
+		escapeLike(ArchivedTablePrefix+"watermill_")+"%",
+		escapeLike(ArchivedTablePrefix+"watermill_offsets_")+"%",
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query archived topics")
+	}
+	defer rows.Close()
+
+	var topics []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, errors.Wrap(err, "could not scan archived topic")
+		}
+
+		topic := strings.TrimPrefix(table, ArchivedTablePrefix+"watermill_")
+		if validateTopicName(topic) == nil {
+			topics = append(topics, topic)
+		}
+	}
+
+	return topics, rows.Err()
+}
+
+// renameTopicTables renames the messages and offsets tables of the topic, replacing fromPrefix of their names with toPrefix.
+// Offsets tables are created when the topic is subscribed for the first time, so they may be missing.
+func (a SQLiteTopicAdmin) renameTopicTables(ctx context.Context, topic string, fromPrefix string, toPrefix string) error {
+	tables := []string{
+		unquotedTableName(a.SchemaAdapter.MessagesTable(topic)),
+		unquotedTableName(a.OffsetsAdapter.MessagesOffsetsTable(topic)),
+	}
+
+	for _, table := range tables {
+		exists, err := a.tableExists(ctx, fromPrefix+table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		_, err = a.DB.ExecContext(ctx, `ALTER TABLE "`+fromPrefix+table+`" RENAME TO "`+toPrefix+table+`"`)
+		if err != nil {
+			return errors.Wrapf(err, "could not rename table %s", fromPrefix+table)
+		}
+	}
+
+	return nil
+}
+
+// inTx runs fn in a transaction if DB can begin transactions, so the tables of topics are renamed atomically.
+func (a SQLiteTopicAdmin) inTx(ctx context.Context, fn func(ctx context.Context, db QueryExecutor) error) error {
+	if isTx(a.DB) {
+		return fn(ctx, a.DB)
+	}
+	if beginner, ok := a.DB.(TxBeginner); ok {
+		return runInTx(ctx, beginner, func(ctx context.Context, tx Tx) error {
+			return fn(ctx, tx)
+		})
+	}
+
+	return fn(ctx, a.DB)
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
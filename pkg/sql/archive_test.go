@@ -0,0 +1,64 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteTopicAdmin_ArchiveRestore(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "archive.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, publisher.Publish("orders", message.NewMessage(watermill.NewUUID(), nil)))
+	}
+
+	admin := sql.SQLiteTopicAdmin{DB: db}
+	require.NoError(t, admin.Skip(ctx, "orders", "workers", sql.SkipTarget{Offset: 1}))
+
+	require.NoError(t, admin.Archive(ctx, "orders"))
+	assert.ErrorIs(t, admin.Archive(ctx, "orders"), sql.ErrTopicNotFound)
+
+	topics, err := admin.Topics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, topics)
+
+	archived, err := admin.ArchivedTopics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, archived)
+
+	assert.Error(t, publisher.Publish("orders", message.NewMessage(watermill.NewUUID(), nil)), "archived topic should not be published")
+
+	require.NoError(t, admin.Restore(ctx, "orders"))
+	assert.ErrorIs(t, admin.Restore(ctx, "orders"), sql.ErrTopicNotFound)
+
+	topics, err = admin.Topics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []sql.TopicStats{{Topic: "orders", Messages: 3, LastOffset: 3}}, topics)
+
+	groups, err := admin.ConsumerGroups(ctx, "orders")
+	require.NoError(t, err)
+	assert.Equal(t, []sql.ConsumerGroupLag{{ConsumerGroup: "workers", OffsetAcked: 1, Lag: 2}}, groups)
+
+	archived, err = admin.ArchivedTopics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, archived)
+
+	require.NoError(t, admin.Archive(ctx, "orders"))
+	recreatingPublisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+	require.NoError(t, recreatingPublisher.Publish("orders", message.NewMessage(watermill.NewUUID(), nil)))
+	assert.Error(t, admin.Restore(ctx, "orders"), "recreated topic should not be overwritten")
+}
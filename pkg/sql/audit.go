@@ -0,0 +1,250 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	stdSQL "database/sql"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// HashChainSchemaAdapter is an optional interface of SchemaAdapter, implemented by adapters which store
+// a hash chain of the messages, so tampering with the messages table can be detected (see VerifyHashChain).
+//
+// Publisher inserts the messages with InsertChainedQuery, in the same transaction as LastRowHashQuery.
+type HashChainSchemaAdapter interface {
+	SchemaAdapter
+
+	// LastRowHashQuery returns the SQL query and arguments selecting the row hash of the topic's last message.
+	LastRowHashQuery(topic string) Query
+
+	// InsertChainedQuery returns the query inserting the messages, like InsertQuery, with the hash chain
+	// continuing from lastRowHash, which is empty for the first message of the topic.
+	InsertChainedQuery(topic string, msgs message.Messages, lastRowHash []byte) (Query, error)
+
+	// ChainQuery returns the SQL query and arguments selecting at most limit messages with offsets
+	// greater than afterOffset, ordered by offsets, with the columns: offset, uuid, payload, metadata,
+	// prev_hash and row_hash.
+	ChainQuery(topic string, afterOffset int64, limit int) Query
+}
+
+// hashChainRow returns the hash of the message's row, chained to the hash of the previous row.
+// Metadata is hashed as stored, so the hash doesn't depend on how it's unmarshaled.
+func hashChainRow(prevHash []byte, uuid string, payload []byte, metadata []byte) []byte {
+	h := sha256.New()
+	for _, field := range [][]byte{prevHash, []byte(uuid), payload, metadata} {
+		// Lengths prefix the fields, so bytes can't be moved between them.
+		_ = binary.Write(h, binary.BigEndian, uint64(len(field)))
+		h.Write(field)
+	}
+
+	return h.Sum(nil)
+}
+
+// AuditSQLiteSchema is an implementation of HashChainSchemaAdapter based on DefaultSQLiteSchema,
+// for topics used as audit logs.
+//
+// Every message stores the hash of the previous message (prev_hash) and its own hash (row_hash),
+// computed from the previous hash, the UUID, the payload and the metadata. The messages table is append-only,
+// as triggers reject updating and deleting messages, so it can't be used with DeleteAckedMessages,
+// ReEncryptMessages or SQLiteTopicAdmin.Erase.
+//
+// Messages can only be inserted by Publisher, so Loader and Importer can't be used with AuditSQLiteSchema.
+// The schema is created only for new topics: it's not added to existing messages tables.
+type AuditSQLiteSchema struct {
+	// Schema is used for the queries which are not related to the hash chain.
+	Schema DefaultSQLiteSchema
+}
+
+func (s AuditSQLiteSchema) SchemaInitializingQueries(topic string) []Query {
+	table := s.Schema.MessagesTable(topic)
+	triggerPrefix := strings.Trim(table, `"`)
+
+	createMessagesTable := `
+		CREATE TABLE IF NOT EXISTS ` + table + ` (
+			"offset" INTEGER PRIMARY KEY AUTOINCREMENT,
+			"uuid" TEXT NOT NULL,
+			"created_at" TEXT NOT NULL DEFAULT ` + s.Schema.CreatedAtPrecision.sqliteDefault() + `,
+			"payload" BLOB,
+			"metadata" TEXT,
+			"prev_hash" BLOB NOT NULL,
+			"row_hash" BLOB NOT NULL
+		);
+	`
+
+	queries := []Query{{Query: createMessagesTable}}
+	for _, operation := range []string{"UPDATE", "DELETE"} {
+		queries = append(queries, Query{Query: fmt.Sprintf(
+			`CREATE TRIGGER IF NOT EXISTS "%s_append_only_%s" BEFORE %s ON %s
+			BEGIN
+				SELECT RAISE(ABORT, 'messages table is append-only');
+			END;`,
+			triggerPrefix, strings.ToLower(operation), operation, table,
+		)})
+	}
+
+	return queries
+}
+
+// InsertQuery always returns an error, as messages must be inserted with InsertChainedQuery.
+func (s AuditSQLiteSchema) InsertQuery(topic string, msgs message.Messages) (Query, error) {
+	return Query{}, errors.New("messages must be inserted with InsertChainedQuery")
+}
+
+func (s AuditSQLiteSchema) LastRowHashQuery(topic string) Query {
+	return Query{
+		Query: `SELECT "row_hash" FROM ` + s.Schema.MessagesTable(topic) + ` ORDER BY "offset" DESC LIMIT 1`,
+	}
+}
+
+func (s AuditSQLiteSchema) InsertChainedQuery(topic string, msgs message.Messages, lastRowHash []byte) (Query, error) {
+	insertQuery := fmt.Sprintf(
+		`INSERT INTO %s ("uuid", "payload", "metadata", "prev_hash", "row_hash") VALUES %s`,
+		s.Schema.MessagesTable(topic),
+		strings.TrimRight(strings.Repeat(`(?,?,?,?,?),`, len(msgs)), ","),
+	)
+
+	defaultArgs, err := stringMetadataInsertArgs(msgs)
+	if err != nil {
+		return Query{}, err
+	}
+
+	if lastRowHash == nil {
+		lastRowHash = []byte{}
+	}
+
+	args := make([]any, 0, len(msgs)*5)
+	prevHash := lastRowHash
+	for i, msg := range msgs {
+		payload, metadata := defaultArgs[i*3+1], defaultArgs[i*3+2]
+		rowHash := hashChainRow(prevHash, msg.UUID, payload.([]byte), []byte(metadata.(string)))
+
+		args = append(args, defaultArgs[i*3], payload, metadata, prevHash, rowHash)
+		prevHash = rowHash
+	}
+
+	return Query{Query: insertQuery, Args: args}, nil
+}
+
+func (s AuditSQLiteSchema) ChainQuery(topic string, afterOffset int64, limit int) Query {
+	return Query{
+		Query: `SELECT "offset", "uuid", "payload", "metadata", "prev_hash", "row_hash" FROM ` + s.Schema.MessagesTable(topic) + `
+			WHERE "offset" > ? ORDER BY "offset" ASC LIMIT ?`,
+		Args: []any{afterOffset, limit},
+	}
+}
+
+func (s AuditSQLiteSchema) SelectQuery(topic string, consumerGroup string, offsetsAdapter OffsetsAdapter) Query {
+	return s.Schema.SelectQuery(topic, consumerGroup, offsetsAdapter)
+}
+
+func (s AuditSQLiteSchema) ReordersMessages() bool {
+	return s.Schema.ReordersMessages()
+}
+
+func (s AuditSQLiteSchema) UnmarshalMessage(row Scanner) (Row, error) {
+	return s.Schema.UnmarshalMessage(row)
+}
+
+func (s AuditSQLiteSchema) MessagesTable(topic string) string {
+	return s.Schema.MessagesTable(topic)
+}
+
+func (s AuditSQLiteSchema) SubscribeIsolationLevel() stdSQL.IsolationLevel {
+	return s.Schema.SubscribeIsolationLevel()
+}
+
+// HashChainViolationError is returned by VerifyHashChain when the messages table was tampered with.
+type HashChainViolationError struct {
+	// Offset is the offset of the first message which doesn't match the hash chain.
+	Offset int64
+
+	Reason string
+}
+
+func (e *HashChainViolationError) Error() string {
+	return fmt.Sprintf("hash chain violated at offset %d: %s", e.Offset, e.Reason)
+}
+
+// HashChainVerification describes the messages checked by VerifyHashChain.
+type HashChainVerification struct {
+	// Messages is the number of verified messages.
+	Messages int64
+
+	// LastOffset is the offset of the last verified message.
+	LastOffset int64
+
+	// LastRowHash is the row hash of the last verified message. It may be stored outside the database,
+	// to detect removing the latest messages of the topic, which can't be detected by the hash chain.
+	LastRowHash []byte
+}
+
+const verifyHashChainBatchSize = 1000
+
+// VerifyHashChain verifies the hash chain of all messages of the topic, detecting modified, removed or inserted
+// messages and gaps in the offsets. When the chain is violated, *HashChainViolationError is returned
+// with the verification of the messages before the violation.
+func VerifyHashChain(
+	ctx context.Context,
+	db QueryExecutor,
+	schemaAdapter HashChainSchemaAdapter,
+	topic string,
+) (HashChainVerification, error) {
+	if err := validateTopic(schemaAdapter, topic); err != nil {
+		return HashChainVerification{}, err
+	}
+
+	result := HashChainVerification{LastRowHash: []byte{}}
+	for {
+		chainQuery := schemaAdapter.ChainQuery(topic, result.LastOffset, verifyHashChainBatchSize)
+		rows, err := db.QueryContext(ctx, chainQuery.Query, chainQuery.Args...)
+		if err != nil {
+			return result, errors.Wrap(err, "could not query messages")
+		}
+
+		batchSize := 0
+		for rows.Next() {
+			var offset int64
+			var uuid string
+			var payload, metadata, prevHash, rowHash []byte
+			if err := rows.Scan(&offset, &uuid, &payload, &metadata, &prevHash, &rowHash); err != nil {
+				_ = rows.Close()
+				return result, errors.Wrap(err, "could not scan message")
+			}
+			batchSize++
+
+			var violation string
+			switch {
+			case offset != result.LastOffset+1:
+				violation = fmt.Sprintf("expected offset %d", result.LastOffset+1)
+			case !bytes.Equal(prevHash, result.LastRowHash):
+				violation = "previous hash doesn't match the previous message"
+			case !bytes.Equal(rowHash, hashChainRow(prevHash, uuid, payload, metadata)):
+				violation = "row hash doesn't match the message"
+			}
+			if violation != "" {
+				_ = rows.Close()
+				return result, &HashChainViolationError{Offset: offset, Reason: violation}
+			}
+
+			result.Messages++
+			result.LastOffset = offset
+			result.LastRowHash = rowHash
+		}
+		if err := rows.Close(); err != nil {
+			return result, errors.Wrap(err, "could not close rows")
+		}
+		if err := rows.Err(); err != nil {
+			return result, errors.Wrap(err, "could not read messages")
+		}
+
+		if batchSize < verifyHashChainBatchSize {
+			return result, nil
+		}
+	}
+}
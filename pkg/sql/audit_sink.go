@@ -0,0 +1,131 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+const actorContextKey contextKey = "actor"
+
+// ContextWithActor returns a context with the actor (like a user or service name) recorded by AuditSink.
+// The publisher reads it from the context of the first published message (or the context passed to PublishMulti),
+// and the subscriber from the context passed to Subscribe.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+// ActorFromContext returns the actor from the context, or an empty string if it's not set.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorContextKey).(string)
+	return actor
+}
+
+// AuditAction is the action recorded by AuditSink.
+type AuditAction string
+
+const (
+	AuditActionPublished AuditAction = "published"
+	AuditActionAcked     AuditAction = "acked"
+)
+
+// AuditRecord describes messages published to or acked from a topic.
+type AuditRecord struct {
+	Action AuditAction
+	Topic  string
+	UUIDs  []string
+
+	// Actor is the actor of the context (see ContextWithActor).
+	Actor string
+
+	// ConsumerGroup is the consumer group which acked the messages. It's empty for published messages.
+	ConsumerGroup string
+
+	Time time.Time
+}
+
+// AuditSink records who published and acked messages, for example, to a compliance log.
+// It's set in PublisherConfig.AuditSink and SubscriberConfig.AuditSink, so the call sites don't need to be wrapped.
+//
+// Records are passed after the transaction inserting or acking the messages is committed,
+// so they're not recorded for rolled back transactions. The exception is a publisher created with a transaction
+// as the database handle, which passes the records after the messages are inserted, as the transaction
+// is committed by the caller.
+//
+// Record is called synchronously, so it should be fast. Errors are logged, as the messages are already committed.
+type AuditSink interface {
+	Record(ctx context.Context, record AuditRecord) error
+}
+
+// AuditSinkFunc is a function implementing AuditSink.
+type AuditSinkFunc func(ctx context.Context, record AuditRecord) error
+
+func (f AuditSinkFunc) Record(ctx context.Context, record AuditRecord) error {
+	return f(ctx, record)
+}
+
+// TopicAuditSinks passes the records of all topics to Global, and the records of each topic to its sink in Topics,
+// so topics with stricter compliance requirements can be audited separately.
+type TopicAuditSinks struct {
+	// Global receives the records of all topics. It's optional.
+	Global AuditSink
+
+	// Topics are the sinks of the topics.
+	Topics map[string]AuditSink
+}
+
+func (s TopicAuditSinks) Record(ctx context.Context, record AuditRecord) error {
+	var globalErr, topicErr error
+	if s.Global != nil {
+		globalErr = s.Global.Record(ctx, record)
+	}
+	if sink, ok := s.Topics[record.Topic]; ok && sink != nil {
+		topicErr = sink.Record(ctx, record)
+	}
+
+	return errors.Join(globalErr, topicErr)
+}
+
+func newAuditRecord(ctx context.Context, action AuditAction, topic string, uuids []string) AuditRecord {
+	return AuditRecord{
+		Action: action,
+		Topic:  topic,
+		UUIDs:  uuids,
+		Actor:  ActorFromContext(ctx),
+		Time:   time.Now().UTC(),
+	}
+}
+
+// auditedMessage is a message acked in the transaction of a subscription.
+type auditedMessage struct {
+	offset int64
+	uuid   string
+}
+
+// audit adds the messages acked up to the acked offset to the messages recorded after the commit.
+// Messages above the offset (delivered out of order) are not acked, so they're delivered again.
+func (c *groupCommit) audit(messages []auditedMessage, ackedOffset int64) {
+	for _, msg := range messages {
+		if msg.offset <= ackedOffset {
+			c.auditedUUIDs = append(c.auditedUUIDs, msg.uuid)
+		}
+	}
+}
+
+func (s *Subscriber) recordAcked(ctx context.Context, topic string, uuids []string, logger watermill.LoggerAdapter) {
+	if s.config.AuditSink == nil || len(uuids) == 0 {
+		return
+	}
+
+	// The messages may be committed after the subscription context was canceled.
+	ctx = detachedContext{ctx}
+
+	record := newAuditRecord(ctx, AuditActionAcked, topic, uuids)
+	record.ConsumerGroup = s.config.ConsumerGroup
+
+	if err := s.config.AuditSink.Record(ctx, record); err != nil {
+		logger.Error("Could not record acked messages", err, nil)
+	}
+}
@@ -0,0 +1,115 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingAuditSink struct {
+	records []sql.AuditRecord
+	lock    sync.Mutex
+}
+
+func (s *recordingAuditSink) Record(ctx context.Context, record sql.AuditRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *recordingAuditSink) Records() []sql.AuditRecord {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]sql.AuditRecord(nil), s.records...)
+}
+
+func TestAuditSink(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "audit.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	schemaAdapter := sql.DefaultSQLiteSchema{}
+
+	global := &recordingAuditSink{}
+	orders := &recordingAuditSink{}
+	sinks := sql.TopicAuditSinks{
+		Global: global,
+		Topics: map[string]sql.AuditSink{"orders": orders},
+	}
+
+	publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+		SchemaAdapter:        schemaAdapter,
+		AutoInitializeSchema: true,
+		AuditSink:            sinks,
+	}, logger)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	first := message.NewMessage(watermill.NewUUID(), []byte("first"))
+	first.SetContext(sql.ContextWithActor(ctx, "checkout"))
+	second := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, publisher.Publish("orders", first, second))
+	require.NoError(t, publisher.Publish("invoices", message.NewMessage(watermill.NewUUID(), nil)))
+
+	records := orders.Records()
+	require.Len(t, records, 1)
+	assert.Equal(t, sql.AuditActionPublished, records[0].Action)
+	assert.Equal(t, "orders", records[0].Topic)
+	assert.Equal(t, []string{first.UUID, second.UUID}, records[0].UUIDs)
+	assert.Equal(t, "checkout", records[0].Actor)
+	assert.False(t, records[0].Time.IsZero())
+	assert.Len(t, global.Records(), 2)
+
+	acks := &recordingAuditSink{}
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "billing",
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+		AuditSink:        acks,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	subscribeCtx, cancel := context.WithTimeout(sql.ContextWithActor(ctx, "billing-service"), time.Second*10)
+	defer cancel()
+	messages, err := subscriber.Subscribe(subscribeCtx, "orders")
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-messages:
+			msg.Ack()
+		case <-subscribeCtx.Done():
+			t.Fatal("messages were not received")
+		}
+	}
+
+	var acked []string
+	require.Eventually(t, func() bool {
+		acked = nil
+		for _, record := range acks.Records() {
+			assert.Equal(t, sql.AuditActionAcked, record.Action)
+			assert.Equal(t, "orders", record.Topic)
+			assert.Equal(t, "billing", record.ConsumerGroup)
+			assert.Equal(t, "billing-service", record.Actor)
+			acked = append(acked, record.UUIDs...)
+		}
+		return len(acked) == 2
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, []string{first.UUID, second.UUID}, acked)
+}
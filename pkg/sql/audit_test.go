@@ -0,0 +1,96 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyHashChain(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "audit.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	schemaAdapter := sql.AuditSQLiteSchema{}
+
+	publish := func(topic string, count int) {
+		publisher := newCheckpointPublisher(t, db, schemaAdapter)
+		for i := 0; i < count; i++ {
+			msg := message.NewMessage(watermill.NewUUID(), []byte(`{"action":"login"}`))
+			msg.Metadata.Set("user_id", "alice")
+			require.NoError(t, publisher.Publish(topic, msg))
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		topic := "audit_" + watermill.NewShortUUID()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				publish(topic, 10)
+			}()
+		}
+		wg.Wait()
+
+		verification, err := sql.VerifyHashChain(ctx, db, schemaAdapter, topic)
+		require.NoError(t, err)
+		assert.EqualValues(t, 40, verification.Messages)
+		assert.EqualValues(t, 40, verification.LastOffset)
+		assert.Len(t, verification.LastRowHash, 32)
+
+		_, err = sqlDB.Exec(`UPDATE ` + schemaAdapter.MessagesTable(topic) + ` SET "payload" = 'x'`)
+		assert.ErrorContains(t, err, "append-only")
+
+		_, err = sqlDB.Exec(`DELETE FROM ` + schemaAdapter.MessagesTable(topic))
+		assert.ErrorContains(t, err, "append-only")
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		topic := "audit_" + watermill.NewShortUUID()
+		publish(topic, 5)
+
+		_, err := sqlDB.Exec(`DROP TRIGGER "watermill_` + topic + `_append_only_update"`)
+		require.NoError(t, err)
+		_, err = sqlDB.Exec(`UPDATE ` + schemaAdapter.MessagesTable(topic) + ` SET "metadata" = '{"user_id":"bob"}' WHERE "offset" = 3`)
+		require.NoError(t, err)
+
+		verification, err := sql.VerifyHashChain(ctx, db, schemaAdapter, topic)
+		var violation *sql.HashChainViolationError
+		require.ErrorAs(t, err, &violation)
+		assert.EqualValues(t, 3, violation.Offset)
+		assert.EqualValues(t, 2, verification.Messages)
+	})
+
+	t.Run("gap", func(t *testing.T) {
+		topic := "audit_" + watermill.NewShortUUID()
+		publish(topic, 5)
+
+		_, err := sqlDB.Exec(`DROP TRIGGER "watermill_` + topic + `_append_only_delete"`)
+		require.NoError(t, err)
+		_, err = sqlDB.Exec(`DELETE FROM ` + schemaAdapter.MessagesTable(topic) + ` WHERE "offset" = 2`)
+		require.NoError(t, err)
+
+		_, err = sql.VerifyHashChain(ctx, db, schemaAdapter, topic)
+		var violation *sql.HashChainViolationError
+		require.ErrorAs(t, err, &violation)
+		assert.EqualValues(t, 3, violation.Offset)
+	})
+
+	t.Run("insert_query", func(t *testing.T) {
+		_, err := schemaAdapter.InsertQuery("audit", message.Messages{message.NewMessage(watermill.NewUUID(), nil)})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,169 @@
+package sql
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// AutoBatchConfig configures adjusting the number of messages processed in one batch to the latency
+// of the handler and the rate of redeliveries (see SubscriberConfig.AutoBatch).
+//
+// Small batches limit the number of messages redelivered after a crash, as offsets are committed after every batch,
+// while big batches increase throughput. The batch size starts at MinBatchSize. It's doubled after full batches
+// processed in less than half of TargetLatency, and halved after batches exceeding TargetLatency
+// or MaxRedeliveryRate.
+type AutoBatchConfig struct {
+	// MinBatchSize is the minimum number of messages of a batch.
+	//
+	// Default value is 1.
+	MinBatchSize int
+
+	// MaxBatchSize is the maximum number of messages of a batch. Batches are not bigger than the batch size
+	// of the schema adapter (like SubscribeBatchSize), so it shouldn't exceed it.
+	//
+	// Default value is 100.
+	MaxBatchSize int
+
+	// TargetLatency is the maximum time of processing a batch.
+	//
+	// Default value is 5s.
+	TargetLatency time.Duration
+
+	// MaxRedeliveryRate is the maximum fraction (from 0 to 1) of deliveries of a batch which were nacked.
+	//
+	// Default value is 0.05.
+	MaxRedeliveryRate float64
+}
+
+func (c *AutoBatchConfig) setDefaults() {
+	if c.MinBatchSize == 0 {
+		c.MinBatchSize = 1
+	}
+	if c.MaxBatchSize == 0 {
+		c.MaxBatchSize = 100
+	}
+	if c.TargetLatency == 0 {
+		c.TargetLatency = time.Second * 5
+	}
+	if c.MaxRedeliveryRate == 0 {
+		c.MaxRedeliveryRate = 0.05
+	}
+}
+
+func (c AutoBatchConfig) validate() error {
+	if c.MinBatchSize < 1 {
+		return errors.New("min batch size must be positive")
+	}
+	if c.MaxBatchSize < c.MinBatchSize {
+		return errors.New("max batch size must not be lower than min batch size")
+	}
+	if c.TargetLatency <= 0 {
+		return errors.New("target latency must be a positive duration")
+	}
+	if c.MaxRedeliveryRate < 0 || c.MaxRedeliveryRate > 1 {
+		return errors.Errorf("max redelivery rate must be between 0 and 1, got %v", c.MaxRedeliveryRate)
+	}
+
+	return nil
+}
+
+// autoBatcher keeps the current batch sizes of topics.
+type autoBatcher struct {
+	config AutoBatchConfig
+
+	sizes map[string]int
+	lock  sync.Mutex
+}
+
+func newAutoBatcher(config *AutoBatchConfig) *autoBatcher {
+	if config == nil {
+		return nil
+	}
+
+	return &autoBatcher{
+		config: *config,
+		sizes:  map[string]int{},
+	}
+}
+
+func (b *autoBatcher) batchSize(topic string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	size, ok := b.sizes[topic]
+	if !ok {
+		return b.config.MinBatchSize
+	}
+
+	return size
+}
+
+// batchProcessed adjusts the batch size of the topic after processing a batch of selected messages.
+func (b *autoBatcher) batchProcessed(topic string, selected int, delivered int64, nacked int64, latency time.Duration) (int, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	size, ok := b.sizes[topic]
+	if !ok {
+		size = b.config.MinBatchSize
+	}
+	previous := size
+
+	var redeliveryRate float64
+	if delivered > 0 {
+		redeliveryRate = float64(nacked) / float64(delivered)
+	}
+
+	switch {
+	case latency > b.config.TargetLatency || redeliveryRate > b.config.MaxRedeliveryRate:
+		size /= 2
+		if size < b.config.MinBatchSize {
+			size = b.config.MinBatchSize
+		}
+	case selected >= size && latency < b.config.TargetLatency/2:
+		size *= 2
+		if size > b.config.MaxBatchSize {
+			size = b.config.MaxBatchSize
+		}
+	}
+
+	b.sizes[topic] = size
+	return size, size != previous
+}
+
+func (s *Subscriber) autoBatchLimitReached(topic string, messages int) bool {
+	return s.autoBatch != nil && messages >= s.autoBatch.batchSize(topic)
+}
+
+// startAutoBatch returns the function which adjusts the batch size after processing the selected messages.
+func (s *Subscriber) startAutoBatch(topic string, logger watermill.LoggerAdapter) func(selected int) {
+	if s.autoBatch == nil {
+		return func(int) {}
+	}
+
+	start := time.Now()
+	before := s.stats.snapshotTopic(topic)
+
+	return func(selected int) {
+		if selected == 0 {
+			return
+		}
+
+		after := s.stats.snapshotTopic(topic)
+		size, changed := s.autoBatch.batchProcessed(
+			topic,
+			selected,
+			after.Received-before.Received,
+			after.Nacked-before.Nacked,
+			time.Since(start),
+		)
+		if changed {
+			logger.Debug("Adjusted batch size", watermill.LogFields{
+				"batch_size": size,
+			})
+		}
+	}
+}
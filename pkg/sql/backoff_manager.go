@@ -1,6 +1,7 @@
 package sql
 
 import (
+	"errors"
 	"strings"
 	"time"
 
@@ -24,32 +25,69 @@ func NewDefaultBackoffManager(pollInterval, retryInterval time.Duration) Backoff
 	return &defaultBackoffManager{
 		retryInterval: retryInterval,
 		pollInterval:  pollInterval,
-		deadlockIndicators: []string{
-			// MySQL deadlock indicator
-			"deadlock",
+	}
+}
+
+// retryableTxErrorIndicators are substrings of errors (in lower case) caused by concurrent transactions,
+// which succeed when retried.
+var retryableTxErrorIndicators = []string{
+	// MySQL deadlock indicator
+	"deadlock",
+
+	// PostgreSQL deadlock indicator
+	"concurrent update",
+
+	// PostgreSQL serialization failure indicator
+	"could not serialize access",
+
+	// DuckDB write-write conflict indicator, like "TransactionContext Error: Failed to commit: write-write conflict on key"
+	"write-write conflict",
+
+	// SQLite write lock indicator
+	"database is locked",
+}
+
+// duckDBTransactionErrorPrefix is the prefix of the errors of DuckDB transactions (in lower case).
+// Wrapped errors contain it after the messages of the wrappers.
+const duckDBTransactionErrorPrefix = "transactioncontext error:"
 
-			// PostgreSQL deadlock indicator
-			"concurrent update",
-		},
+// IsRetryableTxError returns true if the error is caused by a conflict with a concurrent transaction
+// (a deadlock, a serialization failure, a write-write conflict in DuckDB, ErrOffsetConflict, or a busy SQLite database),
+// so the transaction should be retried.
+// Errors classified as ErrBusy or ErrSerializationFailure (see ClassifyError) are always retryable.
+// It's used by the default BackoffManager and RunInTx.
+func IsRetryableTxError(err error) bool {
+	if err == nil {
+		return false
 	}
+
+	switch ClassifyError(err) {
+	case ErrBusy, ErrSerializationFailure:
+		return true
+	}
+	if errors.Is(err, ErrOffsetConflict) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, indicator := range retryableTxErrorIndicators {
+		if strings.Contains(msg, indicator) {
+			return true
+		}
+	}
+
+	// Other DuckDB transaction conflicts, like "TransactionContext Error: Conflict on tuple deletion!"
+	return strings.Contains(msg, duckDBTransactionErrorPrefix) && strings.Contains(msg, "conflict")
 }
 
 type defaultBackoffManager struct {
-	pollInterval       time.Duration
-	retryInterval      time.Duration
-	deadlockIndicators []string
+	pollInterval  time.Duration
+	retryInterval time.Duration
 }
 
 func (d defaultBackoffManager) HandleError(logger watermill.LoggerAdapter, noMsg bool, err error) time.Duration {
 	if err != nil {
-		var deadlock bool
-		for _, indicator := range d.deadlockIndicators {
-			if strings.Contains(strings.ToLower(err.Error()), indicator) {
-				deadlock = true
-				break
-			}
-		}
-		if deadlock {
+		if IsRetryableTxError(err) {
 			logger.Debug("Deadlock during querying message, trying again", watermill.LogFields{
 				"err": err.Error(),
 			})
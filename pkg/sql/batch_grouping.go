@@ -0,0 +1,154 @@
+package sql
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	// BatchIDMetadataKey is the metadata key containing the ID of the logical batch of the message.
+	// Messages of a batch are delivered together when SubscriberConfig.GroupBatches is enabled.
+	BatchIDMetadataKey = "batch_id"
+
+	// BatchSizeMetadataKey is the metadata key containing the number of messages of the message's batch.
+	BatchSizeMetadataKey = "batch_size"
+
+	// BatchEndMetadataKey is the metadata key set to "true" for the last message of a batch
+	// with unknown size, published after the other messages of the batch.
+	BatchEndMetadataKey = "batch_end"
+)
+
+// SetBatch sets the metadata of the messages, so they are delivered together as the batch with the ID.
+// All messages of the batch must be passed, as their number is stored as the size of the batch.
+func SetBatch(batchID string, msgs ...*message.Message) {
+	for _, msg := range msgs {
+		msg.Metadata.Set(BatchIDMetadataKey, batchID)
+		msg.Metadata.Set(BatchSizeMetadataKey, strconv.Itoa(len(msgs)))
+	}
+}
+
+// BatchGroupingSchemaAdapter is an optional interface of SchemaAdapter, implemented by adapters which can
+// select the messages of a logical batch. It's required by SubscriberConfig.GroupBatches.
+type BatchGroupingSchemaAdapter interface {
+	SchemaAdapter
+
+	// BatchMessagesQuery returns the SQL query and arguments selecting all messages of the topic
+	// with the batch ID (see BatchIDMetadataKey), ordered by offsets. Rows are unmarshaled with UnmarshalMessage.
+	BatchMessagesQuery(topic string, batchID string) Query
+}
+
+// errBatchIncomplete is returned by processMessage when the message's batch is not complete yet,
+// so consuming should wait until the rest of the batch is published.
+var errBatchIncomplete = errors.New("batch is not complete")
+
+// deliverBatch delivers all messages of the batch when row is its first message, and the batch is complete.
+// The following messages of the batch are acked without delivering, as they were delivered with the first one.
+func (s *Subscriber) deliverBatch(
+	ctx context.Context,
+	topic string,
+	row Row,
+	batchID string,
+	executor QueryExecutor,
+	out chan *message.Message,
+	logger watermill.LoggerAdapter,
+) (bool, error) {
+	batchRows, err := s.queryBatch(ctx, topic, batchID, executor)
+	if err != nil {
+		return false, err
+	}
+
+	logger = logger.With(watermill.LogFields{
+		"batch_id":       batchID,
+		"batch_messages": len(batchRows),
+	})
+
+	if len(batchRows) > 0 && batchRows[0].Offset < row.Offset {
+		logger.Trace("Skipping message delivered with its batch", nil)
+		return true, nil
+	}
+	if !batchComplete(batchRows) {
+		logger.Debug("Waiting for batch to complete", nil)
+		return false, errBatchIncomplete
+	}
+
+	for _, batchRow := range batchRows {
+		acked, err := s.deliverMessage(ctx, topic, batchRow, executor, out, logger)
+		if err != nil || !acked {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (s *Subscriber) queryBatch(ctx context.Context, topic string, batchID string, executor QueryExecutor) ([]Row, error) {
+	batchQuery := s.config.SchemaAdapter.(BatchGroupingSchemaAdapter).BatchMessagesQuery(topic, batchID)
+
+	rows, err := executor.QueryContext(ctx, batchQuery.Query, batchQuery.Args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query batch messages")
+	}
+
+	var batchRows []Row
+	for rows.Next() {
+		row, err := s.config.SchemaAdapter.UnmarshalMessage(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, errors.Wrap(err, "could not unmarshal batch message")
+		}
+
+		row, err = s.transformMessage(row)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+
+		batchRows = append(batchRows, row)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, errors.Wrap(err, "could not close rows")
+	}
+
+	return batchRows, rows.Err()
+}
+
+// batchComplete reports whether all messages of the batch were published,
+// based on BatchSizeMetadataKey or BatchEndMetadataKey.
+func batchComplete(batchRows []Row) bool {
+	for _, row := range batchRows {
+		if row.Msg.Metadata.Get(BatchEndMetadataKey) == "true" {
+			return true
+		}
+
+		size, err := strconv.Atoi(row.Msg.Metadata.Get(BatchSizeMetadataKey))
+		if err == nil && size > 0 && len(batchRows) >= size {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s DefaultSQLiteSchema) BatchMessagesQuery(topic string, batchID string) Query {
+	return Query{
+		Query: `SELECT "offset", "uuid", ` + s.payloadColumn() + `, ` + s.metadataColumn(topic) + ` FROM ` + s.MessagesTable(topic) + `
+			WHERE json_extract(` + s.metadataExpression(topic) + `, '$.` + BatchIDMetadataKey + `') = ?
+			ORDER BY "offset" ASC`,
+		Args: []any{batchID},
+	}
+}
+
+func (s DefaultMySQLSchema) BatchMessagesQuery(topic string, batchID string) Query {
+	offsetColumn := "`offset`"
+
+	return Query{
+		Query: `SELECT ` + offsetColumn + `, uuid, ` + s.payloadColumn() + `, metadata FROM ` + s.MessagesTable(topic) + `
+			WHERE JSON_UNQUOTE(JSON_EXTRACT(metadata, '$.` + BatchIDMetadataKey + `')) = ?
+			ORDER BY ` + offsetColumn + ` ASC`,
+		Args: []any{batchID},
+	}
+}
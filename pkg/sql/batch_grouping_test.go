@@ -0,0 +1,99 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_GroupBatches(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "batches.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topic := "batches_" + watermill.NewShortUUID()
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+
+	newMessage := func(name string) *message.Message {
+		return message.NewMessage(watermill.NewUUID(), []byte(name))
+	}
+
+	sizedBatch := []*message.Message{newMessage("sized_1"), newMessage("sized_2"), newMessage("sized_3")}
+	sql.SetBatch("sized", sizedBatch...)
+
+	terminatedBatch := []*message.Message{newMessage("terminated_1"), newMessage("terminated_2")}
+	for _, msg := range terminatedBatch {
+		msg.Metadata.Set(sql.BatchIDMetadataKey, "terminated")
+	}
+	terminatedBatch[1].Metadata.Set(sql.BatchEndMetadataKey, "true")
+
+	require.NoError(t, publisher.Publish(topic, newMessage("single_1"), sizedBatch[0], newMessage("single_2")))
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+		GroupBatches:     true,
+	}, logger)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, subscriber.Close())
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	receive := func(count int) []string {
+		var received []string
+		for len(received) < count {
+			select {
+			case msg := <-messages:
+				received = append(received, string(msg.Payload))
+				msg.Ack()
+			case <-ctx.Done():
+				t.Fatal("timeout waiting for messages")
+			}
+		}
+		return received
+	}
+
+	assert.Equal(t, []string{"single_1"}, receive(1))
+
+	select {
+	case msg := <-messages:
+		t.Fatalf("message %s delivered before its preceding batch was complete", msg.Payload)
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	require.NoError(t, publisher.Publish(topic, terminatedBatch[0], sizedBatch[1]))
+	require.NoError(t, publisher.Publish(topic, sizedBatch[2], terminatedBatch[1], newMessage("single_3")))
+
+	assert.Equal(t, []string{
+		"sized_1", "sized_2", "sized_3",
+		"single_2",
+		"terminated_1", "terminated_2",
+		"single_3",
+	}, receive(7))
+}
+
+func TestSubscriber_GroupBatches_requiresSchemaAdapter(t *testing.T) {
+	_, err := sql.NewSubscriber(newSQLite(t), sql.SubscriberConfig{
+		SchemaAdapter:  sql.DefaultPostgreSQLSchema{},
+		OffsetsAdapter: sql.DefaultPostgreSQLOffsetsAdapter{},
+		GroupBatches:   true,
+	}, logger)
+	assert.Error(t, err)
+}
@@ -0,0 +1,257 @@
+package sql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// BridgeConfig configures Bridge.
+type BridgeConfig struct {
+	// Subscriber consumes the messages of the source, like a Kafka or NATS subscriber. It's required.
+	Subscriber message.Subscriber
+
+	// Topics are the topics of the source consumed by the bridge. At least one topic is required.
+	Topics []string
+
+	// DestinationTopic returns the SQL topic to which the messages of the source topic are persisted.
+	//
+	// By default, messages are persisted to the topic of the same name.
+	DestinationTopic func(topic string) string
+
+	// Publisher configures persisting the messages. Publisher.SchemaAdapter is required.
+	//
+	// With Publisher.AutoInitializeSchema, the schema of the destination topics is initialized when the bridge starts,
+	// as the messages are persisted in transactions.
+	Publisher PublisherConfig
+
+	// MetadataProfile maps the metadata of the consumed messages, usually with the Reverse of the broker's profile
+	// (like KafkaHeadersProfile.Reverse()), so the metadata keys of this package are restored.
+	MetadataProfile *MetadataProfile
+
+	// RetryInterval is the wait before nacking a message which couldn't be persisted,
+	// so a failing database is not retried in a hot loop.
+	//
+	// Default value is 1s.
+	RetryInterval time.Duration
+
+	// RetryPolicy decides the waits before nacking the messages which couldn't be persisted,
+	// by the number of consecutive failures of the topic. Messages are nacked after the wait
+	// even when the policy stops retrying, as the bridge doesn't skip messages.
+	//
+	// By default, it's a ConstantRetryPolicy waiting RetryInterval.
+	RetryPolicy RetryPolicy
+}
+
+func (c *BridgeConfig) setDefaults() {
+	if c.DestinationTopic == nil {
+		c.DestinationTopic = func(topic string) string { return topic }
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = time.Second
+	}
+	if c.RetryPolicy == nil {
+		c.RetryPolicy = ConstantRetryPolicy{Interval: c.RetryInterval}
+	}
+	c.Publisher.setDefaults()
+}
+
+func (c BridgeConfig) validate() error {
+	if c.Subscriber == nil {
+		return errors.New("subscriber is nil")
+	}
+	if len(c.Topics) == 0 {
+		return errors.New("no topics to bridge")
+	}
+	if c.RetryInterval < 0 {
+		return errors.New("retry interval must be a positive duration")
+	}
+	if c.MetadataProfile != nil {
+		if err := c.MetadataProfile.validate(); err != nil {
+			return errors.Wrapf(err, "invalid metadata profile %s", c.MetadataProfile.Name)
+		}
+	}
+	if err := c.Publisher.validate(); err != nil {
+		return errors.Wrap(err, "invalid publisher config")
+	}
+
+	return nil
+}
+
+// Bridge consumes messages from another Watermill subscriber (like Kafka or NATS) and persists them to SQL topics,
+// mirroring the outbox forwarder. It may be used for durable local buffering, or for processing streams of a broker
+// offline.
+//
+// Every message is inserted in its own transaction, and acked to the source after the transaction is committed.
+// If the bridge stops between the commit and the ack, the message is persisted again when it's redelivered
+// by the source, so Publisher.Deduplicator should be used when duplicates must be avoided.
+type Bridge struct {
+	db     TxBeginner
+	config BridgeConfig
+
+	publisherConfig PublisherConfig
+
+	runWg   sync.WaitGroup
+	closing chan struct{}
+	closed  bool
+
+	logger watermill.LoggerAdapter
+}
+
+// NewBridge creates Bridge persisting the messages with db.
+func NewBridge(db TxBeginner, config BridgeConfig, logger watermill.LoggerAdapter) (*Bridge, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	// The schema is initialized by Run, as publishers in transactions can't initialize it.
+	publisherConfig := config.Publisher
+	publisherConfig.AutoInitializeSchema = false
+
+	return &Bridge{
+		db:              db,
+		config:          config,
+		publisherConfig: publisherConfig,
+		closing:         make(chan struct{}),
+		logger:          logger,
+	}, nil
+}
+
+// Run subscribes to the source topics and persists the consumed messages until the context is canceled
+// or the bridge is closed.
+func (b *Bridge) Run(ctx context.Context) error {
+	if b.closed {
+		return errors.New("bridge is closed")
+	}
+
+	b.runWg.Add(1)
+	defer b.runWg.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-b.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if b.config.Publisher.AutoInitializeSchema {
+		for _, topic := range b.config.Topics {
+			destinationTopic := b.config.DestinationTopic(topic)
+			err := initializeSchema(ctx, destinationTopic, b.logger, b.db, b.config.Publisher.SchemaAdapter, nil)
+			if err != nil {
+				return errors.Wrapf(err, "could not initialize schema of topic %s", destinationTopic)
+			}
+		}
+	}
+
+	var bridgeWg sync.WaitGroup
+	defer bridgeWg.Wait()
+
+	for _, topic := range b.config.Topics {
+		messages, err := b.config.Subscriber.Subscribe(ctx, topic)
+		if err != nil {
+			cancel()
+			return errors.Wrapf(err, "could not subscribe to topic %s", topic)
+		}
+
+		bridgeWg.Add(1)
+		go func(topic string) {
+			defer bridgeWg.Done()
+			b.bridge(ctx, topic, messages)
+		}(topic)
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+func (b *Bridge) bridge(ctx context.Context, topic string, messages <-chan *message.Message) {
+	destinationTopic := b.config.DestinationTopic(topic)
+	logger := b.logger.With(watermill.LogFields{
+		"topic":             topic,
+		"destination_topic": destinationTopic,
+	})
+
+	failures := retrier{policy: b.config.RetryPolicy}
+	for {
+		var msg *message.Message
+		var ok bool
+
+		select {
+		case msg, ok = <-messages:
+			if !ok {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+
+		if err := b.persist(ctx, destinationTopic, msg); err != nil {
+			logger.Error("Could not persist bridged message", err, watermill.LogFields{
+				"message_uuid": msg.UUID,
+			})
+
+			wait, _ := failures.next(err)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+			msg.Nack()
+			continue
+		}
+		failures.reset()
+
+		logger.Trace("Message bridged", watermill.LogFields{
+			"message_uuid": msg.UUID,
+		})
+		msg.Ack()
+	}
+}
+
+func (b *Bridge) persist(ctx context.Context, topic string, msg *message.Message) error {
+	persisted := msg.Copy()
+	persisted.SetContext(msg.Context())
+	if b.config.MetadataProfile != nil {
+		persisted.Metadata = b.config.MetadataProfile.Map(msg.Metadata)
+	}
+
+	return RunInTx(ctx, b.db, RunInTxOptions{}, func(ctx context.Context, tx Tx) error {
+		publisher, err := NewPublisherWithExecutor(tx, b.publisherConfig, b.logger)
+		if err != nil {
+			return errors.Wrap(err, "could not create publisher")
+		}
+		defer publisher.Close()
+
+		return publisher.Publish(topic, persisted)
+	})
+}
+
+// Close stops the bridge and waits until Run returns. Messages being persisted are not acked to the source.
+func (b *Bridge) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	close(b.closing)
+	b.runWg.Wait()
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	sourceTopic := "broker_" + watermill.NewShortUUID()
+	destinationTopic := "bridged_" + watermill.NewShortUUID()
+
+	broker := gochannel.NewGoChannel(gochannel.Config{Persistent: true}, logger)
+	defer broker.Close()
+
+	kafkaProfile := sql.KafkaHeadersProfile.Reverse()
+	bridge, err := sql.NewBridge(db, sql.BridgeConfig{
+		Subscriber: broker,
+		Topics:     []string{sourceTopic},
+		DestinationTopic: func(topic string) string {
+			return destinationTopic
+		},
+		Publisher: sql.PublisherConfig{
+			SchemaAdapter:        sql.DefaultSQLiteSchema{},
+			AutoInitializeSchema: true,
+		},
+		MetadataProfile: &kafkaProfile,
+	}, logger)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- bridge.Run(ctx)
+	}()
+
+	var published []*message.Message
+	for i := 0; i < 3; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(`{}`))
+		msg.Metadata.Set("correlation-id", "correlation")
+		published = append(published, msg)
+	}
+	require.NoError(t, broker.Publish(sourceTopic, published...))
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	consumed, err := subscriber.Subscribe(ctx, destinationTopic)
+	require.NoError(t, err)
+
+	var publishedUUIDs, receivedUUIDs []string
+	for _, msg := range published {
+		publishedUUIDs = append(publishedUUIDs, msg.UUID)
+
+		select {
+		case received := <-consumed:
+			receivedUUIDs = append(receivedUUIDs, received.UUID)
+			assert.Equal(t, "correlation", received.Metadata.Get(sql.CorrelationIDMetadataKey))
+			received.Ack()
+		case <-time.After(time.Second * 5):
+			t.Fatal("bridged message was not received")
+		}
+	}
+	assert.ElementsMatch(t, publishedUUIDs, receivedUUIDs)
+
+	require.NoError(t, bridge.Close())
+	assert.NoError(t, <-runErr)
+}
+
+func TestNewBridge_invalidConfig(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+
+	_, err := sql.NewBridge(db, sql.BridgeConfig{
+		Subscriber: gochannel.NewGoChannel(gochannel.Config{}, logger),
+		Publisher:  sql.PublisherConfig{SchemaAdapter: sql.DefaultSQLiteSchema{}},
+	}, logger)
+	assert.ErrorContains(t, err, "no topics to bridge")
+}
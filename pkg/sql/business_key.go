@@ -0,0 +1,182 @@
+package sql
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BusinessKey is a metadata key identifying messages in the business domain, like an order ID.
+// Schema adapters supporting business keys create an index on it in SchemaInitializingQueries,
+// so messages can be located with Find, for example, for audits or reprocessing.
+type BusinessKey struct {
+	// MetadataKey is the metadata key of the business key. It's required.
+	MetadataKey string
+
+	// Unique makes the index unique, so publishing a message with a value of the key which is already stored
+	// in the topic fails. Messages without the key are not affected.
+	Unique bool
+}
+
+// BusinessKeySchemaAdapter is an optional interface of SchemaAdapter, implemented by adapters which can
+// look up messages by their business keys. It's used by Find.
+type BusinessKeySchemaAdapter interface {
+	SchemaAdapter
+
+	// FindQuery returns the SQL query and arguments selecting the messages of the topic with the value
+	// of the business key, ordered by their offsets. The selected rows are unmarshaled with UnmarshalMessage.
+	FindQuery(topic string, metadataKey string, value string) (Query, error)
+}
+
+// Find returns the messages of the topic with the value of the business key, in the order of their offsets.
+// The metadata key must be one of the schema adapter's business keys, so the lookup uses its index.
+func Find(
+	ctx context.Context,
+	db QueryExecutor,
+	schemaAdapter BusinessKeySchemaAdapter,
+	topic string,
+	metadataKey string,
+	value string,
+) ([]Row, error) {
+	if err := validateTopic(schemaAdapter, topic); err != nil {
+		return nil, err
+	}
+
+	findQuery, err := schemaAdapter.FindQuery(topic, metadataKey, value)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, findQuery.Query, findQuery.Args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query messages")
+	}
+	defer rows.Close()
+
+	var found []Row
+	for rows.Next() {
+		row, err := schemaAdapter.UnmarshalMessage(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not unmarshal message")
+		}
+		found = append(found, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not iterate messages")
+	}
+
+	return found, nil
+}
+
+// postgreSQLMaxIdentifierLength is the maximum length of PostgreSQL identifiers, like index names.
+const postgreSQLMaxIdentifierLength = 63
+
+var disallowedIndexNameCharacters = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// businessKeyIndexName returns the unquoted name of the business key's index on the messages table.
+// Names longer than maxLength are shortened, unless maxLength is 0.
+func businessKeyIndexName(messagesTable string, key BusinessKey, maxLength int) string {
+	return tableIndexName(messagesTable, disallowedIndexNameCharacters.ReplaceAllString(key.MetadataKey, "_")+"_key", maxLength)
+}
+
+// tableIndexName returns the unquoted name of an index on the table, ending with the suffix.
+// Names longer than maxLength are shortened, unless maxLength is 0.
+func tableIndexName(table string, suffix string, maxLength int) string {
+	name := unquotedTableName(table) + "_" + suffix
+	if maxLength == 0 {
+		return name
+	}
+
+	return HashedTableName(name, maxLength)
+}
+
+// sqlStringLiteral quotes the value as an SQL string literal.
+func sqlStringLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func validateBusinessKey(keys []BusinessKey, metadataKey string) error {
+	for _, key := range keys {
+		if key.MetadataKey == metadataKey {
+			return nil
+		}
+	}
+
+	return errors.Errorf("%s is not a business key of the schema", metadataKey)
+}
+
+func businessKeyIndexQueries(keys []BusinessKey, messagesTable string, maxNameLength int, expression func(metadataKey string) string) []Query {
+	var queries []Query
+	for _, key := range keys {
+		unique := ""
+		if key.Unique {
+			unique = "UNIQUE "
+		}
+
+		queries = append(queries, Query{
+			Query: `CREATE ` + unique + `INDEX IF NOT EXISTS "` + businessKeyIndexName(messagesTable, key, maxNameLength) + `"
+				ON ` + messagesTable + ` ((` + expression(key.MetadataKey) + `))`,
+		})
+	}
+
+	return queries
+}
+
+func sqliteMetadataExpression(metadataKey string) string {
+	return sqliteJSONExpression(`"metadata"`, metadataKey)
+}
+
+func sqliteJSONExpression(json string, metadataKey string) string {
+	// The key is quoted in the JSON path, so keys with dots or hyphens are not split.
+	return `json_extract(` + json + `, ` + sqlStringLiteral(`$."`+metadataKey+`"`) + `)`
+}
+
+func postgreSQLMetadataExpression(metadataKey string) string {
+	return `"metadata"->>` + sqlStringLiteral(metadataKey)
+}
+
+func (s DefaultSQLiteSchema) FindQuery(topic string, metadataKey string, value string) (Query, error) {
+	if err := validateBusinessKey(s.BusinessKeys, metadataKey); err != nil {
+		return Query{}, err
+	}
+
+	return Query{
+		Query: `SELECT "offset", "uuid", ` + s.payloadColumn() + `, ` + s.metadataColumn(topic) + ` FROM ` + s.MessagesTable(topic) + `
+			WHERE ` + sqliteJSONExpression(s.metadataExpression(topic), metadataKey) + ` = ?
+			ORDER BY "offset" ASC`,
+		Args: []any{value},
+	}, nil
+}
+
+func (s DefaultPostgreSQLSchema) FindQuery(topic string, metadataKey string, value string) (Query, error) {
+	if err := validateBusinessKey(s.BusinessKeys, metadataKey); err != nil {
+		return Query{}, err
+	}
+
+	return Query{
+		Query: `SELECT "offset", transaction_id, uuid, ` + s.payloadColumn() + `, metadata FROM ` + s.MessagesTable(topic) + `
+			WHERE ` + postgreSQLMetadataExpression(metadataKey) + ` = $1
+			ORDER BY transaction_id ASC, "offset" ASC`,
+		Args: []any{value},
+	}, nil
+}
+
+// businessKeys returns the metadata keys of the business keys of the schema adapters of this package.
+func businessKeys(schemaAdapter SchemaAdapter) []string {
+	var keys []BusinessKey
+	switch s := schemaAdapter.(type) {
+	case DefaultSQLiteSchema:
+		keys = s.BusinessKeys
+	case DefaultPostgreSQLSchema:
+		keys = s.BusinessKeys
+	}
+
+	metadataKeys := make([]string, len(keys))
+	for i, key := range keys {
+		metadataKeys[i] = key.MetadataKey
+	}
+
+	return metadataKeys
+}
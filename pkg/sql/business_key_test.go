@@ -0,0 +1,95 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFind(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "find.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topic := "orders_" + watermill.NewShortUUID()
+
+	schema := sql.DefaultSQLiteSchema{
+		BusinessKeys: []sql.BusinessKey{
+			{MetadataKey: "order_id"},
+			{MetadataKey: "invoice-number", Unique: true},
+		},
+	}
+	publisher := newCheckpointPublisher(t, db, schema)
+
+	newMessage := func(payload string, orderID string, invoiceNumber string) *message.Message {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(payload))
+		msg.Metadata.Set("order_id", orderID)
+		if invoiceNumber != "" {
+			msg.Metadata.Set("invoice-number", invoiceNumber)
+		}
+		return msg
+	}
+
+	require.NoError(t, publisher.Publish(
+		topic,
+		newMessage("placed", "1", ""),
+		newMessage("placed", "2", ""),
+		newMessage("invoiced", "1", "FV/1"),
+		newMessage("shipped", "1", ""),
+	))
+
+	err = publisher.Publish(topic, newMessage("invoiced", "2", "FV/1"))
+	assert.Error(t, err, "the invoice number should be unique")
+
+	ctx := context.Background()
+
+	rows, err := sql.Find(ctx, db, schema, topic, "order_id", "1")
+	require.NoError(t, err)
+
+	var payloads []string
+	for i, row := range rows {
+		if i > 0 {
+			assert.Greater(t, row.Offset, rows[i-1].Offset)
+		}
+		assert.Equal(t, "1", row.Msg.Metadata.Get("order_id"))
+		payloads = append(payloads, string(row.Msg.Payload))
+	}
+	assert.Equal(t, []string{"placed", "invoiced", "shipped"}, payloads)
+
+	rows, err = sql.Find(ctx, db, schema, topic, "invoice-number", "FV/1")
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "1", rows[0].Msg.Metadata.Get("order_id"))
+
+	rows, err = sql.Find(ctx, db, schema, topic, "order_id", "3")
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+
+	_, err = sql.Find(ctx, db, schema, topic, "customer_id", "1")
+	assert.Error(t, err, "only business keys should be looked up")
+}
+
+func TestDefaultSQLiteSchema_BusinessKeys(t *testing.T) {
+	schema := sql.DefaultSQLiteSchema{
+		BusinessKeys: []sql.BusinessKey{{MetadataKey: "order's id", Unique: true}},
+	}
+
+	queries := schema.SchemaInitializingQueries("orders")
+	require.Len(t, queries, 2)
+
+	index := strings.Join(strings.Fields(queries[1].Query), " ")
+	assert.Equal(
+		t,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "watermill_orders_order_s_id_key" ON "watermill_orders" ((json_extract("metadata", '$."order''s id"')))`,
+		index,
+	)
+}
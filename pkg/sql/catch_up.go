@@ -0,0 +1,33 @@
+package sql
+
+import (
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// CatchUpProgress describes a chunk of messages acked by a consumer group catching up with a backlog
+// (see SubscriberConfig.CatchUpBatchLimit).
+type CatchUpProgress struct {
+	Topic         string
+	ConsumerGroup string
+
+	// Messages is the number of messages of the chunk.
+	Messages int
+
+	// LastOffset is the offset of the last acked message of the chunk.
+	LastOffset int64
+}
+
+func (s *Subscriber) catchUpBatchLimitReached(messages int) bool {
+	return s.config.CatchUpBatchLimit > 0 && messages >= s.config.CatchUpBatchLimit
+}
+
+func (s *Subscriber) reportCatchUpProgress(progress CatchUpProgress, logger watermill.LoggerAdapter) {
+	logger.Debug("Catching up, chunk of messages acked", watermill.LogFields{
+		"chunk_messages": progress.Messages,
+		"last_offset":    progress.LastOffset,
+	})
+
+	if s.config.OnCatchUpProgress != nil {
+		s.config.OnCatchUpProgress(progress)
+	}
+}
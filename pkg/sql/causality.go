@@ -0,0 +1,94 @@
+package sql
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	// CorrelationIDMetadataKey is the metadata key of the correlation ID.
+	// It's the same key as used by the CorrelationID middleware of Watermill.
+	CorrelationIDMetadataKey = "correlation_id"
+
+	// CausationIDMetadataKey is the metadata key of the causation ID: the ID of the message which caused the message.
+	CausationIDMetadataKey = "causation_id"
+)
+
+const (
+	correlationIDContextKey contextKey = "correlation_id"
+	causationIDContextKey   contextKey = "causation_id"
+)
+
+// ContextWithCorrelationID returns a context with the correlation ID.
+// The publisher stores it in the metadata of messages published with the context (see CorrelationIDMetadataKey).
+func ContextWithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDContextKey, correlationID)
+}
+
+// ContextWithCausationID returns a context with the causation ID.
+// The publisher stores it in the metadata of messages published with the context (see CausationIDMetadataKey).
+func ContextWithCausationID(ctx context.Context, causationID string) context.Context {
+	return context.WithValue(ctx, causationIDContextKey, causationID)
+}
+
+// CorrelationIDFromContext returns the correlation ID from the context.
+// The subscriber restores it in the context of consumed messages.
+func CorrelationIDFromContext(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDContextKey).(string)
+	return correlationID
+}
+
+// CausationIDFromContext returns the causation ID from the context.
+// The subscriber restores it in the context of consumed messages.
+func CausationIDFromContext(ctx context.Context) string {
+	causationID, _ := ctx.Value(causationIDContextKey).(string)
+	return causationID
+}
+
+// CorrelationID returns the correlation ID of the message, from its metadata or its context.
+func CorrelationID(msg *message.Message) string {
+	if correlationID := msg.Metadata.Get(CorrelationIDMetadataKey); correlationID != "" {
+		return correlationID
+	}
+
+	return CorrelationIDFromContext(msg.Context())
+}
+
+// CausationID returns the causation ID of the message, from its metadata or its context.
+func CausationID(msg *message.Message) string {
+	if causationID := msg.Metadata.Get(CausationIDMetadataKey); causationID != "" {
+		return causationID
+	}
+
+	return CausationIDFromContext(msg.Context())
+}
+
+// setCausalityMetadata stores the correlation and causation IDs from the message's context in its metadata,
+// unless the metadata already contains them.
+func setCausalityMetadata(msg *message.Message) {
+	if msg.Metadata.Get(CorrelationIDMetadataKey) == "" {
+		if correlationID := CorrelationIDFromContext(msg.Context()); correlationID != "" {
+			msg.Metadata.Set(CorrelationIDMetadataKey, correlationID)
+		}
+	}
+
+	if msg.Metadata.Get(CausationIDMetadataKey) == "" {
+		if causationID := CausationIDFromContext(msg.Context()); causationID != "" {
+			msg.Metadata.Set(CausationIDMetadataKey, causationID)
+		}
+	}
+}
+
+// contextWithCausality returns a context with the correlation and causation IDs from the message's metadata.
+func contextWithCausality(ctx context.Context, msg *message.Message) context.Context {
+	if correlationID := msg.Metadata.Get(CorrelationIDMetadataKey); correlationID != "" {
+		ctx = ContextWithCorrelationID(ctx, correlationID)
+	}
+
+	if causationID := msg.Metadata.Get(CausationIDMetadataKey); causationID != "" {
+		ctx = ContextWithCausationID(ctx, causationID)
+	}
+
+	return ctx
+}
@@ -0,0 +1,224 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CheckpointingOffsetsAdapter is an optional interface of OffsetsAdapter, implemented by adapters which can list
+// and overwrite the acked offsets of consumer groups. It's used by ExportCheckpoint and ImportCheckpoint.
+type CheckpointingOffsetsAdapter interface {
+	OffsetsAdapter
+
+	// ConsumerGroupOffsetsQuery returns the SQL query and arguments which select consumer_group and offset_acked
+	// of all consumer groups of the topic.
+	ConsumerGroupOffsetsQuery(topic string) Query
+
+	// SetAckedOffsetQueries returns the SQL queries and arguments which set the acked offset of the consumer group,
+	// creating the consumer group if it doesn't exist. Pending claims of messages are discarded.
+	SetAckedOffsetQueries(topic string, consumerGroup string, offsetAcked int64) []Query
+}
+
+// Checkpoint is a portable snapshot of the consumption positions of all consumer groups of a topic.
+// It's created by ExportCheckpoint and may be marshaled to JSON.
+type Checkpoint struct {
+	Topic          string                    `json:"topic"`
+	CreatedAt      time.Time                 `json:"created_at"`
+	ConsumerGroups []ConsumerGroupCheckpoint `json:"consumer_groups"`
+}
+
+type ConsumerGroupCheckpoint struct {
+	ConsumerGroup string `json:"consumer_group"`
+	OffsetAcked   int64  `json:"offset_acked"`
+
+	// LastAckedUUID is the UUID of the message with OffsetAcked. It's empty if the schema adapter
+	// wasn't passed to ExportCheckpoint, or if the message doesn't exist anymore.
+	LastAckedUUID string `json:"last_acked_uuid,omitempty"`
+}
+
+// ExportCheckpoint returns the acked offsets of all consumer groups of the topic.
+//
+// If schemaAdapter is not nil, the UUIDs of the last acked messages are exported too, so the checkpoint
+// can be imported into a database where messages have different offsets (for example, copied by Importer).
+// schemaAdapter has the same requirements as ImporterConfig.SourceSchemaAdapter.
+//
+// Offsets acked while the checkpoint is exported may be missing from it, so subscribers should be stopped.
+func ExportCheckpoint(
+	ctx context.Context,
+	db QueryExecutor,
+	schemaAdapter SchemaAdapter,
+	offsetsAdapter CheckpointingOffsetsAdapter,
+	topic string,
+) (Checkpoint, error) {
+	if err := validateTopic(schemaAdapter, topic); err != nil {
+		return Checkpoint{}, err
+	}
+
+	offsetsQuery := offsetsAdapter.ConsumerGroupOffsetsQuery(topic)
+	rows, err := db.QueryContext(ctx, offsetsQuery.Query, offsetsQuery.Args...)
+	if err != nil {
+		return Checkpoint{}, errors.Wrap(err, "could not query consumer group offsets")
+	}
+
+	checkpoint := Checkpoint{
+		Topic:     topic,
+		CreatedAt: time.Now().UTC(),
+	}
+	for rows.Next() {
+		var group ConsumerGroupCheckpoint
+		if err := rows.Scan(&group.ConsumerGroup, &group.OffsetAcked); err != nil {
+			_ = rows.Close()
+			return Checkpoint{}, errors.Wrap(err, "could not scan consumer group offset")
+		}
+		checkpoint.ConsumerGroups = append(checkpoint.ConsumerGroups, group)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return Checkpoint{}, errors.Wrap(err, "could not query consumer group offsets")
+	}
+	if err := rows.Close(); err != nil {
+		return Checkpoint{}, errors.Wrap(err, "could not close rows")
+	}
+
+	if schemaAdapter == nil {
+		return checkpoint, nil
+	}
+
+	for i, group := range checkpoint.ConsumerGroups {
+		if group.OffsetAcked <= 0 {
+			continue
+		}
+
+		batch, err := readMessagesAfter(ctx, db, schemaAdapter, topic, group.OffsetAcked-1)
+		if err != nil {
+			return Checkpoint{}, errors.Wrapf(err, "could not read last message acked by consumer group %s", group.ConsumerGroup)
+		}
+		if len(batch) > 0 && batch[0].Offset == group.OffsetAcked {
+			checkpoint.ConsumerGroups[i].LastAckedUUID = batch[0].Msg.UUID
+		}
+	}
+
+	return checkpoint, nil
+}
+
+// ImportCheckpoint sets the acked offsets of the consumer groups of the topic to the offsets from the checkpoint.
+// The topic may be different from the checkpoint's topic. The offsets table is created if it doesn't exist,
+// and all offsets are set in one transaction.
+//
+// If schemaAdapter is nil, the offsets are imported as they are, which is correct only when the messages
+// have the same offsets in both databases (for example, after restoring a backup).
+// Otherwise, the consumer groups are moved to the offsets of the messages with LastAckedUUID,
+// which are found by reading the whole topic. If any of them is not found, no offsets are imported.
+// schemaAdapter has the same requirements as ImporterConfig.SourceSchemaAdapter.
+//
+// The subscribers of the topic should be stopped during the import.
+func ImportCheckpoint(
+	ctx context.Context,
+	db TxBeginner,
+	schemaAdapter SchemaAdapter,
+	offsetsAdapter CheckpointingOffsetsAdapter,
+	topic string,
+	checkpoint Checkpoint,
+) error {
+	if err := validateTopic(schemaAdapter, topic); err != nil {
+		return err
+	}
+
+	offsets := make(map[string]int64, len(checkpoint.ConsumerGroups))
+	for _, group := range checkpoint.ConsumerGroups {
+		offsets[group.ConsumerGroup] = group.OffsetAcked
+	}
+
+	if schemaAdapter != nil {
+		mapped, err := mapCheckpointOffsets(ctx, db, schemaAdapter, topic, checkpoint)
+		if err != nil {
+			return err
+		}
+		offsets = mapped
+	}
+
+	// Tables are created outside of the transaction, as creating tables implicitly commits it in MySQL.
+	for _, q := range offsetsAdapter.SchemaInitializingQueries(topic) {
+		if _, err := db.ExecContext(ctx, q.Query, q.Args...); err != nil {
+			return errors.Wrap(err, "could not initialize offsets schema")
+		}
+	}
+
+	return runInTx(ctx, db, func(ctx context.Context, tx Tx) error {
+		for _, group := range checkpoint.ConsumerGroups {
+			for _, q := range offsetsAdapter.SetAckedOffsetQueries(topic, group.ConsumerGroup, offsets[group.ConsumerGroup]) {
+				if _, err := tx.ExecContext(ctx, q.Query, q.Args...); err != nil {
+					return errors.Wrapf(err, "could not set offset of consumer group %s", group.ConsumerGroup)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// mapCheckpointOffsets returns the offsets of the last acked messages of the consumer groups in the topic.
+func mapCheckpointOffsets(
+	ctx context.Context,
+	db QueryExecutor,
+	schemaAdapter SchemaAdapter,
+	topic string,
+	checkpoint Checkpoint,
+) (map[string]int64, error) {
+	offsets := map[string]int64{}
+	offsetsByUUID := map[string]int64{}
+
+	for _, group := range checkpoint.ConsumerGroups {
+		if group.OffsetAcked <= 0 {
+			offsets[group.ConsumerGroup] = 0
+			continue
+		}
+		if group.LastAckedUUID == "" {
+			return nil, errors.Errorf("last acked message of consumer group %s is unknown", group.ConsumerGroup)
+		}
+		offsetsByUUID[group.LastAckedUUID] = 0
+	}
+
+	remaining := len(offsetsByUUID)
+	var afterOffset int64
+	for remaining > 0 {
+		batch, err := readMessagesAfter(ctx, db, schemaAdapter, topic, afterOffset)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, row := range batch {
+			if row.Offset > afterOffset {
+				afterOffset = row.Offset
+			}
+
+			offset, ok := offsetsByUUID[row.Msg.UUID]
+			if ok && offset == 0 {
+				offsetsByUUID[row.Msg.UUID] = row.Offset
+				remaining--
+			}
+		}
+	}
+
+	for _, group := range checkpoint.ConsumerGroups {
+		if group.OffsetAcked <= 0 {
+			continue
+		}
+
+		offset := offsetsByUUID[group.LastAckedUUID]
+		if offset == 0 {
+			return nil, errors.Errorf(
+				"message %s acked by consumer group %s not found in topic %s",
+				group.LastAckedUUID, group.ConsumerGroup, topic,
+			)
+		}
+		offsets[group.ConsumerGroup] = offset
+	}
+
+	return offsets, nil
+}
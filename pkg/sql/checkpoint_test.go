@@ -0,0 +1,136 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	sourceDB, err := stdSQL.Open("sqlite", filepath.Join(dir, "source.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sourceDB.Close()
+
+	destinationDB, err := stdSQL.Open("sqlite", filepath.Join(dir, "destination.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer destinationDB.Close()
+
+	source := sql.BeginnerFromStdSQL(sourceDB)
+	destination := sql.BeginnerFromStdSQL(destinationDB)
+
+	schemaAdapter := sql.DefaultSQLiteSchema{SubscribeBatchSize: 1}
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+	topic := "checkpoint_" + watermill.NewShortUUID()
+
+	var uuids []string
+	sourcePublisher := newCheckpointPublisher(t, source, schemaAdapter)
+	for i := 0; i < 5; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(strconv.Itoa(i)))
+		require.NoError(t, sourcePublisher.Publish(topic, msg))
+		uuids = append(uuids, msg.UUID)
+	}
+
+	// The consumer group acks the first three messages.
+	assert.Equal(t, uuids[0:4], consumeCheckpointMessages(t, source, schemaAdapter, offsetsAdapter, topic, 4))
+
+	checkpoint, err := sql.ExportCheckpoint(context.Background(), source, schemaAdapter, offsetsAdapter, topic)
+	require.NoError(t, err)
+	require.Len(t, checkpoint.ConsumerGroups, 1)
+	assert.Equal(t, sql.ConsumerGroupCheckpoint{
+		ConsumerGroup: "workers",
+		OffsetAcked:   3,
+		LastAckedUUID: uuids[2],
+	}, checkpoint.ConsumerGroups[0])
+
+	marshaled, err := json.Marshal(checkpoint)
+	require.NoError(t, err)
+
+	var unmarshaled sql.Checkpoint
+	require.NoError(t, json.Unmarshal(marshaled, &unmarshaled))
+
+	// Other messages in the destination shift the offsets of the imported messages.
+	destinationPublisher := newCheckpointPublisher(t, destination, schemaAdapter)
+	require.NoError(t, destinationPublisher.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+
+	importer, err := sql.NewImporter(source, destination, sql.ImporterConfig{
+		SourceSchemaAdapter:      schemaAdapter,
+		DestinationSchemaAdapter: schemaAdapter,
+	}, logger)
+	require.NoError(t, err)
+
+	_, err = importer.Import(context.Background(), topic, topic)
+	require.NoError(t, err)
+
+	require.NoError(t, sql.ImportCheckpoint(context.Background(), destination, schemaAdapter, offsetsAdapter, topic, unmarshaled))
+
+	assert.Equal(t, uuids[3:5], consumeCheckpointMessages(t, destination, schemaAdapter, offsetsAdapter, topic, 2))
+
+	unmarshaled.ConsumerGroups[0].LastAckedUUID = "missing"
+	err = sql.ImportCheckpoint(context.Background(), destination, schemaAdapter, offsetsAdapter, topic, unmarshaled)
+	assert.ErrorContains(t, err, "message missing acked by consumer group workers not found")
+}
+
+func newCheckpointPublisher(t *testing.T, db sql.TxBeginner, schemaAdapter sql.SchemaAdapter) message.Publisher {
+	publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+		SchemaAdapter:        schemaAdapter,
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	return publisher
+}
+
+// consumeCheckpointMessages receives count messages, acking all of them but the last one.
+func consumeCheckpointMessages(
+	t *testing.T,
+	db sql.TxBeginner,
+	schemaAdapter sql.SchemaAdapter,
+	offsetsAdapter sql.OffsetsAdapter,
+	topic string,
+	count int,
+) []string {
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "workers",
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   offsetsAdapter,
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+	}, logger)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, subscriber.Close())
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	var received []string
+	for len(received) < count {
+		select {
+		case msg := <-messages:
+			received = append(received, msg.UUID)
+			if len(received) < count {
+				msg.Ack()
+			}
+		case <-ctx.Done():
+			t.Fatalf("received only %d of %d messages", len(received), count)
+		}
+	}
+
+	return received
+}
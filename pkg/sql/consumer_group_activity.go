@@ -0,0 +1,226 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// ConsumerGroupActivityStore stores the times when consumer groups were last active.
+// Subscribers update it when SubscriberConfig.ActivityStore is set, and RemoveIdleConsumerGroups reads it.
+type ConsumerGroupActivityStore interface {
+	// MarkActive stores the time when the consumer group was last active.
+	MarkActive(ctx context.Context, topic string, consumerGroup string, at time.Time) error
+
+	// LastActive returns the times when the consumer groups of the topic were last active.
+	LastActive(ctx context.Context, topic string) (map[string]time.Time, error)
+
+	// Forget removes the consumer group from the store.
+	Forget(ctx context.Context, topic string, consumerGroup string) error
+}
+
+// ConsumerGroupDeletingOffsetsAdapter is an optional interface of OffsetsAdapter, implemented by adapters
+// which can remove consumer groups. It's used by RemoveIdleConsumerGroups.
+type ConsumerGroupDeletingOffsetsAdapter interface {
+	CheckpointingOffsetsAdapter
+
+	// DeleteConsumerGroupQueries returns the SQL queries and arguments which remove the offsets of the consumer group.
+	DeleteConsumerGroupQueries(topic string, consumerGroup string) []Query
+}
+
+// IdleConsumerGroupsPolicy defines which consumer groups are removed by RemoveIdleConsumerGroups.
+type IdleConsumerGroupsPolicy struct {
+	// IdleThreshold is the time after which consumer groups which were not active are removed. It's required.
+	IdleThreshold time.Duration
+
+	// ProtectedConsumerGroups are never removed, for example, consumer groups of rarely running batch jobs.
+	ProtectedConsumerGroups []string
+}
+
+func (p IdleConsumerGroupsPolicy) validate() error {
+	if p.IdleThreshold <= 0 {
+		return errors.New("idle threshold must be a positive duration")
+	}
+
+	return nil
+}
+
+func (p IdleConsumerGroupsPolicy) isProtected(consumerGroup string) bool {
+	for _, protected := range p.ProtectedConsumerGroups {
+		if protected == consumerGroup {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RemoveIdleConsumerGroups removes the offsets of consumer groups of the topic which were not active
+// for longer than the policy's IdleThreshold, so they don't hold back the deletion of consumed messages.
+// Subscribers of the topic must have SubscriberConfig.ActivityStore set to the same store.
+//
+// Consumer groups which are not known to the store (for example, subscribed before the activity was tracked)
+// are marked as active now, so they are removed only after they stay idle for IdleThreshold.
+//
+// RemoveIdleConsumerGroups may be executed periodically, while subscribers are running.
+// It returns the removed consumer groups.
+func RemoveIdleConsumerGroups(
+	ctx context.Context,
+	db QueryExecutor,
+	offsetsAdapter ConsumerGroupDeletingOffsetsAdapter,
+	activityStore ConsumerGroupActivityStore,
+	topic string,
+	policy IdleConsumerGroupsPolicy,
+	logger watermill.LoggerAdapter,
+) ([]string, error) {
+	if err := policy.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid policy")
+	}
+	if err := validateTopicName(topic); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	checkpoint, err := ExportCheckpoint(ctx, db, nil, offsetsAdapter, topic)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list consumer groups")
+	}
+
+	lastActive, err := activityStore.LastActive(ctx, topic)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query consumer groups activity")
+	}
+
+	now := time.Now()
+	var removed []string
+	for _, group := range checkpoint.ConsumerGroups {
+		if policy.isProtected(group.ConsumerGroup) {
+			continue
+		}
+
+		at, ok := lastActive[group.ConsumerGroup]
+		if !ok {
+			if err := activityStore.MarkActive(ctx, topic, group.ConsumerGroup, now); err != nil {
+				return removed, errors.Wrapf(err, "could not mark consumer group %s as active", group.ConsumerGroup)
+			}
+			continue
+		}
+		if now.Sub(at) <= policy.IdleThreshold {
+			continue
+		}
+
+		logger.Info("Removing idle consumer group", watermill.LogFields{
+			"topic":          topic,
+			"consumer_group": group.ConsumerGroup,
+			"offset_acked":   group.OffsetAcked,
+			"last_active":    at,
+		})
+
+		for _, q := range offsetsAdapter.DeleteConsumerGroupQueries(topic, group.ConsumerGroup) {
+			if _, err := db.ExecContext(ctx, q.Query, q.Args...); err != nil {
+				return removed, errors.Wrapf(err, "could not remove consumer group %s", group.ConsumerGroup)
+			}
+		}
+		if err := activityStore.Forget(ctx, topic, group.ConsumerGroup); err != nil {
+			return removed, errors.Wrapf(err, "could not forget consumer group %s", group.ConsumerGroup)
+		}
+
+		removed = append(removed, group.ConsumerGroup)
+	}
+
+	return removed, nil
+}
+
+// SQLiteConsumerGroupActivityStore stores the activity of consumer groups in a SQLite table.
+type SQLiteConsumerGroupActivityStore struct {
+	DB QueryExecutor
+
+	// TableName may be used to override the name of the table. The name should not be quoted.
+	//
+	// Default value is watermill_consumer_groups_activity.
+	TableName string
+}
+
+// InitializeSchema creates the table storing the activity, if it doesn't exist yet.
+func (s SQLiteConsumerGroupActivityStore) InitializeSchema(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table()+` (
+		"topic" TEXT NOT NULL,
+		"consumer_group" TEXT NOT NULL,
+		"last_active_at" INTEGER NOT NULL,
+		PRIMARY KEY ("topic", "consumer_group")
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "could not create consumer groups activity table")
+	}
+
+	return nil
+}
+
+func (s SQLiteConsumerGroupActivityStore) MarkActive(
+	ctx context.Context,
+	topic string,
+	consumerGroup string,
+	at time.Time,
+) error {
+	_, err := s.DB.ExecContext(
+		ctx,
+		`INSERT INTO `+s.table()+` ("topic", "consumer_group", "last_active_at") VALUES (?, ?, ?)
+		ON CONFLICT ("topic", "consumer_group") DO UPDATE SET "last_active_at" = excluded."last_active_at"`,
+		topic, consumerGroup, at.UnixMilli(),
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not mark consumer group as active")
+	}
+
+	return nil
+}
+
+func (s SQLiteConsumerGroupActivityStore) LastActive(ctx context.Context, topic string) (map[string]time.Time, error) {
+	rows, err := s.DB.QueryContext(
+		ctx,
+		`SELECT "consumer_group", "last_active_at" FROM `+s.table()+` WHERE "topic" = ?`,
+		topic,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query consumer groups activity")
+	}
+	defer rows.Close()
+
+	lastActive := map[string]time.Time{}
+	for rows.Next() {
+		var consumerGroup string
+		var at int64
+		if err := rows.Scan(&consumerGroup, &at); err != nil {
+			return nil, errors.Wrap(err, "could not scan consumer group activity")
+		}
+		lastActive[consumerGroup] = time.UnixMilli(at)
+	}
+
+	return lastActive, rows.Err()
+}
+
+func (s SQLiteConsumerGroupActivityStore) Forget(ctx context.Context, topic string, consumerGroup string) error {
+	_, err := s.DB.ExecContext(
+		ctx,
+		`DELETE FROM `+s.table()+` WHERE "topic" = ? AND "consumer_group" = ?`,
+		topic, consumerGroup,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not forget consumer group")
+	}
+
+	return nil
+}
+
+func (s SQLiteConsumerGroupActivityStore) table() string {
+	if s.TableName != "" {
+		return fmt.Sprintf(`"%s"`, s.TableName)
+	}
+	return `"watermill_consumer_groups_activity"`
+}
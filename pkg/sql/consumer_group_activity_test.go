@@ -0,0 +1,80 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveIdleConsumerGroups(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "activity.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+	topic := "activity_" + watermill.NewShortUUID()
+
+	activityStore := sql.SQLiteConsumerGroupActivityStore{DB: db}
+	require.NoError(t, activityStore.InitializeSchema(ctx))
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "live",
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   offsetsAdapter,
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+		ActivityStore:    activityStore,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	_, err = subscriber.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		lastActive, err := activityStore.LastActive(ctx, topic)
+		require.NoError(t, err)
+		_, ok := lastActive["live"]
+		return ok
+	}, time.Second*5, time.Millisecond*10)
+
+	for _, group := range []string{"live", "idle", "protected", "untracked"} {
+		require.NoError(t, sql.ImportCheckpoint(ctx, db, nil, offsetsAdapter, topic, sql.Checkpoint{
+			ConsumerGroups: []sql.ConsumerGroupCheckpoint{{ConsumerGroup: group}},
+		}))
+	}
+	require.NoError(t, activityStore.MarkActive(ctx, topic, "idle", time.Now().Add(-time.Hour*2)))
+	require.NoError(t, activityStore.MarkActive(ctx, topic, "protected", time.Now().Add(-time.Hour*2)))
+
+	policy := sql.IdleConsumerGroupsPolicy{
+		IdleThreshold:           time.Hour,
+		ProtectedConsumerGroups: []string{"protected"},
+	}
+
+	removed, err := sql.RemoveIdleConsumerGroups(ctx, db, offsetsAdapter, activityStore, topic, policy, logger)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"idle"}, removed)
+
+	checkpoint, err := sql.ExportCheckpoint(ctx, db, nil, offsetsAdapter, topic)
+	require.NoError(t, err)
+
+	var groups []string
+	for _, group := range checkpoint.ConsumerGroups {
+		groups = append(groups, group.ConsumerGroup)
+	}
+	assert.Equal(t, []string{"live", "protected", "untracked"}, groups)
+
+	lastActive, err := activityStore.LastActive(ctx, topic)
+	require.NoError(t, err)
+	assert.NotContains(t, lastActive, "idle")
+	assert.Contains(t, lastActive, "untracked", "untracked consumer groups should be marked as active")
+}
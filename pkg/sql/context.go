@@ -8,10 +8,11 @@ import (
 type contextKey string
 
 const (
-	txContextKey contextKey = "tx"
+	txContextKey           contextKey = "tx"
+	extraColumnsContextKey contextKey = "extra_columns"
 )
 
-func setTxToContext(ctx context.Context, tx *sql.Tx) context.Context {
+func setTxToContext(ctx context.Context, tx Tx) context.Context {
 	return context.WithValue(ctx, txContextKey, tx)
 }
 
@@ -21,7 +22,46 @@ func setTxToContext(ctx context.Context, tx *sql.Tx) context.Context {
 //
 // It is useful when you want to ensure that data is updated only when the message is processed.
 // Example usage: https://github.com/ThreeDotsLabs/watermill/tree/master/_examples/real-world-examples/exactly-once-delivery-counter
+//
+// It returns false if the transaction is not based on database/sql (like the transactions of BeginnerFromPgx,
+// see PgxTxFromContext).
 func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
-	tx, ok := ctx.Value(txContextKey).(*sql.Tx)
-	return tx, ok
+	tx, ok := ctx.Value(txContextKey).(Tx)
+	if !ok {
+		return nil, false
+	}
+
+	stdTx, ok := unwrapTx(tx).(*stdSQLTx)
+	if !ok {
+		return nil, false
+	}
+
+	return stdTx.Tx, true
+}
+
+// unwrapTx returns the transaction wrapped by the package (like the transactions of FaultyDB and SingleWriter).
+func unwrapTx(tx Tx) Tx {
+	for {
+		wrapper, ok := tx.(interface{ unwrapTx() Tx })
+		if !ok {
+			return tx
+		}
+		tx = wrapper.unwrapTx()
+	}
+}
+
+func setExtraColumnsToContext(ctx context.Context, extraColumns map[string]any) context.Context {
+	if len(extraColumns) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, extraColumnsContextKey, extraColumns)
+}
+
+// ExtraColumnsFromContext returns the values of custom columns of the consumed message (see Row.ExtraColumns).
+//
+// It returns false if the schema adapter didn't return any extra columns.
+func ExtraColumnsFromContext(ctx context.Context) (map[string]any, bool) {
+	extraColumns, ok := ctx.Value(extraColumnsContextKey).(map[string]any)
+	return extraColumns, ok
 }
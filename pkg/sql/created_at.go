@@ -0,0 +1,125 @@
+package sql
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CreatedAtPrecision is the format of the created_at values of schemas storing them as text (like DefaultSQLiteSchema).
+// Values are always stored in UTC.
+//
+// Values of the same precision are ordered correctly when compared as text, so the precision of existing tables
+// shouldn't be changed to CreatedAtRFC3339Nano, as its values are not ordered with the values of the other precisions.
+type CreatedAtPrecision int
+
+const (
+	// CreatedAtSeconds stores the values with seconds precision, like "2006-01-02 15:04:05",
+	// which is the format of CURRENT_TIMESTAMP in SQLite.
+	CreatedAtSeconds CreatedAtPrecision = iota
+
+	// CreatedAtMillis stores the values with milliseconds precision, like "2006-01-02 15:04:05.000".
+	CreatedAtMillis
+
+	// CreatedAtRFC3339Nano stores the values in RFC 3339 format with nanoseconds, like "2006-01-02T15:04:05.000000000Z".
+	// The fractional seconds are not trimmed, so the values are ordered correctly.
+	// Values generated by SQLite have milliseconds precision, as SQLite clock doesn't provide more.
+	CreatedAtRFC3339Nano
+)
+
+// layout returns the time layout of the stored values.
+func (p CreatedAtPrecision) layout() string {
+	switch p {
+	case CreatedAtMillis:
+		return "2006-01-02 15:04:05.000"
+	case CreatedAtRFC3339Nano:
+		return "2006-01-02T15:04:05.000000000Z"
+	default:
+		return "2006-01-02 15:04:05"
+	}
+}
+
+// sqliteDefault returns the SQLite expression generating the current time in the layout.
+func (p CreatedAtPrecision) sqliteDefault() string {
+	switch p {
+	case CreatedAtMillis:
+		return `(strftime('%Y-%m-%d %H:%M:%f', 'now'))`
+	case CreatedAtRFC3339Nano:
+		return `(strftime('%Y-%m-%dT%H:%M:%f', 'now') || '000000Z')`
+	default:
+		return `CURRENT_TIMESTAMP`
+	}
+}
+
+func (p CreatedAtPrecision) format(t time.Time) string {
+	return t.UTC().Format(p.layout())
+}
+
+// createdAtLayouts are the layouts of created_at values returned as text by database drivers.
+// Fractional seconds are parsed even if the layout doesn't contain them.
+var createdAtLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// ParseCreatedAt converts the created_at value scanned into any to time in UTC, so it can be used
+// by UnmarshalMessage of custom schema adapters to set Row.CreatedAt.
+//
+// Drivers return the values as time.Time (like pgx, or go-sql-driver/mysql with parseTime),
+// as text (like SQLite drivers for TEXT columns), or as Unix time in seconds (like SQLite's unixepoch()).
+// Text values without a time zone are UTC.
+func ParseCreatedAt(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v.UTC(), nil
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	case []byte:
+		return parseCreatedAtText(string(v))
+	case string:
+		return parseCreatedAtText(v)
+	default:
+		return time.Time{}, errors.Errorf("unsupported created_at type %T", value)
+	}
+}
+
+func parseCreatedAtText(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range createdAtLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, errors.Errorf("could not parse created_at %q", value)
+}
+
+// scanWithCreatedAt scans the row into dest, and the created_at column following them, if the row has it.
+// If the row doesn't provide its columns, created_at is scanned when selected is true.
+func scanWithCreatedAt(row Scanner, dest []any, selected bool) (time.Time, error) {
+	if columnsScanner, ok := row.(ColumnsScanner); ok {
+		columns, err := columnsScanner.Columns()
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "could not get columns")
+		}
+		selected = len(columns) > len(dest)
+	}
+
+	if !selected {
+		return time.Time{}, row.Scan(dest...)
+	}
+
+	var createdAt any
+	if err := row.Scan(append(dest, &createdAt)...); err != nil {
+		return time.Time{}, err
+	}
+
+	return ParseCreatedAt(createdAt)
+}
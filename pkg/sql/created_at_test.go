@@ -0,0 +1,103 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCreatedAt(t *testing.T) {
+	expected := time.Date(2024, 3, 1, 12, 30, 15, 0, time.UTC)
+	warsaw := time.FixedZone("CET", 3600)
+
+	testCases := []struct {
+		name     string
+		value    any
+		expected time.Time
+	}{
+		{name: "sqlite_seconds", value: "2024-03-01 12:30:15", expected: expected},
+		{name: "sqlite_millis", value: "2024-03-01 12:30:15.250", expected: expected.Add(250 * time.Millisecond)},
+		{name: "rfc3339_nano", value: "2024-03-01T12:30:15.000000123Z", expected: expected.Add(123)},
+		{name: "rfc3339_offset", value: "2024-03-01T13:30:15+01:00", expected: expected},
+		{name: "bytes", value: []byte("2024-03-01 12:30:15"), expected: expected},
+		{name: "time_in_zone", value: expected.In(warsaw), expected: expected},
+		{name: "unix", value: expected.Unix(), expected: expected},
+		{name: "null", value: nil, expected: time.Time{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed, err := sql.ParseCreatedAt(tc.value)
+			require.NoError(t, err)
+			assert.True(t, tc.expected.Equal(parsed), "expected %s, got %s", tc.expected, parsed)
+			if !parsed.IsZero() {
+				assert.Equal(t, time.UTC, parsed.Location())
+			}
+		})
+	}
+
+	_, err := sql.ParseCreatedAt("yesterday")
+	assert.Error(t, err)
+}
+
+func TestDefaultSQLiteSchema_CreatedAtPrecision(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 30, 15, 123456789, time.FixedZone("CET", 3600))
+
+	testCases := []struct {
+		precision sql.CreatedAtPrecision
+		stored    string
+		parsed    time.Time
+	}{
+		{precision: sql.CreatedAtSeconds, stored: "2024-03-01 11:30:15", parsed: createdAt.Truncate(time.Second)},
+		{precision: sql.CreatedAtMillis, stored: "2024-03-01 11:30:15.123", parsed: createdAt.Truncate(time.Millisecond)},
+		{precision: sql.CreatedAtRFC3339Nano, stored: "2024-03-01T11:30:15.123456789Z", parsed: createdAt},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.stored, func(t *testing.T) {
+			sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "created_at.sqlite")+"?_pragma=busy_timeout(10000)")
+			require.NoError(t, err)
+			defer sqlDB.Close()
+
+			ctx := context.Background()
+			db := sql.BeginnerFromStdSQL(sqlDB)
+			topic := "created_at_" + watermill.NewShortUUID()
+			schemaAdapter := sql.DefaultSQLiteSchema{CreatedAtPrecision: tc.precision, SelectCreatedAt: true}
+
+			publisher := newCheckpointPublisher(t, db, schemaAdapter)
+			before := time.Now().UTC().Truncate(time.Second)
+			require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+
+			insertQuery, err := schemaAdapter.InsertWithCreatedAtQuery(
+				topic,
+				message.Messages{message.NewMessage(watermill.NewUUID(), nil)},
+				[]time.Time{createdAt},
+			)
+			require.NoError(t, err)
+			_, err = sqlDB.Exec(insertQuery.Query, insertQuery.Args...)
+			require.NoError(t, err)
+
+			var stored string
+			require.NoError(t, sqlDB.QueryRow(`SELECT "created_at" FROM `+schemaAdapter.MessagesTable(topic)+` WHERE "offset" = 2`).Scan(&stored))
+			assert.Equal(t, tc.stored, stored)
+
+			peeked, err := sql.SQLiteTopicAdmin{DB: db, SchemaAdapter: schemaAdapter}.PeekMessages(ctx, topic, 0, 10)
+			require.NoError(t, err)
+			require.Len(t, peeked, 2)
+
+			assert.False(t, peeked[0].CreatedAt.Before(before), "created_at generated by SQLite should be in UTC")
+			assert.WithinDuration(t, time.Now(), peeked[0].CreatedAt, time.Minute)
+			assert.True(t, tc.parsed.Equal(peeked[1].CreatedAt), "expected %s, got %s", tc.parsed, peeked[1].CreatedAt)
+			assert.Equal(t, time.UTC, peeked[1].CreatedAt.Location())
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package sql
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// ConsumerDeduplicator detects messages which were already handled by the consumer group,
+// for example, messages published twice by a publisher retrying after a timeout.
+// It's used by Subscriber when SubscriberConfig.Deduplicator is set, and messages are recognized by their UUIDs.
+//
+// db is the transaction consuming the message, or the database handle passed to NewSubscriber
+// for offsets adapters which consume messages without transactions.
+type ConsumerDeduplicator interface {
+	// IsDuplicate reports whether the message was already handled by the consumer group.
+	IsDuplicate(ctx context.Context, db QueryExecutor, topic string, consumerGroup string, msg *message.Message) (bool, error)
+
+	// MarkHandled records that the message was acked by the consumer group's handler.
+	MarkHandled(ctx context.Context, db QueryExecutor, topic string, consumerGroup string, msg *message.Message) error
+}
+
+// InMemoryDeduplicator is a ConsumerDeduplicator remembering the UUIDs of recently handled messages in memory,
+// so duplicates are detected only within one subscriber, and only until it's restarted.
+//
+// Messages are remembered until the window expires, or until they are evicted by newer messages
+// when the size is exceeded, whichever comes first.
+//
+// Messages are remembered even if the transaction acking them fails later, so a message redelivered
+// after a failed commit is skipped. SQLiteConsumerDeduplicator doesn't have this problem,
+// as it's updated in the consuming transaction.
+type InMemoryDeduplicator struct {
+	size   int
+	window time.Duration
+
+	lock     sync.Mutex
+	handled  map[string]*list.Element
+	eviction *list.List
+}
+
+type inMemoryDeduplicatorEntry struct {
+	key       string
+	handledAt time.Time
+}
+
+// NewInMemoryDeduplicator creates InMemoryDeduplicator remembering at most size messages for at most window.
+// Zero window means that messages are remembered until they are evicted.
+func NewInMemoryDeduplicator(size int, window time.Duration) (*InMemoryDeduplicator, error) {
+	if size <= 0 {
+		return nil, errors.New("size must be positive")
+	}
+	if window < 0 {
+		return nil, errors.New("window must be a positive duration")
+	}
+
+	return &InMemoryDeduplicator{
+		size:     size,
+		window:   window,
+		handled:  map[string]*list.Element{},
+		eviction: list.New(),
+	}, nil
+}
+
+func (d *InMemoryDeduplicator) IsDuplicate(
+	ctx context.Context,
+	db QueryExecutor,
+	topic string,
+	consumerGroup string,
+	msg *message.Message,
+) (bool, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	element, ok := d.handled[d.key(topic, consumerGroup, msg)]
+	if !ok {
+		return false, nil
+	}
+	if d.window != 0 && time.Since(element.Value.(inMemoryDeduplicatorEntry).handledAt) > d.window {
+		d.remove(element)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (d *InMemoryDeduplicator) MarkHandled(
+	ctx context.Context,
+	db QueryExecutor,
+	topic string,
+	consumerGroup string,
+	msg *message.Message,
+) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	key := d.key(topic, consumerGroup, msg)
+	if element, ok := d.handled[key]; ok {
+		d.remove(element)
+	}
+
+	d.handled[key] = d.eviction.PushBack(inMemoryDeduplicatorEntry{key: key, handledAt: time.Now()})
+	for d.eviction.Len() > d.size {
+		d.remove(d.eviction.Front())
+	}
+
+	return nil
+}
+
+func (d *InMemoryDeduplicator) remove(element *list.Element) {
+	d.eviction.Remove(element)
+	delete(d.handled, element.Value.(inMemoryDeduplicatorEntry).key)
+}
+
+func (d *InMemoryDeduplicator) key(topic string, consumerGroup string, msg *message.Message) string {
+	// Topics are validated, so they don't contain the separator.
+	return topic + "\x00" + consumerGroup + "\x00" + msg.UUID
+}
+
+// SQLiteConsumerDeduplicator is a ConsumerDeduplicator storing the UUIDs of handled messages in a SQLite table,
+// in the same transaction which acks them, so duplicates are detected across subscribers and restarts.
+// The table must be stored in the database of the messages.
+//
+// Expired UUIDs are not used for detecting duplicates, but they should be deleted periodically
+// with DeleteExpired.
+type SQLiteConsumerDeduplicator struct {
+	// Window is the time for which handled messages are remembered. It's required.
+	Window time.Duration
+
+	// TableName may be used to override the name of the table. The name should not be quoted.
+	//
+	// Default value is watermill_handled_messages.
+	TableName string
+}
+
+// InitializeSchema creates the table storing the handled messages, if it doesn't exist yet.
+func (d SQLiteConsumerDeduplicator) InitializeSchema(ctx context.Context, db QueryExecutor) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+d.table()+` (
+		"topic" TEXT NOT NULL,
+		"consumer_group" TEXT NOT NULL,
+		"uuid" TEXT NOT NULL,
+		"handled_at" INTEGER NOT NULL,
+		PRIMARY KEY ("topic", "consumer_group", "uuid")
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "could not create handled messages table")
+	}
+
+	return nil
+}
+
+func (d SQLiteConsumerDeduplicator) IsDuplicate(
+	ctx context.Context,
+	db QueryExecutor,
+	topic string,
+	consumerGroup string,
+	msg *message.Message,
+) (bool, error) {
+	if d.Window <= 0 {
+		return false, errors.New("window must be a positive duration")
+	}
+
+	rows, err := db.QueryContext(
+		ctx,
+		`SELECT 1 FROM `+d.table()+` WHERE "topic" = ? AND "consumer_group" = ? AND "uuid" = ? AND "handled_at" > ?`,
+		topic, consumerGroup, msg.UUID, time.Now().Add(-d.Window).UnixMilli(),
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "could not query handled message")
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
+func (d SQLiteConsumerDeduplicator) MarkHandled(
+	ctx context.Context,
+	db QueryExecutor,
+	topic string,
+	consumerGroup string,
+	msg *message.Message,
+) error {
+	_, err := db.ExecContext(
+		ctx,
+		`INSERT INTO `+d.table()+` ("topic", "consumer_group", "uuid", "handled_at") VALUES (?, ?, ?, ?)
+		ON CONFLICT ("topic", "consumer_group", "uuid") DO UPDATE SET "handled_at" = excluded."handled_at"`,
+		topic, consumerGroup, msg.UUID, time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not mark message as handled")
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes the UUIDs of messages handled before the window. It returns the number of deleted UUIDs.
+func (d SQLiteConsumerDeduplicator) DeleteExpired(ctx context.Context, db QueryExecutor) (int64, error) {
+	result, err := db.ExecContext(
+		ctx,
+		`DELETE FROM `+d.table()+` WHERE "handled_at" <= ?`,
+		time.Now().Add(-d.Window).UnixMilli(),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not delete expired handled messages")
+	}
+
+	return result.RowsAffected()
+}
+
+func (d SQLiteConsumerDeduplicator) table() string {
+	if d.TableName != "" {
+		return fmt.Sprintf(`"%s"`, d.TableName)
+	}
+	return `"watermill_handled_messages"`
+}
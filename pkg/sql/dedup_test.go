@@ -0,0 +1,133 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_Deduplicator(t *testing.T) {
+	inMemory, err := sql.NewInMemoryDeduplicator(100, time.Hour)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name         string
+		Deduplicator func(t *testing.T, db sql.TxBeginner) sql.ConsumerDeduplicator
+	}{
+		{
+			Name: "in_memory",
+			Deduplicator: func(t *testing.T, db sql.TxBeginner) sql.ConsumerDeduplicator {
+				return inMemory
+			},
+		},
+		{
+			Name: "sqlite",
+			Deduplicator: func(t *testing.T, db sql.TxBeginner) sql.ConsumerDeduplicator {
+				deduplicator := sql.SQLiteConsumerDeduplicator{Window: time.Hour}
+				require.NoError(t, deduplicator.InitializeSchema(context.Background(), db))
+				return deduplicator
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "dedup.sqlite")+"?_pragma=busy_timeout(10000)")
+			require.NoError(t, err)
+			defer sqlDB.Close()
+
+			db := sql.BeginnerFromStdSQL(sqlDB)
+			topic := "dedup_" + watermill.NewShortUUID()
+
+			duplicated := watermill.NewUUID()
+			publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+			for _, uuid := range []string{duplicated, duplicated, watermill.NewUUID(), duplicated} {
+				require.NoError(t, publisher.Publish(topic, message.NewMessage(uuid, nil)))
+			}
+			last := watermill.NewUUID()
+			require.NoError(t, publisher.Publish(topic, message.NewMessage(last, nil)))
+
+			subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+				SchemaAdapter:    sql.DefaultSQLiteSchema{},
+				OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+				InitializeSchema: true,
+				PollInterval:     time.Millisecond * 10,
+				Deduplicator:     tc.Deduplicator(t, db),
+			}, logger)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, subscriber.Close())
+			}()
+
+			events := subscriber.Events()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+
+			messages, err := subscriber.Subscribe(ctx, topic)
+			require.NoError(t, err)
+
+			var received []string
+			for len(received) == 0 || received[len(received)-1] != last {
+				select {
+				case msg := <-messages:
+					received = append(received, msg.UUID)
+					msg.Ack()
+				case <-ctx.Done():
+					t.Fatal("timeout waiting for messages")
+				}
+			}
+
+			assert.Len(t, received, 3)
+			assert.Equal(t, duplicated, received[0])
+
+			skipped := 0
+			for len(events) > 0 {
+				if _, ok := (<-events).(sql.DuplicateSkipped); ok {
+					skipped++
+				}
+			}
+			assert.Equal(t, 2, skipped)
+		})
+	}
+}
+
+func TestInMemoryDeduplicator(t *testing.T) {
+	ctx := context.Background()
+
+	deduplicator, err := sql.NewInMemoryDeduplicator(2, time.Millisecond*50)
+	require.NoError(t, err)
+
+	msg1 := message.NewMessage(watermill.NewUUID(), nil)
+	msg2 := message.NewMessage(watermill.NewUUID(), nil)
+	msg3 := message.NewMessage(watermill.NewUUID(), nil)
+
+	isDuplicate := func(consumerGroup string, msg *message.Message) bool {
+		duplicate, err := deduplicator.IsDuplicate(ctx, nil, "topic", consumerGroup, msg)
+		require.NoError(t, err)
+		return duplicate
+	}
+
+	for _, msg := range []*message.Message{msg1, msg2, msg3} {
+		require.NoError(t, deduplicator.MarkHandled(ctx, nil, "topic", "group", msg))
+	}
+
+	assert.False(t, isDuplicate("group", msg1), "evicted by size")
+	assert.True(t, isDuplicate("group", msg2))
+	assert.True(t, isDuplicate("group", msg3))
+	assert.False(t, isDuplicate("other_group", msg3))
+
+	time.Sleep(time.Millisecond * 100)
+	assert.False(t, isDuplicate("group", msg3), "expired")
+
+	_, err = sql.NewInMemoryDeduplicator(0, time.Second)
+	assert.Error(t, err)
+}
@@ -0,0 +1,202 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect describes the SQL syntax of a database, used to generate queries by DialectSchema and DialectOffsetsAdapter,
+// and by the default SQLite and MySQL adapters (with SQLiteDialect and MySQLDialect).
+//
+// Adding support for a new database with Dialect doesn't require copying the whole schema and offsets adapters.
+// Dialects implement only differences in placeholders, table creation, upserts, inserting without duplicates,
+// lock hints and limit syntax.
+type Dialect interface {
+	// QuoteIdentifier quotes the name of a table or a column.
+	QuoteIdentifier(name string) string
+
+	// Placeholder returns the placeholder of the query argument with the given 1-based index.
+	Placeholder(index int) string
+
+	// CreateTableQuery returns the query which creates the table, if it doesn't exist yet.
+	CreateTableQuery(table string, columns []DialectColumn, primaryKey []string) string
+
+	// InsertedOffsetExpression returns the expression which computes the offset of the inserted message
+	// with the given 0-based index within one insert query.
+	//
+	// It should return an empty string if the offset column is auto-incremented by the database,
+	// and the offset column will be omitted from the insert query.
+	InsertedOffsetExpression(table string, offsetColumn string, rowIndex int) string
+
+	// InsertIfNotExistsQuery returns the query which inserts the values, unless a row with the same
+	// primary key already exists.
+	InsertIfNotExistsQuery(table string, columns []string, values []string) string
+
+	// UpsertQuery returns the query which inserts the values, or sets updatedColumns to the inserted values
+	// if a row with the same keyColumns already exists.
+	UpsertQuery(table string, columns []string, values []string, keyColumns []string, updatedColumns []string) string
+
+	// SelectForUpdateQuery returns the query which selects the columns from the table
+	// and locks the selected rows until the end of the transaction.
+	SelectForUpdateQuery(table string, columns []string, where string) string
+
+	// LimitClause returns the clause appended after ORDER BY which limits the number of returned rows.
+	LimitClause(limit int) string
+
+	// SubscribeIsolationLevel returns the isolation level that will be used when subscribing.
+	SubscribeIsolationLevel() sql.IsolationLevel
+}
+
+// DialectColumnType is a database-independent type of a column, mapped to a concrete type by Dialect.
+type DialectColumnType int
+
+const (
+	// DialectColumnTypeOffset is a 64-bit integer, auto-incremented when the dialect supports it.
+	DialectColumnTypeOffset DialectColumnType = iota + 1
+
+	// DialectColumnTypeInt64 is a 64-bit integer.
+	DialectColumnTypeInt64
+
+	// DialectColumnTypeString is a short string, like UUID or consumer group name.
+	DialectColumnTypeString
+
+	// DialectColumnTypeText is a text of unlimited length, like JSON metadata.
+	DialectColumnTypeText
+
+	// DialectColumnTypeBytes is a binary value of unlimited length, like message payload.
+	DialectColumnTypeBytes
+
+	// DialectColumnTypeTimestamp is a timestamp, which defaults to the current time.
+	DialectColumnTypeTimestamp
+)
+
+// DialectColumn is a column definition passed to Dialect.CreateTableQuery.
+type DialectColumn struct {
+	Name     string
+	Type     DialectColumnType
+	Nullable bool
+}
+
+// QuoteIdentifierFunc quotes the name of a table or a column.
+//
+// It may be set in dialects to override their default quoting, for example, to run against a database
+// configured with different quoting rules (like MySQL with ANSI_QUOTES, or PostgreSQL-compatible
+// databases accepting only unquoted identifiers).
+type QuoteIdentifierFunc func(name string) string
+
+// QuoteWithDoubleQuotes quotes the identifier with double quotes, as defined by the SQL standard.
+func QuoteWithDoubleQuotes(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteWithBackticks quotes the identifier with backticks, as done by MySQL and Spanner.
+func QuoteWithBackticks(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// QuoteWithBrackets quotes the identifier with square brackets, as done by SQL Server.
+func QuoteWithBrackets(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+// NoQuoting leaves the identifier unquoted. It should be used only with trusted identifiers.
+func NoQuoting(name string) string {
+	return name
+}
+
+func quoteIdentifiers(dialect Dialect, names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = dialect.QuoteIdentifier(name)
+	}
+
+	return quoted
+}
+
+func dialectPlaceholders(dialect Dialect, firstIndex, count int) []string {
+	placeholders := make([]string, count)
+	for i := range placeholders {
+		placeholders[i] = dialect.Placeholder(firstIndex + i)
+	}
+
+	return placeholders
+}
+
+// dialectValues returns the VALUES list of rowCount rows, with argsPerRow placeholders each.
+func dialectValues(dialect Dialect, rowCount, argsPerRow int) string {
+	values := make([]string, rowCount)
+	for i := range values {
+		values[i] = "(" + strings.Join(dialectPlaceholders(dialect, i*argsPerRow+1, argsPerRow), ",") + ")"
+	}
+
+	return strings.Join(values, ",")
+}
+
+// onConflictUpsertQuery returns the upsert query using ON CONFLICT ... DO UPDATE, supported by SQLite and PostgreSQL.
+func onConflictUpsertQuery(
+	dialect Dialect,
+	table string,
+	columns []string,
+	values []string,
+	keyColumns []string,
+	updatedColumns []string,
+) string {
+	updates := make([]string, len(updatedColumns))
+	for i, column := range updatedColumns {
+		updates[i] = dialect.QuoteIdentifier(column) + " = excluded." + dialect.QuoteIdentifier(column)
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s",
+		table,
+		strings.Join(quoteIdentifiers(dialect, columns), ", "),
+		strings.Join(values, ", "),
+		strings.Join(quoteIdentifiers(dialect, keyColumns), ", "),
+		strings.Join(updates, ", "),
+	)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// columnDefinitions renders column definitions using the type names returned by columnType.
+// Timestamp columns default to currentTimestamp.
+func columnDefinitions(
+	dialect Dialect,
+	columns []DialectColumn,
+	columnType func(DialectColumnType) string,
+	currentTimestamp string,
+) string {
+	definitions := make([]string, len(columns))
+	for i, column := range columns {
+		definition := dialect.QuoteIdentifier(column.Name) + " " + columnType(column.Type)
+		if !column.Nullable {
+			definition += " NOT NULL"
+		}
+		if column.Type == DialectColumnTypeTimestamp {
+			definition += " DEFAULT " + currentTimestamp
+		}
+		definitions[i] = definition
+	}
+
+	return strings.Join(definitions, ",\n")
+}
+
+// maxOffsetExpression computes offsets of inserted rows for databases without monotonic auto-increment.
+//
+// Concurrent inserts compute the same offsets and conflict on the primary key, so one of them fails
+// and must be retried. The offset N+1 can be computed only after the message with the offset N was committed,
+// so messages are never committed out of order.
+func maxOffsetExpression(dialect Dialect, table string, offsetColumn string, rowIndex int) string {
+	return "(SELECT COALESCE(MAX(" + dialect.QuoteIdentifier(offsetColumn) + "), 0) + " +
+		strconv.Itoa(rowIndex+1) + " FROM " + table + ")"
+}
@@ -0,0 +1,108 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// MySQLDialect is a Dialect for MySQL (or MariaDB). It's used by DefaultMySQLSchema and DefaultMySQLOffsetsAdapter.
+type MySQLDialect struct {
+	// IdentifierQuoting overrides how the names of tables and columns are quoted.
+	IdentifierQuoting QuoteIdentifierFunc
+}
+
+func (d MySQLDialect) QuoteIdentifier(name string) string {
+	if d.IdentifierQuoting != nil {
+		return d.IdentifierQuoting(name)
+	}
+	return QuoteWithBackticks(name)
+}
+
+func (d MySQLDialect) Placeholder(index int) string {
+	return "?"
+}
+
+func (d MySQLDialect) CreateTableQuery(table string, columns []DialectColumn, primaryKey []string) string {
+	definitions := columnDefinitions(d, columns, d.columnType, "CURRENT_TIMESTAMP")
+
+	// The offset column is already declared as the primary key.
+	for _, column := range columns {
+		if column.Type == DialectColumnTypeOffset {
+			return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n%s\n)", table, definitions)
+		}
+	}
+
+	return fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (\n%s,\nPRIMARY KEY (%s)\n)",
+		table,
+		definitions,
+		strings.Join(quoteIdentifiers(d, primaryKey), ", "),
+	)
+}
+
+func (d MySQLDialect) columnType(columnType DialectColumnType) string {
+	switch columnType {
+	case DialectColumnTypeOffset:
+		return "BIGINT AUTO_INCREMENT PRIMARY KEY"
+	case DialectColumnTypeInt64:
+		return "BIGINT"
+	case DialectColumnTypeString:
+		return "VARCHAR(255)"
+	case DialectColumnTypeBytes:
+		return "LONGBLOB"
+	case DialectColumnTypeTimestamp:
+		return "TIMESTAMP"
+	default:
+		return "LONGTEXT"
+	}
+}
+
+func (d MySQLDialect) InsertedOffsetExpression(table string, offsetColumn string, rowIndex int) string {
+	return ""
+}
+
+func (d MySQLDialect) InsertIfNotExistsQuery(table string, columns []string, values []string) string {
+	// INSERT IGNORE would ignore other errors too, like values not fitting the columns.
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s = %s",
+		table,
+		strings.Join(quoteIdentifiers(d, columns), ", "),
+		strings.Join(values, ", "),
+		d.QuoteIdentifier(columns[0]),
+		d.QuoteIdentifier(columns[0]),
+	)
+}
+
+func (d MySQLDialect) UpsertQuery(table string, columns []string, values []string, keyColumns []string, updatedColumns []string) string {
+	updates := make([]string, len(updatedColumns))
+	for i, column := range updatedColumns {
+		updates[i] = d.QuoteIdentifier(column) + " = VALUES(" + d.QuoteIdentifier(column) + ")"
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s",
+		table,
+		strings.Join(quoteIdentifiers(d, columns), ", "),
+		strings.Join(values, ", "),
+		strings.Join(updates, ", "),
+	)
+}
+
+func (d MySQLDialect) SelectForUpdateQuery(table string, columns []string, where string) string {
+	return fmt.Sprintf(
+		"SELECT %s FROM %s WHERE %s FOR UPDATE",
+		strings.Join(quoteIdentifiers(d, columns), ", "),
+		table,
+		where,
+	)
+}
+
+func (d MySQLDialect) LimitClause(limit int) string {
+	return fmt.Sprintf("LIMIT %d", limit)
+}
+
+func (d MySQLDialect) SubscribeIsolationLevel() sql.IsolationLevel {
+	// MySQL requires serializable isolation level for not losing messages.
+	return sql.LevelSerializable
+}
@@ -0,0 +1,104 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SpannerDialect is a Dialect for Google Cloud Spanner (GoogleSQL).
+//
+// Spanner has no monotonic auto-increment, so offsets are computed from the highest offset in the table.
+// Concurrent publishes conflict with each other and are aborted and retried by the Spanner driver.
+//
+// Monotonic offsets used as the primary key create a write hotspot, so it's not a good fit for topics
+// with very high write throughput.
+type SpannerDialect struct {
+	// IdentifierQuoting overrides how the names of tables and columns are quoted.
+	IdentifierQuoting QuoteIdentifierFunc
+}
+
+func (d SpannerDialect) QuoteIdentifier(name string) string {
+	if d.IdentifierQuoting != nil {
+		return d.IdentifierQuoting(name)
+	}
+	return "`" + spannerIdentifierEscaper.Replace(name) + "`"
+}
+
+// spannerIdentifierEscaper escapes backslashes and backticks of quoted identifiers, which use the escape sequences
+// of string literals in GoogleSQL, so backticks can't be escaped by doubling them like in MySQL.
+var spannerIdentifierEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+
+func (d SpannerDialect) Placeholder(index int) string {
+	return fmt.Sprintf("@p%d", index)
+}
+
+func (d SpannerDialect) CreateTableQuery(table string, columns []DialectColumn, primaryKey []string) string {
+	return fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (\n%s\n) PRIMARY KEY (%s)",
+		table,
+		columnDefinitions(d, columns, d.columnType, "(CURRENT_TIMESTAMP())"),
+		strings.Join(quoteIdentifiers(d, primaryKey), ", "),
+	)
+}
+
+func (d SpannerDialect) columnType(columnType DialectColumnType) string {
+	switch columnType {
+	case DialectColumnTypeOffset, DialectColumnTypeInt64:
+		return "INT64"
+	case DialectColumnTypeString:
+		return "STRING(255)"
+	case DialectColumnTypeBytes:
+		return "BYTES(MAX)"
+	case DialectColumnTypeTimestamp:
+		return "TIMESTAMP"
+	default:
+		return "STRING(MAX)"
+	}
+}
+
+func (d SpannerDialect) InsertedOffsetExpression(table string, offsetColumn string, rowIndex int) string {
+	return maxOffsetExpression(d, table, offsetColumn, rowIndex)
+}
+
+func (d SpannerDialect) InsertIfNotExistsQuery(table string, columns []string, values []string) string {
+	return fmt.Sprintf(
+		"INSERT OR IGNORE INTO %s (%s) VALUES (%s)",
+		table,
+		strings.Join(quoteIdentifiers(d, columns), ", "),
+		strings.Join(values, ", "),
+	)
+}
+
+// UpsertQuery uses INSERT OR UPDATE, which updates all inserted columns of existing rows, so only keyColumns
+// and updatedColumns are inserted. The other columns must have default values or be nullable.
+func (d SpannerDialect) UpsertQuery(table string, columns []string, values []string, keyColumns []string, updatedColumns []string) string {
+	var insertedColumns, insertedValues []string
+	for i, column := range columns {
+		if containsString(keyColumns, column) || containsString(updatedColumns, column) {
+			insertedColumns = append(insertedColumns, column)
+			insertedValues = append(insertedValues, values[i])
+		}
+	}
+
+	return fmt.Sprintf(
+		"INSERT OR UPDATE INTO %s (%s) VALUES (%s)",
+		table,
+		strings.Join(quoteIdentifiers(d, insertedColumns), ", "),
+		strings.Join(insertedValues, ", "),
+	)
+}
+
+func (d SpannerDialect) SelectForUpdateQuery(table string, columns []string, where string) string {
+	// Read-write transactions of Spanner lock all read rows.
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(quoteIdentifiers(d, columns), ", "), table, where)
+}
+
+func (d SpannerDialect) LimitClause(limit int) string {
+	return fmt.Sprintf("LIMIT %d", limit)
+}
+
+func (d SpannerDialect) SubscribeIsolationLevel() sql.IsolationLevel {
+	// Spanner supports only serializable read-write transactions.
+	return sql.LevelSerializable
+}
@@ -0,0 +1,85 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SQLiteDialect is a Dialect for SQLite.
+type SQLiteDialect struct {
+	// IdentifierQuoting overrides how the names of tables and columns are quoted.
+	IdentifierQuoting QuoteIdentifierFunc
+}
+
+func (d SQLiteDialect) QuoteIdentifier(name string) string {
+	if d.IdentifierQuoting != nil {
+		return d.IdentifierQuoting(name)
+	}
+	return QuoteWithDoubleQuotes(name)
+}
+
+func (d SQLiteDialect) Placeholder(index int) string {
+	return "?"
+}
+
+func (d SQLiteDialect) CreateTableQuery(table string, columns []DialectColumn, primaryKey []string) string {
+	definitions := columnDefinitions(d, columns, d.columnType, "CURRENT_TIMESTAMP")
+
+	// The offset column is already declared as the primary key.
+	for _, column := range columns {
+		if column.Type == DialectColumnTypeOffset {
+			return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n%s\n)", table, definitions)
+		}
+	}
+
+	return fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (\n%s,\nPRIMARY KEY (%s)\n)",
+		table,
+		definitions,
+		strings.Join(quoteIdentifiers(d, primaryKey), ", "),
+	)
+}
+
+func (d SQLiteDialect) columnType(columnType DialectColumnType) string {
+	switch columnType {
+	case DialectColumnTypeOffset:
+		return "INTEGER PRIMARY KEY AUTOINCREMENT"
+	case DialectColumnTypeInt64:
+		return "INTEGER"
+	case DialectColumnTypeBytes:
+		return "BLOB"
+	default:
+		return "TEXT"
+	}
+}
+
+func (d SQLiteDialect) InsertedOffsetExpression(table string, offsetColumn string, rowIndex int) string {
+	return ""
+}
+
+func (d SQLiteDialect) InsertIfNotExistsQuery(table string, columns []string, values []string) string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
+		table,
+		strings.Join(quoteIdentifiers(d, columns), ", "),
+		strings.Join(values, ", "),
+	)
+}
+
+func (d SQLiteDialect) UpsertQuery(table string, columns []string, values []string, keyColumns []string, updatedColumns []string) string {
+	return onConflictUpsertQuery(d, table, columns, values, keyColumns, updatedColumns)
+}
+
+func (d SQLiteDialect) SelectForUpdateQuery(table string, columns []string, where string) string {
+	// SQLite takes the write lock of the whole database on the first write in the transaction.
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(quoteIdentifiers(d, columns), ", "), table, where)
+}
+
+func (d SQLiteDialect) LimitClause(limit int) string {
+	return fmt.Sprintf("LIMIT %d", limit)
+}
+
+func (d SQLiteDialect) SubscribeIsolationLevel() sql.IsolationLevel {
+	return sql.LevelDefault
+}
@@ -0,0 +1,160 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialectSchema_InsertQuery(t *testing.T) {
+	msgs := message.Messages{
+		message.NewMessage("1", nil),
+		message.NewMessage("2", nil),
+	}
+
+	testCases := []struct {
+		Name             string
+		Dialect          Dialect
+		CausalityColumns bool
+		ColumnNames      ColumnNames
+		ExpectedQuery    string
+		ExpectedArgs     int
+	}{
+		{
+			Name:          "auto_increment",
+			Dialect:       SQLiteDialect{},
+			ExpectedQuery: `INSERT INTO "watermill_topic" ("uuid", "payload", "metadata") VALUES (?,?,?),(?,?,?)`,
+			ExpectedArgs:  6,
+		},
+		{
+			Name:    "computed_offset",
+			Dialect: YugabyteDBDialect{},
+			ExpectedQuery: `INSERT INTO "watermill_topic" ("offset", "uuid", "payload", "metadata") VALUES ` +
+				`((SELECT COALESCE(MAX("offset"), 0) + 1 FROM "watermill_topic"),$1,$2,$3),` +
+				`((SELECT COALESCE(MAX("offset"), 0) + 2 FROM "watermill_topic"),$4,$5,$6)`,
+			ExpectedArgs: 6,
+		},
+		{
+			Name:             "causality_columns",
+			Dialect:          YugabyteDBDialect{},
+			CausalityColumns: true,
+			ExpectedQuery: `INSERT INTO "watermill_topic" ("offset", "uuid", "payload", "metadata", "correlation_id", "causation_id") VALUES ` +
+				`((SELECT COALESCE(MAX("offset"), 0) + 1 FROM "watermill_topic"),$1,$2,$3,$4,$5),` +
+				`((SELECT COALESCE(MAX("offset"), 0) + 2 FROM "watermill_topic"),$6,$7,$8,$9,$10)`,
+			ExpectedArgs: 10,
+		},
+		{
+			Name:        "column_names",
+			Dialect:     YugabyteDBDialect{IdentifierQuoting: QuoteWithBackticks},
+			ColumnNames: ColumnNames{Offset: "id", UUID: "message_id", Metadata: "headers"},
+			ExpectedQuery: "INSERT INTO `watermill_topic` (`id`, `message_id`, `payload`, `headers`) VALUES " +
+				"((SELECT COALESCE(MAX(`id`), 0) + 1 FROM `watermill_topic`),$1,$2,$3)," +
+				"((SELECT COALESCE(MAX(`id`), 0) + 2 FROM `watermill_topic`),$4,$5,$6)",
+			ExpectedArgs: 6,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			schema := DialectSchema{Dialect: tc.Dialect, CausalityColumns: tc.CausalityColumns, ColumnNames: tc.ColumnNames}
+			query, err := schema.InsertQuery("topic", msgs)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.ExpectedQuery, query.Query)
+			assert.Len(t, query.Args, tc.ExpectedArgs)
+		})
+	}
+}
+
+func TestQuoteIdentifierFuncs(t *testing.T) {
+	assert.Equal(t, `"my""table"`, QuoteWithDoubleQuotes(`my"table`))
+	assert.Equal(t, "`my``table`", QuoteWithBackticks("my`table"))
+	assert.Equal(t, "[my]]table]", QuoteWithBrackets("my]table"))
+	assert.Equal(t, "my_table", NoQuoting("my_table"))
+}
+
+func TestSpannerDialect_CreateTableQuery(t *testing.T) {
+	query := DialectOffsetsAdapter{Dialect: SpannerDialect{}}.SchemaInitializingQueries("topic")
+
+	require.Len(t, query, 1)
+	assert.Equal(
+		t,
+		"CREATE TABLE IF NOT EXISTS `watermill_offsets_topic` (\n"+
+			"`consumer_group` STRING(255) NOT NULL,\n"+
+			"`offset_acked` INT64 NOT NULL,\n"+
+			"`offset_consumed` INT64 NOT NULL\n"+
+			") PRIMARY KEY (`consumer_group`)",
+		query[0].Query,
+	)
+}
+
+func TestSpannerDialect_QuoteIdentifier(t *testing.T) {
+	assert.Equal(t, "`my_table`", SpannerDialect{}.QuoteIdentifier("my_table"))
+	assert.Equal(t, "`my\\`table`", SpannerDialect{}.QuoteIdentifier("my`table"))
+	assert.Equal(t, "`my\\\\`", SpannerDialect{}.QuoteIdentifier(`my\`))
+}
+
+func TestDialect_UpsertQuery(t *testing.T) {
+	columns := []string{"offset_consumed", "offset_acked", "consumer_group"}
+	keyColumns := []string{"consumer_group"}
+	updatedColumns := []string{"offset_consumed"}
+
+	testCases := []struct {
+		Name          string
+		Dialect       Dialect
+		ExpectedQuery string
+	}{
+		{
+			Name:    "sqlite",
+			Dialect: SQLiteDialect{},
+			ExpectedQuery: `INSERT INTO t ("offset_consumed", "offset_acked", "consumer_group") VALUES (?, 0, ?) ` +
+				`ON CONFLICT ("consumer_group") DO UPDATE SET "offset_consumed" = excluded."offset_consumed"`,
+		},
+		{
+			Name:    "mysql",
+			Dialect: MySQLDialect{},
+			ExpectedQuery: "INSERT INTO t (`offset_consumed`, `offset_acked`, `consumer_group`) VALUES (?, 0, ?) " +
+				"ON DUPLICATE KEY UPDATE `offset_consumed` = VALUES(`offset_consumed`)",
+		},
+		{
+			Name:          "spanner",
+			Dialect:       SpannerDialect{},
+			ExpectedQuery: "INSERT OR UPDATE INTO t (`offset_consumed`, `consumer_group`) VALUES (?, ?)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			query := tc.Dialect.UpsertQuery("t", columns, []string{"?", "0", "?"}, keyColumns, updatedColumns)
+			assert.Equal(t, tc.ExpectedQuery, query)
+		})
+	}
+}
+
+func TestDefaultMySQLOffsetsAdapter_queries(t *testing.T) {
+	adapter := DefaultMySQLOffsetsAdapter{}
+
+	assert.Equal(
+		t,
+		"CREATE TABLE IF NOT EXISTS `watermill_offsets_topic` (\n"+
+			"`consumer_group` VARCHAR(255) NOT NULL,\n"+
+			"`offset_acked` BIGINT,\n"+
+			"`offset_consumed` BIGINT NOT NULL,\n"+
+			"PRIMARY KEY (`consumer_group`)\n"+
+			")",
+		adapter.SchemaInitializingQueries("topic")[0].Query,
+	)
+	assert.Equal(
+		t,
+		"SELECT COALESCE((SELECT `offset_acked` FROM `watermill_offsets_topic` WHERE `consumer_group` = ? FOR UPDATE), 0)",
+		adapter.NextOffsetQuery("topic", "group").Query,
+	)
+	assert.Equal(
+		t,
+		"INSERT INTO `watermill_offsets_topic` (`offset_consumed`, `offset_acked`, `consumer_group`) VALUES (?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE `offset_consumed` = VALUES(`offset_consumed`), `offset_acked` = VALUES(`offset_acked`)",
+		adapter.AckMessageQuery("topic", Row{Offset: 1}, "group").Query,
+	)
+}
@@ -0,0 +1,90 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// YugabyteDBDialect is a Dialect for YugabyteDB (YSQL).
+//
+// YugabyteDB caches sequence values on each node, so SERIAL columns are not monotonic across connections.
+// Offsets are computed from the highest offset in the table instead, and concurrent publishes
+// conflict on the primary key and have to be retried.
+//
+// This dialect doesn't rely on pg_snapshot_xmin like DefaultPostgreSQLSchema, which YugabyteDB doesn't support.
+type YugabyteDBDialect struct {
+	// IdentifierQuoting overrides how the names of tables and columns are quoted.
+	IdentifierQuoting QuoteIdentifierFunc
+}
+
+func (d YugabyteDBDialect) QuoteIdentifier(name string) string {
+	if d.IdentifierQuoting != nil {
+		return d.IdentifierQuoting(name)
+	}
+	return QuoteWithDoubleQuotes(name)
+}
+
+func (d YugabyteDBDialect) Placeholder(index int) string {
+	return fmt.Sprintf("$%d", index)
+}
+
+func (d YugabyteDBDialect) CreateTableQuery(table string, columns []DialectColumn, primaryKey []string) string {
+	return fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (\n%s,\nPRIMARY KEY (%s)\n)",
+		table,
+		columnDefinitions(d, columns, d.columnType, "CURRENT_TIMESTAMP"),
+		strings.Join(quoteIdentifiers(d, primaryKey), ", "),
+	)
+}
+
+func (d YugabyteDBDialect) columnType(columnType DialectColumnType) string {
+	switch columnType {
+	case DialectColumnTypeOffset, DialectColumnTypeInt64:
+		return "BIGINT"
+	case DialectColumnTypeString:
+		return "VARCHAR(255)"
+	case DialectColumnTypeBytes:
+		return "BYTEA"
+	case DialectColumnTypeTimestamp:
+		return "TIMESTAMP"
+	default:
+		return "TEXT"
+	}
+}
+
+func (d YugabyteDBDialect) InsertedOffsetExpression(table string, offsetColumn string, rowIndex int) string {
+	return maxOffsetExpression(d, table, offsetColumn, rowIndex)
+}
+
+func (d YugabyteDBDialect) InsertIfNotExistsQuery(table string, columns []string, values []string) string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
+		table,
+		strings.Join(quoteIdentifiers(d, columns), ", "),
+		strings.Join(values, ", "),
+	)
+}
+
+func (d YugabyteDBDialect) UpsertQuery(table string, columns []string, values []string, keyColumns []string, updatedColumns []string) string {
+	return onConflictUpsertQuery(d, table, columns, values, keyColumns, updatedColumns)
+}
+
+func (d YugabyteDBDialect) SelectForUpdateQuery(table string, columns []string, where string) string {
+	return fmt.Sprintf(
+		"SELECT %s FROM %s WHERE %s FOR UPDATE",
+		strings.Join(quoteIdentifiers(d, columns), ", "),
+		table,
+		where,
+	)
+}
+
+func (d YugabyteDBDialect) LimitClause(limit int) string {
+	return fmt.Sprintf("LIMIT %d", limit)
+}
+
+func (d YugabyteDBDialect) SubscribeIsolationLevel() sql.IsolationLevel {
+	// Serializable transactions of YugabyteDB take read locks, so reading messages conflicts
+	// with inserts which are not committed yet.
+	return sql.LevelSerializable
+}
@@ -0,0 +1,476 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DoctorCheck is the kind of the check of SQLiteDoctor which found a problem.
+type DoctorCheck string
+
+const (
+	// DoctorCheckPragmas checks the settings of the connection, like journal mode and busy timeout.
+	DoctorCheckPragmas DoctorCheck = "pragmas"
+
+	// DoctorCheckSchema checks that the tables of the topics match the schema and offsets adapters (see VerifySchema).
+	DoctorCheckSchema DoctorCheck = "schema"
+
+	// DoctorCheckIndexes checks that the indexes enabled in the schema adapter exist.
+	DoctorCheckIndexes DoctorCheck = "indexes"
+
+	// DoctorCheckLockContention checks for symptoms of connections holding locks for long,
+	// like checkpoints blocked by readers, and processes writing without busy timeout (see SQLiteSettingsGuard).
+	DoctorCheckLockContention DoctorCheck = "lock_contention"
+
+	// DoctorCheckWALSize checks that the write-ahead log doesn't grow over SQLiteDoctor.MaxWALSize.
+	DoctorCheckWALSize DoctorCheck = "wal_size"
+
+	// DoctorCheckOffsets checks that the acked offsets of consumer groups are consistent with the messages.
+	DoctorCheckOffsets DoctorCheck = "offsets"
+)
+
+// DoctorSeverity is the severity of the problem found by SQLiteDoctor.
+type DoctorSeverity string
+
+const (
+	// DoctorWarning is a problem which degrades the deployment, like lock contention or durability,
+	// but doesn't prevent publishing and consuming messages.
+	DoctorWarning DoctorSeverity = "warning"
+
+	// DoctorError is a problem which makes publishing or consuming fail, or makes subscribers skip messages.
+	DoctorError DoctorSeverity = "error"
+)
+
+// DoctorFinding is a problem found by SQLiteDoctor, with the advice how to fix it.
+type DoctorFinding struct {
+	Check    DoctorCheck
+	Severity DoctorSeverity
+
+	// Topic is the topic with the problem. It's empty for problems of the whole database.
+	Topic string
+
+	Problem string
+	Advice  string
+}
+
+func (f DoctorFinding) String() string {
+	s := fmt.Sprintf("[%s] %s", f.Severity, f.Check)
+	if f.Topic != "" {
+		s += " (topic " + f.Topic + ")"
+	}
+	return s + ": " + f.Problem + ". " + f.Advice
+}
+
+// DoctorReport is the report of SQLiteDoctor.
+type DoctorReport struct {
+	// Topics are the checked topics.
+	Topics []string
+
+	Findings []DoctorFinding
+}
+
+// Healthy returns true if no errors were found. Warnings are allowed.
+func (r DoctorReport) Healthy() bool {
+	for _, finding := range r.Findings {
+		if finding.Severity == DoctorError {
+			return false
+		}
+	}
+	return true
+}
+
+func (r DoctorReport) String() string {
+	if len(r.Findings) == 0 {
+		return fmt.Sprintf("No problems found (%d topics checked).", len(r.Topics))
+	}
+
+	lines := make([]string, len(r.Findings))
+	for i, finding := range r.Findings {
+		lines[i] = finding.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Doctor checks the SQLite database of topics stored with the default schema and offsets adapters.
+// See SQLiteDoctor.
+func Doctor(ctx context.Context, db QueryExecutor) (DoctorReport, error) {
+	return SQLiteDoctor{DB: db}.Check(ctx)
+}
+
+// SQLiteDoctor checks SQLite deployments for misconfigurations: the settings of the connection,
+// the schema and indexes of the topics, symptoms of lock contention, the size of the write-ahead log,
+// and the consistency of acked offsets. Problems are returned in DoctorReport with the advice how to fix them,
+// so it can be run when the deployment fails or slows down, for example, with the doctor command of cmd/watermill-sql.
+//
+// The settings are checked for the connection of DB, so DB should be opened with the same settings
+// (like the pragmas of the data source name) as the publishers and subscribers.
+// A passive checkpoint of the write-ahead log is executed to detect blocked checkpoints. Nothing else is written.
+type SQLiteDoctor struct {
+	// DB is the database storing the topics. It's required.
+	DB QueryExecutor
+
+	SchemaAdapter  DefaultSQLiteSchema
+	OffsetsAdapter DefaultSQLiteOffsetsAdapter
+
+	// Topics are the checked topics.
+	//
+	// By default, topics are listed with SQLiteTopicAdmin.Topics. Listed tables without the "offset" and "uuid" columns
+	// (like the tables of stores of this package) are not considered topics.
+	Topics []string
+
+	// MaxWALSize is the size of the write-ahead log in bytes, above which DoctorCheckWALSize is reported.
+	//
+	// Default value is 64 MiB.
+	MaxWALSize int64
+
+	// ProcessesTableName may be set to the table name of SQLiteSettingsGuard, if it's overridden.
+	// The settings of the processes registered by the guard are checked, if the table exists.
+	ProcessesTableName string
+}
+
+// Check runs the checks. It returns an error only if the database couldn't be inspected.
+func (d SQLiteDoctor) Check(ctx context.Context) (DoctorReport, error) {
+	if d.DB == nil {
+		return DoctorReport{}, errors.New("db is nil")
+	}
+
+	topics, err := d.topics(ctx)
+	if err != nil {
+		return DoctorReport{}, err
+	}
+	report := DoctorReport{Topics: topics}
+
+	checks := []func(ctx context.Context) ([]DoctorFinding, error){
+		d.checkPragmas,
+		d.checkWAL,
+		d.checkProcesses,
+	}
+	for _, check := range checks {
+		findings, err := check(ctx)
+		if err != nil {
+			return DoctorReport{}, err
+		}
+		report.Findings = append(report.Findings, findings...)
+	}
+
+	for _, topic := range topics {
+		for _, check := range []func(ctx context.Context, topic string) ([]DoctorFinding, error){
+			d.checkSchema,
+			d.checkOffsets,
+		} {
+			findings, err := check(ctx, topic)
+			if err != nil {
+				return DoctorReport{}, errors.Wrapf(err, "could not check topic %s", topic)
+			}
+			report.Findings = append(report.Findings, findings...)
+		}
+	}
+
+	return report, nil
+}
+
+func (d SQLiteDoctor) topics(ctx context.Context) ([]string, error) {
+	if d.Topics != nil {
+		return d.Topics, nil
+	}
+
+	return d.admin().messagesTopics(ctx)
+}
+
+func (d SQLiteDoctor) checkPragmas(ctx context.Context) ([]DoctorFinding, error) {
+	settings, err := ReadSQLiteSettings(ctx, d.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []DoctorFinding
+	warn := func(problem string, advice string) {
+		findings = append(findings, DoctorFinding{Check: DoctorCheckPragmas, Severity: DoctorWarning, Problem: problem, Advice: advice})
+	}
+
+	if settings.JournalMode != "wal" {
+		warn(
+			fmt.Sprintf("journal mode is %s, so readers and the writer block each other", settings.JournalMode),
+			"Open the database with _pragma=journal_mode(WAL) in all processes.",
+		)
+	}
+	if settings.BusyTimeout == 0 {
+		warn(
+			"busy timeout is 0, so concurrent writes fail immediately with SQLITE_BUSY",
+			"Open the database with _pragma=busy_timeout(5000) (or longer), or write with SingleWriter.",
+		)
+	}
+	if settings.LockingMode == "exclusive" {
+		warn(
+			"locking mode is exclusive, so other processes can't access the database",
+			"Use the normal locking mode, unless the database is used by only one connection.",
+		)
+	}
+
+	synchronous, err := d.readIntPragma(ctx, "synchronous")
+	if err != nil {
+		return nil, err
+	}
+	if synchronous == 0 {
+		warn(
+			"synchronous is OFF, so published messages and acked offsets may be lost or corrupted when the machine crashes",
+			"Open the database with _pragma=synchronous(NORMAL) (with WAL) or FULL.",
+		)
+	}
+
+	if settings.JournalMode == "wal" {
+		autoCheckpoint, err := d.readIntPragma(ctx, "wal_autocheckpoint")
+		if err != nil {
+			return nil, err
+		}
+		if autoCheckpoint <= 0 {
+			warn(
+				"automatic checkpoints are disabled, so the write-ahead log grows until it's checkpointed manually",
+				"Don't set wal_autocheckpoint to 0, or run PRAGMA wal_checkpoint periodically.",
+			)
+		}
+	}
+
+	return findings, nil
+}
+
+func (d SQLiteDoctor) readIntPragma(ctx context.Context, pragma string) (int64, error) {
+	value, err := readSQLitePragma(ctx, d.DB, pragma)
+	if err != nil {
+		return 0, err
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s %s", pragma, value)
+	}
+
+	return parsed, nil
+}
+
+func (d SQLiteDoctor) checkWAL(ctx context.Context) ([]DoctorFinding, error) {
+	journalMode, err := readSQLitePragma(ctx, d.DB, "journal_mode")
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(journalMode, "wal") {
+		return nil, nil
+	}
+
+	pageSize, err := d.readIntPragma(ctx, "page_size")
+	if err != nil {
+		return nil, err
+	}
+
+	var busy, frames, checkpointed int64
+	found, err := d.admin().queryRow(ctx, []any{&busy, &frames, &checkpointed}, `PRAGMA wal_checkpoint(PASSIVE)`)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not checkpoint write-ahead log")
+	}
+	if !found {
+		return nil, errors.New("checkpoint of write-ahead log returned no result")
+	}
+
+	var findings []DoctorFinding
+	if busy != 0 {
+		findings = append(findings, DoctorFinding{
+			Check:    DoctorCheckLockContention,
+			Severity: DoctorWarning,
+			Problem:  "the write-ahead log couldn't be checkpointed, as another connection holds a lock",
+			Advice:   "Check for long-running transactions, like subscribers' handlers consuming in a transaction for long.",
+		})
+	} else if checkpointed >= 0 && checkpointed < frames {
+		findings = append(findings, DoctorFinding{
+			Check:    DoctorCheckLockContention,
+			Severity: DoctorWarning,
+			Problem: fmt.Sprintf(
+				"%d of %d frames of the write-ahead log couldn't be checkpointed, as readers use older snapshots of the database",
+				frames-checkpointed, frames,
+			),
+			Advice: "Check for long-running transactions and unclosed rows, which block checkpoints while they are open.",
+		})
+	}
+
+	walSize := frames * pageSize
+	if walSize > d.maxWALSize() {
+		findings = append(findings, DoctorFinding{
+			Check:    DoctorCheckWALSize,
+			Severity: DoctorWarning,
+			Problem:  fmt.Sprintf("the write-ahead log has %d bytes, more than %d bytes", walSize, d.maxWALSize()),
+			Advice: "Reads slow down with the size of the log. Finish long-running transactions, " +
+				"then run PRAGMA wal_checkpoint(TRUNCATE), or set journal_size_limit.",
+		})
+	}
+
+	return findings, nil
+}
+
+func (d SQLiteDoctor) checkProcesses(ctx context.Context) ([]DoctorFinding, error) {
+	guard := SQLiteSettingsGuard{DB: d.DB, TableName: d.ProcessesTableName}
+	exists, err := d.admin().tableExists(ctx, unquotedTableName(guard.table()))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	processes, err := guard.otherProcesses(ctx, "", time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []DoctorFinding
+	journalModes := map[string]struct{}{}
+	for _, process := range processes {
+		journalModes[process.Settings.JournalMode] = struct{}{}
+
+		if process.Settings.BusyTimeout == 0 {
+			findings = append(findings, DoctorFinding{
+				Check:    DoctorCheckLockContention,
+				Severity: DoctorWarning,
+				Problem:  fmt.Sprintf("process %s has no busy timeout, so its writes fail while other processes write", process.ID),
+				Advice:   "Open the database with a busy timeout in all processes.",
+			})
+		}
+		if process.Settings.LockingMode == "exclusive" {
+			findings = append(findings, DoctorFinding{
+				Check:    DoctorCheckLockContention,
+				Severity: DoctorError,
+				Problem:  fmt.Sprintf("process %s uses exclusive locking mode, so other processes can't access the database", process.ID),
+				Advice:   "Use the normal locking mode in all processes.",
+			})
+		}
+	}
+	if len(journalModes) > 1 {
+		findings = append(findings, DoctorFinding{
+			Check:    DoctorCheckLockContention,
+			Severity: DoctorError,
+			Problem:  "running processes use different journal modes",
+			Advice:   "Open the database with the same journal mode (preferably WAL) in all processes.",
+		})
+	}
+
+	return findings, nil
+}
+
+func (d SQLiteDoctor) checkSchema(ctx context.Context, topic string) ([]DoctorFinding, error) {
+	// Offsets tables are created when the topic is subscribed for the first time.
+	var offsetsAdapter OffsetsAdapter
+	offsetsExist, err := d.offsetsTableExists(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	if offsetsExist {
+		offsetsAdapter = d.OffsetsAdapter
+	}
+
+	err = VerifySchema(ctx, d.DB, SQLiteSchemaIntrospector{}, d.SchemaAdapter, offsetsAdapter, topic)
+	var mismatch *SchemaMismatchError
+	if !errors.As(err, &mismatch) {
+		return nil, err
+	}
+
+	var findings []DoctorFinding
+	for _, difference := range mismatch.Differences {
+		if strings.HasPrefix(difference, "index ") {
+			findings = append(findings, DoctorFinding{
+				Check:    DoctorCheckIndexes,
+				Severity: DoctorWarning,
+				Topic:    topic,
+				Problem:  difference,
+				Advice:   "Run the schema initializing queries of the schema adapter (like with InitializeSchema), which create missing indexes.",
+			})
+			continue
+		}
+
+		findings = append(findings, DoctorFinding{
+			Check:    DoctorCheckSchema,
+			Severity: DoctorError,
+			Topic:    topic,
+			Problem:  difference,
+			Advice:   "Check that the schema adapter matches the one which created the table, or migrate the topic to a new table with MigrateTopic.",
+		})
+	}
+
+	return findings, nil
+}
+
+func (d SQLiteDoctor) checkOffsets(ctx context.Context, topic string) ([]DoctorFinding, error) {
+	var findings []DoctorFinding
+
+	lastOffset, sequenceFound, err := d.admin().lastOffset(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	if !sequenceFound && lastOffset > 0 {
+		findings = append(findings, DoctorFinding{
+			Check:    DoctorCheckOffsets,
+			Severity: DoctorWarning,
+			Topic:    topic,
+			Problem:  "offsets are not generated with AUTOINCREMENT, so offsets of deleted messages may be reused and skipped by consumer groups",
+			Advice:   "Migrate the topic with MigrateTopic to a table created by DefaultSQLiteSchema.",
+		})
+	}
+
+	inconsistencies, err := d.admin().Verify(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range inconsistencies {
+		finding := DoctorFinding{
+			Check:    DoctorCheckOffsets,
+			Severity: DoctorError,
+			Topic:    topic,
+			Advice:   "Repair the offsets with SQLiteTopicAdmin.Repair.",
+		}
+
+		switch i.Kind {
+		case OffsetAckedBeyondLastMessage:
+			finding.Problem = fmt.Sprintf(
+				"consumer group %s acked offset %d, after the last offset %d, so it skips the messages published until the offsets exceed it",
+				i.ConsumerGroup, i.OffsetAcked, i.LastOffset,
+			)
+			finding.Advice = "The messages table was probably recreated, or restored from an older backup than the offsets. " +
+				"Repair the offsets with SQLiteTopicAdmin.Repair, if the messages of the consumer group should be consumed."
+		case OffsetNegative:
+			finding.Problem = fmt.Sprintf(
+				"consumer group %s has negative offsets (acked %d, consumed %d)",
+				i.ConsumerGroup, i.OffsetAcked, i.OffsetConsumed,
+			)
+		default:
+			finding.Problem = fmt.Sprintf(
+				"consumer group %s has inconsistent offsets (%s: acked %d, consumed %d)",
+				i.ConsumerGroup, i.Kind, i.OffsetAcked, i.OffsetConsumed,
+			)
+		}
+
+		findings = append(findings, finding)
+	}
+
+	return findings, nil
+}
+
+func (d SQLiteDoctor) offsetsTableExists(ctx context.Context, topic string) (bool, error) {
+	return d.admin().tableExists(ctx, unquotedTableName(d.OffsetsAdapter.MessagesOffsetsTable(topic)))
+}
+
+func (d SQLiteDoctor) admin() SQLiteTopicAdmin {
+	return SQLiteTopicAdmin{
+		DB:             d.DB,
+		SchemaAdapter:  d.SchemaAdapter,
+		OffsetsAdapter: d.OffsetsAdapter,
+	}
+}
+
+func (d SQLiteDoctor) maxWALSize() int64 {
+	if d.MaxWALSize > 0 {
+		return d.MaxWALSize
+	}
+	return 64 << 20
+}
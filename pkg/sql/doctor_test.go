@@ -0,0 +1,75 @@
+package sql_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoctor(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "doctor.sqlite")
+	db := openSQLiteFile(t, file, "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, publisher.Publish("orders", message.NewMessage(watermill.NewUUID(), nil)))
+	}
+	require.NoError(t, sql.SQLiteIdempotencyStore{}.InitializeSchema(ctx, db))
+
+	report, err := sql.Doctor(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, report.Topics, "tables of stores are not topics")
+	assert.Empty(t, report.Findings)
+	assert.True(t, report.Healthy())
+
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+	for _, q := range offsetsAdapter.SchemaInitializingQueries("orders") {
+		_, err := db.ExecContext(ctx, q.Query, q.Args...)
+		require.NoError(t, err)
+	}
+	_, err = db.ExecContext(
+		ctx,
+		`INSERT INTO `+offsetsAdapter.MessagesOffsetsTable("orders")+` (consumer_group, offset_acked, offset_consumed) VALUES ('restored', 10, 10), ('workers', 2, 2)`,
+	)
+	require.NoError(t, err)
+
+	report, err = sql.SQLiteDoctor{
+		DB:            db,
+		SchemaAdapter: sql.DefaultSQLiteSchema{Indexes: sql.MessagesIndexes{CreatedAt: true}},
+	}.Check(ctx)
+	require.NoError(t, err)
+	assert.False(t, report.Healthy())
+
+	require.Len(t, report.Findings, 2, report.String())
+	assert.Equal(t, sql.DoctorCheckIndexes, report.Findings[0].Check)
+	assert.Equal(t, sql.DoctorWarning, report.Findings[0].Severity)
+	assert.Equal(t, "orders", report.Findings[0].Topic)
+	assert.Equal(t, sql.DoctorCheckOffsets, report.Findings[1].Check)
+	assert.Equal(t, sql.DoctorError, report.Findings[1].Severity)
+	assert.Contains(t, report.Findings[1].Problem, "consumer group restored acked offset 10, after the last offset 3")
+}
+
+func TestDoctor_pragmas(t *testing.T) {
+	db := openSQLiteFile(t, filepath.Join(t.TempDir(), "doctor.sqlite"), "?_pragma=busy_timeout(0)&_pragma=synchronous(OFF)")
+
+	report, err := sql.Doctor(context.Background(), db)
+	require.NoError(t, err)
+	assert.True(t, report.Healthy(), "misconfigured pragmas are warnings")
+
+	var problems []string
+	for _, finding := range report.Findings {
+		assert.Equal(t, sql.DoctorCheckPragmas, finding.Check)
+		problems = append(problems, finding.Problem)
+	}
+	require.Len(t, problems, 3, report.String())
+	assert.Contains(t, problems[0], "journal mode is delete")
+	assert.Contains(t, problems[1], "busy timeout is 0")
+	assert.Contains(t, problems[2], "synchronous is OFF")
+}
@@ -0,0 +1,467 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// SyncDirection is the direction of the messages exchange with a peer, tracked by a separate high-water mark.
+type SyncDirection string
+
+const (
+	// SyncDirectionPull tracks the last offset of the peer's messages pulled from the peer.
+	SyncDirectionPull SyncDirection = "pull"
+
+	// SyncDirectionPush tracks the last offset of the local messages pushed to the peer.
+	SyncDirectionPush SyncDirection = "push"
+)
+
+// SyncHighWaterMarks stores the last offsets exchanged with every peer, so only new messages are exchanged.
+type SyncHighWaterMarks interface {
+	// HighWaterMark returns the last synced offset, or 0 if the topic was never synced with the peer.
+	HighWaterMark(ctx context.Context, peer string, topic string, direction SyncDirection) (int64, error)
+
+	// SetHighWaterMark stores the last synced offset.
+	SetHighWaterMark(ctx context.Context, peer string, topic string, direction SyncDirection, offset int64) error
+}
+
+type SyncConfig struct {
+	// SchemaAdapter reads and writes the messages of the local database. It's required.
+	// It has the same requirements as ImporterConfig.SourceSchemaAdapter.
+	SchemaAdapter SchemaAdapter
+
+	// Deduplicator skips the exchanged messages which already exist in the local database. It's required.
+	//
+	// Messages pulled from a peer are assigned new local offsets, so they are pushed back to the peer
+	// with the next sync. They are skipped by the peer's deduplicator.
+	Deduplicator ImportDeduplicator
+
+	// HighWaterMarks stores the last offsets exchanged with every peer. It's required.
+	HighWaterMarks SyncHighWaterMarks
+
+	// Client is the HTTP client used for requests to peers.
+	//
+	// Default value is http.DefaultClient.
+	Client *http.Client
+
+	// InsertBatchSize is the maximum number of messages inserted with one query.
+	//
+	// Default value is 100.
+	InsertBatchSize int
+
+	// InitializeSchema enables initialization of the local schema before syncing or serving a topic.
+	InitializeSchema bool
+}
+
+func (c *SyncConfig) setDefaults() {
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+}
+
+func (c SyncConfig) validate() error {
+	if c.SchemaAdapter == nil {
+		return errors.New("schema adapter is nil")
+	}
+	if c.Deduplicator == nil {
+		return errors.New("deduplicator is nil")
+	}
+	if c.HighWaterMarks == nil {
+		return errors.New("high water marks are nil")
+	}
+
+	return nil
+}
+
+// SyncPeer is another instance of Sync, serving its topics over HTTP.
+type SyncPeer struct {
+	// Name identifies the peer's high-water marks. It must be stable and unique among the peers.
+	Name string
+
+	// URL is the URL where the peer's Sync is served.
+	URL string
+}
+
+// SyncResult describes the messages exchanged by SyncTopic.
+type SyncResult struct {
+	// Pulled is the number of the peer's messages inserted to the local database.
+	Pulled int
+
+	// Pushed is the number of local messages inserted to the peer's database.
+	Pushed int
+}
+
+// Sync replicates topics between databases of multiple nodes (for example, SQLite databases
+// of offline-first applications), exchanging new messages when the nodes are connected.
+//
+// Every node serves its topics with Sync as http.Handler, which should be protected by authentication.
+// SyncTopic pulls the messages published by the peer after the last pull, and pushes the messages
+// published locally after the last push. Messages are deduplicated by their UUIDs, so the order
+// of messages may differ between the nodes.
+type Sync struct {
+	db       TxBeginner
+	config   SyncConfig
+	logger   watermill.LoggerAdapter
+	importer *Importer
+}
+
+func NewSync(db TxBeginner, config SyncConfig, logger watermill.LoggerAdapter) (*Sync, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	importer, err := NewImporter(db, db, ImporterConfig{
+		SourceSchemaAdapter:      config.SchemaAdapter,
+		DestinationSchemaAdapter: config.SchemaAdapter,
+		Deduplicator:             config.Deduplicator,
+		InsertBatchSize:          config.InsertBatchSize,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sync{
+		db:       db,
+		config:   config,
+		logger:   logger,
+		importer: importer,
+	}, nil
+}
+
+// SyncTopic exchanges the new messages of the topic with the peer.
+func (s *Sync) SyncTopic(ctx context.Context, peer SyncPeer, topic string) (SyncResult, error) {
+	if err := s.initializeTopic(ctx, topic); err != nil {
+		return SyncResult{}, err
+	}
+
+	pulled, err := s.pull(ctx, peer, topic)
+	if err != nil {
+		return SyncResult{}, errors.Wrapf(err, "could not pull messages from peer %s", peer.Name)
+	}
+
+	pushed, err := s.push(ctx, peer, topic)
+	if err != nil {
+		return SyncResult{Pulled: pulled}, errors.Wrapf(err, "could not push messages to peer %s", peer.Name)
+	}
+
+	return SyncResult{Pulled: pulled, Pushed: pushed}, nil
+}
+
+func (s *Sync) pull(ctx context.Context, peer SyncPeer, topic string) (int, error) {
+	hwm, err := s.config.HighWaterMarks.HighWaterMark(ctx, peer.Name, topic, SyncDirectionPull)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get high water mark")
+	}
+
+	var pulled int
+	for {
+		var batch syncBatch
+		query := url.Values{"topic": {topic}, "after": {strconv.FormatInt(hwm, 10)}}
+		if err := s.request(ctx, http.MethodGet, peer.URL+"?"+query.Encode(), nil, &batch); err != nil {
+			return pulled, err
+		}
+		if len(batch.Messages) == 0 {
+			return pulled, nil
+		}
+		if batch.LastOffset <= hwm {
+			return pulled, errors.Errorf("peer returned offset %d not greater than %d", batch.LastOffset, hwm)
+		}
+
+		imported, err := s.importer.importBatch(ctx, topic, batch.messages())
+		if err != nil {
+			return pulled, err
+		}
+		pulled += imported
+
+		hwm = batch.LastOffset
+		if err := s.config.HighWaterMarks.SetHighWaterMark(ctx, peer.Name, topic, SyncDirectionPull, hwm); err != nil {
+			return pulled, errors.Wrap(err, "could not set high water mark")
+		}
+	}
+}
+
+func (s *Sync) push(ctx context.Context, peer SyncPeer, topic string) (int, error) {
+	hwm, err := s.config.HighWaterMarks.HighWaterMark(ctx, peer.Name, topic, SyncDirectionPush)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get high water mark")
+	}
+
+	var pushed int
+	for {
+		batch, err := s.readBatch(ctx, topic, hwm)
+		if err != nil {
+			return pushed, err
+		}
+		if len(batch.Messages) == 0 {
+			return pushed, nil
+		}
+
+		body, err := json.Marshal(batch)
+		if err != nil {
+			return pushed, errors.Wrap(err, "could not marshal messages")
+		}
+
+		var result syncPushResult
+		query := url.Values{"topic": {topic}}
+		if err := s.request(ctx, http.MethodPost, peer.URL+"?"+query.Encode(), body, &result); err != nil {
+			return pushed, err
+		}
+		pushed += result.Imported
+
+		hwm = batch.LastOffset
+		if err := s.config.HighWaterMarks.SetHighWaterMark(ctx, peer.Name, topic, SyncDirectionPush, hwm); err != nil {
+			return pushed, errors.Wrap(err, "could not set high water mark")
+		}
+	}
+}
+
+func (s *Sync) request(ctx context.Context, method string, url string, body []byte, response any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not create request")
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("peer responded with status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return errors.Wrap(err, "could not decode response")
+	}
+
+	return nil
+}
+
+// ServeHTTP serves the topics of the local database to peers.
+// GET returns the batch of messages after the offset, and POST inserts the pushed messages.
+func (s *Sync) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	topic := r.URL.Query().Get("topic")
+
+	if err := s.initializeTopic(ctx, topic); err != nil {
+		s.respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		after, err := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, errors.Wrap(err, "invalid after offset"))
+			return
+		}
+
+		batch, err := s.readBatch(ctx, topic, after)
+		if err != nil {
+			s.respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.respond(w, batch)
+	case http.MethodPost:
+		var batch syncBatch
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			s.respondError(w, http.StatusBadRequest, errors.Wrap(err, "could not decode messages"))
+			return
+		}
+
+		imported, err := s.importer.importBatch(ctx, topic, batch.messages())
+		if err != nil {
+			s.respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.respond(w, syncPushResult{Imported: imported})
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		s.respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *Sync) respond(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.logger.Error("Could not write sync response", err, nil)
+	}
+}
+
+func (s *Sync) respondError(w http.ResponseWriter, status int, err error) {
+	s.logger.Error("Sync request failed", err, watermill.LogFields{"status": status})
+	http.Error(w, err.Error(), status)
+}
+
+func (s *Sync) initializeTopic(ctx context.Context, topic string) error {
+	if err := validateTopic(s.config.SchemaAdapter, topic); err != nil {
+		return err
+	}
+	if topic == "" {
+		return errors.New("topic is empty")
+	}
+
+	if !s.config.InitializeSchema {
+		return nil
+	}
+
+	return initializeSchema(ctx, topic, s.logger, s.db, s.config.SchemaAdapter, nil)
+}
+
+func (s *Sync) readBatch(ctx context.Context, topic string, after int64) (syncBatch, error) {
+	rows, err := s.importer.readBatch(ctx, topic, after)
+	if err != nil {
+		return syncBatch{}, err
+	}
+
+	batch := syncBatch{
+		Messages:   make([]syncMessage, len(rows)),
+		LastOffset: after,
+	}
+	for i, row := range rows {
+		batch.Messages[i] = syncMessage{
+			UUID:     row.Msg.UUID,
+			Payload:  row.Msg.Payload,
+			Metadata: row.Msg.Metadata,
+		}
+		if row.Offset > batch.LastOffset {
+			batch.LastOffset = row.Offset
+		}
+	}
+
+	return batch, nil
+}
+
+type syncBatch struct {
+	Messages []syncMessage `json:"messages"`
+
+	// LastOffset is the highest offset of the batch in the database of the node which read it.
+	LastOffset int64 `json:"last_offset"`
+}
+
+func (b syncBatch) messages() message.Messages {
+	msgs := make(message.Messages, len(b.Messages))
+	for i, m := range b.Messages {
+		msg := message.NewMessage(m.UUID, m.Payload)
+		if m.Metadata != nil {
+			msg.Metadata = m.Metadata
+		}
+		msgs[i] = msg
+	}
+
+	return msgs
+}
+
+type syncMessage struct {
+	UUID     string           `json:"uuid"`
+	Payload  []byte           `json:"payload"`
+	Metadata message.Metadata `json:"metadata"`
+}
+
+type syncPushResult struct {
+	Imported int `json:"imported"`
+}
+
+// SQLiteSyncHighWaterMarks stores the high-water marks of Sync in a SQLite table.
+type SQLiteSyncHighWaterMarks struct {
+	DB QueryExecutor
+
+	// TableName may be used to override the name of the table. The name should not be quoted.
+	//
+	// Default value is watermill_sync_high_water_marks.
+	TableName string
+}
+
+// InitializeSchema creates the table storing the high-water marks, if it doesn't exist yet.
+func (m SQLiteSyncHighWaterMarks) InitializeSchema(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+m.table()+` (
+		"peer" TEXT NOT NULL,
+		"topic" TEXT NOT NULL,
+		"direction" TEXT NOT NULL,
+		"offset" INTEGER NOT NULL,
+		PRIMARY KEY ("peer", "topic", "direction")
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "could not create sync high water marks table")
+	}
+
+	return nil
+}
+
+func (m SQLiteSyncHighWaterMarks) HighWaterMark(
+	ctx context.Context,
+	peer string,
+	topic string,
+	direction SyncDirection,
+) (int64, error) {
+	rows, err := m.DB.QueryContext(
+		ctx,
+		`SELECT "offset" FROM `+m.table()+` WHERE "peer" = ? AND "topic" = ? AND "direction" = ?`,
+		peer, topic, string(direction),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not query high water mark")
+	}
+	defer rows.Close()
+
+	var offset int64
+	if rows.Next() {
+		if err := rows.Scan(&offset); err != nil {
+			return 0, errors.Wrap(err, "could not scan high water mark")
+		}
+	}
+
+	return offset, rows.Err()
+}
+
+func (m SQLiteSyncHighWaterMarks) SetHighWaterMark(
+	ctx context.Context,
+	peer string,
+	topic string,
+	direction SyncDirection,
+	offset int64,
+) error {
+	_, err := m.DB.ExecContext(
+		ctx,
+		`INSERT INTO `+m.table()+` ("peer", "topic", "direction", "offset") VALUES (?, ?, ?, ?)
+		ON CONFLICT ("peer", "topic", "direction") DO UPDATE SET "offset" = excluded."offset"`,
+		peer, topic, string(direction), offset,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not set high water mark")
+	}
+
+	return nil
+}
+
+func (m SQLiteSyncHighWaterMarks) table() string {
+	if m.TableName != "" {
+		return fmt.Sprintf(`"%s"`, m.TableName)
+	}
+	return `"watermill_sync_high_water_marks"`
+}
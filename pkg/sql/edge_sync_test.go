@@ -0,0 +1,109 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	topic := "topic_" + watermill.NewShortUUID()
+
+	newNode := func(name string) (*stdSQL.DB, *sql.Sync) {
+		db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), name+".sqlite"))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+
+		highWaterMarks := sql.SQLiteSyncHighWaterMarks{DB: sql.BeginnerFromStdSQL(db)}
+		require.NoError(t, highWaterMarks.InitializeSchema(ctx))
+
+		sync, err := sql.NewSync(sql.BeginnerFromStdSQL(db), sql.SyncConfig{
+			SchemaAdapter:    sql.DefaultSQLiteSchema{SubscribeBatchSize: 2},
+			Deduplicator:     sql.UUIDImportDeduplicator{Dialect: sql.SQLiteDialect{}},
+			HighWaterMarks:   highWaterMarks,
+			InitializeSchema: true,
+		}, logger)
+		require.NoError(t, err)
+
+		return db, sync
+	}
+
+	publish := func(db *stdSQL.DB, count int) message.Messages {
+		publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+			SchemaAdapter:        sql.DefaultSQLiteSchema{},
+			AutoInitializeSchema: true,
+		}, logger)
+		require.NoError(t, err)
+
+		var msgs message.Messages
+		for i := 0; i < count; i++ {
+			msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+			msg.Metadata.Set("key", "value")
+			msgs = append(msgs, msg)
+		}
+		require.NoError(t, publisher.Publish(topic, msgs...))
+
+		return msgs
+	}
+
+	uuids := func(db *stdSQL.DB) []string {
+		rows, err := db.Query(`SELECT "uuid" FROM "watermill_` + topic + `" ORDER BY "offset"`)
+		require.NoError(t, err)
+		defer rows.Close()
+
+		var result []string
+		for rows.Next() {
+			var uuid string
+			require.NoError(t, rows.Scan(&uuid))
+			result = append(result, uuid)
+		}
+		require.NoError(t, rows.Err())
+
+		return result
+	}
+
+	localDB, localSync := newNode("local")
+	remoteDB, remoteSync := newNode("remote")
+
+	server := httptest.NewServer(remoteSync)
+	defer server.Close()
+
+	remote := sql.SyncPeer{Name: "remote", URL: server.URL}
+
+	localMessages := publish(localDB, 3)
+	remoteMessages := publish(remoteDB, 2)
+
+	result, err := localSync.SyncTopic(ctx, remote, topic)
+	require.NoError(t, err)
+	assert.Equal(t, sql.SyncResult{Pulled: 2, Pushed: 3}, result)
+
+	var expectedUUIDs []string
+	for _, msg := range append(localMessages, remoteMessages...) {
+		expectedUUIDs = append(expectedUUIDs, msg.UUID)
+	}
+	assert.ElementsMatch(t, expectedUUIDs, uuids(localDB))
+	assert.ElementsMatch(t, expectedUUIDs, uuids(remoteDB))
+
+	// Only messages published after the last sync are exchanged.
+	newRemoteMessages := publish(remoteDB, 1)
+
+	result, err = localSync.SyncTopic(ctx, remote, topic)
+	require.NoError(t, err)
+	assert.Equal(t, sql.SyncResult{Pulled: 1, Pushed: 0}, result)
+
+	assert.Equal(t, newRemoteMessages[0].UUID, uuids(localDB)[len(expectedUUIDs)])
+	assert.Len(t, uuids(remoteDB), len(expectedUUIDs)+1)
+
+	result, err = localSync.SyncTopic(ctx, remote, topic)
+	require.NoError(t, err)
+	assert.Equal(t, sql.SyncResult{}, result)
+}
@@ -0,0 +1,367 @@
+package sql
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// EncryptionKeyIDMetadataKey is the metadata key containing the ID of the key which encrypted the message's payload.
+//
+// The key ID is stored together with the rest of the metadata, so messages encrypted with different keys
+// can be stored in one topic, and decrypted after the current key of the topic is rotated.
+const EncryptionKeyIDMetadataKey = "encryption_key_id"
+
+// EncryptionErasedMetadataKey is set to "true" by Encryptor.Decrypt when the key which encrypted
+// the message's payload was erased (see ErrEncryptionKeyErased).
+const EncryptionErasedMetadataKey = "encryption_erased"
+
+// ErrEncryptionKeyErased should be returned by EncryptionKeys.Key for keys erased with crypto-shredding.
+// Encryptor.Decrypt doesn't fail for messages encrypted with erased keys, but clears their payloads,
+// so erased messages don't block consumer groups.
+var ErrEncryptionKeyErased = errors.New("encryption key was erased")
+
+// EncryptionKeys provides the keys used by Encryptor.
+type EncryptionKeys interface {
+	// CurrentKeyID returns the ID of the key which should be used to encrypt new messages of the topic.
+	CurrentKeyID(topic string) (string, error)
+
+	// Key returns the key with the ID. Keys must be 16, 24 or 32 bytes long, to use AES-128, AES-192 or AES-256.
+	// The keys of rotated IDs must be available for as long as messages encrypted with them are stored.
+	Key(keyID string) ([]byte, error)
+}
+
+// MessageEncryptionKeys is an optional interface of EncryptionKeys, implemented by keys which depend
+// on the message, for example, keys of subjects like users (see SQLiteSubjectEncryptionKeys).
+// When it's implemented, Encryptor uses CurrentMessageKeyID instead of CurrentKeyID.
+type MessageEncryptionKeys interface {
+	EncryptionKeys
+
+	// CurrentMessageKeyID returns the ID of the key which should be used to encrypt the message published to the topic.
+	CurrentMessageKeyID(topic string, msg *message.Message) (string, error)
+}
+
+// StaticEncryptionKeys is an implementation of EncryptionKeys with keys known upfront.
+type StaticEncryptionKeys struct {
+	// Keys are the keys by their IDs.
+	Keys map[string][]byte
+
+	// CurrentKeyIDs are the IDs of the current keys by topics.
+	CurrentKeyIDs map[string]string
+
+	// DefaultKeyID is the ID of the current key of topics missing in CurrentKeyIDs.
+	DefaultKeyID string
+}
+
+func (k StaticEncryptionKeys) CurrentKeyID(topic string) (string, error) {
+	if keyID, ok := k.CurrentKeyIDs[topic]; ok {
+		return keyID, nil
+	}
+	if k.DefaultKeyID == "" {
+		return "", errors.Errorf("no encryption key for topic %s", topic)
+	}
+
+	return k.DefaultKeyID, nil
+}
+
+func (k StaticEncryptionKeys) Key(keyID string) ([]byte, error) {
+	key, ok := k.Keys[keyID]
+	if !ok {
+		return nil, errors.Errorf("encryption key %s not found", keyID)
+	}
+
+	return key, nil
+}
+
+// Encryptor encrypts payloads of published messages with AES-GCM, using the current key of the topic,
+// and decrypts them when they are consumed. Metadata is not encrypted.
+//
+// Encryptor should be set as PublisherConfig.Encryptor, and Decrypt should be added to the subscriber
+// with SubscriberConfig.Transforms. The ID of the key is stored in the metadata of every message
+// (see EncryptionKeyIDMetadataKey), so the keys can be rotated, and historical messages re-encrypted
+// with ReEncryptMessages.
+type Encryptor struct {
+	keys EncryptionKeys
+}
+
+func NewEncryptor(keys EncryptionKeys) (*Encryptor, error) {
+	if keys == nil {
+		return nil, errors.New("keys are nil")
+	}
+
+	return &Encryptor{keys: keys}, nil
+}
+
+// Encrypt returns a copy of the message, with the payload encrypted with the current key of the topic.
+func (e *Encryptor) Encrypt(topic string, msg *message.Message) (*message.Message, error) {
+	keyID, err := e.currentKeyID(topic, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.encryptWithKey(keyID, msg)
+}
+
+func (e *Encryptor) currentKeyID(topic string, msg *message.Message) (string, error) {
+	var keyID string
+	var err error
+	if messageKeys, ok := e.keys.(MessageEncryptionKeys); ok {
+		keyID, err = messageKeys.CurrentMessageKeyID(topic, msg)
+	} else {
+		keyID, err = e.keys.CurrentKeyID(topic)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "could not get current encryption key of topic %s", topic)
+	}
+
+	return keyID, nil
+}
+
+// Decrypt decrypts the payload of the message in place, with the key which encrypted it.
+// Messages without EncryptionKeyIDMetadataKey are not changed, so encryption may be enabled for existing topics.
+//
+// Decrypt is a TransformFunc.
+func (e *Encryptor) Decrypt(msg *message.Message) (*message.Message, error) {
+	keyID := msg.Metadata.Get(EncryptionKeyIDMetadataKey)
+	if keyID == "" {
+		return msg, nil
+	}
+
+	aead, err := e.aead(keyID)
+	if errors.Is(err, ErrEncryptionKeyErased) {
+		msg.Payload = nil
+		delete(msg.Metadata, EncryptionKeyIDMetadataKey)
+		msg.Metadata.Set(EncryptionErasedMetadataKey, "true")
+		return msg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msg.Payload) < aead.NonceSize() {
+		return nil, errors.Errorf("encrypted payload of message %s is too short", msg.UUID)
+	}
+	nonce, ciphertext := msg.Payload[:aead.NonceSize()], msg.Payload[aead.NonceSize():]
+
+	payload, err := aead.Open(nil, nonce, ciphertext, []byte(msg.UUID))
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not decrypt payload of message %s", msg.UUID)
+	}
+
+	msg.Payload = payload
+	// Messages re-published by handlers are encrypted again by the publisher.
+	delete(msg.Metadata, EncryptionKeyIDMetadataKey)
+
+	return msg, nil
+}
+
+func (e *Encryptor) encryptWithKey(keyID string, msg *message.Message) (*message.Message, error) {
+	aead, err := e.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(msg.Payload)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "could not generate nonce")
+	}
+
+	// The UUID is authenticated, so encrypted payloads can't be swapped between messages.
+	encrypted := msg.Copy()
+	encrypted.SetContext(msg.Context())
+	encrypted.Payload = aead.Seal(nonce, nonce, msg.Payload, []byte(msg.UUID))
+	encrypted.Metadata.Set(EncryptionKeyIDMetadataKey, keyID)
+
+	return encrypted, nil
+}
+
+func (e *Encryptor) aead(keyID string) (cipher.AEAD, error) {
+	key, err := e.keys.Key(keyID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get encryption key %s", keyID)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid encryption key %s", keyID)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// UpdatingSchemaAdapter is an optional interface of SchemaAdapter, implemented by adapters which can
+// overwrite stored messages. It's used by ReEncryptMessages.
+type UpdatingSchemaAdapter interface {
+	SchemaAdapter
+
+	// UpdateMessageQuery returns the SQL query and arguments which set the payload and the metadata
+	// of the message with the offset.
+	UpdateMessageQuery(topic string, offset int64, msg *message.Message) (Query, error)
+}
+
+// ReEncryptResult describes the messages re-encrypted by ReEncryptMessages.
+type ReEncryptResult struct {
+	// ReEncrypted is the number of messages encrypted with the current key.
+	ReEncrypted int
+
+	// LastOffset is the offset of the last checked message.
+	// It may be passed to ReEncryptMessages, to continue an interrupted re-encryption.
+	LastOffset int64
+}
+
+// ReEncryptMessages encrypts the payloads of the topic's messages with offsets greater than afterOffset
+// with the current keys, so the rotated keys can be retired. Messages encrypted with erased keys are skipped. Messages which are not encrypted
+// are encrypted as well, so subscribers of the topic must decrypt the messages.
+//
+// Every batch of messages is updated in a separate transaction, so ReEncryptMessages may be executed
+// in the background, while messages are published and consumed.
+// schemaAdapter has the same requirements as ImporterConfig.SourceSchemaAdapter.
+func ReEncryptMessages(
+	ctx context.Context,
+	db TxBeginner,
+	schemaAdapter UpdatingSchemaAdapter,
+	encryptor *Encryptor,
+	topic string,
+	afterOffset int64,
+	logger watermill.LoggerAdapter,
+) (ReEncryptResult, error) {
+	if err := validateTopic(schemaAdapter, topic); err != nil {
+		return ReEncryptResult{}, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	result := ReEncryptResult{LastOffset: afterOffset}
+	for {
+		batch, err := readMessagesAfter(ctx, db, schemaAdapter, topic, result.LastOffset)
+		if err != nil {
+			return result, err
+		}
+		if len(batch) == 0 {
+			return result, nil
+		}
+
+		var queries []Query
+		lastOffset := result.LastOffset
+		for _, row := range batch {
+			if row.Offset > lastOffset {
+				lastOffset = row.Offset
+			}
+			if row.Msg.Metadata.Get(EncryptionErasedMetadataKey) != "" {
+				continue
+			}
+
+			currentKeyID, err := encryptor.currentKeyID(topic, row.Msg)
+			if err != nil {
+				return result, err
+			}
+			if row.Msg.Metadata.Get(EncryptionKeyIDMetadataKey) == currentKeyID {
+				continue
+			}
+
+			msg, err := encryptor.Decrypt(row.Msg)
+			if err != nil {
+				return result, err
+			}
+			if msg.Metadata.Get(EncryptionErasedMetadataKey) != "" {
+				// The key was erased, so there is nothing to re-encrypt.
+				continue
+			}
+			msg, err = encryptor.encryptWithKey(currentKeyID, msg)
+			if err != nil {
+				return result, err
+			}
+
+			updateQuery, err := schemaAdapter.UpdateMessageQuery(topic, row.Offset, msg)
+			if err != nil {
+				return result, errors.Wrapf(err, "could not create update query of message %s", msg.UUID)
+			}
+			queries = append(queries, updateQuery)
+		}
+
+		err = runInTx(ctx, db, func(ctx context.Context, tx Tx) error {
+			for _, q := range queries {
+				if _, err := tx.ExecContext(ctx, q.Query, q.Args...); err != nil {
+					return errors.Wrap(err, "could not update message")
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+
+		result.ReEncrypted += len(queries)
+		result.LastOffset = lastOffset
+
+		logger.Debug("Re-encrypted batch of messages", watermill.LogFields{
+			"topic":        topic,
+			"re_encrypted": len(queries),
+			"last_offset":  result.LastOffset,
+		})
+	}
+}
+
+func (s DefaultSQLiteSchema) UpdateMessageQuery(topic string, offset int64, msg *message.Message) (Query, error) {
+	args, err := stringMetadataInsertArgs(message.Messages{msg})
+	if err != nil {
+		return Query{}, err
+	}
+
+	if s.JSONPayloads {
+		payload, jsonPayload := jsonPayloadArgs(msg)
+		return Query{
+			Query: `UPDATE ` + s.MessagesTable(topic) + ` SET "payload" = ?, "` + JSONPayloadColumn + `" = ?, "metadata" = ? WHERE "offset" = ?`,
+			Args:  []any{payload, jsonPayload, args[2], offset},
+		}, nil
+	}
+
+	return Query{
+		Query: `UPDATE ` + s.MessagesTable(topic) + ` SET "payload" = ?, "metadata" = ? WHERE "offset" = ?`,
+		Args:  []any{args[1], args[2], offset},
+	}, nil
+}
+
+func (s DefaultMySQLSchema) UpdateMessageQuery(topic string, offset int64, msg *message.Message) (Query, error) {
+	args, err := defaultInsertArgs(message.Messages{msg})
+	if err != nil {
+		return Query{}, err
+	}
+
+	if s.JSONPayloads {
+		payload, jsonPayload := jsonPayloadArgs(msg)
+		return Query{
+			Query: "UPDATE " + s.MessagesTable(topic) + " SET `payload` = ?, `" + JSONPayloadColumn + "` = ?, `metadata` = ? WHERE `offset` = ?",
+			Args:  []any{payload, jsonPayload, args[2], offset},
+		}, nil
+	}
+
+	return Query{
+		Query: "UPDATE " + s.MessagesTable(topic) + " SET `payload` = ?, `metadata` = ? WHERE `offset` = ?",
+		Args:  []any{args[1], args[2], offset},
+	}, nil
+}
+
+func (s DialectSchema) UpdateMessageQuery(topic string, offset int64, msg *message.Message) (Query, error) {
+	args, err := stringMetadataInsertArgs(message.Messages{msg})
+	if err != nil {
+		return Query{}, err
+	}
+
+	names := s.ColumnNames.withDefaults()
+	return Query{
+		Query: `UPDATE ` + s.MessagesTable(topic) + `
+			SET ` + s.Dialect.QuoteIdentifier(names.Payload) + ` = ` + s.Dialect.Placeholder(1) + `,
+				` + s.Dialect.QuoteIdentifier(names.Metadata) + ` = ` + s.Dialect.Placeholder(2) + `
+			WHERE ` + s.Dialect.QuoteIdentifier(names.Offset) + ` = ` + s.Dialect.Placeholder(3),
+		Args: []any{args[1], args[2], offset},
+	}, nil
+}
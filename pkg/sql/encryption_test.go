@@ -0,0 +1,127 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptor(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "encryption.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	schemaAdapter := sql.DefaultSQLiteSchema{}
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+	topic := "encryption_" + watermill.NewShortUUID()
+
+	keys := sql.StaticEncryptionKeys{
+		Keys: map[string][]byte{
+			"k1": []byte("0123456789abcdef0123456789abcdef"),
+			"k2": []byte("fedcba9876543210fedcba9876543210"),
+		},
+		CurrentKeyIDs: map[string]string{topic: "k1"},
+	}
+	encryptor, err := sql.NewEncryptor(keys)
+	require.NoError(t, err)
+
+	publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+		SchemaAdapter:        schemaAdapter,
+		AutoInitializeSchema: true,
+		Encryptor:            encryptor,
+	}, logger)
+	require.NoError(t, err)
+
+	msgs := message.Messages{
+		message.NewMessage(watermill.NewUUID(), []byte(`{"n":1}`)),
+		message.NewMessage(watermill.NewUUID(), []byte(`{"n":2}`)),
+		message.NewMessage(watermill.NewUUID(), []byte(`{"n":3}`)),
+	}
+	require.NoError(t, publisher.Publish(topic, msgs...))
+	assert.Equal(t, `{"n":1}`, string(msgs[0].Payload), "published messages should not be changed")
+
+	storedKeyIDs := func() []string {
+		rows, err := sqlDB.Query(`SELECT "payload", "metadata" FROM ` + schemaAdapter.MessagesTable(topic) + ` ORDER BY "offset"`)
+		require.NoError(t, err)
+		defer rows.Close()
+
+		var keyIDs []string
+		for rows.Next() {
+			var payload []byte
+			var rawMetadata string
+			require.NoError(t, rows.Scan(&payload, &rawMetadata))
+			assert.NotContains(t, string(payload), `"n"`)
+
+			metadata := message.Metadata{}
+			require.NoError(t, json.Unmarshal([]byte(rawMetadata), &metadata))
+			keyIDs = append(keyIDs, metadata.Get(sql.EncryptionKeyIDMetadataKey))
+		}
+		require.NoError(t, rows.Err())
+
+		return keyIDs
+	}
+	assert.Equal(t, []string{"k1", "k1", "k1"}, storedKeyIDs())
+
+	consume := func(consumerGroup string) []string {
+		subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+			ConsumerGroup:    consumerGroup,
+			SchemaAdapter:    schemaAdapter,
+			OffsetsAdapter:   offsetsAdapter,
+			InitializeSchema: true,
+			PollInterval:     time.Millisecond * 10,
+			Transforms:       []sql.TransformFunc{encryptor.Decrypt},
+		}, logger)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, subscriber.Close())
+		}()
+
+		ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+
+		messages, err := subscriber.Subscribe(ctx, topic)
+		require.NoError(t, err)
+
+		var payloads []string
+		for len(payloads) < len(msgs) {
+			select {
+			case msg := <-messages:
+				assert.Empty(t, msg.Metadata.Get(sql.EncryptionKeyIDMetadataKey))
+				payloads = append(payloads, string(msg.Payload))
+				msg.Ack()
+			case <-ctx.Done():
+				t.Fatal("timeout waiting for messages")
+			}
+		}
+
+		return payloads
+	}
+	expectedPayloads := []string{`{"n":1}`, `{"n":2}`, `{"n":3}`}
+	assert.Equal(t, expectedPayloads, consume("before_rotation"))
+
+	keys.CurrentKeyIDs[topic] = "k2"
+
+	result, err := sql.ReEncryptMessages(ctx, db, schemaAdapter, encryptor, topic, 0, logger)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ReEncrypted)
+	assert.EqualValues(t, 3, result.LastOffset)
+	assert.Equal(t, []string{"k2", "k2", "k2"}, storedKeyIDs())
+
+	result, err = sql.ReEncryptMessages(ctx, db, schemaAdapter, encryptor, topic, 0, logger)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.ReEncrypted, "messages encrypted with the current key should be skipped")
+
+	delete(keys.Keys, "k1")
+	assert.Equal(t, expectedPayloads, consume("after_rotation"))
+}
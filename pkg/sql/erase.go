@@ -0,0 +1,260 @@
+package sql
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// ErasePredicate selects the messages erased by SQLiteTopicAdmin.Erase.
+type ErasePredicate struct {
+	// MetadataKey is the metadata key identifying the subject of the messages, like "user_id". It's required.
+	MetadataKey string
+
+	// MetadataValue is the value of MetadataKey of the erased messages. It's required.
+	MetadataValue string
+}
+
+func (p ErasePredicate) validate() error {
+	if p.MetadataKey == "" {
+		return errors.New("metadata key is empty")
+	}
+	if strings.Contains(p.MetadataKey, `"`) {
+		return errors.New("metadata key must not contain quotes")
+	}
+	if p.MetadataValue == "" {
+		return errors.New("metadata value is empty")
+	}
+
+	return nil
+}
+
+// ErasingEncryptionKeys is an optional interface of EncryptionKeys, implemented by keys which can be erased.
+// It's used by SQLiteTopicAdmin.Erase for crypto-shredding.
+type ErasingEncryptionKeys interface {
+	EncryptionKeys
+
+	// EraseKey removes the key permanently. Key must return ErrEncryptionKeyErased for it afterwards.
+	EraseKey(ctx context.Context, keyID string) error
+}
+
+// EraseResult describes the messages erased by SQLiteTopicAdmin.Erase.
+type EraseResult struct {
+	// Deleted is the number of deleted messages.
+	Deleted int64
+
+	// ErasedKeys are the IDs of the erased encryption keys.
+	ErasedKeys []string
+}
+
+// Erase erases the topic's messages matching the predicate, for example, to handle a right-to-be-forgotten request.
+//
+// If ErasingKeys is nil, the messages are deleted. Otherwise, the messages are crypto-shredded: the keys which
+// encrypted them are erased, so the messages stay in the topic, but can't be decrypted anymore (see Encryptor.Decrypt).
+// Keys must be specific to the subject (see SQLiteSubjectEncryptionKeys), as all messages encrypted
+// with the erased keys are affected. Matching messages which are not encrypted are deleted in both cases.
+//
+// Messages are matched by their stored metadata, so crypto-shredding doesn't require decrypting them,
+// but the subject's metadata must not be encrypted.
+func (a SQLiteTopicAdmin) Erase(ctx context.Context, topic string, predicate ErasePredicate) (EraseResult, error) {
+	if err := validateTopicName(topic); err != nil {
+		return EraseResult{}, err
+	}
+	if err := predicate.validate(); err != nil {
+		return EraseResult{}, errors.Wrap(err, "invalid predicate")
+	}
+
+	var result EraseResult
+	matching := `json_extract("metadata", ?) = ?`
+	matchingArgs := []any{fmt.Sprintf(`$."%s"`, predicate.MetadataKey), predicate.MetadataValue}
+	keyIDPath := fmt.Sprintf(`$."%s"`, EncryptionKeyIDMetadataKey)
+
+	if a.ErasingKeys != nil {
+		rows, err := a.DB.QueryContext(
+			ctx,
+			`SELECT DISTINCT json_extract("metadata", ?) AS "key_id" FROM `+a.SchemaAdapter.MessagesTable(topic)+`
+			WHERE `+matching+` AND json_extract("metadata", ?) IS NOT NULL
+			ORDER BY "key_id"`,
+			append(append([]any{keyIDPath}, matchingArgs...), keyIDPath)...,
+		)
+		if err != nil {
+			return result, errors.Wrap(err, "could not query encryption keys of messages")
+		}
+
+		var keyIDs []string
+		for rows.Next() {
+			var keyID string
+			if err := rows.Scan(&keyID); err != nil {
+				_ = rows.Close()
+				return result, errors.Wrap(err, "could not scan encryption key ID")
+			}
+			keyIDs = append(keyIDs, keyID)
+		}
+		if err := rows.Close(); err != nil {
+			return result, errors.Wrap(err, "could not close rows")
+		}
+
+		for _, keyID := range keyIDs {
+			if err := a.ErasingKeys.EraseKey(ctx, keyID); err != nil {
+				return result, errors.Wrapf(err, "could not erase encryption key %s", keyID)
+			}
+			result.ErasedKeys = append(result.ErasedKeys, keyID)
+		}
+
+		matching += ` AND json_extract("metadata", ?) IS NULL`
+		matchingArgs = append(matchingArgs, keyIDPath)
+	}
+
+	res, err := a.DB.ExecContext(
+		ctx,
+		`DELETE FROM `+a.SchemaAdapter.MessagesTable(topic)+` WHERE `+matching,
+		matchingArgs...,
+	)
+	if err != nil {
+		return result, errors.Wrap(err, "could not delete messages")
+	}
+
+	result.Deleted, err = res.RowsAffected()
+	if err != nil {
+		return result, errors.Wrap(err, "could not get number of deleted messages")
+	}
+
+	return result, nil
+}
+
+// SQLiteSubjectEncryptionKeys is an implementation of ErasingEncryptionKeys and MessageEncryptionKeys,
+// which stores a separate key for every subject (like a user) of every topic in a SQLite table,
+// so the messages of a subject can be crypto-shredded with SQLiteTopicAdmin.Erase.
+//
+// Keys are generated when the first message of the subject is published.
+// Keys are stored in plain text, so the table should be stored separately from the messages
+// (for example, in a different database), and backups of the keys should expire.
+type SQLiteSubjectEncryptionKeys struct {
+	DB QueryExecutor
+
+	// SubjectMetadataKey is the metadata key identifying the subject of messages, like "user_id". It's required.
+	// Messages without the subject can't be published.
+	SubjectMetadataKey string
+
+	// TableName may be used to override the name of the table. The name should not be quoted.
+	//
+	// Default value is watermill_encryption_keys.
+	TableName string
+}
+
+// InitializeSchema creates the table storing the keys, if it doesn't exist yet.
+func (k SQLiteSubjectEncryptionKeys) InitializeSchema(ctx context.Context) error {
+	_, err := k.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+k.table()+` (
+		"key_id" TEXT NOT NULL PRIMARY KEY,
+		"topic" TEXT NOT NULL,
+		"subject" TEXT NOT NULL,
+		"key" BLOB NOT NULL,
+		UNIQUE ("topic", "subject")
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "could not create encryption keys table")
+	}
+
+	return nil
+}
+
+func (k SQLiteSubjectEncryptionKeys) CurrentKeyID(topic string) (string, error) {
+	return "", errors.New("encryption keys require the message's subject")
+}
+
+func (k SQLiteSubjectEncryptionKeys) CurrentMessageKeyID(topic string, msg *message.Message) (string, error) {
+	if k.SubjectMetadataKey == "" {
+		return "", errors.New("subject metadata key is empty")
+	}
+
+	subject := msg.Metadata.Get(k.SubjectMetadataKey)
+	if subject == "" {
+		return "", errors.Errorf("message %s has no %s metadata", msg.UUID, k.SubjectMetadataKey)
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", errors.Wrap(err, "could not generate key")
+	}
+
+	// Keys of erased subjects are deleted, so a new key is generated for the subject's new messages.
+	ctx := context.Background()
+	_, err := k.DB.ExecContext(
+		ctx,
+		`INSERT INTO `+k.table()+` ("key_id", "topic", "subject", "key") VALUES (?, ?, ?, ?)
+		ON CONFLICT ("topic", "subject") DO NOTHING`,
+		watermill.NewUUID(), topic, subject, key,
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "could not insert key")
+	}
+
+	rows, err := k.DB.QueryContext(
+		ctx,
+		`SELECT "key_id" FROM `+k.table()+` WHERE "topic" = ? AND "subject" = ?`,
+		topic, subject,
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "could not query key")
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", errors.Wrap(err, "could not query key")
+		}
+		return "", errors.Errorf("key of subject %s not found", subject)
+	}
+
+	var keyID string
+	if err := rows.Scan(&keyID); err != nil {
+		return "", errors.Wrap(err, "could not scan key ID")
+	}
+
+	return keyID, nil
+}
+
+func (k SQLiteSubjectEncryptionKeys) Key(keyID string) ([]byte, error) {
+	rows, err := k.DB.QueryContext(context.Background(), `SELECT "key" FROM `+k.table()+` WHERE "key_id" = ?`, keyID)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query key")
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, errors.Wrap(err, "could not query key")
+		}
+		// Key IDs are read from the stored messages, so missing keys were erased.
+		return nil, ErrEncryptionKeyErased
+	}
+
+	var key []byte
+	if err := rows.Scan(&key); err != nil {
+		return nil, errors.Wrap(err, "could not scan key")
+	}
+
+	return key, nil
+}
+
+func (k SQLiteSubjectEncryptionKeys) EraseKey(ctx context.Context, keyID string) error {
+	_, err := k.DB.ExecContext(ctx, `DELETE FROM `+k.table()+` WHERE "key_id" = ?`, keyID)
+	if err != nil {
+		return errors.Wrap(err, "could not delete key")
+	}
+
+	return nil
+}
+
+func (k SQLiteSubjectEncryptionKeys) table() string {
+	if k.TableName != "" {
+		return fmt.Sprintf(`"%s"`, k.TableName)
+	}
+	return `"watermill_encryption_keys"`
+}
@@ -0,0 +1,131 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteTopicAdmin_Erase(t *testing.T) {
+	newUserMessage := func(userID string, payload string) *message.Message {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(payload))
+		msg.Metadata.Set("user_id", userID)
+		return msg
+	}
+
+	t.Run("delete", func(t *testing.T) {
+		sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "erase.sqlite")+"?_pragma=busy_timeout(10000)")
+		require.NoError(t, err)
+		defer sqlDB.Close()
+
+		db := sql.BeginnerFromStdSQL(sqlDB)
+		topic := "erase_" + watermill.NewShortUUID()
+
+		publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+		require.NoError(t, publisher.Publish(
+			topic,
+			newUserMessage("alice", `{"n":1}`),
+			newUserMessage("bob", `{"n":2}`),
+			newUserMessage("alice", `{"n":3}`),
+		))
+
+		admin := sql.SQLiteTopicAdmin{DB: db}
+
+		_, err = admin.Erase(context.Background(), topic, sql.ErasePredicate{MetadataKey: "user_id"})
+		assert.Error(t, err)
+
+		result, err := admin.Erase(context.Background(), topic, sql.ErasePredicate{MetadataKey: "user_id", MetadataValue: "alice"})
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, result.Deleted)
+		assert.Empty(t, result.ErasedKeys)
+
+		messages, err := admin.PeekMessages(context.Background(), topic, 0, 10)
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "bob", messages[0].Msg.Metadata.Get("user_id"))
+	})
+
+	t.Run("crypto_shred", func(t *testing.T) {
+		sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "erase.sqlite")+"?_pragma=busy_timeout(10000)")
+		require.NoError(t, err)
+		defer sqlDB.Close()
+
+		ctx := context.Background()
+		db := sql.BeginnerFromStdSQL(sqlDB)
+		topic := "erase_" + watermill.NewShortUUID()
+
+		keys := sql.SQLiteSubjectEncryptionKeys{DB: db, SubjectMetadataKey: "user_id"}
+		require.NoError(t, keys.InitializeSchema(ctx))
+		encryptor, err := sql.NewEncryptor(keys)
+		require.NoError(t, err)
+
+		publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+			SchemaAdapter:        sql.DefaultSQLiteSchema{},
+			AutoInitializeSchema: true,
+			Encryptor:            encryptor,
+		}, logger)
+		require.NoError(t, err)
+
+		assert.Error(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)), "message without subject")
+
+		require.NoError(t, publisher.Publish(
+			topic,
+			newUserMessage("alice", `{"n":1}`),
+			newUserMessage("bob", `{"n":2}`),
+			newUserMessage("alice", `{"n":3}`),
+		))
+
+		admin := sql.SQLiteTopicAdmin{DB: db, ErasingKeys: keys}
+
+		result, err := admin.Erase(ctx, topic, sql.ErasePredicate{MetadataKey: "user_id", MetadataValue: "alice"})
+		require.NoError(t, err)
+		assert.EqualValues(t, 0, result.Deleted)
+		assert.Len(t, result.ErasedKeys, 1)
+
+		subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+			SchemaAdapter:    sql.DefaultSQLiteSchema{},
+			OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+			InitializeSchema: true,
+			PollInterval:     time.Millisecond * 10,
+			Transforms:       []sql.TransformFunc{encryptor.Decrypt},
+		}, logger)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, subscriber.Close())
+		}()
+
+		ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+
+		messages, err := subscriber.Subscribe(ctx, topic)
+		require.NoError(t, err)
+
+		payloads := map[string][]string{}
+		for i := 0; i < 3; i++ {
+			select {
+			case msg := <-messages:
+				userID := msg.Metadata.Get("user_id")
+				if userID == "alice" {
+					assert.Equal(t, "true", msg.Metadata.Get(sql.EncryptionErasedMetadataKey))
+				}
+				payloads[userID] = append(payloads[userID], string(msg.Payload))
+				msg.Ack()
+			case <-ctx.Done():
+				t.Fatal("timeout waiting for messages")
+			}
+		}
+
+		assert.Equal(t, map[string][]string{
+			"alice": {"", ""},
+			"bob":   {`{"n":2}`},
+		}, payloads)
+	})
+}
@@ -0,0 +1,187 @@
+package sql
+
+import (
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Typed errors of the database drivers, returned by TranslateError.
+// They may be checked with errors.Is, regardless of the driver which returned the error.
+var (
+	// ErrBusy is a lock held by another connection, which couldn't be acquired in time,
+	// like SQLITE_BUSY or the lock wait timeout of MySQL.
+	ErrBusy = errors.New("database is busy")
+
+	// ErrDuplicate is a violation of a unique constraint or a primary key.
+	ErrDuplicate = errors.New("duplicate key")
+
+	// ErrSerializationFailure is a conflict with a concurrent transaction, like a serialization failure
+	// or a deadlock. The transaction should be retried.
+	ErrSerializationFailure = errors.New("serialization failure")
+
+	// ErrMissingTable is a query of a table which doesn't exist, for example, when the schema was not initialized.
+	ErrMissingTable = errors.New("missing table")
+)
+
+// SQLite result codes (https://www.sqlite.org/rescode.html).
+const (
+	sqliteBusy       = 5
+	sqliteLocked     = 6
+	sqliteConstraint = 19
+
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+)
+
+// ClassifyError returns the typed error (like ErrBusy or ErrDuplicate) matching the error of a database driver,
+// or nil if the error doesn't match any of them.
+//
+// Errors of pgx, lib/pq and go-sql-driver/mysql are classified by their codes,
+// as well as errors of modernc.org/sqlite, which have the Code method. Errors of other drivers
+// (like mattn/go-sqlite3) are classified by their messages.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	for _, typed := range []error{ErrBusy, ErrDuplicate, ErrSerializationFailure, ErrMissingTable} {
+		if errors.Is(err, typed) {
+			return typed
+		}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return classifySQLState(pgErr.Code)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return classifySQLState(string(pqErr.Code))
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return classifyMySQLError(mysqlErr.Number)
+	}
+
+	var sqliteErr interface {
+		error
+		Code() int
+	}
+	if errors.As(err, &sqliteErr) {
+		if typed := classifySQLiteCode(sqliteErr.Code()); typed != nil {
+			return typed
+		}
+	}
+
+	return classifyErrorMessage(err.Error())
+}
+
+// TranslateError returns the error with the typed error matching it (see ClassifyError), so errors.Is(err, ErrBusy)
+// works for all drivers. The message of the error is not changed, and the driver's error can be still unwrapped.
+// Errors which don't match any typed error are returned unchanged.
+func TranslateError(err error) error {
+	typed := ClassifyError(err)
+	if typed == nil || errors.Is(err, typed) {
+		return err
+	}
+
+	return translatedError{err: err, typed: typed}
+}
+
+type translatedError struct {
+	err   error
+	typed error
+}
+
+func (e translatedError) Error() string {
+	return e.err.Error()
+}
+
+func (e translatedError) Unwrap() error {
+	return e.err
+}
+
+func (e translatedError) Is(target error) bool {
+	return target == e.typed
+}
+
+func classifySQLState(code string) error {
+	switch code {
+	case "40001", "40P01":
+		// serialization_failure, deadlock_detected
+		return ErrSerializationFailure
+	case "55P03":
+		// lock_not_available
+		return ErrBusy
+	case "23505":
+		// unique_violation
+		return ErrDuplicate
+	case "42P01":
+		// undefined_table
+		return ErrMissingTable
+	}
+
+	return nil
+}
+
+func classifyMySQLError(number uint16) error {
+	switch number {
+	case 1213:
+		// ER_LOCK_DEADLOCK
+		return ErrSerializationFailure
+	case 1205:
+		// ER_LOCK_WAIT_TIMEOUT
+		return ErrBusy
+	case 1062:
+		// ER_DUP_ENTRY
+		return ErrDuplicate
+	case 1146:
+		// ER_NO_SUCH_TABLE
+		return ErrMissingTable
+	}
+
+	return nil
+}
+
+func classifySQLiteCode(code int) error {
+	// Extended result codes contain the primary result code in the lowest byte.
+	switch code & 0xff {
+	case sqliteBusy, sqliteLocked:
+		return ErrBusy
+	case sqliteConstraint:
+		if code == sqliteConstraintUnique || code == sqliteConstraintPrimaryKey {
+			return ErrDuplicate
+		}
+	}
+
+	// SQLite reports missing tables with the generic SQLITE_ERROR code.
+	return nil
+}
+
+// errorMessageIndicators are substrings of errors (in lower case) of drivers without error codes.
+var errorMessageIndicators = []struct {
+	indicator string
+	typed     error
+}{
+	{"database is locked", ErrBusy},
+	{"database table is locked", ErrBusy},
+	{"unique constraint failed", ErrDuplicate},
+	{"no such table", ErrMissingTable},
+}
+
+func classifyErrorMessage(msg string) error {
+	msg = strings.ToLower(msg)
+	for _, indicator := range errorMessageIndicators {
+		if strings.Contains(msg, indicator.indicator) {
+			return indicator.typed
+		}
+	}
+
+	return nil
+}
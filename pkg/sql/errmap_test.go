@@ -0,0 +1,104 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Err      error
+		Expected error
+	}{
+		{Name: "nil", Err: nil, Expected: nil},
+		{Name: "unknown", Err: errors.New("connection refused"), Expected: nil},
+		{Name: "pgx_serialization", Err: &pgconn.PgError{Code: "40001"}, Expected: sql.ErrSerializationFailure},
+		{Name: "pgx_deadlock", Err: &pgconn.PgError{Code: "40P01"}, Expected: sql.ErrSerializationFailure},
+		{Name: "pgx_lock_not_available", Err: &pgconn.PgError{Code: "55P03"}, Expected: sql.ErrBusy},
+		{Name: "pgx_unique", Err: &pgconn.PgError{Code: "23505"}, Expected: sql.ErrDuplicate},
+		{Name: "pgx_undefined_table", Err: &pgconn.PgError{Code: "42P01"}, Expected: sql.ErrMissingTable},
+		{Name: "pgx_syntax", Err: &pgconn.PgError{Code: "42601"}, Expected: nil},
+		{Name: "pq_unique", Err: &pq.Error{Code: "23505"}, Expected: sql.ErrDuplicate},
+		{Name: "pq_serialization", Err: &pq.Error{Code: "40001"}, Expected: sql.ErrSerializationFailure},
+		{Name: "mysql_deadlock", Err: &mysql.MySQLError{Number: 1213}, Expected: sql.ErrSerializationFailure},
+		{Name: "mysql_lock_wait_timeout", Err: &mysql.MySQLError{Number: 1205}, Expected: sql.ErrBusy},
+		{Name: "mysql_duplicate", Err: &mysql.MySQLError{Number: 1062}, Expected: sql.ErrDuplicate},
+		{Name: "mysql_no_such_table", Err: &mysql.MySQLError{Number: 1146}, Expected: sql.ErrMissingTable},
+		{Name: "sqlite_busy", Err: sqliteCodeError{code: 5}, Expected: sql.ErrBusy},
+		{Name: "sqlite_busy_snapshot", Err: sqliteCodeError{code: 517}, Expected: sql.ErrBusy},
+		{Name: "sqlite_unique", Err: sqliteCodeError{code: 2067}, Expected: sql.ErrDuplicate},
+		{Name: "sqlite_not_null", Err: sqliteCodeError{code: 1299}, Expected: nil},
+		{Name: "sqlite_message", Err: errors.New("UNIQUE constraint failed: orders.id"), Expected: sql.ErrDuplicate},
+		{Name: "faulty_db", Err: sql.ErrInjectedBusy, Expected: sql.ErrBusy},
+		{Name: "wrapped", Err: errors.Wrap(&pgconn.PgError{Code: "23505"}, "could not insert"), Expected: sql.ErrDuplicate},
+		{Name: "typed", Err: errors.Wrap(sql.ErrMissingTable, "could not select"), Expected: sql.ErrMissingTable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Expected, sql.ClassifyError(tc.Err))
+
+			translated := sql.TranslateError(tc.Err)
+			if tc.Expected == nil {
+				assert.Equal(t, tc.Err, translated)
+				return
+			}
+			assert.ErrorIs(t, translated, tc.Expected)
+			assert.ErrorIs(t, translated, tc.Err)
+			assert.Equal(t, tc.Err.Error(), translated.Error())
+		})
+	}
+}
+
+func TestIsRetryableTxError_typedErrors(t *testing.T) {
+	assert.True(t, sql.IsRetryableTxError(&pgconn.PgError{Code: "40001"}))
+	assert.True(t, sql.IsRetryableTxError(&mysql.MySQLError{Number: 1205}))
+	assert.False(t, sql.IsRetryableTxError(&pgconn.PgError{Code: "23505"}))
+}
+
+func TestTranslateError_sqlite(t *testing.T) {
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topic := "translated_" + watermill.NewShortUUID()
+
+	_, err := db.ExecContext(ctx, `SELECT * FROM "watermill_`+topic+`"`)
+	assert.ErrorIs(t, sql.TranslateError(err), sql.ErrMissingTable)
+
+	schema := sql.DefaultSQLiteSchema{
+		BusinessKeys: []sql.BusinessKey{{MetadataKey: "order_id", Unique: true}},
+	}
+	publisher := newCheckpointPublisher(t, db, schema)
+
+	newMessage := func() *message.Message {
+		msg := message.NewMessage(watermill.NewUUID(), []byte("{}"))
+		msg.Metadata.Set("order_id", "1")
+		return msg
+	}
+
+	require.NoError(t, publisher.Publish(topic, newMessage()))
+	err = publisher.Publish(topic, newMessage())
+	assert.ErrorIs(t, err, sql.ErrDuplicate)
+}
+
+type sqliteCodeError struct {
+	code int
+}
+
+func (e sqliteCodeError) Error() string {
+	return "sqlite error"
+}
+
+func (e sqliteCodeError) Code() int {
+	return e.code
+}
@@ -0,0 +1,167 @@
+package sql
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is a lifecycle event emitted by Publisher or Subscriber on the channel returned by Events.
+//
+// Events may be used to build custom monitoring, or to assert on the internal behavior in tests.
+type Event interface {
+	EventTopic() string
+}
+
+// BatchSelected is emitted by Subscriber when a batch of messages was selected from the database.
+type BatchSelected struct {
+	Topic    string
+	Messages int
+}
+
+// MessageDelivered is emitted by Subscriber when a message was sent to the output channel.
+// A message is delivered again after it's nacked.
+type MessageDelivered struct {
+	Topic string
+	UUID  string
+}
+
+// MessageAcked is emitted by Subscriber when a message was acked by the handler.
+type MessageAcked struct {
+	Topic string
+	UUID  string
+}
+
+// DuplicateSkipped is emitted by Subscriber when a message was acked without delivering it,
+// as SubscriberConfig.Deduplicator detected it as a duplicate.
+type DuplicateSkipped struct {
+	Topic string
+	UUID  string
+}
+
+// AckFailed is emitted by Subscriber when storing the ack of a message failed.
+// UUID is empty if the transaction acking a batch of messages failed to commit.
+type AckFailed struct {
+	Topic string
+	UUID  string
+	Err   error
+}
+
+// RetryScheduled is emitted by Subscriber when querying messages failed and will be retried after Wait.
+type RetryScheduled struct {
+	Topic string
+	Err   error
+	Wait  time.Duration
+}
+
+// LeaseAcquired is emitted by Subscriber when it acquired the lease of the consumer group
+// and started consuming (see SubscriberConfig.LeaseStore).
+type LeaseAcquired struct {
+	Topic         string
+	ConsumerGroup string
+}
+
+// LeaseLost is emitted by Subscriber when the lease of the consumer group was taken over by another subscriber,
+// or released when the subscription stopped.
+type LeaseLost struct {
+	Topic         string
+	ConsumerGroup string
+}
+
+// TopicHibernated is emitted by Subscriber when the topic had no new messages for SubscriberConfig.HibernateAfter,
+// so it's queried every SubscriberConfig.HibernationInterval.
+type TopicHibernated struct {
+	Topic         string
+	ConsumerGroup string
+}
+
+// TopicWoken is emitted by Subscriber when a hibernated topic was woken up by new messages or Subscriber.Wake.
+type TopicWoken struct {
+	Topic         string
+	ConsumerGroup string
+}
+
+// MessagesPublished is emitted by Publisher when messages were inserted.
+type MessagesPublished struct {
+	Topic    string
+	Messages int
+}
+
+// PublishFailed is emitted by Publisher when inserting messages failed.
+type PublishFailed struct {
+	Topic string
+	Err   error
+}
+
+// OrderingViolated is emitted by Subscriber when an acked message is out of the order it was published in
+// (see SubscriberConfig.ValidateOrdering).
+type OrderingViolated struct {
+	Topic     string
+	Violation OrderingViolation
+}
+
+func (e BatchSelected) EventTopic() string     { return e.Topic }
+func (e MessageDelivered) EventTopic() string  { return e.Topic }
+func (e MessageAcked) EventTopic() string      { return e.Topic }
+func (e DuplicateSkipped) EventTopic() string  { return e.Topic }
+func (e AckFailed) EventTopic() string         { return e.Topic }
+func (e RetryScheduled) EventTopic() string    { return e.Topic }
+func (e LeaseAcquired) EventTopic() string     { return e.Topic }
+func (e LeaseLost) EventTopic() string         { return e.Topic }
+func (e TopicHibernated) EventTopic() string   { return e.Topic }
+func (e TopicWoken) EventTopic() string        { return e.Topic }
+func (e MessagesPublished) EventTopic() string { return e.Topic }
+func (e PublishFailed) EventTopic() string     { return e.Topic }
+func (e OrderingViolated) EventTopic() string  { return e.Topic }
+
+// eventEmitter sends events only after the channel was requested with Events,
+// so publishers and subscribers without observers don't fill the buffer.
+// Events are dropped when the buffer is full, so a slow observer never blocks consuming.
+type eventEmitter struct {
+	events  chan Event
+	enabled atomic.Bool
+
+	closed    bool
+	closeLock sync.RWMutex
+}
+
+func newEventEmitter(bufferSize int) *eventEmitter {
+	return &eventEmitter{
+		events: make(chan Event, bufferSize),
+	}
+}
+
+func (e *eventEmitter) Events() <-chan Event {
+	e.enabled.Store(true)
+	return e.events
+}
+
+func (e *eventEmitter) emit(event Event) {
+	if !e.enabled.Load() {
+		return
+	}
+
+	e.closeLock.RLock()
+	defer e.closeLock.RUnlock()
+
+	if e.closed {
+		return
+	}
+
+	select {
+	case e.events <- event:
+	default:
+	}
+}
+
+func (e *eventEmitter) close() {
+	e.closeLock.Lock()
+	defer e.closeLock.Unlock()
+
+	if e.closed {
+		return
+	}
+
+	e.closed = true
+	close(e.events)
+}
@@ -0,0 +1,256 @@
+package sql
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// ExportFormat is the file format written by Exporter.
+type ExportFormat int
+
+const (
+	// ExportFormatNDJSON writes every message as a JSON object on a separate line.
+	ExportFormatNDJSON ExportFormat = iota
+
+	// ExportFormatCSV writes every message as a CSV record, preceded by a header record.
+	ExportFormatCSV
+)
+
+// ExportedMetadataPrefix prefixes the names of fields (or columns) with flattened metadata values.
+const ExportedMetadataPrefix = "metadata."
+
+type ExporterConfig struct {
+	// SchemaAdapter reads the messages of the topic. It's required.
+	// It has the same requirements as ImporterConfig.SourceSchemaAdapter.
+	SchemaAdapter SchemaAdapter
+
+	// Format is the format of the exported messages.
+	//
+	// Default value is ExportFormatNDJSON.
+	Format ExportFormat
+
+	// MetadataKeys are the metadata keys exported as columns of CSV.
+	//
+	// If it's empty, all keys found in the exported messages are used, which requires reading
+	// the exported messages twice. NDJSON always contains all metadata keys of every message.
+	MetadataKeys []string
+}
+
+func (c ExporterConfig) validate() error {
+	if c.SchemaAdapter == nil {
+		return errors.New("schema adapter is nil")
+	}
+	if c.Format != ExportFormatNDJSON && c.Format != ExportFormatCSV {
+		return errors.Errorf("unknown export format: %d", c.Format)
+	}
+
+	return nil
+}
+
+// ExportRange is the range of offsets of exported messages.
+// Ranges of time are not supported, as schema adapters don't read the created_at column.
+type ExportRange struct {
+	// AfterOffset exports only messages with offsets greater than AfterOffset.
+	AfterOffset int64
+
+	// UntilOffset exports only messages with offsets lower or equal to UntilOffset.
+	// If it's 0, messages are exported until the end of the topic.
+	UntilOffset int64
+}
+
+func (r ExportRange) contains(offset int64) bool {
+	return offset > r.AfterOffset && (r.UntilOffset == 0 || offset <= r.UntilOffset)
+}
+
+// Exporter dumps messages of a topic to NDJSON or CSV, for audits or for loading the history of messages
+// to analytics tools. Messages are read without consuming them.
+//
+// Every exported message contains its offset, UUID, payload and metadata. Metadata values are flattened
+// into separate fields (or columns) named with ExportedMetadataPrefix and the metadata key.
+// Payloads which are valid JSON are embedded into NDJSON as JSON values, other payloads are exported as strings.
+// Payloads which are not valid UTF-8 are exported encoded with base64 (and the payload_base64 field).
+type Exporter struct {
+	db     QueryExecutor
+	config ExporterConfig
+	logger watermill.LoggerAdapter
+}
+
+func NewExporter(db QueryExecutor, config ExporterConfig, logger watermill.LoggerAdapter) (*Exporter, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Exporter{
+		db:     db,
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// Export writes the messages of the topic within the range to w. It returns the number of exported messages.
+func (e *Exporter) Export(ctx context.Context, topic string, exportRange ExportRange, w io.Writer) (int, error) {
+	if err := validateTopic(e.config.SchemaAdapter, topic); err != nil {
+		return 0, err
+	}
+
+	if e.config.Format == ExportFormatCSV {
+		return e.exportCSV(ctx, topic, exportRange, w)
+	}
+
+	buf := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buf)
+
+	exported, err := e.forEachMessage(ctx, topic, exportRange, func(offset int64, msg *message.Message) error {
+		record := map[string]any{
+			"offset": offset,
+			"uuid":   msg.UUID,
+		}
+
+		payloadKey, payload := exportedPayload(msg.Payload)
+		if payloadKey == "payload" && json.Valid(msg.Payload) {
+			record[payloadKey] = json.RawMessage(msg.Payload)
+		} else {
+			record[payloadKey] = payload
+		}
+
+		for key, value := range msg.Metadata {
+			record[ExportedMetadataPrefix+key] = value
+		}
+
+		return encoder.Encode(record)
+	})
+	if err != nil {
+		return exported, err
+	}
+
+	if err := buf.Flush(); err != nil {
+		return exported, errors.Wrap(err, "could not write messages")
+	}
+
+	return exported, nil
+}
+
+func (e *Exporter) exportCSV(ctx context.Context, topic string, exportRange ExportRange, w io.Writer) (int, error) {
+	metadataKeys := e.config.MetadataKeys
+	if len(metadataKeys) == 0 {
+		keys := map[string]struct{}{}
+		_, err := e.forEachMessage(ctx, topic, exportRange, func(offset int64, msg *message.Message) error {
+			for key := range msg.Metadata {
+				keys[key] = struct{}{}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for key := range keys {
+			metadataKeys = append(metadataKeys, key)
+		}
+		sort.Strings(metadataKeys)
+	}
+
+	csvWriter := csv.NewWriter(w)
+
+	header := []string{"offset", "uuid", "payload", "payload_base64"}
+	for _, key := range metadataKeys {
+		header = append(header, ExportedMetadataPrefix+key)
+	}
+	if err := csvWriter.Write(header); err != nil {
+		return 0, errors.Wrap(err, "could not write header")
+	}
+
+	exported, err := e.forEachMessage(ctx, topic, exportRange, func(offset int64, msg *message.Message) error {
+		record := make([]string, 4, len(header))
+		record[0] = strconv.FormatInt(offset, 10)
+		record[1] = msg.UUID
+
+		payloadKey, payload := exportedPayload(msg.Payload)
+		if payloadKey == "payload" {
+			record[2] = payload
+		} else {
+			record[3] = payload
+		}
+
+		for _, key := range metadataKeys {
+			record = append(record, msg.Metadata.Get(key))
+		}
+
+		return csvWriter.Write(record)
+	})
+	if err != nil {
+		return exported, err
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return exported, errors.Wrap(err, "could not write messages")
+	}
+
+	return exported, nil
+}
+
+func (e *Exporter) forEachMessage(
+	ctx context.Context,
+	topic string,
+	exportRange ExportRange,
+	fn func(offset int64, msg *message.Message) error,
+) (int, error) {
+	var exported int
+	afterOffset := exportRange.AfterOffset
+
+	for {
+		rows, err := readMessagesAfter(ctx, e.db, e.config.SchemaAdapter, topic, afterOffset)
+		if err != nil {
+			return exported, err
+		}
+		if len(rows) == 0 {
+			return exported, nil
+		}
+
+		for _, row := range rows {
+			if row.Offset > afterOffset {
+				afterOffset = row.Offset
+			}
+			if !exportRange.contains(row.Offset) {
+				continue
+			}
+
+			if err := fn(row.Offset, row.Msg); err != nil {
+				return exported, errors.Wrap(err, "could not write message")
+			}
+			exported++
+		}
+
+		if exportRange.UntilOffset != 0 && afterOffset >= exportRange.UntilOffset {
+			return exported, nil
+		}
+	}
+}
+
+// exportedPayload returns the name of the field and the value of the exported payload.
+func exportedPayload(payload []byte) (string, string) {
+	if utf8.Valid(payload) {
+		return "payload", string(payload)
+	}
+
+	return "payload_base64", base64.StdEncoding.EncodeToString(payload)
+}
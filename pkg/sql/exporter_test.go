@@ -0,0 +1,93 @@
+package sql_test
+
+import (
+	"bytes"
+	"context"
+	stdSQL "database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter(t *testing.T) {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "export.sqlite"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	topic := "topic_" + watermill.NewShortUUID()
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	jsonMsg := message.NewMessage("json", []byte(`{"amount":10}`))
+	jsonMsg.Metadata.Set("type", "order_placed")
+	textMsg := message.NewMessage("text", []byte("plain, text"))
+	textMsg.Metadata.Set("source", "edge")
+	binaryMsg := message.NewMessage("binary", []byte{0xff, 0x00})
+	require.NoError(t, publisher.Publish(topic, jsonMsg, textMsg, binaryMsg))
+
+	schemaAdapter := sql.DefaultSQLiteSchema{SubscribeBatchSize: 2}
+
+	t.Run("ndjson", func(t *testing.T) {
+		exporter, err := sql.NewExporter(sql.BeginnerFromStdSQL(db), sql.ExporterConfig{
+			SchemaAdapter: schemaAdapter,
+		}, logger)
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		exported, err := exporter.Export(context.Background(), topic, sql.ExportRange{}, &out)
+		require.NoError(t, err)
+		assert.Equal(t, 3, exported)
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		require.Len(t, lines, 3)
+
+		var records []map[string]any
+		for _, line := range lines {
+			var record map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &record))
+			records = append(records, record)
+		}
+
+		assert.Equal(t, map[string]any{
+			"offset":        float64(1),
+			"uuid":          "json",
+			"payload":       map[string]any{"amount": float64(10)},
+			"metadata.type": "order_placed",
+		}, records[0])
+		assert.Equal(t, "plain, text", records[1]["payload"])
+		assert.Equal(t, "edge", records[1]["metadata.source"])
+		assert.Equal(t, "/wA=", records[2]["payload_base64"])
+	})
+
+	t.Run("csv_range", func(t *testing.T) {
+		exporter, err := sql.NewExporter(sql.BeginnerFromStdSQL(db), sql.ExporterConfig{
+			SchemaAdapter: schemaAdapter,
+			Format:        sql.ExportFormatCSV,
+		}, logger)
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		exported, err := exporter.Export(context.Background(), topic, sql.ExportRange{AfterOffset: 1, UntilOffset: 2}, &out)
+		require.NoError(t, err)
+		assert.Equal(t, 1, exported)
+
+		records, err := csv.NewReader(&out).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"offset", "uuid", "payload", "payload_base64", "metadata.source"},
+			{"2", "text", "plain, text", "", "edge"},
+		}, records)
+	})
+}
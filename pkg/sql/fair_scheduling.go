@@ -0,0 +1,210 @@
+package sql
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FairSchedulingConfig configures sharing the database between the topics consumed by one subscriber
+// (see SubscriberConfig.FairScheduling), so a busy topic can't starve the other topics.
+//
+// Poll cycles (selecting a batch and delivering its messages) of the topics are limited to MaxConcurrentPolls
+// at a time, and waiting topics are granted the next cycle by weighted fair scheduling: a topic with weight 2
+// gets twice as many cycles as a topic with weight 1, when both of them are busy. Idle topics don't use
+// their share, so it's split between the busy ones.
+type FairSchedulingConfig struct {
+	// MaxConcurrentPolls is the maximum number of poll cycles of all topics at a time.
+	// It should be lower than the number of connections of the database, so they're not all held by one topic.
+	//
+	// Default value is 1.
+	MaxConcurrentPolls int
+
+	// Weights are the weights of the topics.
+	Weights map[string]int
+
+	// DefaultWeight is the weight of the topics missing in Weights.
+	//
+	// Default value is 1.
+	DefaultWeight int
+
+	// MaxInFlight are the maximum numbers of messages of the topics claimed by one poll cycle and not acked yet,
+	// so a long batch of a busy topic doesn't delay the cycles of the other topics.
+	// Batches are still limited by CatchUpBatchLimit, AutoBatch and the schema adapter (like SubscribeBatchSize).
+	//
+	// Topics missing in MaxInFlight are not limited.
+	MaxInFlight map[string]int
+}
+
+func (c *FairSchedulingConfig) setDefaults() {
+	if c.MaxConcurrentPolls == 0 {
+		c.MaxConcurrentPolls = 1
+	}
+	if c.DefaultWeight == 0 {
+		c.DefaultWeight = 1
+	}
+}
+
+func (c FairSchedulingConfig) validate() error {
+	if c.MaxConcurrentPolls < 1 {
+		return errors.New("max concurrent polls must be positive")
+	}
+	if c.DefaultWeight < 1 {
+		return errors.New("default weight must be positive")
+	}
+	for topic, weight := range c.Weights {
+		if weight < 1 {
+			return errors.Errorf("weight of topic %s must be positive", topic)
+		}
+	}
+	for topic, maxInFlight := range c.MaxInFlight {
+		if maxInFlight < 1 {
+			return errors.Errorf("max in-flight messages of topic %s must be positive", topic)
+		}
+	}
+
+	return nil
+}
+
+func (c FairSchedulingConfig) weight(topic string) int {
+	if weight, ok := c.Weights[topic]; ok {
+		return weight
+	}
+
+	return c.DefaultWeight
+}
+
+// fairScheduler grants poll cycles to topics with stride scheduling: every granted cycle advances the pass
+// of the topic by the inverse of its weight, and the waiting topic with the lowest pass is granted the next cycle.
+type fairScheduler struct {
+	config FairSchedulingConfig
+
+	running int
+	waiting []*pollRequest
+
+	// pass is the pass of every topic which was granted a cycle.
+	pass map[string]float64
+	// globalPass is the pass of the last granted cycle. Topics which were idle start from it,
+	// so they don't get all cycles until they catch up with the busy topics.
+	globalPass float64
+
+	lock sync.Mutex
+}
+
+type pollRequest struct {
+	topic   string
+	granted chan struct{}
+}
+
+func newFairScheduler(config *FairSchedulingConfig) *fairScheduler {
+	if config == nil {
+		return nil
+	}
+
+	return &fairScheduler{
+		config: *config,
+		pass:   map[string]float64{},
+	}
+}
+
+// acquire waits until the topic is granted a poll cycle. It returns false if ctx was canceled or closing was closed
+// before. The cycle must be released with release.
+func (f *fairScheduler) acquire(ctx context.Context, closing <-chan struct{}, topic string) bool {
+	f.lock.Lock()
+	if f.running < f.config.MaxConcurrentPolls && len(f.waiting) == 0 {
+		f.grant(topic)
+		f.lock.Unlock()
+		return true
+	}
+
+	request := &pollRequest{topic: topic, granted: make(chan struct{})}
+	f.waiting = append(f.waiting, request)
+	f.lock.Unlock()
+
+	select {
+	case <-request.granted:
+		return true
+	case <-ctx.Done():
+	case <-closing:
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for i, waiting := range f.waiting {
+		if waiting == request {
+			f.waiting = append(f.waiting[:i], f.waiting[i+1:]...)
+			return false
+		}
+	}
+
+	// The cycle was granted meanwhile, so it's passed to the next topic.
+	f.releaseLocked()
+	return false
+}
+
+func (f *fairScheduler) release() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.releaseLocked()
+}
+
+func (f *fairScheduler) releaseLocked() {
+	f.running--
+
+	for f.running < f.config.MaxConcurrentPolls && len(f.waiting) > 0 {
+		next := 0
+		for i, waiting := range f.waiting {
+			// Requests with the same pass are granted in the order they were made.
+			if f.topicPass(waiting.topic) < f.topicPass(f.waiting[next].topic) {
+				next = i
+			}
+		}
+
+		request := f.waiting[next]
+		f.waiting = append(f.waiting[:next], f.waiting[next+1:]...)
+		f.grant(request.topic)
+		close(request.granted)
+	}
+}
+
+func (f *fairScheduler) grant(topic string) {
+	pass := f.topicPass(topic)
+	f.globalPass = pass
+	f.pass[topic] = pass + 1/float64(f.config.weight(topic))
+	f.running++
+}
+
+func (f *fairScheduler) topicPass(topic string) float64 {
+	pass, ok := f.pass[topic]
+	if !ok || pass < f.globalPass {
+		return f.globalPass
+	}
+
+	return pass
+}
+
+func (f *fairScheduler) inFlightLimitReached(topic string, messages int) bool {
+	maxInFlight, ok := f.config.MaxInFlight[topic]
+	return ok && messages >= maxInFlight
+}
+
+// acquirePoll waits for the poll cycle of the topic, if FairScheduling is set.
+// It returns the function releasing the cycle, and false if the subscription was stopped meanwhile.
+func (s *Subscriber) acquirePoll(ctx context.Context, topic string) (func(), bool) {
+	if s.scheduler == nil {
+		return func() {}, true
+	}
+
+	if !s.scheduler.acquire(ctx, s.closing, topic) {
+		return nil, false
+	}
+
+	return s.scheduler.release, true
+}
+
+func (s *Subscriber) inFlightLimitReached(topic string, messages int) bool {
+	return s.scheduler != nil && s.scheduler.inFlightLimitReached(topic, messages)
+}
@@ -0,0 +1,106 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_FairScheduling(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "fair_scheduling.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	busyTopic := "busy_" + watermill.NewShortUUID()
+	quietTopic := "quiet_" + watermill.NewShortUUID()
+
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+	for i := 0; i < 20; i++ {
+		require.NoError(t, publisher.Publish(busyTopic, message.NewMessage(watermill.NewUUID(), nil)))
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, publisher.Publish(quietTopic, message.NewMessage(watermill.NewUUID(), nil)))
+	}
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:  "fair",
+		SchemaAdapter:  sql.DefaultSQLiteSchema{},
+		OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+		PollInterval:   time.Millisecond * 10,
+		FairScheduling: &sql.FairSchedulingConfig{
+			Weights:     map[string]int{quietTopic: 2},
+			MaxInFlight: map[string]int{busyTopic: 2},
+		},
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	// Schemas are initialized before subscribing, so initializing the second topic doesn't wait
+	// for the transaction of the first one.
+	require.NoError(t, subscriber.SubscribeInitialize(busyTopic))
+	require.NoError(t, subscriber.SubscribeInitialize(quietTopic))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	busy, err := subscriber.Subscribe(ctx, busyTopic)
+	require.NoError(t, err)
+	quiet, err := subscriber.Subscribe(ctx, quietTopic)
+	require.NoError(t, err)
+
+	// The first cycle waits until its message is received, so both topics are polling meanwhile.
+	time.Sleep(time.Millisecond * 200)
+
+	var received []string
+	for len(received) < 23 {
+		select {
+		case msg, ok := <-busy:
+			require.True(t, ok)
+			received = append(received, busyTopic)
+			msg.Ack()
+		case msg, ok := <-quiet:
+			require.True(t, ok)
+			received = append(received, quietTopic)
+			msg.Ack()
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for messages, received %d", len(received))
+		}
+	}
+
+	lastQuiet := 0
+	for i, topic := range received {
+		if topic == quietTopic {
+			lastQuiet = i
+		}
+	}
+	// The busy topic gets at most one cycle of 2 messages before the quiet topic is polled.
+	assert.Less(t, lastQuiet, 5, "quiet topic should not wait for the busy topic: %v", received)
+}
+
+func TestSubscriberConfig_FairSchedulingValidation(t *testing.T) {
+	_, err := sql.NewSubscriber(newSQLite(t), sql.SubscriberConfig{
+		SchemaAdapter:  sql.DefaultSQLiteSchema{},
+		OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+		FairScheduling: &sql.FairSchedulingConfig{
+			MaxInFlight: map[string]int{"orders": 0},
+		},
+	}, logger)
+	assert.ErrorContains(t, err, "max in-flight messages of topic orders must be positive")
+}
+
+func TestSubscriber_FairScheduling_MaxInFlight_reordered(t *testing.T) {
+	testReorderedBatchLimit(t, func(topic string, config *sql.SubscriberConfig) {
+		config.FairScheduling = &sql.FairSchedulingConfig{
+			MaxInFlight: map[string]int{topic: 1},
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInjectedBusy is returned by FaultyDB instead of executing a query.
+	// Its message contains "database is locked", so it's handled like SQLite's busy error by the default BackoffManager.
+	ErrInjectedBusy = errors.New("database is locked (injected by FaultyDB)")
+)
+
+type FaultyDBConfig struct {
+	// BusyProbability is the probability (from 0 to 1) of failing a query, BeginTx or Commit with ErrInjectedBusy.
+	BusyProbability float64
+
+	// DropConnectionProbability is the probability (from 0 to 1) of failing a query, BeginTx or Commit
+	// with driver.ErrBadConn, as if the connection was dropped.
+	DropConnectionProbability float64
+
+	// LatencyProbability is the probability (from 0 to 1) of delaying a query, BeginTx or Commit by Latency.
+	LatencyProbability float64
+
+	// Latency is the delay injected with LatencyProbability.
+	// The delay is interrupted when the context of the query is canceled.
+	Latency time.Duration
+
+	// Seed seeds the random source deciding which faults are injected, so runs with the same seed
+	// (and the same order of calls) inject the same faults.
+	//
+	// If it's 0, the current time is used.
+	Seed int64
+}
+
+func (c FaultyDBConfig) validate() error {
+	for name, p := range map[string]float64{
+		"busy probability":            c.BusyProbability,
+		"drop connection probability": c.DropConnectionProbability,
+		"latency probability":         c.LatencyProbability,
+	} {
+		if p < 0 || p > 1 {
+			return errors.Errorf("%s must be between 0 and 1, got %v", name, p)
+		}
+	}
+	if c.BusyProbability+c.DropConnectionProbability > 1 {
+		return errors.New("sum of busy and drop connection probabilities must not be greater than 1")
+	}
+	if c.Latency < 0 {
+		return errors.New("latency must be non-negative")
+	}
+
+	return nil
+}
+
+// FaultyDBStats are the numbers of faults injected by FaultyDB.
+type FaultyDBStats struct {
+	Busy               int64
+	DroppedConnections int64
+	Latencies          int64
+}
+
+// FaultyDB wraps a TxBeginner and injects faults (busy errors, dropped connections and latency) by probability.
+// It's meant for resilience testing: validating the retry settings (like BackoffManager)
+// of publishers and subscribers, and the handling of failures in the code using them.
+//
+// Faults are injected before calls are passed to the wrapped database, so a failed call has no effect,
+// except for Commit: a transaction failing to commit is rolled back.
+// Rows returned by successful queries are not affected.
+type FaultyDB struct {
+	db     TxBeginner
+	config FaultyDBConfig
+
+	randLock sync.Mutex
+	rand     *rand.Rand
+
+	busy               int64
+	droppedConnections int64
+	latencies          int64
+}
+
+func NewFaultyDB(db TxBeginner, config FaultyDBConfig) (*FaultyDB, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &FaultyDB{
+		db:     db,
+		config: config,
+		rand:   rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+func (f *FaultyDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	if err := f.inject(ctx); err != nil {
+		return nil, err
+	}
+
+	tx, err := f.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &faultyTx{tx: tx, db: f, ctx: ctx}, nil
+}
+
+func (f *FaultyDB) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	if err := f.inject(ctx); err != nil {
+		return nil, err
+	}
+
+	return f.db.ExecContext(ctx, query, args...)
+}
+
+func (f *FaultyDB) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	if err := f.inject(ctx); err != nil {
+		return nil, err
+	}
+
+	return f.db.QueryContext(ctx, query, args...)
+}
+
+// Stats returns the numbers of faults injected so far.
+func (f *FaultyDB) Stats() FaultyDBStats {
+	return FaultyDBStats{
+		Busy:               atomic.LoadInt64(&f.busy),
+		DroppedConnections: atomic.LoadInt64(&f.droppedConnections),
+		Latencies:          atomic.LoadInt64(&f.latencies),
+	}
+}
+
+// inject delays the call or returns the injected error, as drawn from the random source.
+func (f *FaultyDB) inject(ctx context.Context) error {
+	f.randLock.Lock()
+	latency := f.rand.Float64() < f.config.LatencyProbability
+	failure := f.rand.Float64()
+	f.randLock.Unlock()
+
+	if latency && f.config.Latency > 0 {
+		atomic.AddInt64(&f.latencies, 1)
+
+		timer := time.NewTimer(f.config.Latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	switch {
+	case failure < f.config.BusyProbability:
+		atomic.AddInt64(&f.busy, 1)
+		return ErrInjectedBusy
+	case failure < f.config.BusyProbability+f.config.DropConnectionProbability:
+		atomic.AddInt64(&f.droppedConnections, 1)
+		return driver.ErrBadConn
+	}
+
+	return nil
+}
+
+type faultyTx struct {
+	tx  Tx
+	db  *FaultyDB
+	ctx context.Context
+}
+
+func (t *faultyTx) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	if err := t.db.inject(ctx); err != nil {
+		return nil, err
+	}
+
+	return t.tx.ExecContext(ctx, query, args...)
+}
+
+func (t *faultyTx) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	if err := t.db.inject(ctx); err != nil {
+		return nil, err
+	}
+
+	return t.tx.QueryContext(ctx, query, args...)
+}
+
+func (t *faultyTx) Commit() error {
+	// Commit doesn't accept a context, so the latency is interrupted by the context of BeginTx.
+	if err := t.db.inject(t.ctx); err != nil {
+		if rollbackErr := t.tx.Rollback(); rollbackErr != nil {
+			return errors.Wrapf(err, "rollback failed: %s", rollbackErr)
+		}
+		return err
+	}
+
+	return t.tx.Commit()
+}
+
+func (t *faultyTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+func (t *faultyTx) unwrapTx() Tx {
+	return t.tx
+}
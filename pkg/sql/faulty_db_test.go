@@ -0,0 +1,141 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"database/sql/driver"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultyDB(t *testing.T) {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "faulty.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer db.Close()
+
+	faultyDB, err := sql.NewFaultyDB(sql.BeginnerFromStdSQL(db), sql.FaultyDBConfig{
+		BusyProbability:           0.1,
+		DropConnectionProbability: 0.1,
+		LatencyProbability:        0.2,
+		Latency:                   time.Millisecond * 5,
+		Seed:                      1,
+	})
+	require.NoError(t, err)
+
+	logger := watermill.NewStdLogger(false, false)
+	topic := "faulty_" + watermill.NewShortUUID()
+
+	// The schema is initialized without faults, so the test focuses on publishing and consuming.
+	initializingSubscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	require.NoError(t, initializingSubscriber.SubscribeInitialize(topic))
+	require.NoError(t, initializingSubscriber.Close())
+
+	publisher, err := sql.NewPublisherWithExecutor(faultyDB, sql.PublisherConfig{
+		SchemaAdapter: sql.DefaultSQLiteSchema{},
+	}, logger)
+	require.NoError(t, err)
+
+	messagesCount := 50
+	published := map[string]struct{}{}
+
+	for i := 0; i < messagesCount; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(strconv.Itoa(i)))
+
+		// Publishing is retried by the caller, as Publisher doesn't retry on its own.
+		var publishErr error
+		for attempt := 0; attempt < 20; attempt++ {
+			if publishErr = publisher.Publish(topic, msg); publishErr == nil {
+				break
+			}
+		}
+		require.NoError(t, publishErr)
+
+		published[msg.UUID] = struct{}{}
+	}
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(faultyDB, sql.SubscriberConfig{
+		SchemaAdapter:  sql.DefaultSQLiteSchema{SubscribeBatchSize: 5},
+		OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+		PollInterval:   time.Millisecond * 10,
+		RetryInterval:  time.Millisecond * 10,
+		ResendInterval: time.Millisecond * 10,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	// Acks which failed to commit are re-delivered, so messages are received at least once.
+	received := map[string]struct{}{}
+	for len(received) < messagesCount {
+		select {
+		case msg := <-messages:
+			received[msg.UUID] = struct{}{}
+			msg.Ack()
+		case <-ctx.Done():
+			t.Fatalf("received only %d of %d messages", len(received), messagesCount)
+		}
+	}
+
+	assert.Equal(t, published, received)
+
+	stats := faultyDB.Stats()
+	assert.NotZero(t, stats.Busy)
+	assert.NotZero(t, stats.DroppedConnections)
+	assert.NotZero(t, stats.Latencies)
+}
+
+func TestFaultyDB_errors(t *testing.T) {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "faulty.sqlite"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	busyDB, err := sql.NewFaultyDB(sql.BeginnerFromStdSQL(db), sql.FaultyDBConfig{BusyProbability: 1})
+	require.NoError(t, err)
+
+	_, err = busyDB.ExecContext(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, sql.ErrInjectedBusy)
+
+	droppingDB, err := sql.NewFaultyDB(sql.BeginnerFromStdSQL(db), sql.FaultyDBConfig{DropConnectionProbability: 1})
+	require.NoError(t, err)
+
+	_, err = droppingDB.BeginTx(ctx, nil)
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+
+	slowDB, err := sql.NewFaultyDB(sql.BeginnerFromStdSQL(db), sql.FaultyDBConfig{
+		LatencyProbability: 1,
+		Latency:            time.Hour,
+	})
+	require.NoError(t, err)
+
+	canceledCtx, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+	defer cancel()
+
+	_, err = slowDB.QueryContext(canceledCtx, "SELECT 1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = sql.NewFaultyDB(sql.BeginnerFromStdSQL(db), sql.FaultyDBConfig{
+		BusyProbability:           0.6,
+		DropConnectionProbability: 0.6,
+	})
+	assert.Error(t, err)
+}
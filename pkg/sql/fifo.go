@@ -0,0 +1,197 @@
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MessageGroupIDMetadataKey is the metadata key containing the ID of the message group, like in SQS FIFO queues.
+	// Messages of a group are consumed in the order in which they were published.
+	//
+	// Subscribers consume all messages of a topic in order, so the order within groups is preserved by default.
+	// To consume different groups concurrently, the topic may be sharded by the group
+	// (see ShardedSchema and NewMessageGroupPartitioner).
+	MessageGroupIDMetadataKey = "message_group_id"
+
+	// DeduplicationIDMetadataKey is the metadata key containing the deduplication ID of the message.
+	// Messages with a deduplication ID published within the deduplication window are skipped
+	// by SQLiteFIFODeduplicator.
+	DeduplicationIDMetadataKey = "deduplication_id"
+)
+
+// DefaultDeduplicationWindow is the deduplication window of SQS FIFO queues.
+const DefaultDeduplicationWindow = time.Minute * 5
+
+// SetFIFO sets the message group ID and the deduplication ID of the message.
+// The deduplication ID is not set if it's empty.
+func SetFIFO(msg *message.Message, messageGroupID string, deduplicationID string) {
+	msg.Metadata.Set(MessageGroupIDMetadataKey, messageGroupID)
+	if deduplicationID != "" {
+		msg.Metadata.Set(DeduplicationIDMetadataKey, deduplicationID)
+	}
+}
+
+// NewMessageGroupPartitioner returns a Partitioner assigning the messages of every message group
+// (see MessageGroupIDMetadataKey) to one partition, so the groups are consumed concurrently, and in order.
+func NewMessageGroupPartitioner() HashPartitioner {
+	return HashPartitioner{MetadataKey: MessageGroupIDMetadataKey}
+}
+
+// PublishDeduplicator filters out the published messages which were already published (see PublisherConfig.Deduplicator).
+// It's called in the transaction inserting the messages, so the messages are deduplicated atomically.
+//
+// ImportDeduplicator implementations (like UUIDImportDeduplicator) may be used as PublishDeduplicator as well.
+type PublishDeduplicator interface {
+	// Deduplicate returns the messages which should be inserted to the topic.
+	Deduplicate(ctx context.Context, db QueryExecutor, topic string, msgs message.Messages) (message.Messages, error)
+}
+
+// SQLiteFIFODeduplicator is a PublishDeduplicator skipping messages with a deduplication ID (see DeduplicationIDMetadataKey)
+// which was published to the topic within Window, like SQS FIFO queues. The deduplication IDs are stored in a SQLite table
+// in the database of the messages.
+//
+// Expired deduplication IDs are not used for detecting duplicates, but they should be deleted periodically
+// with DeleteExpired.
+type SQLiteFIFODeduplicator struct {
+	// Window is the time for which deduplication IDs are remembered.
+	//
+	// Default value is DefaultDeduplicationWindow.
+	Window time.Duration
+
+	// ContentBasedDeduplication uses the SHA-256 hash of the payload as the deduplication ID
+	// of messages without DeduplicationIDMetadataKey. Otherwise, such messages are never skipped.
+	ContentBasedDeduplication bool
+
+	// TableName may be used to override the name of the table. The name should not be quoted.
+	//
+	// Default value is watermill_deduplication_ids.
+	TableName string
+}
+
+// InitializeSchema creates the table storing the deduplication IDs, if it doesn't exist yet.
+func (d SQLiteFIFODeduplicator) InitializeSchema(ctx context.Context, db QueryExecutor) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+d.table()+` (
+		"topic" TEXT NOT NULL,
+		"deduplication_id" TEXT NOT NULL,
+		"published_at" INTEGER NOT NULL,
+		PRIMARY KEY ("topic", "deduplication_id")
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "could not create deduplication ids table")
+	}
+
+	return nil
+}
+
+func (d SQLiteFIFODeduplicator) Deduplicate(
+	ctx context.Context,
+	db QueryExecutor,
+	topic string,
+	msgs message.Messages,
+) (message.Messages, error) {
+	now := time.Now()
+	published := map[string]struct{}{}
+
+	var deduplicated message.Messages
+	for _, msg := range msgs {
+		deduplicationID := d.deduplicationID(msg)
+		if deduplicationID == "" {
+			deduplicated = append(deduplicated, msg)
+			continue
+		}
+
+		if _, ok := published[deduplicationID]; ok {
+			continue
+		}
+
+		duplicate, err := d.isPublished(ctx, db, topic, deduplicationID, now)
+		if err != nil {
+			return nil, err
+		}
+		if duplicate {
+			continue
+		}
+
+		_, err = db.ExecContext(
+			ctx,
+			`INSERT INTO `+d.table()+` ("topic", "deduplication_id", "published_at") VALUES (?, ?, ?)
+			ON CONFLICT ("topic", "deduplication_id") DO UPDATE SET "published_at" = excluded."published_at"`,
+			topic, deduplicationID, now.UnixMilli(),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not store deduplication id")
+		}
+
+		published[deduplicationID] = struct{}{}
+		deduplicated = append(deduplicated, msg)
+	}
+
+	return deduplicated, nil
+}
+
+func (d SQLiteFIFODeduplicator) isPublished(
+	ctx context.Context,
+	db QueryExecutor,
+	topic string,
+	deduplicationID string,
+	now time.Time,
+) (bool, error) {
+	rows, err := db.QueryContext(
+		ctx,
+		`SELECT 1 FROM `+d.table()+` WHERE "topic" = ? AND "deduplication_id" = ? AND "published_at" > ?`,
+		topic, deduplicationID, now.Add(-d.window()).UnixMilli(),
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "could not query deduplication id")
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
+// DeleteExpired deletes the deduplication IDs published before the window. It returns the number of deleted IDs.
+func (d SQLiteFIFODeduplicator) DeleteExpired(ctx context.Context, db QueryExecutor) (int64, error) {
+	result, err := db.ExecContext(
+		ctx,
+		`DELETE FROM `+d.table()+` WHERE "published_at" <= ?`,
+		time.Now().Add(-d.window()).UnixMilli(),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not delete expired deduplication ids")
+	}
+
+	return result.RowsAffected()
+}
+
+func (d SQLiteFIFODeduplicator) deduplicationID(msg *message.Message) string {
+	if deduplicationID := msg.Metadata.Get(DeduplicationIDMetadataKey); deduplicationID != "" {
+		return deduplicationID
+	}
+	if !d.ContentBasedDeduplication {
+		return ""
+	}
+
+	hash := sha256.Sum256(msg.Payload)
+	return hex.EncodeToString(hash[:])
+}
+
+func (d SQLiteFIFODeduplicator) window() time.Duration {
+	if d.Window > 0 {
+		return d.Window
+	}
+	return DefaultDeduplicationWindow
+}
+
+func (d SQLiteFIFODeduplicator) table() string {
+	if d.TableName != "" {
+		return fmt.Sprintf(`"%s"`, d.TableName)
+	}
+	return `"watermill_deduplication_ids"`
+}
@@ -0,0 +1,73 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteFIFODeduplicator(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "fifo.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topic := "fifo_" + watermill.NewShortUUID()
+
+	deduplicator := sql.SQLiteFIFODeduplicator{
+		Window:                    time.Millisecond * 200,
+		ContentBasedDeduplication: true,
+	}
+	require.NoError(t, deduplicator.InitializeSchema(ctx, db))
+
+	publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+		Deduplicator:         deduplicator,
+	}, logger)
+	require.NoError(t, err)
+
+	newMessage := func(payload string, deduplicationID string) *message.Message {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(payload))
+		sql.SetFIFO(msg, "group", deduplicationID)
+		return msg
+	}
+
+	published := func() []string {
+		rows, err := sqlDB.Query(`SELECT payload FROM "watermill_` + topic + `" ORDER BY "offset"`)
+		require.NoError(t, err)
+		defer rows.Close()
+
+		var payloads []string
+		for rows.Next() {
+			var payload string
+			require.NoError(t, rows.Scan(&payload))
+			payloads = append(payloads, payload)
+		}
+		return payloads
+	}
+
+	require.NoError(t, publisher.Publish(topic, newMessage("1", "a"), newMessage("2", "a"), newMessage("3", "b")))
+	require.NoError(t, publisher.Publish(topic, newMessage("4", "a"), newMessage("5", "")))
+	// The content of message 5 was already published.
+	require.NoError(t, publisher.Publish(topic, newMessage("5", "")))
+	assert.Equal(t, []string{"1", "3", "5"}, published())
+
+	time.Sleep(time.Millisecond * 300)
+
+	expired, err := deduplicator.DeleteExpired(ctx, db)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, expired)
+
+	require.NoError(t, publisher.Publish(topic, newMessage("6", "a")))
+	assert.Equal(t, []string{"1", "3", "5", "6"}, published())
+}
@@ -0,0 +1,129 @@
+package sql
+
+import (
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// GeneratedQuery is a query generated by an adapter, returned by GenerateQueries.
+type GeneratedQuery struct {
+	// Method is the name of the adapter's method which generated the query, like "SchemaAdapter.SelectQuery".
+	Method string
+
+	Query Query
+}
+
+// GenerateQueries returns all queries which the schema and offsets adapters would generate for the topic
+// and the consumer group, without executing them. Queries of the optional interfaces (like RetainingSchemaAdapter
+// or CheckpointingOffsetsAdapter) are included when the adapters implement them.
+//
+// Queries using a message or an offset are generated for a sample message with offset 1.
+// It may be used in tests or CI to inspect the generated SQL, for example, by preparing every query
+// against the target database or comparing the queries with golden files.
+func GenerateQueries(
+	schemaAdapter SchemaAdapter,
+	offsetsAdapter OffsetsAdapter,
+	topic string,
+	consumerGroup string,
+) ([]GeneratedQuery, error) {
+	if err := validateTopic(schemaAdapter, topic); err != nil {
+		return nil, err
+	}
+
+	msg := message.NewMessage("00000000-0000-0000-0000-000000000000", []byte(`{}`))
+	row := Row{Offset: 1, UUID: []byte(msg.UUID), Payload: msg.Payload, Metadata: []byte(`{}`), Msg: msg}
+
+	var queries []GeneratedQuery
+	add := func(method string, generated ...Query) {
+		for _, q := range generated {
+			queries = append(queries, GeneratedQuery{Method: method, Query: q})
+		}
+	}
+
+	add("SchemaAdapter.SchemaInitializingQueries", schemaAdapter.SchemaInitializingQueries(topic)...)
+	add("OffsetsAdapter.SchemaInitializingQueries", offsetsAdapter.SchemaInitializingQueries(topic)...)
+	add("OffsetsAdapter.BeforeSubscribingQueries", offsetsAdapter.BeforeSubscribingQueries(topic, consumerGroup)...)
+
+	if chainAdapter, ok := schemaAdapter.(HashChainSchemaAdapter); ok {
+		add("HashChainSchemaAdapter.LastRowHashQuery", chainAdapter.LastRowHashQuery(topic))
+
+		insertQuery, err := chainAdapter.InsertChainedQuery(topic, message.Messages{msg}, make([]byte, 32))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not generate chained insert query")
+		}
+		add("HashChainSchemaAdapter.InsertChainedQuery", insertQuery)
+		add("HashChainSchemaAdapter.ChainQuery", chainAdapter.ChainQuery(topic, 0, 1000))
+	} else {
+		insertQuery, err := schemaAdapter.InsertQuery(topic, message.Messages{msg})
+		if err != nil {
+			return nil, errors.Wrap(err, "could not generate insert query")
+		}
+		add("SchemaAdapter.InsertQuery", insertQuery)
+	}
+
+	if createdAtAdapter, ok := schemaAdapter.(CreatedAtSchemaAdapter); ok {
+		insertQuery, err := createdAtAdapter.InsertWithCreatedAtQuery(topic, message.Messages{msg}, []time.Time{time.Unix(0, 0).UTC()})
+		if err != nil {
+			return nil, errors.Wrap(err, "could not generate insert with created_at query")
+		}
+		add("CreatedAtSchemaAdapter.InsertWithCreatedAtQuery", insertQuery)
+	}
+
+	add("SchemaAdapter.SelectQuery", schemaAdapter.SelectQuery(topic, consumerGroup, offsetsAdapter))
+	add("OffsetsAdapter.NextOffsetQuery", offsetsAdapter.NextOffsetQuery(topic, consumerGroup))
+
+	if consumedQuery := offsetsAdapter.ConsumedMessageQuery(topic, row, consumerGroup, make([]byte, 16)); !consumedQuery.IsZero() {
+		add("OffsetsAdapter.ConsumedMessageQuery", consumedQuery)
+	}
+	add("OffsetsAdapter.AckMessageQuery", offsetsAdapter.AckMessageQuery(topic, row, consumerGroup))
+
+	if nonTransactionalAdapter, ok := offsetsAdapter.(NonTransactionalOffsetsAdapter); ok {
+		if releaseQuery := nonTransactionalAdapter.ReleaseMessageQuery(topic, row, consumerGroup); !releaseQuery.IsZero() {
+			add("NonTransactionalOffsetsAdapter.ReleaseMessageQuery", releaseQuery)
+		}
+	}
+
+	if reconcilingAdapter, ok := offsetsAdapter.(ReconcilingOffsetsAdapter); ok {
+		add("ReconcilingOffsetsAdapter.OrphanedOffsetsQuery", reconcilingAdapter.OrphanedOffsetsQuery(topic))
+		add("ReconcilingOffsetsAdapter.ResetConsumedOffsetQuery", reconcilingAdapter.ResetConsumedOffsetQuery(topic, consumerGroup, row.Offset))
+	}
+
+	if checkpointingAdapter, ok := offsetsAdapter.(CheckpointingOffsetsAdapter); ok {
+		add("CheckpointingOffsetsAdapter.ConsumerGroupOffsetsQuery", checkpointingAdapter.ConsumerGroupOffsetsQuery(topic))
+		add("CheckpointingOffsetsAdapter.SetAckedOffsetQueries", checkpointingAdapter.SetAckedOffsetQueries(topic, consumerGroup, row.Offset)...)
+	}
+
+	if deletingAdapter, ok := offsetsAdapter.(ConsumerGroupDeletingOffsetsAdapter); ok {
+		add("ConsumerGroupDeletingOffsetsAdapter.DeleteConsumerGroupQueries", deletingAdapter.DeleteConsumerGroupQueries(topic, consumerGroup)...)
+	}
+
+	if retainingAdapter, ok := schemaAdapter.(RetainingSchemaAdapter); ok {
+		add("RetainingSchemaAdapter.DeleteMessagesQuery", retainingAdapter.DeleteMessagesQuery(topic, row.Offset))
+	}
+
+	if groupingAdapter, ok := schemaAdapter.(BatchGroupingSchemaAdapter); ok {
+		add("BatchGroupingSchemaAdapter.BatchMessagesQuery", groupingAdapter.BatchMessagesQuery(topic, "batch"))
+	}
+
+	if updatingAdapter, ok := schemaAdapter.(UpdatingSchemaAdapter); ok {
+		updateQuery, err := updatingAdapter.UpdateMessageQuery(topic, row.Offset, msg)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not generate update query")
+		}
+		add("UpdatingSchemaAdapter.UpdateMessageQuery", updateQuery)
+	}
+
+	if businessKeyAdapter, ok := schemaAdapter.(BusinessKeySchemaAdapter); ok {
+		for _, metadataKey := range businessKeys(schemaAdapter) {
+			findQuery, err := businessKeyAdapter.FindQuery(topic, metadataKey, "value")
+			if err != nil {
+				return nil, errors.Wrap(err, "could not generate find query")
+			}
+			add("BusinessKeySchemaAdapter.FindQuery", findQuery)
+		}
+	}
+
+	return queries, nil
+}
@@ -0,0 +1,71 @@
+package sql_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGenerateQueries checks if all queries generated by the SQLite adapters can be prepared by SQLite.
+func TestGenerateQueries(t *testing.T) {
+	db := newSQLite(t)
+
+	testCases := []struct {
+		Name           string
+		SchemaAdapter  sql.SchemaAdapter
+		OffsetsAdapter sql.OffsetsAdapter
+	}{
+		{
+			Name:           "sqlite",
+			SchemaAdapter:  sql.DefaultSQLiteSchema{},
+			OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+		},
+		{
+			Name:           "d1",
+			SchemaAdapter:  sql.DefaultSQLiteSchema{},
+			OffsetsAdapter: sql.DefaultD1OffsetsAdapter{},
+		},
+		{
+			Name:           "dialect",
+			SchemaAdapter:  sql.DialectSchema{Dialect: sql.SQLiteDialect{}},
+			OffsetsAdapter: sql.DialectOffsetsAdapter{Dialect: sql.SQLiteDialect{}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			topic := "generate_" + watermill.NewShortUUID()
+
+			queries, err := sql.GenerateQueries(tc.SchemaAdapter, tc.OffsetsAdapter, topic, "group")
+			require.NoError(t, err)
+
+			methods := map[string]bool{}
+			for _, q := range queries {
+				methods[q.Method] = true
+
+				if strings.HasSuffix(q.Method, ".SchemaInitializingQueries") {
+					_, err := db.Exec(q.Query.Query, q.Query.Args...)
+					require.NoError(t, err, q.Method)
+				}
+			}
+
+			for _, q := range queries {
+				stmt, err := db.Prepare(q.Query.Query)
+				require.NoError(t, err, "%s: %s", q.Method, q.Query.Query)
+				require.NoError(t, stmt.Close())
+			}
+
+			assert.True(t, methods["SchemaAdapter.SelectQuery"])
+			assert.True(t, methods["OffsetsAdapter.AckMessageQuery"])
+			assert.True(t, methods["CheckpointingOffsetsAdapter.ConsumerGroupOffsetsQuery"])
+			assert.True(t, methods["RetainingSchemaAdapter.DeleteMessagesQuery"])
+		})
+	}
+
+	_, err := sql.GenerateQueries(sql.DefaultSQLiteSchema{}, sql.DefaultSQLiteOffsetsAdapter{}, "invalid topic", "group")
+	assert.ErrorIs(t, err, sql.ErrInvalidTopicName)
+}
@@ -0,0 +1,119 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// groupCommit is the transaction of a subscription, which is kept open over multiple batches
+// until GroupCommitMessages messages were acked or GroupCommitInterval elapsed (see SubscriberConfig).
+type groupCommit struct {
+	tx        Tx
+	startedAt time.Time
+	messages  int
+
+	// lastAcked is the last message acked in the transaction.
+	lastAcked *Row
+
+	// nextOffset outlives the transaction, but it's invalidated when the transaction is not committed,
+	// as the acks of the cached offset are lost.
+	nextOffset nextOffsetCache
+
+	catchUpProgress *CatchUpProgress
+
+	// auditedUUIDs are the UUIDs of the messages acked in the transaction, recorded by AuditSink after the commit.
+	auditedUUIDs []string
+}
+
+func (s *Subscriber) groupsCommits() bool {
+	return s.config.GroupCommitMessages > 0 || s.config.GroupCommitInterval > 0
+}
+
+// beginQueryTx returns the open transaction of the group commit, or begins a new one.
+// The transaction outlives ctx (see beginDetachedTx).
+func (s *Subscriber) beginQueryTx(ctx context.Context, commit *groupCommit) (Tx, error) {
+	if commit.tx != nil {
+		return commit.tx, nil
+	}
+
+	txOptions := &sql.TxOptions{
+		Isolation: s.config.SchemaAdapter.SubscribeIsolationLevel(),
+	}
+	tx, err := beginDetachedTx(ctx, s.txProvider(), txOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not begin tx for querying")
+	}
+
+	commit.tx = tx
+	commit.startedAt = time.Now()
+	commit.messages = 0
+	commit.lastAcked = nil
+	commit.catchUpProgress = nil
+
+	return tx, nil
+}
+
+// commitDue returns true if the transaction should be committed after the batch. Without group commits,
+// every batch is committed. Transactions are committed also when no messages were selected,
+// so acks are not delayed while the subscriber waits for new messages.
+func (s *Subscriber) commitDue(commit *groupCommit, noMsg bool) bool {
+	if !s.groupsCommits() || noMsg {
+		return true
+	}
+	if s.config.GroupCommitMessages > 0 && commit.messages >= s.config.GroupCommitMessages {
+		return true
+	}
+	if s.config.GroupCommitInterval > 0 && time.Since(commit.startedAt) >= s.config.GroupCommitInterval {
+		return true
+	}
+
+	return false
+}
+
+func (s *Subscriber) commitQueryTx(ctx context.Context, topic string, commit *groupCommit, logger watermill.LoggerAdapter) {
+	if commit.tx == nil {
+		return
+	}
+
+	tx, catchUpProgress, auditedUUIDs := commit.tx, commit.catchUpProgress, commit.auditedUUIDs
+	commit.tx = nil
+	commit.catchUpProgress = nil
+	commit.auditedUUIDs = nil
+
+	commitErr := tx.Commit()
+	if commitErr != nil && commitErr != sql.ErrTxDone {
+		commit.nextOffset.invalidate()
+		logger.Error("could not commit tx for querying message", commitErr, nil)
+		s.events.emit(AckFailed{Topic: topic, Err: commitErr})
+		return
+	}
+
+	if catchUpProgress != nil {
+		s.reportCatchUpProgress(*catchUpProgress, logger)
+	}
+	s.recordAcked(ctx, topic, auditedUUIDs, logger)
+}
+
+// rollbackQueryTx rolls back the transaction, including the acks of the previous batches of the group commit.
+func (s *Subscriber) rollbackQueryTx(commit *groupCommit, queryErr error, logger watermill.LoggerAdapter) {
+	if commit.tx == nil {
+		return
+	}
+
+	tx := commit.tx
+	commit.tx = nil
+	commit.catchUpProgress = nil
+	commit.auditedUUIDs = nil
+	commit.nextOffset.invalidate()
+
+	rollbackErr := tx.Rollback()
+	if rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+		logger.Error("could not rollback tx for querying message", rollbackErr, watermill.LogFields{
+			"query_err": queryErr,
+		})
+	}
+}
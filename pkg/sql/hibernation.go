@@ -0,0 +1,117 @@
+package sql
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// topicHibernation tracks how long a subscription has been polling a topic without new messages.
+type topicHibernation struct {
+	idleSince   time.Time
+	hibernating bool
+}
+
+// subscriberWakers keeps the wake channels of running subscriptions, by topics.
+type subscriberWakers struct {
+	topics map[string]map[chan struct{}]struct{}
+	lock   sync.Mutex
+}
+
+func newSubscriberWakers() *subscriberWakers {
+	return &subscriberWakers{
+		topics: map[string]map[chan struct{}]struct{}{},
+	}
+}
+
+func (w *subscriberWakers) register(topic string) chan struct{} {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	wake := make(chan struct{}, 1)
+	if _, ok := w.topics[topic]; !ok {
+		w.topics[topic] = map[chan struct{}]struct{}{}
+	}
+	w.topics[topic][wake] = struct{}{}
+
+	return wake
+}
+
+func (w *subscriberWakers) unregister(topic string, wake chan struct{}) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	delete(w.topics[topic], wake)
+	if len(w.topics[topic]) == 0 {
+		delete(w.topics, topic)
+	}
+}
+
+func (w *subscriberWakers) wake(topic string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for wake := range w.topics[topic] {
+		select {
+		case wake <- struct{}{}:
+		default:
+			// The subscription was already woken and didn't query yet.
+		}
+	}
+}
+
+// Wake makes the subscriptions of the topic query it immediately, instead of waiting for the next poll.
+// It's the hook for notifiers of new messages (like LISTEN/NOTIFY of PostgreSQL, or a publisher
+// in the same process), which is especially useful for topics hibernated after SubscriberConfig.HibernateAfter.
+func (s *Subscriber) Wake(topic string) {
+	s.wakers.wake(topic)
+}
+
+// hibernationBackoff returns the wait before the next query, which is HibernationInterval for topics
+// without new messages for HibernateAfter.
+func (s *Subscriber) hibernationBackoff(
+	topic string,
+	hibernation *topicHibernation,
+	noMsg bool,
+	err error,
+	backoff time.Duration,
+	logger watermill.LoggerAdapter,
+) time.Duration {
+	if s.config.HibernateAfter == 0 || err != nil {
+		return backoff
+	}
+
+	if !noMsg {
+		s.wakeUp(topic, hibernation, logger)
+		return backoff
+	}
+
+	if hibernation.idleSince.IsZero() {
+		hibernation.idleSince = time.Now()
+	}
+	if time.Since(hibernation.idleSince) < s.config.HibernateAfter {
+		return backoff
+	}
+
+	if !hibernation.hibernating {
+		hibernation.hibernating = true
+		logger.Debug("Topic hibernated", watermill.LogFields{
+			"hibernation_interval": s.config.HibernationInterval,
+		})
+		s.events.emit(TopicHibernated{Topic: topic, ConsumerGroup: s.config.ConsumerGroup})
+	}
+
+	return s.jitter(s.config.HibernationInterval)
+}
+
+func (s *Subscriber) wakeUp(topic string, hibernation *topicHibernation, logger watermill.LoggerAdapter) {
+	hibernation.idleSince = time.Time{}
+	if !hibernation.hibernating {
+		return
+	}
+
+	hibernation.hibernating = false
+	logger.Debug("Topic woken up", nil)
+	s.events.emit(TopicWoken{Topic: topic, ConsumerGroup: s.config.ConsumerGroup})
+}
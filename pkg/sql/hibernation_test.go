@@ -0,0 +1,79 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_Hibernation(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topicName := "hibernated_" + watermill.NewShortUUID()
+
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:       "hibernation",
+		SchemaAdapter:       sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:      sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema:    true,
+		PollInterval:        time.Millisecond * 10,
+		HibernateAfter:      time.Millisecond * 50,
+		HibernationInterval: time.Hour,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	events := subscriber.Events()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumed, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	waitForEvent := func(match func(sql.Event) bool) {
+		for {
+			select {
+			case event := <-events:
+				if match(event) {
+					return
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatal("event was not emitted")
+			}
+		}
+	}
+
+	waitForEvent(func(event sql.Event) bool {
+		_, ok := event.(sql.TopicHibernated)
+		return ok
+	})
+
+	require.NoError(t, publisher.Publish(topicName, message.NewMessage(watermill.NewUUID(), nil)))
+
+	select {
+	case <-consumed:
+		t.Fatal("hibernated topic should not be queried before the hibernation interval")
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	subscriber.Wake(topicName)
+
+	select {
+	case msg := <-consumed:
+		msg.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("woken topic should be queried immediately")
+	}
+
+	waitForEvent(func(event sql.Event) bool {
+		_, ok := event.(sql.TopicWoken)
+		return ok
+	})
+}
@@ -0,0 +1,262 @@
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// ErrIdempotencyTokenReused is returned by Publisher.PublishIdempotent when the token was already used
+// to publish different messages (or to a different topic).
+var ErrIdempotencyTokenReused = errors.New("idempotency token was used with different messages")
+
+// errIdempotencyTokenRecorded is returned by IdempotencyStore.SaveResult implementations of this package
+// when a concurrent call recorded the token first, so the transaction is retried and returns its result.
+var errIdempotencyTokenRecorded = errors.New("idempotency token was recorded concurrently")
+
+// IdempotentPublishResult is the result of Publisher.PublishIdempotent, recorded for the token,
+// so the same result is returned when the call is retried.
+type IdempotentPublishResult struct {
+	Topic string
+
+	// MessageUUIDs are the UUIDs of the messages published by the first call with the token, in order.
+	MessageUUIDs []string
+
+	// PublishedAt is when the messages were published by the first call with the token.
+	PublishedAt time.Time
+
+	// RequestHash is the hash of the topic and messages of the first call,
+	// used to detect reusing the token for different messages.
+	RequestHash string
+
+	// Replayed is true if the messages were published by a previous call with the token,
+	// so they were not published again. It's not stored.
+	Replayed bool
+}
+
+// IdempotencyStore records the results of Publisher.PublishIdempotent by their tokens (see PublisherConfig.IdempotencyStore).
+// It's called in the transaction inserting the messages, so the token is recorded atomically with them.
+type IdempotencyStore interface {
+	// LoadResult returns the result recorded for the token, or false if the token was not used yet.
+	LoadResult(ctx context.Context, db QueryExecutor, token string) (IdempotentPublishResult, bool, error)
+
+	// SaveResult records the result for the token.
+	SaveResult(ctx context.Context, db QueryExecutor, token string, result IdempotentPublishResult) error
+}
+
+// PublishIdempotent publishes the messages once per token, for producers which retry publishing whole batches,
+// so they can't rely only on deduplicating messages by UUIDs (for example, when UUIDs are generated per attempt).
+// The token is recorded in IdempotencyStore in the transaction inserting the messages. When the call is retried
+// with the token, the messages are not published again, and the result of the first call is returned.
+//
+// The token may be reused only with the same topic and the same messages (compared by UUIDs and payloads),
+// otherwise ErrIdempotencyTokenReused is returned. The database handle must be able to begin transactions,
+// or be a transaction, or TxProvider must be set.
+func (p *Publisher) PublishIdempotent(
+	ctx context.Context,
+	token string,
+	topic string,
+	messages ...*message.Message,
+) (IdempotentPublishResult, error) {
+	if p.closed {
+		return IdempotentPublishResult{}, ErrPublisherClosed
+	}
+	if p.config.IdempotencyStore == nil {
+		return IdempotentPublishResult{}, errors.New("publishing idempotently requires IdempotencyStore")
+	}
+	if token == "" {
+		return IdempotentPublishResult{}, errors.New("idempotency token is empty")
+	}
+
+	p.publishWg.Add(1)
+	defer p.publishWg.Done()
+
+	requestHash := idempotentRequestHash(topic, messages)
+
+	insertedMessages, err := p.prepareMessages(topic, messages)
+	if err != nil {
+		return IdempotentPublishResult{}, err
+	}
+
+	options := RunInTxOptions{
+		IsRetryable: func(err error) bool {
+			return errors.Is(err, errIdempotencyTokenRecorded) || IsRetryableTxError(err)
+		},
+	}
+
+	var result IdempotentPublishResult
+	err = p.inTxWithOptions(ctx, options, func(ctx context.Context, db QueryExecutor) error {
+		recorded, found, err := p.config.IdempotencyStore.LoadResult(ctx, db, token)
+		if err != nil {
+			return errors.Wrap(err, "could not load idempotent publish result")
+		}
+		if found {
+			if recorded.RequestHash != requestHash {
+				return ErrIdempotencyTokenReused
+			}
+			result = recorded
+			result.Replayed = true
+			return nil
+		}
+
+		if err := p.insertMessages(ctx, db, topic, messages, insertedMessages); err != nil {
+			return err
+		}
+
+		result = IdempotentPublishResult{
+			Topic:        topic,
+			MessageUUIDs: make([]string, len(messages)),
+			PublishedAt:  time.Now().UTC(),
+			RequestHash:  requestHash,
+		}
+		for i, msg := range messages {
+			result.MessageUUIDs[i] = msg.UUID
+		}
+
+		if err := p.config.IdempotencyStore.SaveResult(ctx, db, token, result); err != nil {
+			return errors.Wrap(err, "could not save idempotent publish result")
+		}
+		return nil
+	})
+	if err != nil {
+		p.events.emit(PublishFailed{Topic: topic, Err: err})
+		return IdempotentPublishResult{}, err
+	}
+
+	if !result.Replayed {
+		p.messagesPublished(ctx, topic, messages)
+	}
+
+	return result, nil
+}
+
+// idempotentRequestHash returns the hash of the topic, and the UUIDs and payloads of the messages.
+// Metadata is not hashed, as the publisher sets metadata of the messages (like causality metadata).
+func idempotentRequestHash(topic string, messages message.Messages) string {
+	h := sha256.New()
+	fields := [][]byte{[]byte(topic)}
+	for _, msg := range messages {
+		fields = append(fields, []byte(msg.UUID), msg.Payload)
+	}
+	for _, field := range fields {
+		// Lengths prefix the fields, so bytes can't be moved between them.
+		_ = binary.Write(h, binary.BigEndian, uint64(len(field)))
+		h.Write(field)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SQLiteIdempotencyStore is an IdempotencyStore storing the results in a SQLite table in the database of the messages.
+//
+// Results are kept until they are deleted with DeleteExpired, so tokens should be retried only within
+// the retention passed to it.
+type SQLiteIdempotencyStore struct {
+	// TableName may be used to override the name of the table. The name should not be quoted.
+	//
+	// Default value is watermill_idempotency_tokens.
+	TableName string
+}
+
+// InitializeSchema creates the table storing the results, if it doesn't exist yet.
+func (s SQLiteIdempotencyStore) InitializeSchema(ctx context.Context, db QueryExecutor) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table()+` (
+		"token" TEXT NOT NULL PRIMARY KEY,
+		"topic" TEXT NOT NULL,
+		"message_uuids" TEXT NOT NULL,
+		"request_hash" TEXT NOT NULL,
+		"published_at" INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "could not create idempotency tokens table")
+	}
+
+	return nil
+}
+
+func (s SQLiteIdempotencyStore) LoadResult(
+	ctx context.Context,
+	db QueryExecutor,
+	token string,
+) (IdempotentPublishResult, bool, error) {
+	rows, err := db.QueryContext(
+		ctx,
+		`SELECT "topic", "message_uuids", "request_hash", "published_at" FROM `+s.table()+` WHERE "token" = ?`,
+		token,
+	)
+	if err != nil {
+		return IdempotentPublishResult{}, false, errors.Wrap(err, "could not query idempotency token")
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return IdempotentPublishResult{}, false, rows.Err()
+	}
+
+	var result IdempotentPublishResult
+	var messageUUIDs string
+	var publishedAt int64
+	if err := rows.Scan(&result.Topic, &messageUUIDs, &result.RequestHash, &publishedAt); err != nil {
+		return IdempotentPublishResult{}, false, errors.Wrap(err, "could not scan idempotency token")
+	}
+	if err := json.Unmarshal([]byte(messageUUIDs), &result.MessageUUIDs); err != nil {
+		return IdempotentPublishResult{}, false, errors.Wrap(err, "could not unmarshal message uuids")
+	}
+	result.PublishedAt = time.UnixMilli(publishedAt).UTC()
+
+	return result, true, rows.Err()
+}
+
+func (s SQLiteIdempotencyStore) SaveResult(
+	ctx context.Context,
+	db QueryExecutor,
+	token string,
+	result IdempotentPublishResult,
+) error {
+	messageUUIDs, err := json.Marshal(result.MessageUUIDs)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal message uuids")
+	}
+
+	_, err = db.ExecContext(
+		ctx,
+		`INSERT INTO `+s.table()+` ("token", "topic", "message_uuids", "request_hash", "published_at") VALUES (?, ?, ?, ?, ?)`,
+		token, result.Topic, string(messageUUIDs), result.RequestHash, result.PublishedAt.UnixMilli(),
+	)
+	if ClassifyError(err) == ErrDuplicate {
+		return errIdempotencyTokenRecorded
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not store idempotency token")
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes the results published before the retention. It returns the number of deleted results.
+func (s SQLiteIdempotencyStore) DeleteExpired(ctx context.Context, db QueryExecutor, retention time.Duration) (int64, error) {
+	result, err := db.ExecContext(
+		ctx,
+		`DELETE FROM `+s.table()+` WHERE "published_at" <= ?`,
+		time.Now().Add(-retention).UnixMilli(),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not delete expired idempotency tokens")
+	}
+
+	return result.RowsAffected()
+}
+
+func (s SQLiteIdempotencyStore) table() string {
+	if s.TableName != "" {
+		return fmt.Sprintf(`"%s"`, s.TableName)
+	}
+	return `"watermill_idempotency_tokens"`
+}
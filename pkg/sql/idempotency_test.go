@@ -0,0 +1,82 @@
+package sql_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher_PublishIdempotent(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := newSQLite(t)
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topicName := "idempotent_" + watermill.NewShortUUID()
+	schemaAdapter := newSQLiteSchemaAdapter(0)
+
+	store := sql.SQLiteIdempotencyStore{TableName: "idempotency_" + watermill.NewShortUUID()}
+	require.NoError(t, store.InitializeSchema(ctx, db))
+
+	publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+		SchemaAdapter:        schemaAdapter,
+		AutoInitializeSchema: true,
+		IdempotencyStore:     store,
+	}, logger)
+	require.NoError(t, err)
+
+	uuids := []string{watermill.NewUUID(), watermill.NewUUID()}
+	batch := func(payload string) []*message.Message {
+		return []*message.Message{
+			message.NewMessage(uuids[0], []byte(payload)),
+			message.NewMessage(uuids[1], []byte(payload)),
+		}
+	}
+	countMessages := func() int {
+		var count int
+		require.NoError(t, sqlDB.QueryRow(`SELECT COUNT(*) FROM `+schemaAdapter.MessagesTable(topicName)).Scan(&count))
+		return count
+	}
+
+	first, err := publisher.PublishIdempotent(ctx, "order-1", topicName, batch("a")...)
+	require.NoError(t, err)
+	assert.False(t, first.Replayed)
+	assert.Equal(t, uuids, first.MessageUUIDs)
+	assert.Equal(t, topicName, first.Topic)
+
+	retried, err := publisher.PublishIdempotent(ctx, "order-1", topicName, batch("a")...)
+	require.NoError(t, err)
+	assert.True(t, retried.Replayed)
+	assert.Equal(t, first.MessageUUIDs, retried.MessageUUIDs)
+	assert.Equal(t, first.PublishedAt.UnixMilli(), retried.PublishedAt.UnixMilli())
+	assert.Equal(t, 2, countMessages(), "retried messages should not be published again")
+
+	_, err = publisher.PublishIdempotent(ctx, "order-1", topicName, batch("b")...)
+	assert.ErrorIs(t, err, sql.ErrIdempotencyTokenReused)
+
+	var wg sync.WaitGroup
+	results := make([]sql.IdempotentPublishResult, 5)
+	errs := make([]error, len(results))
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = publisher.PublishIdempotent(ctx, "order-2", topicName, batch("c")...)
+		}(i)
+	}
+	wg.Wait()
+
+	published := 0
+	for i := range results {
+		require.NoError(t, errs[i])
+		if !results[i].Replayed {
+			published++
+		}
+	}
+	assert.Equal(t, 1, published, "concurrent calls should publish the messages once")
+	assert.Equal(t, 4, countMessages())
+}
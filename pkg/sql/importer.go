@@ -0,0 +1,352 @@
+package sql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+type ImporterConfig struct {
+	// SourceSchemaAdapter reads the messages from the source database. It's required.
+	//
+	// Messages are read with SelectQuery, using the last imported offset as the next offset,
+	// so the schema adapter must compare offsets with the result of NextOffsetQuery
+	// (DefaultPostgreSQLSchema is not supported, as it also compares transaction IDs).
+	SourceSchemaAdapter SchemaAdapter
+
+	// DestinationSchemaAdapter writes the messages to the destination database. It's required.
+	// The messages are assigned new offsets by the destination, their UUIDs and metadata are preserved.
+	DestinationSchemaAdapter SchemaAdapter
+
+	// Deduplicator may be used to skip messages which already exist in the destination,
+	// so the same source can be imported multiple times (see UUIDImportDeduplicator).
+	Deduplicator ImportDeduplicator
+
+	// InsertBatchSize is the maximum number of messages inserted with one query.
+	// It should be lowered for databases limiting the number of query parameters (like Cloudflare D1).
+	//
+	// Default value is 100.
+	InsertBatchSize int
+
+	// InitializeSchema enables initialization of the destination schema before importing.
+	InitializeSchema bool
+}
+
+func (c *ImporterConfig) setDefaults() {
+	if c.InsertBatchSize == 0 {
+		c.InsertBatchSize = 100
+	}
+}
+
+func (c ImporterConfig) validate() error {
+	if c.SourceSchemaAdapter == nil {
+		return errors.New("source schema adapter is nil")
+	}
+	if c.DestinationSchemaAdapter == nil {
+		return errors.New("destination schema adapter is nil")
+	}
+	if c.InsertBatchSize < 0 {
+		return errors.New("insert batch size must be positive")
+	}
+
+	return nil
+}
+
+// ImportResult describes the messages copied by Importer.
+type ImportResult struct {
+	// Imported is the number of messages inserted to the destination.
+	Imported int
+
+	// Skipped is the number of messages skipped by the Deduplicator.
+	Skipped int
+
+	// LastSourceOffset is the offset of the last message read from the source.
+	// It may be passed to ImportAfter, to import only the messages published later.
+	LastSourceOffset int64
+}
+
+// Importer copies messages of a topic from one database (or table) to another.
+//
+// It may be used to consolidate stores of edge devices (like SQLite databases) into a central database.
+// Every batch read from the source is inserted in a separate transaction of the destination,
+// so an interrupted import can be continued with ImportAfter.
+type Importer struct {
+	source      QueryExecutor
+	destination TxBeginner
+	config      ImporterConfig
+	logger      watermill.LoggerAdapter
+}
+
+func NewImporter(
+	source QueryExecutor,
+	destination TxBeginner,
+	config ImporterConfig,
+	logger watermill.LoggerAdapter,
+) (*Importer, error) {
+	if source == nil {
+		return nil, errors.New("source is nil")
+	}
+	if destination == nil {
+		return nil, errors.New("destination is nil")
+	}
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Importer{
+		source:      source,
+		destination: destination,
+		config:      config,
+		logger:      logger,
+	}, nil
+}
+
+// Import copies all messages of the source topic to the destination topic.
+func (i *Importer) Import(ctx context.Context, sourceTopic string, destinationTopic string) (ImportResult, error) {
+	return i.ImportAfter(ctx, sourceTopic, destinationTopic, 0)
+}
+
+// ImportAfter copies messages of the source topic with offsets greater than afterOffset to the destination topic.
+func (i *Importer) ImportAfter(
+	ctx context.Context,
+	sourceTopic string,
+	destinationTopic string,
+	afterOffset int64,
+) (ImportResult, error) {
+	if err := validateTopic(i.config.SourceSchemaAdapter, sourceTopic); err != nil {
+		return ImportResult{}, err
+	}
+	if err := validateTopic(i.config.DestinationSchemaAdapter, destinationTopic); err != nil {
+		return ImportResult{}, err
+	}
+
+	if i.config.InitializeSchema {
+		err := initializeSchema(ctx, destinationTopic, i.logger, i.destination, i.config.DestinationSchemaAdapter, nil)
+		if err != nil {
+			return ImportResult{}, errors.Wrap(err, "cannot initialize destination schema")
+		}
+	}
+
+	result := ImportResult{LastSourceOffset: afterOffset}
+
+	for {
+		rows, err := i.readBatch(ctx, sourceTopic, result.LastSourceOffset)
+		if err != nil {
+			return result, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		msgs := make(message.Messages, len(rows))
+		for j, row := range rows {
+			msgs[j] = row.Msg
+		}
+
+		imported, err := i.importBatch(ctx, destinationTopic, msgs)
+		if err != nil {
+			return result, err
+		}
+
+		result.Imported += imported
+		result.Skipped += len(msgs) - imported
+		for _, row := range rows {
+			// The source schema adapter may reorder messages within the batch (see MessagesOrder).
+			if row.Offset > result.LastSourceOffset {
+				result.LastSourceOffset = row.Offset
+			}
+		}
+
+		i.logger.Debug("Imported batch of messages", watermill.LogFields{
+			"source_topic":       sourceTopic,
+			"destination_topic":  destinationTopic,
+			"imported":           imported,
+			"last_source_offset": result.LastSourceOffset,
+		})
+	}
+
+	return result, nil
+}
+
+func (i *Importer) readBatch(ctx context.Context, topic string, afterOffset int64) ([]Row, error) {
+	return readMessagesAfter(ctx, i.source, i.config.SourceSchemaAdapter, topic, afterOffset)
+}
+
+// readMessagesAfter reads the batch of messages with offsets greater than afterOffset, without consuming them.
+// The size of the batch is defined by the schema adapter.
+func readMessagesAfter(
+	ctx context.Context,
+	db QueryExecutor,
+	schemaAdapter SchemaAdapter,
+	topic string,
+	afterOffset int64,
+) ([]Row, error) {
+	selectQuery := schemaAdapter.SelectQuery(topic, "", importOffsetsAdapter{afterOffset: afterOffset})
+
+	rows, err := db.QueryContext(ctx, selectQuery.Query, selectQuery.Args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query messages")
+	}
+	defer rows.Close()
+
+	var batch []Row
+	for rows.Next() {
+		row, err := schemaAdapter.UnmarshalMessage(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not unmarshal message")
+		}
+		if row.Offset <= afterOffset {
+			return nil, errors.Errorf("query returned offset %d not greater than %d", row.Offset, afterOffset)
+		}
+
+		batch = append(batch, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not read messages")
+	}
+
+	return batch, nil
+}
+
+func (i *Importer) importBatch(ctx context.Context, topic string, msgs message.Messages) (int, error) {
+	err := runInTx(ctx, i.destination, func(ctx context.Context, tx Tx) error {
+		if i.config.Deduplicator != nil {
+			deduplicated, err := i.config.Deduplicator.Deduplicate(ctx, tx, topic, msgs)
+			if err != nil {
+				return errors.Wrap(err, "could not deduplicate messages")
+			}
+			msgs = deduplicated
+		}
+
+		for start := 0; start < len(msgs); start += i.config.InsertBatchSize {
+			end := start + i.config.InsertBatchSize
+			if end > len(msgs) {
+				end = len(msgs)
+			}
+
+			insertQuery, err := i.config.DestinationSchemaAdapter.InsertQuery(topic, msgs[start:end])
+			if err != nil {
+				return errors.Wrap(err, "cannot create insert query")
+			}
+
+			if _, err := tx.ExecContext(ctx, insertQuery.Query, insertQuery.Args...); err != nil {
+				return errors.Wrap(err, "could not insert messages")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(msgs), nil
+}
+
+// importOffsetsAdapter is passed to the schema adapter, so SelectQuery returns the messages after the offset.
+type importOffsetsAdapter struct {
+	afterOffset int64
+}
+
+func (a importOffsetsAdapter) AckMessageQuery(topic string, row Row, consumerGroup string) Query {
+	return Query{}
+}
+
+func (a importOffsetsAdapter) ConsumedMessageQuery(topic string, row Row, consumerGroup string, consumerULID []byte) Query {
+	return Query{}
+}
+
+func (a importOffsetsAdapter) NextOffsetQuery(topic, consumerGroup string) Query {
+	// The offset is inlined, as placeholders differ between databases.
+	return Query{Query: "SELECT " + strconv.FormatInt(a.afterOffset, 10)}
+}
+
+func (a importOffsetsAdapter) SchemaInitializingQueries(topic string) []Query {
+	return nil
+}
+
+func (a importOffsetsAdapter) BeforeSubscribingQueries(topic string, consumerGroup string) []Query {
+	return nil
+}
+
+// ImportDeduplicator filters out the imported messages which already exist in the destination.
+type ImportDeduplicator interface {
+	// Deduplicate returns the messages which should be inserted to the destination topic.
+	// It's called within the destination transaction inserting the messages.
+	Deduplicate(ctx context.Context, db QueryExecutor, topic string, msgs message.Messages) (message.Messages, error)
+}
+
+// UUIDImportDeduplicator skips the imported messages with UUIDs which already exist in the destination
+// messages table, or which are repeated within the imported batch.
+type UUIDImportDeduplicator struct {
+	// Dialect is the dialect of the destination database. It's required.
+	Dialect Dialect
+
+	// GenerateMessagesTableName may be used to override how the destination messages table name is generated.
+	// The returned name should be already quoted.
+	GenerateMessagesTableName func(topic string) string
+}
+
+func (d UUIDImportDeduplicator) Deduplicate(
+	ctx context.Context,
+	db QueryExecutor,
+	topic string,
+	msgs message.Messages,
+) (message.Messages, error) {
+	if len(msgs) == 0 {
+		return msgs, nil
+	}
+
+	args := make([]any, len(msgs))
+	for i, msg := range msgs {
+		args[i] = msg.UUID
+	}
+
+	query := `SELECT ` + d.Dialect.QuoteIdentifier("uuid") + ` FROM ` + d.messagesTable(topic) + `
+		WHERE ` + d.Dialect.QuoteIdentifier("uuid") + ` IN (` + strings.Join(dialectPlaceholders(d.Dialect, 1, len(msgs)), ",") + `)`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query existing messages")
+	}
+	defer rows.Close()
+
+	existing := map[string]struct{}{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			return nil, errors.Wrap(err, "could not scan existing message")
+		}
+		existing[uuid] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not read existing messages")
+	}
+
+	deduplicated := make(message.Messages, 0, len(msgs))
+	for _, msg := range msgs {
+		if _, ok := existing[msg.UUID]; ok {
+			continue
+		}
+		existing[msg.UUID] = struct{}{}
+		deduplicated = append(deduplicated, msg)
+	}
+
+	return deduplicated, nil
+}
+
+func (d UUIDImportDeduplicator) messagesTable(topic string) string {
+	if d.GenerateMessagesTableName != nil {
+		return d.GenerateMessagesTableName(topic)
+	}
+	return d.Dialect.QuoteIdentifier("watermill_" + topic)
+}
@@ -0,0 +1,96 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImporter(t *testing.T) {
+	dir := t.TempDir()
+
+	sourceDB, err := stdSQL.Open("sqlite", filepath.Join(dir, "source.sqlite"))
+	require.NoError(t, err)
+	defer sourceDB.Close()
+
+	destinationDB, err := stdSQL.Open("sqlite", filepath.Join(dir, "destination.sqlite"))
+	require.NoError(t, err)
+	defer destinationDB.Close()
+
+	sourceTopic := "edge_" + watermill.NewShortUUID()
+	destinationTopic := "central_" + watermill.NewShortUUID()
+
+	sourcePublisher, err := sql.NewPublisher(sourceDB, sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	destinationPublisher, err := sql.NewPublisher(destinationDB, sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	alreadyImported := message.NewMessage(watermill.NewUUID(), []byte("already imported"))
+	require.NoError(t, destinationPublisher.Publish(destinationTopic, alreadyImported))
+
+	var sourceMessages message.Messages
+	for i := 0; i < 5; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+		msg.Metadata.Set("index", strconv.Itoa(i))
+		sourceMessages = append(sourceMessages, msg)
+	}
+	require.NoError(t, sourcePublisher.Publish(sourceTopic, append(sourceMessages, alreadyImported)...))
+
+	importer, err := sql.NewImporter(sql.BeginnerFromStdSQL(sourceDB), sql.BeginnerFromStdSQL(destinationDB), sql.ImporterConfig{
+		SourceSchemaAdapter:      sql.DefaultSQLiteSchema{SubscribeBatchSize: 2},
+		DestinationSchemaAdapter: sql.DefaultSQLiteSchema{},
+		Deduplicator:             sql.UUIDImportDeduplicator{Dialect: sql.SQLiteDialect{}},
+		InitializeSchema:         true,
+	}, logger)
+	require.NoError(t, err)
+
+	result, err := importer.Import(context.Background(), sourceTopic, destinationTopic)
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.Imported)
+	assert.Equal(t, 1, result.Skipped)
+	assert.EqualValues(t, 6, result.LastSourceOffset)
+
+	// Importing again skips all messages.
+	result, err = importer.Import(context.Background(), sourceTopic, destinationTopic)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Imported)
+	assert.Equal(t, 6, result.Skipped)
+
+	rows, err := destinationDB.Query(`SELECT "offset", "uuid", "metadata" FROM "watermill_` + destinationTopic + `" ORDER BY "offset"`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var uuids []string
+	var metadata []string
+	for rows.Next() {
+		var offset int64
+		var uuid, md string
+		require.NoError(t, rows.Scan(&offset, &uuid, &md))
+		assert.EqualValues(t, len(uuids)+1, offset)
+		uuids = append(uuids, uuid)
+		metadata = append(metadata, md)
+	}
+	require.NoError(t, rows.Err())
+
+	require.Len(t, uuids, 6)
+	assert.Equal(t, alreadyImported.UUID, uuids[0])
+	for i, msg := range sourceMessages {
+		assert.Equal(t, msg.UUID, uuids[i+1])
+		assert.Contains(t, metadata[i+1], `"index":"`+msg.Metadata.Get("index")+`"`)
+	}
+}
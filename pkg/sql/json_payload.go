@@ -0,0 +1,72 @@
+package sql
+
+import (
+	"encoding/json"
+	"mime"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// JSONPayloadColumn is the column of the messages table storing the payloads of messages with a JSON content type
+// (see ContentTypeMetadataKey), when JSONPayloads of DefaultPostgreSQLSchema, DefaultMySQLSchema
+// or DefaultSQLiteSchema is enabled. Other payloads are stored in the binary payload column.
+//
+// The column can be queried with JSON path expressions in SQLFragments.WhereExtra, for example,
+// on PostgreSQL (jsonb):
+//
+//	payload_json @? '$.items[*] ? (@.price > 100)'
+//
+// on MySQL (JSON):
+//
+//	JSON_EXTRACT(payload_json, '$.country') = 'PL'
+//
+// and on SQLite (TEXT queried with JSON functions):
+//
+//	json_extract("payload_json", '$.country') = 'PL'
+//
+// Messages without JSON payloads have NULL in the column, so they don't match such predicates.
+const JSONPayloadColumn = "payload_json"
+
+// isJSONContentType returns true for application/json and the media types with the +json suffix,
+// like application/cloudevents+json.
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// jsonPayloadArgs returns the values of the payload and JSON payload columns of the message.
+// Payloads which are not valid JSON are stored in the payload column, even if the content type is JSON,
+// so they're not rejected by the database.
+func jsonPayloadArgs(msg *message.Message) (payload any, jsonPayload any) {
+	if isJSONContentType(msg.Metadata.Get(ContentTypeMetadataKey)) && json.Valid(msg.Payload) {
+		return nil, string(msg.Payload)
+	}
+
+	return []byte(msg.Payload), nil
+}
+
+// jsonPayloadInsertArgs works like defaultInsertArgs, but inserts the JSON payloads into JSONPayloadColumn,
+// which follows the payload column.
+func jsonPayloadInsertArgs(msgs message.Messages) ([]any, error) {
+	args, err := defaultInsertArgs(msgs)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonArgs := make([]any, 0, len(msgs)*4)
+	for i, msg := range msgs {
+		payload, jsonPayload := jsonPayloadArgs(msg)
+		jsonArgs = append(jsonArgs, args[i*3], payload, jsonPayload, args[i*3+2])
+	}
+
+	return jsonArgs, nil
+}
@@ -0,0 +1,90 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultSQLiteSchema_JSONPayloads(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "json.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	schemaAdapter := sql.DefaultSQLiteSchema{
+		JSONPayloads: true,
+		Fragments: sql.SQLFragments{
+			WhereExtra: `json_extract("payload_json", '$.country') = 'PL' OR "payload_json" IS NULL`,
+		},
+	}
+
+	newMessage := func(payload string, contentType string) *message.Message {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(payload))
+		if contentType != "" {
+			msg.Metadata.Set(sql.ContentTypeMetadataKey, contentType)
+		}
+		return msg
+	}
+
+	polish := newMessage(`{"country": "PL"}`, "application/json; charset=utf-8")
+	german := newMessage(`{"country": "DE"}`, "application/json")
+	cloudEvent := newMessage(`{"country": "PL", "type": "event"}`, "application/cloudevents+json")
+	binary := newMessage("\x00\x01", "application/octet-stream")
+	invalidJSON := newMessage(`{"country":`, "application/json")
+	require.NoError(t, newCheckpointPublisher(t, db, schemaAdapter).Publish("orders", polish, german, cloudEvent, binary, invalidJSON))
+
+	var jsonPayloads int
+	require.NoError(t, sqlDB.QueryRow(`SELECT COUNT(*) FROM "watermill_orders" WHERE "payload_json" IS NOT NULL AND "payload" IS NULL`).Scan(&jsonPayloads))
+	assert.Equal(t, 3, jsonPayloads)
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	subscribeCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	messages, err := subscriber.Subscribe(subscribeCtx, "orders")
+	require.NoError(t, err)
+
+	for _, expected := range []*message.Message{polish, cloudEvent, binary, invalidJSON} {
+		select {
+		case msg := <-messages:
+			assert.Equal(t, expected.UUID, msg.UUID)
+			assert.Equal(t, string(expected.Payload), string(msg.Payload))
+			msg.Ack()
+		case <-subscribeCtx.Done():
+			t.Fatal("messages were not received")
+		}
+	}
+}
+
+func TestDefaultPostgreSQLSchema_JSONPayloads(t *testing.T) {
+	msg := message.NewMessage(watermill.NewUUID(), []byte(`{"country": "PL"}`))
+	msg.Metadata.Set(sql.ContentTypeMetadataKey, "application/json")
+	binary := message.NewMessage(watermill.NewUUID(), []byte("binary"))
+
+	query, err := sql.DefaultPostgreSQLSchema{JSONPayloads: true}.InsertQuery("orders", message.Messages{msg, binary})
+	require.NoError(t, err)
+
+	assert.Contains(t, query.Query, `(uuid, payload, payload_json, metadata, transaction_id) VALUES ($1,$2,$3,$4,pg_current_xact_id()),($5,$6,$7,$8,pg_current_xact_id())`)
+	require.Len(t, query.Args, 8)
+	assert.Nil(t, query.Args[1])
+	assert.Equal(t, `{"country": "PL"}`, query.Args[2])
+	assert.Equal(t, []byte("binary"), query.Args[5])
+	assert.Nil(t, query.Args[6])
+}
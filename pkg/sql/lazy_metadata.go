@@ -0,0 +1,75 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+const lazyMetadataContextKey contextKey = "lazy_metadata"
+
+// lazyMetadataSchemaAdapter is implemented by the schema adapters which can leave the metadata of the consumed
+// messages encoded (like DefaultSQLiteSchema with LazyMetadata).
+type lazyMetadataSchemaAdapter interface {
+	decodesMetadataLazily() bool
+}
+
+func schemaDecodesMetadataLazily(schemaAdapter SchemaAdapter) bool {
+	lazyAdapter, ok := schemaAdapter.(lazyMetadataSchemaAdapter)
+	return ok && lazyAdapter.decodesMetadataLazily()
+}
+
+// lazyMetadata is the encoded metadata of the consumed message, decoded on the first access.
+type lazyMetadata struct {
+	encoded []byte
+
+	once     sync.Once
+	metadata message.Metadata
+	err      error
+}
+
+func (m *lazyMetadata) decode() (message.Metadata, error) {
+	m.once.Do(func() {
+		m.metadata = message.Metadata{}
+		if m.encoded != nil {
+			if err := json.Unmarshal(m.encoded, &m.metadata); err != nil {
+				m.err = errors.Wrap(err, "could not unmarshal metadata as JSON")
+			}
+		}
+	})
+
+	return m.metadata, m.err
+}
+
+func setLazyMetadataToContext(ctx context.Context, encoded []byte) context.Context {
+	return context.WithValue(ctx, lazyMetadataContextKey, &lazyMetadata{encoded: encoded})
+}
+
+// MessageMetadata returns the metadata of the consumed message. If the schema adapter left the metadata
+// encoded (like DefaultSQLiteSchema with LazyMetadata), it's decoded on the first call and copied to msg.Metadata,
+// so the message can be re-published with it. Otherwise, msg.Metadata is returned.
+func MessageMetadata(msg *message.Message) (message.Metadata, error) {
+	lazy, ok := msg.Context().Value(lazyMetadataContextKey).(*lazyMetadata)
+	if !ok {
+		return msg.Metadata, nil
+	}
+
+	metadata, err := lazy.decode()
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.Metadata == nil {
+		msg.Metadata = message.Metadata{}
+	}
+	for key, value := range metadata {
+		if _, ok := msg.Metadata[key]; !ok {
+			msg.Metadata[key] = value
+		}
+	}
+
+	return msg.Metadata, nil
+}
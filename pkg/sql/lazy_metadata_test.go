@@ -0,0 +1,63 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_LazyMetadata(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topicName := "lazy_" + watermill.NewShortUUID()
+	schemaAdapter := newSQLiteSchemaAdapter(0)
+	schemaAdapter.LazyMetadata = true
+
+	published := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	published.Metadata.Set("tenant", "acme")
+	publisher := newCheckpointPublisher(t, db, schemaAdapter)
+	require.NoError(t, publisher.Publish(topicName, published))
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "lazy",
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	consumed, err := subscriber.Subscribe(context.Background(), topicName)
+	require.NoError(t, err)
+
+	select {
+	case msg := <-consumed:
+		assert.Empty(t, msg.Metadata, "metadata should not be decoded before it's read")
+
+		metadata, err := sql.MessageMetadata(msg)
+		require.NoError(t, err)
+		assert.Equal(t, "acme", metadata.Get("tenant"))
+		assert.Equal(t, "acme", msg.Metadata.Get("tenant"), "decoded metadata should be copied to the message")
+		msg.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout waiting for message")
+	}
+
+	notConsumed := message.NewMessage(watermill.NewUUID(), nil)
+	notConsumed.Metadata.Set("tenant", "acme")
+	metadata, err := sql.MessageMetadata(notConsumed)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", metadata.Get("tenant"))
+
+	_, err = sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:  schemaAdapter,
+		OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+		Transforms:     []sql.TransformFunc{func(msg *message.Message) (*message.Message, error) { return msg, nil }},
+	}, logger)
+	assert.Error(t, err, "transforms should not be allowed with lazy metadata")
+}
@@ -0,0 +1,161 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// LeaseStore stores the leases of consumer groups, so only one subscriber (the leader) consumes a consumer group,
+// while subscribers of other replicas stand by (see SubscriberConfig.LeaseStore).
+type LeaseStore interface {
+	// AcquireLease acquires the lease of the consumer group for the holder, or renews it if the holder already has it.
+	// It returns false if the lease is held by another holder and didn't expire yet.
+	AcquireLease(ctx context.Context, topic string, consumerGroup string, holder string, duration time.Duration) (bool, error)
+
+	// ReleaseLease releases the lease of the consumer group, if it's held by the holder,
+	// so a standby subscriber can take over without waiting for the lease to expire.
+	ReleaseLease(ctx context.Context, topic string, consumerGroup string, holder string) error
+}
+
+// SQLiteLeaseStore stores the leases of consumer groups in a SQLite table.
+//
+// Expiration of the leases is based on the clocks of the subscribers, so the clocks of the replicas
+// should be synchronized, with a skew much lower than SubscriberConfig.LeaseDuration.
+type SQLiteLeaseStore struct {
+	DB QueryExecutor
+
+	// TableName may be used to override the name of the table. The name should not be quoted.
+	//
+	// Default value is watermill_leases.
+	TableName string
+}
+
+// InitializeSchema creates the table storing the leases, if it doesn't exist yet.
+func (s SQLiteLeaseStore) InitializeSchema(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table()+` (
+		"topic" TEXT NOT NULL,
+		"consumer_group" TEXT NOT NULL,
+		"holder" TEXT NOT NULL,
+		"expires_at" INTEGER NOT NULL,
+		PRIMARY KEY ("topic", "consumer_group")
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "could not create leases table")
+	}
+
+	return nil
+}
+
+func (s SQLiteLeaseStore) AcquireLease(
+	ctx context.Context,
+	topic string,
+	consumerGroup string,
+	holder string,
+	duration time.Duration,
+) (bool, error) {
+	now := time.Now()
+
+	// The row is not updated if the lease is held by another holder, so no rows are affected.
+	result, err := s.DB.ExecContext(
+		ctx,
+		`INSERT INTO `+s.table()+` ("topic", "consumer_group", "holder", "expires_at") VALUES (?, ?, ?, ?)
+		ON CONFLICT ("topic", "consumer_group") DO UPDATE SET "holder" = excluded."holder", "expires_at" = excluded."expires_at"
+		WHERE `+s.table()+`."holder" = excluded."holder" OR `+s.table()+`."expires_at" <= ?`,
+		topic, consumerGroup, holder, now.Add(duration).UnixMilli(), now.UnixMilli(),
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "could not acquire lease")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "could not get affected rows")
+	}
+
+	return affected > 0, nil
+}
+
+func (s SQLiteLeaseStore) ReleaseLease(ctx context.Context, topic string, consumerGroup string, holder string) error {
+	_, err := s.DB.ExecContext(
+		ctx,
+		`DELETE FROM `+s.table()+` WHERE "topic" = ? AND "consumer_group" = ? AND "holder" = ?`,
+		topic, consumerGroup, holder,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not release lease")
+	}
+
+	return nil
+}
+
+func (s SQLiteLeaseStore) table() string {
+	if s.TableName != "" {
+		return fmt.Sprintf(`"%s"`, s.TableName)
+	}
+	return `"watermill_leases"`
+}
+
+// subscriberLease is the state of the lease of a subscription.
+type subscriberLease struct {
+	held      bool
+	renewedAt time.Time
+}
+
+// holdLease acquires or renews the lease of the consumer group, when SubscriberConfig.LeaseStore is set.
+// It returns false if the subscriber should stand by.
+func (s *Subscriber) holdLease(ctx context.Context, topic string, lease *subscriberLease, logger watermill.LoggerAdapter) bool {
+	if s.config.LeaseStore == nil {
+		return true
+	}
+
+	// The lease is renewed well before it expires, so it's not lost between the queries.
+	if lease.held && time.Since(lease.renewedAt) < s.config.LeaseDuration/3 {
+		return true
+	}
+
+	now := time.Now()
+	acquired, err := s.config.LeaseStore.AcquireLease(ctx, topic, s.config.ConsumerGroup, s.consumerIdString, s.config.LeaseDuration)
+	if err != nil {
+		logger.Error("Could not acquire lease", err, nil)
+
+		// The lease may be still valid, even if it couldn't be renewed.
+		return lease.held && time.Since(lease.renewedAt) < s.config.LeaseDuration
+	}
+
+	if acquired {
+		if !lease.held {
+			logger.Info("Acquired lease, consuming", nil)
+			s.events.emit(LeaseAcquired{Topic: topic, ConsumerGroup: s.config.ConsumerGroup})
+		}
+		lease.held = true
+		lease.renewedAt = now
+		return true
+	}
+
+	if lease.held {
+		logger.Info("Lost lease, standing by", nil)
+		s.events.emit(LeaseLost{Topic: topic, ConsumerGroup: s.config.ConsumerGroup})
+	}
+	lease.held = false
+
+	return false
+}
+
+func (s *Subscriber) releaseLease(topic string, lease *subscriberLease, logger watermill.LoggerAdapter) {
+	if !lease.held {
+		return
+	}
+
+	// The subscription's context is already canceled.
+	if err := s.config.LeaseStore.ReleaseLease(context.Background(), topic, s.config.ConsumerGroup, s.consumerIdString); err != nil {
+		logger.Error("Could not release lease", err, nil)
+		return
+	}
+
+	lease.held = false
+	s.events.emit(LeaseLost{Topic: topic, ConsumerGroup: s.config.ConsumerGroup})
+}
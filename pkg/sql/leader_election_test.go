@@ -0,0 +1,133 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteLeaseStore(t *testing.T) {
+	ctx := context.Background()
+	store := sql.SQLiteLeaseStore{DB: sql.BeginnerFromStdSQL(newSQLite(t)), TableName: "leases_" + watermill.NewShortUUID()}
+	require.NoError(t, store.InitializeSchema(ctx))
+
+	acquire := func(holder string, duration time.Duration) bool {
+		acquired, err := store.AcquireLease(ctx, "orders", "workers", holder, duration)
+		require.NoError(t, err)
+		return acquired
+	}
+
+	assert.True(t, acquire("a", time.Millisecond*100))
+	assert.True(t, acquire("a", time.Millisecond*100), "the holder should renew the lease")
+	assert.False(t, acquire("b", time.Minute))
+
+	acquired, err := store.AcquireLease(ctx, "orders", "other_workers", "b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "leases of other consumer groups should be independent")
+
+	time.Sleep(time.Millisecond * 150)
+	assert.True(t, acquire("b", time.Minute), "the expired lease should be taken over")
+	assert.False(t, acquire("a", time.Minute))
+
+	require.NoError(t, store.ReleaseLease(ctx, "orders", "workers", "a"))
+	assert.False(t, acquire("a", time.Minute), "only the holder should release the lease")
+
+	require.NoError(t, store.ReleaseLease(ctx, "orders", "workers", "b"))
+	assert.True(t, acquire("a", time.Minute))
+}
+
+func TestSubscriber_LeaseStore(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "leases.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topic := "leased_" + watermill.NewShortUUID()
+
+	store := sql.SQLiteLeaseStore{DB: db}
+	require.NoError(t, store.InitializeSchema(context.Background()))
+
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+
+	newSubscriber := func() *sql.Subscriber {
+		subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+			ConsumerGroup:    "workers",
+			SchemaAdapter:    sql.DefaultSQLiteSchema{},
+			OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+			InitializeSchema: true,
+			PollInterval:     time.Millisecond * 10,
+			LeaseStore:       store,
+			LeaseDuration:    time.Second,
+		}, logger)
+		require.NoError(t, err)
+		return subscriber
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	leader := newSubscriber()
+	leaderMessages, err := leader.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	receive := func(messages <-chan *message.Message) string {
+		select {
+		case msg := <-messages:
+			msg.Ack()
+			return string(msg.Payload)
+		case <-time.After(time.Second * 5):
+			t.Fatal("message not received")
+			return ""
+		}
+	}
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte("1"))))
+	assert.Equal(t, "1", receive(leaderMessages))
+
+	standby := newSubscriber()
+	defer standby.Close()
+	events := standby.Events()
+
+	standbyMessages, err := standby.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte("2"))))
+	assert.Equal(t, "2", receive(leaderMessages))
+
+	select {
+	case msg := <-standbyMessages:
+		t.Fatalf("standby subscriber received message %s", msg.Payload)
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	require.NoError(t, leader.Close())
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte("3"))))
+	assert.Equal(t, "3", receive(standbyMessages))
+
+	var acquired bool
+	for len(events) > 0 {
+		if _, ok := (<-events).(sql.LeaseAcquired); ok {
+			acquired = true
+		}
+	}
+	assert.True(t, acquired)
+}
+
+func TestNewSubscriber_invalidLeaseDuration(t *testing.T) {
+	_, err := sql.NewSubscriber(newSQLite(t), sql.SubscriberConfig{
+		SchemaAdapter:  sql.DefaultSQLiteSchema{},
+		OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+		LeaseStore:     sql.SQLiteLeaseStore{},
+		LeaseDuration:  -time.Second,
+	}, logger)
+	assert.Error(t, err)
+}
@@ -0,0 +1,264 @@
+package sql
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// CreatedAtSchemaAdapter is an optional interface of SchemaAdapter, implemented by adapters which can insert
+// messages with the given creation time, instead of the time of inserting. It's used by Loader.
+type CreatedAtSchemaAdapter interface {
+	// InsertWithCreatedAtQuery returns the query inserting the messages, like InsertQuery,
+	// with the created_at column of every message set to the corresponding createdAt value.
+	InsertWithCreatedAtQuery(topic string, msgs message.Messages, createdAt []time.Time) (Query, error)
+}
+
+// withCreatedAtArgs appends the created_at argument after the default arguments of every message.
+func withCreatedAtArgs(defaultArgs []any, createdAt []time.Time, format func(time.Time) any) []any {
+	if len(createdAt) == 0 {
+		return defaultArgs
+	}
+
+	// Every message has the same number of arguments, like 3 of defaultInsertArgs.
+	argsPerMessage := len(defaultArgs) / len(createdAt)
+
+	args := make([]any, 0, len(defaultArgs)+len(createdAt))
+	for i, t := range createdAt {
+		args = append(args, defaultArgs[i*argsPerMessage:(i+1)*argsPerMessage]...)
+		args = append(args, format(t))
+	}
+
+	return args
+}
+
+type LoaderConfig struct {
+	// SchemaAdapter inserts the loaded messages. It's required.
+	//
+	// If it implements CreatedAtSchemaAdapter (like DefaultMySQLSchema, DefaultPostgreSQLSchema
+	// and DefaultSQLiteSchema), the created_at values of the loaded messages are preserved.
+	// Otherwise, they are ignored.
+	SchemaAdapter SchemaAdapter
+
+	// BatchSize is the number of messages inserted with one query, in a separate transaction.
+	//
+	// Default value is 100.
+	BatchSize int
+
+	// InitializeSchema enables initialization of the schema before loading.
+	InitializeSchema bool
+}
+
+func (c *LoaderConfig) setDefaults() {
+	if c.BatchSize == 0 {
+		c.BatchSize = 100
+	}
+}
+
+func (c LoaderConfig) validate() error {
+	if c.SchemaAdapter == nil {
+		return errors.New("schema adapter is nil")
+	}
+	if c.BatchSize < 0 {
+		return errors.New("batch size must be positive")
+	}
+
+	return nil
+}
+
+// Loader bulk-inserts messages from NDJSON files (for example, written by Exporter) into a topic.
+// It may be used for seeding test environments, or replaying production captures locally.
+//
+// Every line is a JSON object with the fields:
+//
+//   - uuid: the UUID of the message; a new UUID is generated, if it's missing,
+//   - payload: the payload, as a JSON string or any other JSON value embedded as the payload,
+//   - payload_base64: the base64-encoded payload, used instead of payload,
+//   - metadata: the object with metadata values, and the metadata values flattened
+//     into fields prefixed with ExportedMetadataPrefix,
+//   - created_at: the creation time, in RFC 3339 format.
+//
+// Other fields (like offset) are ignored, as loaded messages are assigned new offsets.
+type Loader struct {
+	db     TxBeginner
+	config LoaderConfig
+	logger watermill.LoggerAdapter
+}
+
+func NewLoader(db TxBeginner, config LoaderConfig, logger watermill.LoggerAdapter) (*Loader, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &Loader{
+		db:     db,
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// Load inserts all messages read from r into the topic. It returns the number of loaded messages.
+//
+// Messages are inserted in batches, so when an error is returned, the previous batches are already loaded.
+func (l *Loader) Load(ctx context.Context, topic string, r io.Reader) (int, error) {
+	if err := validateTopic(l.config.SchemaAdapter, topic); err != nil {
+		return 0, err
+	}
+
+	if l.config.InitializeSchema {
+		if err := initializeSchema(ctx, topic, l.logger, l.db, l.config.SchemaAdapter, nil); err != nil {
+			return 0, errors.Wrap(err, "cannot initialize schema")
+		}
+	}
+
+	reader := bufio.NewReader(r)
+
+	var loaded int
+	var msgs message.Messages
+	var createdAt []time.Time
+
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return loaded, errors.Wrap(readErr, "could not read messages")
+		}
+
+		if len(strings.TrimSpace(string(data))) > 0 {
+			msg, t, err := unmarshalLoadedMessage(data)
+			if err != nil {
+				return loaded, errors.Wrapf(err, "invalid message on line %d", line)
+			}
+			msgs = append(msgs, msg)
+			createdAt = append(createdAt, t)
+		}
+
+		if len(msgs) == l.config.BatchSize || (readErr == io.EOF && len(msgs) > 0) {
+			if err := l.insert(ctx, topic, msgs, createdAt); err != nil {
+				return loaded, err
+			}
+			loaded += len(msgs)
+			msgs, createdAt = nil, nil
+		}
+
+		if readErr == io.EOF {
+			return loaded, nil
+		}
+	}
+}
+
+func (l *Loader) insert(ctx context.Context, topic string, msgs message.Messages, createdAt []time.Time) error {
+	var insertQuery Query
+	var err error
+	if createdAtAdapter, ok := l.config.SchemaAdapter.(CreatedAtSchemaAdapter); ok {
+		now := time.Now()
+		for i, t := range createdAt {
+			if t.IsZero() {
+				createdAt[i] = now
+			}
+		}
+		insertQuery, err = createdAtAdapter.InsertWithCreatedAtQuery(topic, msgs, createdAt)
+	} else {
+		insertQuery, err = l.config.SchemaAdapter.InsertQuery(topic, msgs)
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot create insert query")
+	}
+
+	return runInTx(ctx, l.db, func(ctx context.Context, tx Tx) error {
+		if _, err := tx.ExecContext(ctx, insertQuery.Query, insertQuery.Args...); err != nil {
+			return errors.Wrap(err, "could not insert messages")
+		}
+		return nil
+	})
+}
+
+func unmarshalLoadedMessage(data []byte) (*message.Message, time.Time, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, time.Time{}, errors.Wrap(err, "could not unmarshal JSON")
+	}
+
+	stringField := func(name string) (string, error) {
+		var value string
+		if raw, ok := fields[name]; ok {
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return "", errors.Wrapf(err, "%s is not a string", name)
+			}
+		}
+		return value, nil
+	}
+
+	uuid, err := stringField("uuid")
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if uuid == "" {
+		uuid = watermill.NewUUID()
+	}
+
+	var payload []byte
+	if raw, ok := fields["payload_base64"]; ok {
+		encoded, err := stringField("payload_base64")
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if payload, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, time.Time{}, errors.Wrapf(err, "invalid payload_base64 %s", raw)
+		}
+	} else if raw, ok := fields["payload"]; ok {
+		var text string
+		if json.Unmarshal(raw, &text) == nil {
+			payload = []byte(text)
+		} else {
+			payload = raw
+		}
+	}
+
+	msg := message.NewMessage(uuid, payload)
+
+	if raw, ok := fields["metadata"]; ok {
+		var metadata map[string]string
+		if err := json.Unmarshal(raw, &metadata); err != nil {
+			return nil, time.Time{}, errors.Wrap(err, "metadata is not an object of strings")
+		}
+		for key, value := range metadata {
+			msg.Metadata.Set(key, value)
+		}
+	}
+	for name := range fields {
+		if key := strings.TrimPrefix(name, ExportedMetadataPrefix); key != name {
+			value, err := stringField(name)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			msg.Metadata.Set(key, value)
+		}
+	}
+
+	var createdAt time.Time
+	if value, err := stringField("created_at"); err != nil {
+		return nil, time.Time{}, err
+	} else if value != "" {
+		if createdAt, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return nil, time.Time{}, errors.Wrap(err, "invalid created_at")
+		}
+	}
+
+	return msg, createdAt, nil
+}
@@ -0,0 +1,71 @@
+package sql_test
+
+import (
+	"bytes"
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoader(t *testing.T) {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "load.sqlite"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	topic := "topic_" + watermill.NewShortUUID()
+
+	fixture := strings.Join([]string{
+		`{"uuid":"first","payload":{"amount":10},"metadata":{"type":"order_placed"},"created_at":"2024-05-01T10:00:00Z"}`,
+		``,
+		`{"uuid":"second","payload":"text","metadata.source":"edge","created_at":"2024-05-01T12:30:00+02:00"}`,
+		`{"uuid":"third","payload_base64":"/wA=","offset":100}`,
+	}, "\n")
+
+	loader, err := sql.NewLoader(sql.BeginnerFromStdSQL(db), sql.LoaderConfig{
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		BatchSize:        2,
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	loaded, err := loader.Load(context.Background(), topic, strings.NewReader(fixture))
+	require.NoError(t, err)
+	assert.Equal(t, 3, loaded)
+
+	var createdAt []string
+	rows, err := db.Query(`SELECT "created_at" FROM "watermill_` + topic + `" ORDER BY "offset"`)
+	require.NoError(t, err)
+	for rows.Next() {
+		var value string
+		require.NoError(t, rows.Scan(&value))
+		createdAt = append(createdAt, value)
+	}
+	require.NoError(t, rows.Close())
+	require.Len(t, createdAt, 3)
+	assert.Equal(t, []string{"2024-05-01 10:00:00", "2024-05-01 10:30:00"}, createdAt[:2])
+
+	exporter, err := sql.NewExporter(sql.BeginnerFromStdSQL(db), sql.ExporterConfig{
+		SchemaAdapter: sql.DefaultSQLiteSchema{},
+	}, logger)
+	require.NoError(t, err)
+
+	var exported bytes.Buffer
+	_, err = exporter.Export(context.Background(), topic, sql.ExportRange{}, &exported)
+	require.NoError(t, err)
+
+	assert.Equal(t, strings.Join([]string{
+		`{"metadata.type":"order_placed","offset":1,"payload":{"amount":10},"uuid":"first"}`,
+		`{"metadata.source":"edge","offset":2,"payload":"text","uuid":"second"}`,
+		`{"offset":3,"payload_base64":"/wA=","uuid":"third"}`,
+	}, "\n")+"\n", exported.String())
+
+	_, err = loader.Load(context.Background(), topic, strings.NewReader(`{"uuid":1}`))
+	assert.ErrorContains(t, err, "line 1")
+}
@@ -0,0 +1,125 @@
+package sql
+
+import (
+	"sort"
+	"strings"
+)
+
+// MessagesOrder is the order in which the messages of a selected batch are delivered.
+type MessagesOrder int
+
+const (
+	// MessagesOrderOffset delivers messages ordered by their offsets.
+	MessagesOrderOffset MessagesOrder = iota
+
+	// MessagesOrderCreatedAt delivers the messages of every batch ordered by their created_at column,
+	// and by their offsets if they were created at the same time.
+	//
+	// It may be used when offsets are not monotonic with time, for example, when messages of multiple
+	// databases are merged into one table, or when publishers assign created_at themselves.
+	//
+	// Batches are still selected by offsets, so only messages within one batch (see SubscribeBatchSize)
+	// are reordered. Messages of a batch are acked up to the highest offset below which all messages
+	// from the batch were acked, so messages acked out of order may be re-delivered after a nack or a crash.
+	// Batches limited by CatchUpBatchLimit, AutoBatch or FairSchedulingConfig.MaxInFlight are limited
+	// to the messages with the lowest offsets, so no message is skipped.
+	//
+	// It can't be used with offsets adapters implementing NonTransactionalOffsetsAdapter or
+	// OptimisticOffsetsAdapter, as they require messages to be consumed in the order of their offsets.
+	MessagesOrderCreatedAt
+)
+
+// ReorderingSchemaAdapter is an optional interface of SchemaAdapter, implemented by adapters
+// which may return messages from SelectQuery in a different order than their offsets.
+type ReorderingSchemaAdapter interface {
+	// ReordersMessages returns true if SelectQuery doesn't return messages ordered by their offsets.
+	ReordersMessages() bool
+}
+
+func schemaReordersMessages(schemaAdapter SchemaAdapter) bool {
+	reorderingAdapter, ok := schemaAdapter.(ReorderingSchemaAdapter)
+	return ok && reorderingAdapter.ReordersMessages()
+}
+
+// orderedSelectQuery reorders the batch selected by batchQuery, if the order is not MessagesOrderOffset.
+// batchQuery must select the columns and the createdAtColumn, and columns must contain the offsetColumn.
+func orderedSelectQuery(
+	order MessagesOrder,
+	columns []string,
+	offsetColumn string,
+	createdAtColumn string,
+	batchQuery string,
+	quote func(string) string,
+) string {
+	if order == MessagesOrderOffset {
+		return batchQuery
+	}
+
+	quotedColumns := make([]string, len(columns))
+	for i, column := range columns {
+		quotedColumns[i] = quote(column)
+	}
+
+	return `
+		SELECT ` + strings.Join(quotedColumns, ", ") + ` FROM (` + batchQuery + `) AS batch
+		ORDER BY
+			` + quote(createdAtColumn) + ` ASC,
+			` + quote(offsetColumn) + ` ASC`
+}
+
+// lastAckedInOffsetOrder returns the row with the highest offset, below which all rows were acked.
+// It returns false if the row with the lowest offset was not acked.
+func lastAckedInOffsetOrder(rows []Row, acked map[int64]struct{}) (Row, bool) {
+	sorted := make([]Row, len(rows))
+	copy(sorted, rows)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+
+	var lastRow Row
+	var found bool
+	for _, row := range sorted {
+		if _, ok := acked[row.Offset]; !ok {
+			break
+		}
+		lastRow = row
+		found = true
+	}
+
+	return lastRow, found
+}
+
+// limitReorderedBatch limits the reordered batch to the messages with the lowest offsets,
+// as many as allowed by limitReached, keeping the order in which they were returned.
+// Truncating the rows in the order they were returned would skip messages with lower offsets than the acked ones,
+// and they would never be delivered.
+func limitReorderedBatch(rows []Row, limitReached func(messages int) bool) []Row {
+	limit := len(rows)
+	for i := 1; i < len(rows); i++ {
+		if limitReached(i) {
+			limit = i
+			break
+		}
+	}
+	if limit == len(rows) {
+		return rows
+	}
+
+	sorted := make([]Row, len(rows))
+	copy(sorted, rows)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+	maxOffset := sorted[limit-1].Offset
+
+	limited := make([]Row, 0, limit)
+	for _, row := range rows {
+		if row.Offset <= maxOffset {
+			limited = append(limited, row)
+		} else {
+			row.release()
+		}
+	}
+
+	return limited
+}
@@ -0,0 +1,132 @@
+package sql
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// ContentTypeMetadataKey is the metadata key of the content type of the payload, like application/json.
+const ContentTypeMetadataKey = "content_type"
+
+// MetadataProfile maps the metadata keys used by this package to the headers (or properties) of a message broker,
+// so correlation IDs, content types and partition keys survive bridging between the SQL topics and the broker,
+// for example, by the outbox forwarder. Keys without a mapping are kept unchanged.
+type MetadataProfile struct {
+	Name string
+
+	// Keys maps the metadata keys of this package to the keys of the broker.
+	Keys map[string]string
+}
+
+var (
+	// KafkaHeadersProfile maps the metadata to the Kafka headers of the CloudEvents Kafka binding.
+	// PartitionKeyMetadataKey may be used by the marshaler to set the key of the Kafka message.
+	KafkaHeadersProfile = MetadataProfile{
+		Name: "kafka",
+		Keys: map[string]string{
+			ContentTypeMetadataKey:   "content-type",
+			CorrelationIDMetadataKey: "correlation-id",
+			CausationIDMetadataKey:   "causation-id",
+			PartitionKeyMetadataKey:  "partition-key",
+		},
+	}
+
+	// AMQPPropertiesProfile maps the metadata to the basic properties of AMQP 0-9-1 (as used by RabbitMQ).
+	AMQPPropertiesProfile = MetadataProfile{
+		Name: "amqp",
+		Keys: map[string]string{
+			ContentTypeMetadataKey:   "content_type",
+			CorrelationIDMetadataKey: "correlation_id",
+			CausationIDMetadataKey:   "x-causation-id",
+			PartitionKeyMetadataKey:  "x-partition-key",
+		},
+	}
+
+	// NATSHeadersProfile maps the metadata to NATS headers. The deduplication ID is mapped to Nats-Msg-Id,
+	// so JetStream deduplicates the bridged messages.
+	NATSHeadersProfile = MetadataProfile{
+		Name: "nats",
+		Keys: map[string]string{
+			ContentTypeMetadataKey:     "Content-Type",
+			CorrelationIDMetadataKey:   "Correlation-Id",
+			CausationIDMetadataKey:     "Causation-Id",
+			PartitionKeyMetadataKey:    "Partition-Key",
+			DeduplicationIDMetadataKey: "Nats-Msg-Id",
+		},
+	}
+)
+
+func (p MetadataProfile) validate() error {
+	brokerKeys := map[string]string{}
+	for key, brokerKey := range p.Keys {
+		if key == "" || brokerKey == "" {
+			return errors.New("metadata keys must not be empty")
+		}
+		if other, ok := brokerKeys[brokerKey]; ok {
+			return errors.Errorf("metadata keys %s and %s are both mapped to %s", other, key, brokerKey)
+		}
+		brokerKeys[brokerKey] = key
+	}
+
+	return nil
+}
+
+// Reverse returns the profile mapping the keys of the broker to the metadata keys of this package,
+// used for bridging messages from the broker to the SQL topics.
+func (p MetadataProfile) Reverse() MetadataProfile {
+	keys := make(map[string]string, len(p.Keys))
+	for key, brokerKey := range p.Keys {
+		keys[brokerKey] = key
+	}
+
+	return MetadataProfile{Name: p.Name, Keys: keys}
+}
+
+// Map returns a copy of the metadata with the keys mapped by the profile.
+// When both a key and the key it's mapped to are set, the mapped key's value is kept.
+func (p MetadataProfile) Map(metadata message.Metadata) message.Metadata {
+	mapped := make(message.Metadata, len(metadata))
+	for key, value := range metadata {
+		if _, ok := p.Keys[key]; !ok {
+			mapped[key] = value
+		}
+	}
+	for key, value := range metadata {
+		if mappedKey, ok := p.Keys[key]; ok {
+			mapped[mappedKey] = value
+		}
+	}
+
+	return mapped
+}
+
+// NewMetadataProfileDecorator returns the decorator of publishers which maps the metadata of published messages
+// with the profile. For example, the publisher of the broker passed to the outbox forwarder may be decorated
+// with KafkaHeadersProfile, and the Publisher of this package receiving messages from Kafka
+// with KafkaHeadersProfile.Reverse().
+func NewMetadataProfileDecorator(profile MetadataProfile) message.PublisherDecorator {
+	return func(pub message.Publisher) (message.Publisher, error) {
+		if err := profile.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid metadata profile %s", profile.Name)
+		}
+
+		return &metadataProfilePublisher{Publisher: pub, profile: profile}, nil
+	}
+}
+
+type metadataProfilePublisher struct {
+	message.Publisher
+	profile MetadataProfile
+}
+
+// Publish publishes copies of the messages, so the metadata of the messages is not changed.
+func (p *metadataProfilePublisher) Publish(topic string, messages ...*message.Message) error {
+	mapped := make([]*message.Message, len(messages))
+	for i, msg := range messages {
+		mapped[i] = msg.Copy()
+		mapped[i].Metadata = p.profile.Map(msg.Metadata)
+		mapped[i].SetContext(msg.Context())
+	}
+
+	return p.Publisher.Publish(topic, mapped...)
+}
@@ -0,0 +1,53 @@
+package sql_test
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataProfile(t *testing.T) {
+	metadata := message.Metadata{
+		sql.CorrelationIDMetadataKey:   "correlation",
+		sql.ContentTypeMetadataKey:     "application/json",
+		sql.DeduplicationIDMetadataKey: "order-1",
+		"tenant":                       "acme",
+	}
+
+	bridged := sql.NATSHeadersProfile.Map(metadata)
+	assert.Equal(t, message.Metadata{
+		"Correlation-Id": "correlation",
+		"Content-Type":   "application/json",
+		"Nats-Msg-Id":    "order-1",
+		"tenant":         "acme",
+	}, bridged)
+
+	assert.Equal(t, metadata, sql.NATSHeadersProfile.Reverse().Map(bridged))
+}
+
+func TestNewMetadataProfileDecorator(t *testing.T) {
+	pub := publishedMessages{}
+
+	decorated, err := sql.NewMetadataProfileDecorator(sql.KafkaHeadersProfile)(pub)
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("{}"))
+	msg.Metadata.Set(sql.PartitionKeyMetadataKey, "customer-1")
+	require.NoError(t, decorated.Publish("orders", msg))
+
+	published := pub["orders"]
+	require.Len(t, published, 1)
+	assert.Equal(t, msg.UUID, published[0].UUID)
+	assert.Equal(t, "customer-1", published[0].Metadata.Get("partition-key"))
+	assert.Equal(t, "customer-1", msg.Metadata.Get(sql.PartitionKeyMetadataKey), "published message should not be changed")
+
+	_, err = sql.NewMetadataProfileDecorator(sql.MetadataProfile{
+		Name: "invalid",
+		Keys: map[string]string{"a": "x", "b": "x"},
+	})(pub)
+	assert.Error(t, err)
+}
@@ -0,0 +1,302 @@
+package sql
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// MetadataStorage defines how DefaultSQLiteSchema stores the metadata of the messages of a topic,
+// trading query-ability of the metadata for the cost of writing it:
+//
+//   - InlineJSONMetadata stores the metadata as a JSON object in the metadata column (the default),
+//     which is the cheapest to write, but queried only with JSON functions.
+//   - PromotedColumnsMetadata stores chosen keys in their own (indexed) columns, which can be queried like
+//     any other column, at the cost of an index update per indexed key.
+//   - KeyValueMetadata stores every key in a side table indexed by the key and value, so any key can be queried,
+//     at the cost of a row (and index entries) per key.
+//
+// The metadata of the consumed messages is selected as a JSON object by all of them, so subscribers
+// are not affected by the storage.
+type MetadataStorage interface {
+	// ColumnDefinitions returns the definitions of the columns added to the messages table, like `"tenant" TEXT`.
+	// They're a part of the CREATE TABLE query, so they're not added to existing tables.
+	ColumnDefinitions(topic string) []string
+
+	// SchemaInitializingQueries returns the queries executed after the messages table is created,
+	// like creating indexes and side tables.
+	SchemaInitializingQueries(topic string, messagesTable string) []Query
+
+	// InsertColumns returns the columns inserted after the metadata column.
+	InsertColumns(topic string) []string
+
+	// InsertArgs returns the value of the metadata column of the message, followed by the values of InsertColumns.
+	InsertArgs(topic string, msg *message.Message) ([]any, error)
+
+	// SelectExpression returns the SQL expression selecting the metadata of a message of the messages table
+	// as a JSON object.
+	SelectExpression(topic string, messagesTable string) string
+}
+
+// InlineJSONMetadata stores the metadata as a JSON object in the metadata column.
+type InlineJSONMetadata struct{}
+
+func (InlineJSONMetadata) ColumnDefinitions(topic string) []string {
+	return nil
+}
+
+func (InlineJSONMetadata) SchemaInitializingQueries(topic string, messagesTable string) []Query {
+	return nil
+}
+
+func (InlineJSONMetadata) InsertColumns(topic string) []string {
+	return nil
+}
+
+func (InlineJSONMetadata) InsertArgs(topic string, msg *message.Message) ([]any, error) {
+	metadata, err := marshalMetadata(msg.UUID, msg.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return []any{metadata}, nil
+}
+
+func (InlineJSONMetadata) SelectExpression(topic string, messagesTable string) string {
+	return `"metadata"`
+}
+
+// PromotedMetadataColumn is the column of a metadata key promoted by PromotedColumnsMetadata.
+type PromotedMetadataColumn struct {
+	// MetadataKey is the key of the metadata stored in the column. It's required.
+	MetadataKey string
+
+	// Column is the name of the column.
+	//
+	// Default value is "metadata_" followed by the metadata key.
+	Column string
+
+	// Indexed creates an index on the column.
+	Indexed bool
+}
+
+func (c PromotedMetadataColumn) column() string {
+	if c.Column == "" {
+		return "metadata_" + c.MetadataKey
+	}
+
+	return c.Column
+}
+
+// PromotedColumnsMetadata stores the chosen metadata keys in their own columns of the messages table,
+// so they can be queried (and indexed) like any other column, and the remaining keys as a JSON object
+// in the metadata column. Keys missing in the metadata are stored as NULL.
+//
+// The columns are created with the messages table, so they must be added manually
+// (with ALTER TABLE ADD COLUMN) before promoting keys of an existing topic.
+type PromotedColumnsMetadata struct {
+	Columns []PromotedMetadataColumn
+}
+
+func (m PromotedColumnsMetadata) ColumnDefinitions(topic string) []string {
+	definitions := make([]string, 0, len(m.Columns))
+	for _, c := range m.Columns {
+		definitions = append(definitions, QuoteWithDoubleQuotes(c.column())+" TEXT")
+	}
+
+	return definitions
+}
+
+func (m PromotedColumnsMetadata) SchemaInitializingQueries(topic string, messagesTable string) []Query {
+	var queries []Query
+	for _, c := range m.Columns {
+		if !c.Indexed {
+			continue
+		}
+
+		queries = append(queries, Query{
+			Query: `CREATE INDEX IF NOT EXISTS ` + QuoteWithDoubleQuotes(tableIndexName(messagesTable, c.column()+"_idx", 0)) + `
+				ON ` + messagesTable + ` (` + QuoteWithDoubleQuotes(c.column()) + `)`,
+		})
+	}
+
+	return queries
+}
+
+func (m PromotedColumnsMetadata) InsertColumns(topic string) []string {
+	columns := make([]string, 0, len(m.Columns))
+	for _, c := range m.Columns {
+		columns = append(columns, c.column())
+	}
+
+	return columns
+}
+
+func (m PromotedColumnsMetadata) InsertArgs(topic string, msg *message.Message) ([]any, error) {
+	remaining := make(message.Metadata, len(msg.Metadata))
+	for key, value := range msg.Metadata {
+		remaining[key] = value
+	}
+
+	promoted := make([]any, 0, len(m.Columns))
+	for _, c := range m.Columns {
+		value, ok := remaining[c.MetadataKey]
+		if !ok {
+			promoted = append(promoted, nil)
+			continue
+		}
+
+		promoted = append(promoted, value)
+		delete(remaining, c.MetadataKey)
+	}
+
+	metadata, err := marshalMetadata(msg.UUID, remaining)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]any{metadata}, promoted...), nil
+}
+
+func (m PromotedColumnsMetadata) SelectExpression(topic string, messagesTable string) string {
+	if len(m.Columns) == 0 {
+		return `"metadata"`
+	}
+
+	// NULL values of json_object are removed by json_patch, so missing keys are not selected.
+	var promoted []string
+	for _, c := range m.Columns {
+		promoted = append(promoted, sqlStringLiteral(c.MetadataKey), QuoteWithDoubleQuotes(c.column()))
+	}
+
+	return `json_patch(COALESCE("metadata", '{}'), json_object(` + strings.Join(promoted, ", ") + `))`
+}
+
+// KeyValueMetadata stores every metadata key as a row of a side table of the messages table,
+// indexed by the key and value, so messages can be looked up by any metadata key.
+//
+// The metadata column is inserted as JSON and moved to the side table by a trigger, which leaves it NULL.
+// Another trigger deletes the metadata of deleted messages. The side table has columns offset, key and value.
+type KeyValueMetadata struct {
+	// GenerateTableName may be used to override how the name of the side table is generated from the messages table.
+	//
+	// By default, it's the name of the messages table followed by "_metadata".
+	GenerateTableName func(messagesTable string) string
+}
+
+func (m KeyValueMetadata) Table(messagesTable string) string {
+	if m.GenerateTableName != nil {
+		return m.GenerateTableName(messagesTable)
+	}
+
+	return QuoteWithDoubleQuotes(unquotedTableName(messagesTable) + "_metadata")
+}
+
+func (m KeyValueMetadata) ColumnDefinitions(topic string) []string {
+	return nil
+}
+
+func (m KeyValueMetadata) SchemaInitializingQueries(topic string, messagesTable string) []Query {
+	table := m.Table(messagesTable)
+
+	return []Query{
+		{Query: `
+			CREATE TABLE IF NOT EXISTS ` + table + ` (
+				"offset" INTEGER NOT NULL,
+				"key" TEXT NOT NULL,
+				"value" TEXT,
+				PRIMARY KEY ("offset", "key")
+			) WITHOUT ROWID
+		`},
+		{Query: `CREATE INDEX IF NOT EXISTS ` + QuoteWithDoubleQuotes(tableIndexName(table, "key_value_idx", 0)) + `
+			ON ` + table + ` ("key", "value")`},
+		{Query: `
+			CREATE TRIGGER IF NOT EXISTS ` + QuoteWithDoubleQuotes(tableIndexName(table, "insert", 0)) + `
+			AFTER INSERT ON ` + messagesTable + `
+			WHEN NEW."metadata" IS NOT NULL
+			BEGIN
+				INSERT INTO ` + table + ` ("offset", "key", "value")
+					SELECT NEW."offset", "key", "value" FROM json_each(NEW."metadata");
+				UPDATE ` + messagesTable + ` SET "metadata" = NULL WHERE "offset" = NEW."offset";
+			END
+		`},
+		{Query: `
+			CREATE TRIGGER IF NOT EXISTS ` + QuoteWithDoubleQuotes(tableIndexName(table, "delete", 0)) + `
+			AFTER DELETE ON ` + messagesTable + `
+			BEGIN
+				DELETE FROM ` + table + ` WHERE "offset" = OLD."offset";
+			END
+		`},
+	}
+}
+
+func (m KeyValueMetadata) InsertColumns(topic string) []string {
+	return nil
+}
+
+func (m KeyValueMetadata) InsertArgs(topic string, msg *message.Message) ([]any, error) {
+	return InlineJSONMetadata{}.InsertArgs(topic, msg)
+}
+
+func (m KeyValueMetadata) SelectExpression(topic string, messagesTable string) string {
+	table := m.Table(messagesTable)
+
+	// The messages table is referenced by its name, so it can't be aliased by SQLFragments.SelectSuffix.
+	return `(SELECT json_group_object("key", "value") FROM ` + table + `
+		WHERE ` + table + `."offset" = ` + messagesTable + `."offset")`
+}
+
+// TopicMetadataStorage picks the MetadataStorage of each topic, so topics with metadata queried often
+// can have a storage with lower read cost than the others.
+type TopicMetadataStorage struct {
+	// Topics are the storages of the topics.
+	Topics map[string]MetadataStorage
+
+	// Default is the storage of the topics missing in Topics.
+	//
+	// Default value is InlineJSONMetadata.
+	Default MetadataStorage
+}
+
+func (m TopicMetadataStorage) storage(topic string) MetadataStorage {
+	if storage, ok := m.Topics[topic]; ok && storage != nil {
+		return storage
+	}
+	if m.Default != nil {
+		return m.Default
+	}
+
+	return InlineJSONMetadata{}
+}
+
+func (m TopicMetadataStorage) ColumnDefinitions(topic string) []string {
+	return m.storage(topic).ColumnDefinitions(topic)
+}
+
+func (m TopicMetadataStorage) SchemaInitializingQueries(topic string, messagesTable string) []Query {
+	return m.storage(topic).SchemaInitializingQueries(topic, messagesTable)
+}
+
+func (m TopicMetadataStorage) InsertColumns(topic string) []string {
+	return m.storage(topic).InsertColumns(topic)
+}
+
+func (m TopicMetadataStorage) InsertArgs(topic string, msg *message.Message) ([]any, error) {
+	return m.storage(topic).InsertArgs(topic, msg)
+}
+
+func (m TopicMetadataStorage) SelectExpression(topic string, messagesTable string) string {
+	return m.storage(topic).SelectExpression(topic, messagesTable)
+}
+
+func marshalMetadata(uuid string, metadata message.Metadata) (string, error) {
+	// Metadata is stored as TEXT, so JSON functions can be used on it.
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not marshal metadata into JSON for message %s", uuid)
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,107 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultSQLiteSchema_MetadataStorage(t *testing.T) {
+	testCases := []struct {
+		name    string
+		storage sql.MetadataStorage
+		stored  string
+	}{
+		{
+			name:    "inline_json",
+			storage: sql.InlineJSONMetadata{},
+			stored:  `SELECT json_extract("metadata", '$.tenant') FROM "watermill_orders" ORDER BY "offset" LIMIT 1`,
+		},
+		{
+			name: "promoted_columns",
+			storage: sql.PromotedColumnsMetadata{Columns: []sql.PromotedMetadataColumn{
+				{MetadataKey: "tenant", Indexed: true},
+				{MetadataKey: "missing", Column: "missing"},
+			}},
+			stored: `SELECT "metadata_tenant" FROM "watermill_orders" WHERE json_extract("metadata", '$.tenant') IS NULL ORDER BY "offset" LIMIT 1`,
+		},
+		{
+			name:    "key_value",
+			storage: sql.KeyValueMetadata{},
+			stored:  `SELECT "value" FROM "watermill_orders_metadata" WHERE "key" = 'tenant' ORDER BY "offset" LIMIT 1`,
+		},
+		{
+			name: "per_topic",
+			storage: sql.TopicMetadataStorage{
+				Topics: map[string]sql.MetadataStorage{"orders": sql.KeyValueMetadata{}},
+			},
+			stored: `SELECT "value" FROM "watermill_orders_metadata" WHERE "key" = 'tenant' ORDER BY "offset" LIMIT 1`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "metadata.sqlite")+"?_pragma=busy_timeout(10000)")
+			require.NoError(t, err)
+			defer sqlDB.Close()
+
+			ctx := context.Background()
+			db := sql.BeginnerFromStdSQL(sqlDB)
+			schemaAdapter := sql.DefaultSQLiteSchema{MetadataStorage: tc.storage, Pagination: sql.PaginationKeyset}
+
+			first := message.NewMessage(watermill.NewUUID(), []byte("first"))
+			first.Metadata.Set("tenant", "acme")
+			first.Metadata.Set("type", "placed")
+			first.SetContext(sql.ContextWithCorrelationID(ctx, "order-1"))
+			second := message.NewMessage(watermill.NewUUID(), []byte("second"))
+			require.NoError(t, newCheckpointPublisher(t, db, schemaAdapter).Publish("orders", first, second))
+
+			var stored string
+			require.NoError(t, sqlDB.QueryRow(tc.stored).Scan(&stored))
+			assert.Equal(t, "acme", stored)
+
+			subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+				SchemaAdapter:    schemaAdapter,
+				OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+				InitializeSchema: true,
+				PollInterval:     time.Millisecond * 10,
+			}, logger)
+			require.NoError(t, err)
+			defer subscriber.Close()
+
+			subscribeCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+			defer cancel()
+			messages, err := subscriber.Subscribe(subscribeCtx, "orders")
+			require.NoError(t, err)
+
+			for _, expected := range []*message.Message{first, second} {
+				select {
+				case msg := <-messages:
+					assert.Equal(t, expected.UUID, msg.UUID)
+					assert.Equal(t, expected.Payload, msg.Payload)
+					assert.Len(t, msg.Metadata, len(expected.Metadata))
+					for key, value := range expected.Metadata {
+						assert.Equal(t, value, msg.Metadata.Get(key), key)
+					}
+					msg.Ack()
+				case <-subscribeCtx.Done():
+					t.Fatal("messages were not received")
+				}
+			}
+
+			traced, err := sql.SQLiteTopicAdmin{DB: db, SchemaAdapter: schemaAdapter}.Trace(ctx, "order-1")
+			require.NoError(t, err)
+			require.Len(t, traced, 1)
+			assert.Equal(t, first.UUID, traced[0].Msg.UUID)
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package sql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// MetricsLabels are the labels of the metrics recorded by the decorators
+// returned by NewPublisherMetricsDecorator and NewSubscriberMetricsDecorator.
+type MetricsLabels struct {
+	Topic string
+
+	// Table is the messages table of the topic, as returned by MessagesTable of the schema adapter, without quotes.
+	// It's empty if the schema adapter doesn't implement MessagesTable.
+	Table string
+
+	// Dialect is the database of the schema adapter, like "postgresql" or "sqlite".
+	Dialect string
+
+	// ConsumerGroup is the consumer group of the subscriber. It's empty for published messages.
+	ConsumerGroup string
+
+	// HandlerName is the name of the router's handler publishing the messages.
+	// It's empty for consumed messages, and for messages published outside handlers.
+	HandlerName string
+}
+
+// Map returns the labels by their names in snake case, so they may be used as prometheus.Labels.
+func (l MetricsLabels) Map() map[string]string {
+	return map[string]string{
+		"topic":          l.Topic,
+		"table":          l.Table,
+		"dialect":        l.Dialect,
+		"consumer_group": l.ConsumerGroup,
+		"handler_name":   l.HandlerName,
+	}
+}
+
+// MetricsRecorder records the metrics of publishing and consuming messages, for example, with Prometheus.
+// Its methods are called concurrently, and they shouldn't block.
+type MetricsRecorder interface {
+	// ObservePublish is called after publishing the messages, with the duration of Publish and its error.
+	ObservePublish(labels MetricsLabels, messages int, duration time.Duration, err error)
+
+	// ObserveConsume is called when the consumed message is acked or nacked,
+	// with the duration between receiving the message and acking or nacking it.
+	ObserveConsume(labels MetricsLabels, acked bool, duration time.Duration)
+}
+
+type MetricsConfig struct {
+	// SchemaAdapter is the schema adapter of the decorated publisher or subscriber,
+	// used to label the metrics with the messages table and the dialect. It's required.
+	SchemaAdapter SchemaAdapter
+
+	// Dialect overrides the dialect label. By default, it's based on the type of SchemaAdapter,
+	// and it's empty for custom schema adapters.
+	Dialect string
+
+	// ConsumerGroup is the consumer group of the decorated subscriber.
+	ConsumerGroup string
+
+	// Recorder records the metrics. It's required.
+	Recorder MetricsRecorder
+}
+
+func (c MetricsConfig) validate() error {
+	if c.SchemaAdapter == nil {
+		return errors.New("schema adapter is nil")
+	}
+	if c.Recorder == nil {
+		return errors.New("recorder is nil")
+	}
+
+	return nil
+}
+
+func (c MetricsConfig) labels(topic string) MetricsLabels {
+	labels := MetricsLabels{
+		Topic:         topic,
+		Dialect:       c.Dialect,
+		ConsumerGroup: c.ConsumerGroup,
+	}
+	if tableAdapter, ok := c.SchemaAdapter.(interface{ MessagesTable(topic string) string }); ok {
+		labels.Table = strings.Trim(tableAdapter.MessagesTable(topic), "\"`[]")
+	}
+	if labels.Dialect == "" {
+		labels.Dialect = schemaDialectName(c.SchemaAdapter)
+	}
+
+	return labels
+}
+
+func schemaDialectName(schemaAdapter SchemaAdapter) string {
+	switch s := schemaAdapter.(type) {
+	case DefaultSQLiteSchema, AuditSQLiteSchema:
+		return "sqlite"
+	case DefaultMySQLSchema:
+		return "mysql"
+	case DefaultPostgreSQLSchema, PostgreSQLQueueSchema:
+		return "postgresql"
+	case DefaultMSSQLSchema:
+		return "mssql"
+	case DefaultDuckDBSchema:
+		return "duckdb"
+	case DialectSchema:
+		switch s.Dialect.(type) {
+		case SQLiteDialect:
+			return "sqlite"
+		case MySQLDialect:
+			return "mysql"
+		case SpannerDialect:
+			return "spanner"
+		case YugabyteDBDialect:
+			return "yugabytedb"
+		}
+	}
+
+	return ""
+}
+
+// NewPublisherMetricsDecorator returns the decorator of publishers of this package, recording the metrics
+// of published messages labeled with the topic, the messages table and the dialect.
+// It may be added to the router with AddPublisherDecorators.
+func NewPublisherMetricsDecorator(config MetricsConfig) message.PublisherDecorator {
+	return func(pub message.Publisher) (message.Publisher, error) {
+		if err := config.validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid config")
+		}
+
+		return &metricsPublisher{Publisher: pub, config: config}, nil
+	}
+}
+
+type metricsPublisher struct {
+	message.Publisher
+	config MetricsConfig
+}
+
+func (p *metricsPublisher) Publish(topic string, messages ...*message.Message) error {
+	labels := p.config.labels(topic)
+	if len(messages) > 0 {
+		labels.HandlerName = message.HandlerNameFromCtx(messages[0].Context())
+	}
+
+	start := time.Now()
+	err := p.Publisher.Publish(topic, messages...)
+	p.config.Recorder.ObservePublish(labels, len(messages), time.Since(start), err)
+
+	return err
+}
+
+// NewSubscriberMetricsDecorator returns the decorator of subscribers of this package, recording the metrics
+// of consumed messages labeled with the topic, the messages table, the dialect and the consumer group.
+// It may be added to the router with AddSubscriberDecorators.
+func NewSubscriberMetricsDecorator(config MetricsConfig) message.SubscriberDecorator {
+	return func(sub message.Subscriber) (message.Subscriber, error) {
+		if err := config.validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid config")
+		}
+
+		return &metricsSubscriber{Subscriber: sub, config: config}, nil
+	}
+}
+
+type metricsSubscriber struct {
+	message.Subscriber
+	config MetricsConfig
+}
+
+func (s *metricsSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	messages, err := s.Subscriber.Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := s.config.labels(topic)
+	out := make(chan *message.Message)
+
+	go func() {
+		defer close(out)
+
+		for msg := range messages {
+			go s.observeConsume(labels, msg, time.Now())
+
+			select {
+			case out <- msg:
+			case <-msg.Context().Done():
+				// The subscriber discarded the message, for example, when it was closed.
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func (s *metricsSubscriber) observeConsume(labels MetricsLabels, msg *message.Message, received time.Time) {
+	select {
+	case <-msg.Acked():
+		s.config.Recorder.ObserveConsume(labels, true, time.Since(received))
+	case <-msg.Nacked():
+		s.config.Recorder.ObserveConsume(labels, false, time.Since(received))
+	case <-msg.Context().Done():
+		// The context is canceled after the ack, so the ack is checked again.
+		select {
+		case <-msg.Acked():
+			s.config.Recorder.ObserveConsume(labels, true, time.Since(received))
+		default:
+			// The subscriber discarded the message, for example, when it was closed or the ack deadline passed.
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package sql_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedConsume struct {
+	Labels sql.MetricsLabels
+	Acked  bool
+}
+
+type metricsRecorderMock struct {
+	lock      sync.Mutex
+	published []sql.MetricsLabels
+	consumed  []recordedConsume
+}
+
+func (r *metricsRecorderMock) ObservePublish(labels sql.MetricsLabels, messages int, duration time.Duration, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i := 0; i < messages; i++ {
+		r.published = append(r.published, labels)
+	}
+}
+
+func (r *metricsRecorderMock) ObserveConsume(labels sql.MetricsLabels, acked bool, duration time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.consumed = append(r.consumed, recordedConsume{Labels: labels, Acked: acked})
+}
+
+func (r *metricsRecorderMock) consumedCount() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.consumed)
+}
+
+func TestMetricsDecorators(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topic := "metrics_" + watermill.NewShortUUID()
+	recorder := &metricsRecorderMock{}
+
+	publisher, err := sql.NewPublisherMetricsDecorator(sql.MetricsConfig{
+		SchemaAdapter: sql.DefaultSQLiteSchema{},
+		Recorder:      recorder,
+	})(newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{}))
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "workers",
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+		ResendInterval:   time.Millisecond * 10,
+	}, logger)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, subscriber.Close())
+	}()
+
+	decorated, err := sql.NewSubscriberMetricsDecorator(sql.MetricsConfig{
+		SchemaAdapter: sql.DefaultSQLiteSchema{},
+		ConsumerGroup: "workers",
+		Recorder:      recorder,
+	})(subscriber)
+	require.NoError(t, err)
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	messages, err := decorated.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	(<-messages).Nack()
+	(<-messages).Ack()
+
+	assert.Eventually(t, func() bool {
+		return recorder.consumedCount() == 2
+	}, time.Second*5, time.Millisecond*10)
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	expectedLabels := sql.MetricsLabels{
+		Topic:   topic,
+		Table:   "watermill_" + topic,
+		Dialect: "sqlite",
+	}
+	assert.Equal(t, []sql.MetricsLabels{expectedLabels}, recorder.published)
+
+	expectedLabels.ConsumerGroup = "workers"
+	assert.Equal(t, []recordedConsume{
+		{Labels: expectedLabels, Acked: false},
+		{Labels: expectedLabels, Acked: true},
+	}, recorder.consumed)
+}
+
+func TestNewPublisherMetricsDecorator_invalidConfig(t *testing.T) {
+	_, err := sql.NewPublisherMetricsDecorator(sql.MetricsConfig{
+		SchemaAdapter: sql.DefaultSQLiteSchema{},
+	})(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,171 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+type MigrateTopicOptions struct {
+	// SchemaAdapter reads the messages of fromTopic and writes them to toTopic. It's required.
+	// It has the same requirements as ImporterConfig.SourceSchemaAdapter.
+	SchemaAdapter SchemaAdapter
+
+	// OffsetsAdapter is used to copy the offsets of consumer groups. It's required.
+	OffsetsAdapter CheckpointingOffsetsAdapter
+
+	// CutoverWindow is the time for which messages published to fromTopic after the initial copy
+	// are still copied to toTopic, so publishers can be switched to toTopic without downtime.
+	// The offsets of consumer groups are copied after the window ends.
+	//
+	// If it's zero, offsets are copied right after the initial copy of messages.
+	CutoverWindow time.Duration
+
+	// PollInterval is the interval of checking for new messages of fromTopic during CutoverWindow.
+	//
+	// Default value is 1s.
+	PollInterval time.Duration
+
+	// InsertBatchSize is the maximum number of messages inserted with one query.
+	//
+	// Default value is 100.
+	InsertBatchSize int
+}
+
+func (o *MigrateTopicOptions) setDefaults() {
+	if o.PollInterval == 0 {
+		o.PollInterval = time.Second
+	}
+}
+
+func (o MigrateTopicOptions) validate() error {
+	if o.SchemaAdapter == nil {
+		return errors.New("schema adapter is nil")
+	}
+	if o.OffsetsAdapter == nil {
+		return errors.New("offsets adapter is nil")
+	}
+	if o.CutoverWindow < 0 {
+		return errors.New("cutover window must be non-negative")
+	}
+	if o.PollInterval < 0 {
+		return errors.New("poll interval must be positive")
+	}
+
+	return nil
+}
+
+// MigrateTopicResult describes the messages and offsets copied by MigrateTopic.
+type MigrateTopicResult struct {
+	// Copied is the number of messages inserted to toTopic.
+	Copied int
+
+	// ConsumerGroups is the number of consumer groups with offsets copied to toTopic.
+	ConsumerGroups int
+}
+
+// MigrateTopic copies the messages which weren't consumed yet by all consumer groups of fromTopic to toTopic,
+// and moves the consumer groups to the same messages in toTopic, so topics can be renamed or re-partitioned
+// (for example, moved to a schema adapter with a different table layout) without downtime.
+//
+// The migration goes as follows:
+//
+//  1. Messages after the lowest acked offset of all consumer groups are copied (all messages if there are none).
+//  2. During CutoverWindow, messages published to fromTopic in the meantime are copied as well,
+//     in the order of publishing. Publishers should be switched to toTopic within the window.
+//  3. Offsets of the consumer groups are copied with ExportCheckpoint and ImportCheckpoint.
+//     Subscribers of fromTopic should be stopped before the window ends, and started for toTopic afterward.
+//
+// Messages of fromTopic are not deleted. The last message acked by any consumer group must still exist.
+func MigrateTopic(
+	ctx context.Context,
+	db TxBeginner,
+	fromTopic string,
+	toTopic string,
+	options MigrateTopicOptions,
+	logger watermill.LoggerAdapter,
+) (MigrateTopicResult, error) {
+	options.setDefaults()
+	if err := options.validate(); err != nil {
+		return MigrateTopicResult{}, errors.Wrap(err, "invalid options")
+	}
+	if fromTopic == toTopic {
+		return MigrateTopicResult{}, errors.New("topics must be different")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+	logger = logger.With(watermill.LogFields{
+		"from_topic": fromTopic,
+		"to_topic":   toTopic,
+	})
+
+	checkpoint, err := ExportCheckpoint(ctx, db, options.SchemaAdapter, options.OffsetsAdapter, fromTopic)
+	if err != nil {
+		return MigrateTopicResult{}, errors.Wrap(err, "could not export offsets")
+	}
+
+	// The message acked last by the slowest consumer group is copied too, so its offset can be mapped to toTopic.
+	var afterOffset int64
+	for i, group := range checkpoint.ConsumerGroups {
+		if i == 0 || group.OffsetAcked-1 < afterOffset {
+			afterOffset = group.OffsetAcked - 1
+		}
+	}
+	if afterOffset < 0 {
+		afterOffset = 0
+	}
+
+	importer, err := NewImporter(db, db, ImporterConfig{
+		SourceSchemaAdapter:      options.SchemaAdapter,
+		DestinationSchemaAdapter: options.SchemaAdapter,
+		InsertBatchSize:          options.InsertBatchSize,
+		InitializeSchema:         true,
+	}, logger)
+	if err != nil {
+		return MigrateTopicResult{}, errors.Wrap(err, "could not create importer")
+	}
+
+	var result MigrateTopicResult
+	cutoverEnd := time.Now().Add(options.CutoverWindow)
+
+	for {
+		imported, err := importer.ImportAfter(ctx, fromTopic, toTopic, afterOffset)
+		result.Copied += imported.Imported
+		if err != nil {
+			return result, errors.Wrap(err, "could not copy messages")
+		}
+		afterOffset = imported.LastSourceOffset
+
+		if !time.Now().Before(cutoverEnd) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(options.PollInterval):
+		}
+	}
+
+	logger.Info("Messages copied, copying offsets", watermill.LogFields{
+		"copied":             result.Copied,
+		"last_source_offset": afterOffset,
+	})
+
+	checkpoint, err = ExportCheckpoint(ctx, db, options.SchemaAdapter, options.OffsetsAdapter, fromTopic)
+	if err != nil {
+		return result, errors.Wrap(err, "could not export offsets")
+	}
+
+	err = ImportCheckpoint(ctx, db, options.SchemaAdapter, options.OffsetsAdapter, toTopic, checkpoint)
+	if err != nil {
+		return result, errors.Wrap(err, "could not import offsets")
+	}
+	result.ConsumerGroups = len(checkpoint.ConsumerGroups)
+
+	return result, nil
+}
@@ -0,0 +1,68 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateTopic(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "migrate.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	schemaAdapter := sql.DefaultSQLiteSchema{SubscribeBatchSize: 1}
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+	fromTopic := "migrate_from_" + watermill.NewShortUUID()
+	toTopic := "migrate_to_" + watermill.NewShortUUID()
+
+	var uuids []string
+	publisher := newCheckpointPublisher(t, db, schemaAdapter)
+	publish := func() {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(strconv.Itoa(len(uuids))))
+		require.NoError(t, publisher.Publish(fromTopic, msg))
+		uuids = append(uuids, msg.UUID)
+	}
+	for i := 0; i < 5; i++ {
+		publish()
+	}
+
+	// The consumer group acks the first three messages.
+	assert.Equal(t, uuids[0:4], consumeCheckpointMessages(t, db, schemaAdapter, offsetsAdapter, fromTopic, 4))
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		time.Sleep(time.Millisecond * 50)
+		publish()
+	}()
+
+	result, err := sql.MigrateTopic(context.Background(), db, fromTopic, toTopic, sql.MigrateTopicOptions{
+		SchemaAdapter:  schemaAdapter,
+		OffsetsAdapter: offsetsAdapter,
+		CutoverWindow:  time.Millisecond * 300,
+		PollInterval:   time.Millisecond * 10,
+	}, logger)
+	require.NoError(t, err)
+	<-published
+
+	// The last message acked by the consumer group is copied as well, to map its offset.
+	assert.Equal(t, sql.MigrateTopicResult{Copied: 4, ConsumerGroups: 1}, result)
+	assert.Equal(t, uuids[3:6], consumeCheckpointMessages(t, db, schemaAdapter, offsetsAdapter, toTopic, 3))
+
+	_, err = sql.MigrateTopic(context.Background(), db, fromTopic, fromTopic, sql.MigrateTopicOptions{
+		SchemaAdapter:  schemaAdapter,
+		OffsetsAdapter: offsetsAdapter,
+	}, logger)
+	assert.ErrorContains(t, err, "topics must be different")
+}
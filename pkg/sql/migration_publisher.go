@@ -0,0 +1,313 @@
+package sql
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+type MigrationPublisherConfig struct {
+	// Primary publishes to the backend which is migrated from, and which is the source of truth
+	// until the migration is finished. It's required.
+	Primary message.Publisher
+
+	// Secondary publishes to the backend which is migrated to. It's required.
+	Secondary message.Publisher
+
+	// TolerateSecondaryFailures makes Publish succeed when the messages were published with Primary,
+	// but Secondary failed, for example, when the new backend shouldn't affect the availability of the system yet.
+	// The failures are logged and counted, and the missing messages are reported by VerifyMigration.
+	//
+	// By default, Publish returns the error of Secondary, so the messages are retried by the caller.
+	// Retried messages are published to Primary again, so both publishers should deduplicate the messages
+	// (see PublisherConfig.Deduplicator), or consumers must be idempotent.
+	TolerateSecondaryFailures bool
+}
+
+func (c MigrationPublisherConfig) validate() error {
+	if c.Primary == nil {
+		return errors.New("primary publisher is nil")
+	}
+	if c.Secondary == nil {
+		return errors.New("secondary publisher is nil")
+	}
+
+	return nil
+}
+
+// MigrationPublisher writes every message to two backends (like SQLite and PostgreSQL),
+// for migrating a live system from one database to the other without losing messages:
+//
+//  1. Publishers are switched to MigrationPublisher, so new messages are written to both backends.
+//  2. Messages published before the dual writes started are copied to the new backend with Importer.
+//  3. VerifyMigration compares the messages of the backends.
+//  4. Subscribers are switched to the new backend (continuing after the messages they consumed from the old one),
+//     and publishers are switched to the new backend's publisher.
+//
+// Messages are published with Primary first, and with Secondary after they are stored by Primary,
+// so the new backend never has messages which are missing in the old one, except for messages published
+// while Primary failed after storing them.
+type MigrationPublisher struct {
+	config MigrationPublisherConfig
+
+	secondaryFailures int64
+
+	closed    bool
+	closeOnce sync.Once
+
+	logger watermill.LoggerAdapter
+}
+
+func NewMigrationPublisher(config MigrationPublisherConfig, logger watermill.LoggerAdapter) (*MigrationPublisher, error) {
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &MigrationPublisher{
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// Publish publishes the messages with Primary, and then with Secondary.
+// Secondary publishes copies of the messages, so it's not affected by the changes made by Primary.
+func (p *MigrationPublisher) Publish(topic string, messages ...*message.Message) error {
+	if p.closed {
+		return ErrPublisherClosed
+	}
+
+	copies := make([]*message.Message, len(messages))
+	for i, msg := range messages {
+		copies[i] = msg.Copy()
+		copies[i].SetContext(msg.Context())
+	}
+
+	if err := p.config.Primary.Publish(topic, messages...); err != nil {
+		return errors.Wrap(err, "could not publish to primary")
+	}
+
+	if err := p.config.Secondary.Publish(topic, copies...); err != nil {
+		atomic.AddInt64(&p.secondaryFailures, 1)
+
+		if !p.config.TolerateSecondaryFailures {
+			return errors.Wrap(err, "messages were published to primary, but not to secondary")
+		}
+
+		p.logger.Error("Could not publish messages to secondary", err, watermill.LogFields{
+			"topic":    topic,
+			"messages": len(messages),
+		})
+	}
+
+	return nil
+}
+
+// SecondaryFailures returns the number of Publish calls which published the messages to Primary, but not to Secondary.
+func (p *MigrationPublisher) SecondaryFailures() int64 {
+	return atomic.LoadInt64(&p.secondaryFailures)
+}
+
+// Close closes both publishers.
+func (p *MigrationPublisher) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		p.closed = true
+
+		if closeErr := p.config.Primary.Close(); closeErr != nil {
+			err = errors.Wrap(closeErr, "could not close primary publisher")
+		}
+		if closeErr := p.config.Secondary.Close(); closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "could not close secondary publisher")
+		}
+	})
+
+	return err
+}
+
+// messagesTableAdapter is implemented by the schema adapters storing the messages of a topic in one table.
+type messagesTableAdapter interface {
+	MessagesTable(topic string) string
+}
+
+type VerifyMigrationOptions struct {
+	// SourceSchemaAdapter defines the messages table of the topic in the source database. It's required.
+	SourceSchemaAdapter SchemaAdapter
+
+	// DestinationSchemaAdapter defines the messages table of the topic in the destination database. It's required.
+	DestinationSchemaAdapter SchemaAdapter
+
+	// MaxReportedUUIDs is the maximum number of UUIDs listed in MigrationVerification.MissingInDestination
+	// and MigrationVerification.MissingInSource. All missing messages are counted.
+	//
+	// Default value is 100.
+	MaxReportedUUIDs int
+}
+
+func (o *VerifyMigrationOptions) setDefaults() {
+	if o.MaxReportedUUIDs == 0 {
+		o.MaxReportedUUIDs = 100
+	}
+}
+
+func (o VerifyMigrationOptions) validate() error {
+	if o.SourceSchemaAdapter == nil {
+		return errors.New("source schema adapter is nil")
+	}
+	if o.DestinationSchemaAdapter == nil {
+		return errors.New("destination schema adapter is nil")
+	}
+	if _, ok := o.SourceSchemaAdapter.(messagesTableAdapter); !ok {
+		return errors.Errorf("source schema adapter %T doesn't define the messages table", o.SourceSchemaAdapter)
+	}
+	if _, ok := o.DestinationSchemaAdapter.(messagesTableAdapter); !ok {
+		return errors.Errorf("destination schema adapter %T doesn't define the messages table", o.DestinationSchemaAdapter)
+	}
+	if o.MaxReportedUUIDs < 0 {
+		return errors.New("max reported uuids must be non-negative")
+	}
+
+	return nil
+}
+
+// MigrationVerification is the result of VerifyMigration.
+type MigrationVerification struct {
+	SourceMessages      int
+	DestinationMessages int
+
+	// MissingInDestinationCount is the number of messages of the source which are not in the destination.
+	// MissingInDestination lists their UUIDs, up to VerifyMigrationOptions.MaxReportedUUIDs.
+	MissingInDestinationCount int
+	MissingInDestination      []string
+
+	// MissingInSourceCount is the number of messages of the destination which are not in the source.
+	// MissingInSource lists their UUIDs, up to VerifyMigrationOptions.MaxReportedUUIDs.
+	MissingInSourceCount int
+	MissingInSource      []string
+
+	// DuplicatesInDestination is the number of messages of the destination with UUIDs stored more than once,
+	// for example, because publishing was retried without deduplication.
+	DuplicatesInDestination int
+}
+
+// Consistent returns true if the destination has all messages of the source, and no other messages.
+// Duplicates are allowed.
+func (v MigrationVerification) Consistent() bool {
+	return v.MissingInDestinationCount == 0 && v.MissingInSourceCount == 0
+}
+
+// VerifyMigration compares the messages of the topic in the source and destination databases by their UUIDs,
+// for checking that a migration (with MigrationPublisher and Importer) didn't lose messages.
+// Messages are compared by the UUIDs of all messages of the topics, so messages deleted only from one of the databases
+// (for example, by DeleteAckedMessages) are reported as missing.
+//
+// It may be executed while messages are published: the source is read before the destination,
+// so messages published meanwhile are not reported as missing in the destination, and messages
+// missing in the source are checked again after the destination is read.
+//
+// The UUIDs are read from the messages tables of the schema adapters (with the uuid column), so schema adapters
+// storing a topic in multiple tables (like TimePartitionedSchema) are not supported.
+func VerifyMigration(
+	ctx context.Context,
+	source QueryExecutor,
+	destination QueryExecutor,
+	topic string,
+	options VerifyMigrationOptions,
+) (MigrationVerification, error) {
+	options.setDefaults()
+	if err := options.validate(); err != nil {
+		return MigrationVerification{}, errors.Wrap(err, "invalid options")
+	}
+	if err := validateTopic(options.SourceSchemaAdapter, topic); err != nil {
+		return MigrationVerification{}, err
+	}
+	if err := validateTopic(options.DestinationSchemaAdapter, topic); err != nil {
+		return MigrationVerification{}, err
+	}
+
+	sourceTable := options.SourceSchemaAdapter.(messagesTableAdapter).MessagesTable(topic)
+	destinationTable := options.DestinationSchemaAdapter.(messagesTableAdapter).MessagesTable(topic)
+
+	sourceUUIDs, sourceMessages, err := readMessageUUIDs(ctx, source, sourceTable)
+	if err != nil {
+		return MigrationVerification{}, errors.Wrap(err, "could not read source messages")
+	}
+	destinationUUIDs, destinationMessages, err := readMessageUUIDs(ctx, destination, destinationTable)
+	if err != nil {
+		return MigrationVerification{}, errors.Wrap(err, "could not read destination messages")
+	}
+
+	verification := MigrationVerification{
+		SourceMessages:          sourceMessages,
+		DestinationMessages:     destinationMessages,
+		DuplicatesInDestination: destinationMessages - len(destinationUUIDs),
+	}
+
+	missingInDestination := missingUUIDs(sourceUUIDs, destinationUUIDs)
+	missingInSource := missingUUIDs(destinationUUIDs, sourceUUIDs)
+	if len(missingInSource) > 0 {
+		// The messages could be published to both databases after the source was read.
+		sourceUUIDs, _, err = readMessageUUIDs(ctx, source, sourceTable)
+		if err != nil {
+			return MigrationVerification{}, errors.Wrap(err, "could not read source messages")
+		}
+		missingInSource = missingUUIDs(destinationUUIDs, sourceUUIDs)
+	}
+
+	verification.MissingInDestinationCount = len(missingInDestination)
+	verification.MissingInDestination = reportedUUIDs(missingInDestination, options.MaxReportedUUIDs)
+	verification.MissingInSourceCount = len(missingInSource)
+	verification.MissingInSource = reportedUUIDs(missingInSource, options.MaxReportedUUIDs)
+
+	return verification, nil
+}
+
+// readMessageUUIDs returns the distinct UUIDs of the messages of the table, and the number of the messages.
+func readMessageUUIDs(ctx context.Context, db QueryExecutor, messagesTable string) (map[string]struct{}, int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT uuid FROM `+messagesTable)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "could not query uuids")
+	}
+	defer rows.Close()
+
+	uuids := map[string]struct{}{}
+	messages := 0
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			return nil, 0, errors.Wrap(err, "could not scan uuid")
+		}
+		uuids[uuid] = struct{}{}
+		messages++
+	}
+
+	return uuids, messages, rows.Err()
+}
+
+// missingUUIDs returns the sorted UUIDs of from which are not in to.
+func missingUUIDs(from map[string]struct{}, to map[string]struct{}) []string {
+	var missing []string
+	for uuid := range from {
+		if _, ok := to[uuid]; !ok {
+			missing = append(missing, uuid)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
+
+func reportedUUIDs(uuids []string, limit int) []string {
+	if len(uuids) > limit {
+		return uuids[:limit]
+	}
+	return uuids
+}
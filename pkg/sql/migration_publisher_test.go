@@ -0,0 +1,92 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingPublisher struct {
+	message.Publisher
+	failing bool
+}
+
+func (p *failingPublisher) Publish(topic string, messages ...*message.Message) error {
+	if p.failing {
+		return errors.New("backend is down")
+	}
+	return p.Publisher.Publish(topic, messages...)
+}
+
+func TestMigrationPublisher(t *testing.T) {
+	ctx := context.Background()
+	schemaAdapter := sql.DefaultSQLiteSchema{}
+	topic := "migrated"
+
+	openDB := func(name string) sql.TxBeginner {
+		db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), name)+"?_pragma=busy_timeout(10000)")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = db.Close()
+		})
+		return sql.BeginnerFromStdSQL(db)
+	}
+	oldDB, newDB := openDB("old.sqlite"), openDB("new.sqlite")
+
+	secondary := &failingPublisher{Publisher: newCheckpointPublisher(t, newDB, schemaAdapter)}
+	publisher, err := sql.NewMigrationPublisher(sql.MigrationPublisherConfig{
+		Primary:   newCheckpointPublisher(t, oldDB, schemaAdapter),
+		Secondary: secondary,
+	}, logger)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte("payload"))))
+	}
+
+	options := sql.VerifyMigrationOptions{
+		SourceSchemaAdapter:      schemaAdapter,
+		DestinationSchemaAdapter: schemaAdapter,
+	}
+	verification, err := sql.VerifyMigration(ctx, oldDB, newDB, topic, options)
+	require.NoError(t, err)
+	assert.True(t, verification.Consistent())
+	assert.Equal(t, 3, verification.SourceMessages)
+	assert.Equal(t, 3, verification.DestinationMessages)
+
+	secondary.failing = true
+	lost := message.NewMessage(watermill.NewUUID(), nil)
+	assert.Error(t, publisher.Publish(topic, lost))
+	assert.EqualValues(t, 1, publisher.SecondaryFailures())
+
+	verification, err = sql.VerifyMigration(ctx, oldDB, newDB, topic, options)
+	require.NoError(t, err)
+	assert.False(t, verification.Consistent())
+	assert.Equal(t, 1, verification.MissingInDestinationCount)
+	assert.Equal(t, []string{lost.UUID}, verification.MissingInDestination)
+	assert.Zero(t, verification.MissingInSourceCount)
+
+	tolerating, err := sql.NewMigrationPublisher(sql.MigrationPublisherConfig{
+		Primary:                   newCheckpointPublisher(t, oldDB, schemaAdapter),
+		Secondary:                 secondary,
+		TolerateSecondaryFailures: true,
+	}, logger)
+	require.NoError(t, err)
+	require.NoError(t, tolerating.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+	assert.EqualValues(t, 1, tolerating.SecondaryFailures())
+
+	verification, err = sql.VerifyMigration(ctx, oldDB, newDB, topic, options)
+	require.NoError(t, err)
+	assert.Equal(t, 2, verification.MissingInDestinationCount)
+
+	require.NoError(t, publisher.Close())
+	assert.ErrorIs(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)), sql.ErrPublisherClosed)
+}
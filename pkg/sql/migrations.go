@@ -0,0 +1,149 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MigrationFormat is the format of the migration files rendered by RenderMigrations.
+type MigrationFormat int
+
+const (
+	// MigrationFormatGolangMigrate renders separate up and down files, like "20240101120000_orders.up.sql",
+	// as expected by golang-migrate. The statements of a file are executed at once, so MySQL connections
+	// of golang-migrate need multiStatements enabled.
+	MigrationFormatGolangMigrate MigrationFormat = iota
+
+	// MigrationFormatGoose renders one file with annotated up and down sections, like "20240101120000_orders.sql",
+	// as expected by goose.
+	MigrationFormatGoose
+)
+
+// MigrationFile is a migration file rendered by RenderMigrations.
+type MigrationFile struct {
+	// Name is the name of the file, including the version prefix.
+	Name string
+
+	Content string
+}
+
+type RenderMigrationsOptions struct {
+	// Format is the format of the rendered files.
+	//
+	// Default value is MigrationFormatGolangMigrate.
+	Format MigrationFormat
+
+	// Version is the version prefix of the file names.
+	//
+	// Default value is the current UTC time, like "20240101120000".
+	Version string
+
+	// Name is the name of the migration, appended to the version.
+	//
+	// Default value is "watermill_" followed by the topic.
+	Name string
+}
+
+// RenderMigrations renders the schema initializing queries of the schema and offsets adapters for the topic
+// as migration files, instead of executing them. It may be used when the database user of the application
+// has no rights to create tables, so the schema is created by the team's migration pipeline.
+// Publishers and subscribers should have schema initialization disabled then.
+//
+// The down migration drops the tables returned by MessagesTable of the schema adapter
+// and MessagesOffsetsTable of the offsets adapter, if they implement these methods.
+// offsetsAdapter may be nil, for topics which are only published to.
+func RenderMigrations(
+	schemaAdapter SchemaAdapter,
+	offsetsAdapter OffsetsAdapter,
+	topic string,
+	options RenderMigrationsOptions,
+) ([]MigrationFile, error) {
+	if err := validateTopic(schemaAdapter, topic); err != nil {
+		return nil, err
+	}
+
+	queries := schemaAdapter.SchemaInitializingQueries(topic)
+	if offsetsAdapter != nil {
+		queries = append(queries, offsetsAdapter.SchemaInitializingQueries(topic)...)
+	}
+
+	var up []string
+	for _, q := range queries {
+		if len(q.Args) > 0 {
+			return nil, errors.Errorf("query with arguments can't be rendered as a migration: %s", q.Query)
+		}
+		up = append(up, migrationStatement(q.Query))
+	}
+
+	// Offsets reference the messages, so they are dropped first.
+	var down []string
+	if tableAdapter, ok := offsetsAdapter.(interface{ MessagesOffsetsTable(topic string) string }); ok {
+		down = append(down, migrationStatement(`DROP TABLE IF EXISTS `+tableAdapter.MessagesOffsetsTable(topic)))
+	}
+	if tableAdapter, ok := schemaAdapter.(interface{ MessagesTable(topic string) string }); ok {
+		down = append(down, migrationStatement(`DROP TABLE IF EXISTS `+tableAdapter.MessagesTable(topic)))
+	}
+
+	version := options.Version
+	if version == "" {
+		version = time.Now().UTC().Format("20060102150405")
+	}
+	name := options.Name
+	if name == "" {
+		name = "watermill_" + topic
+	}
+	prefix := version + "_" + name
+
+	switch options.Format {
+	case MigrationFormatGolangMigrate:
+		return []MigrationFile{
+			{Name: prefix + ".up.sql", Content: strings.Join(up, "\n\n") + "\n"},
+			{Name: prefix + ".down.sql", Content: strings.Join(down, "\n\n") + "\n"},
+		}, nil
+	case MigrationFormatGoose:
+		content := "-- +goose Up\n" + gooseStatements(up) + "\n-- +goose Down\n" + gooseStatements(down)
+		return []MigrationFile{{Name: prefix + ".sql", Content: content}}, nil
+	default:
+		return nil, errors.Errorf("unknown migration format %d", options.Format)
+	}
+}
+
+// migrationStatement removes the common indentation of the generated query, and terminates it with a semicolon.
+func migrationStatement(query string) string {
+	lines := strings.Split(strings.TrimSpace(query), "\n")
+
+	indentation := -1
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lineIndentation := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indentation == -1 || lineIndentation < indentation {
+			indentation = lineIndentation
+		}
+	}
+
+	for i, line := range lines[1:] {
+		line = strings.TrimRight(line, " \t")
+		if len(line) >= indentation && indentation > 0 {
+			line = line[indentation:]
+		}
+		lines[i+1] = line
+	}
+
+	return strings.TrimSuffix(strings.Join(lines, "\n"), ";") + ";"
+}
+
+// gooseStatements wraps every statement in StatementBegin and StatementEnd annotations,
+// so goose doesn't split statements containing semicolons.
+func gooseStatements(statements []string) string {
+	var b strings.Builder
+	for _, statement := range statements {
+		fmt.Fprintf(&b, "-- +goose StatementBegin\n%s\n-- +goose StatementEnd\n", statement)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderMigrations_golangMigrate(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topic := "migrated_" + watermill.NewShortUUID()
+
+	files, err := sql.RenderMigrations(
+		sql.DefaultSQLiteSchema{},
+		sql.DefaultSQLiteOffsetsAdapter{},
+		topic,
+		sql.RenderMigrationsOptions{Version: "20240101120000"},
+	)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	up, down := files[0], files[1]
+	assert.Equal(t, "20240101120000_watermill_"+topic+".up.sql", up.Name)
+	assert.Equal(t, "20240101120000_watermill_"+topic+".down.sql", down.Name)
+
+	ctx := context.Background()
+	_, err = db.ExecContext(ctx, up.Content)
+	require.NoError(t, err)
+
+	publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+		SchemaAdapter: sql.DefaultSQLiteSchema{},
+	}, logger)
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte("{}"))))
+
+	_, err = db.ExecContext(ctx, down.Content)
+	require.NoError(t, err)
+
+	rows, err := db.QueryContext(ctx, `SELECT "name" FROM "sqlite_master" WHERE "name" LIKE ?`, "%"+topic)
+	require.NoError(t, err)
+	defer rows.Close()
+	assert.False(t, rows.Next(), "tables should be dropped")
+}
+
+func TestRenderMigrations_goose(t *testing.T) {
+	files, err := sql.RenderMigrations(
+		sql.DefaultSQLiteSchema{},
+		nil,
+		"orders",
+		sql.RenderMigrationsOptions{Format: sql.MigrationFormatGoose, Version: "1", Name: "orders_topic"},
+	)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	assert.Equal(t, "1_orders_topic.sql", files[0].Name)
+	assert.Equal(t, `-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "watermill_orders" (
+	"offset" INTEGER PRIMARY KEY AUTOINCREMENT,
+	"uuid" TEXT NOT NULL,
+	"created_at" TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	"payload" BLOB,
+	"metadata" TEXT
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "watermill_orders";
+-- +goose StatementEnd
+`, files[0].Content)
+}
+
+func TestRenderMigrations_invalidTopic(t *testing.T) {
+	_, err := sql.RenderMigrations(sql.DefaultSQLiteSchema{}, nil, "orders; DROP TABLE users", sql.RenderMigrationsOptions{})
+	assert.ErrorIs(t, err, sql.ErrInvalidTopicName)
+}
@@ -0,0 +1,47 @@
+package sql
+
+import "time"
+
+// nextOffsetCache is the last message acked by the subscription, used instead of NextOffsetQuery
+// when selecting the following batches (see SubscriberConfig.CacheNextOffset).
+type nextOffsetCache struct {
+	lastAcked *Row
+
+	// validatedAt is when the acked offset was last queried from the database.
+	validatedAt time.Time
+}
+
+// invalidate discards the cached offset, so the next batch is selected with NextOffsetQuery.
+func (c *nextOffsetCache) invalidate() {
+	c.lastAcked = nil
+	c.validatedAt = time.Time{}
+}
+
+// selectOffsetsAdapter returns the offsets adapter passed to SelectQuery. When the cached offset is valid,
+// it returns the messages after the last acked message, without querying the acked offset, and true.
+func (s *Subscriber) selectOffsetsAdapter(topic string, cache *nextOffsetCache) (OffsetsAdapter, bool) {
+	if !s.config.CacheNextOffset || cache.lastAcked == nil {
+		return s.config.OffsetsAdapter, false
+	}
+	if s.config.OffsetsAdapter.NextOffsetQuery(topic, s.config.ConsumerGroup).IsZero() {
+		// Offsets adapters without NextOffsetQuery (like PostgreSQLQueueOffsetsAdapter) don't select by offsets.
+		return s.config.OffsetsAdapter, false
+	}
+	if time.Since(cache.validatedAt) >= s.config.NextOffsetRevalidationInterval {
+		// The offset may have been changed by another subscriber of the consumer group,
+		// or by an operator (for example, with SetAckedOffset).
+		cache.invalidate()
+		return s.config.OffsetsAdapter, false
+	}
+
+	return prefetchOffsetsAdapter{after: *cache.lastAcked}, true
+}
+
+// acked caches the last acked message of the batch. If the batch was selected with NextOffsetQuery,
+// the offset is valid since the batch was selected.
+func (c *nextOffsetCache) acked(lastAcked Row, cached bool, selectedAt time.Time) {
+	c.lastAcked = &lastAcked
+	if !cached {
+		c.validatedAt = selectedAt
+	}
+}
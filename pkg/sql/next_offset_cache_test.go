@@ -0,0 +1,104 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_CacheNextOffset(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		revalidationInterval time.Duration
+		expectRedelivery     bool
+	}{
+		{name: "cached", revalidationInterval: time.Hour, expectRedelivery: false},
+		{name: "revalidated", revalidationInterval: time.Millisecond, expectRedelivery: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB := newSQLite(t)
+			db := sql.BeginnerFromStdSQL(sqlDB)
+			topicName := "next_offset_" + watermill.NewShortUUID()
+			schemaAdapter := newSQLiteSchemaAdapter(10)
+			offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+
+			leaseStore := sql.SQLiteLeaseStore{DB: db}
+			require.NoError(t, leaseStore.InitializeSchema(context.Background()))
+
+			publisher := newCheckpointPublisher(t, db, schemaAdapter)
+			first := message.NewMessage(watermill.NewUUID(), nil)
+			require.NoError(t, publisher.Publish(topicName, first))
+
+			subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+				ConsumerGroup:                  "next_offset",
+				SchemaAdapter:                  schemaAdapter,
+				OffsetsAdapter:                 offsetsAdapter,
+				InitializeSchema:               true,
+				PollInterval:                   time.Millisecond * 10,
+				CacheNextOffset:                true,
+				NextOffsetRevalidationInterval: tc.revalidationInterval,
+				LeaseStore:                     leaseStore,
+			}, logger)
+			require.NoError(t, err)
+			defer subscriber.Close()
+
+			consumed, err := subscriber.Subscribe(context.Background(), topicName)
+			require.NoError(t, err)
+
+			receive := func() *message.Message {
+				select {
+				case msg := <-consumed:
+					msg.Ack()
+					return msg
+				case <-time.After(time.Second * 5):
+					t.Fatal("timeout waiting for message")
+					return nil
+				}
+			}
+
+			assert.Equal(t, first.UUID, receive().UUID)
+
+			offsetAcked := func() int64 {
+				var offset int64
+				err := sqlDB.QueryRow(`SELECT offset_acked FROM `+offsetsAdapter.MessagesOffsetsTable(topicName)+` WHERE consumer_group = ?`, "next_offset").Scan(&offset)
+				if err != nil {
+					return 0
+				}
+				return offset
+			}
+			require.Eventually(t, func() bool { return offsetAcked() == 1 }, time.Second*5, time.Millisecond*10)
+
+			// The offset is changed behind the subscriber's back, which is noticed only when it's revalidated.
+			_, err = sqlDB.Exec(`UPDATE `+offsetsAdapter.MessagesOffsetsTable(topicName)+` SET offset_acked = 0 WHERE consumer_group = ?`, "next_offset")
+			require.NoError(t, err)
+
+			if tc.expectRedelivery {
+				assert.Equal(t, first.UUID, receive().UUID)
+			} else {
+				// A few polls pass with the cached offset.
+				time.Sleep(time.Millisecond * 50)
+			}
+
+			second := message.NewMessage(watermill.NewUUID(), nil)
+			require.NoError(t, publisher.Publish(topicName, second))
+			assert.Equal(t, second.UUID, receive().UUID)
+		})
+	}
+}
+
+func TestSubscriberConfig_CacheNextOffsetRequiresLeaseStore(t *testing.T) {
+	_, err := sql.NewSubscriber(newSQLite(t), sql.SubscriberConfig{
+		SchemaAdapter:   sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:  sql.DefaultSQLiteOffsetsAdapter{},
+		CacheNextOffset: true,
+	}, logger)
+	assert.ErrorContains(t, err, "LeaseStore is required")
+}
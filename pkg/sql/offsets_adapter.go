@@ -21,3 +21,78 @@ type OffsetsAdapter interface {
 	// All queries will be executed in a single transaction.
 	BeforeSubscribingQueries(topic string, consumerGroup string) []Query
 }
+
+// OptimisticOffsetsAdapter is an optional interface of OffsetsAdapter,
+// implemented by adapters for databases which can't lock the consumer group row.
+//
+// When ConsumedMessageQueryIsConditional returns true, ConsumedMessageQuery is expected to be
+// a conditional (compare-and-swap) update of the consumer group offset.
+// If it affects no rows, the message was already consumed by another subscriber,
+// so the subscriber rolls back the transaction with ErrOffsetConflict and queries again.
+type OptimisticOffsetsAdapter interface {
+	OffsetsAdapter
+
+	ConsumedMessageQueryIsConditional() bool
+}
+
+// NonTransactionalOffsetsAdapter is an optional interface of OffsetsAdapter,
+// implemented by adapters for databases or drivers which don't support interactive transactions.
+//
+// When an offsets adapter implements NonTransactionalOffsetsAdapter, the subscriber executes all queries
+// outside of a transaction. Each message is claimed with ConsumedMessageQuery before it's sent,
+// and acked separately with AckMessageQuery.
+// The messages' context doesn't contain a transaction, so TxFromContext returns false.
+type NonTransactionalOffsetsAdapter interface {
+	OffsetsAdapter
+
+	// ReleaseMessageQuery returns the SQL query and arguments which will release the claim of a message
+	// made by ConsumedMessageQuery, when the message was not acked (for example, because the subscriber is closing).
+	ReleaseMessageQuery(topic string, row Row, consumerGroup string) Query
+}
+
+// MessageAckingOffsetsAdapter is an optional interface of OffsetsAdapter, implemented by adapters which store
+// the consumption state of every message, instead of the acked offset (like PostgreSQLQueueOffsetsAdapter).
+//
+// When AcksEveryMessage returns true, the subscriber executes AckMessageQuery for every acked message of a batch,
+// instead of only for the last one.
+type MessageAckingOffsetsAdapter interface {
+	OffsetsAdapter
+
+	AcksEveryMessage() bool
+}
+
+func offsetsAdapterAcksEveryMessage(offsetsAdapter OffsetsAdapter) bool {
+	ackingAdapter, ok := offsetsAdapter.(MessageAckingOffsetsAdapter)
+	return ok && ackingAdapter.AcksEveryMessage()
+}
+
+// ReconcilingOffsetsAdapter is an optional interface of OffsetsAdapter, implemented by adapters which store
+// the consumed offset separately from the acked offset. It's used by ReconcileOrphanedOffsets.
+type ReconcilingOffsetsAdapter interface {
+	OffsetsAdapter
+
+	// OrphanedOffsetsQuery returns the SQL query and arguments which select consumer_group, offset_acked
+	// and offset_consumed of consumer groups with a consumed offset ahead of the acked offset,
+	// which are not consumed by any subscriber at the moment.
+	OrphanedOffsetsQuery(topic string) Query
+
+	// ResetConsumedOffsetQuery returns the SQL query and arguments which move the consumed offset of the consumer group
+	// back to the acked offset, if the consumed offset is still equal to offsetConsumed.
+	ResetConsumedOffsetQuery(topic string, consumerGroup string, offsetConsumed int64) Query
+}
+
+// PartitionedOffsetsAdapter is an optional interface of OffsetsAdapter, implemented by adapters which store
+// a separate offset for every partition of the topic, so subscribers of one consumer group can consume
+// different partitions concurrently. Schema adapters supporting it (like DefaultMySQLSchema) select
+// the messages of the partition locked by NextPartitionQuery, instead of using NextOffsetQuery.
+type PartitionedOffsetsAdapter interface {
+	OffsetsAdapter
+
+	// NextPartitionQuery returns the SQL query and arguments which lock one partition of the consumer group
+	// with messages to consume, skipping partitions locked by other subscribers,
+	// and select its partition_id and offset_acked.
+	NextPartitionQuery(topic string, consumerGroup string, messagesTable string) Query
+
+	// PartitionExpression returns the SQL expression computing the partition of a message from its offset column.
+	PartitionExpression(offsetColumn string) string
+}
@@ -0,0 +1,156 @@
+package sql
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultD1OffsetsAdapter is adapter for storing offsets in Cloudflare D1 (or other HTTP-based SQLite) databases.
+// It should be used together with DefaultSQLiteSchema.
+//
+// D1 doesn't support interactive transactions, so DefaultD1OffsetsAdapter consumes without a transaction
+// (see NonTransactionalOffsetsAdapter), and offsets are advanced by conditional single-statement updates.
+// Claims of messages which were not acked are released with ReleaseMessageQuery.
+//
+// ConsumedMessageQuery claims the next message for the consumer group only if no other claim is pending,
+// or the pending claim is older than ClaimTimeout. When another consumer is trying to consume the same message,
+// the claim affects no rows, and the consumer queries again.
+//
+// DefaultD1OffsetsAdapter provides at-least-once delivery: a message may be re-delivered if the subscriber
+// crashes after handling it, but before acking it, or if handling takes longer than ClaimTimeout.
+type DefaultD1OffsetsAdapter struct {
+	// GenerateMessagesOffsetsTableName may be used to override how the messages/offsets table name is generated.
+	GenerateMessagesOffsetsTableName func(topic string) string
+
+	// ClaimTimeout is the time after which a message claimed, but not acked by a consumer,
+	// can be claimed by another consumer of the same consumer group.
+	// It should be longer than AckDeadline of the subscriber.
+	//
+	// Default value is 1 minute.
+	ClaimTimeout time.Duration
+}
+
+func (a DefaultD1OffsetsAdapter) SchemaInitializingQueries(topic string) []Query {
+	return []Query{
+		{
+			Query: `
+				CREATE TABLE IF NOT EXISTS ` + a.MessagesOffsetsTable(topic) + ` (
+				consumer_group TEXT NOT NULL,
+				offset_acked INTEGER NOT NULL,
+				offset_consumed INTEGER NOT NULL,
+				consumed_at INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY(consumer_group)
+			)`,
+		},
+	}
+}
+
+func (a DefaultD1OffsetsAdapter) AckMessageQuery(topic string, row Row, consumerGroup string) Query {
+	// Only the consumer holding the claim can ack the message.
+	ackQuery := `UPDATE ` + a.MessagesOffsetsTable(topic) + `
+		SET offset_acked = ?
+		WHERE consumer_group = ? AND offset_consumed = ? AND offset_acked < ?`
+
+	return Query{ackQuery, []any{row.Offset, consumerGroup, row.Offset, row.Offset}}
+}
+
+func (a DefaultD1OffsetsAdapter) NextOffsetQuery(topic, consumerGroup string) Query {
+	return Query{
+		Query: `SELECT COALESCE(
+				(SELECT offset_acked
+				 FROM ` + a.MessagesOffsetsTable(topic) + `
+				 WHERE consumer_group=?
+				), 0)`,
+		Args: []any{consumerGroup},
+	}
+}
+
+func (a DefaultD1OffsetsAdapter) MessagesOffsetsTable(topic string) string {
+	if a.GenerateMessagesOffsetsTableName != nil {
+		return a.GenerateMessagesOffsetsTableName(topic)
+	}
+	return fmt.Sprintf(`"watermill_offsets_%s"`, topic)
+}
+
+func (a DefaultD1OffsetsAdapter) claimTimeout() time.Duration {
+	if a.ClaimTimeout == 0 {
+		return time.Minute
+	}
+
+	return a.ClaimTimeout
+}
+
+func (a DefaultD1OffsetsAdapter) ConsumedMessageQuery(topic string, row Row, consumerGroup string, consumerULID []byte) Query {
+	// The current time is passed as an argument instead of using SQL functions,
+	// so the statement stays deterministic when it's replicated (for example, by rqlite).
+	now := time.Now().Unix()
+
+	consumedQuery := `UPDATE ` + a.MessagesOffsetsTable(topic) + `
+		SET offset_consumed = ?, consumed_at = ?
+		WHERE consumer_group = ? AND offset_acked < ? AND (
+			offset_consumed = offset_acked
+			OR
+			consumed_at < ?
+		)`
+
+	return Query{consumedQuery, []any{row.Offset, now, consumerGroup, row.Offset, now - int64(a.claimTimeout().Seconds())}}
+}
+
+func (a DefaultD1OffsetsAdapter) ConsumedMessageQueryIsConditional() bool {
+	return true
+}
+
+func (a DefaultD1OffsetsAdapter) ReleaseMessageQuery(topic string, row Row, consumerGroup string) Query {
+	releaseQuery := `UPDATE ` + a.MessagesOffsetsTable(topic) + `
+		SET offset_consumed = offset_acked
+		WHERE consumer_group = ? AND offset_consumed = ?`
+
+	return Query{releaseQuery, []any{consumerGroup, row.Offset}}
+}
+
+func (a DefaultD1OffsetsAdapter) BeforeSubscribingQueries(topic string, consumerGroup string) []Query {
+	return []Query{
+		{
+			// ConsumedMessageQuery is an UPDATE, so the consumer group row must exist before consuming.
+			Query: `INSERT INTO ` + a.MessagesOffsetsTable(topic) + ` (consumer_group, offset_acked, offset_consumed) VALUES (?, 0, 0) ON CONFLICT DO NOTHING`,
+			Args:  []any{consumerGroup},
+		},
+	}
+}
+
+func (a DefaultD1OffsetsAdapter) OrphanedOffsetsQuery(topic string) Query {
+	// Claims younger than ClaimTimeout may be still handled by a running subscriber.
+	expiredBefore := time.Now().Unix() - int64(a.claimTimeout().Seconds())
+
+	return Query{
+		Query: `SELECT consumer_group, offset_acked, offset_consumed FROM ` + a.MessagesOffsetsTable(topic) + `
+			WHERE offset_consumed > offset_acked AND consumed_at < ?`,
+		Args: []any{expiredBefore},
+	}
+}
+
+func (a DefaultD1OffsetsAdapter) ResetConsumedOffsetQuery(topic string, consumerGroup string, offsetConsumed int64) Query {
+	return a.ReleaseMessageQuery(topic, Row{Offset: offsetConsumed}, consumerGroup)
+}
+
+func (a DefaultD1OffsetsAdapter) ConsumerGroupOffsetsQuery(topic string) Query {
+	return Query{
+		Query: `SELECT consumer_group, offset_acked FROM ` + a.MessagesOffsetsTable(topic) + ` ORDER BY consumer_group`,
+	}
+}
+
+func (a DefaultD1OffsetsAdapter) SetAckedOffsetQueries(topic string, consumerGroup string, offsetAcked int64) []Query {
+	setQuery := `INSERT INTO ` + a.MessagesOffsetsTable(topic) + ` (consumer_group, offset_acked, offset_consumed, consumed_at)
+		VALUES (?, ?, ?, 0)
+		ON CONFLICT (consumer_group)
+		DO UPDATE SET offset_acked = excluded.offset_acked, offset_consumed = excluded.offset_consumed, consumed_at = 0`
+
+	return []Query{{setQuery, []any{consumerGroup, offsetAcked, offsetAcked}}}
+}
+
+func (a DefaultD1OffsetsAdapter) DeleteConsumerGroupQueries(topic string, consumerGroup string) []Query {
+	return []Query{{
+		Query: `DELETE FROM ` + a.MessagesOffsetsTable(topic) + ` WHERE consumer_group = ?`,
+		Args:  []any{consumerGroup},
+	}}
+}
@@ -0,0 +1,137 @@
+package sql
+
+import (
+	"strings"
+)
+
+// DialectOffsetsAdapter is an implementation of OffsetsAdapter which generates queries using the provided Dialect.
+// It should be used together with DialectSchema.
+//
+// DialectOffsetsAdapter is designed to support multiple subscribers with exactly once delivery
+// and guaranteed order, as long as Dialect.SelectForUpdateQuery locks the consumer group row.
+//
+// When another consumer is trying to consume the same message, it waits for the lock or fails,
+// depending on the database, and consumes the next message.
+type DialectOffsetsAdapter struct {
+	Dialect Dialect
+
+	// GenerateMessagesOffsetsTableName may be used to override how the messages/offsets table name is generated.
+	// The returned name should be already quoted.
+	GenerateMessagesOffsetsTableName func(topic string) string
+}
+
+func (a DialectOffsetsAdapter) SchemaInitializingQueries(topic string) []Query {
+	columns := []DialectColumn{
+		{Name: "consumer_group", Type: DialectColumnTypeString},
+		{Name: "offset_acked", Type: DialectColumnTypeInt64},
+		{Name: "offset_consumed", Type: DialectColumnTypeInt64},
+	}
+
+	return []Query{{Query: a.Dialect.CreateTableQuery(a.MessagesOffsetsTable(topic), columns, []string{"consumer_group"})}}
+}
+
+func (a DialectOffsetsAdapter) AckMessageQuery(topic string, row Row, consumerGroup string) Query {
+	ackQuery := `UPDATE ` + a.MessagesOffsetsTable(topic) + `
+		SET ` + a.Dialect.QuoteIdentifier("offset_acked") + ` = ` + a.Dialect.Placeholder(1) + `,
+			` + a.Dialect.QuoteIdentifier("offset_consumed") + ` = ` + a.Dialect.Placeholder(2) + `
+		WHERE ` + a.Dialect.QuoteIdentifier("consumer_group") + ` = ` + a.Dialect.Placeholder(3)
+
+	return Query{ackQuery, []any{row.Offset, row.Offset, consumerGroup}}
+}
+
+func (a DialectOffsetsAdapter) NextOffsetQuery(topic, consumerGroup string) Query {
+	selectOffset := a.Dialect.SelectForUpdateQuery(
+		a.MessagesOffsetsTable(topic),
+		[]string{"offset_acked"},
+		a.Dialect.QuoteIdentifier("consumer_group")+" = "+a.Dialect.Placeholder(1),
+	)
+
+	return Query{
+		Query: `SELECT COALESCE((` + selectOffset + `), 0)`,
+		Args:  []any{consumerGroup},
+	}
+}
+
+func (a DialectOffsetsAdapter) MessagesOffsetsTable(topic string) string {
+	if a.GenerateMessagesOffsetsTableName != nil {
+		return a.GenerateMessagesOffsetsTableName(topic)
+	}
+	return a.Dialect.QuoteIdentifier("watermill_offsets_" + topic)
+}
+
+func (a DialectOffsetsAdapter) ConsumedMessageQuery(topic string, row Row, consumerGroup string, consumerULID []byte) Query {
+	// offset_consumed is not queried anywhere, it's used only to detect race conditions with NextOffsetQuery.
+	consumedQuery := `UPDATE ` + a.MessagesOffsetsTable(topic) + `
+		SET ` + a.Dialect.QuoteIdentifier("offset_consumed") + ` = ` + a.Dialect.Placeholder(1) + `
+		WHERE ` + a.Dialect.QuoteIdentifier("consumer_group") + ` = ` + a.Dialect.Placeholder(2)
+
+	return Query{consumedQuery, []any{row.Offset, consumerGroup}}
+}
+
+func (a DialectOffsetsAdapter) BeforeSubscribingQueries(topic string, consumerGroup string) []Query {
+	return []Query{
+		{
+			// ConsumedMessageQuery and AckMessageQuery are UPDATEs, so the consumer group row must exist,
+			// and it's required for locking the consumer group in NextOffsetQuery.
+			Query: a.Dialect.InsertIfNotExistsQuery(
+				a.MessagesOffsetsTable(topic),
+				[]string{"consumer_group", "offset_acked", "offset_consumed"},
+				[]string{a.Dialect.Placeholder(1), "0", "0"},
+			),
+			Args: []any{consumerGroup},
+		},
+	}
+}
+
+func (a DialectOffsetsAdapter) ConsumerGroupOffsetsQuery(topic string) Query {
+	return consumerGroupOffsetsQuery(a.Dialect, a.MessagesOffsetsTable(topic))
+}
+
+func (a DialectOffsetsAdapter) SetAckedOffsetQueries(topic string, consumerGroup string, offsetAcked int64) []Query {
+	return append(
+		a.BeforeSubscribingQueries(topic, consumerGroup),
+		a.AckMessageQuery(topic, Row{Offset: offsetAcked}, consumerGroup),
+	)
+}
+
+func (a DialectOffsetsAdapter) DeleteConsumerGroupQueries(topic string, consumerGroup string) []Query {
+	return []Query{deleteConsumerGroupQuery(a.Dialect, a.MessagesOffsetsTable(topic), consumerGroup)}
+}
+
+// The queries below are shared by the offsets adapters storing consumer_group, offset_acked and offset_consumed
+// columns, generated with their Dialect.
+
+func orphanedOffsetsQuery(d Dialect, offsetsTable string) Query {
+	// Uncommitted consumed offsets of running subscribers are not visible, so only committed gaps are selected.
+	return Query{
+		Query: `SELECT ` + strings.Join(quoteIdentifiers(d, []string{"consumer_group", "offset_acked", "offset_consumed"}), ", ") + `
+			FROM ` + offsetsTable + `
+			WHERE ` + d.QuoteIdentifier("offset_consumed") + ` > ` + d.QuoteIdentifier("offset_acked"),
+	}
+}
+
+func resetConsumedOffsetQuery(d Dialect, offsetsTable string, consumerGroup string, offsetConsumed int64) Query {
+	resetQuery := `UPDATE ` + offsetsTable + `
+		SET ` + d.QuoteIdentifier("offset_consumed") + ` = ` + d.QuoteIdentifier("offset_acked") + `
+		WHERE ` + d.QuoteIdentifier("consumer_group") + ` = ` + d.Placeholder(1) + `
+			AND ` + d.QuoteIdentifier("offset_consumed") + ` = ` + d.Placeholder(2)
+
+	return Query{resetQuery, []any{consumerGroup, offsetConsumed}}
+}
+
+func consumerGroupOffsetsQuery(d Dialect, offsetsTable string) Query {
+	// offset_acked is nullable in the tables of DefaultMySQLOffsetsAdapter.
+	return Query{
+		Query: `SELECT ` + d.QuoteIdentifier("consumer_group") + `, COALESCE(` + d.QuoteIdentifier("offset_acked") + `, 0)
+			FROM ` + offsetsTable + `
+			ORDER BY ` + d.QuoteIdentifier("consumer_group"),
+	}
+}
+
+func deleteConsumerGroupQuery(d Dialect, offsetsTable string, consumerGroup string) Query {
+	return Query{
+		Query: `DELETE FROM ` + offsetsTable + `
+			WHERE ` + d.QuoteIdentifier("consumer_group") + ` = ` + d.Placeholder(1),
+		Args: []any{consumerGroup},
+	}
+}
@@ -0,0 +1,80 @@
+package sql
+
+import (
+	"fmt"
+)
+
+// DefaultDuckDBOffsetsAdapter is adapter for storing offsets in DuckDB database.
+//
+// DuckDB has no row locks, so DefaultDuckDBOffsetsAdapter uses optimistic concurrency control instead:
+// ConsumedMessageQuery advances offset_consumed only if it's lower than the consumed message's offset.
+//
+// When another consumer is trying to consume the same message, the update either conflicts
+// with the concurrent transaction or affects no rows, and the consumer queries again.
+type DefaultDuckDBOffsetsAdapter struct {
+	// GenerateMessagesOffsetsTableName may be used to override how the messages/offsets table name is generated.
+	GenerateMessagesOffsetsTableName func(topic string) string
+}
+
+func (a DefaultDuckDBOffsetsAdapter) SchemaInitializingQueries(topic string) []Query {
+	return []Query{
+		{
+			Query: `
+				CREATE TABLE IF NOT EXISTS ` + a.MessagesOffsetsTable(topic) + ` (
+				consumer_group VARCHAR NOT NULL,
+				offset_acked BIGINT NOT NULL,
+				offset_consumed BIGINT NOT NULL,
+				PRIMARY KEY(consumer_group)
+			)`,
+		},
+	}
+}
+
+func (a DefaultDuckDBOffsetsAdapter) AckMessageQuery(topic string, row Row, consumerGroup string) Query {
+	ackQuery := `INSERT INTO ` + a.MessagesOffsetsTable(topic) + ` (offset_consumed, offset_acked, consumer_group)
+		VALUES (?, ?, ?)
+		ON CONFLICT (consumer_group)
+		DO UPDATE SET offset_consumed = excluded.offset_consumed, offset_acked = excluded.offset_acked`
+
+	return Query{ackQuery, []any{row.Offset, row.Offset, consumerGroup}}
+}
+
+func (a DefaultDuckDBOffsetsAdapter) NextOffsetQuery(topic, consumerGroup string) Query {
+	return Query{
+		Query: `SELECT COALESCE(
+				(SELECT offset_acked
+				 FROM ` + a.MessagesOffsetsTable(topic) + `
+				 WHERE consumer_group=?
+				), 0)`,
+		Args: []any{consumerGroup},
+	}
+}
+
+func (a DefaultDuckDBOffsetsAdapter) MessagesOffsetsTable(topic string) string {
+	if a.GenerateMessagesOffsetsTableName != nil {
+		return a.GenerateMessagesOffsetsTableName(topic)
+	}
+	return fmt.Sprintf(`"watermill_offsets_%s"`, topic)
+}
+
+func (a DefaultDuckDBOffsetsAdapter) ConsumedMessageQuery(topic string, row Row, consumerGroup string, consumerULID []byte) Query {
+	consumedQuery := `UPDATE ` + a.MessagesOffsetsTable(topic) + `
+		SET offset_consumed = ?
+		WHERE consumer_group = ? AND offset_consumed < ?`
+
+	return Query{consumedQuery, []any{row.Offset, consumerGroup, row.Offset}}
+}
+
+func (a DefaultDuckDBOffsetsAdapter) ConsumedMessageQueryIsConditional() bool {
+	return true
+}
+
+func (a DefaultDuckDBOffsetsAdapter) BeforeSubscribingQueries(topic string, consumerGroup string) []Query {
+	return []Query{
+		{
+			// ConsumedMessageQuery is an UPDATE, so the consumer group row must exist before consuming.
+			Query: `INSERT INTO ` + a.MessagesOffsetsTable(topic) + ` (consumer_group, offset_acked, offset_consumed) VALUES (?, 0, 0) ON CONFLICT DO NOTHING`,
+			Args:  []any{consumerGroup},
+		},
+	}
+}
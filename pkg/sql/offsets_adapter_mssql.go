@@ -0,0 +1,87 @@
+package sql
+
+import (
+	"fmt"
+)
+
+// DefaultMSSQLOffsetsAdapter is adapter for storing offsets in Microsoft SQL Server database.
+//
+// DefaultMSSQLOffsetsAdapter is designed to support multiple subscribers with exactly once delivery
+// and guaranteed order.
+//
+// We are using UPDLOCK and READPAST hints in NextOffsetQuery to lock consumer group in offsets table.
+//
+// When another consumer is trying to consume the same consumer group, it skips the locked row
+// and receives no messages until the lock is released.
+type DefaultMSSQLOffsetsAdapter struct {
+	// GenerateMessagesOffsetsTableName may be used to override how the messages/offsets table name is generated.
+	GenerateMessagesOffsetsTableName func(topic string) string
+}
+
+func (a DefaultMSSQLOffsetsAdapter) SchemaInitializingQueries(topic string) []Query {
+	return []Query{
+		{
+			Query: `
+				IF OBJECT_ID(N'` + a.MessagesOffsetsTable(topic) + `', N'U') IS NULL
+				CREATE TABLE ` + a.MessagesOffsetsTable(topic) + ` (
+				[consumer_group] NVARCHAR(255) NOT NULL,
+				[offset_acked] BIGINT NOT NULL,
+				[offset_consumed] BIGINT NOT NULL,
+				PRIMARY KEY([consumer_group])
+			)`,
+		},
+	}
+}
+
+func (a DefaultMSSQLOffsetsAdapter) AckMessageQuery(topic string, row Row, consumerGroup string) Query {
+	ackQuery := `MERGE ` + a.MessagesOffsetsTable(topic) + ` WITH (HOLDLOCK) AS target
+		USING (SELECT @p1 AS [consumer_group], @p2 AS [offset_acked]) AS source
+		ON target.[consumer_group] = source.[consumer_group]
+		WHEN MATCHED THEN
+			UPDATE SET [offset_acked] = source.[offset_acked], [offset_consumed] = source.[offset_acked]
+		WHEN NOT MATCHED THEN
+			INSERT ([consumer_group], [offset_acked], [offset_consumed])
+			VALUES (source.[consumer_group], source.[offset_acked], source.[offset_acked]);`
+
+	return Query{ackQuery, []any{consumerGroup, row.Offset}}
+}
+
+func (a DefaultMSSQLOffsetsAdapter) NextOffsetQuery(topic, consumerGroup string) Query {
+	return Query{
+		Query: `SELECT [offset_acked]
+			FROM ` + a.MessagesOffsetsTable(topic) + ` WITH (UPDLOCK, READPAST, ROWLOCK)
+			WHERE [consumer_group]=@p1`,
+		Args: []any{consumerGroup},
+	}
+}
+
+func (a DefaultMSSQLOffsetsAdapter) MessagesOffsetsTable(topic string) string {
+	if a.GenerateMessagesOffsetsTableName != nil {
+		return a.GenerateMessagesOffsetsTableName(topic)
+	}
+	return fmt.Sprintf("[watermill_offsets_%s]", topic)
+}
+
+func (a DefaultMSSQLOffsetsAdapter) ConsumedMessageQuery(topic string, row Row, consumerGroup string, consumerULID []byte) Query {
+	// The consumer group row is already locked by NextOffsetQuery until the end of the transaction.
+	return Query{}
+}
+
+func (a DefaultMSSQLOffsetsAdapter) BeforeSubscribingQueries(topic string, consumerGroup string) []Query {
+	return []Query{
+		{
+			// It's required for exactly-once-delivery guarantee.
+			// It adds "zero offsets" to the table with offsets.
+			//
+			// Without that, NextOffsetQuery returns no rows and there is nothing to lock,
+			// so no messages would be consumed.
+			Query: `MERGE ` + a.MessagesOffsetsTable(topic) + ` WITH (HOLDLOCK) AS target
+				USING (SELECT @p1 AS [consumer_group]) AS source
+				ON target.[consumer_group] = source.[consumer_group]
+				WHEN NOT MATCHED THEN
+					INSERT ([consumer_group], [offset_acked], [offset_consumed])
+					VALUES (source.[consumer_group], 0, 0);`,
+			Args: []any{consumerGroup},
+		},
+	}
+}
@@ -1,9 +1,5 @@
 package sql
 
-import (
-	"fmt"
-)
-
 // DefaultMySQLOffsetsAdapter is adapter for storing offsets for MySQL (or MariaDB) databases.
 //
 // DefaultMySQLOffsetsAdapter is designed to support multiple subscribers with exactly once delivery
@@ -18,34 +14,43 @@ type DefaultMySQLOffsetsAdapter struct {
 	GenerateMessagesOffsetsTableName func(topic string) string
 }
 
+func (a DefaultMySQLOffsetsAdapter) dialect() MySQLDialect {
+	return MySQLDialect{}
+}
+
 func (a DefaultMySQLOffsetsAdapter) SchemaInitializingQueries(topic string) []Query {
+	columns := []DialectColumn{
+		{Name: "consumer_group", Type: DialectColumnTypeString},
+		{Name: "offset_acked", Type: DialectColumnTypeInt64, Nullable: true},
+		{Name: "offset_consumed", Type: DialectColumnTypeInt64},
+	}
+
 	return []Query{
-		{
-			Query: `
-				CREATE TABLE IF NOT EXISTS ` + a.MessagesOffsetsTable(topic) + ` (
-				consumer_group VARCHAR(255) NOT NULL,
-				offset_acked BIGINT,
-				offset_consumed BIGINT NOT NULL,
-				PRIMARY KEY(consumer_group)
-			)`,
-		},
+		{Query: a.dialect().CreateTableQuery(a.MessagesOffsetsTable(topic), columns, []string{"consumer_group"})},
 	}
 }
 
 func (a DefaultMySQLOffsetsAdapter) AckMessageQuery(topic string, row Row, consumerGroup string) Query {
-	ackQuery := `INSERT INTO ` + a.MessagesOffsetsTable(topic) + ` (offset_consumed, offset_acked, consumer_group)
-		VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE offset_consumed=VALUES(offset_consumed), offset_acked=VALUES(offset_acked)`
+	ackQuery := a.dialect().UpsertQuery(
+		a.MessagesOffsetsTable(topic),
+		[]string{"offset_consumed", "offset_acked", "consumer_group"},
+		dialectPlaceholders(a.dialect(), 1, 3),
+		[]string{"consumer_group"},
+		[]string{"offset_consumed", "offset_acked"},
+	)
 
 	return Query{ackQuery, []any{row.Offset, row.Offset, consumerGroup}}
 }
 
 func (a DefaultMySQLOffsetsAdapter) NextOffsetQuery(topic, consumerGroup string) Query {
+	d := a.dialect()
+
 	return Query{
-		Query: `SELECT COALESCE(
-				(SELECT offset_acked
-				 FROM ` + a.MessagesOffsetsTable(topic) + `
-				 WHERE consumer_group=? FOR UPDATE
-				), 0)`,
+		Query: `SELECT COALESCE((` + d.SelectForUpdateQuery(
+			a.MessagesOffsetsTable(topic),
+			[]string{"offset_acked"},
+			d.QuoteIdentifier("consumer_group")+" = "+d.Placeholder(1),
+		) + `), 0)`,
 		Args: []any{consumerGroup},
 	}
 }
@@ -54,16 +59,42 @@ func (a DefaultMySQLOffsetsAdapter) MessagesOffsetsTable(topic string) string {
 	if a.GenerateMessagesOffsetsTableName != nil {
 		return a.GenerateMessagesOffsetsTableName(topic)
 	}
-	return fmt.Sprintf("`watermill_offsets_%s`", topic)
+	return a.dialect().QuoteIdentifier("watermill_offsets_" + topic)
 }
 
 func (a DefaultMySQLOffsetsAdapter) ConsumedMessageQuery(topic string, row Row, consumerGroup string, consumerULID []byte) Query {
 	// offset_consumed is not queried anywhere, it's used only to detect race conditions with NextOffsetQuery.
-	ackQuery := `INSERT INTO ` + a.MessagesOffsetsTable(topic) + ` (offset_consumed, consumer_group)
-		VALUES (?, ?) ON DUPLICATE KEY UPDATE offset_consumed=VALUES(offset_consumed)`
-	return Query{ackQuery, []interface{}{row.Offset, consumerGroup}}
+	consumedQuery := a.dialect().UpsertQuery(
+		a.MessagesOffsetsTable(topic),
+		[]string{"offset_consumed", "consumer_group"},
+		dialectPlaceholders(a.dialect(), 1, 2),
+		[]string{"consumer_group"},
+		[]string{"offset_consumed"},
+	)
+
+	return Query{consumedQuery, []any{row.Offset, consumerGroup}}
 }
 
 func (a DefaultMySQLOffsetsAdapter) BeforeSubscribingQueries(topic, consumerGroup string) []Query {
 	return nil
 }
+
+func (a DefaultMySQLOffsetsAdapter) OrphanedOffsetsQuery(topic string) Query {
+	return orphanedOffsetsQuery(a.dialect(), a.MessagesOffsetsTable(topic))
+}
+
+func (a DefaultMySQLOffsetsAdapter) ResetConsumedOffsetQuery(topic string, consumerGroup string, offsetConsumed int64) Query {
+	return resetConsumedOffsetQuery(a.dialect(), a.MessagesOffsetsTable(topic), consumerGroup, offsetConsumed)
+}
+
+func (a DefaultMySQLOffsetsAdapter) ConsumerGroupOffsetsQuery(topic string) Query {
+	return consumerGroupOffsetsQuery(a.dialect(), a.MessagesOffsetsTable(topic))
+}
+
+func (a DefaultMySQLOffsetsAdapter) SetAckedOffsetQueries(topic string, consumerGroup string, offsetAcked int64) []Query {
+	return []Query{a.AckMessageQuery(topic, Row{Offset: offsetAcked}, consumerGroup)}
+}
+
+func (a DefaultMySQLOffsetsAdapter) DeleteConsumerGroupQueries(topic string, consumerGroup string) []Query {
+	return []Query{deleteConsumerGroupQuery(a.dialect(), a.MessagesOffsetsTable(topic), consumerGroup)}
+}
@@ -0,0 +1,128 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MySQLSkipLockedOffsetsAdapter is adapter for storing offsets in MySQL 8 databases, which splits every topic
+// into Partitions, with a separate offset of each consumer group. It must be used together with DefaultMySQLSchema.
+//
+// Subscribers lock one partition with messages to consume using SELECT ... FOR UPDATE SKIP LOCKED,
+// so several subscribers of one consumer group consume different partitions concurrently, instead of
+// coordinating with deadlocks like DefaultMySQLOffsetsAdapter. It supports exactly once delivery.
+//
+// Messages are assigned to partitions by their offsets (offset modulo Partitions), so the order of messages
+// is guaranteed only within a partition. A batch of selected messages contains messages of one partition.
+type MySQLSkipLockedOffsetsAdapter struct {
+	// Partitions is the number of partitions of every topic. It shouldn't be changed after subscribing,
+	// as the partitions of consumed messages would change.
+	//
+	// Default value is 16.
+	Partitions int
+
+	// GenerateMessagesOffsetsTableName may be used to override how the messages/offsets table name is generated.
+	GenerateMessagesOffsetsTableName func(topic string) string
+}
+
+func (a MySQLSkipLockedOffsetsAdapter) SchemaInitializingQueries(topic string) []Query {
+	return []Query{
+		{
+			Query: `
+				CREATE TABLE IF NOT EXISTS ` + a.MessagesOffsetsTable(topic) + ` (
+				consumer_group VARCHAR(255) NOT NULL,
+				partition_id INT NOT NULL,
+				offset_acked BIGINT NOT NULL DEFAULT 0,
+				offset_consumed BIGINT NOT NULL DEFAULT 0,
+				PRIMARY KEY(consumer_group, partition_id)
+			)`,
+		},
+	}
+}
+
+func (a MySQLSkipLockedOffsetsAdapter) AckMessageQuery(topic string, row Row, consumerGroup string) Query {
+	ackQuery := `UPDATE ` + a.MessagesOffsetsTable(topic) + `
+		SET offset_acked = ?, offset_consumed = ?
+		WHERE consumer_group = ? AND partition_id = ?`
+
+	return Query{ackQuery, []any{row.Offset, row.Offset, consumerGroup, a.partition(row.Offset)}}
+}
+
+// NextOffsetQuery returns the lowest acked offset of all partitions. It's not used by DefaultMySQLSchema,
+// which selects messages with NextPartitionQuery.
+func (a MySQLSkipLockedOffsetsAdapter) NextOffsetQuery(topic, consumerGroup string) Query {
+	return Query{
+		Query: `SELECT COALESCE(
+				(SELECT MIN(offset_acked)
+				 FROM ` + a.MessagesOffsetsTable(topic) + `
+				 WHERE consumer_group=?
+				), 0)`,
+		Args: []any{consumerGroup},
+	}
+}
+
+func (a MySQLSkipLockedOffsetsAdapter) NextPartitionQuery(topic string, consumerGroup string, messagesTable string) Query {
+	return Query{
+		Query: `SELECT o.partition_id, o.offset_acked
+			FROM ` + a.MessagesOffsetsTable(topic) + ` o
+			WHERE o.consumer_group = ? AND EXISTS (
+				SELECT 1 FROM ` + messagesTable + ` m
+				WHERE m.` + "`offset`" + ` > o.offset_acked AND ` + a.PartitionExpression("m.`offset`") + ` = o.partition_id
+			)
+			ORDER BY o.offset_acked ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED`,
+		Args: []any{consumerGroup},
+	}
+}
+
+func (a MySQLSkipLockedOffsetsAdapter) PartitionExpression(offsetColumn string) string {
+	return "MOD(" + offsetColumn + ", " + strconv.Itoa(a.partitions()) + ")"
+}
+
+func (a MySQLSkipLockedOffsetsAdapter) MessagesOffsetsTable(topic string) string {
+	if a.GenerateMessagesOffsetsTableName != nil {
+		return a.GenerateMessagesOffsetsTableName(topic)
+	}
+	return fmt.Sprintf("`watermill_offsets_%s`", topic)
+}
+
+func (a MySQLSkipLockedOffsetsAdapter) ConsumedMessageQuery(topic string, row Row, consumerGroup string, consumerULID []byte) Query {
+	// offset_consumed is not queried anywhere, the partition is already locked by NextPartitionQuery.
+	consumedQuery := `UPDATE ` + a.MessagesOffsetsTable(topic) + `
+		SET offset_consumed = ?
+		WHERE consumer_group = ? AND partition_id = ?`
+
+	return Query{consumedQuery, []any{row.Offset, consumerGroup, a.partition(row.Offset)}}
+}
+
+func (a MySQLSkipLockedOffsetsAdapter) BeforeSubscribingQueries(topic string, consumerGroup string) []Query {
+	// The partitions must exist to be locked by NextPartitionQuery.
+	values := make([]string, a.partitions())
+	args := make([]any, 0, a.partitions()*2)
+	for partition := range values {
+		values[partition] = "(?, ?)"
+		args = append(args, consumerGroup, partition)
+	}
+
+	return []Query{
+		{
+			Query: `INSERT IGNORE INTO ` + a.MessagesOffsetsTable(topic) + ` (consumer_group, partition_id)
+				VALUES ` + strings.Join(values, ", "),
+			Args: args,
+		},
+	}
+}
+
+func (a MySQLSkipLockedOffsetsAdapter) partitions() int {
+	if a.Partitions <= 0 {
+		return 16
+	}
+
+	return a.Partitions
+}
+
+func (a MySQLSkipLockedOffsetsAdapter) partition(offset int64) int64 {
+	return offset % int64(a.partitions())
+}
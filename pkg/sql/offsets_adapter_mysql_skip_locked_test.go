@@ -0,0 +1,25 @@
+package sql_test
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLSkipLockedOffsetsAdapter_queries(t *testing.T) {
+	offsetsAdapter := sql.MySQLSkipLockedOffsetsAdapter{Partitions: 4}
+
+	selectQuery := sql.DefaultMySQLSchema{}.SelectQuery("topic", "group", offsetsAdapter)
+	assert.Contains(t, selectQuery.Query, "FOR UPDATE SKIP LOCKED")
+	assert.Contains(t, selectQuery.Query, "ON MOD(`offset`, 4) = watermill_partition.partition_id")
+	assert.Contains(t, selectQuery.Query, "`offset` > watermill_partition.offset_acked")
+	assert.Equal(t, []any{"group"}, selectQuery.Args)
+
+	ackQuery := offsetsAdapter.AckMessageQuery("topic", sql.Row{Offset: 7}, "group")
+	assert.Equal(t, []any{int64(7), int64(7), "group", int64(3)}, ackQuery.Args)
+
+	beforeSubscribing := offsetsAdapter.BeforeSubscribingQueries("topic", "group")
+	assert.Len(t, beforeSubscribing, 1)
+	assert.Equal(t, []any{"group", 0, "group", 1, "group", 2, "group", 3}, beforeSubscribing[0].Args)
+}
@@ -0,0 +1,62 @@
+package sql
+
+import (
+	"fmt"
+)
+
+// PostgreSQLQueueOffsetsAdapter is adapter for storing the consumption state in the messages table
+// created by PostgreSQLQueueSchema, instead of a separate offsets table.
+//
+// Every acked message is marked with the acked status and the consumer group which acked it,
+// or deleted when DeleteOnAck is enabled (see MessageAckingOffsetsAdapter).
+type PostgreSQLQueueOffsetsAdapter struct {
+	// GenerateMessagesTableName may be used to override how the messages table name is generated.
+	// It must generate the same name as PostgreSQLQueueSchema.
+	GenerateMessagesTableName func(topic string) string
+
+	// DeleteOnAck deletes messages when they are acked, instead of updating their status.
+	// It keeps the table small, but acked messages can't be inspected or replayed.
+	DeleteOnAck bool
+}
+
+func (a PostgreSQLQueueOffsetsAdapter) SchemaInitializingQueries(topic string) []Query {
+	return nil
+}
+
+func (a PostgreSQLQueueOffsetsAdapter) AckMessageQuery(topic string, row Row, consumerGroup string) Query {
+	if a.DeleteOnAck {
+		deleteQuery := `DELETE FROM ` + a.MessagesTable(topic) + ` WHERE "offset" = $1`
+
+		return Query{deleteQuery, []any{row.Offset}}
+	}
+
+	ackQuery := `UPDATE ` + a.MessagesTable(topic) + ` SET status = $1, consumer_group = $2 WHERE "offset" = $3`
+
+	return Query{ackQuery, []any{queueStatusAcked, consumerGroup, row.Offset}}
+}
+
+// AcksEveryMessage returns true, as the status of every message is stored in its row.
+func (a PostgreSQLQueueOffsetsAdapter) AcksEveryMessage() bool {
+	return true
+}
+
+func (a PostgreSQLQueueOffsetsAdapter) NextOffsetQuery(topic, consumerGroup string) Query {
+	// PostgreSQLQueueSchema selects pending messages, so the next offset is not needed.
+	return Query{}
+}
+
+func (a PostgreSQLQueueOffsetsAdapter) MessagesTable(topic string) string {
+	if a.GenerateMessagesTableName != nil {
+		return a.GenerateMessagesTableName(topic)
+	}
+	return fmt.Sprintf(`"watermill_%s"`, topic)
+}
+
+func (a PostgreSQLQueueOffsetsAdapter) ConsumedMessageQuery(topic string, row Row, consumerGroup string, consumerULID []byte) Query {
+	// The message row stays locked by SelectQuery until the transaction is finished.
+	return Query{}
+}
+
+func (a PostgreSQLQueueOffsetsAdapter) BeforeSubscribingQueries(topic string, consumerGroup string) []Query {
+	return nil
+}
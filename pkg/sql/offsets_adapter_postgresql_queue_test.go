@@ -0,0 +1,97 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgreSQLQueueOffsetsAdapter_queries(t *testing.T) {
+	offsetsAdapter := sql.PostgreSQLQueueOffsetsAdapter{}
+	assert.True(t, offsetsAdapter.AcksEveryMessage())
+
+	ackQuery := offsetsAdapter.AckMessageQuery("topic", sql.Row{Offset: 7}, "group")
+	assert.Equal(t, `UPDATE "watermill_topic" SET status = $1, consumer_group = $2 WHERE "offset" = $3`, ackQuery.Query)
+	assert.Equal(t, []any{"acked", "group", int64(7)}, ackQuery.Args)
+
+	deleteQuery := sql.PostgreSQLQueueOffsetsAdapter{DeleteOnAck: true}.AckMessageQuery("topic", sql.Row{Offset: 7}, "group")
+	assert.Equal(t, `DELETE FROM "watermill_topic" WHERE "offset" = $1`, deleteQuery.Query)
+	assert.Equal(t, []any{int64(7)}, deleteQuery.Args)
+}
+
+// messageAckingOffsetsAdapter records the offsets acked with AckMessageQuery.
+type messageAckingOffsetsAdapter struct {
+	sql.DefaultSQLiteOffsetsAdapter
+
+	lock  *sync.Mutex
+	acked *[]int64
+}
+
+func (a messageAckingOffsetsAdapter) AckMessageQuery(topic string, row sql.Row, consumerGroup string) sql.Query {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	*a.acked = append(*a.acked, row.Offset)
+
+	return a.DefaultSQLiteOffsetsAdapter.AckMessageQuery(topic, row, consumerGroup)
+}
+
+func (a messageAckingOffsetsAdapter) AcksEveryMessage() bool {
+	return true
+}
+
+func TestSubscriber_AcksEveryMessage(t *testing.T) {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "acks.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer db.Close()
+
+	topicName := "topic_" + watermill.NewShortUUID()
+	schemaAdapter := sql.DefaultSQLiteSchema{SubscribeBatchSize: 3}
+
+	publisher := newCheckpointPublisher(t, sql.BeginnerFromStdSQL(db), schemaAdapter)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, publisher.Publish(topicName, message.NewMessage(watermill.NewUUID(), nil)))
+	}
+
+	offsetsAdapter := messageAckingOffsetsAdapter{lock: &sync.Mutex{}, acked: &[]int64{}}
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   offsetsAdapter,
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-messages:
+			msg.Ack()
+		case <-time.After(time.Second * 5):
+			t.Fatal("no message received")
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		offsetsAdapter.lock.Lock()
+		defer offsetsAdapter.lock.Unlock()
+		return len(*offsetsAdapter.acked) >= 3
+	}, time.Second*5, time.Millisecond*10)
+
+	offsetsAdapter.lock.Lock()
+	defer offsetsAdapter.lock.Unlock()
+	assert.Equal(t, []int64{1, 2, 3}, *offsetsAdapter.acked, "every message of the batch should be acked")
+}
@@ -0,0 +1,112 @@
+package sql
+
+// DefaultSQLiteOffsetsAdapter is adapter for storing offsets in SQLite database (or dqlite, which replicates SQLite
+// with interactive transactions). It should be used together with DefaultSQLiteSchema.
+//
+// DefaultSQLiteOffsetsAdapter is designed to support multiple subscribers with exactly once delivery
+// and guaranteed order.
+//
+// SQLite allows only one writer at a time. ConsumedMessageQuery upgrades the transaction to a write transaction,
+// so when another consumer is trying to consume the same message, its write fails with "database is locked" error
+// and the consumer queries again.
+//
+// Keep in mind that the write lock is held until the consumed messages are acked,
+// so subscribers of all topics stored in the same database file are consuming one at a time.
+type DefaultSQLiteOffsetsAdapter struct {
+	// GenerateMessagesOffsetsTableName may be used to override how the messages/offsets table name is generated.
+	GenerateMessagesOffsetsTableName func(topic string) string
+
+	// StrictTables creates the offsets tables as STRICT tables (see SQLiteSupportsStrictTables).
+	// Tables created before it was enabled are not changed.
+	StrictTables bool
+}
+
+func (a DefaultSQLiteOffsetsAdapter) dialect() SQLiteDialect {
+	return SQLiteDialect{}
+}
+
+func (a DefaultSQLiteOffsetsAdapter) SchemaInitializingQueries(topic string) []Query {
+	columns := []DialectColumn{
+		{Name: "consumer_group", Type: DialectColumnTypeString},
+		{Name: "offset_acked", Type: DialectColumnTypeInt64},
+		{Name: "offset_consumed", Type: DialectColumnTypeInt64},
+	}
+
+	return []Query{
+		{
+			Query: a.dialect().CreateTableQuery(a.MessagesOffsetsTable(topic), columns, []string{"consumer_group"}) +
+				sqliteTableOptions(a.StrictTables),
+		},
+	}
+}
+
+func (a DefaultSQLiteOffsetsAdapter) AckMessageQuery(topic string, row Row, consumerGroup string) Query {
+	ackQuery := a.dialect().UpsertQuery(
+		a.MessagesOffsetsTable(topic),
+		[]string{"offset_consumed", "offset_acked", "consumer_group"},
+		dialectPlaceholders(a.dialect(), 1, 3),
+		[]string{"consumer_group"},
+		[]string{"offset_consumed", "offset_acked"},
+	)
+
+	return Query{ackQuery, []any{row.Offset, row.Offset, consumerGroup}}
+}
+
+func (a DefaultSQLiteOffsetsAdapter) NextOffsetQuery(topic, consumerGroup string) Query {
+	d := a.dialect()
+
+	return Query{
+		Query: `SELECT COALESCE((` + d.SelectForUpdateQuery(
+			a.MessagesOffsetsTable(topic),
+			[]string{"offset_acked"},
+			d.QuoteIdentifier("consumer_group")+" = "+d.Placeholder(1),
+		) + `), 0)`,
+		Args: []any{consumerGroup},
+	}
+}
+
+func (a DefaultSQLiteOffsetsAdapter) MessagesOffsetsTable(topic string) string {
+	if a.GenerateMessagesOffsetsTableName != nil {
+		return a.GenerateMessagesOffsetsTableName(topic)
+	}
+	return a.dialect().QuoteIdentifier("watermill_offsets_" + topic)
+}
+
+func (a DefaultSQLiteOffsetsAdapter) ConsumedMessageQuery(topic string, row Row, consumerGroup string, consumerULID []byte) Query {
+	d := a.dialect()
+
+	// offset_consumed is not queried anywhere, it's used only to take the write lock before sending the message.
+	consumedQuery := d.UpsertQuery(
+		a.MessagesOffsetsTable(topic),
+		[]string{"offset_consumed", "offset_acked", "consumer_group"},
+		[]string{d.Placeholder(1), "0", d.Placeholder(2)},
+		[]string{"consumer_group"},
+		[]string{"offset_consumed"},
+	)
+
+	return Query{consumedQuery, []any{row.Offset, consumerGroup}}
+}
+
+func (a DefaultSQLiteOffsetsAdapter) BeforeSubscribingQueries(topic string, consumerGroup string) []Query {
+	return nil
+}
+
+func (a DefaultSQLiteOffsetsAdapter) OrphanedOffsetsQuery(topic string) Query {
+	return orphanedOffsetsQuery(a.dialect(), a.MessagesOffsetsTable(topic))
+}
+
+func (a DefaultSQLiteOffsetsAdapter) ResetConsumedOffsetQuery(topic string, consumerGroup string, offsetConsumed int64) Query {
+	return resetConsumedOffsetQuery(a.dialect(), a.MessagesOffsetsTable(topic), consumerGroup, offsetConsumed)
+}
+
+func (a DefaultSQLiteOffsetsAdapter) ConsumerGroupOffsetsQuery(topic string) Query {
+	return consumerGroupOffsetsQuery(a.dialect(), a.MessagesOffsetsTable(topic))
+}
+
+func (a DefaultSQLiteOffsetsAdapter) SetAckedOffsetQueries(topic string, consumerGroup string, offsetAcked int64) []Query {
+	return []Query{a.AckMessageQuery(topic, Row{Offset: offsetAcked}, consumerGroup)}
+}
+
+func (a DefaultSQLiteOffsetsAdapter) DeleteConsumerGroupQueries(topic string, consumerGroup string) []Query {
+	return []Query{deleteConsumerGroupQuery(a.dialect(), a.MessagesOffsetsTable(topic), consumerGroup)}
+}
@@ -0,0 +1,224 @@
+package sql
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// OffsetInconsistencyKind is the kind of the impossible state of a consumer group's offsets found by SQLiteTopicAdmin.Verify.
+type OffsetInconsistencyKind string
+
+const (
+	// OffsetAckedBeyondLastMessage is reported when the acked offset is greater than the offset of the last message
+	// ever published to the topic, for example, because the messages table was recreated, or restored from
+	// an older backup than the offsets. The consumer group skips the messages until their offsets exceed it.
+	// It's repaired by moving the acked offset back to the last offset.
+	OffsetAckedBeyondLastMessage OffsetInconsistencyKind = "acked_beyond_last_message"
+
+	// OffsetNegative is reported when the acked or consumed offset is negative. It's repaired by setting it to 0.
+	OffsetNegative OffsetInconsistencyKind = "negative_offset"
+
+	// OffsetConsumedBehindAcked is reported when the consumed offset is lower than the acked offset (a negative gap),
+	// which subscribers never write, as acking a message updates both offsets.
+	// It's repaired by moving the consumed offset to the acked offset.
+	OffsetConsumedBehindAcked OffsetInconsistencyKind = "consumed_behind_acked"
+
+	// OffsetOrphanedConsumerGroup is reported for consumer groups stored in the offsets table of a topic
+	// without the messages table, for example, when the messages table was dropped manually.
+	// It's repaired by deleting the offsets of the consumer group.
+	OffsetOrphanedConsumerGroup OffsetInconsistencyKind = "orphaned_consumer_group"
+)
+
+// OffsetInconsistency describes the impossible state of the offsets of a consumer group.
+type OffsetInconsistency struct {
+	Kind          OffsetInconsistencyKind
+	ConsumerGroup string
+
+	OffsetAcked    int64
+	OffsetConsumed int64
+
+	// LastOffset is the offset of the last message ever published to the topic.
+	LastOffset int64
+}
+
+// Verify detects impossible states of the offsets of the topic's consumer groups (see OffsetInconsistencyKind),
+// which usually result from manual changes of the messages and offsets tables. It doesn't change the offsets,
+// see Repair.
+func (a SQLiteTopicAdmin) Verify(ctx context.Context, topic string) ([]OffsetInconsistency, error) {
+	if err := validateTopicName(topic); err != nil {
+		return nil, err
+	}
+
+	return a.verifyOffsets(ctx, topic)
+}
+
+// Repair detects impossible states of the offsets of the topic's consumer groups, like Verify, and repairs them
+// in one transaction (if DB can begin transactions). It returns the repaired inconsistencies.
+//
+// Offsets are repaired only if they didn't change since they were verified, so Repair may be executed
+// while subscribers are running, but subscribers of the repaired consumer groups should be restarted,
+// as they may cache the offsets (see SubscriberConfig.CacheNextOffset).
+func (a SQLiteTopicAdmin) Repair(ctx context.Context, topic string) ([]OffsetInconsistency, error) {
+	if err := validateTopicName(topic); err != nil {
+		return nil, err
+	}
+
+	var repaired []OffsetInconsistency
+	err := a.inTx(ctx, func(ctx context.Context, db QueryExecutor) error {
+		admin := a
+		admin.DB = db
+
+		inconsistencies, err := admin.verifyOffsets(ctx, topic)
+		if err != nil {
+			return err
+		}
+
+		for _, inconsistency := range inconsistencies {
+			if err := admin.repairOffsets(ctx, topic, inconsistency); err != nil {
+				return errors.Wrapf(err, "could not repair offsets of consumer group %s", inconsistency.ConsumerGroup)
+			}
+			repaired = append(repaired, inconsistency)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repaired, nil
+}
+
+func (a SQLiteTopicAdmin) verifyOffsets(ctx context.Context, topic string) ([]OffsetInconsistency, error) {
+	offsetsTable := a.OffsetsAdapter.MessagesOffsetsTable(topic)
+	exists, err := a.tableExists(ctx, unquotedTableName(offsetsTable))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		// The topic was not subscribed yet.
+		return nil, nil
+	}
+
+	messagesExist, err := a.tableExists(ctx, unquotedTableName(a.SchemaAdapter.MessagesTable(topic)))
+	if err != nil {
+		return nil, err
+	}
+
+	var lastOffset int64
+	if messagesExist {
+		lastOffset, _, err = a.lastOffset(ctx, topic)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := a.DB.QueryContext(ctx, `SELECT consumer_group, offset_acked, offset_consumed FROM `+offsetsTable+` ORDER BY consumer_group`)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query offsets")
+	}
+	defer rows.Close()
+
+	var inconsistencies []OffsetInconsistency
+	for rows.Next() {
+		i := OffsetInconsistency{LastOffset: lastOffset}
+		if err := rows.Scan(&i.ConsumerGroup, &i.OffsetAcked, &i.OffsetConsumed); err != nil {
+			return nil, errors.Wrap(err, "could not scan offsets")
+		}
+
+		switch {
+		case !messagesExist:
+			i.Kind = OffsetOrphanedConsumerGroup
+		case i.OffsetAcked < 0 || i.OffsetConsumed < 0:
+			i.Kind = OffsetNegative
+		case i.OffsetAcked > lastOffset:
+			i.Kind = OffsetAckedBeyondLastMessage
+		case i.OffsetConsumed < i.OffsetAcked:
+			i.Kind = OffsetConsumedBehindAcked
+		default:
+			continue
+		}
+
+		inconsistencies = append(inconsistencies, i)
+	}
+
+	return inconsistencies, rows.Err()
+}
+
+func (a SQLiteTopicAdmin) repairOffsets(ctx context.Context, topic string, inconsistency OffsetInconsistency) error {
+	offsetsTable := a.OffsetsAdapter.MessagesOffsetsTable(topic)
+
+	// The offsets are compared, so offsets changed by subscribers since they were verified are not overwritten.
+	var query string
+	var args []any
+	switch inconsistency.Kind {
+	case OffsetOrphanedConsumerGroup:
+		query = `DELETE FROM ` + offsetsTable + ` WHERE consumer_group = ? AND offset_acked = ? AND offset_consumed = ?`
+		args = []any{inconsistency.ConsumerGroup, inconsistency.OffsetAcked, inconsistency.OffsetConsumed}
+	default:
+		offsetAcked := inconsistency.OffsetAcked
+		if offsetAcked < 0 {
+			offsetAcked = 0
+		}
+		if offsetAcked > inconsistency.LastOffset {
+			offsetAcked = inconsistency.LastOffset
+		}
+		offsetConsumed := inconsistency.OffsetConsumed
+		if offsetConsumed < offsetAcked || offsetConsumed > inconsistency.LastOffset {
+			offsetConsumed = offsetAcked
+		}
+
+		query = `UPDATE ` + offsetsTable + ` SET offset_acked = ?, offset_consumed = ?
+			WHERE consumer_group = ? AND offset_acked = ? AND offset_consumed = ?`
+		args = []any{offsetAcked, offsetConsumed, inconsistency.ConsumerGroup, inconsistency.OffsetAcked, inconsistency.OffsetConsumed}
+	}
+
+	res, err := a.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "could not get number of repaired offsets")
+	}
+	if affected == 0 {
+		return errors.New("offsets changed since they were verified")
+	}
+
+	return nil
+}
+
+// lastOffset returns the offset of the last message ever published to the topic. Offsets of deleted messages
+// are not reused by tables with AUTOINCREMENT (like the tables of DefaultSQLiteSchema), which record the last offset
+// in sqlite_sequence. It returns false if the table doesn't have a sequence.
+func (a SQLiteTopicAdmin) lastOffset(ctx context.Context, topic string) (int64, bool, error) {
+	messagesTable := a.SchemaAdapter.MessagesTable(topic)
+
+	var lastOffset int64
+	_, err := a.queryRow(ctx, []any{&lastOffset}, `SELECT COALESCE(MAX("offset"), 0) FROM `+messagesTable)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "could not query last offset")
+	}
+
+	sequenceExists, err := a.tableExists(ctx, "sqlite_sequence")
+	if err != nil || !sequenceExists {
+		return lastOffset, false, err
+	}
+
+	var sequence int64
+	sequenceFound, err := a.queryRow(
+		ctx,
+		[]any{&sequence},
+		`SELECT "seq" FROM "sqlite_sequence" WHERE "name" = ?`,
+		unquotedTableName(messagesTable),
+	)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "could not query sequence of offsets")
+	}
+	if sequence > lastOffset {
+		lastOffset = sequence
+	}
+
+	return lastOffset, sequenceFound, nil
+}
@@ -0,0 +1,82 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteTopicAdmin_VerifyRepair(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "verify.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, publisher.Publish("orders", message.NewMessage(watermill.NewUUID(), nil)))
+	}
+
+	for _, topic := range []string{"orders", "dropped"} {
+		for _, q := range offsetsAdapter.SchemaInitializingQueries(topic) {
+			_, err := db.ExecContext(ctx, q.Query, q.Args...)
+			require.NoError(t, err)
+		}
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO `+offsetsAdapter.MessagesOffsetsTable("orders")+` (consumer_group, offset_acked, offset_consumed)
+		VALUES ('beyond', 10, 10), ('behind', 2, 1), ('negative', -1, 0), ('consuming', 1, 2), ('ok', 2, 3)`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `INSERT INTO `+offsetsAdapter.MessagesOffsetsTable("dropped")+` (consumer_group, offset_acked, offset_consumed)
+		VALUES ('workers', 5, 5)`)
+	require.NoError(t, err)
+
+	admin := sql.SQLiteTopicAdmin{DB: db}
+
+	inconsistencies, err := admin.Verify(ctx, "orders")
+	require.NoError(t, err)
+	assert.Equal(t, []sql.OffsetInconsistency{
+		{Kind: sql.OffsetConsumedBehindAcked, ConsumerGroup: "behind", OffsetAcked: 2, OffsetConsumed: 1, LastOffset: 3},
+		{Kind: sql.OffsetAckedBeyondLastMessage, ConsumerGroup: "beyond", OffsetAcked: 10, OffsetConsumed: 10, LastOffset: 3},
+		{Kind: sql.OffsetNegative, ConsumerGroup: "negative", OffsetAcked: -1, OffsetConsumed: 0, LastOffset: 3},
+	}, inconsistencies, "consumed offsets ahead of acked offsets are valid")
+
+	repaired, err := admin.Repair(ctx, "orders")
+	require.NoError(t, err)
+	assert.Equal(t, inconsistencies, repaired)
+
+	inconsistencies, err = admin.Verify(ctx, "orders")
+	require.NoError(t, err)
+	assert.Empty(t, inconsistencies)
+
+	groups, err := admin.ConsumerGroups(ctx, "orders")
+	require.NoError(t, err)
+	assert.Equal(t, []sql.ConsumerGroupLag{
+		{ConsumerGroup: "behind", OffsetAcked: 2, Lag: 1},
+		{ConsumerGroup: "beyond", OffsetAcked: 3, Lag: 0},
+		{ConsumerGroup: "consuming", OffsetAcked: 1, Lag: 2},
+		{ConsumerGroup: "negative", OffsetAcked: 0, Lag: 3},
+		{ConsumerGroup: "ok", OffsetAcked: 2, Lag: 1},
+	}, groups)
+
+	inconsistencies, err = admin.Verify(ctx, "dropped")
+	require.NoError(t, err)
+	assert.Equal(t, []sql.OffsetInconsistency{
+		{Kind: sql.OffsetOrphanedConsumerGroup, ConsumerGroup: "workers", OffsetAcked: 5, OffsetConsumed: 5},
+	}, inconsistencies)
+
+	_, err = admin.Repair(ctx, "dropped")
+	require.NoError(t, err)
+	inconsistencies, err = admin.Verify(ctx, "dropped")
+	require.NoError(t, err)
+	assert.Empty(t, inconsistencies)
+}
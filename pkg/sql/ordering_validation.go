@@ -0,0 +1,164 @@
+package sql
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	// OrderingSourceMetadataKey is the metadata key containing the ID of the publisher and the partition key
+	// of the messages tracked by PublisherConfig.TrackOrdering. Messages of one source are numbered
+	// with OrderingSequenceMetadataKey.
+	OrderingSourceMetadataKey = "ordering_source"
+
+	// OrderingSequenceMetadataKey is the metadata key containing the sequence number of the message within its source
+	// (see OrderingSourceMetadataKey), starting with 1.
+	OrderingSequenceMetadataKey = "ordering_sequence"
+)
+
+// OrderingViolationKind is the kind of OrderingViolation.
+type OrderingViolationKind string
+
+const (
+	// OrderingGap means that messages between the previous and the acked message of the source were not acked.
+	OrderingGap OrderingViolationKind = "gap"
+
+	// OrderingReordered means that a message with a higher sequence number of the source was acked before
+	// the acked message, or that the message was acked again.
+	OrderingReordered OrderingViolationKind = "reordered"
+)
+
+// OrderingViolation describes an acked message which is out of the order it was published in.
+type OrderingViolation struct {
+	Kind OrderingViolationKind
+
+	Topic  string
+	UUID   string
+	Source string
+
+	// Sequence is the sequence number of the acked message.
+	Sequence int64
+
+	// Expected is the sequence number following the previous acked message of the source.
+	Expected int64
+}
+
+// orderingTracker numbers the messages published by a publisher, per topic and partition key.
+type orderingTracker struct {
+	publisherID  string
+	partitionKey string
+
+	sequences map[string]int64
+	lock      sync.Mutex
+}
+
+func newOrderingTracker(enabled bool, partitionKey string) *orderingTracker {
+	if !enabled {
+		return nil
+	}
+
+	return &orderingTracker{
+		publisherID:  watermill.NewULID(),
+		partitionKey: partitionKey,
+		sequences:    map[string]int64{},
+	}
+}
+
+// track sets the ordering metadata of the messages.
+func (t *orderingTracker) track(topic string, msgs message.Messages) {
+	if t == nil {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, msg := range msgs {
+		source := t.publisherID + "/" + msg.Metadata.Get(t.partitionKey)
+		key := topic + "\x00" + source
+
+		t.sequences[key]++
+		msg.Metadata.Set(OrderingSourceMetadataKey, source)
+		msg.Metadata.Set(OrderingSequenceMetadataKey, strconv.FormatInt(t.sequences[key], 10))
+	}
+}
+
+// orderingValidator remembers the last acked sequence number of every source.
+type orderingValidator struct {
+	acked map[string]int64
+	lock  sync.Mutex
+}
+
+func newOrderingValidator(enabled bool) *orderingValidator {
+	if !enabled {
+		return nil
+	}
+
+	return &orderingValidator{
+		acked: map[string]int64{},
+	}
+}
+
+// ackedMessage records the acked message, returning the violation of the order, if any.
+// Messages without the ordering metadata are not validated, and the first acked message of a source is always valid,
+// as the subscription may start in the middle of the topic.
+func (v *orderingValidator) ackedMessage(topic string, msg *message.Message) (OrderingViolation, bool) {
+	source := msg.Metadata.Get(OrderingSourceMetadataKey)
+	sequence, err := strconv.ParseInt(msg.Metadata.Get(OrderingSequenceMetadataKey), 10, 64)
+	if source == "" || err != nil {
+		return OrderingViolation{}, false
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	key := topic + "\x00" + source
+	previous, ok := v.acked[key]
+	if !ok || sequence > previous {
+		v.acked[key] = sequence
+	}
+	if !ok || sequence == previous+1 {
+		return OrderingViolation{}, false
+	}
+
+	violation := OrderingViolation{
+		Kind:     OrderingGap,
+		Topic:    topic,
+		UUID:     msg.UUID,
+		Source:   source,
+		Sequence: sequence,
+		Expected: previous + 1,
+	}
+	if sequence <= previous {
+		violation.Kind = OrderingReordered
+	}
+
+	return violation, true
+}
+
+// validateOrdering validates the order of the acked message, if ValidateOrdering is enabled.
+func (s *Subscriber) validateOrdering(topic string, msg *message.Message, logger watermill.LoggerAdapter) {
+	if s.ordering == nil {
+		return
+	}
+
+	violation, ok := s.ordering.ackedMessage(topic, msg)
+	if !ok {
+		return
+	}
+
+	logger.Error("Message ordering violated", nil, watermill.LogFields{
+		"kind":     violation.Kind,
+		"source":   violation.Source,
+		"sequence": violation.Sequence,
+		"expected": violation.Expected,
+	})
+	s.events.emit(OrderingViolated{Topic: topic, Violation: violation})
+
+	if s.config.OnOrderingViolation != nil {
+		s.config.OnOrderingViolation(violation)
+	}
+}
@@ -0,0 +1,93 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_ValidateOrdering(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topic := "ordering_" + watermill.NewShortUUID()
+
+	publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+		TrackOrdering:        true,
+	}, logger)
+	require.NoError(t, err)
+
+	var published []*message.Message
+	for i := 0; i < 4; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), nil)
+		msg.Metadata.Set(sql.PartitionKeyMetadataKey, []string{"a", "b"}[i%2])
+		published = append(published, msg)
+	}
+	require.NoError(t, publisher.Publish(topic, published...))
+
+	assert.Equal(t, "1", published[0].Metadata.Get(sql.OrderingSequenceMetadataKey))
+	assert.Equal(t, "1", published[1].Metadata.Get(sql.OrderingSequenceMetadataKey))
+	assert.Equal(t, "2", published[2].Metadata.Get(sql.OrderingSequenceMetadataKey))
+	assert.NotEqual(t,
+		published[0].Metadata.Get(sql.OrderingSourceMetadataKey),
+		published[1].Metadata.Get(sql.OrderingSourceMetadataKey),
+	)
+
+	// A message of partition "a" skipping a sequence number, published without tracking.
+	skipped := message.NewMessage(watermill.NewUUID(), nil)
+	skipped.Metadata.Set(sql.OrderingSourceMetadataKey, published[0].Metadata.Get(sql.OrderingSourceMetadataKey))
+	skipped.Metadata.Set(sql.OrderingSequenceMetadataKey, "4")
+	require.NoError(t, newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{}).Publish(topic, skipped))
+
+	violations := make(chan sql.OrderingViolation, 10)
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "ordering",
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+		ValidateOrdering: true,
+		OnOrderingViolation: func(violation sql.OrderingViolation) {
+			violations <- violation
+		},
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		select {
+		case msg := <-messages:
+			msg.Ack()
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting for messages, received %d", i)
+		}
+	}
+
+	select {
+	case violation := <-violations:
+		assert.Equal(t, sql.OrderingViolation{
+			Kind:     sql.OrderingGap,
+			Topic:    topic,
+			UUID:     skipped.UUID,
+			Source:   published[0].Metadata.Get(sql.OrderingSourceMetadataKey),
+			Sequence: 4,
+			Expected: 3,
+		}, violation)
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for the ordering violation")
+	}
+
+	assert.Empty(t, violations, "messages published in order should not be reported")
+}
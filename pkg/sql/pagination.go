@@ -0,0 +1,38 @@
+package sql
+
+import "fmt"
+
+// Pagination is how the batches of messages are selected by SelectQuery.
+type Pagination int
+
+const (
+	// PaginationLimit selects the messages following the acked offset with LIMIT of the batch size.
+	PaginationLimit Pagination = iota
+
+	// PaginationKeyset selects the messages in the range of offsets starting at the first message following
+	// the acked offset, as wide as the batch size: WHERE "offset" >= first AND "offset" < first + batch size.
+	// The acked offset is queried once per batch and the range is scanned directly from the primary key,
+	// which keeps the queries of consumer groups catching up with deep backlogs cheap.
+	//
+	// Batches are smaller when there are gaps between the offsets (for example, after messages were deleted),
+	// but consuming never stops at a gap, as the range starts at an existing message.
+	PaginationKeyset
+)
+
+// sqliteKeysetSelectQuery returns the query selecting the columns of the messages in the keyset page
+// following the offset selected by nextOffsetQuery.
+func sqliteKeysetSelectQuery(columns string, table string, fragments SQLFragments, nextOffsetQuery string, batchSize int) string {
+	return `
+		SELECT ` + columns + ` FROM ` + fragments.fromTable(table) + `, (
+			SELECT MIN("offset") AS "first_offset" FROM ` + table + `
+			WHERE
+				"offset" > (` + nextOffsetQuery + `)
+				` + fragments.andWhereExtra() + `
+		) AS "page"
+		WHERE
+			"offset" >= "page"."first_offset"
+			AND "offset" < "page"."first_offset" + ` + fmt.Sprintf("%d", batchSize) + `
+			` + fragments.andWhereExtra() + `
+		ORDER BY
+			"offset" ASC`
+}
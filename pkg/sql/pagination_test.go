@@ -0,0 +1,62 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultSQLiteSchema_KeysetPagination(t *testing.T) {
+	sqlDB := newSQLite(t)
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topicName := "keyset_" + watermill.NewShortUUID()
+	schemaAdapter := newSQLiteSchemaAdapter(3)
+	schemaAdapter.Pagination = sql.PaginationKeyset
+
+	publisher := newCheckpointPublisher(t, db, schemaAdapter)
+	var published []*message.Message
+	for i := 0; i < 12; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), nil)
+		require.NoError(t, publisher.Publish(topicName, msg))
+		published = append(published, msg)
+	}
+
+	// The gap is wider than the batch size, so a page following the acked offset alone would be empty.
+	_, err := sqlDB.Exec(`DELETE FROM ` + schemaAdapter.MessagesTable(topicName) + ` WHERE "offset" BETWEEN 3 AND 8`)
+	require.NoError(t, err)
+	expected := append(append([]*message.Message{}, published[:2]...), published[8:]...)
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "keyset",
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	consumed, err := subscriber.Subscribe(context.Background(), topicName)
+	require.NoError(t, err)
+
+	for _, msg := range expected {
+		select {
+		case received := <-consumed:
+			assert.Equal(t, msg.UUID, received.UUID)
+			received.Ack()
+		case <-time.After(time.Second * 5):
+			t.Fatal("timeout waiting for message")
+		}
+	}
+
+	select {
+	case received := <-consumed:
+		t.Fatalf("unexpected message %s", received.UUID)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
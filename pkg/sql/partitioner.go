@@ -0,0 +1,149 @@
+package sql
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// PartitionKeyMetadataKey is the metadata key containing the partition key of the message, used by HashPartitioner.
+// Messages with the same partition key are assigned to the same partition, so their order is preserved.
+const PartitionKeyMetadataKey = "partition_key"
+
+// Partitioner assigns the messages published together to partitions (like the shards of ShardedSchema).
+// Implementations must be safe for concurrent use.
+type Partitioner interface {
+	// Partitions returns the partition of every message, from 0 to partitions-1.
+	Partitions(topic string, msgs []*message.Message, partitions int) []int
+}
+
+// HashPartitioner assigns messages to partitions by the hash of their metadata value, so the messages
+// with the same value are stored in one partition, and are consumed in order.
+// Messages without the metadata are assigned by the hash of their UUIDs.
+type HashPartitioner struct {
+	// MetadataKey is the metadata key of the hashed value.
+	//
+	// Default value is PartitionKeyMetadataKey.
+	MetadataKey string
+}
+
+func (p HashPartitioner) Partitions(topic string, msgs []*message.Message, partitions int) []int {
+	assigned := make([]int, len(msgs))
+	for i, msg := range msgs {
+		assigned[i] = p.Partition(msg, partitions)
+	}
+
+	return assigned
+}
+
+// Partition returns the partition of the message.
+func (p HashPartitioner) Partition(msg *message.Message, partitions int) int {
+	metadataKey := p.MetadataKey
+	if metadataKey == "" {
+		metadataKey = PartitionKeyMetadataKey
+	}
+
+	key := msg.Metadata.Get(metadataKey)
+	if key == "" {
+		key = msg.UUID
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// RoundRobinPartitioner assigns the messages of every topic to the partitions in turn,
+// so they are spread evenly, but their order is not preserved.
+type RoundRobinPartitioner struct {
+	lock sync.Mutex
+	next map[string]int
+}
+
+func NewRoundRobinPartitioner() *RoundRobinPartitioner {
+	return &RoundRobinPartitioner{
+		next: map[string]int{},
+	}
+}
+
+func (p *RoundRobinPartitioner) Partitions(topic string, msgs []*message.Message, partitions int) []int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	assigned := make([]int, len(msgs))
+	for i := range msgs {
+		assigned[i] = p.next[topic] % partitions
+		p.next[topic] = (assigned[i] + 1) % partitions
+	}
+
+	return assigned
+}
+
+// StickyPartitioner assigns the messages of every topic to one randomly chosen partition, until SwitchAfter
+// messages were assigned to it. Messages published together are inserted with fewer queries than with
+// RoundRobinPartitioner, while the partitions are still filled evenly over time.
+type StickyPartitioner struct {
+	switchAfter int
+
+	lock   sync.Mutex
+	sticky map[string]*stickyPartition
+}
+
+type stickyPartition struct {
+	partition int
+	assigned  int
+}
+
+// NewStickyPartitioner creates StickyPartitioner switching the partition after switchAfter messages.
+// If switchAfter is not positive, it defaults to 100.
+func NewStickyPartitioner(switchAfter int) *StickyPartitioner {
+	if switchAfter <= 0 {
+		switchAfter = 100
+	}
+
+	return &StickyPartitioner{
+		switchAfter: switchAfter,
+		sticky:      map[string]*stickyPartition{},
+	}
+}
+
+func (p *StickyPartitioner) Partitions(topic string, msgs []*message.Message, partitions int) []int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	sticky, ok := p.sticky[topic]
+	if !ok {
+		sticky = &stickyPartition{partition: rand.Intn(partitions)}
+		p.sticky[topic] = sticky
+	}
+
+	assigned := make([]int, len(msgs))
+	for i := range msgs {
+		if sticky.assigned >= p.switchAfter || sticky.partition >= partitions {
+			sticky.partition = p.switchPartition(sticky.partition, partitions)
+			sticky.assigned = 0
+		}
+
+		assigned[i] = sticky.partition
+		sticky.assigned++
+	}
+
+	return assigned
+}
+
+// switchPartition chooses a random partition other than the current one, if there are more partitions.
+func (p *StickyPartitioner) switchPartition(current int, partitions int) int {
+	if partitions == 1 {
+		return 0
+	}
+
+	next := rand.Intn(partitions - 1)
+	if next >= current {
+		next++
+	}
+
+	return next % partitions
+}
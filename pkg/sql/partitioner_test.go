@@ -0,0 +1,69 @@
+package sql_test
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPartitionedMessages(n int, metadataKey string, keys ...string) []*message.Message {
+	var msgs []*message.Message
+	for i := 0; i < n; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), nil)
+		if len(keys) > 0 {
+			msg.Metadata.Set(metadataKey, keys[i%len(keys)])
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestHashPartitioner(t *testing.T) {
+	partitioner := sql.HashPartitioner{MetadataKey: "customer_id"}
+	msgs := newPartitionedMessages(20, "customer_id", "a", "b", "c")
+
+	partitions := partitioner.Partitions("topic", msgs, 4)
+	assert.Len(t, partitions, len(msgs))
+
+	partitionOfKey := map[string]int{}
+	for i, msg := range msgs {
+		assert.GreaterOrEqual(t, partitions[i], 0)
+		assert.Less(t, partitions[i], 4)
+
+		key := msg.Metadata.Get("customer_id")
+		if partition, ok := partitionOfKey[key]; ok {
+			assert.Equal(t, partition, partitions[i], "messages of key %s in different partitions", key)
+		}
+		partitionOfKey[key] = partitions[i]
+	}
+}
+
+func TestRoundRobinPartitioner(t *testing.T) {
+	partitioner := sql.NewRoundRobinPartitioner()
+
+	assert.Equal(t, []int{0, 1, 2}, partitioner.Partitions("topic", newPartitionedMessages(3, ""), 3))
+	assert.Equal(t, []int{0, 1}, partitioner.Partitions("topic", newPartitionedMessages(2, ""), 3))
+	assert.Equal(t, []int{0}, partitioner.Partitions("other_topic", newPartitionedMessages(1, ""), 3))
+	assert.Equal(t, []int{2, 0}, partitioner.Partitions("topic", newPartitionedMessages(2, ""), 3))
+}
+
+func TestStickyPartitioner(t *testing.T) {
+	partitioner := sql.NewStickyPartitioner(3)
+
+	partitions := partitioner.Partitions("topic", newPartitionedMessages(7, ""), 4)
+	assert.Len(t, partitions, 7)
+
+	// Every partition is used for 3 messages, and the next one is different.
+	for i := range partitions {
+		if i%3 != 0 {
+			assert.Equal(t, partitions[i-1], partitions[i])
+		} else if i > 0 {
+			assert.NotEqual(t, partitions[i-1], partitions[i])
+		}
+	}
+
+	assert.Equal(t, []int{0, 0}, sql.NewStickyPartitioner(1).Partitions("topic", newPartitionedMessages(2, ""), 1))
+}
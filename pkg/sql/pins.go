@@ -0,0 +1,191 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PinningTopicAdmin is an optional interface of TopicAdmin, implemented by topic admins which can pin messages,
+// so messages under investigation or legal hold are never deleted by retention (see DeleteAckedMessages).
+// It's implemented only by SQLiteTopicAdmin, so pins are kept only in SQLite.
+type PinningTopicAdmin interface {
+	TopicAdmin
+
+	// Pin pins the message, so it's kept until it's unpinned. Pinning a pinned message does nothing.
+	Pin(ctx context.Context, topic string, uuid string) error
+
+	// Unpin unpins the message, so it can be deleted again. Unpinning a message which is not pinned does nothing.
+	Unpin(ctx context.Context, topic string, uuid string) error
+}
+
+// Pin stores the pin in the pins table (see SQLiteTopicAdmin.PinsTableName), and creates a trigger on the messages
+// table of the topic, which ignores deleting the pinned messages. The messages are kept by every DELETE statement,
+// including DeleteAckedMessages and Erase, but not when the whole table is dropped.
+//
+// Deleting the messages of the topic is slower once a message was pinned, as the pins table is queried for every
+// deleted message.
+func (a SQLiteTopicAdmin) Pin(ctx context.Context, topic string, uuid string) error {
+	if err := validateTopicName(topic); err != nil {
+		return err
+	}
+
+	return a.inTx(ctx, func(ctx context.Context, db QueryExecutor) error {
+		messagesTable := a.SchemaAdapter.MessagesTable(topic)
+
+		rows, err := db.QueryContext(ctx, `SELECT 1 FROM `+messagesTable+` WHERE "uuid" = ?`, uuid)
+		if err != nil {
+			return errors.Wrap(err, "could not query message")
+		}
+		found := rows.Next()
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return errors.Wrap(err, "could not query message")
+		}
+		if !found {
+			return ErrMessageNotFound
+		}
+
+		_, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+a.pinsTable()+` (
+			"topic" TEXT NOT NULL,
+			"uuid" TEXT NOT NULL,
+			"pinned_at" INTEGER NOT NULL,
+			PRIMARY KEY ("topic", "uuid")
+		)`)
+		if err != nil {
+			return errors.Wrap(err, "could not create pins table")
+		}
+
+		_, err = db.ExecContext(ctx, `
+			CREATE TRIGGER IF NOT EXISTS `+a.pinsTrigger(messagesTable)+`
+			BEFORE DELETE ON `+messagesTable+`
+			WHEN EXISTS (
+				SELECT 1 FROM `+a.pinsTable()+` WHERE "topic" = `+sqlStringLiteral(topic)+` AND "uuid" = OLD."uuid"
+			)
+			BEGIN
+				SELECT RAISE(IGNORE);
+			END
+		`)
+		if err != nil {
+			return errors.Wrap(err, "could not create pins trigger")
+		}
+
+		_, err = db.ExecContext(
+			ctx,
+			`INSERT INTO `+a.pinsTable()+` ("topic", "uuid", "pinned_at") VALUES (?, ?, ?)
+			ON CONFLICT ("topic", "uuid") DO NOTHING`,
+			topic, uuid, time.Now().UnixMilli(),
+		)
+		if err != nil {
+			return errors.Wrap(err, "could not insert pin")
+		}
+
+		return nil
+	})
+}
+
+// Unpin deletes the pin from the pins table. When the last pin of the topic is deleted, the trigger
+// of the messages table is dropped, so deleting the messages of the topic doesn't query the pins table anymore.
+func (a SQLiteTopicAdmin) Unpin(ctx context.Context, topic string, uuid string) error {
+	if err := validateTopicName(topic); err != nil {
+		return err
+	}
+
+	exists, err := a.tableExists(ctx, a.pinsTableName())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// No messages were pinned yet.
+		return nil
+	}
+
+	return a.inTx(ctx, func(ctx context.Context, db QueryExecutor) error {
+		_, err := db.ExecContext(ctx, `DELETE FROM `+a.pinsTable()+` WHERE "topic" = ? AND "uuid" = ?`, topic, uuid)
+		if err != nil {
+			return errors.Wrap(err, "could not delete pin")
+		}
+
+		rows, err := db.QueryContext(ctx, `SELECT 1 FROM `+a.pinsTable()+` WHERE "topic" = ? LIMIT 1`, topic)
+		if err != nil {
+			return errors.Wrap(err, "could not query pins")
+		}
+		pinsLeft := rows.Next()
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return errors.Wrap(err, "could not query pins")
+		}
+		if pinsLeft {
+			return nil
+		}
+
+		_, err = db.ExecContext(ctx, `DROP TRIGGER IF EXISTS `+a.pinsTrigger(a.SchemaAdapter.MessagesTable(topic)))
+		if err != nil {
+			return errors.Wrap(err, "could not drop pins trigger")
+		}
+
+		return nil
+	})
+}
+
+// pinned returns the UUIDs of the pinned messages among the UUIDs.
+func (a SQLiteTopicAdmin) pinned(ctx context.Context, topic string, uuids []string) (map[string]bool, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+
+	exists, err := a.tableExists(ctx, a.pinsTableName())
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	args := []any{topic}
+	for _, uuid := range uuids {
+		args = append(args, uuid)
+	}
+
+	rows, err := a.DB.QueryContext(
+		ctx,
+		`SELECT "uuid" FROM `+a.pinsTable()+` WHERE "topic" = ? AND "uuid" IN (?`+strings.Repeat(", ?", len(uuids)-1)+`)`,
+		args...,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query pins")
+	}
+	defer rows.Close()
+
+	pinned := map[string]bool{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			return nil, errors.Wrap(err, "could not scan pin")
+		}
+		pinned[uuid] = true
+	}
+
+	return pinned, rows.Err()
+}
+
+func (a SQLiteTopicAdmin) pinsTableName() string {
+	if a.PinsTableName != "" {
+		return a.PinsTableName
+	}
+	return "watermill_pinned_messages"
+}
+
+// pinsTrigger returns the quoted name of the trigger keeping the pinned messages of the messages table.
+func (a SQLiteTopicAdmin) pinsTrigger(messagesTable string) string {
+	return QuoteWithDoubleQuotes(tableIndexName(messagesTable, "pinned", 0))
+}
+
+func (a SQLiteTopicAdmin) pinsTable() string {
+	return fmt.Sprintf(`"%s"`, a.pinsTableName())
+}
@@ -0,0 +1,78 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteTopicAdmin_Pin(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "pin.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	schemaAdapter := sql.DefaultSQLiteSchema{}
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+	topic := "pin_" + watermill.NewShortUUID()
+
+	var msgs []*message.Message
+	for i := 0; i < 4; i++ {
+		msgs = append(msgs, message.NewMessage(watermill.NewUUID(), nil))
+	}
+	require.NoError(t, newCheckpointPublisher(t, db, schemaAdapter).Publish(topic, msgs...))
+
+	var admin sql.PinningTopicAdmin = sql.SQLiteTopicAdmin{DB: db}
+
+	require.NoError(t, admin.Unpin(ctx, topic, msgs[0].UUID), "unpinning should work before the pins table exists")
+	require.NoError(t, admin.Pin(ctx, topic, msgs[1].UUID))
+	require.NoError(t, admin.Pin(ctx, topic, msgs[1].UUID))
+	require.NoError(t, admin.Pin(ctx, topic, msgs[2].UUID))
+	assert.ErrorIs(t, admin.Pin(ctx, topic, "missing"), sql.ErrMessageNotFound)
+
+	peeked, err := admin.PeekMessages(ctx, topic, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, peeked, 4)
+	assert.False(t, peeked[0].Pinned)
+	assert.True(t, peeked[1].Pinned)
+	assert.True(t, peeked[2].Pinned)
+
+	require.NoError(t, sql.ImportCheckpoint(ctx, db, nil, offsetsAdapter, topic, sql.Checkpoint{
+		ConsumerGroups: []sql.ConsumerGroupCheckpoint{{ConsumerGroup: "workers", OffsetAcked: 4}},
+	}))
+
+	deleted, err := sql.DeleteAckedMessages(ctx, db, schemaAdapter, offsetsAdapter, topic, sql.AckedRetentionPolicy{}, logger)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, deleted, "pinned messages should not be deleted")
+
+	peeked, err = admin.PeekMessages(ctx, topic, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, peeked, 2)
+	assert.Equal(t, msgs[1].UUID, peeked[0].Msg.UUID)
+	assert.Equal(t, msgs[2].UUID, peeked[1].Msg.UUID)
+
+	require.NoError(t, admin.Unpin(ctx, topic, msgs[1].UUID))
+
+	deleted, err = sql.DeleteAckedMessages(ctx, db, schemaAdapter, offsetsAdapter, topic, sql.AckedRetentionPolicy{}, logger)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+
+	peeked, err = admin.PeekMessages(ctx, topic, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, peeked, 1)
+	assert.Equal(t, msgs[2].UUID, peeked[0].Msg.UUID)
+
+	topics, err := admin.Topics(ctx)
+	require.NoError(t, err)
+	for _, stats := range topics {
+		assert.NotEqual(t, "pinned_messages", stats.Topic)
+	}
+}
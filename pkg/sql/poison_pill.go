@@ -0,0 +1,280 @@
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PoisonPillFingerprintMetadataKey is the metadata key of parked messages containing their fingerprint.
+	PoisonPillFingerprintMetadataKey = "poison_pill_fingerprint"
+
+	// PoisonPillFailuresMetadataKey is the metadata key of parked messages containing the number of failures
+	// of messages with the same fingerprint.
+	PoisonPillFailuresMetadataKey = "poison_pill_failures"
+
+	// PoisonPillTopicMetadataKey is the metadata key of parked messages containing the topic they were consumed from.
+	PoisonPillTopicMetadataKey = "poison_pill_topic"
+)
+
+// PoisonPillStore counts failures of messages with the same fingerprint within a topic.
+//
+// The store may be shared by multiple instances of the service (for example, by storing the counts in SQL),
+// so the failures of all consumers of the topic are counted together.
+type PoisonPillStore interface {
+	// Failures returns the number of failures recorded for the fingerprint.
+	Failures(ctx context.Context, topic string, fingerprint string) (int, error)
+
+	// RecordFailure increments the number of failures of the fingerprint and returns the new value.
+	RecordFailure(ctx context.Context, topic string, fingerprint string) (int, error)
+
+	// Reset removes the failures of the fingerprint, after a message with the fingerprint was handled successfully.
+	Reset(ctx context.Context, topic string, fingerprint string) error
+}
+
+type PoisonPillDetectorConfig struct {
+	// ParkPublisher publishes the messages detected as poison pills. It's required.
+	ParkPublisher message.Publisher
+
+	// GenerateParkTopic may be used to override how the topic of parked messages is generated.
+	// Default topic is the consumed topic with the _poison_pills suffix.
+	GenerateParkTopic func(topic string) string
+
+	// Store counts the failures of fingerprints.
+	//
+	// Default value is a MemoryPoisonPillStore, which counts the failures of a single instance.
+	Store PoisonPillStore
+
+	// Fingerprint may be used to override how the fingerprint of a message is calculated.
+	//
+	// Default fingerprint is the SHA-256 hash of the payload.
+	Fingerprint func(msg *message.Message) string
+
+	// MaxFailures is the number of failures of messages with the same fingerprint,
+	// after which the matching messages are parked instead of being handled.
+	//
+	// Default value is 3.
+	MaxFailures int
+}
+
+func (c *PoisonPillDetectorConfig) setDefaults() {
+	if c.GenerateParkTopic == nil {
+		c.GenerateParkTopic = func(topic string) string {
+			return topic + "_poison_pills"
+		}
+	}
+	if c.Store == nil {
+		c.Store = NewMemoryPoisonPillStore(0)
+	}
+	if c.Fingerprint == nil {
+		c.Fingerprint = PayloadFingerprint
+	}
+	if c.MaxFailures == 0 {
+		c.MaxFailures = 3
+	}
+}
+
+func (c PoisonPillDetectorConfig) validate() error {
+	if c.ParkPublisher == nil {
+		return errors.New("park publisher is nil")
+	}
+	if c.MaxFailures < 0 {
+		return errors.New("max failures must be positive")
+	}
+
+	return nil
+}
+
+// PoisonPillDetector detects poison pills: messages with identical payloads which repeatedly fail.
+//
+// Producer bugs may emit many copies of the same malformed event. Each of them would be retried
+// until it's handled, so the consumers would be blocked. PoisonPillDetector counts the failures
+// of messages with the same fingerprint, and when they reach MaxFailures, it parks all matching messages:
+// they are published to the park topic and acked, without calling the handler.
+//
+// The detector should be added to the router with Middleware.
+type PoisonPillDetector struct {
+	config PoisonPillDetectorConfig
+	logger watermill.LoggerAdapter
+
+	parked     map[string]int64
+	parkedLock sync.Mutex
+}
+
+func NewPoisonPillDetector(config PoisonPillDetectorConfig, logger watermill.LoggerAdapter) (*PoisonPillDetector, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &PoisonPillDetector{
+		config: config,
+		logger: logger,
+		parked: map[string]int64{},
+	}, nil
+}
+
+// PayloadFingerprint returns the hex-encoded SHA-256 hash of the message's payload.
+func PayloadFingerprint(msg *message.Message) string {
+	hash := sha256.Sum256(msg.Payload)
+	return hex.EncodeToString(hash[:])
+}
+
+// Middleware is the message.HandlerMiddleware which parks poison pills.
+// The topic is taken from the message's context, set by the router.
+func (d *PoisonPillDetector) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		ctx := msg.Context()
+		topic := message.SubscribeTopicFromCtx(ctx)
+		fingerprint := d.config.Fingerprint(msg)
+
+		failures, err := d.config.Store.Failures(ctx, topic, fingerprint)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not get failures of message fingerprint")
+		}
+
+		if failures >= d.config.MaxFailures {
+			return nil, d.park(topic, fingerprint, failures, msg)
+		}
+
+		produced, err := h(msg)
+		if err == nil {
+			if failures > 0 {
+				if resetErr := d.config.Store.Reset(ctx, topic, fingerprint); resetErr != nil {
+					d.logger.Error("Could not reset failures of message fingerprint", resetErr, nil)
+				}
+			}
+
+			return produced, nil
+		}
+
+		if _, recordErr := d.config.Store.RecordFailure(ctx, topic, fingerprint); recordErr != nil {
+			d.logger.Error("Could not record failure of message fingerprint", recordErr, nil)
+		}
+
+		return produced, err
+	}
+}
+
+func (d *PoisonPillDetector) park(topic string, fingerprint string, failures int, msg *message.Message) error {
+	parkTopic := d.config.GenerateParkTopic(topic)
+
+	d.logger.Info("Parking poison pill message", watermill.LogFields{
+		"uuid":        msg.UUID,
+		"topic":       topic,
+		"park_topic":  parkTopic,
+		"fingerprint": fingerprint,
+		"failures":    failures,
+	})
+
+	parked := msg.Copy()
+	parked.Metadata.Set(PoisonPillFingerprintMetadataKey, fingerprint)
+	parked.Metadata.Set(PoisonPillFailuresMetadataKey, strconv.Itoa(failures))
+	parked.Metadata.Set(PoisonPillTopicMetadataKey, topic)
+
+	if err := d.config.ParkPublisher.Publish(parkTopic, parked); err != nil {
+		return errors.Wrap(err, "could not park poison pill message")
+	}
+
+	d.parkedLock.Lock()
+	d.parked[topic]++
+	d.parkedLock.Unlock()
+
+	return nil
+}
+
+// ParkedMessages returns the numbers of messages parked since the detector was created, by consumed topics.
+func (d *PoisonPillDetector) ParkedMessages() map[string]int64 {
+	d.parkedLock.Lock()
+	defer d.parkedLock.Unlock()
+
+	parked := make(map[string]int64, len(d.parked))
+	for topic, count := range d.parked {
+		parked[topic] = count
+	}
+
+	return parked
+}
+
+// MemoryPoisonPillStore is a PoisonPillStore keeping the failures in memory.
+// When the number of stored fingerprints exceeds the limit, the oldest fingerprints are forgotten.
+type MemoryPoisonPillStore struct {
+	maxFingerprints int
+
+	failures map[string]int
+	order    []string
+	lock     sync.Mutex
+}
+
+// NewMemoryPoisonPillStore creates a MemoryPoisonPillStore storing at most maxFingerprints fingerprints.
+// If maxFingerprints is 0, it defaults to 10000.
+func NewMemoryPoisonPillStore(maxFingerprints int) *MemoryPoisonPillStore {
+	if maxFingerprints == 0 {
+		maxFingerprints = 10000
+	}
+
+	return &MemoryPoisonPillStore{
+		maxFingerprints: maxFingerprints,
+		failures:        map[string]int{},
+	}
+}
+
+func (s *MemoryPoisonPillStore) Failures(ctx context.Context, topic string, fingerprint string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.failures[s.key(topic, fingerprint)], nil
+}
+
+func (s *MemoryPoisonPillStore) RecordFailure(ctx context.Context, topic string, fingerprint string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := s.key(topic, fingerprint)
+	if _, ok := s.failures[key]; !ok {
+		s.order = append(s.order, key)
+		for len(s.order) > s.maxFingerprints {
+			delete(s.failures, s.order[0])
+			s.order = s.order[1:]
+		}
+	}
+
+	s.failures[key]++
+
+	return s.failures[key], nil
+}
+
+func (s *MemoryPoisonPillStore) Reset(ctx context.Context, topic string, fingerprint string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := s.key(topic, fingerprint)
+	if _, ok := s.failures[key]; !ok {
+		return nil
+	}
+
+	delete(s.failures, key)
+	for i, k := range s.order {
+		if k == key {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryPoisonPillStore) key(topic string, fingerprint string) string {
+	return topic + "\x00" + fingerprint
+}
@@ -0,0 +1,60 @@
+package sql_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type publishedMessages map[string][]*message.Message
+
+func (p publishedMessages) Publish(topic string, messages ...*message.Message) error {
+	p[topic] = append(p[topic], messages...)
+	return nil
+}
+
+func (p publishedMessages) Close() error {
+	return nil
+}
+
+func TestPoisonPillDetector(t *testing.T) {
+	parked := publishedMessages{}
+
+	detector, err := sql.NewPoisonPillDetector(sql.PoisonPillDetectorConfig{
+		ParkPublisher: parked,
+		MaxFailures:   2,
+	}, logger)
+	require.NoError(t, err)
+
+	handled := 0
+	handler := detector.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		handled++
+		if string(msg.Payload) == "malformed" {
+			return nil, errors.New("malformed payload")
+		}
+		return nil, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := handler(message.NewMessage(watermill.NewUUID(), []byte("malformed")))
+		assert.Error(t, err)
+	}
+
+	_, err = handler(message.NewMessage(watermill.NewUUID(), []byte("valid")))
+	assert.NoError(t, err)
+
+	poisonPill := message.NewMessage(watermill.NewUUID(), []byte("malformed"))
+	_, err = handler(poisonPill)
+	assert.NoError(t, err, "poison pill should be parked and acked")
+
+	assert.Equal(t, 3, handled, "poison pill should not be handled")
+	require.Len(t, parked["_poison_pills"], 1)
+	assert.Equal(t, poisonPill.UUID, parked["_poison_pills"][0].UUID)
+	assert.Equal(t, "2", parked["_poison_pills"][0].Metadata.Get(sql.PoisonPillFailuresMetadataKey))
+	assert.Equal(t, sql.PayloadFingerprint(poisonPill), parked["_poison_pills"][0].Metadata.Get(sql.PoisonPillFingerprintMetadataKey))
+}
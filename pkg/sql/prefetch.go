@@ -0,0 +1,245 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// subscriptionPrefetch holds the batches of a subscription selected ahead (see SubscriberConfig.PrefetchBatches).
+type subscriptionPrefetch struct {
+	batches chan prefetchResult
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// prefetchResult is a batch of messages selected after the offset.
+type prefetchResult struct {
+	afterOffset int64
+	rows        []Row
+	err         error
+}
+
+// stop stops prefetching and discards the batches which were prefetched.
+func (p *subscriptionPrefetch) stop() {
+	if p.batches == nil {
+		return
+	}
+
+	p.cancel()
+	<-p.done
+
+	p.batches = nil
+	p.cancel = nil
+	p.done = nil
+}
+
+// startPrefetch starts selecting the batches following the batch in the background, until PrefetchBatches
+// batches are buffered. The batches are selected in separate transactions, so they don't hold the locks
+// of the subscription transaction.
+func (s *Subscriber) startPrefetch(
+	ctx context.Context,
+	topic string,
+	prefetch *subscriptionPrefetch,
+	batch []Row,
+	logger watermill.LoggerAdapter,
+) {
+	if s.config.PrefetchBatches == 0 || len(batch) == 0 {
+		return
+	}
+	if s.config.OffsetsAdapter.NextOffsetQuery(topic, s.config.ConsumerGroup).IsZero() {
+		// Prefetched batches can't be checked against the acked offset.
+		return
+	}
+
+	prefetch.stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	batches := make(chan prefetchResult, s.config.PrefetchBatches)
+	done := make(chan struct{})
+
+	prefetch.batches = batches
+	prefetch.cancel = cancel
+	prefetch.done = done
+
+	go func() {
+		defer close(done)
+		defer close(batches)
+
+		after := batch[len(batch)-1]
+		for {
+			rows, err := s.selectBatchAfter(ctx, topic, after)
+			if err != nil && ctx.Err() == nil {
+				logger.Debug("Could not prefetch batch", watermill.LogFields{"err": err.Error()})
+			}
+
+			select {
+			case batches <- prefetchResult{afterOffset: after.Offset, rows: rows, err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil || len(rows) == 0 {
+				return
+			}
+			after = rows[len(rows)-1]
+		}
+	}()
+}
+
+// selectBatchAfter selects the batch of messages following the row, without consuming them.
+func (s *Subscriber) selectBatchAfter(ctx context.Context, topic string, after Row) (messageRows []Row, err error) {
+	tx, err := s.txProvider().BeginTx(ctx, &sql.TxOptions{
+		Isolation: s.config.SchemaAdapter.SubscribeIsolationLevel(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not begin tx for prefetching")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	selectQuery := s.config.SchemaAdapter.SelectQuery(topic, s.config.ConsumerGroup, prefetchOffsetsAdapter{after: after})
+
+	queryCtx, cancelQuery := s.withQueryTimeout(ctx)
+	defer cancelQuery()
+
+	rows, err := tx.QueryContext(queryCtx, selectQuery.Query, selectQuery.Args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query messages")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := s.config.SchemaAdapter.UnmarshalMessage(rows)
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "could not unmarshal message from query")
+		}
+
+		row, err = s.transformMessage(row)
+		if err != nil {
+			return nil, err
+		}
+
+		messageRows = append(messageRows, row)
+		if s.batchLimitReached(topic, len(messageRows)) {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not read messages")
+	}
+
+	return messageRows, nil
+}
+
+// prefetchedBatch returns the next prefetched batch, if it follows the offset acked by the consumer group.
+// Otherwise, for example, when another subscriber of the consumer group acked messages meanwhile,
+// the prefetched batches are discarded and false is returned, so the batch is selected in the transaction.
+func (s *Subscriber) prefetchedBatch(
+	ctx context.Context,
+	tx Tx,
+	topic string,
+	prefetch *subscriptionPrefetch,
+	logger watermill.LoggerAdapter,
+) ([]Row, bool) {
+	if prefetch.batches == nil {
+		return nil, false
+	}
+
+	var result prefetchResult
+	var ok bool
+	select {
+	case result, ok = <-prefetch.batches:
+	case <-ctx.Done():
+		return nil, false
+	}
+
+	if !ok || result.err != nil || len(result.rows) == 0 {
+		// New messages may have been published since the batch was prefetched.
+		prefetch.stop()
+		return nil, false
+	}
+
+	ackedOffset, err := s.ackedOffset(ctx, tx, topic)
+	if err != nil {
+		logger.Debug("Discarding prefetched batch, could not query acked offset", watermill.LogFields{"err": err.Error()})
+		prefetch.stop()
+		return nil, false
+	}
+	if ackedOffset != result.afterOffset {
+		logger.Debug("Discarding prefetched batch, acked offset changed", watermill.LogFields{
+			"acked_offset":    ackedOffset,
+			"prefetched_from": result.afterOffset,
+		})
+		prefetch.stop()
+		return nil, false
+	}
+
+	return result.rows, true
+}
+
+// ackedOffset returns the offset acked by the consumer group, queried with NextOffsetQuery in the transaction,
+// so the offsets adapter also locks the consumer group, as it would when selecting the batch.
+func (s *Subscriber) ackedOffset(ctx context.Context, tx Tx, topic string) (int64, error) {
+	nextOffsetQuery := s.config.OffsetsAdapter.NextOffsetQuery(topic, s.config.ConsumerGroup)
+
+	queryCtx, cancelQuery := s.withQueryTimeout(ctx)
+	defer cancelQuery()
+
+	rows, err := tx.QueryContext(queryCtx, nextOffsetQuery.Query, nextOffsetQuery.Args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not query next offset")
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		// The consumer group didn't ack any messages yet.
+		return 0, rows.Err()
+	}
+
+	var offset sql.NullInt64
+	dest := []any{&offset}
+	if columnsScanner, ok := rows.(ColumnsScanner); ok {
+		// Some offsets adapters select more columns, like the last transaction ID of PostgreSQL.
+		columns, err := columnsScanner.Columns()
+		if err != nil {
+			return 0, errors.Wrap(err, "could not get next offset columns")
+		}
+		for i := 1; i < len(columns); i++ {
+			dest = append(dest, new(any))
+		}
+	}
+
+	if err := rows.Scan(dest...); err != nil {
+		return 0, errors.Wrap(err, "could not scan next offset")
+	}
+
+	return offset.Int64, nil
+}
+
+// prefetchOffsetsAdapter is passed to the schema adapter, so SelectQuery returns the messages after the row.
+// It's used also for the offsets cached with SubscriberConfig.CacheNextOffset.
+type prefetchOffsetsAdapter struct {
+	importOffsetsAdapter
+	after Row
+}
+
+func (a prefetchOffsetsAdapter) NextOffsetQuery(topic, consumerGroup string) Query {
+	// The values are inlined, as placeholders differ between databases.
+	offset := strconv.FormatInt(a.after.Offset, 10)
+
+	if transactionID, ok := a.after.ExtraData["transaction_id"].(int64); ok {
+		// DefaultPostgreSQLSchema compares also the transaction IDs.
+		return Query{
+			Query: "SELECT " + offset + " AS offset_acked, '" + strconv.FormatInt(transactionID, 10) + "'::xid8 AS last_processed_transaction_id",
+		}
+	}
+
+	return Query{Query: "SELECT " + offset}
+}
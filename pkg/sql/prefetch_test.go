@@ -0,0 +1,122 @@
+package sql_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selectCountingSchema counts the batches selected in subscription transactions and the prefetched ones.
+type selectCountingSchema struct {
+	sql.DefaultSQLiteSchema
+
+	selected   *atomic.Int64
+	prefetched *atomic.Int64
+}
+
+func (s selectCountingSchema) SelectQuery(topic string, consumerGroup string, offsetsAdapter sql.OffsetsAdapter) sql.Query {
+	if _, ok := offsetsAdapter.(sql.DefaultSQLiteOffsetsAdapter); ok {
+		s.selected.Add(1)
+	} else {
+		s.prefetched.Add(1)
+	}
+
+	return s.DefaultSQLiteSchema.SelectQuery(topic, consumerGroup, offsetsAdapter)
+}
+
+func TestSubscriber_Prefetch(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topicName := "topic_" + watermill.NewShortUUID()
+
+	schemaAdapter := selectCountingSchema{
+		DefaultSQLiteSchema: newSQLiteSchemaAdapter(2),
+		selected:            &atomic.Int64{},
+		prefetched:          &atomic.Int64{},
+	}
+
+	publisher := newCheckpointPublisher(t, db, schemaAdapter)
+	var published []string
+	for i := 0; i < 10; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), nil)
+		require.NoError(t, publisher.Publish(topicName, msg))
+		published = append(published, msg.UUID)
+	}
+
+	ackDeadline := time.Millisecond * 200
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "prefetch",
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+		AckDeadline:      &ackDeadline,
+		PrefetchBatches:  2,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumed, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	receive := func() *message.Message {
+		select {
+		case msg := <-consumed:
+			return msg
+		case <-time.After(time.Second * 5):
+			t.Fatal("timeout waiting for message")
+			return nil
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		msg := receive()
+		assert.Equal(t, published[i], msg.UUID)
+		msg.Ack()
+	}
+
+	// The message is not acked within the ack deadline, so the batches prefetched after it are discarded.
+	assert.Equal(t, published[4], receive().UUID)
+
+	for i := 4; i < 10; i++ {
+		msg := receive()
+		assert.Equal(t, published[i], msg.UUID, "messages should be delivered in order")
+		msg.Ack()
+	}
+
+	assert.Greater(t, schemaAdapter.prefetched.Load(), int64(0), "batches should be prefetched")
+	assert.Less(t, schemaAdapter.selected.Load(), int64(6), "prefetched batches should be used instead of selecting them")
+
+	select {
+	case msg := <-consumed:
+		t.Fatalf("message %s should not be redelivered", msg.UUID)
+	case <-time.After(time.Millisecond * 300):
+	}
+}
+
+func TestSubscriberConfig_PrefetchValidation(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+
+	_, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:   newSQLiteSchemaAdapter(0),
+		OffsetsAdapter:  sql.DefaultD1OffsetsAdapter{},
+		PrefetchBatches: 1,
+	}, logger)
+	require.Error(t, err, "prefetching should not be allowed with non-transactional offsets adapter")
+
+	_, err = sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:   newSQLiteSchemaAdapter(0),
+		OffsetsAdapter:  sql.DefaultSQLiteOffsetsAdapter{},
+		PrefetchBatches: -1,
+	}, logger)
+	require.Error(t, err)
+}
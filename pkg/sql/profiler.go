@@ -0,0 +1,386 @@
+package sql
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// TopicProfile is the profile of the stored messages of a topic, made by SQLiteProfiler from a sample of them.
+type TopicProfile struct {
+	Topic string
+
+	// Messages is the number of messages stored in the topic.
+	Messages int64
+
+	// FirstOffset and LastOffset are the lowest and the highest offsets of the topic's messages.
+	FirstOffset int64
+	LastOffset  int64
+
+	// SampledMessages is the number of sampled messages.
+	SampledMessages int
+
+	// PayloadSize is the distribution of the sizes of the sampled payloads, in bytes.
+	PayloadSize SizeDistribution
+
+	// CompressionRatio is the estimated ratio of the size of the payloads to their size compressed with DEFLATE,
+	// for example, 3 if the payloads compress to a third of their size. Every payload is compressed separately.
+	// It's 1 if the sampled payloads are empty.
+	CompressionRatio float64
+
+	// MetadataKeys are the metadata keys of the sampled messages, ordered by the keys.
+	MetadataKeys []MetadataKeyProfile
+}
+
+// SizeDistribution is the distribution of sizes in bytes.
+type SizeDistribution struct {
+	Min   int
+	Max   int
+	Mean  float64
+	P50   int
+	P90   int
+	P99   int
+	Total int64
+}
+
+// MetadataKeyProfile is the profile of a metadata key of the sampled messages.
+type MetadataKeyProfile struct {
+	Key string
+
+	// Messages is the number of sampled messages with the key.
+	Messages int
+
+	// DistinctValues is the number of distinct values of the key in the sampled messages.
+	// It's at most SQLiteProfiler.MaxDistinctValues, and ValuesCapped is true when more values were seen.
+	DistinctValues int
+	ValuesCapped   bool
+}
+
+// Advice returns the suggested changes of the configuration of the topic based on the profile:
+// compressing payloads which compress well, storing large payloads outside of the messages table,
+// and indexing metadata keys identifying messages.
+func (p TopicProfile) Advice() []string {
+	if p.SampledMessages == 0 {
+		return nil
+	}
+
+	var advice []string
+
+	if p.CompressionRatio >= 2 && p.PayloadSize.Mean >= 512 {
+		advice = append(advice, fmt.Sprintf(
+			"Payloads compress %.1fx (mean size %.0f B). Compress them before publishing, and decompress them with SubscriberConfig.Transforms.",
+			p.CompressionRatio, p.PayloadSize.Mean,
+		))
+	}
+
+	if p.PayloadSize.P99 >= 256*1024 {
+		advice = append(advice, fmt.Sprintf(
+			"1%% of payloads are larger than %d B. Store large payloads outside of the messages table (like in object storage) and publish references to them.",
+			p.PayloadSize.P99,
+		))
+	}
+
+	// A few sampled messages may have distinct values of any key.
+	if p.SampledMessages < 10 {
+		return advice
+	}
+	for _, key := range p.MetadataKeys {
+		if key.Messages*10 < p.SampledMessages*9 || !key.ValuesCapped && key.DistinctValues*10 < key.Messages*9 {
+			continue
+		}
+		advice = append(advice, fmt.Sprintf(
+			"Metadata key %s identifies messages. If messages are looked up by it, index it with BusinessKey or PromotedColumnsMetadata.",
+			key.Key,
+		))
+	}
+
+	return advice
+}
+
+// SQLiteProfiler profiles the stored messages of topics stored with DefaultSQLiteSchema: the distribution
+// of payload sizes, the cardinality of metadata keys, and the estimated compression ratio of payloads
+// (see TopicProfile and TopicProfile.Advice), to guide the configuration of compression, storing large payloads
+// and indexes.
+//
+// Messages are sampled with exponential spacing of offsets back from the last message, so the recent messages,
+// which reflect the current producers, are sampled densely, and the history is covered with few reads.
+// Every sampled message is read with a separate query selecting it by the offset index. Nothing is written.
+type SQLiteProfiler struct {
+	// DB is the database storing the topics. It's required.
+	DB QueryExecutor
+
+	SchemaAdapter DefaultSQLiteSchema
+
+	// SampleSize is the maximum number of sampled messages of every topic.
+	//
+	// Default value is 200.
+	SampleSize int
+
+	// MaxDistinctValues is the maximum number of distinct values of every metadata key counted in the sample.
+	//
+	// Default value is 1000.
+	MaxDistinctValues int
+}
+
+// ProfileTopics profiles all topics of the SQLite database stored with the default schema adapter.
+// See SQLiteProfiler.
+func ProfileTopics(ctx context.Context, db QueryExecutor) ([]TopicProfile, error) {
+	p := SQLiteProfiler{DB: db}
+
+	topics, err := p.admin().messagesTopics(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]TopicProfile, 0, len(topics))
+	for _, topic := range topics {
+		profile, err := p.Profile(ctx, topic)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+// Profile profiles the stored messages of the topic.
+func (p SQLiteProfiler) Profile(ctx context.Context, topic string) (TopicProfile, error) {
+	if p.DB == nil {
+		return TopicProfile{}, errors.New("db is nil")
+	}
+	if err := validateTopicName(topic); err != nil {
+		return TopicProfile{}, err
+	}
+
+	messagesTable := p.SchemaAdapter.MessagesTable(topic)
+	exists, err := p.admin().tableExists(ctx, unquotedTableName(messagesTable))
+	if err != nil {
+		return TopicProfile{}, err
+	}
+	if !exists {
+		return TopicProfile{}, errors.Wrap(ErrTopicNotFound, topic)
+	}
+
+	profile := TopicProfile{Topic: topic, CompressionRatio: 1}
+
+	rows, err := p.DB.QueryContext(
+		ctx,
+		`SELECT COUNT(*), COALESCE(MIN("offset"), 0), COALESCE(MAX("offset"), 0) FROM `+messagesTable,
+	)
+	if err != nil {
+		return TopicProfile{}, errors.Wrapf(err, "could not query stats of topic %s", topic)
+	}
+	if rows.Next() {
+		err = rows.Scan(&profile.Messages, &profile.FirstOffset, &profile.LastOffset)
+	}
+	_ = rows.Close()
+	if err != nil {
+		return TopicProfile{}, errors.Wrapf(err, "could not scan stats of topic %s", topic)
+	}
+	if profile.Messages == 0 {
+		return profile, nil
+	}
+
+	schemaAdapter := p.SchemaAdapter
+	schemaAdapter.SubscribeBatchSize = 1
+
+	sample := newProfileSample(p.maxDistinctValues())
+	sampled := map[int64]struct{}{}
+	for _, distance := range exponentialDistances(profile.LastOffset-profile.FirstOffset+1, p.sampleSize()) {
+		rows, err := readMessagesAfter(ctx, p.DB, schemaAdapter, topic, profile.LastOffset-distance-1)
+		if err != nil {
+			return TopicProfile{}, errors.Wrapf(err, "could not sample messages of topic %s", topic)
+		}
+		// Offsets of deleted messages may be sampled, so the next message may have been sampled already.
+		if len(rows) == 0 {
+			continue
+		}
+		if _, ok := sampled[rows[0].Offset]; ok {
+			continue
+		}
+		sampled[rows[0].Offset] = struct{}{}
+
+		if err := sample.add(rows[0].Msg.Payload, rows[0].Msg.Metadata); err != nil {
+			return TopicProfile{}, err
+		}
+	}
+
+	sample.profile(&profile)
+
+	return profile, nil
+}
+
+func (p SQLiteProfiler) admin() SQLiteTopicAdmin {
+	return SQLiteTopicAdmin{
+		DB:            p.DB,
+		SchemaAdapter: p.SchemaAdapter,
+	}
+}
+
+func (p SQLiteProfiler) sampleSize() int {
+	if p.SampleSize > 0 {
+		return p.SampleSize
+	}
+
+	return 200
+}
+
+func (p SQLiteProfiler) maxDistinctValues() int {
+	if p.MaxDistinctValues > 0 {
+		return p.MaxDistinctValues
+	}
+
+	return 1000
+}
+
+// exponentialDistances returns at most n distances from the last of span offsets, growing exponentially
+// from 0 to span-1, so every distance is at least one greater than the previous one.
+func exponentialDistances(span int64, n int) []int64 {
+	if span <= int64(n) {
+		distances := make([]int64, span)
+		for i := range distances {
+			distances[i] = int64(i)
+		}
+		return distances
+	}
+
+	growth := math.Pow(float64(span), 1/float64(n-1))
+	distances := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		distance := int64(math.Pow(growth, float64(i))) - 1
+		if len(distances) > 0 && distance <= distances[len(distances)-1] {
+			distance = distances[len(distances)-1] + 1
+		}
+		if distance > span-1 {
+			break
+		}
+		distances = append(distances, distance)
+	}
+
+	return distances
+}
+
+type profileSample struct {
+	maxDistinctValues int
+
+	sizes      []int
+	compressed int64
+
+	keys map[string]*metadataKeySample
+
+	compressor *flate.Writer
+	buffer     bytes.Buffer
+}
+
+type metadataKeySample struct {
+	messages int
+	values   map[string]struct{}
+	capped   bool
+}
+
+func newProfileSample(maxDistinctValues int) *profileSample {
+	return &profileSample{
+		maxDistinctValues: maxDistinctValues,
+		keys:              map[string]*metadataKeySample{},
+	}
+}
+
+func (s *profileSample) add(payload []byte, metadata map[string]string) error {
+	s.sizes = append(s.sizes, len(payload))
+
+	if len(payload) > 0 {
+		s.buffer.Reset()
+		if s.compressor == nil {
+			compressor, err := flate.NewWriter(&s.buffer, flate.DefaultCompression)
+			if err != nil {
+				return errors.Wrap(err, "could not create compressor")
+			}
+			s.compressor = compressor
+		} else {
+			s.compressor.Reset(&s.buffer)
+		}
+
+		if _, err := s.compressor.Write(payload); err != nil {
+			return errors.Wrap(err, "could not compress payload")
+		}
+		if err := s.compressor.Close(); err != nil {
+			return errors.Wrap(err, "could not compress payload")
+		}
+		s.compressed += int64(s.buffer.Len())
+	}
+
+	for key, value := range metadata {
+		k, ok := s.keys[key]
+		if !ok {
+			k = &metadataKeySample{values: map[string]struct{}{}}
+			s.keys[key] = k
+		}
+
+		k.messages++
+		if _, ok := k.values[value]; ok {
+			continue
+		}
+		if len(k.values) < s.maxDistinctValues {
+			k.values[value] = struct{}{}
+		} else {
+			k.capped = true
+		}
+	}
+
+	return nil
+}
+
+func (s *profileSample) profile(profile *TopicProfile) {
+	profile.SampledMessages = len(s.sizes)
+	if len(s.sizes) == 0 {
+		return
+	}
+
+	sizes := append([]int(nil), s.sizes...)
+	sort.Ints(sizes)
+
+	distribution := SizeDistribution{
+		Min: sizes[0],
+		Max: sizes[len(sizes)-1],
+		P50: percentile(sizes, 0.5),
+		P90: percentile(sizes, 0.9),
+		P99: percentile(sizes, 0.99),
+	}
+	for _, size := range sizes {
+		distribution.Total += int64(size)
+	}
+	distribution.Mean = float64(distribution.Total) / float64(len(sizes))
+	profile.PayloadSize = distribution
+
+	if s.compressed > 0 {
+		profile.CompressionRatio = float64(distribution.Total) / float64(s.compressed)
+	}
+
+	for key, k := range s.keys {
+		profile.MetadataKeys = append(profile.MetadataKeys, MetadataKeyProfile{
+			Key:            key,
+			Messages:       k.messages,
+			DistinctValues: len(k.values),
+			ValuesCapped:   k.capped,
+		})
+	}
+	sort.Slice(profile.MetadataKeys, func(i, j int) bool {
+		return profile.MetadataKeys[i].Key < profile.MetadataKeys[j].Key
+	})
+}
+
+// percentile returns the nearest-rank percentile of the sorted sizes.
+func percentile(sorted []int, p float64) int {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
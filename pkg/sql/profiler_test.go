@@ -0,0 +1,64 @@
+package sql_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteProfiler(t *testing.T) {
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topic := "profiled_" + watermill.NewShortUUID()
+
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+	var messages []*message.Message
+	for i := 0; i < 1000; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), bytes.Repeat([]byte("order placed "), 100))
+		msg.Metadata.Set("order_id", fmt.Sprintf("order-%d", i))
+		msg.Metadata.Set("tenant", []string{"acme", "globex"}[i%2])
+		messages = append(messages, msg)
+	}
+	require.NoError(t, publisher.Publish(topic, messages...))
+
+	profile, err := sql.SQLiteProfiler{DB: db, SampleSize: 50}.Profile(ctx, topic)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1000), profile.Messages)
+	assert.Equal(t, int64(1000), profile.LastOffset-profile.FirstOffset+1)
+	assert.Equal(t, 50, profile.SampledMessages)
+	assert.Equal(t, sql.SizeDistribution{
+		Min:   1300,
+		Max:   1300,
+		Mean:  1300,
+		P50:   1300,
+		P90:   1300,
+		P99:   1300,
+		Total: 50 * 1300,
+	}, profile.PayloadSize)
+	assert.Greater(t, profile.CompressionRatio, 10.0)
+
+	keys := map[string]sql.MetadataKeyProfile{}
+	for _, key := range profile.MetadataKeys {
+		keys[key.Key] = key
+	}
+	assert.Equal(t, sql.MetadataKeyProfile{Key: "order_id", Messages: 50, DistinctValues: 50}, keys["order_id"])
+	assert.Equal(t, sql.MetadataKeyProfile{Key: "tenant", Messages: 50, DistinctValues: 2}, keys["tenant"])
+
+	advice := profile.Advice()
+	require.NotEmpty(t, advice)
+	assert.Contains(t, advice[0], "Compress them before publishing")
+	for _, a := range advice {
+		assert.NotContains(t, a, "tenant", "keys with few values should not be indexed")
+	}
+
+	_, err = sql.SQLiteProfiler{DB: db}.Profile(ctx, "missing")
+	assert.ErrorIs(t, err, sql.ErrTopicNotFound)
+}
@@ -0,0 +1,145 @@
+package sql
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// ProjectionFunc applies the message to the read model, using the transaction in which the message is consumed.
+// When it returns an error, its changes are rolled back, and the message is projected again after
+// SubscriberConfig.ResendInterval.
+type ProjectionFunc func(ctx context.Context, tx QueryExecutor, msg *message.Message) error
+
+// ProjectionQuery returns ProjectionFunc executing the query built for every message,
+// for example, an upsert of the read model's row.
+func ProjectionQuery(query func(msg *message.Message) (Query, error)) ProjectionFunc {
+	return func(ctx context.Context, tx QueryExecutor, msg *message.Message) error {
+		q, err := query(msg)
+		if err != nil {
+			return errors.Wrap(err, "could not build projection query")
+		}
+
+		if _, err := tx.ExecContext(ctx, q.Query, q.Args...); err != nil {
+			return errors.Wrap(err, "could not execute projection query")
+		}
+
+		return nil
+	}
+}
+
+type ProjectorConfig struct {
+	// SubscriberConfig configures the subscriber consuming the projected topic. SchemaAdapter and OffsetsAdapter
+	// are required, and the offsets adapter must consume messages in transactions.
+	//
+	// UseSavepoints is always enabled, so changes of a failed projection are rolled back,
+	// while the already projected messages of the batch are committed.
+	SubscriberConfig SubscriberConfig
+
+	// Project applies the messages to the read model. It's required.
+	Project ProjectionFunc
+
+	// InitializeQueries are executed by Run before consuming the topic, for example, to create the read model's table.
+	// They should be idempotent (like CREATE TABLE IF NOT EXISTS).
+	InitializeQueries []Query
+}
+
+func (c ProjectorConfig) validate() error {
+	if c.Project == nil {
+		return errors.New("project func is nil")
+	}
+	if _, ok := c.SubscriberConfig.OffsetsAdapter.(NonTransactionalOffsetsAdapter); ok {
+		return errors.New("offsets adapter must consume messages in transactions")
+	}
+
+	return nil
+}
+
+// Projector maintains a read model in the same database as the topic, projecting every message
+// in the transaction in which it's consumed. The changes of the read model are committed together with
+// the consumer group's offset, so every message is applied to the read model exactly once.
+//
+// The read model must be modified only with the QueryExecutor passed to ProjectionFunc.
+// Side effects outside the database (like sending emails) may still be repeated.
+type Projector struct {
+	db         TxBeginner
+	config     ProjectorConfig
+	subscriber *Subscriber
+	logger     watermill.LoggerAdapter
+}
+
+func NewProjector(db TxBeginner, config ProjectorConfig, logger watermill.LoggerAdapter) (*Projector, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	subscriberConfig := config.SubscriberConfig
+	subscriberConfig.UseSavepoints = true
+
+	subscriber, err := NewSubscriberWithTxBeginner(db, subscriberConfig, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create subscriber")
+	}
+
+	return &Projector{
+		db:         db,
+		config:     config,
+		subscriber: subscriber,
+		logger:     logger,
+	}, nil
+}
+
+// Run projects the messages of the topic until the context is canceled or the projector is closed.
+func (p *Projector) Run(ctx context.Context, topic string) error {
+	for _, q := range p.config.InitializeQueries {
+		if _, err := p.db.ExecContext(ctx, q.Query, q.Args...); err != nil {
+			return errors.Wrap(err, "could not initialize read model")
+		}
+	}
+
+	messages, err := p.subscriber.Subscribe(ctx, topic)
+	if err != nil {
+		return errors.Wrap(err, "could not subscribe")
+	}
+
+	logger := p.logger.With(watermill.LogFields{
+		"topic": topic,
+	})
+
+	for msg := range messages {
+		if err := p.project(msg); err != nil {
+			logger.Error("Could not project message", err, watermill.LogFields{
+				"msg_uuid": msg.UUID,
+			})
+			msg.Nack()
+			continue
+		}
+
+		msg.Ack()
+	}
+
+	return nil
+}
+
+func (p *Projector) project(msg *message.Message) error {
+	tx, ok := msg.Context().Value(txContextKey).(Tx)
+	if !ok {
+		return errors.New("message was not consumed in a transaction")
+	}
+
+	return p.config.Project(msg.Context(), tx, msg)
+}
+
+// Close stops projecting. Changes of messages which were not acked yet are rolled back.
+func (p *Projector) Close() error {
+	return p.subscriber.Close()
+}
@@ -0,0 +1,111 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjector(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "projector.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topic := "projected_" + watermill.NewShortUUID()
+
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+	for _, name := range []string{"a", "b", "a", "fail", "a"} {
+		require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte(name))))
+	}
+
+	upsert := sql.ProjectionQuery(func(msg *message.Message) (sql.Query, error) {
+		return sql.Query{
+			Query: `INSERT INTO counts (name, count) VALUES (?, 1)
+				ON CONFLICT (name) DO UPDATE SET count = count + 1`,
+			Args: []any{string(msg.Payload)},
+		}, nil
+	})
+
+	failed := false
+	projector, err := sql.NewProjector(db, sql.ProjectorConfig{
+		SubscriberConfig: sql.SubscriberConfig{
+			SchemaAdapter:    sql.DefaultSQLiteSchema{},
+			OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+			InitializeSchema: true,
+			PollInterval:     time.Millisecond * 10,
+			ResendInterval:   time.Millisecond * 10,
+		},
+		Project: func(ctx context.Context, tx sql.QueryExecutor, msg *message.Message) error {
+			if err := upsert(ctx, tx, msg); err != nil {
+				return err
+			}
+			if string(msg.Payload) == "fail" && !failed {
+				failed = true
+				return errors.New("projection failed")
+			}
+			return nil
+		},
+		InitializeQueries: []sql.Query{
+			{Query: `CREATE TABLE IF NOT EXISTS counts (name TEXT PRIMARY KEY, count INTEGER NOT NULL)`},
+		},
+	}, logger)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- projector.Run(ctx, topic)
+	}()
+
+	counts := func() map[string]int {
+		rows, err := sqlDB.Query(`SELECT name, count FROM counts`)
+		if err != nil {
+			return nil
+		}
+		defer rows.Close()
+
+		counts := map[string]int{}
+		for rows.Next() {
+			var name string
+			var count int
+			require.NoError(t, rows.Scan(&name, &count))
+			counts[name] = count
+		}
+		return counts
+	}
+
+	expected := map[string]int{"a": 3, "b": 1, "fail": 1}
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(expected, counts())
+	}, time.Second*5, time.Millisecond*20)
+
+	require.NoError(t, projector.Close())
+	require.NoError(t, <-done)
+	assert.True(t, failed)
+	assert.Equal(t, expected, counts())
+}
+
+func TestNewProjector_requiresTransactions(t *testing.T) {
+	_, err := sql.NewProjector(sql.BeginnerFromStdSQL(newSQLite(t)), sql.ProjectorConfig{
+		SubscriberConfig: sql.SubscriberConfig{
+			SchemaAdapter:  sql.DefaultSQLiteSchema{},
+			OffsetsAdapter: sql.DefaultD1OffsetsAdapter{},
+		},
+		Project: func(ctx context.Context, tx sql.QueryExecutor, msg *message.Message) error {
+			return nil
+		},
+	}, logger)
+	assert.Error(t, err)
+}
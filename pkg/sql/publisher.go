@@ -2,6 +2,8 @@ package sql
 
 import (
 	"context"
+	"database/sql"
+	"sort"
 	"sync"
 
 	"github.com/pkg/errors"
@@ -23,6 +25,62 @@ type PublisherConfig struct {
 	// AutoInitializeSchema is forbidden if using an ongoing transaction as database handle;
 	// That could result in an implicit commit of the transaction by a CREATE TABLE statement.
 	AutoInitializeSchema bool
+
+	// SchemaIntrospector may be used to verify the schema of every topic with VerifySchema before the first publish,
+	// so publishing to tables which don't match SchemaAdapter fails with a detailed error.
+	// The schema is verified after it's initialized, if AutoInitializeSchema is enabled.
+	SchemaIntrospector SchemaIntrospector
+
+	// SchemaVersion may be used to record the schema version of published messages' payloads
+	// (see SchemaVersionMetadataKey). Messages which already have a version are not changed.
+	SchemaVersion func(topic string, msg *message.Message) int
+
+	// Encryptor may be used to encrypt payloads of published messages with the current key of the topic.
+	// Published messages are not changed, as encrypted copies are inserted.
+	// Subscribers must decrypt the messages with Encryptor.Decrypt.
+	Encryptor *Encryptor
+
+	// Deduplicator may be used to skip published messages which were already published, like the messages
+	// with the same deduplication ID published within the deduplication window (see SQLiteFIFODeduplicator).
+	// Messages are deduplicated in the transaction inserting them, so the database handle must be able to begin
+	// transactions, or be a transaction, or TxProvider must be set.
+	Deduplicator PublishDeduplicator
+
+	// IdempotencyStore records the results of PublishIdempotent by their tokens (see SQLiteIdempotencyStore).
+	// It's required by PublishIdempotent.
+	IdempotencyStore IdempotencyStore
+
+	// AuditSink may be used to record who published the messages (see ContextWithActor).
+	// Use TopicAuditSinks to record the messages of chosen topics separately.
+	AuditSink AuditSink
+
+	// TrackOrdering is a debug option numbering the published messages of every partition
+	// (see OrderingSourceMetadataKey and OrderingSequenceMetadataKey), so subscribers can verify that they're consumed
+	// in the order they were published with SubscriberConfig.ValidateOrdering.
+	//
+	// Messages are numbered in the order they're passed to Publish, so messages published concurrently
+	// are not ordered. Messages which failed to be published leave gaps in the sequence.
+	TrackOrdering bool
+
+	// OrderingPartitionMetadataKey is the metadata key of the partition of the messages numbered with TrackOrdering.
+	// Messages without it belong to one partition.
+	//
+	// Default value is PartitionKeyMetadataKey.
+	OrderingPartitionMetadataKey string
+
+	// EventsBufferSize is the size of the buffer of the channel returned by Events.
+	// Events are dropped when the buffer is full.
+	//
+	// Default value is 1024.
+	EventsBufferSize int
+
+	// TxProvider may be used to provide the transaction used for inserting messages.
+	// The context of the first published message is passed to the provider.
+	// The transaction is committed after the messages are inserted. Transactions failing with a retryable error
+	// are retried like with RunInTx.
+	//
+	// If TxProvider is nil, messages are inserted with the database handle passed to NewPublisher.
+	TxProvider TxProvider
 }
 
 func (c PublisherConfig) validate() error {
@@ -34,23 +92,45 @@ func (c PublisherConfig) validate() error {
 }
 
 func (c *PublisherConfig) setDefaults() {
+	if c.EventsBufferSize == 0 {
+		c.EventsBufferSize = 1024
+	}
+	if c.OrderingPartitionMetadataKey == "" {
+		c.OrderingPartitionMetadataKey = PartitionKeyMetadataKey
+	}
 }
 
 // Publisher inserts the Messages as rows into a SQL table..
 type Publisher struct {
 	config PublisherConfig
 
-	db ContextExecutor
+	db QueryExecutor
 
 	publishWg *sync.WaitGroup
 	closeCh   chan struct{}
 	closed    bool
 
 	initializedTopics sync.Map
+	ordering          *orderingTracker
+	events            *eventEmitter
 	logger            watermill.LoggerAdapter
 }
 
+// NewPublisher creates a Publisher inserting the messages with the database/sql handle,
+// like *sql.DB, or *sql.Tx to publish within a transaction handled by the user.
 func NewPublisher(db ContextExecutor, config PublisherConfig, logger watermill.LoggerAdapter) (*Publisher, error) {
+	var executor QueryExecutor
+	if db != nil {
+		executor = queryExecutorFromStdSQL(db)
+	}
+
+	return NewPublisherWithExecutor(executor, config, logger)
+}
+
+// NewPublisherWithExecutor creates a Publisher inserting the messages with the QueryExecutor,
+// like the ones returned by BeginnerFromPgx and TxFromPgx, or ExecutorFromStdSQL.
+// If the executor implements TxBeginner, every Publish call is executed in a new transaction.
+func NewPublisherWithExecutor(db QueryExecutor, config PublisherConfig, logger watermill.LoggerAdapter) (*Publisher, error) {
 	config.setDefaults()
 	if err := config.validate(); err != nil {
 		return nil, errors.Wrap(err, "invalid config")
@@ -78,7 +158,9 @@ func NewPublisher(db ContextExecutor, config PublisherConfig, logger watermill.L
 		closeCh:   make(chan struct{}),
 		closed:    false,
 
-		logger: logger,
+		ordering: newOrderingTracker(config.TrackOrdering, config.OrderingPartitionMetadataKey),
+		events:   newEventEmitter(config.EventsBufferSize),
+		logger:   logger,
 	}, nil
 }
 
@@ -95,15 +177,30 @@ func (p *Publisher) Publish(topic string, messages ...*message.Message) (err err
 	p.publishWg.Add(1)
 	defer p.publishWg.Done()
 
-	if err := validateTopicName(topic); err != nil {
+	insertedMessages, err := p.prepareMessages(topic, messages)
+	if err != nil {
 		return err
 	}
 
-	if err := p.initializeSchema(topic); err != nil {
-		return err
+	if p.insertsInTx() {
+		ctx := context.Background()
+		if len(messages) > 0 {
+			ctx = messages[0].Context()
+		}
+
+		err = p.inTx(ctx, func(ctx context.Context, db QueryExecutor) error {
+			return p.insertMessages(ctx, db, topic, messages, insertedMessages)
+		})
+		if err != nil {
+			p.events.emit(PublishFailed{Topic: topic, Err: err})
+			return err
+		}
+
+		p.messagesPublished(ctx, topic, messages)
+		return nil
 	}
 
-	insertQuery, err := p.config.SchemaAdapter.InsertQuery(topic, messages)
+	insertQuery, err := p.config.SchemaAdapter.InsertQuery(topic, insertedMessages)
 	if err != nil {
 		return errors.Wrap(err, "cannot create insert query")
 	}
@@ -113,16 +210,306 @@ func (p *Publisher) Publish(topic string, messages ...*message.Message) (err err
 		"query_args": sqlArgsToLog(insertQuery.Args),
 	})
 
-	_, err = p.db.ExecContext(context.Background(), insertQuery.Query, insertQuery.Args...)
+	ctx := context.Background()
+	if len(messages) > 0 {
+		ctx = messages[0].Context()
+	}
+
+	if p.config.TxProvider == nil {
+		err = p.insert(context.Background(), p.db, insertQuery)
+	} else {
+		// Transactions of TxProvider are retried like the transactions of inTx.
+		err = p.inTx(ctx, func(ctx context.Context, db QueryExecutor) error {
+			return p.insert(ctx, db, insertQuery)
+		})
+	}
+	if err != nil {
+		p.events.emit(PublishFailed{Topic: topic, Err: err})
+		return err
+	}
+
+	p.messagesPublished(ctx, topic, messages)
+
+	return nil
+}
+
+// PublishMulti inserts the messages of several topics in one transaction, so either all of them are published,
+// or none of them, for example, when related events must be emitted to multiple topics atomically.
+// Order is guaranteed for messages of one topic.
+//
+// Topics are inserted in the order of their names, so concurrent calls lock the tables in the same order.
+// The database handle must be able to begin transactions, or be a transaction, or TxProvider must be set.
+func (p *Publisher) PublishMulti(ctx context.Context, messages map[string][]*message.Message) error {
+	if p.closed {
+		return ErrPublisherClosed
+	}
+
+	p.publishWg.Add(1)
+	defer p.publishWg.Done()
+
+	topics := make([]string, 0, len(messages))
+	for topic := range messages {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	insertedMessages := map[string]message.Messages{}
+	for _, topic := range topics {
+		inserted, err := p.prepareMessages(topic, messages[topic])
+		if err != nil {
+			return errors.Wrapf(err, "could not prepare messages of topic %s", topic)
+		}
+		insertedMessages[topic] = inserted
+	}
+
+	err := p.inTx(ctx, func(ctx context.Context, db QueryExecutor) error {
+		for _, topic := range topics {
+			if err := p.insertMessages(ctx, db, topic, messages[topic], insertedMessages[topic]); err != nil {
+				return errors.Wrapf(err, "could not publish to topic %s", topic)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		for _, topic := range topics {
+			p.events.emit(PublishFailed{Topic: topic, Err: err})
+		}
+		return err
+	}
+
+	for _, topic := range topics {
+		p.messagesPublished(ctx, topic, messages[topic])
+	}
+
+	return nil
+}
+
+// messagesPublished is called after the messages were inserted (and committed, unless the database handle
+// is a transaction).
+func (p *Publisher) messagesPublished(ctx context.Context, topic string, messages []*message.Message) {
+	p.events.emit(MessagesPublished{Topic: topic, Messages: len(messages)})
+
+	if !isTx(p.db) {
+		wakeReadYourWritesSubscribers(p.db, topic)
+	}
+
+	if p.config.AuditSink != nil && len(messages) > 0 {
+		uuids := make([]string, len(messages))
+		for i, msg := range messages {
+			uuids[i] = msg.UUID
+		}
+
+		record := newAuditRecord(ctx, AuditActionPublished, topic, uuids)
+		if err := p.config.AuditSink.Record(ctx, record); err != nil {
+			p.logger.Error("Could not record published messages", err, watermill.LogFields{"topic": topic})
+		}
+	}
+}
+
+// prepareMessages validates the topic, initializes its schema, and sets the metadata of the messages.
+// It returns the messages which should be inserted, which are encrypted copies when Encryptor is set.
+func (p *Publisher) prepareMessages(topic string, messages message.Messages) (message.Messages, error) {
+	if err := validateTopic(p.config.SchemaAdapter, topic); err != nil {
+		return nil, err
+	}
+
+	if err := p.initializeSchema(topic); err != nil {
+		return nil, err
+	}
+
+	for _, msg := range messages {
+		setCausalityMetadata(msg)
+
+		if p.config.SchemaVersion != nil && msg.Metadata.Get(SchemaVersionMetadataKey) == "" {
+			SetSchemaVersion(msg, p.config.SchemaVersion(topic, msg))
+		}
+	}
+	p.ordering.track(topic, messages)
+
+	if p.config.Encryptor == nil {
+		return messages, nil
+	}
+
+	insertedMessages := make(message.Messages, len(messages))
+	for i, msg := range messages {
+		encrypted, err := p.config.Encryptor.Encrypt(topic, msg)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot encrypt message")
+		}
+		insertedMessages[i] = encrypted
+	}
+
+	return insertedMessages, nil
+}
+
+// Events returns the channel of lifecycle events of the publisher (see Event).
+// The channel is closed when the publisher is closed.
+func (p *Publisher) Events() <-chan Event {
+	return p.events.Events()
+}
+
+func (p *Publisher) insert(ctx context.Context, db QueryExecutor, insertQuery Query) error {
+	_, err := db.ExecContext(ctx, insertQuery.Query, insertQuery.Args...)
 	if err != nil {
-		return errors.Wrap(err, "could not insert message as row")
+		return errors.Wrap(TranslateError(err), "could not insert message as row")
 	}
 
 	return nil
 }
 
+// insertsInTx returns true if the messages must be inserted in a transaction together with other queries.
+func (p *Publisher) insertsInTx() bool {
+	_, chained := p.config.SchemaAdapter.(HashChainSchemaAdapter)
+	return chained || p.config.Deduplicator != nil
+}
+
+// insertMessages deduplicates and inserts the messages with db, which must be a transaction when the messages are
+// deduplicated or hash chained, so concurrent publishers don't insert duplicates or fork the hash chain.
+// insertedMessages are the (possibly encrypted) copies of messages.
+func (p *Publisher) insertMessages(
+	ctx context.Context,
+	db QueryExecutor,
+	topic string,
+	messages message.Messages,
+	insertedMessages message.Messages,
+) error {
+	msgs := insertedMessages
+	if p.config.Deduplicator != nil {
+		var err error
+		msgs, err = p.deduplicate(ctx, db, topic, messages, insertedMessages)
+		if err != nil {
+			return err
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	if chainAdapter, ok := p.config.SchemaAdapter.(HashChainSchemaAdapter); ok {
+		return p.insertChained(ctx, db, topic, chainAdapter, msgs)
+	}
+
+	insertQuery, err := p.config.SchemaAdapter.InsertQuery(topic, msgs)
+	if err != nil {
+		return errors.Wrap(err, "cannot create insert query")
+	}
+
+	p.logger.Trace("Inserting message to SQL", watermill.LogFields{
+		"query":      insertQuery.Query,
+		"query_args": sqlArgsToLog(insertQuery.Args),
+	})
+
+	return p.insert(ctx, db, insertQuery)
+}
+
+// inTx runs fn in a transaction of TxProvider or the database handle, or with the database handle
+// if it's already a transaction. Transactions of concurrent publishers may conflict, so they are retried.
+func (p *Publisher) inTx(ctx context.Context, fn func(ctx context.Context, db QueryExecutor) error) error {
+	return p.inTxWithOptions(ctx, RunInTxOptions{}, fn)
+}
+
+// inTxWithOptions is inTx retrying the transactions with the options. Transactions are not retried
+// when the database handle is already a transaction.
+func (p *Publisher) inTxWithOptions(
+	ctx context.Context,
+	options RunInTxOptions,
+	fn func(ctx context.Context, db QueryExecutor) error,
+) error {
+	inTx := func(ctx context.Context, tx Tx) error {
+		return fn(ctx, tx)
+	}
+
+	if p.config.TxProvider != nil {
+		return RunInTx(ctx, p.config.TxProvider, options, inTx)
+	}
+	if isTx(p.db) {
+		return fn(ctx, p.db)
+	}
+	if beginner, ok := p.db.(TxBeginner); ok {
+		return RunInTx(ctx, beginner, options, inTx)
+	}
+
+	return errors.New("publishing in a transaction requires a database handle which can begin transactions")
+}
+
+// deduplicate returns the inserted copies of the messages kept by the deduplicator.
+// The original messages are deduplicated, as encrypted payloads differ every time.
+func (p *Publisher) deduplicate(
+	ctx context.Context,
+	db QueryExecutor,
+	topic string,
+	messages message.Messages,
+	insertedMessages message.Messages,
+) (message.Messages, error) {
+	kept, err := p.config.Deduplicator.Deduplicate(ctx, db, topic, messages)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not deduplicate messages")
+	}
+
+	keptMessages := map[*message.Message]struct{}{}
+	for _, msg := range kept {
+		keptMessages[msg] = struct{}{}
+	}
+
+	var msgs message.Messages
+	for i, msg := range messages {
+		if _, ok := keptMessages[msg]; ok {
+			msgs = append(msgs, insertedMessages[i])
+		}
+	}
+
+	if skipped := len(messages) - len(msgs); skipped > 0 {
+		p.logger.Debug("Skipping duplicate published messages", watermill.LogFields{
+			"topic":   topic,
+			"skipped": skipped,
+		})
+	}
+
+	return msgs, nil
+}
+
+// insertChained inserts the messages with the hash chain continuing from the topic's last message.
+// The last message is queried in the same transaction, so concurrent publishers don't fork the chain.
+func (p *Publisher) insertChained(
+	ctx context.Context,
+	db QueryExecutor,
+	topic string,
+	chainAdapter HashChainSchemaAdapter,
+	msgs message.Messages,
+) error {
+	lastRowHashQuery := chainAdapter.LastRowHashQuery(topic)
+	rows, err := db.QueryContext(ctx, lastRowHashQuery.Query, lastRowHashQuery.Args...)
+	if err != nil {
+		return errors.Wrap(err, "could not query last row hash")
+	}
+
+	var lastRowHash []byte
+	if rows.Next() {
+		err = rows.Scan(&lastRowHash)
+	}
+	if closeErr := rows.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not scan last row hash")
+	}
+
+	insertQuery, err := chainAdapter.InsertChainedQuery(topic, msgs, lastRowHash)
+	if err != nil {
+		return errors.Wrap(err, "cannot create insert query")
+	}
+
+	p.logger.Trace("Inserting message to SQL", watermill.LogFields{
+		"query":      insertQuery.Query,
+		"query_args": sqlArgsToLog(insertQuery.Args),
+	})
+
+	return p.insert(ctx, db, insertQuery)
+}
+
 func (p *Publisher) initializeSchema(topic string) error {
-	if !p.config.AutoInitializeSchema {
+	if !p.config.AutoInitializeSchema && p.config.SchemaIntrospector == nil {
 		return nil
 	}
 
@@ -130,15 +517,23 @@ func (p *Publisher) initializeSchema(topic string) error {
 		return nil
 	}
 
-	if err := initializeSchema(
-		context.Background(),
-		topic,
-		p.logger,
-		p.db,
-		p.config.SchemaAdapter,
-		nil,
-	); err != nil {
-		return errors.Wrap(err, "cannot initialize schema")
+	if p.config.AutoInitializeSchema {
+		if err := initializeSchema(
+			context.Background(),
+			topic,
+			p.logger,
+			p.db,
+			p.config.SchemaAdapter,
+			nil,
+		); err != nil {
+			return errors.Wrap(err, "cannot initialize schema")
+		}
+	}
+
+	if p.config.SchemaIntrospector != nil {
+		if err := VerifySchema(context.Background(), p.db, p.config.SchemaIntrospector, p.config.SchemaAdapter, nil, topic); err != nil {
+			return errors.Wrap(err, "cannot verify schema")
+		}
 	}
 
 	p.initializedTopics.Store(topic, struct{}{})
@@ -157,11 +552,28 @@ func (p *Publisher) Close() error {
 
 	close(p.closeCh)
 	p.publishWg.Wait()
+	p.events.close()
 
 	return nil
 }
 
-func isTx(db ContextExecutor) bool {
+// queryExecutorFromStdSQL adapts the database/sql handle passed to NewPublisher.
+func queryExecutorFromStdSQL(db ContextExecutor) QueryExecutor {
+	switch db := db.(type) {
+	case *sql.Tx:
+		return TxFromStdSQL(db)
+	case Beginner:
+		return BeginnerFromStdSQL(db)
+	default:
+		return ExecutorFromStdSQL(db)
+	}
+}
+
+func isTx(db QueryExecutor) bool {
+	if executor, ok := db.(*stdSQLExecutor); ok {
+		return executor.isTransaction()
+	}
+
 	_, dbIsTx := db.(interface {
 		Commit() error
 		Rollback() error
@@ -5,6 +5,9 @@ import (
 	stdSQL "database/sql"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,10 +22,15 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
 )
 
 var (
 	logger = watermill.NewStdLogger(true, false)
+
+	sqliteDB     *stdSQL.DB
+	sqliteDBErr  error
+	sqliteDBOnce sync.Once
 )
 
 func newPubSub(t *testing.T, db *stdSQL.DB, consumerGroup string, schemaAdapter sql.SchemaAdapter, offsetsAdapter sql.OffsetsAdapter) (message.Publisher, message.Subscriber) {
@@ -107,6 +115,24 @@ func newPgxPostgreSQL(t *testing.T) *stdSQL.DB {
 	return db
 }
 
+// newSQLite returns a SQLite database shared by all tests, similar to the MySQL and PostgreSQL databases.
+func newSQLite(t *testing.T) *stdSQL.DB {
+	sqliteDBOnce.Do(func() {
+		path := os.Getenv("WATERMILL_TEST_SQLITE_PATH")
+		if path == "" {
+			path = filepath.Join(os.TempDir(), "watermill_test.sqlite")
+		}
+
+		sqliteDB, sqliteDBErr = stdSQL.Open("sqlite", path+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+		if sqliteDBErr == nil {
+			sqliteDBErr = sqliteDB.Ping()
+		}
+	})
+	require.NoError(t, sqliteDBErr)
+
+	return sqliteDB
+}
+
 func createMySQLPubSubWithConsumerGroup(t *testing.T, consumerGroup string) (message.Publisher, message.Subscriber) {
 	return newPubSub(
 		t,
@@ -140,6 +166,25 @@ func createMySQLPubSub(t *testing.T) (message.Publisher, message.Subscriber) {
 	return createMySQLPubSubWithConsumerGroup(t, "test")
 }
 
+func createMySQLSkipLockedPubSubWithConsumerGroup(t *testing.T, consumerGroup string) (message.Publisher, message.Subscriber) {
+	return newPubSub(
+		t,
+		newMySQL(t),
+		consumerGroup,
+		newMySQLSchemaAdapter(0),
+		sql.MySQLSkipLockedOffsetsAdapter{
+			Partitions: 4,
+			GenerateMessagesOffsetsTableName: func(topic string) string {
+				return fmt.Sprintf("`test_skip_locked_offsets_%s`", topic)
+			},
+		},
+	)
+}
+
+func createMySQLSkipLockedPubSub(t *testing.T) (message.Publisher, message.Subscriber) {
+	return createMySQLSkipLockedPubSubWithConsumerGroup(t, "test")
+}
+
 func createPostgreSQLPubSubWithConsumerGroup(t *testing.T, consumerGroup string) (message.Publisher, message.Subscriber) {
 	return newPubSub(
 		t,
@@ -195,6 +240,49 @@ func createPgxPostgreSQLPubSub(t *testing.T) (message.Publisher, message.Subscri
 	return createPgxPostgreSQLPubSubWithConsumerGroup(t, "test")
 }
 
+func createPostgreSQLQueuePubSub(t *testing.T) (message.Publisher, message.Subscriber) {
+	schemaAdapter := sql.PostgreSQLQueueSchema{
+		GenerateMessagesTableName: func(topic string) string {
+			return fmt.Sprintf(`"test_queue_%s"`, topic)
+		},
+	}
+
+	offsetsAdapter := sql.PostgreSQLQueueOffsetsAdapter{
+		GenerateMessagesTableName: func(topic string) string {
+			return fmt.Sprintf(`"test_queue_%s"`, topic)
+		},
+	}
+
+	return newPubSub(t, newPostgreSQL(t), "test", schemaAdapter, offsetsAdapter)
+}
+
+func createD1PubSubWithConsumerGroup(t *testing.T, consumerGroup string) (message.Publisher, message.Subscriber) {
+	return newPubSub(
+		t,
+		newSQLite(t),
+		consumerGroup,
+		newSQLiteSchemaAdapter(0),
+		sql.DefaultD1OffsetsAdapter{
+			GenerateMessagesOffsetsTableName: func(topic string) string {
+				return fmt.Sprintf(`"test_offsets_%s"`, topic)
+			},
+		},
+	)
+}
+
+func newSQLiteSchemaAdapter(batchSize int) sql.DefaultSQLiteSchema {
+	return sql.DefaultSQLiteSchema{
+		GenerateMessagesTableName: func(topic string) string {
+			return fmt.Sprintf(`"test_%s"`, topic)
+		},
+		SubscribeBatchSize: batchSize,
+	}
+}
+
+func createD1PubSub(t *testing.T) (message.Publisher, message.Subscriber) {
+	return createD1PubSubWithConsumerGroup(t, "test")
+}
+
 func TestMySQLPublishSubscribe(t *testing.T) {
 	t.Parallel()
 
@@ -213,6 +301,24 @@ func TestMySQLPublishSubscribe(t *testing.T) {
 	)
 }
 
+func TestMySQLSkipLockedPublishSubscribe(t *testing.T) {
+	t.Parallel()
+
+	features := tests.Features{
+		ConsumerGroups:      true,
+		ExactlyOnceDelivery: true,
+		GuaranteedOrder:     false,
+		Persistent:          true,
+	}
+
+	tests.TestPubSub(
+		t,
+		features,
+		createMySQLSkipLockedPubSub,
+		createMySQLSkipLockedPubSubWithConsumerGroup,
+	)
+}
+
 func TestPostgreSQLPublishSubscribe(t *testing.T) {
 	t.Parallel()
 
@@ -249,6 +355,44 @@ func TestPgxPostgreSQLPublishSubscribe(t *testing.T) {
 	)
 }
 
+func TestPostgreSQLQueuePublishSubscribe(t *testing.T) {
+	t.Parallel()
+
+	features := tests.Features{
+		ConsumerGroups:      false,
+		ExactlyOnceDelivery: true,
+		GuaranteedOrder:     false,
+		Persistent:          true,
+	}
+
+	tests.TestPubSub(
+		t,
+		features,
+		createPostgreSQLQueuePubSub,
+		nil,
+	)
+}
+
+// TestD1PublishSubscribe runs DefaultD1OffsetsAdapter against a local SQLite database,
+// consuming without transactions like it would with Cloudflare D1.
+func TestD1PublishSubscribe(t *testing.T) {
+	t.Parallel()
+
+	features := tests.Features{
+		ConsumerGroups:      true,
+		ExactlyOnceDelivery: false,
+		GuaranteedOrder:     true,
+		Persistent:          true,
+	}
+
+	tests.TestPubSub(
+		t,
+		features,
+		createD1PubSub,
+		createD1PubSubWithConsumerGroup,
+	)
+}
+
 func TestCtxValues(t *testing.T) {
 	pubSubConstructors := []struct {
 		Name        string
@@ -538,3 +682,995 @@ func TestConcurrentSubscribe_different_bulk_sizes(t *testing.T) {
 		})
 	}
 }
+
+type testTxProviderCtxKey struct{}
+
+func TestPublisher_TxProvider(t *testing.T) {
+	db := newSQLite(t)
+	beginner := sql.BeginnerFromStdSQL(db)
+	topicName := "topic_" + watermill.NewUUID()
+
+	var providedCtxValues []any
+	txProvider := sql.TxProviderFunc(func(ctx context.Context, opts *stdSQL.TxOptions) (sql.Tx, error) {
+		providedCtxValues = append(providedCtxValues, ctx.Value(testTxProviderCtxKey{}))
+		return beginner.BeginTx(ctx, opts)
+	})
+
+	publisher, err := sql.NewPublisher(
+		db,
+		sql.PublisherConfig{
+			SchemaAdapter:        newSQLiteSchemaAdapter(0),
+			AutoInitializeSchema: true,
+			TxProvider:           txProvider,
+		},
+		logger,
+	)
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	msg.SetContext(context.WithValue(context.Background(), testTxProviderCtxKey{}, "request"))
+
+	err = publisher.Publish(topicName, msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, []any{"request"}, providedCtxValues)
+
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM "test_` + topicName + `"`).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestPublisher_PublishMulti(t *testing.T) {
+	db := newSQLite(t)
+	ordersTopic := "orders_" + watermill.NewShortUUID()
+	paymentsTopic := "payments_" + watermill.NewShortUUID()
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter: newSQLiteSchemaAdapter(0),
+	}, logger)
+	require.NoError(t, err)
+
+	count := func(topic string) int {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM "test_` + topic + `"`).Scan(&count)
+		require.NoError(t, err)
+		return count
+	}
+
+	newMessages := func(n int) []*message.Message {
+		var msgs []*message.Message
+		for i := 0; i < n; i++ {
+			msgs = append(msgs, message.NewMessage(watermill.NewUUID(), nil))
+		}
+		return msgs
+	}
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:  newSQLiteSchemaAdapter(0),
+		OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+	}, logger)
+	require.NoError(t, err)
+	require.NoError(t, subscriber.SubscribeInitialize(ordersTopic))
+
+	// The payments table doesn't exist, so inserting its messages fails, and the orders are rolled back.
+	err = publisher.PublishMulti(context.Background(), map[string][]*message.Message{
+		ordersTopic:   newMessages(2),
+		paymentsTopic: newMessages(1),
+	})
+	require.Error(t, err)
+	assert.Equal(t, 0, count(ordersTopic))
+
+	require.NoError(t, subscriber.SubscribeInitialize(paymentsTopic))
+
+	err = publisher.PublishMulti(context.Background(), map[string][]*message.Message{
+		ordersTopic:   newMessages(2),
+		paymentsTopic: newMessages(1),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count(ordersTopic))
+	assert.Equal(t, 1, count(paymentsTopic))
+}
+
+func TestSubscriber_NackOnAckDeadline(t *testing.T) {
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewUUID()
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        newSQLiteSchemaAdapter(0),
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	var exceeded int32
+	ackDeadline := time.Millisecond * 200
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:     newSQLiteSchemaAdapter(0),
+		OffsetsAdapter:    sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema:  true,
+		AckDeadline:       &ackDeadline,
+		ResendInterval:    time.Millisecond * 10,
+		NackOnAckDeadline: true,
+		OnAckDeadlineExceeded: func(topic string, msg *message.Message) {
+			assert.Equal(t, topicName, topic)
+			atomic.AddInt32(&exceeded, 1)
+		},
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, publisher.Publish(topicName, msg))
+
+	select {
+	case received := <-messages:
+		assert.Equal(t, msg.UUID, received.UUID)
+		<-received.Context().Done()
+	case <-time.After(time.Second * 5):
+		t.Fatal("no message received")
+	}
+
+	select {
+	case received := <-messages:
+		assert.Equal(t, msg.UUID, received.UUID)
+		received.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("message not re-delivered")
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&exceeded))
+}
+
+func TestSubscriber_Transforms(t *testing.T) {
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewUUID()
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        newSQLiteSchemaAdapter(0),
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    newSQLiteSchemaAdapter(0),
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		Transforms: []sql.TransformFunc{
+			func(msg *message.Message) (*message.Message, error) {
+				msg.Payload = append(msg.Payload, "-first"...)
+				return msg, nil
+			},
+			func(msg *message.Message) (*message.Message, error) {
+				transformed := message.NewMessage(msg.UUID, append(msg.Payload, "-second"...))
+				transformed.Metadata = msg.Metadata
+				return transformed, nil
+			},
+		},
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	require.NoError(t, publisher.Publish(topicName, msg))
+
+	select {
+	case received := <-messages:
+		assert.Equal(t, msg.UUID, received.UUID)
+		assert.Equal(t, "payload-first-second", string(received.Payload))
+		received.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("no message received")
+	}
+}
+
+func TestCausalityPropagation(t *testing.T) {
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewUUID()
+
+	schemaAdapter := sql.DialectSchema{
+		Dialect:          sql.SQLiteDialect{},
+		CausalityColumns: true,
+	}
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        schemaAdapter,
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DialectOffsetsAdapter{Dialect: sql.SQLiteDialect{}},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	msgCtx := sql.ContextWithCorrelationID(context.Background(), "correlation")
+	msgCtx = sql.ContextWithCausationID(msgCtx, "causation")
+	msg.SetContext(msgCtx)
+	require.NoError(t, publisher.Publish(topicName, msg))
+
+	select {
+	case received := <-messages:
+		assert.Equal(t, "correlation", sql.CorrelationID(received))
+		assert.Equal(t, "causation", sql.CausationID(received))
+		assert.Equal(t, "correlation", sql.CorrelationIDFromContext(received.Context()))
+		assert.Equal(t, "causation", sql.CausationIDFromContext(received.Context()))
+		received.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("no message received")
+	}
+
+	var correlationID string
+	err = newSQLite(t).QueryRow(`SELECT correlation_id FROM "watermill_` + topicName + `"`).Scan(&correlationID)
+	require.NoError(t, err)
+	assert.Equal(t, "correlation", correlationID)
+}
+
+func TestSubscriber_UseSavepoints(t *testing.T) {
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewUUID()
+	handlerTable := `"handled_` + topicName + `"`
+
+	_, err := db.Exec(`CREATE TABLE ` + handlerTable + ` (uuid TEXT NOT NULL)`)
+	require.NoError(t, err)
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        newSQLiteSchemaAdapter(0),
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    newSQLiteSchemaAdapter(0),
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		UseSavepoints:    true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, publisher.Publish(topicName, msg))
+
+	handle := func(received *message.Message) int {
+		tx, ok := sql.TxFromContext(received.Context())
+		require.True(t, ok)
+
+		var handled int
+		require.NoError(t, tx.QueryRow(`SELECT COUNT(*) FROM `+handlerTable).Scan(&handled))
+
+		_, err := tx.Exec(`INSERT INTO `+handlerTable+` (uuid) VALUES (?)`, received.UUID)
+		require.NoError(t, err)
+
+		return handled
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case received := <-messages:
+			// The changes made before the nack are rolled back to the savepoint.
+			assert.Equal(t, 0, handle(received))
+			if i == 0 {
+				received.Nack()
+			} else {
+				received.Ack()
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("no message received")
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		var handled int
+		err := db.QueryRow(`SELECT COUNT(*) FROM ` + handlerTable).Scan(&handled)
+		return err == nil && handled == 1
+	}, time.Second*5, time.Millisecond*10)
+}
+
+func TestTxFromContext(t *testing.T) {
+	var _ sql.Beginner = (*stdSQL.DB)(nil)
+	var _ sql.ContextExecutor = (*stdSQL.Tx)(nil)
+	var _ sql.Executor = (*stdSQL.DB)(nil)
+
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewUUID()
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        newSQLiteSchemaAdapter(0),
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	// FaultyDB wraps the transactions, which are unwrapped by TxFromContext.
+	faultyDB, err := sql.NewFaultyDB(sql.BeginnerFromStdSQL(db), sql.FaultyDBConfig{})
+	require.NoError(t, err)
+
+	beginners := map[string]func(config sql.SubscriberConfig) (*sql.Subscriber, error){
+		"std": func(config sql.SubscriberConfig) (*sql.Subscriber, error) {
+			return sql.NewSubscriber(db, config, logger)
+		},
+		"faulty": func(config sql.SubscriberConfig) (*sql.Subscriber, error) {
+			return sql.NewSubscriberWithTxBeginner(faultyDB, config, logger)
+		},
+	}
+
+	for name, newSubscriber := range beginners {
+		t.Run(name, func(t *testing.T) {
+			subscriber, err := newSubscriber(sql.SubscriberConfig{
+				ConsumerGroup:    name,
+				SchemaAdapter:    newSQLiteSchemaAdapter(0),
+				OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+				InitializeSchema: true,
+			})
+			require.NoError(t, err)
+			defer subscriber.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			messages, err := subscriber.Subscribe(ctx, topicName)
+			require.NoError(t, err)
+
+			require.NoError(t, publisher.Publish(topicName, message.NewMessage(watermill.NewUUID(), nil)))
+
+			select {
+			case received := <-messages:
+				tx, ok := sql.TxFromContext(received.Context())
+				require.True(t, ok)
+
+				var one int
+				require.NoError(t, tx.QueryRow(`SELECT 1`).Scan(&one))
+				assert.Equal(t, 1, one)
+
+				received.Ack()
+			case <-time.After(time.Second * 5):
+				t.Fatal("no message received")
+			}
+		})
+	}
+
+	_, ok := sql.TxFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func TestSubscriber_MessagesOrderCreatedAt(t *testing.T) {
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewUUID()
+
+	schemaAdapter := sql.DefaultSQLiteSchema{MessagesOrder: sql.MessagesOrderCreatedAt}
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        schemaAdapter,
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	older := message.NewMessage(watermill.NewUUID(), nil)
+	newer := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, publisher.Publish(topicName, newer, older))
+
+	// Simulates a message published by a publisher with a delayed clock.
+	_, err = db.Exec(`UPDATE "watermill_`+topicName+`" SET "created_at" = '2000-01-01 00:00:00' WHERE "uuid" = ?`, older.UUID)
+	require.NoError(t, err)
+
+	_, err = sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:  schemaAdapter,
+		OffsetsAdapter: sql.DefaultD1OffsetsAdapter{},
+	}, logger)
+	require.Error(t, err, "reordering schema should not be allowed with non-transactional offsets adapter")
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	for _, expected := range []*message.Message{older, newer} {
+		select {
+		case received := <-messages:
+			assert.Equal(t, expected.UUID, received.UUID)
+			received.Ack()
+		case <-time.After(time.Second * 5):
+			t.Fatal("no message received")
+		}
+	}
+
+	select {
+	case received := <-messages:
+		t.Fatalf("message %s should not be re-delivered", received.UUID)
+	case <-time.After(time.Millisecond * 500):
+	}
+}
+
+func TestSubscriber_CloseCancelsQueries(t *testing.T) {
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewUUID()
+
+	config := sql.SubscriberConfig{
+		SchemaAdapter:  newSQLiteSchemaAdapter(0),
+		OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+	}
+
+	initializingSubscriber, err := sql.NewSubscriber(db, config, logger)
+	require.NoError(t, err)
+	require.NoError(t, initializingSubscriber.SubscribeInitialize(topicName))
+
+	// Every query is blocked until its context is canceled.
+	faultyDB, err := sql.NewFaultyDB(sql.BeginnerFromStdSQL(db), sql.FaultyDBConfig{LatencyProbability: 1, Latency: time.Hour})
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(faultyDB, config, logger)
+	require.NoError(t, err)
+
+	_, err = subscriber.Subscribe(context.Background(), topicName)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return faultyDB.Stats().Latencies > 0
+	}, time.Second*5, time.Millisecond*10)
+
+	closed := make(chan error)
+	go func() {
+		closed <- subscriber.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("subscriber not closed, in-flight query was not canceled")
+	}
+}
+
+func TestSubscriber_QueryTimeout(t *testing.T) {
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewUUID()
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(blockingQueriesDB{sql.BeginnerFromStdSQL(db)}, sql.SubscriberConfig{
+		SchemaAdapter:    newSQLiteSchemaAdapter(0),
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		QueryTimeout:     time.Millisecond * 50,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	events := subscriber.Events()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err = subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	for {
+		select {
+		case event := <-events:
+			if retry, ok := event.(sql.RetryScheduled); ok {
+				assert.ErrorIs(t, retry.Err, context.DeadlineExceeded)
+				return
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("query was not timed out")
+		}
+	}
+}
+
+func TestSubscriber_PollJitter(t *testing.T) {
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewUUID()
+
+	// Every query fails, so querying is retried after RetryInterval.
+	faultyDB, err := sql.NewFaultyDB(sql.BeginnerFromStdSQL(db), sql.FaultyDBConfig{DropConnectionProbability: 1})
+	require.NoError(t, err)
+
+	retryInterval := time.Millisecond * 100
+	subscriber, err := sql.NewSubscriberWithTxBeginner(faultyDB, sql.SubscriberConfig{
+		SchemaAdapter:      newSQLiteSchemaAdapter(0),
+		OffsetsAdapter:     sql.DefaultSQLiteOffsetsAdapter{},
+		RetryInterval:      retryInterval,
+		PollJitter:         0.5,
+		DesynchronizeStart: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	events := subscriber.Events()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err = subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	waits := map[time.Duration]struct{}{}
+	for retries := 0; retries < 5; {
+		select {
+		case event := <-events:
+			if retry, ok := event.(sql.RetryScheduled); ok {
+				assert.GreaterOrEqual(t, retry.Wait, retryInterval/2)
+				assert.LessOrEqual(t, retry.Wait, retryInterval*3/2)
+				waits[retry.Wait] = struct{}{}
+				retries++
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("querying was not retried")
+		}
+	}
+
+	assert.Greater(t, len(waits), 1, "waits should be randomized")
+}
+
+func TestSubscriber_PollJitter_invalid(t *testing.T) {
+	_, err := sql.NewSubscriber(newSQLite(t), sql.SubscriberConfig{
+		SchemaAdapter:  newSQLiteSchemaAdapter(0),
+		OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+		PollJitter:     1.5,
+	}, logger)
+	assert.Error(t, err)
+}
+
+func TestSubscriber_CatchUpBatchLimit(t *testing.T) {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "catch_up.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer db.Close()
+
+	topicName := "topic_" + watermill.NewShortUUID()
+
+	publisher := newCheckpointPublisher(t, sql.BeginnerFromStdSQL(db), sql.DefaultSQLiteSchema{})
+	var messages []*message.Message
+	for i := 0; i < 25; i++ {
+		messages = append(messages, message.NewMessage(watermill.NewUUID(), nil))
+	}
+	require.NoError(t, publisher.Publish(topicName, messages...))
+
+	progress := make(chan sql.CatchUpProgress, 10)
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		ConsumerGroup:     "catching_up",
+		SchemaAdapter:     sql.DefaultSQLiteSchema{SubscribeBatchSize: 100},
+		OffsetsAdapter:    sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema:  true,
+		PollInterval:      time.Millisecond * 10,
+		CatchUpBatchLimit: 10,
+		OnCatchUpProgress: func(p sql.CatchUpProgress) {
+			progress <- p
+		},
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	consumed, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	for range messages {
+		select {
+		case msg := <-consumed:
+			msg.Ack()
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for messages")
+		}
+	}
+
+	for _, lastOffset := range []int64{10, 20} {
+		select {
+		case p := <-progress:
+			assert.Equal(t, sql.CatchUpProgress{
+				Topic:         topicName,
+				ConsumerGroup: "catching_up",
+				Messages:      10,
+				LastOffset:    lastOffset,
+			}, p)
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for progress")
+		}
+	}
+	assert.Empty(t, progress, "the last chunk is not limited")
+}
+
+func TestSubscriber_CatchUpBatchLimit_reordered(t *testing.T) {
+	testReorderedBatchLimit(t, func(topic string, config *sql.SubscriberConfig) {
+		config.CatchUpBatchLimit = 1
+	})
+}
+
+// testReorderedBatchLimit checks if the messages of a batch reordered by the schema adapter and limited
+// by the config are all delivered, even if the limit cuts the batch before the messages with lower offsets.
+func testReorderedBatchLimit(t *testing.T, limitBatch func(topic string, config *sql.SubscriberConfig)) {
+	t.Helper()
+
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewUUID()
+
+	schemaAdapter := sql.DefaultSQLiteSchema{MessagesOrder: sql.MessagesOrderCreatedAt, SubscribeBatchSize: 3}
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        schemaAdapter,
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	var published []string
+	for i := 0; i < 3; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), nil)
+		require.NoError(t, publisher.Publish(topicName, msg))
+		published = append(published, msg.UUID)
+	}
+
+	// The last message is selected first, so limiting the batch to one message must not ack the others.
+	_, err = db.Exec(`UPDATE "watermill_`+topicName+`" SET "created_at" = '2000-01-01 00:00:00' WHERE "uuid" = ?`, published[2])
+	require.NoError(t, err)
+
+	config := sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+	}
+	limitBatch(topicName, &config)
+
+	subscriber, err := sql.NewSubscriber(db, config, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	var received []string
+	for range published {
+		select {
+		case msg := <-messages:
+			received = append(received, msg.UUID)
+			msg.Ack()
+		case <-time.After(time.Second * 5):
+			t.Fatalf("not all messages received, received: %v", received)
+		}
+	}
+	assert.ElementsMatch(t, published, received)
+
+	select {
+	case msg := <-messages:
+		t.Fatalf("message %s should not be re-delivered", msg.UUID)
+	case <-time.After(time.Millisecond * 500):
+	}
+}
+
+func TestSubscriber_Stats(t *testing.T) {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "stats.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer db.Close()
+
+	topicName := "topic_" + watermill.NewShortUUID()
+
+	publisher := newCheckpointPublisher(t, sql.BeginnerFromStdSQL(db), sql.DefaultSQLiteSchema{})
+	require.NoError(t, publisher.Publish(
+		topicName,
+		message.NewMessage(watermill.NewUUID(), nil),
+		message.NewMessage(watermill.NewUUID(), nil),
+		message.NewMessage(watermill.NewUUID(), nil),
+	))
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		ConsumerGroup:    "stats",
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+		ResendInterval:   time.Millisecond * 10,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	assert.Empty(t, subscriber.Stats())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	consumed, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		select {
+		case msg := <-consumed:
+			time.Sleep(time.Millisecond * 5)
+			if i == 0 {
+				msg.Nack()
+			} else {
+				msg.Ack()
+			}
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for messages")
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		return subscriber.Stats()[topicName].LastBatchSize == 0
+	}, time.Second*5, time.Millisecond*10, "the next poll should select no messages")
+
+	stats := subscriber.Stats()[topicName]
+	assert.Equal(t, topicName, stats.Topic)
+	assert.EqualValues(t, 4, stats.Received)
+	assert.EqualValues(t, 3, stats.Acked)
+	assert.EqualValues(t, 1, stats.Nacked)
+	assert.GreaterOrEqual(t, stats.AverageProcessingTime, time.Millisecond*5)
+	assert.Greater(t, stats.LastPollDuration, time.Duration(0))
+}
+
+func TestSubscriber_AutoBatch(t *testing.T) {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "auto_batch.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer db.Close()
+
+	topicName := "topic_" + watermill.NewShortUUID()
+
+	publisher := newCheckpointPublisher(t, sql.BeginnerFromStdSQL(db), sql.DefaultSQLiteSchema{})
+	publish := func(count int) {
+		for i := 0; i < count; i++ {
+			require.NoError(t, publisher.Publish(topicName, message.NewMessage(watermill.NewUUID(), nil)))
+		}
+	}
+	publish(8)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		ConsumerGroup:    "auto_batch",
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+		ResendInterval:   time.Millisecond * 10,
+		AutoBatch: &sql.AutoBatchConfig{
+			MaxBatchSize:  4,
+			TargetLatency: time.Second * 5,
+		},
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	consumed, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	consume := func(count int, nackFirst bool) {
+		for i := 0; i < count; i++ {
+			select {
+			case msg := <-consumed:
+				if nackFirst && i == 0 {
+					msg.Nack()
+				} else {
+					msg.Ack()
+				}
+			case <-ctx.Done():
+				t.Fatal("timeout waiting for messages")
+			}
+		}
+	}
+
+	// Batches of 1, 2 and 4 messages were processed fast, so the batch size grew to the maximum.
+	consume(8, false)
+	require.Eventually(t, func() bool {
+		return subscriber.Stats()[topicName].LastBatchSize == 0
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, 4, subscriber.Stats()[topicName].BatchSizeLimit)
+
+	// The nacked message was redelivered, so the batch size was halved.
+	publish(4)
+	consume(5, true)
+	require.Eventually(t, func() bool {
+		return subscriber.Stats()[topicName].LastBatchSize == 0
+	}, time.Second*5, time.Millisecond*10)
+	assert.Less(t, subscriber.Stats()[topicName].BatchSizeLimit, 4)
+}
+
+func TestSubscriber_AutoBatch_reordered(t *testing.T) {
+	testReorderedBatchLimit(t, func(topic string, config *sql.SubscriberConfig) {
+		config.AutoBatch = &sql.AutoBatchConfig{
+			MinBatchSize: 1,
+			MaxBatchSize: 1,
+		}
+	})
+}
+
+func TestSubscriberConfig_AutoBatchValidation(t *testing.T) {
+	_, err := sql.NewSubscriber(newSQLite(t), sql.SubscriberConfig{
+		SchemaAdapter:  sql.DefaultSQLiteSchema{},
+		OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+		AutoBatch: &sql.AutoBatchConfig{
+			MinBatchSize: 10,
+			MaxBatchSize: 5,
+		},
+	}, logger)
+	assert.ErrorContains(t, err, "max batch size must not be lower than min batch size")
+}
+
+func TestSubscriber_GroupCommit(t *testing.T) {
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewShortUUID()
+	schemaAdapter := newSQLiteSchemaAdapter(1)
+
+	publisher := newCheckpointPublisher(t, sql.BeginnerFromStdSQL(db), schemaAdapter)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, publisher.Publish(topicName, message.NewMessage(watermill.NewUUID(), nil)))
+	}
+
+	var begunTxs atomic.Int64
+	newSubscriber := func(groupCommitMessages int) *sql.Subscriber {
+		subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+			ConsumerGroup:    "group_commit",
+			SchemaAdapter:    schemaAdapter,
+			OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+			InitializeSchema: true,
+			PollInterval:     time.Hour,
+			TxProvider: sql.TxProviderFunc(func(ctx context.Context, opts *stdSQL.TxOptions) (sql.Tx, error) {
+				begunTxs.Add(1)
+				return sql.BeginnerFromStdSQL(db).BeginTx(ctx, opts)
+			}),
+			GroupCommitMessages: groupCommitMessages,
+		}, logger)
+		require.NoError(t, err)
+		return subscriber
+	}
+
+	subscriber := newSubscriber(5)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumed, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		select {
+		case msg := <-consumed:
+			msg.Ack()
+		case <-time.After(time.Second * 5):
+			t.Fatal("timeout waiting for messages")
+		}
+	}
+
+	// 10 batches of one message were committed in two transactions, and the third one selected no messages.
+	require.Eventually(t, func() bool {
+		return begunTxs.Load() == 3
+	}, time.Second*5, time.Millisecond*10)
+	require.NoError(t, subscriber.Close())
+
+	last := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, publisher.Publish(topicName, last))
+
+	nextSubscriber := newSubscriber(0)
+	defer nextSubscriber.Close()
+
+	consumed, err = nextSubscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	select {
+	case msg := <-consumed:
+		assert.Equal(t, last.UUID, msg.UUID, "acks of the group commits should be committed")
+		msg.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout waiting for the message")
+	}
+}
+
+// blockingQueriesDB blocks the queries executed in transactions until their context is done.
+type blockingQueriesDB struct {
+	sql.TxBeginner
+}
+
+func (db blockingQueriesDB) BeginTx(ctx context.Context, opts *stdSQL.TxOptions) (sql.Tx, error) {
+	tx, err := db.TxBeginner.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return blockingQueriesTx{tx}, nil
+}
+
+type blockingQueriesTx struct {
+	sql.Tx
+}
+
+func (tx blockingQueriesTx) QueryContext(ctx context.Context, query string, args ...any) (sql.Rows, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestEvents(t *testing.T) {
+	db := newSQLite(t)
+	topicName := "topic_" + watermill.NewUUID()
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        newSQLiteSchemaAdapter(0),
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    newSQLiteSchemaAdapter(0),
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	publisherEvents := publisher.Events()
+	subscriberEvents := subscriber.Events()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, publisher.Publish(topicName, msg))
+	require.NoError(t, publisher.Close())
+
+	select {
+	case received := <-messages:
+		received.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("no message received")
+	}
+
+	// Wait until the subscriber processes the ack, so no events are missing after closing it.
+	require.Eventually(t, func() bool {
+		return len(subscriberEvents) >= 3
+	}, time.Second*5, time.Millisecond*10)
+	require.NoError(t, subscriber.Close())
+
+	var events []sql.Event
+	for event := range publisherEvents {
+		events = append(events, event)
+	}
+	for event := range subscriberEvents {
+		events = append(events, event)
+	}
+
+	assert.Equal(t, []sql.Event{
+		sql.MessagesPublished{Topic: topicName, Messages: 1},
+		sql.BatchSelected{Topic: topicName, Messages: 1},
+		sql.MessageDelivered{Topic: topicName, UUID: msg.UUID},
+		sql.MessageAcked{Topic: topicName, UUID: msg.UUID},
+	}, events)
+}
@@ -0,0 +1,79 @@
+package sql
+
+import (
+	"reflect"
+	"sync"
+)
+
+// readYourWritesSubscribers are the subscribers with SubscriberConfig.ReadYourWrites, by their database handles.
+var readYourWritesSubscribers = struct {
+	subscribers map[any]map[*Subscriber]struct{}
+	lock        sync.Mutex
+}{
+	subscribers: map[any]map[*Subscriber]struct{}{},
+}
+
+// databaseHandleKey returns the handle wrapped by BeginnerFromStdSQL, BeginnerFromPgx or ExecutorFromStdSQL,
+// so publishers and subscribers using different wrappers of the same *sql.DB are matched.
+func databaseHandleKey(db any) (any, bool) {
+	switch handle := db.(type) {
+	case *stdSQLBeginner:
+		db = handle.db
+	case *pgxBeginner:
+		db = handle.db
+	case *stdSQLExecutor:
+		db = handle.executor
+	}
+
+	if db == nil || !reflect.TypeOf(db).Comparable() {
+		return nil, false
+	}
+
+	return db, true
+}
+
+func registerReadYourWritesSubscriber(s *Subscriber) {
+	key, ok := databaseHandleKey(s.db)
+	if !ok {
+		return
+	}
+
+	readYourWritesSubscribers.lock.Lock()
+	defer readYourWritesSubscribers.lock.Unlock()
+
+	if _, ok := readYourWritesSubscribers.subscribers[key]; !ok {
+		readYourWritesSubscribers.subscribers[key] = map[*Subscriber]struct{}{}
+	}
+	readYourWritesSubscribers.subscribers[key][s] = struct{}{}
+}
+
+func unregisterReadYourWritesSubscriber(s *Subscriber) {
+	key, ok := databaseHandleKey(s.db)
+	if !ok {
+		return
+	}
+
+	readYourWritesSubscribers.lock.Lock()
+	defer readYourWritesSubscribers.lock.Unlock()
+
+	delete(readYourWritesSubscribers.subscribers[key], s)
+	if len(readYourWritesSubscribers.subscribers[key]) == 0 {
+		delete(readYourWritesSubscribers.subscribers, key)
+	}
+}
+
+// wakeReadYourWritesSubscribers wakes the subscriptions of the topic (see Subscriber.Wake) of subscribers
+// with ReadYourWrites using the same database handle as the publisher.
+func wakeReadYourWritesSubscribers(db QueryExecutor, topic string) {
+	key, ok := databaseHandleKey(db)
+	if !ok {
+		return
+	}
+
+	readYourWritesSubscribers.lock.Lock()
+	defer readYourWritesSubscribers.lock.Unlock()
+
+	for subscriber := range readYourWritesSubscribers.subscribers[key] {
+		subscriber.Wake(topic)
+	}
+}
@@ -0,0 +1,50 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_ReadYourWrites(t *testing.T) {
+	sqlDB := newSQLite(t)
+	topicName := "read_your_writes_" + watermill.NewShortUUID()
+
+	subscriber, err := sql.NewSubscriber(sqlDB, sql.SubscriberConfig{
+		ConsumerGroup:    "read_your_writes",
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Hour,
+		ReadYourWrites:   true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumed, err := subscriber.Subscribe(ctx, topicName)
+	require.NoError(t, err)
+
+	// The publisher uses another wrapper of the same *sql.DB.
+	publisher := newCheckpointPublisher(t, sql.BeginnerFromStdSQL(sqlDB), sql.DefaultSQLiteSchema{})
+
+	for i := 0; i < 3; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), nil)
+		require.NoError(t, publisher.Publish(topicName, msg))
+
+		select {
+		case received := <-consumed:
+			require.Equal(t, msg.UUID, received.UUID)
+			received.Ack()
+		case <-time.After(time.Second * 5):
+			t.Fatal("message should be received without waiting for the poll interval")
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package sql
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// OrphanedOffsets describes a consumer group with a consumed offset ahead of its acked offset.
+type OrphanedOffsets struct {
+	ConsumerGroup  string
+	OffsetAcked    int64
+	OffsetConsumed int64
+}
+
+// ReconcileOrphanedOffsets detects consumer groups of the topic whose consumed offset advanced without an ack,
+// for example, because a subscriber crashed between consuming and acking a message.
+// The gaps are logged, and the consumed offsets are moved back to the acked offsets, so the messages
+// after the acked offset are re-delivered by the next query, instead of waiting for the claim to expire.
+//
+// ReconcileOrphanedOffsets may be executed periodically, while subscribers are running.
+// It returns the reconciled gaps.
+func ReconcileOrphanedOffsets(
+	ctx context.Context,
+	db QueryExecutor,
+	offsetsAdapter ReconcilingOffsetsAdapter,
+	topic string,
+	logger watermill.LoggerAdapter,
+) ([]OrphanedOffsets, error) {
+	if err := validateTopicName(topic); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	orphanedQuery := offsetsAdapter.OrphanedOffsetsQuery(topic)
+	rows, err := db.QueryContext(ctx, orphanedQuery.Query, orphanedQuery.Args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query orphaned offsets")
+	}
+
+	var orphaned []OrphanedOffsets
+	for rows.Next() {
+		var o OrphanedOffsets
+		if err := rows.Scan(&o.ConsumerGroup, &o.OffsetAcked, &o.OffsetConsumed); err != nil {
+			_ = rows.Close()
+			return nil, errors.Wrap(err, "could not scan orphaned offsets")
+		}
+		orphaned = append(orphaned, o)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, errors.Wrap(err, "could not query orphaned offsets")
+	}
+	if err := rows.Close(); err != nil {
+		return nil, errors.Wrap(err, "could not close rows")
+	}
+
+	var reconciled []OrphanedOffsets
+	for _, o := range orphaned {
+		logger.Info("Re-delivering messages consumed without ack", watermill.LogFields{
+			"topic":           topic,
+			"consumer_group":  o.ConsumerGroup,
+			"offset_acked":    o.OffsetAcked,
+			"offset_consumed": o.OffsetConsumed,
+		})
+
+		resetQuery := offsetsAdapter.ResetConsumedOffsetQuery(topic, o.ConsumerGroup, o.OffsetConsumed)
+		result, err := db.ExecContext(ctx, resetQuery.Query, resetQuery.Args...)
+		if err != nil {
+			return reconciled, errors.Wrapf(err, "could not reset consumed offset of consumer group %s", o.ConsumerGroup)
+		}
+
+		// The consumer group could ack or consume another message in the meantime.
+		if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+			continue
+		}
+
+		reconciled = append(reconciled, o)
+	}
+
+	return reconciled, nil
+}
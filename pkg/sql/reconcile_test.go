@@ -0,0 +1,38 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileOrphanedOffsets(t *testing.T) {
+	db := newSQLite(t)
+	topic := "topic_" + watermill.NewShortUUID()
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+
+	for _, q := range offsetsAdapter.SchemaInitializingQueries(topic) {
+		_, err := db.Exec(q.Query, q.Args...)
+		require.NoError(t, err)
+	}
+
+	table := offsetsAdapter.MessagesOffsetsTable(topic)
+	_, err := db.Exec(`INSERT INTO `+table+` (consumer_group, offset_acked, offset_consumed) VALUES (?, 3, 5), (?, 7, 7)`, "orphaned", "acked")
+	require.NoError(t, err)
+
+	reconciled, err := sql.ReconcileOrphanedOffsets(context.Background(), sql.BeginnerFromStdSQL(db), offsetsAdapter, topic, logger)
+	require.NoError(t, err)
+
+	assert.Equal(t, []sql.OrphanedOffsets{
+		{ConsumerGroup: "orphaned", OffsetAcked: 3, OffsetConsumed: 5},
+	}, reconciled)
+
+	var offsetConsumed int64
+	err = db.QueryRow(`SELECT offset_consumed FROM `+table+` WHERE consumer_group = ?`, "orphaned").Scan(&offsetConsumed)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), offsetConsumed)
+}
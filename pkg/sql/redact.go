@@ -0,0 +1,45 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// RedactedMetadataKey is set to "true" in the metadata of messages redacted by SQLiteTopicAdmin.Redact.
+const RedactedMetadataKey = "redacted"
+
+// Redact removes the payload of the message in place, for example, when sensitive content was published
+// by mistake. The message is kept as a tombstone with its offset, UUID and metadata, marked with
+// RedactedMetadataKey, so offsets and the order of messages don't change, and consumer groups
+// which didn't consume the message yet receive it with an empty payload.
+//
+// The encryption key ID is removed from the metadata, so Encryptor.Decrypt doesn't fail for redacted messages.
+// Other metadata is kept, so Erase should be used to remove all messages of a subject.
+func (a SQLiteTopicAdmin) Redact(ctx context.Context, topic string, uuid string) error {
+	if err := validateTopicName(topic); err != nil {
+		return err
+	}
+
+	res, err := a.DB.ExecContext(
+		ctx,
+		`UPDATE `+a.SchemaAdapter.MessagesTable(topic)+`
+		SET "payload" = NULL, "metadata" = json_set(json_remove(COALESCE("metadata", '{}'), ?), ?, 'true')
+		WHERE "uuid" = ?`,
+		fmt.Sprintf(`$."%s"`, EncryptionKeyIDMetadataKey), fmt.Sprintf(`$."%s"`, RedactedMetadataKey), uuid,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not redact message")
+	}
+
+	redacted, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "could not get number of redacted messages")
+	}
+	if redacted == 0 {
+		return ErrMessageNotFound
+	}
+
+	return nil
+}
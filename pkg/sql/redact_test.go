@@ -0,0 +1,51 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteTopicAdmin_Redact(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "redact.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topic := "redact_" + watermill.NewShortUUID()
+
+	sensitive := message.NewMessage(watermill.NewUUID(), []byte(`{"card":"4111111111111111"}`))
+	sensitive.Metadata.Set(sql.CorrelationIDMetadataKey, "order-1")
+	sensitive.Metadata.Set(sql.EncryptionKeyIDMetadataKey, "key-1")
+	other := message.NewMessage(watermill.NewUUID(), []byte(`{"card":"none"}`))
+
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+	require.NoError(t, publisher.Publish(topic, sensitive, other))
+
+	admin := sql.SQLiteTopicAdmin{DB: db}
+	require.NoError(t, admin.Redact(ctx, topic, sensitive.UUID))
+	assert.ErrorIs(t, admin.Redact(ctx, topic, "missing"), sql.ErrMessageNotFound)
+
+	peeked, err := admin.PeekMessages(ctx, topic, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, peeked, 2)
+
+	assert.EqualValues(t, 1, peeked[0].Offset)
+	assert.Equal(t, sensitive.UUID, peeked[0].Msg.UUID)
+	assert.Empty(t, peeked[0].Msg.Payload)
+	assert.Equal(t, "true", peeked[0].Msg.Metadata.Get(sql.RedactedMetadataKey))
+	assert.Equal(t, "order-1", peeked[0].Msg.Metadata.Get(sql.CorrelationIDMetadataKey))
+	assert.Empty(t, peeked[0].Msg.Metadata.Get(sql.EncryptionKeyIDMetadataKey))
+
+	assert.EqualValues(t, 2, peeked[1].Offset)
+	assert.Equal(t, other.Payload, peeked[1].Msg.Payload)
+	assert.Empty(t, peeked[1].Msg.Metadata.Get(sql.RedactedMetadataKey))
+}
@@ -0,0 +1,137 @@
+package sql
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RqliteConsistencyLevel is the read consistency level of rqlite queries.
+// See https://rqlite.io/docs/api/read-consistency/.
+type RqliteConsistencyLevel string
+
+const (
+	// RqliteConsistencyNone reads from the local node without checking leadership.
+	// Reads may be arbitrarily stale.
+	RqliteConsistencyNone RqliteConsistencyLevel = "none"
+
+	// RqliteConsistencyWeak reads from the node which believes it's the leader.
+	// Reads may be stale for a short while after a leadership change.
+	RqliteConsistencyWeak RqliteConsistencyLevel = "weak"
+
+	// RqliteConsistencyLinearizable reads from the leader after confirming its leadership with a quorum.
+	RqliteConsistencyLinearizable RqliteConsistencyLevel = "linearizable"
+
+	// RqliteConsistencyStrong sends reads through the Raft log.
+	RqliteConsistencyStrong RqliteConsistencyLevel = "strong"
+)
+
+// RqliteProfile provides adapters configured for rqlite, a distributed database replicating SQLite with Raft.
+//
+// rqlite doesn't support interactive transactions, so the subscriber consumes without a transaction,
+// using DefaultD1OffsetsAdapter. Claims and acks are conditional writes, which are applied through the Raft log,
+// so they are never based on stale data, regardless of the consistency level of reads.
+// Stale reads only delay delivery of new messages, or cause claims which affect no rows and are retried.
+//
+// It provides at-least-once delivery, not exactly-once: a message claimed by a subscriber can be claimed
+// by another subscriber of the consumer group after ClaimTimeout, even if the first one is still handling it,
+// and it's re-delivered if the subscriber crashes after handling it, but before acking it.
+// If your handlers need exactly-once processing, use dqlite (see DqliteProfile) which supports transactions.
+type RqliteProfile struct {
+	// ConsistencyLevel is the read consistency level which should be used by the connection.
+	// Weaker levels lower the load on the leader, but increase the number of retried claims.
+	//
+	// Default value is RqliteConsistencyWeak.
+	ConsistencyLevel RqliteConsistencyLevel
+
+	// ClaimTimeout is passed to DefaultD1OffsetsAdapter.
+	ClaimTimeout time.Duration
+
+	// SubscribeBatchSize is passed to DefaultSQLiteSchema.
+	SubscribeBatchSize int
+
+	// GenerateMessagesTableName may be used to override how the messages table name is generated.
+	GenerateMessagesTableName func(topic string) string
+
+	// GenerateMessagesOffsetsTableName may be used to override how the messages/offsets table name is generated.
+	GenerateMessagesOffsetsTableName func(topic string) string
+}
+
+func (p RqliteProfile) consistencyLevel() RqliteConsistencyLevel {
+	if p.ConsistencyLevel == "" {
+		return RqliteConsistencyWeak
+	}
+
+	return p.ConsistencyLevel
+}
+
+// Validate checks if the profile is configured correctly.
+func (p RqliteProfile) Validate() error {
+	switch p.consistencyLevel() {
+	case RqliteConsistencyNone, RqliteConsistencyWeak, RqliteConsistencyLinearizable, RqliteConsistencyStrong:
+	default:
+		return errors.Errorf("unknown rqlite consistency level: %s", p.ConsistencyLevel)
+	}
+
+	if p.ClaimTimeout < 0 {
+		return errors.New("claim timeout must be non-negative")
+	}
+
+	return nil
+}
+
+// ConnectionParams returns the query parameters which should be added to the database/sql DSN
+// of the rqlite driver (for example, github.com/rqlite/gorqlite/stdlib).
+func (p RqliteProfile) ConnectionParams() url.Values {
+	return url.Values{
+		"level": []string{string(p.consistencyLevel())},
+	}
+}
+
+// SchemaAdapter returns the schema adapter for rqlite.
+func (p RqliteProfile) SchemaAdapter() DefaultSQLiteSchema {
+	return DefaultSQLiteSchema{
+		GenerateMessagesTableName: p.GenerateMessagesTableName,
+		SubscribeBatchSize:        p.SubscribeBatchSize,
+	}
+}
+
+// OffsetsAdapter returns the offsets adapter for rqlite.
+func (p RqliteProfile) OffsetsAdapter() DefaultD1OffsetsAdapter {
+	return DefaultD1OffsetsAdapter{
+		GenerateMessagesOffsetsTableName: p.GenerateMessagesOffsetsTableName,
+		ClaimTimeout:                     p.ClaimTimeout,
+	}
+}
+
+// DqliteProfile provides adapters configured for dqlite, a distributed database replicating SQLite with Raft.
+//
+// dqlite supports interactive transactions executed on the leader, with the same serializable semantics as SQLite,
+// so it provides exactly-once delivery with DefaultSQLiteOffsetsAdapter.
+// When the leadership changes, transactions in progress fail, are rolled back, and the messages are re-delivered.
+type DqliteProfile struct {
+	// SubscribeBatchSize is passed to DefaultSQLiteSchema.
+	SubscribeBatchSize int
+
+	// GenerateMessagesTableName may be used to override how the messages table name is generated.
+	GenerateMessagesTableName func(topic string) string
+
+	// GenerateMessagesOffsetsTableName may be used to override how the messages/offsets table name is generated.
+	GenerateMessagesOffsetsTableName func(topic string) string
+}
+
+// SchemaAdapter returns the schema adapter for dqlite.
+func (p DqliteProfile) SchemaAdapter() DefaultSQLiteSchema {
+	return DefaultSQLiteSchema{
+		GenerateMessagesTableName: p.GenerateMessagesTableName,
+		SubscribeBatchSize:        p.SubscribeBatchSize,
+	}
+}
+
+// OffsetsAdapter returns the offsets adapter for dqlite.
+func (p DqliteProfile) OffsetsAdapter() DefaultSQLiteOffsetsAdapter {
+	return DefaultSQLiteOffsetsAdapter{
+		GenerateMessagesOffsetsTableName: p.GenerateMessagesOffsetsTableName,
+	}
+}
@@ -0,0 +1,145 @@
+package sql
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// RetainingSchemaAdapter is an optional interface of SchemaAdapter, implemented by adapters
+// which can delete consumed messages. It's used by DeleteAckedMessages.
+type RetainingSchemaAdapter interface {
+	SchemaAdapter
+
+	// DeleteMessagesQuery returns the SQL query and arguments which delete the messages of the topic
+	// with offsets lower than or equal to upToOffset.
+	DeleteMessagesQuery(topic string, upToOffset int64) Query
+}
+
+// AckedRetentionPolicy defines which messages are deleted by DeleteAckedMessages.
+type AckedRetentionPolicy struct {
+	// ConsumerGroups are the consumer groups registered for the topic. Messages are deleted only after all of them
+	// acked them, so registered consumer groups which didn't subscribe yet prevent deleting any messages.
+	//
+	// If empty, all consumer groups stored by the offsets adapter are used. Consumer groups which were removed
+	// (for example, by RemoveIdleConsumerGroups) don't hold back the deletion then.
+	ConsumerGroups []string
+
+	// IgnoredConsumerGroups are not waited for, so they may miss the deleted messages.
+	// It may be used for consumer groups which don't need all messages, like debugging tools.
+	IgnoredConsumerGroups []string
+}
+
+func (p AckedRetentionPolicy) isIgnored(consumerGroup string) bool {
+	for _, ignored := range p.IgnoredConsumerGroups {
+		if ignored == consumerGroup {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeleteAckedMessages deletes the messages of the topic which were acked by all consumer groups of the policy,
+// so cleanup never deletes messages which a lagging consumer group still needs.
+// If there are no consumer groups to wait for, no messages are deleted.
+//
+// DefaultPostgreSQLSchema is not supported, as messages with lower offsets may be committed
+// after the acked ones. DeleteAckedMessages may be executed periodically, while subscribers are running.
+// In SQLite, messages pinned with SQLiteTopicAdmin.Pin are kept, and they are not counted as deleted.
+// Pins are ignored by the other schema adapters. It returns the number of deleted messages.
+func DeleteAckedMessages(
+	ctx context.Context,
+	db QueryExecutor,
+	schemaAdapter RetainingSchemaAdapter,
+	offsetsAdapter CheckpointingOffsetsAdapter,
+	topic string,
+	policy AckedRetentionPolicy,
+	logger watermill.LoggerAdapter,
+) (int64, error) {
+	if err := validateTopic(schemaAdapter, topic); err != nil {
+		return 0, err
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	checkpoint, err := ExportCheckpoint(ctx, db, nil, offsetsAdapter, topic)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not query consumer group offsets")
+	}
+
+	offsets := make(map[string]int64, len(checkpoint.ConsumerGroups))
+	for _, group := range checkpoint.ConsumerGroups {
+		offsets[group.ConsumerGroup] = group.OffsetAcked
+	}
+
+	consumerGroups := policy.ConsumerGroups
+	if len(consumerGroups) == 0 {
+		for _, group := range checkpoint.ConsumerGroups {
+			consumerGroups = append(consumerGroups, group.ConsumerGroup)
+		}
+	}
+
+	var upToOffset int64
+	var slowestConsumerGroup string
+	found := false
+	for _, consumerGroup := range consumerGroups {
+		if policy.isIgnored(consumerGroup) {
+			continue
+		}
+
+		offset := offsets[consumerGroup]
+		if !found || offset < upToOffset {
+			upToOffset = offset
+			slowestConsumerGroup = consumerGroup
+			found = true
+		}
+	}
+	if upToOffset <= 0 {
+		return 0, nil
+	}
+
+	deleteQuery := schemaAdapter.DeleteMessagesQuery(topic, upToOffset)
+	result, err := db.ExecContext(ctx, deleteQuery.Query, deleteQuery.Args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not delete acked messages")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get number of deleted messages")
+	}
+
+	logger.Debug("Deleted acked messages", watermill.LogFields{
+		"topic":                  topic,
+		"up_to_offset":           upToOffset,
+		"slowest_consumer_group": slowestConsumerGroup,
+		"deleted":                deleted,
+	})
+
+	return deleted, nil
+}
+
+func (s DefaultSQLiteSchema) DeleteMessagesQuery(topic string, upToOffset int64) Query {
+	return deleteMessagesQuery(s.dialect(), s.MessagesTable(topic), "offset", upToOffset)
+}
+
+// DeleteMessagesQuery requires MySQL 8.0 or later, as earlier versions may reuse the offsets of deleted messages
+// after being restarted.
+func (s DefaultMySQLSchema) DeleteMessagesQuery(topic string, upToOffset int64) Query {
+	return deleteMessagesQuery(s.dialect(), s.MessagesTable(topic), "offset", upToOffset)
+}
+
+func (s DialectSchema) DeleteMessagesQuery(topic string, upToOffset int64) Query {
+	return deleteMessagesQuery(s.Dialect, s.MessagesTable(topic), s.ColumnNames.withDefaults().Offset, upToOffset)
+}
+
+func deleteMessagesQuery(d Dialect, messagesTable string, offsetColumn string, upToOffset int64) Query {
+	return Query{
+		Query: `DELETE FROM ` + messagesTable + ` WHERE ` + d.QuoteIdentifier(offsetColumn) + ` <= ` + d.Placeholder(1),
+		Args:  []any{upToOffset},
+	}
+}
@@ -0,0 +1,114 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteAckedMessages(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "retention.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	schemaAdapter := sql.DefaultSQLiteSchema{}
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+	topic := "retention_" + watermill.NewShortUUID()
+
+	publisher := newCheckpointPublisher(t, db, schemaAdapter)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+	}
+
+	require.NoError(t, sql.ImportCheckpoint(ctx, db, nil, offsetsAdapter, topic, sql.Checkpoint{
+		ConsumerGroups: []sql.ConsumerGroupCheckpoint{
+			{ConsumerGroup: "fast", OffsetAcked: 4},
+			{ConsumerGroup: "slow", OffsetAcked: 2},
+			{ConsumerGroup: "debug", OffsetAcked: 0},
+		},
+	}))
+
+	deleteAcked := func(policy sql.AckedRetentionPolicy) int64 {
+		deleted, err := sql.DeleteAckedMessages(ctx, db, schemaAdapter, offsetsAdapter, topic, policy, logger)
+		require.NoError(t, err)
+		return deleted
+	}
+
+	assert.EqualValues(t, 0, deleteAcked(sql.AckedRetentionPolicy{}), "debug consumer group didn't ack any messages")
+
+	assert.EqualValues(t, 0, deleteAcked(sql.AckedRetentionPolicy{
+		ConsumerGroups: []string{"fast", "slow", "not_subscribed"},
+	}), "registered consumer group didn't subscribe yet")
+
+	assert.EqualValues(t, 2, deleteAcked(sql.AckedRetentionPolicy{
+		IgnoredConsumerGroups: []string{"debug"},
+	}))
+
+	assert.EqualValues(t, 2, deleteAcked(sql.AckedRetentionPolicy{
+		ConsumerGroups: []string{"fast"},
+	}))
+
+	var remaining int
+	require.NoError(t, sqlDB.QueryRow(`SELECT COUNT(*) FROM `+schemaAdapter.MessagesTable(topic)).Scan(&remaining))
+	assert.Equal(t, 1, remaining)
+}
+
+func TestDeleteAckedMessages_pinnedMessages(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "retention_pins.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	schemaAdapter := sql.DefaultSQLiteSchema{}
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+	topic := "retention_" + watermill.NewShortUUID()
+
+	var msgs []*message.Message
+	for i := 0; i < 3; i++ {
+		msgs = append(msgs, message.NewMessage(watermill.NewUUID(), nil))
+	}
+	require.NoError(t, newCheckpointPublisher(t, db, schemaAdapter).Publish(topic, msgs...))
+	require.NoError(t, sql.ImportCheckpoint(ctx, db, nil, offsetsAdapter, topic, sql.Checkpoint{
+		ConsumerGroups: []sql.ConsumerGroupCheckpoint{{ConsumerGroup: "workers", OffsetAcked: 3}},
+	}))
+
+	admin := sql.SQLiteTopicAdmin{DB: db}
+	require.NoError(t, admin.Pin(ctx, topic, msgs[1].UUID))
+
+	pinsTriggers := func() int {
+		var triggers int
+		require.NoError(t, sqlDB.QueryRow(
+			`SELECT COUNT(*) FROM "sqlite_master" WHERE "type" = 'trigger' AND "tbl_name" = ?`,
+			"watermill_"+topic,
+		).Scan(&triggers))
+		return triggers
+	}
+	assert.Equal(t, 1, pinsTriggers())
+
+	deleted, err := sql.DeleteAckedMessages(ctx, db, schemaAdapter, offsetsAdapter, topic, sql.AckedRetentionPolicy{}, logger)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, deleted, "the pinned message should not be counted as deleted")
+
+	peeked, err := admin.PeekMessages(ctx, topic, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, peeked, 1)
+	assert.Equal(t, msgs[1].UUID, peeked[0].Msg.UUID)
+	assert.True(t, peeked[0].Pinned)
+
+	require.NoError(t, admin.Unpin(ctx, topic, msgs[1].UUID))
+	assert.Equal(t, 0, pinsTriggers(), "the trigger should be dropped with the last pin of the topic")
+
+	deleted, err = sql.DeleteAckedMessages(ctx, db, schemaAdapter, offsetsAdapter, topic, sql.AckedRetentionPolicy{}, logger)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+}
@@ -0,0 +1,206 @@
+package sql
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryAttempt describes a failed attempt of an operation, which may be retried.
+type RetryAttempt struct {
+	// Retry is the number of the next retry, starting with 1.
+	Retry int
+
+	// Err is the error of the failed attempt.
+	Err error
+
+	// LastWait is the wait before the previous retry, or 0 before the first retry.
+	LastWait time.Duration
+}
+
+// RetryPolicy decides how long to wait before retrying a failed operation, and when to stop retrying.
+// The same policy may be used by all subsystems retrying operations, so retries are configured in one place:
+// RunInTxOptions.RetryPolicy (transactions failing with busy databases and conflicts),
+// SubscriberConfig.RedeliveryPolicy (nacked messages) and BridgeConfig.RetryPolicy (messages which couldn't be persisted).
+//
+// Policies are used concurrently, so stateful policies (like RetryBudget) must be safe for concurrent use.
+type RetryPolicy interface {
+	// NextRetry returns the wait before the retry, and false if the operation shouldn't be retried anymore.
+	// Operations which can't be abandoned (like delivering nacked messages) are retried after the wait anyway,
+	// so the wait should be returned even when it returns false.
+	NextRetry(attempt RetryAttempt) (wait time.Duration, retry bool)
+}
+
+// ConstantRetryPolicy waits Interval before every retry.
+type ConstantRetryPolicy struct {
+	Interval time.Duration
+
+	// MaxRetries is the maximum number of retries. Negative value disables retries.
+	//
+	// Default value is 0, which doesn't limit the retries.
+	MaxRetries int
+}
+
+func (p ConstantRetryPolicy) NextRetry(attempt RetryAttempt) (time.Duration, bool) {
+	return p.Interval, retriesLeft(p.MaxRetries, attempt)
+}
+
+// ExponentialRetryPolicy multiplies the wait with every retry, from InitialInterval up to MaxInterval.
+type ExponentialRetryPolicy struct {
+	InitialInterval time.Duration
+
+	// MaxInterval is the maximum wait.
+	//
+	// Default value is 1 minute.
+	MaxInterval time.Duration
+
+	// Multiplier is the factor of the wait with every retry.
+	//
+	// Default value is 2.
+	Multiplier float64
+
+	// MaxRetries is the maximum number of retries. Negative value disables retries.
+	//
+	// Default value is 0, which doesn't limit the retries.
+	MaxRetries int
+}
+
+func (p ExponentialRetryPolicy) NextRetry(attempt RetryAttempt) (time.Duration, bool) {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	wait := float64(p.InitialInterval)
+	for i := 1; i < attempt.Retry; i++ {
+		wait *= multiplier
+		if wait >= float64(maxRetryInterval(p.MaxInterval)) {
+			break
+		}
+	}
+
+	next := time.Duration(math.MaxInt64)
+	if wait < math.MaxInt64 {
+		next = time.Duration(wait)
+	}
+
+	return capRetryWait(next, p.MaxInterval), retriesLeft(p.MaxRetries, attempt)
+}
+
+// DecorrelatedJitterRetryPolicy waits a random duration between BaseInterval and three times the previous wait,
+// up to MaxInterval, so many clients failing at the same time (like subscribers of a busy database) don't retry
+// in lockstep. It's the "decorrelated jitter" backoff described by the AWS Architecture Blog.
+type DecorrelatedJitterRetryPolicy struct {
+	BaseInterval time.Duration
+
+	// MaxInterval is the maximum wait.
+	//
+	// Default value is 1 minute.
+	MaxInterval time.Duration
+
+	// MaxRetries is the maximum number of retries. Negative value disables retries.
+	//
+	// Default value is 0, which doesn't limit the retries.
+	MaxRetries int
+}
+
+func (p DecorrelatedJitterRetryPolicy) NextRetry(attempt RetryAttempt) (time.Duration, bool) {
+	wait := p.BaseInterval
+	if upper := attempt.LastWait * 3; upper > p.BaseInterval {
+		wait += time.Duration(rand.Int63n(int64(upper - p.BaseInterval)))
+	}
+
+	return capRetryWait(wait, p.MaxInterval), retriesLeft(p.MaxRetries, attempt)
+}
+
+// RetryBudget limits the retries of all operations using it to a number of retries per interval, on top of
+// the waits of another policy, so a failing database isn't overloaded with the retries of many concurrent operations (retry storms).
+// Retries over the budget are rejected, but their waits are still returned by NextRetry.
+type RetryBudget struct {
+	policy     RetryPolicy
+	maxRetries int
+	interval   time.Duration
+
+	windowStart time.Time
+	retries     int
+	lock        sync.Mutex
+}
+
+// NewRetryBudget creates a RetryBudget allowing maxRetries retries per interval, waiting as the policy.
+func NewRetryBudget(policy RetryPolicy, maxRetries int, interval time.Duration) *RetryBudget {
+	return &RetryBudget{
+		policy:     policy,
+		maxRetries: maxRetries,
+		interval:   interval,
+	}
+}
+
+func (b *RetryBudget) NextRetry(attempt RetryAttempt) (time.Duration, bool) {
+	wait, retry := b.policy.NextRetry(attempt)
+	if !retry {
+		return wait, false
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(b.windowStart) >= b.interval {
+		b.windowStart = now
+		b.retries = 0
+	}
+	if b.retries >= b.maxRetries {
+		return wait, false
+	}
+	b.retries++
+
+	return wait, true
+}
+
+func retriesLeft(maxRetries int, attempt RetryAttempt) bool {
+	return maxRetries == 0 || attempt.Retry <= maxRetries
+}
+
+// defaultMaxRetryInterval is the maximum wait of the policies with zero MaxInterval, so an unlimited wait
+// doesn't block Subscriber.Close or RunInTx for hours.
+const defaultMaxRetryInterval = time.Minute
+
+func maxRetryInterval(maxInterval time.Duration) time.Duration {
+	if maxInterval == 0 {
+		return defaultMaxRetryInterval
+	}
+
+	return maxInterval
+}
+
+func capRetryWait(wait time.Duration, maxInterval time.Duration) time.Duration {
+	if maxInterval = maxRetryInterval(maxInterval); wait > maxInterval {
+		return maxInterval
+	}
+
+	return wait
+}
+
+// retrier tracks the retries of an operation retried with a RetryPolicy.
+type retrier struct {
+	policy   RetryPolicy
+	retries  int
+	lastWait time.Duration
+}
+
+// next returns the wait before retrying the operation after err, and false if the policy stopped retrying it.
+func (r *retrier) next(err error) (time.Duration, bool) {
+	r.retries++
+
+	wait, retry := r.policy.NextRetry(RetryAttempt{Retry: r.retries, Err: err, LastWait: r.lastWait})
+	r.lastWait = wait
+
+	return wait, retry
+}
+
+// reset starts counting the retries again, after the operation succeeded.
+func (r *retrier) reset() {
+	r.retries = 0
+	r.lastWait = 0
+}
@@ -0,0 +1,205 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicies(t *testing.T) {
+	err := errors.New("failed")
+
+	constant := sql.ConstantRetryPolicy{Interval: time.Second, MaxRetries: 2}
+	for retry, expected := range []bool{true, true, false} {
+		wait, ok := constant.NextRetry(sql.RetryAttempt{Retry: retry + 1, Err: err})
+		assert.Equal(t, time.Second, wait)
+		assert.Equal(t, expected, ok, retry+1)
+	}
+	_, ok := sql.ConstantRetryPolicy{MaxRetries: -1}.NextRetry(sql.RetryAttempt{Retry: 1})
+	assert.False(t, ok, "negative max retries should disable retries")
+
+	exponential := sql.ExponentialRetryPolicy{InitialInterval: time.Millisecond * 10, MaxInterval: time.Millisecond * 50}
+	var waits []time.Duration
+	for retry := 1; retry <= 5; retry++ {
+		wait, ok := exponential.NextRetry(sql.RetryAttempt{Retry: retry})
+		require.True(t, ok)
+		waits = append(waits, wait)
+	}
+	assert.Equal(t, []time.Duration{10, 20, 40, 50, 50}, divideDurations(waits, time.Millisecond))
+
+	wait, _ := sql.ExponentialRetryPolicy{InitialInterval: time.Second}.NextRetry(sql.RetryAttempt{Retry: 1000})
+	assert.Equal(t, time.Minute, wait, "waits without MaxInterval should be capped by default")
+
+	jitter := sql.DecorrelatedJitterRetryPolicy{BaseInterval: time.Millisecond * 10, MaxInterval: time.Millisecond * 100}
+	lastWait := time.Duration(0)
+	for retry := 1; retry <= 20; retry++ {
+		wait, ok := jitter.NextRetry(sql.RetryAttempt{Retry: retry, LastWait: lastWait})
+		require.True(t, ok)
+		assert.GreaterOrEqual(t, wait, time.Millisecond*10)
+		assert.LessOrEqual(t, wait, time.Millisecond*100)
+		if lastWait*3 > time.Millisecond*10 {
+			assert.Less(t, wait, lastWait*3+1)
+		}
+		lastWait = wait
+	}
+
+	budget := sql.NewRetryBudget(sql.ConstantRetryPolicy{Interval: time.Millisecond}, 2, time.Hour)
+	var allowed int
+	for i := 0; i < 5; i++ {
+		wait, ok := budget.NextRetry(sql.RetryAttempt{Retry: 1, Err: err})
+		assert.Equal(t, time.Millisecond, wait, "the wait should be returned over the budget")
+		if ok {
+			allowed++
+		}
+	}
+	assert.Equal(t, 2, allowed)
+}
+
+func divideDurations(durations []time.Duration, unit time.Duration) []time.Duration {
+	divided := make([]time.Duration, len(durations))
+	for i, d := range durations {
+		divided[i] = d / unit
+	}
+	return divided
+}
+
+// recordingRetryPolicy records the attempts passed to it, and waits as Policy.
+type recordingRetryPolicy struct {
+	Policy sql.RetryPolicy
+
+	attempts []sql.RetryAttempt
+	lock     sync.Mutex
+}
+
+func (p *recordingRetryPolicy) NextRetry(attempt sql.RetryAttempt) (time.Duration, bool) {
+	p.lock.Lock()
+	p.attempts = append(p.attempts, attempt)
+	p.lock.Unlock()
+
+	return p.Policy.NextRetry(attempt)
+}
+
+func (p *recordingRetryPolicy) Retries() []int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var retries []int
+	for _, attempt := range p.attempts {
+		retries = append(retries, attempt.Retry)
+	}
+	return retries
+}
+
+func TestRunInTx_retryPolicy(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "retry.sqlite"))
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	policy := &recordingRetryPolicy{Policy: sql.ConstantRetryPolicy{Interval: time.Millisecond, MaxRetries: 3}}
+
+	calls := 0
+	err = sql.RunInTx(context.Background(), sql.BeginnerFromStdSQL(sqlDB), sql.RunInTxOptions{RetryPolicy: policy}, func(ctx context.Context, tx sql.Tx) error {
+		calls++
+		return sql.ErrInjectedBusy
+	})
+	assert.ErrorIs(t, err, sql.ErrInjectedBusy)
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, []int{1, 2, 3, 4}, policy.Retries())
+}
+
+func TestSubscriber_redeliveryPolicy(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "redelivery.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	schemaAdapter := sql.DefaultSQLiteSchema{}
+	require.NoError(t, newCheckpointPublisher(t, db, schemaAdapter).Publish("orders", message.NewMessage(watermill.NewUUID(), nil)))
+
+	policy := &recordingRetryPolicy{Policy: sql.ConstantRetryPolicy{Interval: time.Millisecond, MaxRetries: 1}}
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+		RedeliveryPolicy: policy,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	messages, err := subscriber.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-messages:
+			if i < 2 {
+				msg.Nack()
+			} else {
+				msg.Ack()
+			}
+		case <-ctx.Done():
+			t.Fatal("message was not redelivered")
+		}
+	}
+
+	// The message is redelivered after the policy stopped retrying, as nacked messages are not skipped.
+	assert.Equal(t, []int{1, 2}, policy.Retries())
+}
+
+func TestSubscriber_closeDuringRedeliveryWait(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "redelivery_wait.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	require.NoError(t, newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{}).Publish("orders", message.NewMessage(watermill.NewUUID(), nil)))
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+		RedeliveryPolicy: sql.ConstantRetryPolicy{Interval: time.Hour},
+	}, logger)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	messages, err := subscriber.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	select {
+	case msg := <-messages:
+		msg.Nack()
+	case <-ctx.Done():
+		t.Fatal("message was not delivered")
+	}
+
+	// The nacked message waits an hour before redelivery.
+	time.Sleep(time.Millisecond * 100)
+
+	closed := make(chan error)
+	go func() {
+		closed <- subscriber.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("Close should not wait for the redelivery")
+	}
+}
@@ -0,0 +1,78 @@
+package sql
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// rowBuffers are the reusable buffers holding the UUID, payload and metadata of a consumed row
+// (see DefaultSQLiteSchema.PooledBuffers).
+type rowBuffers struct {
+	uuid     []byte
+	payload  []byte
+	metadata []byte
+}
+
+// maxPooledBufferSize is the capacity above which buffers are not returned to the pool,
+// so a single large message doesn't keep the memory allocated.
+const maxPooledBufferSize = 64 * 1024
+
+var rowBuffersPool = sync.Pool{
+	New: func() any {
+		return &rowBuffers{}
+	},
+}
+
+// release returns the buffers of the row to the pool. It's called by the subscriber when the message was acked,
+// so the buffers are not used by the handler anymore.
+func (r Row) release() {
+	if r.buffers == nil {
+		return
+	}
+	if cap(r.buffers.payload) > maxPooledBufferSize || cap(r.buffers.metadata) > maxPooledBufferSize {
+		return
+	}
+
+	rowBuffersPool.Put(r.buffers)
+}
+
+// scanPooledRow scans offset, uuid, payload and metadata (and created_at, if selected) of *sql.Rows,
+// copying the values into pooled buffers instead of allocating them for every row.
+// It returns false if the row is not *sql.Rows, as other drivers may not support sql.RawBytes.
+func scanPooledRow(row Scanner, selectCreatedAt bool) (Row, bool, error) {
+	rows, ok := row.(*sql.Rows)
+	if !ok {
+		return Row{}, false, nil
+	}
+
+	// sql.RawBytes point to the memory of the driver, which is valid only until the next row is scanned.
+	var uuid, payload, metadata sql.RawBytes
+	r := Row{}
+
+	createdAt, err := scanWithCreatedAt(rows, []any{&r.Offset, &uuid, &payload, &metadata}, selectCreatedAt)
+	if err != nil {
+		return Row{}, true, err
+	}
+
+	buffers := rowBuffersPool.Get().(*rowBuffers)
+	buffers.uuid = append(buffers.uuid[:0], uuid...)
+	buffers.payload = append(buffers.payload[:0], payload...)
+	buffers.metadata = append(buffers.metadata[:0], metadata...)
+
+	r.UUID = buffers.uuid
+	r.Payload = nullable(buffers.payload, payload)
+	r.Metadata = nullable(buffers.metadata, metadata)
+	r.CreatedAt = createdAt
+	r.buffers = buffers
+
+	return r, true, nil
+}
+
+// nullable returns nil instead of the buffer if the scanned value was NULL.
+func nullable(buffer []byte, value sql.RawBytes) []byte {
+	if value == nil {
+		return nil
+	}
+
+	return buffer
+}
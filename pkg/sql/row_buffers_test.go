@@ -0,0 +1,106 @@
+package sql_test
+
+import (
+	"bytes"
+	"context"
+	stdSQL "database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_PooledBuffers(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topicName := "pooled_" + watermill.NewShortUUID()
+	schemaAdapter := newSQLiteSchemaAdapter(10)
+	schemaAdapter.PooledBuffers = true
+
+	publisher := newCheckpointPublisher(t, db, schemaAdapter)
+	var published []*message.Message
+	for i := 0; i < 50; i++ {
+		// Payloads of different lengths, so reused buffers would show leftovers of the previous messages.
+		msg := message.NewMessage(watermill.NewUUID(), bytes.Repeat([]byte{byte('a' + i%26)}, 50-i))
+		msg.Metadata.Set("i", fmt.Sprint(i))
+		require.NoError(t, publisher.Publish(topicName, msg))
+		published = append(published, msg)
+	}
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "pooled",
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	consumed, err := subscriber.Subscribe(context.Background(), topicName)
+	require.NoError(t, err)
+
+	for _, expected := range published {
+		select {
+		case msg := <-consumed:
+			assert.Equal(t, expected.UUID, msg.UUID)
+			assert.Equal(t, expected.Payload, msg.Payload)
+			assert.Equal(t, expected.Metadata.Get("i"), msg.Metadata.Get("i"))
+			msg.Ack()
+		case <-time.After(time.Second * 5):
+			t.Fatal("timeout waiting for message")
+		}
+	}
+}
+
+func BenchmarkSubscriber_Consume(b *testing.B) {
+	for _, pooled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pooled_buffers=%t", pooled), func(b *testing.B) {
+			sqlDB, err := stdSQL.Open("sqlite", filepath.Join(b.TempDir(), "bench.sqlite")+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+			require.NoError(b, err)
+			defer sqlDB.Close()
+
+			db := sql.BeginnerFromStdSQL(sqlDB)
+			topicName := "bench"
+			schemaAdapter := sql.DefaultSQLiteSchema{SubscribeBatchSize: 100, PooledBuffers: pooled}
+
+			publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+				SchemaAdapter:        schemaAdapter,
+				AutoInitializeSchema: true,
+			}, nil)
+			require.NoError(b, err)
+
+			payload := bytes.Repeat([]byte("x"), 1024)
+			msgs := make([]*message.Message, 0, 100)
+			for i := 0; i < b.N; i++ {
+				msgs = append(msgs, message.NewMessage(watermill.NewUUID(), payload))
+				if len(msgs) == cap(msgs) || i == b.N-1 {
+					require.NoError(b, publisher.Publish(topicName, msgs...))
+					msgs = msgs[:0]
+				}
+			}
+
+			subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+				SchemaAdapter:    schemaAdapter,
+				OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+				InitializeSchema: true,
+			}, nil)
+			require.NoError(b, err)
+			defer subscriber.Close()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			consumed, err := subscriber.Subscribe(context.Background(), topicName)
+			require.NoError(b, err)
+			for i := 0; i < b.N; i++ {
+				msg := <-consumed
+				msg.Ack()
+			}
+		})
+	}
+}
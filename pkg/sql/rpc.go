@@ -0,0 +1,284 @@
+package sql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ReplyTopicMetadataKey is the metadata key of requests containing the topic to which the reply is published.
+	ReplyTopicMetadataKey = "reply_topic"
+
+	// InReplyToMetadataKey is the metadata key of replies containing the UUID of the request.
+	InReplyToMetadataKey = "in_reply_to"
+)
+
+var (
+	ErrRequestTimeout  = errors.New("request timed out")
+	ErrRequesterClosed = errors.New("requester is closed")
+)
+
+var errDuplicateRequest = errors.New("request with the same UUID is pending")
+
+type RequesterConfig struct {
+	// ReplyTopic is the topic on which the replies are received. It's required.
+	//
+	// Replies are consumed by one consumer group, so every instance of the requester needs its own reply topic
+	// (for example, with the instance's ID as the suffix), or its own consumer group of the subscriber.
+	ReplyTopic string
+
+	// Timeout is the maximum time of waiting for a reply, if the context of the request has no deadline.
+	//
+	// Default value is 30s.
+	Timeout time.Duration
+}
+
+func (c *RequesterConfig) setDefaults() {
+	if c.Timeout == 0 {
+		c.Timeout = time.Second * 30
+	}
+}
+
+func (c RequesterConfig) validate() error {
+	if err := validateTopicName(c.ReplyTopic); err != nil {
+		return errors.Wrap(err, "invalid reply topic")
+	}
+	if c.Timeout < 0 {
+		return errors.New("timeout must be a positive duration")
+	}
+
+	return nil
+}
+
+// Requester publishes requests and waits for their replies published by Responder,
+// so simple RPC between services may use the durable SQL topics.
+//
+// Requests are delivered at least once, so handlers of requests should be idempotent.
+// Replies to requests which timed out are acked and dropped.
+type Requester struct {
+	config    RequesterConfig
+	publisher message.Publisher
+
+	lock    sync.Mutex
+	pending map[string]chan *message.Message
+	closed  bool
+
+	cancel    context.CancelFunc
+	consuming chan struct{}
+
+	logger watermill.LoggerAdapter
+}
+
+// NewRequester creates Requester publishing requests with the publisher,
+// and subscribing to ReplyTopic with the subscriber.
+func NewRequester(
+	publisher message.Publisher,
+	subscriber message.Subscriber,
+	config RequesterConfig,
+	logger watermill.LoggerAdapter,
+) (*Requester, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if publisher == nil {
+		return nil, errors.New("publisher is nil")
+	}
+	if subscriber == nil {
+		return nil, errors.New("subscriber is nil")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	replies, err := subscriber.Subscribe(ctx, config.ReplyTopic)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "could not subscribe to reply topic")
+	}
+
+	r := &Requester{
+		config:    config,
+		publisher: publisher,
+		pending:   map[string]chan *message.Message{},
+		cancel:    cancel,
+		consuming: make(chan struct{}),
+		logger: logger.With(watermill.LogFields{
+			"reply_topic": config.ReplyTopic,
+		}),
+	}
+	go r.consumeReplies(replies)
+
+	return r, nil
+}
+
+// Request publishes the request to the topic and waits for its reply until the context is canceled,
+// or Timeout passes. ErrRequestTimeout is returned when no reply was received in time.
+func (r *Requester) Request(ctx context.Context, topic string, request *message.Message) (*message.Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.Timeout)
+		defer cancel()
+	}
+
+	reply, err := r.register(request.UUID)
+	if err != nil {
+		return nil, err
+	}
+	defer r.unregister(request.UUID)
+
+	request.Metadata.Set(ReplyTopicMetadataKey, r.config.ReplyTopic)
+	if CorrelationID(request) == "" {
+		request.Metadata.Set(CorrelationIDMetadataKey, request.UUID)
+	}
+
+	if err := r.publisher.Publish(topic, request); err != nil {
+		return nil, errors.Wrap(err, "could not publish request")
+	}
+
+	select {
+	case msg, ok := <-reply:
+		if !ok {
+			return nil, ErrRequesterClosed
+		}
+		return msg, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrRequestTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops consuming replies. Pending requests return ErrRequesterClosed.
+func (r *Requester) Close() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.lock.Unlock()
+
+	r.cancel()
+	<-r.consuming
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for uuid, reply := range r.pending {
+		close(reply)
+		delete(r.pending, uuid)
+	}
+
+	return nil
+}
+
+func (r *Requester) register(uuid string) (chan *message.Message, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return nil, ErrRequesterClosed
+	}
+	if _, ok := r.pending[uuid]; ok {
+		return nil, errDuplicateRequest
+	}
+
+	reply := make(chan *message.Message, 1)
+	r.pending[uuid] = reply
+
+	return reply, nil
+}
+
+func (r *Requester) unregister(uuid string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.pending, uuid)
+}
+
+func (r *Requester) consumeReplies(replies <-chan *message.Message) {
+	defer close(r.consuming)
+
+	for msg := range replies {
+		requestUUID := msg.Metadata.Get(InReplyToMetadataKey)
+
+		r.lock.Lock()
+		reply, ok := r.pending[requestUUID]
+		if ok {
+			reply <- msg
+			delete(r.pending, requestUUID)
+		}
+		r.lock.Unlock()
+
+		if !ok {
+			r.logger.Debug("Dropping reply to unknown request", watermill.LogFields{
+				"request_uuid": requestUUID,
+				"reply_uuid":   msg.UUID,
+			})
+		}
+
+		msg.Ack()
+	}
+}
+
+// RequestHandler handles the request and returns its reply.
+// When it returns an error, the request is nacked, and handled again.
+type RequestHandler func(request *message.Message) (*message.Message, error)
+
+// Responder publishes the replies of requests published by Requester.
+type Responder struct {
+	publisher message.Publisher
+}
+
+// NewResponder creates Responder publishing the replies with the publisher.
+func NewResponder(publisher message.Publisher) (*Responder, error) {
+	if publisher == nil {
+		return nil, errors.New("publisher is nil")
+	}
+
+	return &Responder{publisher: publisher}, nil
+}
+
+// Handler returns a handler of requests, which may be added to the router with AddNoPublisherHandler.
+// The reply is published to the request's reply topic, with the correlation ID of the request.
+// Replies to messages without the reply topic (which were not published by Requester) are dropped.
+//
+// Replies are published after the handler returns, so a request may be replied to multiple times,
+// if acking it fails. Requester ignores the repeated replies.
+//
+// SQLite allows only one writer at a time, so when requests are consumed in transactions,
+// the replies must be published to another database.
+func (r *Responder) Handler(handler RequestHandler) message.NoPublishHandlerFunc {
+	return func(request *message.Message) error {
+		reply, err := handler(request)
+		if err != nil {
+			return err
+		}
+
+		replyTopic := request.Metadata.Get(ReplyTopicMetadataKey)
+		if replyTopic == "" || reply == nil {
+			return nil
+		}
+
+		reply.Metadata.Set(InReplyToMetadataKey, request.UUID)
+		if correlationID := CorrelationID(request); correlationID != "" {
+			reply.Metadata.Set(CorrelationIDMetadataKey, correlationID)
+		}
+		reply.Metadata.Set(CausationIDMetadataKey, request.UUID)
+
+		if err := r.publisher.Publish(replyTopic, reply); err != nil {
+			return errors.Wrap(err, "could not publish reply")
+		}
+
+		return nil
+	}
+}
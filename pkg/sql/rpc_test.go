@@ -0,0 +1,98 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequester(t *testing.T) {
+	// Replies are stored in a separate database, as SQLite doesn't allow publishing them
+	// while the request is consumed in a transaction.
+	openDB := func(name string) sql.TxBeginner {
+		sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), name)+"?_pragma=busy_timeout(10000)")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = sqlDB.Close()
+		})
+		return sql.BeginnerFromStdSQL(sqlDB)
+	}
+	requestsDB := openDB("requests.sqlite")
+	repliesDB := openDB("replies.sqlite")
+	requestTopic := "rpc_requests_" + watermill.NewShortUUID()
+
+	newSubscriber := func(db sql.TxBeginner) *sql.Subscriber {
+		subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+			SchemaAdapter:    sql.DefaultSQLiteSchema{},
+			OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+			InitializeSchema: true,
+			PollInterval:     time.Millisecond * 10,
+		}, logger)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, subscriber.Close())
+		})
+		return subscriber
+	}
+	requestsPublisher := newCheckpointPublisher(t, requestsDB, sql.DefaultSQLiteSchema{})
+	repliesPublisher := newCheckpointPublisher(t, repliesDB, sql.DefaultSQLiteSchema{})
+
+	responder, err := sql.NewResponder(repliesPublisher)
+	require.NoError(t, err)
+	handler := responder.Handler(func(request *message.Message) (*message.Message, error) {
+		if string(request.Payload) == "slow" {
+			time.Sleep(time.Millisecond * 300)
+		}
+		return message.NewMessage(watermill.NewUUID(), []byte(strings.ToUpper(string(request.Payload)))), nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	requests, err := newSubscriber(requestsDB).Subscribe(ctx, requestTopic)
+	require.NoError(t, err)
+	go func() {
+		for msg := range requests {
+			if err := handler(msg); err != nil {
+				msg.Nack()
+				continue
+			}
+			msg.Ack()
+		}
+	}()
+
+	requester, err := sql.NewRequester(requestsPublisher, newSubscriber(repliesDB), sql.RequesterConfig{
+		ReplyTopic: "rpc_replies_" + watermill.NewShortUUID(),
+		Timeout:    time.Second * 10,
+	}, logger)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, requester.Close())
+	}()
+
+	request := message.NewMessage(watermill.NewUUID(), []byte("ping"))
+	reply, err := requester.Request(ctx, requestTopic, request)
+	require.NoError(t, err)
+	assert.Equal(t, "PING", string(reply.Payload))
+	assert.Equal(t, request.UUID, reply.Metadata.Get(sql.InReplyToMetadataKey))
+	assert.Equal(t, request.UUID, reply.Metadata.Get(sql.CorrelationIDMetadataKey))
+
+	timeoutCtx, cancelTimeout := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancelTimeout()
+	_, err = requester.Request(timeoutCtx, requestTopic, message.NewMessage(watermill.NewUUID(), []byte("slow")))
+	assert.ErrorIs(t, err, sql.ErrRequestTimeout)
+
+	// The late reply of the timed out request is dropped.
+	reply, err = requester.Request(ctx, requestTopic, message.NewMessage(watermill.NewUUID(), []byte("pong")))
+	require.NoError(t, err)
+	assert.Equal(t, "PONG", string(reply.Payload))
+}
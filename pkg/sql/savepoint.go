@@ -0,0 +1,58 @@
+package sql
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+const messageSavepointName = "watermill_message"
+
+// messageSavepoint isolates the changes made by the handler of a single message
+// within the transaction consuming the batch (see SubscriberConfig.UseSavepoints).
+//
+// All methods are no-ops for a nil savepoint, so they can be called when savepoints are disabled.
+type messageSavepoint struct {
+	tx  Tx
+	err error
+}
+
+func beginMessageSavepoint(ctx context.Context, tx Tx) (*messageSavepoint, error) {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+messageSavepointName); err != nil {
+		return nil, errors.Wrap(err, "could not create savepoint")
+	}
+
+	return &messageSavepoint{tx: tx}, nil
+}
+
+// rollback rolls back the changes made since the savepoint was created, so the message can be re-delivered.
+// The savepoint stays active after the rollback. It returns false if the rollback failed.
+func (sp *messageSavepoint) rollback(ctx context.Context) bool {
+	if sp == nil {
+		return true
+	}
+
+	if _, err := sp.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+messageSavepointName); err != nil {
+		sp.err = errors.Wrap(err, "could not rollback to savepoint")
+		return false
+	}
+
+	return true
+}
+
+// finish keeps the changes of an acked message, or rolls back the changes of a message which was not acked.
+func (sp *messageSavepoint) finish(ctx context.Context, acked bool) error {
+	if sp == nil {
+		return nil
+	}
+
+	if !acked {
+		sp.rollback(ctx)
+	} else if sp.err == nil {
+		if _, err := sp.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+messageSavepointName); err != nil {
+			sp.err = errors.Wrap(err, "could not release savepoint")
+		}
+	}
+
+	return sp.err
+}
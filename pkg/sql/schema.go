@@ -11,11 +11,11 @@ func initializeSchema(
 	ctx context.Context,
 	topic string,
 	logger watermill.LoggerAdapter,
-	db ContextExecutor,
+	db QueryExecutor,
 	schemaAdapter SchemaAdapter,
 	offsetsAdapter OffsetsAdapter,
 ) error {
-	err := validateTopicName(topic)
+	err := validateTopic(schemaAdapter, topic)
 	if err != nil {
 		return err
 	}
@@ -3,6 +3,7 @@ package sql
 import (
 	"database/sql"
 	"encoding/json"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/pkg/errors"
@@ -39,9 +40,83 @@ type Row struct {
 	Payload  []byte
 	Metadata []byte
 
+	// CreatedAt is the creation time of the message in UTC, if the schema adapter selects it
+	// (like DefaultSQLiteSchema with SelectCreatedAt). Otherwise, it's zero.
+	CreatedAt time.Time
+
 	Msg *message.Message
 
 	ExtraData map[string]any
+
+	// ExtraColumns are the values of custom columns of the messages table, by column names.
+	// They are passed to handlers in the context of the message (see ExtraColumnsFromContext).
+	ExtraColumns map[string]any
+
+	// buffers are the pooled buffers of UUID, Payload and Metadata, released when the message is acked.
+	buffers *rowBuffers
+}
+
+// ColumnsScanner is a Scanner which returns the names of the scanned columns, like *sql.Rows.
+// Rows returned by BeginnerFromStdSQL and BeginnerFromPgx implement it.
+type ColumnsScanner interface {
+	Scanner
+	Columns() ([]string, error)
+}
+
+// ScanRow scans a row with any number of columns into Row, which may be used by UnmarshalMessage
+// of custom schema adapters. Columns are mapped to the fields of Row by their names (see ColumnNames),
+// and the other columns are scanned into ExtraColumns. The created_at column is parsed into CreatedAt
+// (see ParseCreatedAt).
+//
+// Msg is not set, as unmarshaling payloads and metadata depends on the schema.
+func ScanRow(row ColumnsScanner, names ColumnNames) (Row, error) {
+	columns, err := row.Columns()
+	if err != nil {
+		return Row{}, errors.Wrap(err, "could not get columns")
+	}
+
+	names = names.withDefaults()
+
+	r := Row{}
+	var createdAt any
+	dest := make([]any, len(columns))
+	extra := map[string]*any{}
+	for i, column := range columns {
+		switch column {
+		case names.Offset:
+			dest[i] = &r.Offset
+		case names.UUID:
+			dest[i] = &r.UUID
+		case names.Payload:
+			dest[i] = &r.Payload
+		case names.Metadata:
+			dest[i] = &r.Metadata
+		case names.CreatedAt:
+			dest[i] = &createdAt
+		default:
+			value := new(any)
+			extra[column] = value
+			dest[i] = value
+		}
+	}
+
+	if err := row.Scan(dest...); err != nil {
+		return Row{}, errors.Wrap(err, "could not scan message row")
+	}
+
+	r.CreatedAt, err = ParseCreatedAt(createdAt)
+	if err != nil {
+		return Row{}, err
+	}
+
+	if len(extra) > 0 {
+		r.ExtraColumns = make(map[string]any, len(extra))
+		for column, value := range extra {
+			r.ExtraColumns[column] = *value
+		}
+	}
+
+	return r, nil
 }
 
 func defaultInsertArgs(msgs message.Messages) ([]interface{}, error) {
@@ -57,3 +132,18 @@ func defaultInsertArgs(msgs message.Messages) ([]interface{}, error) {
 
 	return args, nil
 }
+
+// stringMetadataInsertArgs works like defaultInsertArgs, but passes metadata as a string
+// for databases which don't convert binary values to text columns.
+func stringMetadataInsertArgs(msgs message.Messages) ([]interface{}, error) {
+	args, err := defaultInsertArgs(msgs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 2; i < len(args); i += 3 {
+		args[i] = string(args[i].([]byte))
+	}
+
+	return args, nil
+}
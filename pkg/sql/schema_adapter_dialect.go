@@ -0,0 +1,285 @@
+package sql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// ColumnNames are the names of the columns of the messages table.
+// Empty names default to the names used by the default schemas: offset, uuid, payload, metadata and created_at.
+//
+// They may be used to run against pre-existing tables with different column names.
+type ColumnNames struct {
+	Offset    string
+	UUID      string
+	Payload   string
+	Metadata  string
+	CreatedAt string
+}
+
+func (c ColumnNames) withDefaults() ColumnNames {
+	if c.Offset == "" {
+		c.Offset = "offset"
+	}
+	if c.UUID == "" {
+		c.UUID = "uuid"
+	}
+	if c.Payload == "" {
+		c.Payload = "payload"
+	}
+	if c.Metadata == "" {
+		c.Metadata = "metadata"
+	}
+	if c.CreatedAt == "" {
+		c.CreatedAt = "created_at"
+	}
+
+	return c
+}
+
+// DialectSchema is an implementation of SchemaAdapter which generates queries using the provided Dialect.
+// It should be used together with DialectOffsetsAdapter.
+//
+//	schemaAdapter := sql.DialectSchema{Dialect: sql.SpannerDialect{}}
+//	offsetsAdapter := sql.DialectOffsetsAdapter{Dialect: sql.SpannerDialect{}}
+type DialectSchema struct {
+	Dialect Dialect
+
+	// GenerateMessagesTableName may be used to override how the messages table name is generated.
+	// The returned name should be already quoted.
+	GenerateMessagesTableName func(topic string) string
+
+	// SubscribeBatchSize is the number of messages to be queried at once.
+	//
+	// Higher value, increases a chance of message re-delivery in case of crash or networking issues.
+	// 1 is the safest value, but it may have a negative impact on performance when consuming a lot of messages.
+	//
+	// Default value is 100.
+	SubscribeBatchSize int
+
+	// CausalityColumns adds the correlation_id and causation_id columns to the messages table.
+	// They are filled from the messages' metadata (see CorrelationIDMetadataKey and CausationIDMetadataKey),
+	// so messages can be indexed and queried by them.
+	CausalityColumns bool
+
+	// MessagesOrder is the order in which messages of a selected batch are delivered.
+	//
+	// Default value is MessagesOrderOffset.
+	MessagesOrder MessagesOrder
+
+	// ColumnNames overrides the names of the columns of the messages table.
+	// The names are quoted by Dialect.QuoteIdentifier.
+	ColumnNames ColumnNames
+
+	// Fragments are custom SQL fragments added to the generated queries.
+	Fragments SQLFragments
+
+	// ExtraColumns are the names of custom columns of the messages table, which are selected with the messages
+	// and passed to handlers in the context of the message (see ExtraColumnsFromContext).
+	//
+	// They are not created by SchemaInitializingQueries nor filled by InsertQuery,
+	// so they should be added to pre-existing tables with default values.
+	ExtraColumns []string
+}
+
+func (s DialectSchema) SchemaInitializingQueries(topic string) []Query {
+	names := s.ColumnNames.withDefaults()
+
+	columns := []DialectColumn{
+		{Name: names.Offset, Type: DialectColumnTypeOffset},
+		{Name: names.UUID, Type: DialectColumnTypeString},
+		{Name: names.CreatedAt, Type: DialectColumnTypeTimestamp},
+		{Name: names.Payload, Type: DialectColumnTypeBytes, Nullable: true},
+		{Name: names.Metadata, Type: DialectColumnTypeText, Nullable: true},
+	}
+	if s.CausalityColumns {
+		columns = append(
+			columns,
+			DialectColumn{Name: "correlation_id", Type: DialectColumnTypeString, Nullable: true},
+			DialectColumn{Name: "causation_id", Type: DialectColumnTypeString, Nullable: true},
+		)
+	}
+
+	return []Query{{Query: s.Dialect.CreateTableQuery(s.MessagesTable(topic), columns, []string{names.Offset})}}
+}
+
+func (s DialectSchema) InsertQuery(topic string, msgs message.Messages) (Query, error) {
+	table := s.MessagesTable(topic)
+	offsetColumn := s.ColumnNames.withDefaults().Offset
+
+	columns := s.insertedColumns()
+	argsPerMessage := len(columns)
+	withOffset := s.Dialect.InsertedOffsetExpression(table, offsetColumn, 0) != ""
+	if withOffset {
+		columns = append([]string{offsetColumn}, columns...)
+	}
+
+	values := make([]string, len(msgs))
+	for i := range msgs {
+		rowValues := dialectPlaceholders(s.Dialect, i*argsPerMessage+1, argsPerMessage)
+		if withOffset {
+			rowValues = append([]string{s.Dialect.InsertedOffsetExpression(table, offsetColumn, i)}, rowValues...)
+		}
+		values[i] = "(" + strings.Join(rowValues, ",") + ")"
+	}
+
+	insertQuery := s.Fragments.insertQuery(fmt.Sprintf(
+		`INSERT INTO %s (%s) VALUES %s`,
+		table,
+		strings.Join(quoteIdentifiers(s.Dialect, columns), ", "),
+		strings.Join(values, ","),
+	))
+
+	args, err := stringMetadataInsertArgs(msgs)
+	if err != nil {
+		return Query{}, err
+	}
+
+	if s.CausalityColumns {
+		args = causalityInsertArgs(msgs, args)
+	}
+
+	return Query{insertQuery, args}, nil
+}
+
+func (s DialectSchema) insertedColumns() []string {
+	names := s.ColumnNames.withDefaults()
+
+	columns := []string{names.UUID, names.Payload, names.Metadata}
+	if s.CausalityColumns {
+		columns = append(columns, "correlation_id", "causation_id")
+	}
+
+	return columns
+}
+
+// causalityInsertArgs appends the correlation and causation IDs after the default arguments of every message.
+func causalityInsertArgs(msgs message.Messages, defaultArgs []any) []any {
+	args := make([]any, 0, len(msgs)*5)
+	for i, msg := range msgs {
+		args = append(
+			args,
+			defaultArgs[i*3], defaultArgs[i*3+1], defaultArgs[i*3+2],
+			nullableString(msg.Metadata.Get(CorrelationIDMetadataKey)),
+			nullableString(msg.Metadata.Get(CausationIDMetadataKey)),
+		)
+	}
+
+	return args
+}
+
+func nullableString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func (s DialectSchema) batchSize() int {
+	if s.SubscribeBatchSize == 0 {
+		return 100
+	}
+
+	return s.SubscribeBatchSize
+}
+
+func (s DialectSchema) SelectQuery(topic string, consumerGroup string, offsetsAdapter OffsetsAdapter) Query {
+	nextOffsetQuery := offsetsAdapter.NextOffsetQuery(topic, consumerGroup)
+	names := s.ColumnNames.withDefaults()
+	offsetColumn := s.Dialect.QuoteIdentifier(names.Offset)
+
+	columns := s.selectedColumns()
+	batchColumns := columns
+	if s.MessagesOrder != MessagesOrderOffset {
+		batchColumns = append(batchColumns[:len(batchColumns):len(batchColumns)], names.CreatedAt)
+	}
+
+	selectQuery := `
+		SELECT ` + strings.Join(quoteIdentifiers(s.Dialect, batchColumns), ", ") + `
+		FROM ` + s.Fragments.fromTable(s.MessagesTable(topic)) + `
+		WHERE
+			` + offsetColumn + ` > (` + nextOffsetQuery.Query + `)
+			` + s.Fragments.andWhereExtra() + `
+		ORDER BY
+			` + offsetColumn + ` ASC
+		` + s.Dialect.LimitClause(s.batchSize())
+	selectQuery = orderedSelectQuery(s.MessagesOrder, columns, names.Offset, names.CreatedAt, selectQuery, s.Dialect.QuoteIdentifier)
+
+	return Query{Query: selectQuery, Args: nextOffsetQuery.Args}
+}
+
+func (s DialectSchema) ReordersMessages() bool {
+	return s.MessagesOrder != MessagesOrderOffset
+}
+
+func (s DialectSchema) selectedColumns() []string {
+	names := s.ColumnNames.withDefaults()
+
+	columns := []string{names.Offset, names.UUID, names.Payload, names.Metadata}
+	if s.CausalityColumns {
+		columns = append(columns, "correlation_id", "causation_id")
+	}
+	columns = append(columns, s.ExtraColumns...)
+
+	return columns
+}
+
+func (s DialectSchema) UnmarshalMessage(row Scanner) (Row, error) {
+	r := Row{}
+	var correlationID, causationID sql.NullString
+
+	dest := []any{&r.Offset, &r.UUID, &r.Payload, &r.Metadata}
+	if s.CausalityColumns {
+		dest = append(dest, &correlationID, &causationID)
+	}
+	extraValues := make([]any, len(s.ExtraColumns))
+	for i := range extraValues {
+		dest = append(dest, &extraValues[i])
+	}
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return Row{}, errors.Wrap(err, "could not scan message row")
+	}
+
+	msg := message.NewMessage(string(r.UUID), r.Payload)
+
+	if r.Metadata != nil {
+		err = json.Unmarshal(r.Metadata, &msg.Metadata)
+		if err != nil {
+			return Row{}, errors.Wrap(err, "could not unmarshal metadata as JSON")
+		}
+	}
+
+	// The columns take precedence, as they may be updated independently of the metadata.
+	if correlationID.Valid {
+		msg.Metadata.Set(CorrelationIDMetadataKey, correlationID.String)
+	}
+	if causationID.Valid {
+		msg.Metadata.Set(CausationIDMetadataKey, causationID.String)
+	}
+
+	if len(s.ExtraColumns) > 0 {
+		r.ExtraColumns = make(map[string]any, len(s.ExtraColumns))
+		for i, column := range s.ExtraColumns {
+			r.ExtraColumns[column] = extraValues[i]
+		}
+	}
+
+	r.Msg = msg
+
+	return r, nil
+}
+
+func (s DialectSchema) MessagesTable(topic string) string {
+	if s.GenerateMessagesTableName != nil {
+		return s.GenerateMessagesTableName(topic)
+	}
+	return s.Dialect.QuoteIdentifier("watermill_" + topic)
+}
+
+func (s DialectSchema) SubscribeIsolationLevel() sql.IsolationLevel {
+	return s.Dialect.SubscribeIsolationLevel()
+}
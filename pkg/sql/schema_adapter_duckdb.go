@@ -0,0 +1,128 @@
+package sql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// DefaultDuckDBSchema is a default implementation of SchemaAdapter based on DuckDB.
+//
+// Offsets are generated by a sequence created for each topic.
+//
+// DuckDB doesn't expose transaction IDs like PostgreSQL does, so messages published in long-running
+// concurrent transactions may be committed with a lower offset than already consumed messages.
+// DuckDB is usually used as an embedded database with a single writer, where it's not an issue.
+type DefaultDuckDBSchema struct {
+	// GenerateMessagesTableName may be used to override how the messages table name is generated.
+	GenerateMessagesTableName func(topic string) string
+
+	// GenerateMessagesSequenceName may be used to override how the offsets sequence name is generated.
+	GenerateMessagesSequenceName func(topic string) string
+
+	// SubscribeBatchSize is the number of messages to be queried at once.
+	//
+	// Higher value, increases a chance of message re-delivery in case of crash or networking issues.
+	// 1 is the safest value, but it may have a negative impact on performance when consuming a lot of messages.
+	//
+	// Default value is 100.
+	SubscribeBatchSize int
+}
+
+func (s DefaultDuckDBSchema) SchemaInitializingQueries(topic string) []Query {
+	createSequence := `CREATE SEQUENCE IF NOT EXISTS ` + s.MessagesSequence(topic)
+
+	createMessagesTable := `
+		CREATE TABLE IF NOT EXISTS ` + s.MessagesTable(topic) + ` (
+			"offset" BIGINT PRIMARY KEY DEFAULT nextval('` + s.MessagesSequence(topic) + `'),
+			"uuid" VARCHAR NOT NULL,
+			"created_at" TIMESTAMP NOT NULL DEFAULT current_timestamp,
+			"payload" BLOB,
+			"metadata" VARCHAR
+		);
+	`
+
+	return []Query{{Query: createSequence}, {Query: createMessagesTable}}
+}
+
+func (s DefaultDuckDBSchema) InsertQuery(topic string, msgs message.Messages) (Query, error) {
+	insertQuery := fmt.Sprintf(
+		`INSERT INTO %s ("uuid", "payload", "metadata") VALUES %s`,
+		s.MessagesTable(topic),
+		strings.TrimRight(strings.Repeat(`(?,?,?),`, len(msgs)), ","),
+	)
+
+	// DuckDB doesn't cast BLOB to VARCHAR implicitly.
+	args, err := stringMetadataInsertArgs(msgs)
+	if err != nil {
+		return Query{}, err
+	}
+
+	return Query{insertQuery, args}, nil
+}
+
+func (s DefaultDuckDBSchema) batchSize() int {
+	if s.SubscribeBatchSize == 0 {
+		return 100
+	}
+
+	return s.SubscribeBatchSize
+}
+
+func (s DefaultDuckDBSchema) SelectQuery(topic string, consumerGroup string, offsetsAdapter OffsetsAdapter) Query {
+	nextOffsetQuery := offsetsAdapter.NextOffsetQuery(topic, consumerGroup)
+
+	selectQuery := `
+		SELECT "offset", "uuid", "payload", "metadata" FROM ` + s.MessagesTable(topic) + `
+		WHERE
+			"offset" > (` + nextOffsetQuery.Query + `)
+		ORDER BY
+			"offset" ASC
+		LIMIT ` + fmt.Sprintf("%d", s.batchSize())
+
+	return Query{Query: selectQuery, Args: nextOffsetQuery.Args}
+}
+
+func (s DefaultDuckDBSchema) UnmarshalMessage(row Scanner) (Row, error) {
+	r := Row{}
+	err := row.Scan(&r.Offset, &r.UUID, &r.Payload, &r.Metadata)
+	if err != nil {
+		return Row{}, errors.Wrap(err, "could not scan message row")
+	}
+
+	msg := message.NewMessage(string(r.UUID), r.Payload)
+
+	if r.Metadata != nil {
+		err = json.Unmarshal(r.Metadata, &msg.Metadata)
+		if err != nil {
+			return Row{}, errors.Wrap(err, "could not unmarshal metadata as JSON")
+		}
+	}
+
+	r.Msg = msg
+
+	return r, nil
+}
+
+func (s DefaultDuckDBSchema) MessagesTable(topic string) string {
+	if s.GenerateMessagesTableName != nil {
+		return s.GenerateMessagesTableName(topic)
+	}
+	return fmt.Sprintf(`"watermill_%s"`, topic)
+}
+
+func (s DefaultDuckDBSchema) MessagesSequence(topic string) string {
+	if s.GenerateMessagesSequenceName != nil {
+		return s.GenerateMessagesSequenceName(topic)
+	}
+	return fmt.Sprintf(`"watermill_seq_%s"`, topic)
+}
+
+func (s DefaultDuckDBSchema) SubscribeIsolationLevel() sql.IsolationLevel {
+	// DuckDB supports only snapshot isolation, and the driver rejects other isolation levels.
+	return sql.LevelDefault
+}
@@ -0,0 +1,98 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type scannerFunc func(dest ...any) error
+
+func (f scannerFunc) Scan(dest ...any) error {
+	return f(dest...)
+}
+
+func TestDefaultDuckDBSchema(t *testing.T) {
+	schema := sql.DefaultDuckDBSchema{SubscribeBatchSize: 10}
+
+	assert.Equal(t, `"watermill_orders"`, schema.MessagesTable("orders"))
+	assert.Equal(t, `"watermill_seq_orders"`, schema.MessagesSequence("orders"))
+
+	queries := schema.SchemaInitializingQueries("orders")
+	require.Len(t, queries, 2)
+	assert.Contains(t, queries[0].Query, `CREATE SEQUENCE IF NOT EXISTS "watermill_seq_orders"`)
+	assert.Contains(t, queries[1].Query, `DEFAULT nextval('"watermill_seq_orders"')`)
+
+	msg := message.NewMessage("uuid-1", []byte("payload"))
+	msg.Metadata.Set("key", "value")
+	insert, err := schema.InsertQuery("orders", message.Messages{msg, msg})
+	require.NoError(t, err)
+	assert.Contains(t, insert.Query, `VALUES (?,?,?),(?,?,?)`)
+	require.Len(t, insert.Args, 6)
+	assert.Equal(t, []byte("payload"), insert.Args[1])
+	assert.Equal(t, `{"key":"value"}`, insert.Args[2], "metadata should be passed as a string, as DuckDB doesn't cast BLOB to VARCHAR")
+
+	selectQuery := schema.SelectQuery("orders", "workers", sql.DefaultDuckDBOffsetsAdapter{})
+	assert.Contains(t, selectQuery.Query, `FROM "watermill_orders"`)
+	assert.Contains(t, selectQuery.Query, `LIMIT 10`)
+	assert.Equal(t, []any{"workers"}, selectQuery.Args)
+
+	row, err := schema.UnmarshalMessage(scannerFunc(func(dest ...any) error {
+		*dest[0].(*int64) = 7
+		*dest[1].(*[]byte) = []byte("uuid-1")
+		*dest[2].(*[]byte) = []byte("payload")
+		*dest[3].(*[]byte) = []byte(`{"key":"value"}`)
+		return nil
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), row.Offset)
+	assert.Equal(t, "uuid-1", row.Msg.UUID)
+	assert.Equal(t, "value", row.Msg.Metadata.Get("key"))
+}
+
+// The queries of DefaultDuckDBOffsetsAdapter are also valid in SQLite, so the optimistic concurrency control
+// can be verified without DuckDB.
+func TestDefaultDuckDBOffsetsAdapter_optimisticConsuming(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLite(t)
+	adapter := sql.DefaultDuckDBOffsetsAdapter{}
+
+	assert.True(t, adapter.ConsumedMessageQueryIsConditional())
+
+	exec := func(q sql.Query) int64 {
+		result, err := db.ExecContext(ctx, q.Query, q.Args...)
+		require.NoError(t, err)
+		affected, err := result.RowsAffected()
+		require.NoError(t, err)
+		return affected
+	}
+
+	for _, q := range adapter.SchemaInitializingQueries("orders") {
+		exec(q)
+	}
+	for i := 0; i < 2; i++ {
+		for _, q := range adapter.BeforeSubscribingQueries("orders", "workers") {
+			exec(q)
+		}
+	}
+
+	row := sql.Row{Offset: 1}
+	assert.Equal(t, int64(1), exec(adapter.ConsumedMessageQuery("orders", row, "workers", nil)))
+	assert.Equal(t, int64(0), exec(adapter.ConsumedMessageQuery("orders", row, "workers", nil)),
+		"the message consumed by another subscriber should not be consumed again")
+
+	exec(adapter.AckMessageQuery("orders", row, "workers"))
+
+	next := adapter.NextOffsetQuery("orders", "workers")
+	var offset int64
+	require.NoError(t, db.QueryRowContext(ctx, next.Query, next.Args...).Scan(&offset))
+	assert.Equal(t, int64(1), offset)
+
+	next = adapter.NextOffsetQuery("orders", "reporting")
+	require.NoError(t, db.QueryRowContext(ctx, next.Query, next.Args...).Scan(&offset))
+	assert.Equal(t, int64(0), offset, "offset of an unknown consumer group should be 0")
+}
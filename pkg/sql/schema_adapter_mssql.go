@@ -0,0 +1,143 @@
+package sql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// DefaultMSSQLSchema is a default implementation of SchemaAdapter based on Microsoft SQL Server.
+//
+// SQL Server accepts at most 2100 parameters in a single query, so a single Publish call
+// can't insert more than 700 messages.
+type DefaultMSSQLSchema struct {
+	// GenerateMessagesTableName may be used to override how the messages table name is generated.
+	GenerateMessagesTableName func(topic string) string
+
+	// SubscribeBatchSize is the number of messages to be queried at once.
+	//
+	// Higher value, increases a chance of message re-delivery in case of crash or networking issues.
+	// 1 is the safest value, but it may have a negative impact on performance when consuming a lot of messages.
+	//
+	// Default value is 100.
+	SubscribeBatchSize int
+}
+
+func (s DefaultMSSQLSchema) SchemaInitializingQueries(topic string) []Query {
+	createMessagesTable := `
+		IF OBJECT_ID(N'` + s.MessagesTable(topic) + `', N'U') IS NULL
+		CREATE TABLE ` + s.MessagesTable(topic) + ` (
+			[offset] BIGINT IDENTITY(1,1) NOT NULL PRIMARY KEY,
+			[uuid] VARCHAR(36) NOT NULL,
+			[created_at] DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME(),
+			[payload] VARBINARY(MAX) NULL,
+			[metadata] NVARCHAR(MAX) NULL
+		);
+	`
+
+	return []Query{{Query: createMessagesTable}}
+}
+
+func (s DefaultMSSQLSchema) InsertQuery(topic string, msgs message.Messages) (Query, error) {
+	insertQuery := fmt.Sprintf(
+		`INSERT INTO %s ([uuid], [payload], [metadata]) VALUES %s`,
+		s.MessagesTable(topic),
+		mssqlInsertMarkers(len(msgs)),
+	)
+
+	args, err := mssqlInsertArgs(msgs)
+	if err != nil {
+		return Query{}, err
+	}
+
+	return Query{insertQuery, args}, nil
+}
+
+func mssqlInsertMarkers(count int) string {
+	result := strings.Builder{}
+
+	index := 1
+	for i := 0; i < count; i++ {
+		result.WriteString(fmt.Sprintf("(@p%d,@p%d,@p%d),", index, index+1, index+2))
+		index += 3
+	}
+
+	return strings.TrimRight(result.String(), ",")
+}
+
+// mssqlInsertArgs passes metadata as a string, because SQL Server doesn't convert VARBINARY to NVARCHAR implicitly.
+func mssqlInsertArgs(msgs message.Messages) ([]interface{}, error) {
+	var args []interface{}
+	for _, msg := range msgs {
+		metadata, err := json.Marshal(msg.Metadata)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not marshal metadata into JSON for message %s", msg.UUID)
+		}
+
+		args = append(args, msg.UUID, []byte(msg.Payload), string(metadata))
+	}
+
+	return args, nil
+}
+
+func (s DefaultMSSQLSchema) batchSize() int {
+	if s.SubscribeBatchSize == 0 {
+		return 100
+	}
+
+	return s.SubscribeBatchSize
+}
+
+func (s DefaultMSSQLSchema) SelectQuery(topic string, consumerGroup string, offsetsAdapter OffsetsAdapter) Query {
+	nextOffsetQuery := offsetsAdapter.NextOffsetQuery(topic, consumerGroup)
+
+	// When NextOffsetQuery returns no rows (for example, because the consumer group is locked by another consumer),
+	// the comparison with NULL is never true and no messages are returned.
+	selectQuery := `
+		SELECT TOP (` + fmt.Sprintf("%d", s.batchSize()) + `) [offset], [uuid], [payload], [metadata] FROM ` + s.MessagesTable(topic) + `
+		WHERE
+			[offset] > (` + nextOffsetQuery.Query + `)
+		ORDER BY
+			[offset] ASC`
+
+	return Query{Query: selectQuery, Args: nextOffsetQuery.Args}
+}
+
+func (s DefaultMSSQLSchema) UnmarshalMessage(row Scanner) (Row, error) {
+	r := Row{}
+	err := row.Scan(&r.Offset, &r.UUID, &r.Payload, &r.Metadata)
+	if err != nil {
+		return Row{}, errors.Wrap(err, "could not scan message row")
+	}
+
+	msg := message.NewMessage(string(r.UUID), r.Payload)
+
+	if r.Metadata != nil {
+		err = json.Unmarshal(r.Metadata, &msg.Metadata)
+		if err != nil {
+			return Row{}, errors.Wrap(err, "could not unmarshal metadata as JSON")
+		}
+	}
+
+	r.Msg = msg
+
+	return r, nil
+}
+
+func (s DefaultMSSQLSchema) MessagesTable(topic string) string {
+	if s.GenerateMessagesTableName != nil {
+		return s.GenerateMessagesTableName(topic)
+	}
+	return fmt.Sprintf("[watermill_%s]", topic)
+}
+
+func (s DefaultMSSQLSchema) SubscribeIsolationLevel() sql.IsolationLevel {
+	// READPAST hints are not allowed with serializable isolation level.
+	// Repeatable read is lock-based even when READ_COMMITTED_SNAPSHOT is enabled,
+	// so rows of uncommitted inserts are not skipped.
+	return sql.LevelRepeatableRead
+}
@@ -0,0 +1,46 @@
+package sql
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMSSQLInsertMarkers(t *testing.T) {
+	testCases := []struct {
+		Count          int
+		ExpectedOutput string
+	}{
+		{
+			Count:          0,
+			ExpectedOutput: "",
+		},
+		{
+			Count:          1,
+			ExpectedOutput: "(@p1,@p2,@p3)",
+		},
+		{
+			Count:          3,
+			ExpectedOutput: "(@p1,@p2,@p3),(@p4,@p5,@p6),(@p7,@p8,@p9)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", tc.Count), func(t *testing.T) {
+			output := mssqlInsertMarkers(tc.Count)
+			assert.Equal(t, tc.ExpectedOutput, output)
+		})
+	}
+}
+
+func TestMSSQLInsertArgs(t *testing.T) {
+	msg := message.NewMessage("uuid-1", []byte("payload"))
+	msg.Metadata.Set("key", "value")
+
+	args, err := mssqlInsertArgs(message.Messages{msg})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"uuid-1", []byte("payload"), `{"key":"value"}`}, args,
+		"metadata should be passed as a string, as SQL Server doesn't convert VARBINARY to NVARCHAR")
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/pkg/errors"
@@ -35,7 +36,7 @@ import (
 //		// ...
 //
 // For debugging your custom schema, we recommend to inject logger with trace logging level
-// which will print all SQL queries.
+// which will print all SQL queries. Queries are generated with MySQLDialect.
 type DefaultMySQLSchema struct {
 	// GenerateMessagesTableName may be used to override how the messages table name is generated.
 	GenerateMessagesTableName func(topic string) string
@@ -47,6 +48,26 @@ type DefaultMySQLSchema struct {
 	//
 	// Default value is 100.
 	SubscribeBatchSize int
+
+	// MessagesOrder is the order in which messages of a selected batch are delivered.
+	//
+	// Default value is MessagesOrderOffset.
+	MessagesOrder MessagesOrder
+
+	// Fragments are custom SQL fragments added to the generated queries.
+	Fragments SQLFragments
+
+	// LazyMetadata leaves the metadata of the consumed messages encoded, until it's read with MessageMetadata
+	// (see DefaultSQLiteSchema.LazyMetadata).
+	LazyMetadata bool
+
+	// JSONPayloads stores the payloads of messages with a JSON content type (see ContentTypeMetadataKey)
+	// in the JSON column JSONPayloadColumn, so they can be filtered with JSON path expressions
+	// in SQLFragments.WhereExtra, and other payloads in the binary payload column, so they don't have to be JSON.
+	// It's used by new messages tables, as existing tables have the JSON payload column.
+	//
+	// The JSON column doesn't preserve the formatting of the payload, like whitespace and the order of keys.
+	JSONPayloads bool
 }
 
 func (s DefaultMySQLSchema) SchemaInitializingQueries(topic string) []Query {
@@ -55,7 +76,7 @@ func (s DefaultMySQLSchema) SchemaInitializingQueries(topic string) []Query {
 		"`offset` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,",
 		"`uuid` VARCHAR(36) NOT NULL,",
 		"`created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,",
-		"`payload` JSON DEFAULT NULL,",
+		s.payloadColumnDefinitions(),
 		"`metadata` JSON DEFAULT NULL",
 		");",
 	}, "\n")
@@ -63,14 +84,23 @@ func (s DefaultMySQLSchema) SchemaInitializingQueries(topic string) []Query {
 	return []Query{{Query: createMessagesTable}}
 }
 
+func (s DefaultMySQLSchema) payloadColumnDefinitions() string {
+	if s.JSONPayloads {
+		return "`payload` LONGBLOB DEFAULT NULL,\n`" + JSONPayloadColumn + "` JSON DEFAULT NULL,"
+	}
+
+	return "`payload` JSON DEFAULT NULL,"
+}
+
 func (s DefaultMySQLSchema) InsertQuery(topic string, msgs message.Messages) (Query, error) {
-	insertQuery := fmt.Sprintf(
-		`INSERT INTO %s (uuid, payload, metadata) VALUES %s`,
+	insertQuery := s.Fragments.insertQuery(fmt.Sprintf(
+		`INSERT INTO %s (%s) VALUES %s`,
 		s.MessagesTable(topic),
-		strings.TrimRight(strings.Repeat(`(?,?,?),`, len(msgs)), ","),
-	)
+		s.insertColumns(),
+		dialectValues(s.dialect(), len(msgs), s.insertArgsPerMessage()),
+	))
 
-	args, err := defaultInsertArgs(msgs)
+	args, err := s.insertArgs(msgs)
 	if err != nil {
 		return Query{}, err
 	}
@@ -78,6 +108,57 @@ func (s DefaultMySQLSchema) InsertQuery(topic string, msgs message.Messages) (Qu
 	return Query{insertQuery, args}, nil
 }
 
+func (s DefaultMySQLSchema) InsertWithCreatedAtQuery(topic string, msgs message.Messages, createdAt []time.Time) (Query, error) {
+	insertQuery := s.Fragments.insertQuery(fmt.Sprintf(
+		`INSERT INTO %s (%s, created_at) VALUES %s`,
+		s.MessagesTable(topic),
+		s.insertColumns(),
+		dialectValues(s.dialect(), len(msgs), s.insertArgsPerMessage()+1),
+	))
+
+	args, err := s.insertArgs(msgs)
+	if err != nil {
+		return Query{}, err
+	}
+
+	return Query{insertQuery, withCreatedAtArgs(args, createdAt, func(t time.Time) any {
+		return t.UTC()
+	})}, nil
+}
+
+func (s DefaultMySQLSchema) insertColumns() string {
+	if s.JSONPayloads {
+		return "uuid, payload, " + JSONPayloadColumn + ", metadata"
+	}
+
+	return "uuid, payload, metadata"
+}
+
+func (s DefaultMySQLSchema) insertArgsPerMessage() int {
+	if s.JSONPayloads {
+		return 4
+	}
+
+	return 3
+}
+
+func (s DefaultMySQLSchema) insertArgs(msgs message.Messages) ([]any, error) {
+	if s.JSONPayloads {
+		return jsonPayloadInsertArgs(msgs)
+	}
+
+	return defaultInsertArgs(msgs)
+}
+
+// payloadColumn returns the payload selected as the payload column.
+func (s DefaultMySQLSchema) payloadColumn() string {
+	if s.JSONPayloads {
+		return "COALESCE(payload, CAST(" + JSONPayloadColumn + " AS CHAR)) AS payload"
+	}
+
+	return "payload"
+}
+
 func (s DefaultMySQLSchema) batchSize() int {
 	if s.SubscribeBatchSize == 0 {
 		return 100
@@ -87,19 +168,58 @@ func (s DefaultMySQLSchema) batchSize() int {
 }
 
 func (s DefaultMySQLSchema) SelectQuery(topic string, consumerGroup string, offsetsAdapter OffsetsAdapter) Query {
+	if partitionedAdapter, ok := offsetsAdapter.(PartitionedOffsetsAdapter); ok {
+		return s.selectPartitionQuery(topic, consumerGroup, partitionedAdapter)
+	}
+
 	nextOffsetQuery := offsetsAdapter.NextOffsetQuery(topic, consumerGroup)
 
+	columns := "offset, uuid, " + s.payloadColumn() + ", metadata"
+	if s.MessagesOrder != MessagesOrderOffset {
+		columns += ", created_at"
+	}
+
 	selectQuery := `
-		SELECT offset, uuid, payload, metadata FROM ` + s.MessagesTable(topic) + `
+		SELECT ` + columns + ` FROM ` + s.Fragments.fromTable(s.MessagesTable(topic)) + `
 		WHERE 
 			offset > (` + nextOffsetQuery.Query + `)
+			` + s.Fragments.andWhereExtra() + `
 		ORDER BY 
 			offset ASC
-		LIMIT ` + fmt.Sprintf("%d", s.batchSize())
+		` + s.dialect().LimitClause(s.batchSize())
+	selectQuery = orderedSelectQuery(s.MessagesOrder, []string{"offset", "uuid", "payload", "metadata"}, "offset", "created_at", selectQuery, s.dialect().QuoteIdentifier)
 
 	return Query{Query: selectQuery, Args: nextOffsetQuery.Args}
 }
 
+// selectPartitionQuery selects the messages of the partition locked by the offsets adapter.
+func (s DefaultMySQLSchema) selectPartitionQuery(topic string, consumerGroup string, offsetsAdapter PartitionedOffsetsAdapter) Query {
+	nextPartitionQuery := offsetsAdapter.NextPartitionQuery(topic, consumerGroup, s.MessagesTable(topic))
+
+	columns := "`offset`, uuid, " + s.payloadColumn() + ", metadata"
+	if s.MessagesOrder != MessagesOrderOffset {
+		columns += ", created_at"
+	}
+
+	selectQuery := `
+		SELECT ` + columns + ` FROM ` + s.Fragments.fromTable(s.MessagesTable(topic)) + `
+		JOIN (` + nextPartitionQuery.Query + `) AS watermill_partition
+			ON ` + offsetsAdapter.PartitionExpression("`offset`") + ` = watermill_partition.partition_id
+		WHERE
+			` + "`offset`" + ` > watermill_partition.offset_acked
+			` + s.Fragments.andWhereExtra() + `
+		ORDER BY
+			` + "`offset`" + ` ASC
+		` + s.dialect().LimitClause(s.batchSize())
+	selectQuery = orderedSelectQuery(s.MessagesOrder, []string{"offset", "uuid", "payload", "metadata"}, "offset", "created_at", selectQuery, s.dialect().QuoteIdentifier)
+
+	return Query{Query: selectQuery, Args: nextPartitionQuery.Args}
+}
+
+func (s DefaultMySQLSchema) ReordersMessages() bool {
+	return s.MessagesOrder != MessagesOrderOffset
+}
+
 func (s DefaultMySQLSchema) UnmarshalMessage(row Scanner) (Row, error) {
 	r := Row{}
 	err := row.Scan(&r.Offset, &r.UUID, &r.Payload, &r.Metadata)
@@ -109,7 +229,7 @@ func (s DefaultMySQLSchema) UnmarshalMessage(row Scanner) (Row, error) {
 
 	msg := message.NewMessage(string(r.UUID), r.Payload)
 
-	if r.Metadata != nil {
+	if r.Metadata != nil && !s.LazyMetadata {
 		err = json.Unmarshal(r.Metadata, &msg.Metadata)
 		if err != nil {
 			return Row{}, errors.Wrap(err, "could not unmarshal metadata as JSON")
@@ -121,14 +241,21 @@ func (s DefaultMySQLSchema) UnmarshalMessage(row Scanner) (Row, error) {
 	return r, nil
 }
 
+func (s DefaultMySQLSchema) decodesMetadataLazily() bool {
+	return s.LazyMetadata
+}
+
 func (s DefaultMySQLSchema) MessagesTable(topic string) string {
 	if s.GenerateMessagesTableName != nil {
 		return s.GenerateMessagesTableName(topic)
 	}
-	return fmt.Sprintf("`watermill_%s`", topic)
+	return s.dialect().QuoteIdentifier("watermill_" + topic)
 }
 
 func (s DefaultMySQLSchema) SubscribeIsolationLevel() sql.IsolationLevel {
-	// MySQL requires serializable isolation level for not losing messages.
-	return sql.LevelSerializable
+	return s.dialect().SubscribeIsolationLevel()
+}
+
+func (s DefaultMySQLSchema) dialect() MySQLDialect {
+	return MySQLDialect{}
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/pkg/errors"
@@ -22,6 +23,30 @@ type DefaultPostgreSQLSchema struct {
 	//
 	// Default value is 100.
 	SubscribeBatchSize int
+
+	// Fragments are custom SQL fragments added to the generated queries.
+	Fragments SQLFragments
+
+	// BusinessKeys are the metadata keys indexed by SchemaInitializingQueries, so messages can be looked up
+	// with Find. Indexes are created only if they don't exist, so changing Unique of a key requires
+	// dropping its index.
+	BusinessKeys []BusinessKey
+
+	// Indexes are the additional indexes created on the messages table.
+	Indexes MessagesIndexes
+
+	// LazyMetadata leaves the metadata of the consumed messages encoded, until it's read with MessageMetadata
+	// (see DefaultSQLiteSchema.LazyMetadata).
+	LazyMetadata bool
+
+	// JSONPayloads stores the payloads of messages with a JSON content type (see ContentTypeMetadataKey)
+	// in the jsonb column JSONPayloadColumn, so they can be filtered with JSON path expressions
+	// in SQLFragments.WhereExtra, and other payloads in the bytea payload column, so they don't have to be JSON.
+	// It's used by new messages tables, as existing tables have the json payload column.
+	//
+	// jsonb doesn't preserve the formatting of the payload, like whitespace and the order of keys.
+	// The JSON payload column is not included in the covering index (see MessagesIndexes.Covering).
+	JSONPayloads bool
 }
 
 func (s DefaultPostgreSQLSchema) SchemaInitializingQueries(topic string) []Query {
@@ -30,24 +55,42 @@ func (s DefaultPostgreSQLSchema) SchemaInitializingQueries(topic string) []Query
 			"offset" SERIAL,
 			"uuid" VARCHAR(36) NOT NULL,
 			"created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			"payload" JSON DEFAULT NULL,
+			` + s.payloadColumnDefinitions() + `
 			"metadata" JSON DEFAULT NULL,
 			"transaction_id" xid8 NOT NULL,
 			PRIMARY KEY ("transaction_id", "offset")
 		);
 	`
 
-	return []Query{{Query: createMessagesTable}}
+	var where string
+	if s.Fragments.WhereExtra != "" {
+		where = "(" + s.Fragments.WhereExtra + ")"
+	}
+
+	queries := []Query{{Query: createMessagesTable}}
+	queries = append(queries, s.Indexes.postgreSQLCoveringIndexQueries(s.MessagesTable(topic), `"transaction_id", "offset"`, where)...)
+	queries = append(queries, s.Indexes.createdAtIndexQueries(s.MessagesTable(topic), postgreSQLMaxIdentifierLength)...)
+	return append(queries, businessKeyIndexQueries(s.BusinessKeys, s.MessagesTable(topic), postgreSQLMaxIdentifierLength, postgreSQLMetadataExpression)...)
+}
+
+func (s DefaultPostgreSQLSchema) payloadColumnDefinitions() string {
+	if s.JSONPayloads {
+		return `"payload" BYTEA DEFAULT NULL,
+			"` + JSONPayloadColumn + `" JSONB DEFAULT NULL,`
+	}
+
+	return `"payload" JSON DEFAULT NULL,`
 }
 
 func (s DefaultPostgreSQLSchema) InsertQuery(topic string, msgs message.Messages) (Query, error) {
-	insertQuery := fmt.Sprintf(
-		`INSERT INTO %s (uuid, payload, metadata, transaction_id) VALUES %s`,
+	insertQuery := s.Fragments.insertQuery(fmt.Sprintf(
+		`INSERT INTO %s (%s, transaction_id) VALUES %s`,
 		s.MessagesTable(topic),
-		defaultInsertMarkers(len(msgs)),
-	)
+		s.insertColumns(),
+		postgreSQLTransactionInsertMarkers(len(msgs), s.insertArgsPerMessage()),
+	))
 
-	args, err := defaultInsertArgs(msgs)
+	args, err := s.insertArgs(msgs)
 	if err != nil {
 		return Query{}, err
 	}
@@ -55,16 +98,74 @@ func (s DefaultPostgreSQLSchema) InsertQuery(topic string, msgs message.Messages
 	return Query{insertQuery, args}, nil
 }
 
+func (s DefaultPostgreSQLSchema) InsertWithCreatedAtQuery(topic string, msgs message.Messages, createdAt []time.Time) (Query, error) {
+	insertQuery := s.Fragments.insertQuery(fmt.Sprintf(
+		`INSERT INTO %s (%s, created_at, transaction_id) VALUES %s`,
+		s.MessagesTable(topic),
+		s.insertColumns(),
+		postgreSQLTransactionInsertMarkers(len(msgs), s.insertArgsPerMessage()+1),
+	))
+
+	args, err := s.insertArgs(msgs)
+	if err != nil {
+		return Query{}, err
+	}
+
+	return Query{insertQuery, withCreatedAtArgs(args, createdAt, func(t time.Time) any {
+		return t.UTC()
+	})}, nil
+}
+
+func (s DefaultPostgreSQLSchema) insertColumns() string {
+	if s.JSONPayloads {
+		return "uuid, payload, " + JSONPayloadColumn + ", metadata"
+	}
+
+	return "uuid, payload, metadata"
+}
+
+func (s DefaultPostgreSQLSchema) insertArgsPerMessage() int {
+	if s.JSONPayloads {
+		return 4
+	}
+
+	return 3
+}
+
+func (s DefaultPostgreSQLSchema) insertArgs(msgs message.Messages) ([]any, error) {
+	if s.JSONPayloads {
+		return jsonPayloadInsertArgs(msgs)
+	}
+
+	return defaultInsertArgs(msgs)
+}
+
+// payloadColumn returns the payload selected as the payload column.
+func (s DefaultPostgreSQLSchema) payloadColumn() string {
+	if s.JSONPayloads {
+		return `COALESCE(payload, convert_to(` + JSONPayloadColumn + `::text, 'UTF8')) AS payload`
+	}
+
+	return "payload"
+}
+
 func defaultInsertMarkers(count int) string {
-	result := strings.Builder{}
+	return postgreSQLTransactionInsertMarkers(count, 3)
+}
 
-	index := 1
-	for i := 0; i < count; i++ {
-		result.WriteString(fmt.Sprintf("($%d,$%d,$%d,pg_current_xact_id()),", index, index+1, index+2))
-		index += 3
+// postgreSQLTransactionInsertMarkers returns the values of count messages with argsPerMessage arguments each,
+// followed by the current transaction ID.
+func postgreSQLTransactionInsertMarkers(count int, argsPerMessage int) string {
+	markers := make([]string, count)
+	for i := range markers {
+		placeholders := make([]string, argsPerMessage)
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%d", i*argsPerMessage+j+1)
+		}
+		markers[i] = "(" + strings.Join(placeholders, ",") + ",pg_current_xact_id())"
 	}
 
-	return strings.TrimRight(result.String(), ",")
+	return strings.Join(markers, ",")
 }
 
 func (s DefaultPostgreSQLSchema) batchSize() int {
@@ -84,7 +185,7 @@ func (s DefaultPostgreSQLSchema) SelectQuery(topic string, consumerGroup string,
 			` + nextOffsetQuery.Query + `
 		)
 
-		SELECT "offset", transaction_id, uuid, payload, metadata FROM ` + s.MessagesTable(topic) + `
+		SELECT "offset", transaction_id, uuid, ` + s.payloadColumn() + `, metadata FROM ` + s.Fragments.fromTable(s.MessagesTable(topic)) + `
 
 		WHERE 
 		(
@@ -98,6 +199,7 @@ func (s DefaultPostgreSQLSchema) SelectQuery(topic string, consumerGroup string,
 		)
 		AND 
 			transaction_id < pg_snapshot_xmin(pg_current_snapshot())
+			` + s.Fragments.andWhereExtra() + `
 		ORDER BY
 			transaction_id ASC,
 			"offset" ASC
@@ -117,7 +219,7 @@ func (s DefaultPostgreSQLSchema) UnmarshalMessage(row Scanner) (Row, error) {
 
 	msg := message.NewMessage(string(r.UUID), r.Payload)
 
-	if r.Metadata != nil {
+	if r.Metadata != nil && !s.LazyMetadata {
 		err = json.Unmarshal(r.Metadata, &msg.Metadata)
 		if err != nil {
 			return Row{}, errors.Wrap(err, "could not unmarshal metadata as JSON")
@@ -132,6 +234,10 @@ func (s DefaultPostgreSQLSchema) UnmarshalMessage(row Scanner) (Row, error) {
 	return r, nil
 }
 
+func (s DefaultPostgreSQLSchema) decodesMetadataLazily() bool {
+	return s.LazyMetadata
+}
+
 func (s DefaultPostgreSQLSchema) MessagesTable(topic string) string {
 	if s.GenerateMessagesTableName != nil {
 		return s.GenerateMessagesTableName(topic)
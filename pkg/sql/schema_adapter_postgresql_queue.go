@@ -0,0 +1,143 @@
+package sql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	queueStatusPending = "pending"
+	queueStatusAcked   = "acked"
+)
+
+// PostgreSQLQueueSchema is an implementation of SchemaAdapter based on PostgreSQL,
+// which keeps the consumption state in the messages table itself (status and consumer_group columns).
+// It should be used together with PostgreSQLQueueOffsetsAdapter, and no offsets table is created.
+//
+// PostgreSQLQueueSchema is meant for work-queue deployments with a single consumer group.
+// Subscribers of the topic share the messages: each subscriber locks the pending rows it selects,
+// and skips the rows locked by other subscribers, so messages are not delivered in a guaranteed order.
+type PostgreSQLQueueSchema struct {
+	// GenerateMessagesTableName may be used to override how the messages table name is generated.
+	// PostgreSQLQueueOffsetsAdapter must generate the same name.
+	GenerateMessagesTableName func(topic string) string
+
+	// SubscribeBatchSize is the number of messages to be queried at once.
+	//
+	// Higher value, increases a chance of message re-delivery in case of crash or networking issues.
+	// 1 is the safest value, but it may have a negative impact on performance when consuming a lot of messages.
+	//
+	// Default value is 100.
+	SubscribeBatchSize int
+
+	// Indexes are the additional indexes created on the messages table.
+	Indexes MessagesIndexes
+}
+
+func (s PostgreSQLQueueSchema) SchemaInitializingQueries(topic string) []Query {
+	createMessagesTable := `
+		CREATE TABLE IF NOT EXISTS ` + s.MessagesTable(topic) + ` (
+			"offset" BIGSERIAL,
+			"uuid" VARCHAR(36) NOT NULL,
+			"created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			"payload" JSON DEFAULT NULL,
+			"metadata" JSON DEFAULT NULL,
+			"status" VARCHAR(16) NOT NULL DEFAULT '` + queueStatusPending + `',
+			"consumer_group" VARCHAR(255) DEFAULT NULL,
+			PRIMARY KEY ("offset")
+		);
+	`
+
+	queries := []Query{{Query: createMessagesTable}}
+	queries = append(queries, s.Indexes.postgreSQLCoveringIndexQueries(s.MessagesTable(topic), `"offset"`, `"status" = '`+queueStatusPending+`'`)...)
+	return append(queries, s.Indexes.createdAtIndexQueries(s.MessagesTable(topic), postgreSQLMaxIdentifierLength)...)
+}
+
+func (s PostgreSQLQueueSchema) InsertQuery(topic string, msgs message.Messages) (Query, error) {
+	insertQuery := fmt.Sprintf(
+		`INSERT INTO %s (uuid, payload, metadata) VALUES %s`,
+		s.MessagesTable(topic),
+		postgreSQLInsertMarkers(len(msgs)),
+	)
+
+	args, err := defaultInsertArgs(msgs)
+	if err != nil {
+		return Query{}, err
+	}
+
+	return Query{insertQuery, args}, nil
+}
+
+func postgreSQLInsertMarkers(count int) string {
+	result := strings.Builder{}
+
+	index := 1
+	for i := 0; i < count; i++ {
+		result.WriteString(fmt.Sprintf("($%d,$%d,$%d),", index, index+1, index+2))
+		index += 3
+	}
+
+	return strings.TrimRight(result.String(), ",")
+}
+
+func (s PostgreSQLQueueSchema) batchSize() int {
+	if s.SubscribeBatchSize == 0 {
+		return 100
+	}
+
+	return s.SubscribeBatchSize
+}
+
+func (s PostgreSQLQueueSchema) SelectQuery(topic string, consumerGroup string, offsetsAdapter OffsetsAdapter) Query {
+	// The consumption state is stored in the messages table, so the offsets adapter is not queried.
+	// Rows locked by other subscribers are skipped instead of waiting for their transactions to finish.
+	selectQuery := `
+		SELECT "offset", uuid, payload, metadata FROM ` + s.MessagesTable(topic) + `
+		WHERE
+			status = $1
+		ORDER BY
+			"offset" ASC
+		LIMIT ` + fmt.Sprintf("%d", s.batchSize()) + `
+		FOR UPDATE SKIP LOCKED`
+
+	return Query{selectQuery, []any{queueStatusPending}}
+}
+
+func (s PostgreSQLQueueSchema) UnmarshalMessage(row Scanner) (Row, error) {
+	r := Row{}
+	err := row.Scan(&r.Offset, &r.UUID, &r.Payload, &r.Metadata)
+	if err != nil {
+		return Row{}, errors.Wrap(err, "could not scan message row")
+	}
+
+	msg := message.NewMessage(string(r.UUID), r.Payload)
+
+	if r.Metadata != nil {
+		err = json.Unmarshal(r.Metadata, &msg.Metadata)
+		if err != nil {
+			return Row{}, errors.Wrap(err, "could not unmarshal metadata as JSON")
+		}
+	}
+
+	r.Msg = msg
+
+	return r, nil
+}
+
+func (s PostgreSQLQueueSchema) MessagesTable(topic string) string {
+	if s.GenerateMessagesTableName != nil {
+		return s.GenerateMessagesTableName(topic)
+	}
+	return fmt.Sprintf(`"watermill_%s"`, topic)
+}
+
+func (s PostgreSQLQueueSchema) SubscribeIsolationLevel() sql.IsolationLevel {
+	// SKIP LOCKED needs Read Committed: in Repeatable Read, rows updated by concurrent subscribers
+	// would fail the transaction with a serialization error.
+	return sql.LevelReadCommitted
+}
@@ -0,0 +1,428 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// SegmentManagerConfig configures SegmentManager.
+type SegmentManagerConfig struct {
+	// Database is the database where segments are stored. It's required.
+	// Segments use the same tables as the partitions of TimePartitionedSchema.
+	Database TimePartitionedDatabase
+
+	// SegmentSize is the number of messages after which a segment is sealed by Maintain,
+	// and the following messages are written to a new segment. Segments may be slightly bigger,
+	// as messages are written to the active segment until Maintain seals it.
+	//
+	// Default value is 1000000.
+	SegmentSize int64
+
+	// RegistryTableName is the name of the table storing the segments of all topics.
+	//
+	// Default value is watermill_segments.
+	RegistryTableName string
+
+	// GenerateSegmentTableName may be used to override how the segment table name is generated.
+	// The returned name should not be quoted.
+	GenerateSegmentTableName func(topic string, segment int64) string
+
+	// SubscribeBatchSize is the number of messages to be queried at once.
+	//
+	// Default value is 100.
+	SubscribeBatchSize int
+}
+
+func (c *SegmentManagerConfig) setDefaults() {
+	if c.SegmentSize == 0 {
+		c.SegmentSize = 1000000
+	}
+	if c.RegistryTableName == "" {
+		c.RegistryTableName = "watermill_segments"
+	}
+	if c.SubscribeBatchSize == 0 {
+		c.SubscribeBatchSize = 100
+	}
+}
+
+func (c SegmentManagerConfig) validate() error {
+	if c.Database != TimePartitionedMySQL && c.Database != TimePartitionedSQLite {
+		return errors.Errorf("unknown segmented database: %d", c.Database)
+	}
+	if c.SegmentSize < 0 {
+		return errors.New("segment size must be positive")
+	}
+	if c.SegmentSize >= 1<<partitionOffsetBits {
+		return errors.Errorf("segment size must be lower than %d", int64(1)<<partitionOffsetBits)
+	}
+
+	return nil
+}
+
+// Segment is a table storing a range of the messages of a topic (see SegmentManager).
+type Segment struct {
+	Number int64
+	Table  string
+
+	// Sealed segments don't receive new messages.
+	Sealed bool
+}
+
+// SegmentManager manages the segments of topics stored with SegmentedSchema: an append-only log of fixed-size
+// segments stored in separate tables (for example, watermill_topic_seg_0). Messages are written to the active
+// segment, until it's sealed, when it's full.
+//
+// Retention drops whole segments (see DropSegments), instead of executing huge DELETE statements,
+// and the indexes of sealed segments don't change anymore, so very high-volume topics don't suffer from index bloat.
+// Every segment has its own range of offsets, so subscribers read only the few segments after their offsets.
+//
+// The segments are kept in memory, so Maintain must be executed before publishing or subscribing,
+// and then periodically (for example, every minute) by every process, to seal full segments and to observe
+// the segments created by other processes.
+type SegmentManager struct {
+	db     QueryExecutor
+	config SegmentManagerConfig
+
+	segments map[string][]Segment
+	lock     sync.RWMutex
+}
+
+func NewSegmentManager(db QueryExecutor, config SegmentManagerConfig) (*SegmentManager, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	return &SegmentManager{
+		db:       db,
+		config:   config,
+		segments: map[string][]Segment{},
+	}, nil
+}
+
+// Schema returns the SchemaAdapter storing the messages in the segments of the manager.
+func (m *SegmentManager) Schema() SegmentedSchema {
+	return SegmentedSchema{manager: m}
+}
+
+// Segments returns the segments of the topic, loaded by the last Maintain, from the oldest one.
+func (m *SegmentManager) Segments(topic string) []Segment {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return append([]Segment(nil), m.segments[topic]...)
+}
+
+// Maintain creates the first segment of the topic, seals the active segment if it's full and creates the next one,
+// and loads the segments of the topic.
+//
+// The queries can't be executed within a transaction, as creating tables implicitly commits it in MySQL.
+func (m *SegmentManager) Maintain(ctx context.Context, topic string) error {
+	if err := validateTopic(m.Schema(), topic); err != nil {
+		return err
+	}
+
+	segments, err := m.loadSegments(ctx, topic)
+	if err != nil {
+		return err
+	}
+
+	if err := m.rollSegment(ctx, topic, segments); err != nil {
+		return err
+	}
+
+	segments, err = m.loadSegments(ctx, topic)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.segments[topic] = segments
+
+	return nil
+}
+
+// rollSegment creates the first segment of the topic, or seals the active segment if it's full
+// and creates the next one.
+func (m *SegmentManager) rollSegment(ctx context.Context, topic string, segments []Segment) error {
+	if len(segments) == 0 {
+		return m.createSegment(ctx, topic, 0)
+	}
+
+	active := segments[len(segments)-1]
+	if active.Sealed {
+		return m.createSegment(ctx, topic, active.Number+1)
+	}
+
+	full, err := m.segmentFull(ctx, active)
+	if err != nil || !full {
+		return err
+	}
+
+	// The next segment is created before sealing the active one, so there is always an active segment.
+	if err := m.createSegment(ctx, topic, active.Number+1); err != nil {
+		return err
+	}
+
+	return m.sealSegment(ctx, topic, active.Number)
+}
+
+// DropSegments drops the oldest sealed segments of the topic, keeping the retained most recent segments
+// (including the active one). Messages from dropped segments are never delivered, even if they were not consumed yet.
+// It returns the dropped segments.
+func (m *SegmentManager) DropSegments(ctx context.Context, topic string, retained int) ([]Segment, error) {
+	if retained < 1 {
+		return nil, errors.New("at least one segment must be retained")
+	}
+
+	segments, err := m.loadSegments(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	var dropped []Segment
+	for i, segment := range segments {
+		if i >= len(segments)-retained || !segment.Sealed {
+			break
+		}
+
+		if _, err := m.db.ExecContext(ctx, `DROP TABLE IF EXISTS `+m.quote(segment.Table)); err != nil {
+			return dropped, errors.Wrapf(err, "could not drop segment %d", segment.Number)
+		}
+
+		deleteQuery := `DELETE FROM ` + m.quote(m.config.RegistryTableName) + ` WHERE ` +
+			m.quote("topic") + ` = ? AND ` + m.quote("segment") + ` = ?`
+		if _, err := m.db.ExecContext(ctx, deleteQuery, topic, segment.Number); err != nil {
+			return dropped, errors.Wrapf(err, "could not unregister segment %d", segment.Number)
+		}
+
+		dropped = append(dropped, segment)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.segments[topic] = segments[len(dropped):]
+
+	return dropped, nil
+}
+
+func (m *SegmentManager) registryQueries() []Query {
+	if m.config.Database == TimePartitionedMySQL {
+		return []Query{{Query: strings.Join([]string{
+			"CREATE TABLE IF NOT EXISTS " + m.quote(m.config.RegistryTableName) + " (",
+			"`topic` VARCHAR(255) NOT NULL,",
+			"`segment` BIGINT NOT NULL,",
+			"`sealed` BOOLEAN NOT NULL DEFAULT FALSE,",
+			"PRIMARY KEY (`topic`, `segment`)",
+			");",
+		}, "\n")}}
+	}
+
+	return []Query{{Query: `
+		CREATE TABLE IF NOT EXISTS ` + m.quote(m.config.RegistryTableName) + ` (
+			"topic" TEXT NOT NULL,
+			"segment" INTEGER NOT NULL,
+			"sealed" INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY ("topic", "segment")
+		);
+	`}}
+}
+
+// createSegmentQueries returns the queries creating the segment's table and registering it.
+// The auto-increment of every segment starts at the segment's base offset, so offsets of newer segments are greater.
+func (m *SegmentManager) createSegmentQueries(topic string, segment int64) []Query {
+	queries := m.partitions().createPartitionQueries(m.segmentTableName(topic, segment), segment)
+
+	insertIgnore := `INSERT OR IGNORE INTO `
+	if m.config.Database == TimePartitionedMySQL {
+		insertIgnore = `INSERT IGNORE INTO `
+	}
+
+	return append(queries, Query{
+		Query: insertIgnore + m.quote(m.config.RegistryTableName) + ` (` +
+			m.quote("topic") + `, ` + m.quote("segment") + `) VALUES (?, ?)`,
+		Args: []any{topic, segment},
+	})
+}
+
+func (m *SegmentManager) createSegment(ctx context.Context, topic string, segment int64) error {
+	for _, q := range m.createSegmentQueries(topic, segment) {
+		if _, err := m.db.ExecContext(ctx, q.Query, q.Args...); err != nil {
+			return errors.Wrapf(err, "could not create segment %d", segment)
+		}
+	}
+
+	return nil
+}
+
+func (m *SegmentManager) sealSegment(ctx context.Context, topic string, segment int64) error {
+	sealQuery := `UPDATE ` + m.quote(m.config.RegistryTableName) + ` SET ` + m.quote("sealed") + ` = 1 WHERE ` +
+		m.quote("topic") + ` = ? AND ` + m.quote("segment") + ` = ?`
+	if _, err := m.db.ExecContext(ctx, sealQuery, topic, segment); err != nil {
+		return errors.Wrapf(err, "could not seal segment %d", segment)
+	}
+
+	return nil
+}
+
+// segmentFull returns true if the segment's last offset reached SegmentSize messages.
+// Offsets are assigned by auto-increment, so it doesn't need to count the messages.
+func (m *SegmentManager) segmentFull(ctx context.Context, segment Segment) (bool, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT MAX(`+m.quote("offset")+`) FROM `+m.quote(segment.Table))
+	if err != nil {
+		return false, errors.Wrapf(err, "could not query last offset of segment %d", segment.Number)
+	}
+	defer rows.Close()
+
+	var lastOffset sql.NullInt64
+	if rows.Next() {
+		if err := rows.Scan(&lastOffset); err != nil {
+			return false, errors.Wrapf(err, "could not scan last offset of segment %d", segment.Number)
+		}
+	}
+
+	return lastOffset.Valid && lastOffset.Int64-segment.Number<<partitionOffsetBits >= m.config.SegmentSize, nil
+}
+
+func (m *SegmentManager) loadSegments(ctx context.Context, topic string) ([]Segment, error) {
+	for _, q := range m.registryQueries() {
+		if _, err := m.db.ExecContext(ctx, q.Query, q.Args...); err != nil {
+			return nil, errors.Wrap(err, "could not create segments registry")
+		}
+	}
+
+	selectQuery := `SELECT ` + m.quote("segment") + `, ` + m.quote("sealed") + ` FROM ` +
+		m.quote(m.config.RegistryTableName) + ` WHERE ` + m.quote("topic") + ` = ? ORDER BY ` + m.quote("segment")
+	rows, err := m.db.QueryContext(ctx, selectQuery, topic)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query segments")
+	}
+	defer rows.Close()
+
+	var segments []Segment
+	for rows.Next() {
+		var segment Segment
+		if err := rows.Scan(&segment.Number, &segment.Sealed); err != nil {
+			return nil, errors.Wrap(err, "could not scan segment")
+		}
+		segment.Table = m.segmentTableName(topic, segment.Number)
+		segments = append(segments, segment)
+	}
+
+	return segments, errors.Wrap(rows.Err(), "could not query segments")
+}
+
+func (m *SegmentManager) segmentTableName(topic string, segment int64) string {
+	if m.config.GenerateSegmentTableName != nil {
+		return m.config.GenerateSegmentTableName(topic, segment)
+	}
+
+	return fmt.Sprintf("watermill_%s_seg_%d", topic, segment)
+}
+
+// partitions returns TimePartitionedSchema of the database, which creates the tables of segments,
+// as they have the same structure as partitions.
+func (m *SegmentManager) partitions() TimePartitionedSchema {
+	return TimePartitionedSchema{
+		Database:           m.config.Database,
+		SubscribeBatchSize: m.config.SubscribeBatchSize,
+	}
+}
+
+func (m *SegmentManager) quote(name string) string {
+	return m.partitions().quote(name)
+}
+
+// SegmentedSchema is an implementation of SchemaAdapter which stores messages in the segments
+// of SegmentManager. It's returned by SegmentManager.Schema.
+type SegmentedSchema struct {
+	manager *SegmentManager
+}
+
+// SchemaInitializingQueries returns the queries creating the segments registry and the first segment.
+// The following segments are created by SegmentManager.Maintain.
+func (s SegmentedSchema) SchemaInitializingQueries(topic string) []Query {
+	return append(s.manager.registryQueries(), s.manager.createSegmentQueries(topic, 0)...)
+}
+
+func (s SegmentedSchema) InsertQuery(topic string, msgs message.Messages) (Query, error) {
+	segments := s.manager.Segments(topic)
+	if len(segments) == 0 {
+		return Query{}, errors.Errorf("segments of topic %s are not loaded, SegmentManager.Maintain must be executed first", topic)
+	}
+
+	active := segments[len(segments)-1]
+	insertQuery := fmt.Sprintf(
+		`INSERT INTO %s (uuid, payload, metadata) VALUES %s`,
+		s.manager.quote(active.Table),
+		strings.TrimRight(strings.Repeat(`(?,?,?),`, len(msgs)), ","),
+	)
+
+	var args []any
+	var err error
+	if s.manager.config.Database == TimePartitionedSQLite {
+		args, err = stringMetadataInsertArgs(msgs)
+	} else {
+		args, err = defaultInsertArgs(msgs)
+	}
+	if err != nil {
+		return Query{}, err
+	}
+
+	return Query{insertQuery, args}, nil
+}
+
+// SelectQuery unions the segments of the topic. The offset condition is repeated in every segment,
+// so segments with older messages are skipped by their primary key indexes.
+// If the segments were not loaded yet, only the first segment is queried.
+func (s SegmentedSchema) SelectQuery(topic string, consumerGroup string, offsetsAdapter OffsetsAdapter) Query {
+	nextOffsetQuery := offsetsAdapter.NextOffsetQuery(topic, consumerGroup)
+
+	quote := s.manager.quote
+	columns := quote("offset") + ", " + quote("uuid") + ", " + quote("payload") + ", " + quote("metadata")
+
+	tables := []string{s.manager.segmentTableName(topic, 0)}
+	if segments := s.manager.Segments(topic); len(segments) > 0 {
+		tables = tables[:0]
+		for _, segment := range segments {
+			tables = append(tables, segment.Table)
+		}
+	}
+
+	var selects []string
+	var args []any
+	for _, table := range tables {
+		selects = append(selects, `SELECT `+columns+` FROM `+quote(table)+`
+			WHERE `+quote("offset")+` > (`+nextOffsetQuery.Query+`)`)
+		args = append(args, nextOffsetQuery.Args...)
+	}
+
+	selectQuery := `
+		SELECT ` + columns + ` FROM (
+			` + strings.Join(selects, "\nUNION ALL\n") + `
+		) AS messages
+		ORDER BY
+			` + quote("offset") + ` ASC
+		LIMIT ` + fmt.Sprintf("%d", s.manager.config.SubscribeBatchSize)
+
+	return Query{selectQuery, args}
+}
+
+func (s SegmentedSchema) UnmarshalMessage(row Scanner) (Row, error) {
+	return s.manager.partitions().UnmarshalMessage(row)
+}
+
+func (s SegmentedSchema) SubscribeIsolationLevel() sql.IsolationLevel {
+	return s.manager.partitions().SubscribeIsolationLevel()
+}
@@ -0,0 +1,92 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentManager(t *testing.T) {
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topic := "segmented_" + watermill.NewShortUUID()
+
+	manager, err := sql.NewSegmentManager(db, sql.SegmentManagerConfig{
+		Database:    sql.TimePartitionedSQLite,
+		SegmentSize: 3,
+	})
+	require.NoError(t, err)
+
+	publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{SchemaAdapter: manager.Schema()}, logger)
+	require.NoError(t, err)
+
+	err = publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), nil))
+	assert.ErrorContains(t, err, "SegmentManager.Maintain must be executed first")
+
+	require.NoError(t, manager.Maintain(ctx, topic))
+
+	var published []string
+	publish := func(count int) {
+		for i := 0; i < count; i++ {
+			msg := message.NewMessage(watermill.NewUUID(), nil)
+			require.NoError(t, publisher.Publish(topic, msg))
+			published = append(published, msg.UUID)
+		}
+	}
+
+	publish(3)
+	require.NoError(t, manager.Maintain(ctx, topic))
+	publish(2)
+	require.NoError(t, manager.Maintain(ctx, topic))
+
+	assert.Equal(t, []sql.Segment{
+		{Number: 0, Table: "watermill_" + topic + "_seg_0", Sealed: true},
+		{Number: 1, Table: "watermill_" + topic + "_seg_1"},
+	}, manager.Segments(topic))
+
+	consume := func(consumerGroup string, count int) []string {
+		subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+			ConsumerGroup:    consumerGroup,
+			SchemaAdapter:    manager.Schema(),
+			OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+			InitializeSchema: true,
+			PollInterval:     time.Millisecond * 10,
+		}, logger)
+		require.NoError(t, err)
+		defer subscriber.Close()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		messages, err := subscriber.Subscribe(ctx, topic)
+		require.NoError(t, err)
+
+		var consumed []string
+		for i := 0; i < count; i++ {
+			select {
+			case msg := <-messages:
+				consumed = append(consumed, msg.UUID)
+				msg.Ack()
+			case <-time.After(time.Second * 5):
+				t.Fatal("timeout waiting for messages")
+			}
+		}
+
+		return consumed
+	}
+
+	assert.Equal(t, published, consume("before_drop", 5))
+
+	dropped, err := manager.DropSegments(ctx, topic, 1)
+	require.NoError(t, err)
+	require.Len(t, dropped, 1)
+	assert.EqualValues(t, 0, dropped[0].Number)
+
+	assert.Equal(t, published[3:], consume("after_drop", 2))
+}
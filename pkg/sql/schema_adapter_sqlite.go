@@ -0,0 +1,313 @@
+package sql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// DefaultSQLiteSchema is a default implementation of SchemaAdapter based on SQLite.
+//
+// It can be used with SQLite-compatible databases like Cloudflare D1 (see DefaultD1OffsetsAdapter).
+// Keep in mind that D1 allows at most 100 bound parameters per query, so a single Publish call
+// can't insert more than 33 messages there.
+//
+// Queries are generated with SQLiteDialect.
+type DefaultSQLiteSchema struct {
+	// GenerateMessagesTableName may be used to override how the messages table name is generated.
+	GenerateMessagesTableName func(topic string) string
+
+	// SubscribeBatchSize is the number of messages to be queried at once.
+	//
+	// Higher value, increases a chance of message re-delivery in case of crash or networking issues.
+	// 1 is the safest value, but it may have a negative impact on performance when consuming a lot of messages.
+	//
+	// Default value is 100.
+	SubscribeBatchSize int
+
+	// MessagesOrder is the order in which messages of a selected batch are delivered.
+	//
+	// Default value is MessagesOrderOffset.
+	MessagesOrder MessagesOrder
+
+	// Pagination is how the batches are selected.
+	//
+	// Default value is PaginationLimit.
+	Pagination Pagination
+
+	// Fragments are custom SQL fragments added to the generated queries.
+	Fragments SQLFragments
+
+	// BusinessKeys are the metadata keys indexed by SchemaInitializingQueries, so messages can be looked up
+	// with Find. Indexes are created only if they don't exist, so changing Unique of a key requires
+	// dropping its index.
+	BusinessKeys []BusinessKey
+
+	// Indexes are the additional indexes created on the messages table.
+	Indexes MessagesIndexes
+
+	// CreatedAtPrecision is the format of the created_at values generated for new messages tables,
+	// and of the values inserted by Loader.
+	//
+	// Default value is CreatedAtSeconds.
+	CreatedAtPrecision CreatedAtPrecision
+
+	// SelectCreatedAt selects the created_at column of the messages, so it's parsed into Row.CreatedAt.
+	SelectCreatedAt bool
+
+	// LazyMetadata leaves the metadata of the consumed messages encoded, so it's unmarshaled only by the handlers
+	// which read it with MessageMetadata. It reduces allocations of consumers which rarely read the metadata.
+	// msg.Metadata is empty until MessageMetadata is called.
+	//
+	// Subscriber features using the metadata (GroupBatches, Deduplicator and Transforms) can't be used with it.
+	LazyMetadata bool
+
+	// PooledBuffers copies the UUIDs, payloads and metadata of the consumed messages into buffers reused
+	// after the messages are acked, reducing allocations of consumers handling many messages per second.
+	// It's used only with BeginnerFromStdSQL, as other drivers may not support scanning into sql.RawBytes.
+	//
+	// The payload of a message must not be used after the message is acked (for example, by a goroutine
+	// started by the handler), as it's overwritten by the following messages. Messages themselves are not pooled,
+	// as they are created with message.NewMessage.
+	PooledBuffers bool
+
+	// MetadataStorage defines how the metadata of the messages is stored, trading query-ability of the metadata
+	// for the cost of writing it. TopicMetadataStorage picks it per topic.
+	//
+	// Features updating or indexing the metadata column directly (indexes of BusinessKeys, SQLiteTopicAdmin.Erase
+	// and Redact, and re-encrypting messages) require InlineJSONMetadata, or keys which are not promoted.
+	//
+	// Default value is InlineJSONMetadata.
+	MetadataStorage MetadataStorage
+
+	// StrictTables creates the messages tables as STRICT tables (see SQLiteSupportsStrictTables),
+	// so values of a wrong type are rejected instead of being stored, and the metadata is checked to be valid JSON.
+	// Tables created before it was enabled are not changed.
+	StrictTables bool
+
+	// JSONPayloads stores the payloads of messages with a JSON content type (see ContentTypeMetadataKey)
+	// in the TEXT column JSONPayloadColumn, so they can be filtered with JSON functions in SQLFragments.WhereExtra.
+	// Other payloads are stored in the payload column. It's used by new messages tables,
+	// as the column is created with the table.
+	JSONPayloads bool
+}
+
+// payloadColumn returns the payload selected as the payload column.
+func (s DefaultSQLiteSchema) payloadColumn() string {
+	if s.JSONPayloads {
+		return `COALESCE("payload", "` + JSONPayloadColumn + `") AS "payload"`
+	}
+
+	return `"payload"`
+}
+
+func (s DefaultSQLiteSchema) payloadColumnDefinitions() string {
+	if !s.JSONPayloads {
+		return ""
+	}
+
+	return `
+			"` + JSONPayloadColumn + `" TEXT,`
+}
+
+func (s DefaultSQLiteSchema) metadataStorage() MetadataStorage {
+	if s.MetadataStorage == nil {
+		return InlineJSONMetadata{}
+	}
+
+	return s.MetadataStorage
+}
+
+// metadataExpression returns the SQL expression of the metadata of the topic's messages as a JSON object.
+func (s DefaultSQLiteSchema) metadataExpression(topic string) string {
+	return s.metadataStorage().SelectExpression(topic, s.MessagesTable(topic))
+}
+
+// metadataColumn returns the metadata selected as the metadata column.
+func (s DefaultSQLiteSchema) metadataColumn(topic string) string {
+	expression := s.metadataExpression(topic)
+	if expression == `"metadata"` {
+		return expression
+	}
+
+	return expression + ` AS "metadata"`
+}
+
+func (s DefaultSQLiteSchema) SchemaInitializingQueries(topic string) []Query {
+	// AUTOINCREMENT guarantees that offsets of deleted messages are never reused.
+	createMessagesTable := `
+		CREATE TABLE IF NOT EXISTS ` + s.MessagesTable(topic) + ` (
+			"offset" INTEGER PRIMARY KEY AUTOINCREMENT,
+			"uuid" TEXT NOT NULL,
+			"created_at" TEXT NOT NULL DEFAULT ` + s.CreatedAtPrecision.sqliteDefault() + `,
+			"payload" BLOB,` + s.payloadColumnDefinitions() + `
+			"metadata" TEXT` + s.metadataCheck() + s.metadataColumnDefinitions(topic) + `
+		)` + sqliteTableOptions(s.StrictTables) + `;
+	`
+
+	queries := []Query{{Query: createMessagesTable}}
+	queries = append(queries, s.Indexes.createdAtIndexQueries(s.MessagesTable(topic), 0)...)
+	queries = append(queries, s.metadataStorage().SchemaInitializingQueries(topic, s.MessagesTable(topic))...)
+	return append(queries, businessKeyIndexQueries(s.BusinessKeys, s.MessagesTable(topic), 0, sqliteMetadataExpression)...)
+}
+
+func (s DefaultSQLiteSchema) metadataCheck() string {
+	if !s.StrictTables {
+		return ""
+	}
+
+	return ` CHECK ("metadata" IS NULL OR json_valid("metadata"))`
+}
+
+func (s DefaultSQLiteSchema) metadataColumnDefinitions(topic string) string {
+	var definitions string
+	for _, definition := range s.metadataStorage().ColumnDefinitions(topic) {
+		definitions += ",\n\t\t\t" + definition
+	}
+
+	return definitions
+}
+
+func (s DefaultSQLiteSchema) InsertQuery(topic string, msgs message.Messages) (Query, error) {
+	return s.insertQuery(topic, msgs, nil)
+}
+
+func (s DefaultSQLiteSchema) InsertWithCreatedAtQuery(topic string, msgs message.Messages, createdAt []time.Time) (Query, error) {
+	return s.insertQuery(topic, msgs, createdAt)
+}
+
+func (s DefaultSQLiteSchema) insertQuery(topic string, msgs message.Messages, createdAt []time.Time) (Query, error) {
+	storage := s.metadataStorage()
+
+	columns := []string{"uuid", "payload"}
+	if s.JSONPayloads {
+		columns = append(columns, JSONPayloadColumn)
+	}
+	columns = append(columns, "metadata")
+	columns = append(columns, storage.InsertColumns(topic)...)
+	if createdAt != nil {
+		columns = append(columns, "created_at")
+	}
+
+	args := make([]any, 0, len(msgs)*len(columns))
+	for i, msg := range msgs {
+		metadataArgs, err := storage.InsertArgs(topic, msg)
+		if err != nil {
+			return Query{}, err
+		}
+
+		if s.JSONPayloads {
+			payload, jsonPayload := jsonPayloadArgs(msg)
+			args = append(args, msg.UUID, payload, jsonPayload)
+		} else {
+			args = append(args, msg.UUID, []byte(msg.Payload))
+		}
+		args = append(args, metadataArgs...)
+		if createdAt != nil {
+			// The same format as the column's default, so created_at values are ordered correctly.
+			args = append(args, s.CreatedAtPrecision.format(createdAt[i]))
+		}
+	}
+
+	insertQuery := s.Fragments.insertQuery(fmt.Sprintf(
+		`INSERT INTO %s (%s) VALUES %s`,
+		s.MessagesTable(topic),
+		strings.Join(quoteIdentifiers(s.dialect(), columns), ", "),
+		dialectValues(s.dialect(), len(msgs), len(columns)),
+	))
+
+	return Query{insertQuery, args}, nil
+}
+
+func (s DefaultSQLiteSchema) batchSize() int {
+	if s.SubscribeBatchSize == 0 {
+		return 100
+	}
+
+	return s.SubscribeBatchSize
+}
+
+func (s DefaultSQLiteSchema) SelectQuery(topic string, consumerGroup string, offsetsAdapter OffsetsAdapter) Query {
+	nextOffsetQuery := offsetsAdapter.NextOffsetQuery(topic, consumerGroup)
+
+	columns := `"offset", "uuid", ` + s.payloadColumn() + `, ` + s.metadataColumn(topic)
+	orderedColumns := []string{"offset", "uuid", "payload", "metadata"}
+	if s.MessagesOrder != MessagesOrderOffset || s.SelectCreatedAt {
+		columns += `, "created_at"`
+	}
+	if s.SelectCreatedAt {
+		orderedColumns = append(orderedColumns, "created_at")
+	}
+
+	selectQuery := `
+		SELECT ` + columns + ` FROM ` + s.Fragments.fromTable(s.MessagesTable(topic)) + `
+		WHERE
+			"offset" > (` + nextOffsetQuery.Query + `)
+			` + s.Fragments.andWhereExtra() + `
+		ORDER BY
+			"offset" ASC
+		` + s.dialect().LimitClause(s.batchSize())
+	if s.Pagination == PaginationKeyset {
+		selectQuery = sqliteKeysetSelectQuery(columns, s.MessagesTable(topic), s.Fragments, nextOffsetQuery.Query, s.batchSize())
+	}
+	selectQuery = orderedSelectQuery(s.MessagesOrder, orderedColumns, "offset", "created_at", selectQuery, s.dialect().QuoteIdentifier)
+
+	return Query{Query: selectQuery, Args: nextOffsetQuery.Args}
+}
+
+func (s DefaultSQLiteSchema) ReordersMessages() bool {
+	return s.MessagesOrder != MessagesOrderOffset
+}
+
+func (s DefaultSQLiteSchema) UnmarshalMessage(row Scanner) (Row, error) {
+	var r Row
+	var err error
+	pooled := false
+	if s.PooledBuffers {
+		r, pooled, err = scanPooledRow(row, s.SelectCreatedAt)
+	}
+	if !pooled && err == nil {
+		r.CreatedAt, err = scanWithCreatedAt(row, []any{&r.Offset, &r.UUID, &r.Payload, &r.Metadata}, s.SelectCreatedAt)
+	}
+	if err != nil {
+		return Row{}, errors.Wrap(err, "could not scan message row")
+	}
+
+	msg := message.NewMessage(string(r.UUID), r.Payload)
+
+	if r.Metadata != nil && !s.LazyMetadata {
+		err = json.Unmarshal(r.Metadata, &msg.Metadata)
+		if err != nil {
+			return Row{}, errors.Wrap(err, "could not unmarshal metadata as JSON")
+		}
+	}
+
+	r.Msg = msg
+
+	return r, nil
+}
+
+func (s DefaultSQLiteSchema) decodesMetadataLazily() bool {
+	return s.LazyMetadata
+}
+
+func (s DefaultSQLiteSchema) MessagesTable(topic string) string {
+	if s.GenerateMessagesTableName != nil {
+		return s.GenerateMessagesTableName(topic)
+	}
+	return s.dialect().QuoteIdentifier("watermill_" + topic)
+}
+
+func (s DefaultSQLiteSchema) SubscribeIsolationLevel() sql.IsolationLevel {
+	// SQLite transactions are always serializable, as only one writer is allowed at a time.
+	return s.dialect().SubscribeIsolationLevel()
+}
+
+func (s DefaultSQLiteSchema) dialect() SQLiteDialect {
+	return SQLiteDialect{}
+}
@@ -82,6 +82,241 @@ func TestDefaultPostgreSQLSchema(t *testing.T) {
 	testOneMessage(t, publisher, subscriber)
 }
 
+// TestDefaultSQLiteSchema checks if the SQL schema defined in DefaultSQLiteSchema is correctly executed
+// and if message marshaling works as intended.
+func TestDefaultSQLiteSchema(t *testing.T) {
+	db := newSQLite(t)
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	testOneMessage(t, publisher, subscriber)
+}
+
+// TestDialectSchema checks if the SQL schema generated by DialectSchema and DialectOffsetsAdapter
+// is correctly executed and if message marshaling works as intended.
+func TestDialectSchema(t *testing.T) {
+	db := newSQLite(t)
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        sql.DialectSchema{Dialect: sql.SQLiteDialect{}},
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    sql.DialectSchema{Dialect: sql.SQLiteDialect{}},
+		OffsetsAdapter:   sql.DialectOffsetsAdapter{Dialect: sql.SQLiteDialect{}},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	testOneMessage(t, publisher, subscriber)
+}
+
+// TestDialectSchema_ColumnNames checks if DialectSchema consumes a pre-existing table with custom column names
+// and quoting.
+func TestDialectSchema_ColumnNames(t *testing.T) {
+	db := newSQLite(t)
+
+	table := "outbox_" + watermill.NewShortUUID()
+	_, err := db.Exec(`CREATE TABLE ` + "`" + table + "`" + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id TEXT NOT NULL,
+		published_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		body BLOB,
+		headers TEXT
+	)`)
+	require.NoError(t, err)
+
+	dialect := sql.SQLiteDialect{IdentifierQuoting: sql.QuoteWithBackticks}
+	schemaAdapter := sql.DialectSchema{
+		Dialect: dialect,
+		GenerateMessagesTableName: func(topic string) string {
+			return dialect.QuoteIdentifier(table)
+		},
+		ColumnNames: sql.ColumnNames{
+			Offset:    "id",
+			UUID:      "message_id",
+			Payload:   "body",
+			Metadata:  "headers",
+			CreatedAt: "published_at",
+		},
+		MessagesOrder: sql.MessagesOrderCreatedAt,
+	}
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter: schemaAdapter,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DialectOffsetsAdapter{Dialect: dialect},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	testOneMessage(t, publisher, subscriber)
+}
+
+// TestDialectSchema_ExtraColumns checks if the values of custom columns are passed to handlers.
+func TestDialectSchema_ExtraColumns(t *testing.T) {
+	db := newSQLite(t)
+
+	schemaAdapter := sql.DialectSchema{
+		Dialect:      sql.SQLiteDialect{},
+		ExtraColumns: []string{"region"},
+	}
+	topic := "extra_columns_" + watermill.NewShortUUID()
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter: schemaAdapter,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DialectOffsetsAdapter{Dialect: sql.SQLiteDialect{}},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	require.NoError(t, subscriber.SubscribeInitialize(topic))
+	_, err = db.Exec(`ALTER TABLE ` + schemaAdapter.MessagesTable(topic) + ` ADD COLUMN "region" TEXT NOT NULL DEFAULT 'eu'`)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+
+	select {
+	case received := <-messages:
+		extraColumns, ok := sql.ExtraColumnsFromContext(received.Context())
+		require.True(t, ok)
+		require.Equal(t, map[string]any{"region": "eu"}, extraColumns)
+		received.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("Didn't receive any messages")
+	}
+}
+
+func TestScanRow(t *testing.T) {
+	db := newSQLite(t)
+
+	rows, err := db.QueryContext(
+		context.Background(),
+		`SELECT 'eu' AS "region", 7 AS "id", 'uuid' AS "uuid", x'01' AS "payload", '{}' AS "metadata"`,
+	)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	require.True(t, rows.Next())
+
+	row, err := sql.ScanRow(rows, sql.ColumnNames{Offset: "id"})
+	require.NoError(t, err)
+
+	require.Equal(t, int64(7), row.Offset)
+	require.Equal(t, []byte("uuid"), row.UUID)
+	require.Equal(t, []byte{1}, row.Payload)
+	require.Equal(t, []byte("{}"), row.Metadata)
+	require.Equal(t, map[string]any{"region": "eu"}, row.ExtraColumns)
+}
+
+// TestSQLFragments checks if the custom SQL fragments are added to the queries of DefaultSQLiteSchema.
+func TestSQLFragments(t *testing.T) {
+	db := newSQLite(t)
+
+	topic := "fragments_" + watermill.NewShortUUID()
+	index := "idx_" + topic
+
+	schemaAdapter := sql.DefaultSQLiteSchema{
+		Fragments: sql.SQLFragments{
+			SelectSuffix: `INDEXED BY "` + index + `"`,
+			WhereExtra:   `json_extract("metadata", '$.tenant') = 'acme'`,
+			InsertSuffix: `RETURNING "offset"`,
+		},
+	}
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        schemaAdapter,
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	require.NoError(t, subscriber.SubscribeInitialize(topic))
+	_, err = db.Exec(`CREATE INDEX "` + index + `" ON ` + schemaAdapter.MessagesTable(topic) + ` ("offset")`)
+	require.NoError(t, err)
+
+	otherTenant := message.NewMessage(watermill.NewUUID(), nil)
+	otherTenant.Metadata.Set("tenant", "other")
+	acme := message.NewMessage(watermill.NewUUID(), nil)
+	acme.Metadata.Set("tenant", "acme")
+	require.NoError(t, publisher.Publish(topic, otherTenant, acme))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	select {
+	case received := <-messages:
+		require.Equal(t, acme.UUID, received.UUID)
+		received.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("Didn't receive any messages")
+	}
+}
+
+// TestTimePartitionedSchema checks if the partitions created by TimePartitionedSchema
+// are correctly queried by the subscriber.
+func TestTimePartitionedSchema(t *testing.T) {
+	db := newSQLite(t)
+
+	schemaAdapter := sql.TimePartitionedSchema{
+		Database: sql.TimePartitionedSQLite,
+	}
+
+	publisher, err := sql.NewPublisher(db, sql.PublisherConfig{
+		SchemaAdapter:        schemaAdapter,
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriber(db, sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	testOneMessage(t, publisher, subscriber)
+}
+
 func testOneMessage(t *testing.T, publisher message.Publisher, subscriber message.Subscriber) {
 	topic := "test_" + watermill.NewULID()
 
@@ -0,0 +1,353 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// TimePartitionedDatabase is the database used by TimePartitionedSchema.
+type TimePartitionedDatabase int
+
+const (
+	// TimePartitionedMySQL stores partitions in MySQL (or MariaDB) tables.
+	// It should be used together with DefaultMySQLOffsetsAdapter.
+	TimePartitionedMySQL TimePartitionedDatabase = iota + 1
+
+	// TimePartitionedSQLite stores partitions in SQLite tables.
+	// It should be used together with DefaultSQLiteOffsetsAdapter or DefaultD1OffsetsAdapter.
+	TimePartitionedSQLite
+)
+
+// TimePartitionPeriod is the time period covered by one partition of TimePartitionedSchema.
+type TimePartitionPeriod int
+
+const (
+	// TimePartitionDaily creates a partition for every day (UTC).
+	TimePartitionDaily TimePartitionPeriod = iota
+
+	// TimePartitionWeekly creates a partition for every week (UTC), starting on Monday.
+	TimePartitionWeekly
+)
+
+// partitionOffsetBits is the number of low bits of the offset assigned by the partition's auto-increment.
+// The higher bits contain the number of the period, so offsets grow monotonically across partitions.
+const partitionOffsetBits = 40
+
+const secondsPerDay = 24 * 60 * 60
+
+// TimePartitionedSchema is an implementation of SchemaAdapter which writes messages of a topic
+// to a separate table for every day or week (for example, watermill_topic_20240501).
+//
+// SelectQuery unions the partitions within the retention window, so retention drops whole tables
+// (see MaintainPartitions), instead of executing huge DELETE statements on a single table.
+// Messages from dropped partitions are never delivered, even if they were not consumed yet.
+//
+// Partitions are created in advance, so MaintainPartitions must be executed at least once per period
+// (for example, every hour), to create the upcoming partitions before they are used.
+// Otherwise, publishing and subscribing fail, because the tables don't exist.
+type TimePartitionedSchema struct {
+	// Database is the database where partitions are stored. It's required.
+	Database TimePartitionedDatabase
+
+	// Period is the time period covered by one partition.
+	//
+	// Default value is TimePartitionDaily.
+	Period TimePartitionPeriod
+
+	// RetainedPartitions is the number of the most recent partitions (including the current one)
+	// which are queried by subscribers. Older partitions are dropped by MaintainPartitions.
+	//
+	// Default value is 7.
+	RetainedPartitions int
+
+	// PrecreatedPartitions is the number of partitions created in advance.
+	// They are queried by subscribers too, in case the clocks of publishers are ahead.
+	//
+	// Default value is 1.
+	PrecreatedPartitions int
+
+	// GeneratePartitionTableName may be used to override how the partition table name is generated.
+	// The returned name should not be quoted.
+	GeneratePartitionTableName func(topic string, periodStart time.Time) string
+
+	// SubscribeBatchSize is the number of messages to be queried at once.
+	//
+	// Higher value, increases a chance of message re-delivery in case of crash or networking issues.
+	// 1 is the safest value, but it may have a negative impact on performance when consuming a lot of messages.
+	//
+	// Default value is 100.
+	SubscribeBatchSize int
+}
+
+// ValidateTopicName validates the topic name like ValidateTopicName does. It also returns an error
+// if Database is not set, as topics are validated before the queries of the schema adapter are used.
+func (s TimePartitionedSchema) ValidateTopicName(topic string) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	return validateTopicName(topic)
+}
+
+func (s TimePartitionedSchema) validate() error {
+	if s.Database != TimePartitionedMySQL && s.Database != TimePartitionedSQLite {
+		return errors.Errorf("unknown time partitioned database: %d", s.Database)
+	}
+
+	return nil
+}
+
+func (s TimePartitionedSchema) SchemaInitializingQueries(topic string) []Query {
+	return s.createPartitionsQueries(topic, time.Now())
+}
+
+// MaintenanceQueries returns queries which create the missing partitions of the retention window
+// and the precreated partitions, and drop partitions older than the retention window.
+//
+// Partitions are dropped only one retention window back, so the queries should be executed
+// at least once per RetainedPartitions periods.
+func (s TimePartitionedSchema) MaintenanceQueries(topic string, now time.Time) []Query {
+	queries := s.createPartitionsQueries(topic, now)
+
+	current := s.periodNumber(now)
+	retained := int64(s.retainedPartitions())
+	for period := current - 2*retained + 1; period <= current-retained; period++ {
+		queries = append(queries, Query{
+			Query: `DROP TABLE IF EXISTS ` + s.quote(s.partitionTableName(topic, period)),
+		})
+	}
+
+	return queries
+}
+
+// MaintainPartitions executes MaintenanceQueries for the topic.
+//
+// The queries can't be executed within a transaction, as creating and dropping tables
+// implicitly commits it in MySQL.
+func (s TimePartitionedSchema) MaintainPartitions(ctx context.Context, db QueryExecutor, topic string) error {
+	if err := validateTopic(s, topic); err != nil {
+		return err
+	}
+
+	for _, q := range s.MaintenanceQueries(topic, time.Now()) {
+		if _, err := db.ExecContext(ctx, q.Query, q.Args...); err != nil {
+			return errors.Wrap(err, "could not maintain partitions")
+		}
+	}
+
+	return nil
+}
+
+func (s TimePartitionedSchema) createPartitionsQueries(topic string, now time.Time) []Query {
+	var queries []Query
+
+	first, last := s.window(now)
+	for period := first; period <= last; period++ {
+		queries = append(queries, s.createPartitionQueries(s.partitionTableName(topic, period), period)...)
+	}
+
+	return queries
+}
+
+func (s TimePartitionedSchema) createPartitionQueries(table string, period int64) []Query {
+	// Auto-increment of every partition starts at the period's base offset,
+	// so offsets of newer partitions are always greater.
+	baseOffset := period << partitionOffsetBits
+
+	switch s.Database {
+	case TimePartitionedMySQL:
+		createTable := strings.Join([]string{
+			"CREATE TABLE IF NOT EXISTS " + s.quote(table) + " (",
+			"`offset` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,",
+			"`uuid` VARCHAR(36) NOT NULL,",
+			"`created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,",
+			"`payload` JSON DEFAULT NULL,",
+			"`metadata` JSON DEFAULT NULL",
+			fmt.Sprintf(") AUTO_INCREMENT = %d;", baseOffset+1),
+		}, "\n")
+
+		return []Query{{Query: createTable}}
+	case TimePartitionedSQLite:
+		createTable := `
+			CREATE TABLE IF NOT EXISTS ` + s.quote(table) + ` (
+				"offset" INTEGER PRIMARY KEY AUTOINCREMENT,
+				"uuid" TEXT NOT NULL,
+				"created_at" TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				"payload" BLOB,
+				"metadata" TEXT
+			);
+		`
+
+		// sqlite_sequence holds the last offset assigned by AUTOINCREMENT for every table.
+		seedSequence := `INSERT INTO sqlite_sequence (name, seq)
+			SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = ?)`
+
+		return []Query{
+			{Query: createTable},
+			{Query: seedSequence, Args: []any{table, baseOffset, table}},
+		}
+	default:
+		// Unknown databases are rejected by ValidateTopicName, before the queries are used.
+		return nil
+	}
+}
+
+func (s TimePartitionedSchema) InsertQuery(topic string, msgs message.Messages) (Query, error) {
+	if err := s.validate(); err != nil {
+		return Query{}, err
+	}
+
+	insertQuery := fmt.Sprintf(
+		`INSERT INTO %s (uuid, payload, metadata) VALUES %s`,
+		s.quote(s.PartitionTableName(topic, time.Now())),
+		strings.TrimRight(strings.Repeat(`(?,?,?),`, len(msgs)), ","),
+	)
+
+	var args []any
+	var err error
+	if s.Database == TimePartitionedSQLite {
+		args, err = stringMetadataInsertArgs(msgs)
+	} else {
+		args, err = defaultInsertArgs(msgs)
+	}
+	if err != nil {
+		return Query{}, err
+	}
+
+	return Query{insertQuery, args}, nil
+}
+
+func (s TimePartitionedSchema) batchSize() int {
+	if s.SubscribeBatchSize == 0 {
+		return 100
+	}
+
+	return s.SubscribeBatchSize
+}
+
+func (s TimePartitionedSchema) SelectQuery(topic string, consumerGroup string, offsetsAdapter OffsetsAdapter) Query {
+	nextOffsetQuery := offsetsAdapter.NextOffsetQuery(topic, consumerGroup)
+
+	columns := s.quote("offset") + ", " + s.quote("uuid") + ", " + s.quote("payload") + ", " + s.quote("metadata")
+
+	// The offset condition is repeated in every partition, so the primary key index of each partition is used.
+	var partitions []string
+	var args []any
+
+	first, last := s.window(time.Now())
+	for period := first; period <= last; period++ {
+		partitions = append(partitions, `SELECT `+columns+` FROM `+s.quote(s.partitionTableName(topic, period))+`
+			WHERE `+s.quote("offset")+` > (`+nextOffsetQuery.Query+`)`)
+		args = append(args, nextOffsetQuery.Args...)
+	}
+
+	selectQuery := `
+		SELECT ` + columns + ` FROM (
+			` + strings.Join(partitions, "\nUNION ALL\n") + `
+		) AS messages
+		ORDER BY
+			` + s.quote("offset") + ` ASC
+		LIMIT ` + fmt.Sprintf("%d", s.batchSize())
+
+	return Query{selectQuery, args}
+}
+
+func (s TimePartitionedSchema) UnmarshalMessage(row Scanner) (Row, error) {
+	r := Row{}
+	err := row.Scan(&r.Offset, &r.UUID, &r.Payload, &r.Metadata)
+	if err != nil {
+		return Row{}, errors.Wrap(err, "could not scan message row")
+	}
+
+	msg := message.NewMessage(string(r.UUID), r.Payload)
+
+	if r.Metadata != nil {
+		err = json.Unmarshal(r.Metadata, &msg.Metadata)
+		if err != nil {
+			return Row{}, errors.Wrap(err, "could not unmarshal metadata as JSON")
+		}
+	}
+
+	r.Msg = msg
+
+	return r, nil
+}
+
+// PartitionTableName returns the name of the partition table storing messages published at t.
+func (s TimePartitionedSchema) PartitionTableName(topic string, t time.Time) string {
+	return s.partitionTableName(topic, s.periodNumber(t))
+}
+
+func (s TimePartitionedSchema) partitionTableName(topic string, period int64) string {
+	periodStart := s.periodStart(period)
+	if s.GeneratePartitionTableName != nil {
+		return s.GeneratePartitionTableName(topic, periodStart)
+	}
+	return fmt.Sprintf("watermill_%s_%s", topic, periodStart.Format("20060102"))
+}
+
+func (s TimePartitionedSchema) SubscribeIsolationLevel() sql.IsolationLevel {
+	if s.Database == TimePartitionedSQLite {
+		// SQLite transactions are always serializable, as only one writer is allowed at a time.
+		return sql.LevelDefault
+	}
+
+	// MySQL requires serializable isolation level for not losing messages.
+	return sql.LevelSerializable
+}
+
+func (s TimePartitionedSchema) quote(name string) string {
+	if s.Database == TimePartitionedMySQL {
+		return "`" + name + "`"
+	}
+	return `"` + name + `"`
+}
+
+func (s TimePartitionedSchema) retainedPartitions() int {
+	if s.RetainedPartitions == 0 {
+		return 7
+	}
+
+	return s.RetainedPartitions
+}
+
+func (s TimePartitionedSchema) precreatedPartitions() int {
+	if s.PrecreatedPartitions == 0 {
+		return 1
+	}
+
+	return s.PrecreatedPartitions
+}
+
+// window returns the first and the last period queried by subscribers.
+func (s TimePartitionedSchema) window(now time.Time) (int64, int64) {
+	current := s.periodNumber(now)
+	return current - int64(s.retainedPartitions()) + 1, current + int64(s.precreatedPartitions())
+}
+
+// periodNumber returns the number of periods between the Unix epoch and t.
+func (s TimePartitionedSchema) periodNumber(t time.Time) int64 {
+	days := t.Unix() / secondsPerDay
+	if s.Period == TimePartitionWeekly {
+		// The Unix epoch was on Thursday, so weeks are shifted to start on Monday.
+		return (days + 3) / 7
+	}
+
+	return days
+}
+
+func (s TimePartitionedSchema) periodStart(period int64) time.Time {
+	days := period
+	if s.Period == TimePartitionWeekly {
+		days = period*7 - 3
+	}
+
+	return time.Unix(days*secondsPerDay, 0).UTC()
+}
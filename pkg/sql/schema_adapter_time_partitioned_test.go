@@ -0,0 +1,75 @@
+package sql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimePartitionedSchema_PartitionTableName(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Period        TimePartitionPeriod
+		Time          time.Time
+		ExpectedTable string
+	}{
+		{
+			Name:          "daily",
+			Period:        TimePartitionDaily,
+			Time:          time.Date(2024, 5, 1, 23, 59, 59, 0, time.UTC),
+			ExpectedTable: "watermill_topic_20240501",
+		},
+		{
+			Name:          "weekly_monday",
+			Period:        TimePartitionWeekly,
+			Time:          time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC),
+			ExpectedTable: "watermill_topic_20240429",
+		},
+		{
+			Name:          "weekly_sunday",
+			Period:        TimePartitionWeekly,
+			Time:          time.Date(2024, 5, 5, 23, 59, 59, 0, time.UTC),
+			ExpectedTable: "watermill_topic_20240429",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			s := TimePartitionedSchema{Database: TimePartitionedSQLite, Period: tc.Period}
+			assert.Equal(t, tc.ExpectedTable, s.PartitionTableName("topic", tc.Time))
+		})
+	}
+}
+
+func TestTimePartitionedSchema_MaintenanceQueries(t *testing.T) {
+	s := TimePartitionedSchema{
+		Database:             TimePartitionedMySQL,
+		RetainedPartitions:   2,
+		PrecreatedPartitions: 1,
+	}
+
+	queries := s.MaintenanceQueries("topic", time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC))
+
+	assert.Len(t, queries, 5)
+	assert.Contains(t, queries[0].Query, "CREATE TABLE IF NOT EXISTS `watermill_topic_20240509`")
+	assert.Contains(t, queries[1].Query, "CREATE TABLE IF NOT EXISTS `watermill_topic_20240510`")
+	assert.Contains(t, queries[2].Query, "CREATE TABLE IF NOT EXISTS `watermill_topic_20240511`")
+	assert.Equal(t, "DROP TABLE IF EXISTS `watermill_topic_20240507`", queries[3].Query)
+	assert.Equal(t, "DROP TABLE IF EXISTS `watermill_topic_20240508`", queries[4].Query)
+}
+
+func TestTimePartitionedSchema_unknownDatabase(t *testing.T) {
+	s := TimePartitionedSchema{}
+
+	assert.EqualError(t, s.ValidateTopicName("topic"), "unknown time partitioned database: 0")
+	assert.EqualError(t, validateTopic(s, "topic"), "invalid topic name: unknown time partitioned database: 0")
+	assert.Empty(t, s.SchemaInitializingQueries("topic"))
+
+	_, err := s.InsertQuery("topic", message.Messages{message.NewMessage("uuid", nil)})
+	assert.EqualError(t, err, "unknown time partitioned database: 0")
+
+	assert.NoError(t, TimePartitionedSchema{Database: TimePartitionedSQLite}.ValidateTopicName("topic"))
+	assert.ErrorIs(t, TimePartitionedSchema{Database: TimePartitionedSQLite}.ValidateTopicName("a b"), ErrInvalidTopicName)
+}
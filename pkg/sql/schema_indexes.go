@@ -0,0 +1,68 @@
+package sql
+
+// MessagesIndexes are the additional indexes on the messages table created by SchemaInitializingQueries.
+// Indexes are created only if they don't exist, so changing the options requires dropping the indexes.
+type MessagesIndexes struct {
+	// Covering creates an index holding all columns read by SelectQuery, so messages are polled
+	// with an index-only scan, even when columns are added to the messages table.
+	//
+	// On PostgreSQL, the payload and metadata are included in the index, so inserting messages
+	// larger than about 2.7 kB fails. The index is partial if SQLFragments.WhereExtra is set,
+	// and only pending messages are indexed with PostgreSQLQueueSchema.
+	//
+	// SQLite stores rows in the order of offsets, so no covering index is needed there, and the option is ignored.
+	Covering bool
+
+	// CreatedAt creates an index on created_at, used when deleting messages older than their TTL,
+	// and when delivering messages in MessagesOrderCreatedAt.
+	CreatedAt bool
+}
+
+func (i MessagesIndexes) createdAtIndexName(messagesTable string, maxNameLength int) string {
+	return tableIndexName(messagesTable, "created_at_idx", maxNameLength)
+}
+
+func (i MessagesIndexes) coveringIndexName(messagesTable string, maxNameLength int) string {
+	return tableIndexName(messagesTable, "poll_idx", maxNameLength)
+}
+
+// createdAtIndexQueries returns the query creating the created_at index, if it's enabled.
+func (i MessagesIndexes) createdAtIndexQueries(messagesTable string, maxNameLength int) []Query {
+	if !i.CreatedAt {
+		return nil
+	}
+
+	return []Query{{
+		Query: `CREATE INDEX IF NOT EXISTS "` + i.createdAtIndexName(messagesTable, maxNameLength) + `"
+			ON ` + messagesTable + ` ("created_at")`,
+	}}
+}
+
+// postgreSQLCoveringIndexQueries returns the query creating the covering index on the key columns,
+// including the columns selected with them. The index is partial if where isn't empty.
+func (i MessagesIndexes) postgreSQLCoveringIndexQueries(messagesTable string, keyColumns string, where string) []Query {
+	if !i.Covering {
+		return nil
+	}
+
+	query := `CREATE INDEX IF NOT EXISTS "` + i.coveringIndexName(messagesTable, postgreSQLMaxIdentifierLength) + `"
+			ON ` + messagesTable + ` (` + keyColumns + `) INCLUDE ("uuid", "payload", "metadata")`
+	if where != "" {
+		query += ` WHERE ` + where
+	}
+
+	return []Query{{Query: query}}
+}
+
+// expectedIndexes returns the names of the enabled indexes, for DescribingAdapter.
+func (i MessagesIndexes) expectedIndexes(messagesTable string, maxNameLength int, coveringSupported bool) []string {
+	var indexes []string
+	if i.Covering && coveringSupported {
+		indexes = append(indexes, i.coveringIndexName(messagesTable, maxNameLength))
+	}
+	if i.CreatedAt {
+		indexes = append(indexes, i.createdAtIndexName(messagesTable, maxNameLength))
+	}
+
+	return indexes
+}
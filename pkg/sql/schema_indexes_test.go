@@ -0,0 +1,75 @@
+package sql_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessagesIndexes_postgreSQL(t *testing.T) {
+	schema := sql.DefaultPostgreSQLSchema{
+		Fragments: sql.SQLFragments{WhereExtra: "tenant_id = 'acme'"},
+		Indexes:   sql.MessagesIndexes{Covering: true, CreatedAt: true},
+	}
+
+	queries := schema.SchemaInitializingQueries("orders")
+	require.Len(t, queries, 3)
+
+	assert.Equal(
+		t,
+		`CREATE INDEX IF NOT EXISTS "watermill_orders_poll_idx" ON "watermill_orders" ("transaction_id", "offset") INCLUDE ("uuid", "payload", "metadata") WHERE (tenant_id = 'acme')`,
+		strings.Join(strings.Fields(queries[1].Query), " "),
+	)
+	assert.Equal(
+		t,
+		`CREATE INDEX IF NOT EXISTS "watermill_orders_created_at_idx" ON "watermill_orders" ("created_at")`,
+		strings.Join(strings.Fields(queries[2].Query), " "),
+	)
+
+	tables := schema.ExpectedTables("orders")
+	require.Len(t, tables, 1)
+	assert.Equal(t, []string{"watermill_orders_poll_idx", "watermill_orders_created_at_idx"}, tables[0].Indexes)
+}
+
+func TestMessagesIndexes_postgreSQLQueue(t *testing.T) {
+	schema := sql.PostgreSQLQueueSchema{
+		Indexes: sql.MessagesIndexes{Covering: true},
+	}
+
+	queries := schema.SchemaInitializingQueries("orders")
+	require.Len(t, queries, 2)
+
+	assert.Equal(
+		t,
+		`CREATE INDEX IF NOT EXISTS "watermill_orders_poll_idx" ON "watermill_orders" ("offset") INCLUDE ("uuid", "payload", "metadata") WHERE "status" = 'pending'`,
+		strings.Join(strings.Fields(queries[1].Query), " "),
+	)
+}
+
+func TestMessagesIndexes_sqlite(t *testing.T) {
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topic := "indexed_" + watermill.NewShortUUID()
+
+	schemaAdapter := sql.DefaultSQLiteSchema{
+		Indexes: sql.MessagesIndexes{Covering: true, CreatedAt: true},
+	}
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+
+	tables := schemaAdapter.ExpectedTables(topic)
+	require.Len(t, tables, 1)
+	assert.Equal(t, []string{"watermill_" + topic + "_created_at_idx"}, tables[0].Indexes)
+
+	for _, q := range append(schemaAdapter.SchemaInitializingQueries(topic), offsetsAdapter.SchemaInitializingQueries(topic)...) {
+		_, err := db.ExecContext(ctx, q.Query, q.Args...)
+		require.NoError(t, err)
+	}
+
+	err := sql.VerifySchema(ctx, db, sql.SQLiteSchemaIntrospector{}, schemaAdapter, offsetsAdapter, topic)
+	assert.NoError(t, err)
+}
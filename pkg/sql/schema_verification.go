@@ -0,0 +1,313 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TableSchema describes a table, as expected by an adapter or as returned by SchemaIntrospector.
+type TableSchema struct {
+	// Name is the name of the table, without quotes.
+	Name string
+
+	Columns []ColumnSchema
+
+	// Indexes are the names of the table's indexes. The indexes of primary keys are not included.
+	Indexes []string
+}
+
+// ColumnSchema describes a column of a table.
+type ColumnSchema struct {
+	Name string
+
+	// Type is the type of the column as reported by the database, like "INTEGER" in SQLite or "int4" in PostgreSQL.
+	Type string
+}
+
+// DescribingAdapter is an optional interface of SchemaAdapter and OffsetsAdapter, implemented by adapters
+// which can describe the tables created by their SchemaInitializingQueries. It's used by VerifySchema.
+type DescribingAdapter interface {
+	// ExpectedTables returns the tables required by the adapter for the topic.
+	ExpectedTables(topic string) []TableSchema
+}
+
+// SchemaIntrospector reads the schema of existing tables from the database's catalog.
+type SchemaIntrospector interface {
+	// InspectTable returns the schema of the table. It returns false if the table doesn't exist.
+	InspectTable(ctx context.Context, db QueryExecutor, table string) (TableSchema, bool, error)
+}
+
+// SchemaMismatchError is returned by VerifySchema when the tables of the topic don't match the adapters.
+type SchemaMismatchError struct {
+	Topic string
+
+	// Differences describe every missing table, column or index, and every column with an unexpected type.
+	Differences []string
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return fmt.Sprintf("schema of topic %s doesn't match the adapters: %s", e.Topic, strings.Join(e.Differences, "; "))
+}
+
+// VerifySchema checks that the tables required by the schema and offsets adapters for the topic exist,
+// with the expected columns, types and indexes. It returns SchemaMismatchError listing all differences,
+// so misconfigured deployments fail on startup, instead of failing later with errors like "no such column".
+//
+// Adapters which don't implement DescribingAdapter are not verified. Columns which are not expected
+// by the adapters (like columns added for custom queries) are allowed. offsetsAdapter may be nil.
+// It may be executed by publishers and subscribers with PublisherConfig.SchemaIntrospector
+// and SubscriberConfig.SchemaIntrospector.
+func VerifySchema(
+	ctx context.Context,
+	db QueryExecutor,
+	introspector SchemaIntrospector,
+	schemaAdapter SchemaAdapter,
+	offsetsAdapter OffsetsAdapter,
+	topic string,
+) error {
+	if err := validateTopic(schemaAdapter, topic); err != nil {
+		return err
+	}
+
+	var expected []TableSchema
+	if describingAdapter, ok := schemaAdapter.(DescribingAdapter); ok {
+		expected = append(expected, describingAdapter.ExpectedTables(topic)...)
+	}
+	if describingAdapter, ok := offsetsAdapter.(DescribingAdapter); ok {
+		expected = append(expected, describingAdapter.ExpectedTables(topic)...)
+	}
+
+	var differences []string
+	for _, expectedTable := range expected {
+		table, exists, err := introspector.InspectTable(ctx, db, expectedTable.Name)
+		if err != nil {
+			return errors.Wrapf(err, "could not inspect table %s", expectedTable.Name)
+		}
+		if !exists {
+			differences = append(differences, fmt.Sprintf("table %s doesn't exist", expectedTable.Name))
+			continue
+		}
+
+		differences = append(differences, tableSchemaDifferences(expectedTable, table)...)
+	}
+
+	if len(differences) > 0 {
+		return &SchemaMismatchError{Topic: topic, Differences: differences}
+	}
+
+	return nil
+}
+
+func tableSchemaDifferences(expected TableSchema, actual TableSchema) []string {
+	columnTypes := map[string]string{}
+	for _, column := range actual.Columns {
+		columnTypes[strings.ToLower(column.Name)] = column.Type
+	}
+
+	var differences []string
+	for _, column := range expected.Columns {
+		columnType, ok := columnTypes[strings.ToLower(column.Name)]
+		if !ok {
+			differences = append(differences, fmt.Sprintf("column %s.%s doesn't exist", expected.Name, column.Name))
+			continue
+		}
+		if normalizeColumnType(columnType) != normalizeColumnType(column.Type) {
+			differences = append(differences, fmt.Sprintf(
+				"column %s.%s has type %s, expected %s",
+				expected.Name, column.Name, columnType, column.Type,
+			))
+		}
+	}
+
+	indexes := map[string]struct{}{}
+	for _, index := range actual.Indexes {
+		indexes[index] = struct{}{}
+	}
+	for _, index := range expected.Indexes {
+		if _, ok := indexes[index]; !ok {
+			differences = append(differences, fmt.Sprintf("index %s of table %s doesn't exist", index, expected.Name))
+		}
+	}
+
+	return differences
+}
+
+func normalizeColumnType(columnType string) string {
+	return strings.ToLower(strings.Join(strings.Fields(columnType), " "))
+}
+
+// unquotedTableName returns the table name without quotes, as stored in the database's catalog.
+func unquotedTableName(table string) string {
+	return strings.Trim(table, "\"`[]")
+}
+
+// SQLiteSchemaIntrospector is SchemaIntrospector of SQLite. The types of columns are the declared types.
+type SQLiteSchemaIntrospector struct{}
+
+func (i SQLiteSchemaIntrospector) InspectTable(ctx context.Context, db QueryExecutor, table string) (TableSchema, bool, error) {
+	schema := TableSchema{Name: table}
+
+	columns, err := db.QueryContext(ctx, `SELECT "name", "type" FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return TableSchema{}, false, errors.Wrap(err, "could not query columns")
+	}
+	defer columns.Close()
+
+	for columns.Next() {
+		var column ColumnSchema
+		if err := columns.Scan(&column.Name, &column.Type); err != nil {
+			return TableSchema{}, false, errors.Wrap(err, "could not scan column")
+		}
+		schema.Columns = append(schema.Columns, column)
+	}
+	if err := columns.Err(); err != nil {
+		return TableSchema{}, false, errors.Wrap(err, "could not iterate columns")
+	}
+	if len(schema.Columns) == 0 {
+		return TableSchema{}, false, nil
+	}
+
+	indexes, err := db.QueryContext(ctx, `SELECT "name" FROM pragma_index_list(?) WHERE "origin" != 'pk'`, table)
+	if err != nil {
+		return TableSchema{}, false, errors.Wrap(err, "could not query indexes")
+	}
+	defer indexes.Close()
+
+	for indexes.Next() {
+		var index string
+		if err := indexes.Scan(&index); err != nil {
+			return TableSchema{}, false, errors.Wrap(err, "could not scan index")
+		}
+		schema.Indexes = append(schema.Indexes, index)
+	}
+
+	return schema, true, indexes.Err()
+}
+
+// PostgreSQLSchemaIntrospector is SchemaIntrospector of PostgreSQL, inspecting the tables of the current schema.
+// The types of columns are the names of the underlying types, like "int4" or "varchar".
+type PostgreSQLSchemaIntrospector struct{}
+
+func (i PostgreSQLSchemaIntrospector) InspectTable(ctx context.Context, db QueryExecutor, table string) (TableSchema, bool, error) {
+	schema := TableSchema{Name: table}
+
+	columns, err := db.QueryContext(
+		ctx,
+		`SELECT column_name, udt_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1
+		ORDER BY ordinal_position`,
+		table,
+	)
+	if err != nil {
+		return TableSchema{}, false, errors.Wrap(err, "could not query columns")
+	}
+	defer columns.Close()
+
+	for columns.Next() {
+		var column ColumnSchema
+		if err := columns.Scan(&column.Name, &column.Type); err != nil {
+			return TableSchema{}, false, errors.Wrap(err, "could not scan column")
+		}
+		schema.Columns = append(schema.Columns, column)
+	}
+	if err := columns.Err(); err != nil {
+		return TableSchema{}, false, errors.Wrap(err, "could not iterate columns")
+	}
+	if len(schema.Columns) == 0 {
+		return TableSchema{}, false, nil
+	}
+
+	indexes, err := db.QueryContext(
+		ctx,
+		`SELECT indexname FROM pg_indexes
+		WHERE schemaname = current_schema() AND tablename = $1 AND indexname NOT IN (
+			SELECT conname FROM pg_constraint WHERE contype = 'p' AND conrelid = to_regclass(quote_ident($1))
+		)`,
+		table,
+	)
+	if err != nil {
+		return TableSchema{}, false, errors.Wrap(err, "could not query indexes")
+	}
+	defer indexes.Close()
+
+	for indexes.Next() {
+		var index string
+		if err := indexes.Scan(&index); err != nil {
+			return TableSchema{}, false, errors.Wrap(err, "could not scan index")
+		}
+		schema.Indexes = append(schema.Indexes, index)
+	}
+
+	return schema, true, indexes.Err()
+}
+
+func (s DefaultSQLiteSchema) ExpectedTables(topic string) []TableSchema {
+	table := TableSchema{
+		Name: unquotedTableName(s.MessagesTable(topic)),
+		Columns: []ColumnSchema{
+			{Name: "offset", Type: "INTEGER"},
+			{Name: "uuid", Type: "TEXT"},
+			{Name: "created_at", Type: "TEXT"},
+			{Name: "payload", Type: "BLOB"},
+			{Name: "metadata", Type: "TEXT"},
+		},
+	}
+	if s.JSONPayloads {
+		table.Columns = append(table.Columns, ColumnSchema{Name: JSONPayloadColumn, Type: "TEXT"})
+	}
+	table.Indexes = s.Indexes.expectedIndexes(s.MessagesTable(topic), 0, false)
+	for _, key := range s.BusinessKeys {
+		table.Indexes = append(table.Indexes, businessKeyIndexName(s.MessagesTable(topic), key, 0))
+	}
+
+	return []TableSchema{table}
+}
+
+func (a DefaultSQLiteOffsetsAdapter) ExpectedTables(topic string) []TableSchema {
+	return []TableSchema{{
+		Name: unquotedTableName(a.MessagesOffsetsTable(topic)),
+		Columns: []ColumnSchema{
+			{Name: "consumer_group", Type: "TEXT"},
+			{Name: "offset_acked", Type: "INTEGER"},
+			{Name: "offset_consumed", Type: "INTEGER"},
+		},
+	}}
+}
+
+func (s DefaultPostgreSQLSchema) ExpectedTables(topic string) []TableSchema {
+	table := TableSchema{
+		Name: unquotedTableName(s.MessagesTable(topic)),
+		Columns: []ColumnSchema{
+			{Name: "offset", Type: "int4"},
+			{Name: "uuid", Type: "varchar"},
+			{Name: "created_at", Type: "timestamp"},
+			{Name: "payload", Type: "json"},
+			{Name: "metadata", Type: "json"},
+			{Name: "transaction_id", Type: "xid8"},
+		},
+	}
+	if s.JSONPayloads {
+		table.Columns[3].Type = "bytea"
+		table.Columns = append(table.Columns, ColumnSchema{Name: JSONPayloadColumn, Type: "jsonb"})
+	}
+	table.Indexes = s.Indexes.expectedIndexes(s.MessagesTable(topic), postgreSQLMaxIdentifierLength, true)
+	for _, key := range s.BusinessKeys {
+		table.Indexes = append(table.Indexes, businessKeyIndexName(s.MessagesTable(topic), key, postgreSQLMaxIdentifierLength))
+	}
+
+	return []TableSchema{table}
+}
+
+func (a DefaultPostgreSQLOffsetsAdapter) ExpectedTables(topic string) []TableSchema {
+	return []TableSchema{{
+		Name: unquotedTableName(a.MessagesOffsetsTable(topic)),
+		Columns: []ColumnSchema{
+			{Name: "consumer_group", Type: "varchar"},
+			{Name: "offset_acked", Type: "int8"},
+			{Name: "last_processed_transaction_id", Type: "xid8"},
+		},
+	}}
+}
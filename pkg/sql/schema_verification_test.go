@@ -0,0 +1,98 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySchema(t *testing.T) {
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topic := "verified_" + watermill.NewShortUUID()
+
+	schemaAdapter := sql.DefaultSQLiteSchema{
+		BusinessKeys: []sql.BusinessKey{{MetadataKey: "order_id"}},
+	}
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{}
+
+	_, err := db.ExecContext(ctx, `CREATE TABLE "watermill_`+topic+`" (
+		"offset" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"uuid" TEXT NOT NULL,
+		"created_at" TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		"payload" TEXT,
+		"custom" TEXT
+	)`)
+	require.NoError(t, err)
+
+	err = sql.VerifySchema(ctx, db, sql.SQLiteSchemaIntrospector{}, schemaAdapter, offsetsAdapter, topic)
+
+	var mismatchErr *sql.SchemaMismatchError
+	require.ErrorAs(t, err, &mismatchErr)
+	assert.Equal(t, topic, mismatchErr.Topic)
+	assert.Equal(t, []string{
+		"column watermill_" + topic + ".payload has type TEXT, expected BLOB",
+		"column watermill_" + topic + ".metadata doesn't exist",
+		"index watermill_" + topic + "_order_id_key of table watermill_" + topic + " doesn't exist",
+		"table watermill_offsets_" + topic + " doesn't exist",
+	}, mismatchErr.Differences)
+
+	otherTopic := "verified_" + watermill.NewShortUUID()
+	for _, q := range append(schemaAdapter.SchemaInitializingQueries(otherTopic), offsetsAdapter.SchemaInitializingQueries(otherTopic)...) {
+		_, err := db.ExecContext(ctx, q.Query, q.Args...)
+		require.NoError(t, err)
+	}
+
+	err = sql.VerifySchema(ctx, db, sql.SQLiteSchemaIntrospector{}, schemaAdapter, offsetsAdapter, otherTopic)
+	assert.NoError(t, err)
+}
+
+func TestSchemaIntrospector_publisherAndSubscriber(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topic := "unverified_" + watermill.NewShortUUID()
+
+	publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+		SchemaAdapter:      sql.DefaultSQLiteSchema{},
+		SchemaIntrospector: sql.SQLiteSchemaIntrospector{},
+	}, logger)
+	require.NoError(t, err)
+
+	err = publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte("{}")))
+	var mismatchErr *sql.SchemaMismatchError
+	require.ErrorAs(t, err, &mismatchErr)
+	assert.Equal(t, []string{"table watermill_" + topic + " doesn't exist"}, mismatchErr.Differences)
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:      sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:     sql.DefaultSQLiteOffsetsAdapter{},
+		SchemaIntrospector: sql.SQLiteSchemaIntrospector{},
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	_, err = subscriber.Subscribe(context.Background(), topic)
+	require.ErrorAs(t, err, &mismatchErr)
+	assert.Len(t, mismatchErr.Differences, 2)
+
+	initializingSubscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:      sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:     sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema:   true,
+		SchemaIntrospector: sql.SQLiteSchemaIntrospector{},
+	}, logger)
+	require.NoError(t, err)
+	defer initializingSubscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err = initializingSubscriber.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte("{}"))))
+}
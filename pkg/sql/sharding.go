@@ -0,0 +1,225 @@
+package sql
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// ShardedSchema spreads the messages of a topic across a fixed number of shards, assigned by Partitioner.
+// Every shard is stored as a separate topic (with its own messages table), so inserts into different shards
+// don't contend on the same table and its indexes.
+//
+// Messages are published with ShardedPublisher and consumed with ShardedSubscriber, wrapping the publisher
+// and the subscriber of this package. The number of shards can't be changed without re-publishing the messages,
+// as the partition keys would be mapped to other shards.
+type ShardedSchema struct {
+	// Shards is the number of shards of every topic. It's required.
+	Shards int
+
+	// Partitioner assigns the published messages to shards.
+	//
+	// Default value is HashPartitioner, so messages with the same PartitionKeyMetadataKey are stored in one shard.
+	Partitioner Partitioner
+
+	// GenerateShardTopic may be used to override how the topic of a shard is named.
+	//
+	// By default, the shard's number is appended to the topic, like "orders_shard_0".
+	GenerateShardTopic func(topic string, shard int) string
+}
+
+func (s ShardedSchema) validate() error {
+	if s.Shards <= 0 {
+		return errors.New("shards must be a positive number")
+	}
+
+	return nil
+}
+
+// ShardTopic returns the topic storing the messages of the shard.
+func (s ShardedSchema) ShardTopic(topic string, shard int) string {
+	if s.GenerateShardTopic != nil {
+		return s.GenerateShardTopic(topic, shard)
+	}
+
+	return topic + "_shard_" + strconv.Itoa(shard)
+}
+
+// ShardTopics returns the topics of all shards.
+func (s ShardedSchema) ShardTopics(topic string) []string {
+	topics := make([]string, s.Shards)
+	for shard := range topics {
+		topics[shard] = s.ShardTopic(topic, shard)
+	}
+
+	return topics
+}
+
+func (s ShardedSchema) partitioner() Partitioner {
+	if s.Partitioner != nil {
+		return s.Partitioner
+	}
+
+	return HashPartitioner{}
+}
+
+// ShardedPublisher publishes every message to the topic of its shard (see ShardedSchema).
+type ShardedPublisher struct {
+	publisher message.Publisher
+	schema    ShardedSchema
+}
+
+// NewShardedPublisher creates ShardedPublisher publishing with the publisher, usually a Publisher of this package.
+func NewShardedPublisher(publisher message.Publisher, schema ShardedSchema) (*ShardedPublisher, error) {
+	if publisher == nil {
+		return nil, errors.New("publisher is nil")
+	}
+	if err := schema.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid schema")
+	}
+
+	return &ShardedPublisher{
+		publisher: publisher,
+		schema:    schema,
+	}, nil
+}
+
+// Publish publishes the messages of every shard with one call of the wrapped publisher.
+// Publishing is not atomic across shards: when it fails, messages of some shards may be already published.
+func (p *ShardedPublisher) Publish(topic string, messages ...*message.Message) error {
+	partitions := p.schema.partitioner().Partitions(topic, messages, p.schema.Shards)
+	if len(partitions) != len(messages) {
+		return errors.Errorf("partitioner returned %d partitions for %d messages", len(partitions), len(messages))
+	}
+
+	byShard := map[int][]*message.Message{}
+	var shards []int
+	for i, msg := range messages {
+		shard := partitions[i]
+		if shard < 0 || shard >= p.schema.Shards {
+			return errors.Errorf("partitioner returned shard %d out of range, topics have %d shards", shard, p.schema.Shards)
+		}
+		if _, ok := byShard[shard]; !ok {
+			shards = append(shards, shard)
+		}
+		byShard[shard] = append(byShard[shard], msg)
+	}
+
+	for _, shard := range shards {
+		if err := p.publisher.Publish(p.schema.ShardTopic(topic, shard), byShard[shard]...); err != nil {
+			return errors.Wrapf(err, "could not publish to shard %d", shard)
+		}
+	}
+
+	return nil
+}
+
+func (p *ShardedPublisher) Close() error {
+	return p.publisher.Close()
+}
+
+// ShardedSubscriber consumes the messages of the assigned shards of topics (see ShardedSchema).
+// Order is preserved only within a shard, so the messages with the same partition key are delivered in order.
+type ShardedSubscriber struct {
+	subscriber message.Subscriber
+	schema     ShardedSchema
+	shards     []int
+}
+
+// NewShardedSubscriber creates ShardedSubscriber consuming the shards with the subscriber,
+// usually a Subscriber of this package. If no shards are passed, all shards are consumed.
+//
+// To spread consuming across multiple instances, every shard should be assigned to one instance,
+// or all instances should share the consumer group with an offsets adapter locking the messages.
+func NewShardedSubscriber(subscriber message.Subscriber, schema ShardedSchema, shards ...int) (*ShardedSubscriber, error) {
+	if subscriber == nil {
+		return nil, errors.New("subscriber is nil")
+	}
+	if err := schema.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid schema")
+	}
+
+	if len(shards) == 0 {
+		for shard := 0; shard < schema.Shards; shard++ {
+			shards = append(shards, shard)
+		}
+	}
+
+	assigned := map[int]struct{}{}
+	for _, shard := range shards {
+		if shard < 0 || shard >= schema.Shards {
+			return nil, errors.Errorf("shard %d out of range, topics have %d shards", shard, schema.Shards)
+		}
+		if _, ok := assigned[shard]; ok {
+			return nil, errors.Errorf("shard %d assigned twice", shard)
+		}
+		assigned[shard] = struct{}{}
+	}
+
+	return &ShardedSubscriber{
+		subscriber: subscriber,
+		schema:     schema,
+		shards:     shards,
+	}, nil
+}
+
+// Subscribe subscribes to the topics of the assigned shards, and merges their messages into the returned channel.
+// The channel is closed when the subscriptions of all shards are closed.
+func (s *ShardedSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	out := make(chan *message.Message)
+	wg := &sync.WaitGroup{}
+
+	for _, shard := range s.shards {
+		messages, err := s.subscriber.Subscribe(ctx, s.schema.ShardTopic(topic, shard))
+		if err != nil {
+			cancel()
+			return nil, errors.Wrapf(err, "could not subscribe to shard %d", shard)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for msg := range messages {
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+// SubscribeInitialize initializes the schema of the assigned shards, if the subscriber supports it.
+func (s *ShardedSubscriber) SubscribeInitialize(topic string) error {
+	initializer, ok := s.subscriber.(message.SubscribeInitializer)
+	if !ok {
+		return errors.New("subscriber doesn't support initializing topics")
+	}
+
+	for _, shard := range s.shards {
+		if err := initializer.SubscribeInitialize(s.schema.ShardTopic(topic, shard)); err != nil {
+			return errors.Wrapf(err, "could not initialize shard %d", shard)
+		}
+	}
+
+	return nil
+}
+
+func (s *ShardedSubscriber) Close() error {
+	return s.subscriber.Close()
+}
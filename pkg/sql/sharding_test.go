@@ -0,0 +1,139 @@
+package sql_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedSchema(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topic := "sharded_" + watermill.NewShortUUID()
+	schema := sql.ShardedSchema{Shards: 3}
+
+	publisher, err := sql.NewShardedPublisher(newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{}), schema)
+	require.NoError(t, err)
+
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	var messages []*message.Message
+	for i := 0; i < 30; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(strconv.Itoa(i)))
+		msg.Metadata.Set(sql.PartitionKeyMetadataKey, keys[i%len(keys)])
+		messages = append(messages, msg)
+	}
+	require.NoError(t, publisher.Publish(topic, messages...))
+
+	newSubscriber := func(shards ...int) *sql.ShardedSubscriber {
+		subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+			SchemaAdapter:    sql.DefaultSQLiteSchema{},
+			OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+			InitializeSchema: true,
+			PollInterval:     time.Millisecond * 10,
+		}, logger)
+		require.NoError(t, err)
+
+		sharded, err := sql.NewShardedSubscriber(subscriber, schema, shards...)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, sharded.Close())
+		})
+		return sharded
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	receivedByKey := map[string][]int{}
+	subscriberOfKey := map[string]int{}
+	received := 0
+	for i, subscriber := range []*sql.ShardedSubscriber{newSubscriber(0, 1), newSubscriber(2)} {
+		var expected int
+		for _, msg := range messages {
+			if (sql.HashPartitioner{}.Partition(msg, schema.Shards) == 2) == (i == 1) {
+				expected++
+			}
+		}
+
+		consumed, err := subscriber.Subscribe(ctx, topic)
+		require.NoError(t, err)
+
+		for n := 0; n < expected; n++ {
+			select {
+			case msg := <-consumed:
+				key := msg.Metadata.Get(sql.PartitionKeyMetadataKey)
+				value, err := strconv.Atoi(string(msg.Payload))
+				require.NoError(t, err)
+
+				receivedByKey[key] = append(receivedByKey[key], value)
+				if previous, ok := subscriberOfKey[key]; ok {
+					assert.Equal(t, previous, i, "messages of key %s consumed by different subscribers", key)
+				}
+				subscriberOfKey[key] = i
+				received++
+				msg.Ack()
+			case <-ctx.Done():
+				t.Fatal("timeout waiting for messages")
+			}
+		}
+	}
+
+	assert.Equal(t, len(messages), received)
+	for key, values := range receivedByKey {
+		assert.IsIncreasing(t, values, "order of key %s", key)
+	}
+}
+
+func TestShardedPublisher_Partitioner(t *testing.T) {
+	sqlDB := newSQLite(t)
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topic := "sharded_" + watermill.NewShortUUID()
+	schema := sql.ShardedSchema{Shards: 2, Partitioner: sql.NewRoundRobinPartitioner()}
+
+	publisher, err := sql.NewShardedPublisher(newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{}), schema)
+	require.NoError(t, err)
+
+	var messages []*message.Message
+	for i := 0; i < 4; i++ {
+		messages = append(messages, message.NewMessage(watermill.NewUUID(), nil))
+	}
+	require.NoError(t, publisher.Publish(topic, messages...))
+
+	for shard, shardTopic := range schema.ShardTopics(topic) {
+		rows, err := sqlDB.Query(`SELECT uuid FROM "watermill_` + shardTopic + `" ORDER BY "offset"`)
+		require.NoError(t, err)
+
+		var uuids []string
+		for rows.Next() {
+			var uuid string
+			require.NoError(t, rows.Scan(&uuid))
+			uuids = append(uuids, uuid)
+		}
+		require.NoError(t, rows.Close())
+
+		assert.Equal(t, []string{messages[shard].UUID, messages[shard+2].UUID}, uuids)
+	}
+}
+
+func TestNewShardedSubscriber_invalidShards(t *testing.T) {
+	subscriber, err := sql.NewSubscriber(newSQLite(t), sql.SubscriberConfig{
+		SchemaAdapter:  sql.DefaultSQLiteSchema{},
+		OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+	}, logger)
+	require.NoError(t, err)
+
+	_, err = sql.NewShardedSubscriber(subscriber, sql.ShardedSchema{Shards: 2}, 2)
+	assert.Error(t, err)
+
+	_, err = sql.NewShardedSubscriber(subscriber, sql.ShardedSchema{Shards: 2}, 1, 1)
+	assert.Error(t, err)
+
+	_, err = sql.NewShardedSubscriber(subscriber, sql.ShardedSchema{})
+	assert.Error(t, err)
+}
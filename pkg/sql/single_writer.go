@@ -0,0 +1,375 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// ErrSingleWriterClosed is returned by SingleWriter for writes requested after it was closed.
+var ErrSingleWriterClosed = errors.New("single writer is closed")
+
+type SingleWriterConfig struct {
+	// MaxBatchSize is the maximum number of queued statements executed (with ExecContext) in one transaction.
+	// Statements are batched only when they are queued while the previous batch is written,
+	// so a single statement is not delayed.
+	//
+	// Default value is 100.
+	MaxBatchSize int
+
+	// QueueSize is the size of the buffer of the queue of writes.
+	// Writes requested when the buffer is full wait until there's space in the queue, or until their context is canceled.
+	//
+	// Default value is 1024.
+	QueueSize int
+}
+
+func (c *SingleWriterConfig) setDefaults() {
+	if c.MaxBatchSize == 0 {
+		c.MaxBatchSize = 100
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = 1024
+	}
+}
+
+func (c SingleWriterConfig) validate() error {
+	if c.MaxBatchSize < 0 {
+		return errors.New("max batch size must be non-negative")
+	}
+	if c.QueueSize < 0 {
+		return errors.New("queue size must be non-negative")
+	}
+
+	return nil
+}
+
+// SingleWriter is a TxBeginner funneling all writes through one goroutine, for SQLite deployments where
+// publishers, subscribers and background jobs (like DeleteAckedMessages) of one process share the database.
+// SQLite allows only one writer at a time, so concurrent writers otherwise contend for the lock,
+// which shows up as interleaved SQLITE_BUSY errors under load. With SingleWriter, writes wait in the queue instead.
+//
+// Statements executed with ExecContext are batched into one transaction when they are queued concurrently,
+// each one in its own savepoint, so a failing statement doesn't fail the others. Transactions begun with BeginTx
+// are executed one at a time: writes requested while a transaction is open wait until it's committed
+// or rolled back. Consequently, writes outside the transaction made while it's open, like publishing
+// with another publisher in the handler of a subscriber consuming in a transaction, wait until the handler returns;
+// use TxFromContext in such handlers instead.
+//
+// Queries executed with QueryContext outside transactions, and read-only transactions, don't go through the queue,
+// so they must not write.
+type SingleWriter struct {
+	db     TxBeginner
+	config SingleWriterConfig
+
+	requests chan singleWriterRequest
+	closing  chan struct{}
+	closed   chan struct{}
+	once     sync.Once
+
+	logger watermill.LoggerAdapter
+}
+
+type singleWriterRequest struct {
+	ctx context.Context
+
+	query string
+	args  []any
+
+	beginTx   bool
+	txOptions *sql.TxOptions
+
+	response chan singleWriterResponse
+}
+
+type singleWriterResponse struct {
+	result Result
+	tx     *singleWriterTx
+	err    error
+}
+
+// NewSingleWriter creates SingleWriter writing with db. The writing goroutine runs until Close is called.
+func NewSingleWriter(db TxBeginner, config SingleWriterConfig, logger watermill.LoggerAdapter) (*SingleWriter, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	w := &SingleWriter{
+		db:       db,
+		config:   config,
+		requests: make(chan singleWriterRequest, config.QueueSize),
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+		logger:   logger,
+	}
+	go w.run()
+
+	return w, nil
+}
+
+// ExecContext queues the statement and waits until it's executed.
+func (w *SingleWriter) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	response, err := w.request(singleWriterRequest{ctx: ctx, query: query, args: args})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.result, response.err
+}
+
+// QueryContext executes the query directly with the database handle, as it doesn't write.
+func (w *SingleWriter) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	return w.db.QueryContext(ctx, query, args...)
+}
+
+// BeginTx queues the transaction and waits until it's begun. The writes queued after it wait until
+// it's committed or rolled back (or until its context is canceled, which rolls it back).
+// Read-only transactions are begun directly with the database handle.
+func (w *SingleWriter) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	if opts != nil && opts.ReadOnly {
+		return w.db.BeginTx(ctx, opts)
+	}
+
+	response, err := w.request(singleWriterRequest{ctx: ctx, beginTx: true, txOptions: opts})
+	if err != nil {
+		return nil, err
+	}
+	if response.err != nil {
+		return nil, response.err
+	}
+
+	return response.tx, nil
+}
+
+// Close stops the writing goroutine after the current write is finished. Queued writes fail with ErrSingleWriterClosed.
+// The database handle is not closed.
+func (w *SingleWriter) Close() error {
+	w.once.Do(func() {
+		close(w.closing)
+	})
+	<-w.closed
+
+	return nil
+}
+
+func (w *SingleWriter) request(request singleWriterRequest) (singleWriterResponse, error) {
+	// The response is buffered, so the writer doesn't wait for requests which were canceled.
+	request.response = make(chan singleWriterResponse, 1)
+
+	select {
+	case <-w.closing:
+		return singleWriterResponse{}, ErrSingleWriterClosed
+	default:
+	}
+
+	select {
+	case w.requests <- request:
+	case <-w.closing:
+		return singleWriterResponse{}, ErrSingleWriterClosed
+	case <-request.ctx.Done():
+		return singleWriterResponse{}, request.ctx.Err()
+	}
+
+	select {
+	case response := <-request.response:
+		if response.tx != nil && request.ctx.Err() != nil {
+			// The transaction was begun after the caller stopped waiting.
+			_ = response.tx.Rollback()
+			return singleWriterResponse{}, request.ctx.Err()
+		}
+		return response, nil
+	case <-w.closed:
+		// The request was queued after the writer rejected the queued requests.
+		select {
+		case response := <-request.response:
+			return response, nil
+		default:
+			return singleWriterResponse{}, ErrSingleWriterClosed
+		}
+	case <-request.ctx.Done():
+		go func() {
+			// The transaction may be begun meanwhile, and it must be finished, so the writer continues.
+			if response := <-request.response; response.tx != nil {
+				_ = response.tx.Rollback()
+			}
+		}()
+		return singleWriterResponse{}, request.ctx.Err()
+	}
+}
+
+func (w *SingleWriter) run() {
+	defer close(w.closed)
+
+	for {
+		var request singleWriterRequest
+		select {
+		case request = <-w.requests:
+		case <-w.closing:
+			w.rejectQueued()
+			return
+		}
+
+		if request.beginTx {
+			w.runTx(request)
+			continue
+		}
+
+		batch := []singleWriterRequest{request}
+		var next *singleWriterRequest
+	Batching:
+		for len(batch) < w.config.MaxBatchSize {
+			select {
+			case queued := <-w.requests:
+				if queued.beginTx {
+					next = &queued
+					break Batching
+				}
+				batch = append(batch, queued)
+			default:
+				break Batching
+			}
+		}
+
+		w.execBatch(batch)
+		if next != nil {
+			w.runTx(*next)
+		}
+	}
+}
+
+func (w *SingleWriter) rejectQueued() {
+	for {
+		select {
+		case request := <-w.requests:
+			request.response <- singleWriterResponse{err: ErrSingleWriterClosed}
+		default:
+			return
+		}
+	}
+}
+
+// runTx begins the transaction and waits until it's finished.
+func (w *SingleWriter) runTx(request singleWriterRequest) {
+	if request.ctx.Err() != nil {
+		request.response <- singleWriterResponse{err: request.ctx.Err()}
+		return
+	}
+
+	tx, err := w.db.BeginTx(request.ctx, request.txOptions)
+	if err != nil {
+		request.response <- singleWriterResponse{err: err}
+		return
+	}
+
+	writerTx := &singleWriterTx{Tx: tx, finished: make(chan struct{})}
+	request.response <- singleWriterResponse{tx: writerTx}
+
+	select {
+	case <-writerTx.finished:
+	case <-request.ctx.Done():
+		// The transaction is rolled back by the database handle, when its context is canceled.
+		w.logger.Debug("Transaction of single writer canceled", nil)
+	}
+}
+
+// execBatch executes the statements in one transaction, each one in its own savepoint.
+// A single statement is executed without a transaction.
+func (w *SingleWriter) execBatch(batch []singleWriterRequest) {
+	var pending []singleWriterRequest
+	for _, request := range batch {
+		if request.ctx.Err() != nil {
+			request.response <- singleWriterResponse{err: request.ctx.Err()}
+			continue
+		}
+		pending = append(pending, request)
+	}
+
+	if len(pending) == 0 {
+		return
+	}
+	if len(pending) == 1 {
+		result, err := w.db.ExecContext(pending[0].ctx, pending[0].query, pending[0].args...)
+		pending[0].response <- singleWriterResponse{result: result, err: err}
+		return
+	}
+
+	// Statements were already requested, so they are executed even if their contexts are canceled meanwhile,
+	// as canceling one of them shouldn't abort the whole batch.
+	ctx := context.Background()
+	responses := make([]singleWriterResponse, len(pending))
+
+	err := runInTx(ctx, w.db, func(ctx context.Context, tx Tx) error {
+		for i, request := range pending {
+			responses[i] = w.execInSavepoint(ctx, tx, request)
+		}
+		return nil
+	})
+	if err != nil {
+		err = errors.Wrap(err, "could not commit batch of writes")
+		for i := range responses {
+			if responses[i].err == nil {
+				responses[i] = singleWriterResponse{err: err}
+			}
+		}
+	}
+
+	for i, request := range pending {
+		request.response <- responses[i]
+	}
+}
+
+func (w *SingleWriter) execInSavepoint(ctx context.Context, tx Tx, request singleWriterRequest) singleWriterResponse {
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT watermill_single_writer`); err != nil {
+		return singleWriterResponse{err: errors.Wrap(err, "could not create savepoint")}
+	}
+
+	result, err := tx.ExecContext(ctx, request.query, request.args...)
+	if err != nil {
+		if _, rollbackErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT watermill_single_writer`); rollbackErr != nil {
+			err = errors.Wrapf(err, "could not roll back to savepoint: %v", rollbackErr)
+		}
+	}
+	if _, releaseErr := tx.ExecContext(ctx, `RELEASE SAVEPOINT watermill_single_writer`); releaseErr != nil && err == nil {
+		err = errors.Wrap(releaseErr, "could not release savepoint")
+	}
+
+	return singleWriterResponse{result: result, err: err}
+}
+
+// singleWriterTx is a transaction of SingleWriter, which lets the writer continue when it's finished.
+type singleWriterTx struct {
+	Tx
+	finished chan struct{}
+	once     sync.Once
+}
+
+func (t *singleWriterTx) Commit() error {
+	defer t.finish()
+	return t.Tx.Commit()
+}
+
+func (t *singleWriterTx) Rollback() error {
+	defer t.finish()
+	return t.Tx.Rollback()
+}
+
+func (t *singleWriterTx) finish() {
+	t.once.Do(func() {
+		close(t.finished)
+	})
+}
+
+func (t *singleWriterTx) unwrapTx() Tx {
+	return t.Tx
+}
@@ -0,0 +1,139 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSQLiteWithoutBusyTimeout opens a new database failing with SQLITE_BUSY immediately when it's locked.
+func newSQLiteWithoutBusyTimeout(t *testing.T) *stdSQL.DB {
+	db, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "single_writer.sqlite")+"?_pragma=busy_timeout(0)&_pragma=journal_mode(WAL)")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return db
+}
+
+func TestSingleWriter(t *testing.T) {
+	writer, err := sql.NewSingleWriter(sql.BeginnerFromStdSQL(newSQLiteWithoutBusyTimeout(t)), sql.SingleWriterConfig{}, logger)
+	require.NoError(t, err)
+	defer writer.Close()
+
+	topicName := "single_writer_" + watermill.NewShortUUID()
+	schemaAdapter := newSQLiteSchemaAdapter(10)
+
+	publisher, err := sql.NewPublisherWithExecutor(writer, sql.PublisherConfig{
+		SchemaAdapter:        schemaAdapter,
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(writer, sql.SubscriberConfig{
+		ConsumerGroup:    "single_writer",
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	require.NoError(t, subscriber.SubscribeInitialize(topicName))
+	consumed, err := subscriber.Subscribe(context.Background(), topicName)
+	require.NoError(t, err)
+
+	publishers, messagesPerPublisher := 10, 10
+	errs := make(chan error, publishers*messagesPerPublisher)
+	var wg sync.WaitGroup
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messagesPerPublisher; j++ {
+				errs <- publisher.Publish(topicName, message.NewMessage(watermill.NewUUID(), nil))
+			}
+		}()
+	}
+
+	received := map[string]struct{}{}
+	for len(received) < publishers*messagesPerPublisher {
+		select {
+		case msg := <-consumed:
+			received[msg.UUID] = struct{}{}
+			msg.Ack()
+		case <-time.After(time.Second * 10):
+			t.Fatalf("timeout waiting for messages, received %d", len(received))
+		}
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err, "writes should wait in the queue instead of failing with SQLITE_BUSY")
+	}
+}
+
+func TestSingleWriter_batch(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteWithoutBusyTimeout(t)
+	writer, err := sql.NewSingleWriter(sql.BeginnerFromStdSQL(db), sql.SingleWriterConfig{}, logger)
+	require.NoError(t, err)
+	defer writer.Close()
+
+	_, err = writer.ExecContext(ctx, `CREATE TABLE "values" ("value" INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+
+	// The open transaction holds the writer, so the following statements are queued and executed in one batch.
+	tx, err := writer.BeginTx(ctx, nil)
+	require.NoError(t, err)
+
+	errs := make([]error, 5)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value := i
+			if i == 2 {
+				// Violates the primary key of the value inserted in the transaction.
+				value = 100
+			}
+			_, errs[i] = writer.ExecContext(ctx, fmt.Sprintf(`INSERT INTO "values" ("value") VALUES (%d)`, value))
+		}(i)
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO "values" ("value") VALUES (100)`)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	wg.Wait()
+
+	for i, err := range errs {
+		if i == 2 {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM "values"`).Scan(&count))
+	assert.Equal(t, 5, count, "failing statement should not roll back the other statements of the batch")
+
+	require.NoError(t, writer.Close())
+	_, err = writer.ExecContext(ctx, `DELETE FROM "values"`)
+	assert.ErrorIs(t, err, sql.ErrSingleWriterClosed)
+}
@@ -0,0 +1,149 @@
+package sql
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SkippedAnnotationKeyPrefix prefixes the key of the annotation (see AnnotatingTopicAdmin) recording that
+// the message was skipped by SQLiteTopicAdmin.Skip. It's followed by the consumer group.
+const SkippedAnnotationKeyPrefix = "skipped:"
+
+// SkipTarget selects the message skipped by SQLiteTopicAdmin.Skip, by its offset or UUID.
+type SkipTarget struct {
+	Offset int64
+	UUID   string
+}
+
+func (t SkipTarget) validate() error {
+	if t.Offset == 0 && t.UUID == "" {
+		return errors.New("offset or uuid is required")
+	}
+	if t.Offset != 0 && t.UUID != "" {
+		return errors.New("only one of offset and uuid can be set")
+	}
+	if t.Offset < 0 {
+		return errors.New("offset must be positive")
+	}
+
+	return nil
+}
+
+// Skip acks the message for the consumer group without handling it, for example, when a poison message
+// is blocking the consumer group. The skip is recorded as an annotation of the message
+// (with the key SkippedAnnotationKeyPrefix followed by the consumer group), so it's shown by PeekMessages.
+//
+// Only the message following the acked offset of the consumer group can be skipped, so the consumer group
+// doesn't skip the messages before it. Subscribers redelivering the message don't need to be stopped:
+// the skip fails if they acked the message meanwhile, otherwise they continue after the message
+// at their next query.
+func (a SQLiteTopicAdmin) Skip(ctx context.Context, topic string, consumerGroup string, target SkipTarget) error {
+	if err := validateTopicName(topic); err != nil {
+		return err
+	}
+	if err := target.validate(); err != nil {
+		return errors.Wrap(err, "invalid skip target")
+	}
+
+	messagesTable := a.SchemaAdapter.MessagesTable(topic)
+	where, arg := `"offset" = ?`, any(target.Offset)
+	if target.UUID != "" {
+		where, arg = `"uuid" = ?`, target.UUID
+	}
+
+	var offset int64
+	var uuid string
+	found, err := a.queryRow(ctx, []any{&offset, &uuid}, `SELECT "offset", "uuid" FROM `+messagesTable+` WHERE `+where, arg)
+	if err != nil {
+		return errors.Wrap(err, "could not query message")
+	}
+	if !found {
+		return ErrMessageNotFound
+	}
+
+	offsetsTable := a.OffsetsAdapter.MessagesOffsetsTable(topic)
+	exists, err := a.tableExists(ctx, strings.Trim(offsetsTable, `"`))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		for _, q := range a.OffsetsAdapter.SchemaInitializingQueries(topic) {
+			if _, err := a.DB.ExecContext(ctx, q.Query, q.Args...); err != nil {
+				return errors.Wrap(err, "could not create offsets table")
+			}
+		}
+	}
+
+	var offsetAcked int64
+	_, err = a.queryRow(ctx, []any{&offsetAcked}, `SELECT offset_acked FROM `+offsetsTable+` WHERE consumer_group = ?`, consumerGroup)
+	if err != nil {
+		return errors.Wrap(err, "could not query acked offset")
+	}
+	if offsetAcked >= offset {
+		return errors.Errorf("message %d was already acked by consumer group %s", offset, consumerGroup)
+	}
+
+	var nextOffset int64
+	_, err = a.queryRow(
+		ctx,
+		[]any{&nextOffset},
+		`SELECT "offset" FROM `+messagesTable+` WHERE "offset" > ? ORDER BY "offset" ASC LIMIT 1`,
+		offsetAcked,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not query next message")
+	}
+	if nextOffset != offset {
+		return errors.Errorf(
+			"message %d is not the next message of consumer group %s (message %d is), skipping it would skip the messages before it",
+			offset, consumerGroup, nextOffset,
+		)
+	}
+
+	// The acked offset is compared, so messages acked by subscribers since it was queried are not overwritten.
+	res, err := a.DB.ExecContext(
+		ctx,
+		`INSERT INTO `+offsetsTable+` (offset_consumed, offset_acked, consumer_group)
+		VALUES (?, ?, ?)
+		ON CONFLICT (consumer_group)
+		DO UPDATE SET offset_consumed = excluded.offset_consumed, offset_acked = excluded.offset_acked
+		WHERE offset_acked = ?`,
+		offset, offset, consumerGroup, offsetAcked,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not ack skipped message")
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "could not get number of acked offsets")
+	}
+	if affected == 0 {
+		return errors.Errorf("acked offset of consumer group %s changed, the message was not skipped", consumerGroup)
+	}
+
+	if err := a.Annotate(ctx, topic, uuid, SkippedAnnotationKeyPrefix+consumerGroup, "skipped manually"); err != nil {
+		return errors.Wrap(err, "could not record skip")
+	}
+
+	return nil
+}
+
+// queryRow scans the first row returned by the query into dest, returning false if there are no rows.
+func (a SQLiteTopicAdmin) queryRow(ctx context.Context, dest []any, query string, args ...any) (bool, error) {
+	rows, err := a.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return false, err
+	}
+
+	return true, rows.Err()
+}
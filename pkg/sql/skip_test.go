@@ -0,0 +1,75 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteTopicAdmin_Skip(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "skip.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topic := "skip_" + watermill.NewShortUUID()
+
+	var published []*message.Message
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+	for i := 0; i < 3; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), nil)
+		require.NoError(t, publisher.Publish(topic, msg))
+		published = append(published, msg)
+	}
+
+	admin := sql.SQLiteTopicAdmin{DB: db}
+
+	assert.Error(t, admin.Skip(ctx, topic, "workers", sql.SkipTarget{}))
+	assert.Error(t, admin.Skip(ctx, topic, "workers", sql.SkipTarget{Offset: 1, UUID: published[0].UUID}))
+	assert.ErrorIs(t, admin.Skip(ctx, topic, "workers", sql.SkipTarget{UUID: "missing"}), sql.ErrMessageNotFound)
+	assert.Error(t, admin.Skip(ctx, topic, "workers", sql.SkipTarget{Offset: 2}), "messages before the skipped message should not be skipped")
+
+	require.NoError(t, admin.Skip(ctx, topic, "workers", sql.SkipTarget{UUID: published[0].UUID}))
+	assert.Error(t, admin.Skip(ctx, topic, "workers", sql.SkipTarget{Offset: 1}), "acked message should not be skipped")
+	require.NoError(t, admin.Skip(ctx, topic, "workers", sql.SkipTarget{Offset: 2}))
+
+	groups, err := admin.ConsumerGroups(ctx, topic)
+	require.NoError(t, err)
+	assert.Equal(t, []sql.ConsumerGroupLag{{ConsumerGroup: "workers", OffsetAcked: 2, Lag: 1}}, groups)
+
+	peeked, err := admin.PeekMessages(ctx, topic, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, peeked, 3)
+	require.Len(t, peeked[1].Annotations, 1)
+	assert.Equal(t, sql.SkippedAnnotationKeyPrefix+"workers", peeked[1].Annotations[0].Key)
+	assert.Empty(t, peeked[2].Annotations)
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "workers",
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	consumed, err := subscriber.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	select {
+	case msg := <-consumed:
+		assert.Equal(t, published[2].UUID, msg.UUID, "skipped messages should not be delivered")
+		msg.Ack()
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout waiting for message")
+	}
+}
@@ -0,0 +1,198 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// SnapshotMetadataKey is the metadata key set to "true" in the messages of the snapshot
+// delivered by SubscribeWithSnapshot, so handlers can tell them from the messages of the topic.
+const SnapshotMetadataKey = "snapshot"
+
+// Snapshot is the initial state delivered by SubscribeWithSnapshot before the messages of the topic.
+type Snapshot struct {
+	// Query selects the rows of the snapshot, for example, the current state of a projection table. It's required.
+	Query Query
+
+	// UnmarshalRow converts a row selected by Query to a message. It's required.
+	UnmarshalRow func(row Scanner) (*message.Message, error)
+
+	// OffsetQuery may select the offset of the topic's last message reflected by the snapshot
+	// (for example, stored with the projection). The acked offset of the consumer group is set to it,
+	// so the topic is consumed from the first message missing in the snapshot. It requires
+	// the offsets adapter to implement CheckpointingOffsetsAdapter.
+	//
+	// If it's zero, the topic is consumed from the acked offset of the consumer group.
+	OffsetQuery Query
+}
+
+func (s Snapshot) validate() error {
+	if s.Query.IsZero() {
+		return errors.New("snapshot query is empty")
+	}
+	if s.UnmarshalRow == nil {
+		return errors.New("snapshot UnmarshalRow is nil")
+	}
+
+	return nil
+}
+
+// SubscribeWithSnapshot works like Subscribe, but it first delivers the messages unmarshaled from the rows
+// of the snapshot's query, and then consumes the topic, so a new consumer can be bootstrapped from the current state
+// instead of all messages of the topic. Messages of the snapshot are delivered one by one, after the previous one
+// is acked, and they have SnapshotMetadataKey set.
+//
+// The snapshot is queried in a transaction with the isolation level of the schema adapter (SubscribeIsolationLevel),
+// which is kept open until all rows are acked. The offset selected by Snapshot.OffsetQuery is set first
+// in the same transaction, so other writers of the offset (and in SQLite, all writers of the database)
+// wait until the snapshot is delivered. The snapshot and the offset are consistent if the isolation level reads
+// from one snapshot of the database (like in SQLite, or with repeatable read in PostgreSQL and MySQL).
+//
+// If the subscription stops before all rows are acked, the offset is not set, and the snapshot is delivered
+// from the beginning again by the next SubscribeWithSnapshot. When the query fails, or a message is not acked
+// within AckDeadline, the snapshot is delivered from the beginning after RetryInterval.
+func (s *Subscriber) SubscribeWithSnapshot(
+	ctx context.Context,
+	topic string,
+	snapshot Snapshot,
+) (<-chan *message.Message, error) {
+	if err := snapshot.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid snapshot")
+	}
+
+	var offsetsAdapter CheckpointingOffsetsAdapter
+	if !snapshot.OffsetQuery.IsZero() {
+		var ok bool
+		offsetsAdapter, ok = s.config.OffsetsAdapter.(CheckpointingOffsetsAdapter)
+		if !ok {
+			return nil, errors.New("snapshot offset query requires the offsets adapter to implement CheckpointingOffsetsAdapter")
+		}
+	}
+
+	if err := s.prepareSubscription(ctx, topic); err != nil {
+		return nil, err
+	}
+
+	deliverSnapshot := func(ctx context.Context, out chan *message.Message) bool {
+		logger := s.logger.With(watermill.LogFields{
+			"topic":          topic,
+			"consumer_group": s.config.ConsumerGroup,
+		})
+
+		for {
+			err := s.deliverSnapshot(ctx, topic, snapshot, offsetsAdapter, out, logger)
+			if err == nil {
+				return true
+			}
+			if ctx.Err() != nil {
+				return false
+			}
+
+			logger.Error("Could not deliver snapshot, retrying", err, watermill.LogFields{
+				"wait_time": s.config.RetryInterval,
+			})
+
+			select {
+			case <-time.After(s.config.RetryInterval):
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+
+	return s.startConsuming(ctx, topic, deliverSnapshot), nil
+}
+
+func (s *Subscriber) deliverSnapshot(
+	ctx context.Context,
+	topic string,
+	snapshot Snapshot,
+	offsetsAdapter CheckpointingOffsetsAdapter,
+	out chan *message.Message,
+	logger watermill.LoggerAdapter,
+) error {
+	txOptions := &sql.TxOptions{
+		Isolation: s.config.SchemaAdapter.SubscribeIsolationLevel(),
+	}
+
+	return runInTxWithOptions(ctx, s.txProvider(), txOptions, func(ctx context.Context, tx Tx) error {
+		// The offset is set before the snapshot is read, so the transaction doesn't need to upgrade
+		// a read-only snapshot of the database for writing, which fails if other transactions wrote meanwhile.
+		if offsetsAdapter != nil {
+			if err := setSnapshotOffset(ctx, tx, topic, s.config.ConsumerGroup, snapshot.OffsetQuery, offsetsAdapter); err != nil {
+				return err
+			}
+		}
+
+		rows, err := tx.QueryContext(ctx, snapshot.Query.Query, snapshot.Query.Args...)
+		if err != nil {
+			return errors.Wrap(err, "could not query snapshot")
+		}
+		defer rows.Close()
+
+		var delivered int
+		for rows.Next() {
+			msg, err := snapshot.UnmarshalRow(rows)
+			if err != nil {
+				return errors.Wrap(err, "could not unmarshal snapshot row")
+			}
+			msg.Metadata.Set(SnapshotMetadataKey, "true")
+
+			msgLogger := logger.With(watermill.LogFields{"msg_uuid": msg.UUID})
+			if !s.sendMessage(ctx, topic, msg, out, nil, msgLogger) {
+				return errors.Errorf("snapshot message %s was not acked", msg.UUID)
+			}
+			delivered++
+		}
+		if err := rows.Err(); err != nil {
+			return errors.Wrap(err, "could not query snapshot")
+		}
+		if err := rows.Close(); err != nil {
+			return errors.Wrap(err, "could not close snapshot rows")
+		}
+
+		logger.Debug("Delivered snapshot", watermill.LogFields{"messages": delivered})
+		return nil
+	})
+}
+
+func setSnapshotOffset(
+	ctx context.Context,
+	tx Tx,
+	topic string,
+	consumerGroup string,
+	offsetQuery Query,
+	offsetsAdapter CheckpointingOffsetsAdapter,
+) error {
+	var offset sql.NullInt64
+	rows, err := tx.QueryContext(ctx, offsetQuery.Query, offsetQuery.Args...)
+	if err != nil {
+		return errors.Wrap(err, "could not query snapshot offset")
+	}
+	if rows.Next() {
+		err = rows.Scan(&offset)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	_ = rows.Close()
+	if err != nil {
+		return errors.Wrap(err, "could not query snapshot offset")
+	}
+	if !offset.Valid {
+		return errors.New("snapshot offset query returned no offset")
+	}
+
+	for _, q := range offsetsAdapter.SetAckedOffsetQueries(topic, consumerGroup, offset.Int64) {
+		if _, err := tx.ExecContext(ctx, q.Query, q.Args...); err != nil {
+			return errors.Wrap(err, "could not set snapshot offset")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriber_SubscribeWithSnapshot(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "snapshot.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topic := "orders_" + watermill.NewShortUUID()
+
+	var published []*message.Message
+	for i := 0; i < 3; i++ {
+		published = append(published, message.NewMessage(watermill.NewUUID(), []byte("placed")))
+	}
+	require.NoError(t, newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{}).Publish(topic, published...))
+
+	// The projection reflects the first two messages.
+	_, err = sqlDB.Exec(`CREATE TABLE "order_state" ("id" TEXT PRIMARY KEY, "state" TEXT NOT NULL)`)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO "order_state" VALUES ('order-1', 'placed'), ('order-2', 'placed')`)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec(`CREATE TABLE "order_state_offset" ("offset" INTEGER NOT NULL)`)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO "order_state_offset" VALUES (2)`)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		ConsumerGroup:    "reporting",
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+		ResendInterval:   time.Millisecond * 10,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	snapshot := sql.Snapshot{
+		Query: sql.Query{Query: `SELECT "id", "state" FROM "order_state" ORDER BY "id"`},
+		UnmarshalRow: func(row sql.Scanner) (*message.Message, error) {
+			var id, state string
+			if err := row.Scan(&id, &state); err != nil {
+				return nil, err
+			}
+			return message.NewMessage(id, []byte(state)), nil
+		},
+		OffsetQuery: sql.Query{Query: `SELECT "offset" FROM "order_state_offset"`},
+	}
+
+	messages, err := subscriber.SubscribeWithSnapshot(ctx, topic, snapshot)
+	require.NoError(t, err)
+
+	receive := func() *message.Message {
+		select {
+		case msg := <-messages:
+			return msg
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for messages")
+			return nil
+		}
+	}
+
+	first := receive()
+	assert.Equal(t, "order-1", first.UUID)
+	assert.Equal(t, "true", first.Metadata.Get(sql.SnapshotMetadataKey))
+	first.Nack()
+
+	redelivered := receive()
+	assert.Equal(t, "order-1", redelivered.UUID, "nacked snapshot message should be redelivered")
+	redelivered.Ack()
+
+	second := receive()
+	assert.Equal(t, "order-2", second.UUID)
+	second.Ack()
+
+	tailed := receive()
+	assert.Equal(t, published[2].UUID, tailed.UUID, "messages reflected by the snapshot should be skipped")
+	assert.Empty(t, tailed.Metadata.Get(sql.SnapshotMetadataKey))
+	tailed.Ack()
+
+	_, err = subscriber.SubscribeWithSnapshot(ctx, topic, sql.Snapshot{})
+	assert.ErrorContains(t, err, "snapshot query is empty")
+}
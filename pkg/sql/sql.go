@@ -31,6 +31,43 @@ type Beginner interface {
 	ContextExecutor
 }
 
+// QueryExecutor can perform SQL queries with context, like ContextExecutor, but it doesn't depend on database/sql,
+// so it can be implemented for other database libraries. It's accepted by NewPublisherWithExecutor.
+//
+// It's implemented by the values returned by BeginnerFromStdSQL, TxFromStdSQL, BeginnerFromPgx and TxFromPgx,
+// but it's small enough to be implemented for any other database library.
+type QueryExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (Rows, error)
+}
+
+// TxBeginner begins transactions, like Beginner, but it doesn't depend on database/sql (see QueryExecutor).
+// It's accepted by NewSubscriberWithTxBeginner.
+type TxBeginner interface {
+	BeginTx(context.Context, *sql.TxOptions) (Tx, error)
+	QueryExecutor
+}
+
+// Tx is a transaction started by TxBeginner.
+type Tx interface {
+	QueryExecutor
+	Rollback() error
+	Commit() error
+}
+
+// Result is the result of a query executed with ExecContext.
+type Result interface {
+	RowsAffected() (int64, error)
+}
+
+// Rows is the result of a query executed with QueryContext.
+type Rows interface {
+	Scan(dest ...any) error
+	Close() error
+	Next() bool
+	Err() error
+}
+
 // sqlArgsToLog is used for "lazy" generating sql args strings to logger
 type sqlArgsToLog []interface{}
 
@@ -0,0 +1,49 @@
+package sql
+
+// SQLFragments are custom SQL fragments added to the queries generated by a schema adapter,
+// so it can be tuned without re-implementing it.
+//
+// Fragments are added to the queries as they are, so they must never contain untrusted input.
+// They can't contain placeholders, as the numbering of the query arguments is controlled by the schema adapter.
+type SQLFragments struct {
+	// SelectSuffix is added after the messages table in the FROM clause of SelectQuery,
+	// for example, an index hint like "USE INDEX (idx_offset)" (MySQL) or "INDEXED BY idx_offset" (SQLite).
+	SelectSuffix string
+
+	// WhereExtra is a predicate joined with AND to the WHERE clause of SelectQuery,
+	// for example, "tenant_id = 'acme'" with a column added to the messages table.
+	//
+	// Messages which don't match the predicate are never delivered to the consumer group,
+	// as offsets of the later messages are acked past them.
+	WhereExtra string
+
+	// InsertSuffix is appended to InsertQuery, for example, "ON CONFLICT DO NOTHING" with a unique index
+	// or a RETURNING clause. The publisher doesn't read rows returned by the query.
+	InsertSuffix string
+}
+
+func (f SQLFragments) fromTable(table string) string {
+	if f.SelectSuffix == "" {
+		return table
+	}
+
+	return table + " " + f.SelectSuffix
+}
+
+// andWhereExtra returns the predicate which should be joined with AND to the WHERE clause.
+// It returns an empty string if WhereExtra is empty.
+func (f SQLFragments) andWhereExtra() string {
+	if f.WhereExtra == "" {
+		return ""
+	}
+
+	return "AND (" + f.WhereExtra + ")"
+}
+
+func (f SQLFragments) insertQuery(query string) string {
+	if f.InsertSuffix == "" {
+		return query
+	}
+
+	return query + " " + f.InsertSuffix
+}
@@ -0,0 +1,56 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// StdSQLExecutor is implemented by *sql.DB, *sql.Tx and *sql.Conn, as well as by the executors of ORMs
+// and query builders wrapping them, like gorm.ConnPool (tx.Statement.ConnPool inside a GORM transaction),
+// DBTX of sqlc, or ExecQuerier of ent (implemented by the *entsql.Tx returned by the driver's Tx).
+type StdSQLExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// ExecutorFromStdSQL converts StdSQLExecutor into QueryExecutor, so messages can be published with
+// NewPublisherWithExecutor inside the transaction of an ORM, for example:
+//
+//	db.Transaction(func(tx *gorm.DB) error {
+//		publisher, err := sql.NewPublisherWithExecutor(sql.ExecutorFromStdSQL(tx.Statement.ConnPool), config, logger)
+//		// ...
+//	})
+//
+// Executors which are transactions (*sql.Tx, or executors with Commit and Rollback methods) are recognized
+// by NewPublisherWithExecutor, so AutoInitializeSchema can't be used with them. The returned executor can't commit
+// or roll back the transaction, which is still controlled by the ORM.
+func ExecutorFromStdSQL(executor StdSQLExecutor) QueryExecutor {
+	_, tx := executor.(interface {
+		Commit() error
+		Rollback() error
+	})
+
+	return &stdSQLExecutor{executor: executor, tx: tx}
+}
+
+type stdSQLExecutor struct {
+	executor StdSQLExecutor
+	tx       bool
+}
+
+func (e *stdSQLExecutor) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	return e.executor.ExecContext(ctx, query, args...)
+}
+
+func (e *stdSQLExecutor) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := e.executor.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func (e *stdSQLExecutor) isTransaction() bool {
+	return e.tx
+}
@@ -0,0 +1,51 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutorFromStdSQL(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := newSQLite(t)
+	topic := "orm_" + watermill.NewShortUUID()
+
+	initializingPublisher, err := sql.NewPublisherWithExecutor(sql.ExecutorFromStdSQL(sqlDB), sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	require.NoError(t, initializingPublisher.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+
+	countMessages := func() int {
+		var count int
+		err := sqlDB.QueryRowContext(ctx, `SELECT COUNT(*) FROM "watermill_`+topic+`"`).Scan(&count)
+		require.NoError(t, err)
+		return count
+	}
+
+	// The transaction is controlled by the ORM, represented by *sql.Tx.
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	require.NoError(t, err)
+
+	_, err = sql.NewPublisherWithExecutor(sql.ExecutorFromStdSQL(tx), sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+	}, logger)
+	assert.Error(t, err, "AutoInitializeSchema should be refused in a transaction")
+
+	publisher, err := sql.NewPublisherWithExecutor(sql.ExecutorFromStdSQL(tx), sql.PublisherConfig{
+		SchemaAdapter: sql.DefaultSQLiteSchema{},
+	}, logger)
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+
+	require.NoError(t, tx.Rollback())
+	assert.Equal(t, 1, countMessages())
+}
@@ -0,0 +1,173 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// PgxBeginner is implemented by the native pgx handles: *pgx.Conn and *pgxpool.Pool.
+type PgxBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// BeginnerFromPgx converts a native pgx handle (*pgx.Conn or *pgxpool.Pool) into TxBeginner.
+func BeginnerFromPgx(db PgxBeginner) TxBeginner {
+	return &pgxBeginner{db: db}
+}
+
+// TxFromPgx converts pgx.Tx into Tx.
+func TxFromPgx(tx pgx.Tx) Tx {
+	return &pgxTx{Tx: tx}
+}
+
+// PgxTxFromContext returns the transaction used by the subscriber to consume the message,
+// when the subscriber was created with BeginnerFromPgx. See TxFromContext for details.
+func PgxTxFromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey).(Tx)
+	if !ok {
+		return nil, false
+	}
+
+	pgxTx, ok := unwrapTx(tx).(*pgxTx)
+	if !ok {
+		return nil, false
+	}
+
+	return pgxTx.Tx, true
+}
+
+type pgxBeginner struct {
+	db PgxBeginner
+}
+
+func (b *pgxBeginner) BeginTx(ctx context.Context, options *sql.TxOptions) (Tx, error) {
+	txOptions, err := pgxTxOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := b.db.BeginTx(ctx, txOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pgxTx{Tx: tx}, nil
+}
+
+func (b *pgxBeginner) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	tag, err := b.db.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgxResult{tag: tag}, nil
+}
+
+func (b *pgxBeginner) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := b.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgxRows{Rows: rows}, nil
+}
+
+func pgxTxOptions(options *sql.TxOptions) (pgx.TxOptions, error) {
+	txOptions := pgx.TxOptions{}
+	if options == nil {
+		return txOptions, nil
+	}
+
+	switch options.Isolation {
+	case sql.LevelDefault:
+	case sql.LevelReadUncommitted:
+		txOptions.IsoLevel = pgx.ReadUncommitted
+	case sql.LevelReadCommitted:
+		txOptions.IsoLevel = pgx.ReadCommitted
+	case sql.LevelRepeatableRead, sql.LevelSnapshot:
+		txOptions.IsoLevel = pgx.RepeatableRead
+	case sql.LevelSerializable:
+		txOptions.IsoLevel = pgx.Serializable
+	default:
+		return pgx.TxOptions{}, errors.Errorf("isolation level %s is not supported by pgx", options.Isolation)
+	}
+
+	if options.ReadOnly {
+		txOptions.AccessMode = pgx.ReadOnly
+	}
+
+	return txOptions, nil
+}
+
+type pgxTx struct {
+	pgx.Tx
+}
+
+func (t *pgxTx) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	tag, err := t.Tx.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgxResult{tag: tag}, nil
+}
+
+func (t *pgxTx) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := t.Tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgxRows{Rows: rows}, nil
+}
+
+func (t *pgxTx) Commit() error {
+	return pgxTxErr(t.Tx.Commit(context.Background()))
+}
+
+func (t *pgxTx) Rollback() error {
+	return pgxTxErr(t.Tx.Rollback(context.Background()))
+}
+
+// pgxTxErr translates pgx.ErrTxClosed to sql.ErrTxDone, which is expected by the subscriber.
+func pgxTxErr(err error) error {
+	if errors.Is(err, pgx.ErrTxClosed) {
+		return sql.ErrTxDone
+	}
+
+	return err
+}
+
+type pgxResult struct {
+	tag pgconn.CommandTag
+}
+
+func (r pgxResult) RowsAffected() (int64, error) {
+	return r.tag.RowsAffected(), nil
+}
+
+type pgxRows struct {
+	pgx.Rows
+}
+
+func (r pgxRows) Columns() ([]string, error) {
+	fields := r.Rows.FieldDescriptions()
+
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = string(field.Name)
+	}
+
+	return columns, nil
+}
+
+func (r pgxRows) Close() error {
+	r.Rows.Close()
+	return r.Rows.Err()
+}
@@ -0,0 +1,99 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgxTxOptions(t *testing.T) {
+	testCases := []struct {
+		Name            string
+		Options         *sql.TxOptions
+		ExpectedOptions pgx.TxOptions
+	}{
+		{
+			Name:            "nil",
+			Options:         nil,
+			ExpectedOptions: pgx.TxOptions{},
+		},
+		{
+			Name:            "repeatable_read",
+			Options:         &sql.TxOptions{Isolation: sql.LevelRepeatableRead},
+			ExpectedOptions: pgx.TxOptions{IsoLevel: pgx.RepeatableRead},
+		},
+		{
+			Name:            "serializable_read_only",
+			Options:         &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true},
+			ExpectedOptions: pgx.TxOptions{IsoLevel: pgx.Serializable, AccessMode: pgx.ReadOnly},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			options, err := pgxTxOptions(tc.Options)
+			require.NoError(t, err)
+			assert.Equal(t, tc.ExpectedOptions, options)
+		})
+	}
+
+	_, err := pgxTxOptions(&sql.TxOptions{Isolation: sql.LevelLinearizable})
+	assert.Error(t, err)
+}
+
+type testPgxBeginner struct {
+	PgxBeginner
+	tx pgx.Tx
+}
+
+func (b testPgxBeginner) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	return b.tx, nil
+}
+
+type testPgxTx struct {
+	pgx.Tx
+}
+
+func (tx *testPgxTx) Rollback(ctx context.Context) error {
+	return nil
+}
+
+func TestPgxTxFromContext(t *testing.T) {
+	pgxTx := &testPgxTx{}
+	beginner := BeginnerFromPgx(testPgxBeginner{tx: pgxTx})
+
+	faultyDB, err := NewFaultyDB(beginner, FaultyDBConfig{})
+	require.NoError(t, err)
+
+	singleWriter, err := NewSingleWriter(beginner, SingleWriterConfig{}, nil)
+	require.NoError(t, err)
+	defer singleWriter.Close()
+
+	beginners := map[string]TxBeginner{
+		"pgx":           beginner,
+		"faulty_db":     faultyDB,
+		"single_writer": singleWriter,
+	}
+
+	for name, beginner := range beginners {
+		t.Run(name, func(t *testing.T) {
+			tx, err := beginner.BeginTx(context.Background(), nil)
+			require.NoError(t, err)
+			defer tx.Rollback()
+
+			ctxTx, ok := PgxTxFromContext(setTxToContext(context.Background(), tx))
+			require.True(t, ok)
+			assert.Same(t, pgxTx, ctxTx)
+
+			_, ok = TxFromContext(setTxToContext(context.Background(), tx))
+			assert.False(t, ok)
+		})
+	}
+
+	_, ok := PgxTxFromContext(context.Background())
+	assert.False(t, ok)
+}
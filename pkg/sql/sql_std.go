@@ -0,0 +1,66 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// StdSQLBeginner is implemented by *sql.DB and database handles embedding it (like *sqlx.DB).
+type StdSQLBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// BeginnerFromStdSQL converts *sql.DB (or a compatible handle) into TxBeginner.
+func BeginnerFromStdSQL(db StdSQLBeginner) TxBeginner {
+	return &stdSQLBeginner{db: db}
+}
+
+// TxFromStdSQL converts *sql.Tx into Tx.
+func TxFromStdSQL(tx *sql.Tx) Tx {
+	return &stdSQLTx{Tx: tx}
+}
+
+type stdSQLBeginner struct {
+	db StdSQLBeginner
+}
+
+func (b *stdSQLBeginner) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := b.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stdSQLTx{Tx: tx}, nil
+}
+
+func (b *stdSQLBeginner) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	return b.db.ExecContext(ctx, query, args...)
+}
+
+func (b *stdSQLBeginner) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := b.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+type stdSQLTx struct {
+	*sql.Tx
+}
+
+func (t *stdSQLTx) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
+	return t.Tx.ExecContext(ctx, query, args...)
+}
+
+func (t *stdSQLTx) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := t.Tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,35 @@
+package sql
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// BackupSQLite writes a consistent snapshot of the SQLite database to destPath, using VACUUM INTO.
+//
+// Publishers and subscribers don't need to be stopped: the snapshot is taken within a read transaction,
+// so it contains only committed messages and offsets. In the WAL journal mode, writers are not blocked
+// while the backup is running. The file at destPath must not exist.
+func BackupSQLite(ctx context.Context, db QueryExecutor, destPath string) error {
+	if _, err := os.Stat(destPath); err == nil {
+		return errors.Errorf("backup destination %s already exists", destPath)
+	}
+
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, destPath); err != nil {
+		return errors.Wrap(err, "could not backup database")
+	}
+
+	return nil
+}
+
+// Backup writes a consistent snapshot of the topic's database to destPath (see BackupSQLite).
+func (d *SQLiteTopicDatabases) Backup(ctx context.Context, topic string, destPath string) error {
+	db, err := d.DB(topic)
+	if err != nil {
+		return err
+	}
+
+	return BackupSQLite(ctx, BeginnerFromStdSQL(db), destPath)
+}
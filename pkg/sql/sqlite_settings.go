@@ -0,0 +1,276 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrIncompatibleSQLiteSettings is returned by SQLiteSettingsGuard.Check when processes using the same SQLite file
+// are configured with settings which make them fail or corrupt the database.
+var ErrIncompatibleSQLiteSettings = errors.New("incompatible SQLite settings")
+
+// SQLiteSettings are the connection settings of SQLite which matter when multiple processes write to the same file.
+type SQLiteSettings struct {
+	// JournalMode is the journal mode, like "wal" or "delete".
+	JournalMode string
+
+	// LockingMode is the locking mode, "normal" or "exclusive".
+	LockingMode string
+
+	// BusyTimeout is the time for which writers wait for a lock held by another connection.
+	// When it's 0, concurrent writers fail immediately with SQLITE_BUSY.
+	BusyTimeout time.Duration
+}
+
+// ReadSQLiteSettings reads the settings of the database's connection.
+// Settings like busy timeout are configured per connection, so all connections of the pool
+// should be opened with the same settings, for example, with pragmas of the data source name.
+func ReadSQLiteSettings(ctx context.Context, db QueryExecutor) (SQLiteSettings, error) {
+	var settings SQLiteSettings
+
+	journalMode, err := readSQLitePragma(ctx, db, "journal_mode")
+	if err != nil {
+		return SQLiteSettings{}, err
+	}
+	settings.JournalMode = strings.ToLower(journalMode)
+
+	lockingMode, err := readSQLitePragma(ctx, db, "locking_mode")
+	if err != nil {
+		return SQLiteSettings{}, err
+	}
+	settings.LockingMode = strings.ToLower(lockingMode)
+
+	busyTimeout, err := readSQLitePragma(ctx, db, "busy_timeout")
+	if err != nil {
+		return SQLiteSettings{}, err
+	}
+	busyTimeoutMillis, err := strconv.ParseInt(busyTimeout, 10, 64)
+	if err != nil {
+		return SQLiteSettings{}, errors.Wrapf(err, "invalid busy timeout %s", busyTimeout)
+	}
+	settings.BusyTimeout = time.Duration(busyTimeoutMillis) * time.Millisecond
+
+	return settings, nil
+}
+
+func readSQLitePragma(ctx context.Context, db QueryExecutor, pragma string) (string, error) {
+	rows, err := db.QueryContext(ctx, `PRAGMA `+pragma)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not read %s", pragma)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", errors.Wrapf(err, "could not read %s", pragma)
+		}
+		return "", errors.Errorf("%s not returned", pragma)
+	}
+
+	var value string
+	if err := rows.Scan(&value); err != nil {
+		return "", errors.Wrapf(err, "could not scan %s", pragma)
+	}
+
+	return value, nil
+}
+
+// SQLiteSettingsGuard detects processes writing to the same SQLite file with incompatible settings,
+// like different journal modes or no busy timeout. Every process registers its settings
+// in a coordination table in the database with Check, and compares them with the settings
+// of the other running processes.
+//
+// Check should be called when the process starts, before publishing or consuming messages, so misconfigured
+// deployments fail fast. It should be also called periodically (more often than ProcessTimeout),
+// so the process is not considered stopped.
+type SQLiteSettingsGuard struct {
+	DB QueryExecutor
+
+	// ProcessID identifies the process in the coordination table.
+	//
+	// Default value is the hostname and the process ID, like "worker-1:4242".
+	ProcessID string
+
+	// ProcessTimeout is the time after which processes which didn't call Check are considered stopped,
+	// so their settings are ignored.
+	//
+	// Default value is 1m.
+	ProcessTimeout time.Duration
+
+	// TableName may be used to override the name of the table. The name should not be quoted.
+	//
+	// Default value is watermill_sqlite_processes.
+	TableName string
+}
+
+// InitializeSchema creates the table storing the settings of the processes, if it doesn't exist yet.
+func (g SQLiteSettingsGuard) InitializeSchema(ctx context.Context) error {
+	_, err := g.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+g.table()+` (
+		"process_id" TEXT NOT NULL PRIMARY KEY,
+		"journal_mode" TEXT NOT NULL,
+		"locking_mode" TEXT NOT NULL,
+		"busy_timeout_ms" INTEGER NOT NULL,
+		"checked_at" INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "could not create sqlite processes table")
+	}
+
+	return nil
+}
+
+// Check registers the settings of the process, and returns ErrIncompatibleSQLiteSettings describing
+// the incompatibilities with the other running processes. When the settings are incompatible,
+// the process is unregistered, so it doesn't affect the checks of the other processes after it's fixed.
+func (g SQLiteSettingsGuard) Check(ctx context.Context) error {
+	settings, err := ReadSQLiteSettings(ctx, g.DB)
+	if err != nil {
+		return err
+	}
+
+	processID, err := g.processID()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = g.DB.ExecContext(
+		ctx,
+		`INSERT INTO `+g.table()+` ("process_id", "journal_mode", "locking_mode", "busy_timeout_ms", "checked_at")
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT ("process_id") DO UPDATE SET
+			"journal_mode" = excluded."journal_mode",
+			"locking_mode" = excluded."locking_mode",
+			"busy_timeout_ms" = excluded."busy_timeout_ms",
+			"checked_at" = excluded."checked_at"`,
+		processID, settings.JournalMode, settings.LockingMode, settings.BusyTimeout.Milliseconds(), now.UnixMilli(),
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not register process settings")
+	}
+
+	others, err := g.otherProcesses(ctx, processID, now)
+	if err != nil {
+		return err
+	}
+
+	problems := sqliteSettingsProblems(processID, settings, others)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if err := g.Release(ctx); err != nil {
+		return err
+	}
+
+	return errors.Wrap(ErrIncompatibleSQLiteSettings, strings.Join(problems, "; "))
+}
+
+// Release unregisters the process, for example, when it's shutting down.
+func (g SQLiteSettingsGuard) Release(ctx context.Context) error {
+	processID, err := g.processID()
+	if err != nil {
+		return err
+	}
+
+	_, err = g.DB.ExecContext(ctx, `DELETE FROM `+g.table()+` WHERE "process_id" = ?`, processID)
+	if err != nil {
+		return errors.Wrap(err, "could not unregister process")
+	}
+
+	return nil
+}
+
+type sqliteProcess struct {
+	ID       string
+	Settings SQLiteSettings
+}
+
+func (g SQLiteSettingsGuard) otherProcesses(ctx context.Context, processID string, now time.Time) ([]sqliteProcess, error) {
+	rows, err := g.DB.QueryContext(
+		ctx,
+		`SELECT "process_id", "journal_mode", "locking_mode", "busy_timeout_ms" FROM `+g.table()+`
+		WHERE "process_id" != ? AND "checked_at" > ?
+		ORDER BY "process_id"`,
+		processID, now.Add(-g.processTimeout()).UnixMilli(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query process settings")
+	}
+	defer rows.Close()
+
+	var others []sqliteProcess
+	for rows.Next() {
+		var process sqliteProcess
+		var busyTimeoutMillis int64
+		if err := rows.Scan(&process.ID, &process.Settings.JournalMode, &process.Settings.LockingMode, &busyTimeoutMillis); err != nil {
+			return nil, errors.Wrap(err, "could not scan process settings")
+		}
+		process.Settings.BusyTimeout = time.Duration(busyTimeoutMillis) * time.Millisecond
+		others = append(others, process)
+	}
+
+	return others, rows.Err()
+}
+
+func sqliteSettingsProblems(processID string, settings SQLiteSettings, others []sqliteProcess) []string {
+	if len(others) == 0 {
+		return nil
+	}
+
+	var problems []string
+	checkProcess := func(id string, settings SQLiteSettings) {
+		if settings.BusyTimeout == 0 {
+			problems = append(problems, fmt.Sprintf("process %s has no busy timeout, so its writes fail while other processes write", id))
+		}
+		if settings.LockingMode == "exclusive" {
+			problems = append(problems, fmt.Sprintf("process %s uses exclusive locking mode, so other processes can't access the database", id))
+		}
+	}
+
+	checkProcess(processID, settings)
+	for _, other := range others {
+		if other.Settings.JournalMode != settings.JournalMode {
+			problems = append(problems, fmt.Sprintf(
+				"process %s uses journal mode %s, while process %s uses %s",
+				processID, settings.JournalMode, other.ID, other.Settings.JournalMode,
+			))
+		}
+		checkProcess(other.ID, other.Settings)
+	}
+
+	return problems
+}
+
+func (g SQLiteSettingsGuard) processID() (string, error) {
+	if g.ProcessID != "" {
+		return g.ProcessID, nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", errors.Wrap(err, "could not get hostname")
+	}
+
+	return hostname + ":" + strconv.Itoa(os.Getpid()), nil
+}
+
+func (g SQLiteSettingsGuard) processTimeout() time.Duration {
+	if g.ProcessTimeout > 0 {
+		return g.ProcessTimeout
+	}
+	return time.Minute
+}
+
+func (g SQLiteSettingsGuard) table() string {
+	if g.TableName != "" {
+		return fmt.Sprintf(`"%s"`, g.TableName)
+	}
+	return `"watermill_sqlite_processes"`
+}
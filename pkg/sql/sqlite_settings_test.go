@@ -0,0 +1,100 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSQLiteSettings(t *testing.T) {
+	db := openSQLiteFile(t, filepath.Join(t.TempDir(), "settings.sqlite"), "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+
+	settings, err := sql.ReadSQLiteSettings(context.Background(), db)
+	require.NoError(t, err)
+	assert.Equal(t, sql.SQLiteSettings{
+		JournalMode: "wal",
+		LockingMode: "normal",
+		BusyTimeout: time.Second * 5,
+	}, settings)
+}
+
+func TestSQLiteSettingsGuard(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "guarded.sqlite")
+
+	first := sql.SQLiteSettingsGuard{
+		DB:        openSQLiteFile(t, file, "?_pragma=busy_timeout(5000)"),
+		ProcessID: "first",
+	}
+	require.NoError(t, first.InitializeSchema(ctx))
+	require.NoError(t, first.Check(ctx))
+
+	compatible := sql.SQLiteSettingsGuard{
+		DB:        openSQLiteFile(t, file, "?_pragma=busy_timeout(1000)"),
+		ProcessID: "compatible",
+	}
+	require.NoError(t, compatible.Check(ctx))
+	require.NoError(t, compatible.Release(ctx))
+
+	noBusyTimeout := sql.SQLiteSettingsGuard{
+		DB:        openSQLiteFile(t, file, "?_pragma=busy_timeout(0)"),
+		ProcessID: "no_busy_timeout",
+	}
+	err := noBusyTimeout.Check(ctx)
+	assert.ErrorIs(t, err, sql.ErrIncompatibleSQLiteSettings)
+	assert.ErrorContains(t, err, "process no_busy_timeout has no busy timeout")
+
+	otherJournal := sql.SQLiteSettingsGuard{
+		DB:        openSQLiteFile(t, file, "?_pragma=busy_timeout(5000)&_pragma=journal_mode(MEMORY)"),
+		ProcessID: "other_journal",
+	}
+	err = otherJournal.Check(ctx)
+	assert.ErrorIs(t, err, sql.ErrIncompatibleSQLiteSettings)
+	assert.ErrorContains(t, err, "process other_journal uses journal mode memory, while process first uses delete")
+
+	// The incompatible processes were unregistered, so they don't fail the checks of the first process.
+	require.NoError(t, first.Check(ctx))
+
+	require.NoError(t, first.Release(ctx))
+	require.NoError(t, otherJournal.Check(ctx), "settings of released processes should be ignored")
+	require.NoError(t, otherJournal.Release(ctx))
+}
+
+func TestSQLiteSettingsGuard_ProcessTimeout(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "guarded.sqlite")
+
+	stopped := sql.SQLiteSettingsGuard{
+		DB:        openSQLiteFile(t, file, "?_pragma=busy_timeout(0)"),
+		ProcessID: "stopped",
+	}
+	require.NoError(t, stopped.InitializeSchema(ctx))
+	require.NoError(t, stopped.Check(ctx))
+
+	time.Sleep(time.Millisecond * 100)
+
+	running := sql.SQLiteSettingsGuard{
+		DB:             openSQLiteFile(t, file, "?_pragma=busy_timeout(5000)"),
+		ProcessID:      "running",
+		ProcessTimeout: time.Millisecond * 50,
+	}
+	require.NoError(t, running.Check(ctx))
+}
+
+func openSQLiteFile(t *testing.T, file string, params string) sql.TxBeginner {
+	t.Helper()
+
+	db, err := stdSQL.Open("sqlite", file+params)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return sql.BeginnerFromStdSQL(db)
+}
@@ -0,0 +1,77 @@
+package sql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sqliteStrictTablesVersion is the first SQLite version supporting STRICT tables.
+var sqliteStrictTablesVersion = [3]int{3, 37, 0}
+
+// SQLiteSupportsStrictTables returns true if the SQLite library of the database's driver supports STRICT tables
+// (SQLite 3.37.0 and newer), so DefaultSQLiteSchema.StrictTables and DefaultSQLiteOffsetsAdapter.StrictTables
+// can be enabled for new deployments:
+//
+//	strict, err := sql.SQLiteSupportsStrictTables(ctx, db)
+//	if err != nil {
+//		return err
+//	}
+//	schemaAdapter := sql.DefaultSQLiteSchema{StrictTables: strict}
+//	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{StrictTables: strict}
+func SQLiteSupportsStrictTables(ctx context.Context, db QueryExecutor) (bool, error) {
+	version, err := readSQLiteVersion(ctx, db)
+	if err != nil {
+		return false, err
+	}
+
+	for i := range version {
+		if version[i] != sqliteStrictTablesVersion[i] {
+			return version[i] > sqliteStrictTablesVersion[i], nil
+		}
+	}
+
+	return true, nil
+}
+
+func readSQLiteVersion(ctx context.Context, db QueryExecutor) ([3]int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT sqlite_version()`)
+	if err != nil {
+		return [3]int{}, errors.Wrap(err, "could not query SQLite version")
+	}
+	defer rows.Close()
+
+	var raw string
+	if rows.Next() {
+		if err := rows.Scan(&raw); err != nil {
+			return [3]int{}, errors.Wrap(err, "could not scan SQLite version")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return [3]int{}, errors.Wrap(err, "could not query SQLite version")
+	}
+
+	var version [3]int
+	parts := strings.SplitN(raw, ".", 3)
+	for i, part := range parts {
+		version[i], err = strconv.Atoi(part)
+		if err != nil {
+			return [3]int{}, errors.Errorf("invalid SQLite version %q", raw)
+		}
+	}
+
+	return version, nil
+}
+
+// sqliteTableOptions returns the options of the CREATE TABLE query of a table created by SchemaInitializingQueries.
+// Columns of STRICT tables are checked to match their types (INTEGER, TEXT or BLOB), instead of being converted
+// to the type's affinity.
+func sqliteTableOptions(strict bool) string {
+	if strict {
+		return " STRICT"
+	}
+
+	return ""
+}
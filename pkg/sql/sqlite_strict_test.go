@@ -0,0 +1,70 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultSQLiteSchema_StrictTables(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "strict.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+
+	strict, err := sql.SQLiteSupportsStrictTables(ctx, db)
+	require.NoError(t, err)
+	require.True(t, strict)
+
+	schemaAdapter := sql.DefaultSQLiteSchema{StrictTables: strict}
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{StrictTables: strict}
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+	msg.Metadata.Set("key", "value")
+	require.NoError(t, newCheckpointPublisher(t, db, schemaAdapter).Publish("orders", msg))
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   offsetsAdapter,
+		InitializeSchema: true,
+		PollInterval:     time.Millisecond * 10,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	subscribeCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	messages, err := subscriber.Subscribe(subscribeCtx, "orders")
+	require.NoError(t, err)
+
+	select {
+	case received := <-messages:
+		assert.Equal(t, msg.UUID, received.UUID)
+		assert.Equal(t, "value", received.Metadata.Get("key"))
+		received.Ack()
+	case <-subscribeCtx.Done():
+		t.Fatal("message was not received")
+	}
+
+	for _, table := range []string{"watermill_orders", "watermill_offsets_orders"} {
+		var isStrict bool
+		require.NoError(t, sqlDB.QueryRow(`SELECT "strict" FROM pragma_table_list WHERE "name" = ?`, table).Scan(&isStrict))
+		assert.True(t, isStrict, table)
+	}
+
+	_, err = sqlDB.Exec(`INSERT INTO "watermill_orders" ("uuid", "payload", "metadata") VALUES (X'00', NULL, NULL)`)
+	assert.Error(t, err, "blob uuid should be rejected")
+
+	_, err = sqlDB.Exec(`INSERT INTO "watermill_orders" ("uuid", "payload", "metadata") VALUES ('uuid', NULL, 'not json')`)
+	assert.Error(t, err, "invalid metadata should be rejected")
+}
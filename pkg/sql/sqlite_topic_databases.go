@@ -0,0 +1,341 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSQLiteTopicDatabasesClosed = errors.New("sqlite topic databases are closed")
+)
+
+type SQLiteTopicDatabasesConfig struct {
+	// Dir is the directory where the database files of topics are stored. It's required.
+	Dir string
+
+	// GenerateFileName may be used to override how the database file name of a topic is generated.
+	GenerateFileName func(topic string) string
+
+	// Open opens the database file at the path.
+	// It may be used to choose the driver and set the connection parameters, like the busy timeout.
+	//
+	// By default, the file is opened with the driver registered as "sqlite" (for example, modernc.org/sqlite).
+	Open func(path string) (*sql.DB, error)
+}
+
+func (c *SQLiteTopicDatabasesConfig) setDefaults() {
+	if c.GenerateFileName == nil {
+		c.GenerateFileName = func(topic string) string {
+			return "watermill_" + topic + ".sqlite"
+		}
+	}
+	if c.Open == nil {
+		c.Open = func(path string) (*sql.DB, error) {
+			return sql.Open("sqlite", path)
+		}
+	}
+}
+
+func (c SQLiteTopicDatabasesConfig) validate() error {
+	if c.Dir == "" {
+		return errors.New("dir is empty")
+	}
+
+	return nil
+}
+
+// SQLiteTopicDatabases stores every topic in a separate SQLite database file, opened on demand.
+//
+// SQLite allows only one writer per database file, so topics stored in one file contend on its write lock.
+// With a file per topic, heavy topics don't block each other, and the files of topics can be
+// backed up or deleted independently.
+//
+// SQLiteTopicDatabases should be used with SQLiteTopicPublisher and SQLiteTopicSubscriber.
+type SQLiteTopicDatabases struct {
+	config SQLiteTopicDatabasesConfig
+
+	dbs    map[string]*sql.DB
+	lock   sync.Mutex
+	closed bool
+}
+
+func NewSQLiteTopicDatabases(config SQLiteTopicDatabasesConfig) (*SQLiteTopicDatabases, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	return &SQLiteTopicDatabases{
+		config: config,
+		dbs:    map[string]*sql.DB{},
+	}, nil
+}
+
+// Path returns the path of the database file of the topic.
+func (d *SQLiteTopicDatabases) Path(topic string) string {
+	return filepath.Join(d.config.Dir, d.config.GenerateFileName(topic))
+}
+
+// DB returns the handle of the topic's database, opening it if it's not open yet.
+func (d *SQLiteTopicDatabases) DB(topic string) (*sql.DB, error) {
+	if err := validateTopicName(topic); err != nil {
+		return nil, err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return nil, ErrSQLiteTopicDatabasesClosed
+	}
+
+	if db, ok := d.dbs[topic]; ok {
+		return db, nil
+	}
+
+	db, err := d.config.Open(d.Path(topic))
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open database of topic %s", topic)
+	}
+
+	d.dbs[topic] = db
+
+	return db, nil
+}
+
+// Remove closes the database of the topic and deletes its files.
+// The topic must not be used by any publisher or subscriber at this time.
+func (d *SQLiteTopicDatabases) Remove(topic string) error {
+	if err := validateTopicName(topic); err != nil {
+		return err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if db, ok := d.dbs[topic]; ok {
+		delete(d.dbs, topic)
+		if err := db.Close(); err != nil {
+			return errors.Wrapf(err, "could not close database of topic %s", topic)
+		}
+	}
+
+	path := d.Path(topic)
+	// The write-ahead log and the shared memory files exist only in WAL mode.
+	for _, file := range []string{path, path + "-wal", path + "-shm"} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "could not remove database file of topic %s", topic)
+		}
+	}
+
+	return nil
+}
+
+// Close closes all opened databases.
+func (d *SQLiteTopicDatabases) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+
+	var closeErr error
+	for topic, db := range d.dbs {
+		if err := db.Close(); err != nil && closeErr == nil {
+			closeErr = errors.Wrapf(err, "could not close database of topic %s", topic)
+		}
+	}
+	d.dbs = nil
+
+	return closeErr
+}
+
+// SQLiteTopicPublisher publishes messages to the databases of topics provided by SQLiteTopicDatabases.
+// Every topic is published with a separate Publisher, created with the same config.
+type SQLiteTopicPublisher struct {
+	dbs    *SQLiteTopicDatabases
+	config PublisherConfig
+	logger watermill.LoggerAdapter
+
+	publishers map[string]*Publisher
+	lock       sync.Mutex
+	closed     bool
+}
+
+func NewSQLiteTopicPublisher(
+	dbs *SQLiteTopicDatabases,
+	config PublisherConfig,
+	logger watermill.LoggerAdapter,
+) (*SQLiteTopicPublisher, error) {
+	if dbs == nil {
+		return nil, errors.New("dbs is nil")
+	}
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	return &SQLiteTopicPublisher{
+		dbs:        dbs,
+		config:     config,
+		logger:     logger,
+		publishers: map[string]*Publisher{},
+	}, nil
+}
+
+func (p *SQLiteTopicPublisher) Publish(topic string, messages ...*message.Message) error {
+	publisher, err := p.publisher(topic)
+	if err != nil {
+		return err
+	}
+
+	return publisher.Publish(topic, messages...)
+}
+
+func (p *SQLiteTopicPublisher) publisher(topic string) (*Publisher, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return nil, ErrPublisherClosed
+	}
+
+	if publisher, ok := p.publishers[topic]; ok {
+		return publisher, nil
+	}
+
+	db, err := p.dbs.DB(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	publisher, err := NewPublisher(db, p.config, p.logger)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create publisher of topic %s", topic)
+	}
+
+	p.publishers[topic] = publisher
+
+	return publisher, nil
+}
+
+// Close closes the publishers of all topics. The databases are not closed.
+func (p *SQLiteTopicPublisher) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	for _, publisher := range p.publishers {
+		_ = publisher.Close()
+	}
+
+	return nil
+}
+
+// SQLiteTopicSubscriber subscribes to the databases of topics provided by SQLiteTopicDatabases.
+// Every topic is consumed with a separate Subscriber, created with the same config.
+type SQLiteTopicSubscriber struct {
+	dbs    *SQLiteTopicDatabases
+	config SubscriberConfig
+	logger watermill.LoggerAdapter
+
+	subscribers map[string]*Subscriber
+	lock        sync.Mutex
+	closed      bool
+}
+
+func NewSQLiteTopicSubscriber(
+	dbs *SQLiteTopicDatabases,
+	config SubscriberConfig,
+	logger watermill.LoggerAdapter,
+) (*SQLiteTopicSubscriber, error) {
+	if dbs == nil {
+		return nil, errors.New("dbs is nil")
+	}
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	return &SQLiteTopicSubscriber{
+		dbs:         dbs,
+		config:      config,
+		logger:      logger,
+		subscribers: map[string]*Subscriber{},
+	}, nil
+}
+
+func (s *SQLiteTopicSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	subscriber, err := s.subscriber(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	return subscriber.Subscribe(ctx, topic)
+}
+
+func (s *SQLiteTopicSubscriber) SubscribeInitialize(topic string) error {
+	subscriber, err := s.subscriber(topic)
+	if err != nil {
+		return err
+	}
+
+	return subscriber.SubscribeInitialize(topic)
+}
+
+func (s *SQLiteTopicSubscriber) subscriber(topic string) (*Subscriber, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return nil, ErrSubscriberClosed
+	}
+
+	if subscriber, ok := s.subscribers[topic]; ok {
+		return subscriber, nil
+	}
+
+	db, err := s.dbs.DB(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriber, err := NewSubscriber(db, s.config, s.logger)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create subscriber of topic %s", topic)
+	}
+
+	s.subscribers[topic] = subscriber
+
+	return subscriber, nil
+}
+
+// Close closes the subscribers of all topics. The databases are not closed.
+func (s *SQLiteTopicSubscriber) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	for _, subscriber := range s.subscribers {
+		_ = subscriber.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteTopicDatabases(t *testing.T) {
+	dbs, err := sql.NewSQLiteTopicDatabases(sql.SQLiteTopicDatabasesConfig{
+		Dir: t.TempDir(),
+		// The backup waits for the write lock of the subscriber committing the ack.
+		Open: func(path string) (*stdSQL.DB, error) {
+			return stdSQL.Open("sqlite", path+"?_pragma=busy_timeout(10000)")
+		},
+	})
+	require.NoError(t, err)
+	defer dbs.Close()
+
+	publisher, err := sql.NewSQLiteTopicPublisher(dbs, sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	subscriber, err := sql.NewSQLiteTopicSubscriber(dbs, sql.SubscriberConfig{
+		SchemaAdapter:    sql.DefaultSQLiteSchema{},
+		OffsetsAdapter:   sql.DefaultSQLiteOffsetsAdapter{},
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topics := []string{"topic_" + watermill.NewShortUUID(), "topic_" + watermill.NewShortUUID()}
+
+	for _, topic := range topics {
+		messages, err := subscriber.Subscribe(ctx, topic)
+		require.NoError(t, err)
+
+		msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+		require.NoError(t, publisher.Publish(topic, msg))
+
+		select {
+		case received := <-messages:
+			assert.Equal(t, msg.UUID, received.UUID)
+			received.Ack()
+		case <-time.After(time.Second * 5):
+			t.Fatal("no message received")
+		}
+
+		assert.FileExists(t, dbs.Path(topic))
+	}
+
+	backupPath := filepath.Join(t.TempDir(), "backup.sqlite")
+	require.NoError(t, dbs.Backup(ctx, topics[1], backupPath))
+	assertSQLiteBackup(t, backupPath, topics[1], 1)
+
+	require.NoError(t, subscriber.Close())
+	require.NoError(t, publisher.Close())
+
+	require.NoError(t, dbs.Remove(topics[0]))
+	assert.NoFileExists(t, dbs.Path(topics[0]))
+	assert.FileExists(t, dbs.Path(topics[1]))
+}
+
+func assertSQLiteBackup(t *testing.T, path string, topic string, expectedMessages int) {
+	backup, err := stdSQL.Open("sqlite", path)
+	require.NoError(t, err)
+	defer backup.Close()
+
+	var count int
+	err = backup.QueryRow(`SELECT COUNT(*) FROM "watermill_` + topic + `"`).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, expectedMessages, count)
+}
@@ -0,0 +1,156 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+)
+
+// selectedRows are the messages of a batch, either selected into a slice, or streamed from the rows
+// of the query one by one (see SubscriberConfig.StreamRows).
+type selectedRows struct {
+	batch []Row
+
+	subscriber *Subscriber
+	topic      string
+	rows       Rows
+	pollStart  time.Time
+	polled     time.Duration
+	noRows     bool
+	closed     bool
+
+	read int
+	last Row
+}
+
+func newBatchRows(batch []Row) *selectedRows {
+	return &selectedRows{batch: batch}
+}
+
+// streamBatch executes the select query, returning the rows from which the messages are unmarshaled
+// while they are processed, so only the message being processed is kept in memory.
+//
+// QueryTimeout can't be used, as canceling the query would close the rows while the messages are processed.
+func (s *Subscriber) streamBatch(
+	ctx context.Context,
+	executor QueryExecutor,
+	topic string,
+	offsetsAdapter OffsetsAdapter,
+	logger watermill.LoggerAdapter,
+) (*selectedRows, error) {
+	selectQuery := s.config.SchemaAdapter.SelectQuery(
+		topic,
+		s.config.ConsumerGroup,
+		offsetsAdapter,
+	)
+	logger.Trace("Querying message", watermill.LogFields{
+		"query":      selectQuery.Query,
+		"query_args": sqlArgsToLog(selectQuery.Args),
+	})
+
+	pollStart := time.Now()
+	rows, err := executor.QueryContext(ctx, selectQuery.Query, selectQuery.Args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query message")
+	}
+
+	return &selectedRows{
+		subscriber: s,
+		topic:      topic,
+		rows:       rows,
+		pollStart:  pollStart,
+	}, nil
+}
+
+func (r *selectedRows) streamed() bool {
+	return r.rows != nil
+}
+
+// next returns the next message, or false if there are no more messages in the batch.
+func (r *selectedRows) next() (Row, bool, error) {
+	if !r.streamed() {
+		if r.read == len(r.batch) {
+			return Row{}, false, nil
+		}
+		row := r.batch[r.read]
+		r.read++
+		r.last = row
+		return row, true, nil
+	}
+
+	if r.closed || r.subscriber.batchLimitReached(r.topic, r.read) {
+		return Row{}, false, nil
+	}
+
+	hasNext := r.rows.Next()
+	if r.read == 0 {
+		r.polled = time.Since(r.pollStart)
+	}
+	if !hasNext {
+		if err := r.rows.Err(); err != nil {
+			return Row{}, false, errors.Wrap(err, "could not read message rows")
+		}
+		return Row{}, false, nil
+	}
+
+	row, err := r.subscriber.config.SchemaAdapter.UnmarshalMessage(r.rows)
+	if errors.Cause(err) == sql.ErrNoRows {
+		r.noRows = r.read == 0
+		return Row{}, false, nil
+	} else if err != nil {
+		return Row{}, false, errors.Wrap(err, "could not unmarshal message from query")
+	}
+
+	row, err = r.subscriber.transformMessage(row)
+	if err != nil {
+		return Row{}, false, err
+	}
+
+	r.read++
+	r.last = row
+	return row, true, nil
+}
+
+// count returns the number of selected messages. Messages of streamed batches are counted when they are read.
+func (r *selectedRows) count() int {
+	if !r.streamed() {
+		return len(r.batch)
+	}
+	return r.read
+}
+
+// lastSelected returns the last selected message, or the last read message of streamed batches.
+func (r *selectedRows) lastSelected() Row {
+	if !r.streamed() {
+		if len(r.batch) == 0 {
+			return Row{}
+		}
+		return r.batch[len(r.batch)-1]
+	}
+	return r.last
+}
+
+// close closes the rows of streamed batches. The remaining messages are queried again with the next batch.
+func (r *selectedRows) close() error {
+	if !r.streamed() || r.closed {
+		return nil
+	}
+	r.closed = true
+
+	if err := r.rows.Close(); err != nil {
+		return errors.Wrap(err, "could not close rows")
+	}
+	return nil
+}
+
+// recordSelected records the poll in the statistics and emits BatchSelected.
+func (s *Subscriber) recordSelected(topic string, pollDuration time.Duration, messages int) {
+	s.stats.recordPoll(topic, pollDuration, messages)
+
+	if messages > 0 {
+		s.events.emit(BatchSelected{Topic: topic, Messages: messages})
+	}
+}
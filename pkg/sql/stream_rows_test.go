@@ -0,0 +1,106 @@
+package sql_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingSchemaAdapter counts the unmarshaled messages.
+type countingSchemaAdapter struct {
+	sql.SchemaAdapter
+	unmarshaled *atomic.Int64
+}
+
+func (a countingSchemaAdapter) UnmarshalMessage(row sql.Scanner) (sql.Row, error) {
+	a.unmarshaled.Add(1)
+	return a.SchemaAdapter.UnmarshalMessage(row)
+}
+
+func TestSubscriber_StreamRows(t *testing.T) {
+	testCases := []struct {
+		name           string
+		offsetsAdapter sql.OffsetsAdapter
+	}{
+		{name: "transactional", offsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{}},
+		{name: "non_transactional", offsetsAdapter: sql.DefaultD1OffsetsAdapter{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := sql.BeginnerFromStdSQL(newSQLite(t))
+			topicName := "stream_rows_" + watermill.NewShortUUID()
+			schemaAdapter := countingSchemaAdapter{
+				SchemaAdapter: newSQLiteSchemaAdapter(100),
+				unmarshaled:   &atomic.Int64{},
+			}
+
+			publisher := newCheckpointPublisher(t, db, schemaAdapter)
+			var published []*message.Message
+			for i := 0; i < 20; i++ {
+				msg := message.NewMessage(watermill.NewUUID(), []byte(fmt.Sprint(i)))
+				require.NoError(t, publisher.Publish(topicName, msg))
+				published = append(published, msg)
+			}
+
+			subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+				ConsumerGroup:    "stream_rows",
+				SchemaAdapter:    schemaAdapter,
+				OffsetsAdapter:   tc.offsetsAdapter,
+				InitializeSchema: true,
+				StreamRows:       true,
+			}, logger)
+			require.NoError(t, err)
+			defer subscriber.Close()
+
+			consumed, err := subscriber.Subscribe(context.Background(), topicName)
+			require.NoError(t, err)
+
+			for i, expected := range published {
+				select {
+				case msg := <-consumed:
+					assert.Equal(t, expected.UUID, msg.UUID)
+					assert.Equal(t, expected.Payload, msg.Payload)
+					if i == 0 {
+						assert.EqualValues(t, 1, schemaAdapter.unmarshaled.Load(), "only the delivered message should be read")
+					}
+					msg.Ack()
+				case <-time.After(time.Second * 5):
+					t.Fatal("timeout waiting for message")
+				}
+			}
+
+			require.Eventually(t, func() bool {
+				return subscriber.Stats()[topicName].Acked == int64(len(published))
+			}, time.Second*5, time.Millisecond*10)
+		})
+	}
+}
+
+func TestSubscriberConfig_StreamRowsValidation(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+
+	_, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:  newSQLiteSchemaAdapter(10),
+		OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+		StreamRows:     true,
+		QueryTimeout:   time.Second,
+	}, logger)
+	assert.Error(t, err, "query timeout should not be allowed")
+
+	_, err = sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:   newSQLiteSchemaAdapter(10),
+		OffsetsAdapter:  sql.DefaultSQLiteOffsetsAdapter{},
+		StreamRows:      true,
+		PrefetchBatches: 1,
+	}, logger)
+	assert.Error(t, err, "prefetching should not be allowed")
+}
@@ -0,0 +1,100 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// detachedContext keeps the values of the parent context, but it's never canceled (like context.WithoutCancel).
+// It is used for the transactions of subscriptions, so canceling the subscription context doesn't roll back
+// the acks of messages which were already handled.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key any) any {
+	return c.parent.Value(key)
+}
+
+// beginDetachedTx begins the transaction with a context canceled with ctx only until the transaction is begun,
+// so beginning is interrupted when the subscription stops, but the transaction outlives ctx.
+func beginDetachedTx(ctx context.Context, txProvider TxProvider, opts *sql.TxOptions) (Tx, error) {
+	beginCtx, cancelBegin := context.WithCancel(detachedContext{ctx})
+
+	var lock sync.Mutex
+	begun := false
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			lock.Lock()
+			defer lock.Unlock()
+			if !begun {
+				cancelBegin()
+			}
+		case <-stop:
+		}
+	}()
+
+	tx, err := txProvider.BeginTx(beginCtx, opts)
+
+	lock.Lock()
+	begun = true
+	canceledErr := beginCtx.Err()
+	lock.Unlock()
+
+	if err != nil {
+		cancelBegin()
+		return nil, err
+	}
+	if canceledErr != nil {
+		// The transaction is already rolled back, as its context was canceled.
+		_ = tx.Rollback()
+		return nil, canceledErr
+	}
+
+	return tx, nil
+}
+
+// releaseInterruptedClaim reverts the claim of the message which was consumed, but not acked, because the batch
+// was interrupted (for example, by canceling the subscription context). Otherwise, the claim would be committed
+// with the transaction, leaving the message consumed but never acked.
+//
+// Acking the last acked message of the transaction again moves the consumed offset back to it.
+// Transactions without acked messages are rolled back.
+func (s *Subscriber) releaseInterruptedClaim(
+	ctx context.Context,
+	topic string,
+	commit *groupCommit,
+	interrupted bool,
+	logger watermill.LoggerAdapter,
+) error {
+	if !interrupted {
+		return nil
+	}
+
+	if commit.lastAcked == nil {
+		s.rollbackQueryTx(commit, nil, logger)
+		return nil
+	}
+
+	return s.ackMessage(ctx, commit.tx, topic, *commit.lastAcked, logger)
+}
@@ -0,0 +1,120 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe_contextCanceledMidBatch(t *testing.T) {
+	testCases := []struct {
+		Name                string
+		OffsetsAdapter      sql.OffsetsAdapter
+		BatchSize           int
+		GroupCommitMessages int
+	}{
+		{
+			Name:           "transaction",
+			OffsetsAdapter: sql.DefaultSQLiteOffsetsAdapter{},
+			BatchSize:      6,
+		},
+		{
+			Name:                "group_commit",
+			OffsetsAdapter:      sql.DefaultSQLiteOffsetsAdapter{},
+			BatchSize:           2,
+			GroupCommitMessages: 100,
+		},
+		{
+			Name:           "without_transaction",
+			OffsetsAdapter: sql.DefaultD1OffsetsAdapter{},
+			BatchSize:      6,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			sqliteDB := newSQLite(t)
+			db := sql.BeginnerFromStdSQL(sqliteDB)
+			topicName := "lifetime_" + watermill.NewShortUUID()
+			schemaAdapter := sql.DefaultSQLiteSchema{SubscribeBatchSize: tc.BatchSize}
+
+			publisher := newCheckpointPublisher(t, db, schemaAdapter)
+			var published []string
+			for i := 0; i < 6; i++ {
+				msg := message.NewMessage(watermill.NewUUID(), nil)
+				require.NoError(t, publisher.Publish(topicName, msg))
+				published = append(published, msg.UUID)
+			}
+
+			newSubscriber := func() *sql.Subscriber {
+				subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+					ConsumerGroup:       "lifetime",
+					SchemaAdapter:       schemaAdapter,
+					OffsetsAdapter:      tc.OffsetsAdapter,
+					InitializeSchema:    true,
+					PollInterval:        time.Millisecond * 10,
+					GroupCommitMessages: tc.GroupCommitMessages,
+				}, logger)
+				require.NoError(t, err)
+				t.Cleanup(func() { _ = subscriber.Close() })
+				return subscriber
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			consumed, err := newSubscriber().Subscribe(ctx, topicName)
+			require.NoError(t, err)
+
+			for i := 0; i < 4; i++ {
+				select {
+				case msg := <-consumed:
+					assert.Equal(t, published[i], msg.UUID)
+					if i < 3 {
+						msg.Ack()
+					}
+				case <-time.After(time.Second * 5):
+					t.Fatal("timeout waiting for messages")
+				}
+			}
+
+			// The fourth message is canceled in the middle of its batch, before it's acked.
+			cancel()
+
+			select {
+			case _, ok := <-consumed:
+				require.False(t, ok, "no more messages should be delivered after canceling the context")
+			case <-time.After(time.Second * 5):
+				t.Fatal("channel should be closed after canceling the context")
+			}
+
+			var offsetAcked, offsetConsumed int64
+			err = sqliteDB.QueryRow(
+				`SELECT offset_acked, offset_consumed FROM "watermill_offsets_`+topicName+`" WHERE consumer_group = ?`,
+				"lifetime",
+			).Scan(&offsetAcked, &offsetConsumed)
+			require.NoError(t, err)
+			assert.Equal(t, offsetAcked, offsetConsumed, "no message should be left consumed, but not acked")
+
+			consumed, err = newSubscriber().Subscribe(context.Background(), topicName)
+			require.NoError(t, err)
+
+			for _, uuid := range published[3:] {
+				select {
+				case msg := <-consumed:
+					assert.Equal(t, uuid, msg.UUID, "messages acked before canceling the context should not be redelivered")
+					msg.Ack()
+				case <-time.After(time.Second * 5):
+					t.Fatal("timeout waiting for redelivered messages")
+				}
+			}
+		})
+	}
+}
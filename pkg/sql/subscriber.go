@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	stdErrors "errors"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -16,6 +17,10 @@ import (
 
 var (
 	ErrSubscriberClosed = errors.New("subscriber is closed")
+
+	// ErrOffsetConflict is returned when a conditional ConsumedMessageQuery of OptimisticOffsetsAdapter
+	// didn't affect any rows, because another subscriber consumed the message first.
+	ErrOffsetConflict = errors.New("offset conflict: message was consumed by another subscriber")
 )
 
 type SubscriberConfig struct {
@@ -33,6 +38,16 @@ type SubscriberConfig struct {
 	// Must be non-negative. Nil value defaults to 30s.
 	AckDeadline *time.Duration
 
+	// OnAckDeadlineExceeded is called when a delivered message was neither acked nor nacked within AckDeadline,
+	// for example, to increase a metric of stuck handlers. Such messages are logged regardless.
+	OnAckDeadlineExceeded func(topic string, msg *message.Message)
+
+	// NackOnAckDeadline nacks messages which were neither acked nor nacked within AckDeadline.
+	// Nacked messages are re-delivered after ResendInterval with a fresh ack deadline.
+	//
+	// By default, such messages are discarded and the messages are queried again.
+	NackOnAckDeadline bool
+
 	// PollInterval is the interval to wait between subsequent SELECT queries, if no more messages were found in the database (Prefer using the BackoffManager instead).
 	// Must be non-negative. Defaults to 1s.
 	PollInterval time.Duration
@@ -41,6 +56,12 @@ type SubscriberConfig struct {
 	// Must be non-negative. Defaults to 1s.
 	ResendInterval time.Duration
 
+	// RedeliveryPolicy decides the waits before resending a nacked message (or a message nacked after AckDeadline).
+	// Messages are not skipped, so they're resent after the wait even when the policy stops retrying.
+	//
+	// By default, it's a ConstantRetryPolicy waiting ResendInterval.
+	RedeliveryPolicy RetryPolicy
+
 	// RetryInterval is the time to wait before resuming querying for messages after an error (Prefer using the BackoffManager instead).
 	// Must be non-negative. Defaults to 1s.
 	RetryInterval time.Duration
@@ -48,6 +69,17 @@ type SubscriberConfig struct {
 	// BackoffManager defines how much to backoff when receiving errors.
 	BackoffManager BackoffManager
 
+	// PollJitter randomizes the waits returned by BackoffManager by up to the fraction (from 0 to 1) of the wait,
+	// so many replicas consuming the same topic don't poll at the same time and collide on locks.
+	// For example, 0.2 with PollInterval 1s waits between 800ms and 1.2s.
+	//
+	// If it's 0, the waits are not randomized.
+	PollJitter float64
+
+	// DesynchronizeStart delays the first query of every subscription by a random duration up to PollInterval,
+	// so replicas started at the same time (for example, by a deployment) don't poll in lockstep.
+	DesynchronizeStart bool
+
 	// SchemaAdapter provides the schema-dependent queries and arguments for them, based on topic/message etc.
 	SchemaAdapter SchemaAdapter
 
@@ -56,6 +88,207 @@ type SubscriberConfig struct {
 
 	// InitializeSchema option enables initializing schema on making subscription.
 	InitializeSchema bool
+
+	// SchemaIntrospector may be used to verify the schema of the topic with VerifySchema when subscribing,
+	// so subscribing to tables which don't match SchemaAdapter and OffsetsAdapter fails with a detailed error.
+	// The schema is verified after it's initialized, if InitializeSchema is enabled.
+	SchemaIntrospector SchemaIntrospector
+
+	// Transforms are applied in order to every consumed message, before it's sent to the handler
+	// (for example, to decompress or decrypt the payload, or to migrate old payload versions).
+	//
+	// When a transform returns an error, no messages of the batch are sent, and they are queried again.
+	Transforms []TransformFunc
+
+	// Deduplicator may be used to detect messages which were already handled by the consumer group,
+	// like messages published twice (see InMemoryDeduplicator and SQLiteConsumerDeduplicator).
+	// Duplicates are acked without being sent to the handler.
+	Deduplicator ConsumerDeduplicator
+
+	// GroupBatches enables delivering the messages of a logical batch (see BatchIDMetadataKey and SetBatch) together,
+	// one after another, once all of them were published. Consuming waits at the first message of an incomplete batch,
+	// so the order of messages is preserved. The schema adapter must implement BatchGroupingSchemaAdapter.
+	//
+	// When consuming in transactions, the batch is acked in one transaction, so it's delivered again
+	// if any of its messages is not acked. Messages of a batch published before the consumer group's
+	// first offset are not delivered.
+	GroupBatches bool
+
+	// UseSavepoints creates a savepoint before delivering every message of a batch consumed in a transaction.
+	// When the message is nacked or not acked in time, changes made by its handler in the transaction
+	// (see TxFromContext) are rolled back to the savepoint, while the already acked messages of the batch
+	// are committed. Otherwise, the changes made before a nack are kept.
+	//
+	// The database must support the SAVEPOINT, ROLLBACK TO SAVEPOINT and RELEASE SAVEPOINT statements
+	// (like PostgreSQL, MySQL and SQLite).
+	UseSavepoints bool
+
+	// AuditSink may be used to record which messages were acked by the consumer group, with the actor
+	// of the context passed to Subscribe (see ContextWithActor). When consuming in transactions,
+	// the messages are recorded after the transaction acking them is committed.
+	AuditSink AuditSink
+
+	// ValidateOrdering is a debug option verifying that messages numbered by PublisherConfig.TrackOrdering
+	// are acked in the order they were published. Gaps and reordered messages of every partition are logged,
+	// emitted as OrderingViolated events, and passed to OnOrderingViolation.
+	//
+	// Messages are validated when they're acked, so messages acked in a transaction which was rolled back
+	// and then redelivered are reported as reordered. Every consumer group should be consumed by one subscriber
+	// while validating, as messages consumed by the other subscribers are reported as gaps.
+	ValidateOrdering bool
+
+	// OnOrderingViolation is called for every violation found by ValidateOrdering.
+	OnOrderingViolation func(violation OrderingViolation)
+
+	// EventsBufferSize is the size of the buffer of the channel returned by Events.
+	// Events are dropped when the buffer is full.
+	//
+	// Default value is 1024.
+	EventsBufferSize int
+
+	// TxProvider may be used to provide the transactions used for consuming messages,
+	// instead of beginning them with the database handle passed to NewSubscriber.
+	TxProvider TxProvider
+
+	// QueryTimeout limits the duration of the queries selecting messages, so a query blocked on a contended lock
+	// or reading a huge batch is canceled and retried after RetryInterval. It doesn't limit processing the messages.
+	//
+	// If it's zero, queries are canceled only when the subscriber is closed or the context of Subscribe is canceled.
+	QueryTimeout time.Duration
+
+	// CatchUpBatchLimit limits the number of messages selected and acked in one transaction, so a consumer group
+	// catching up with a huge backlog (for example, a new consumer group) commits its offset after every chunk,
+	// instead of holding one long transaction. The rest of the selected batch is queried again.
+	//
+	// If it's 0, the number of messages is limited only by the schema adapter (like SubscribeBatchSize).
+	CatchUpBatchLimit int
+
+	// OnCatchUpProgress is called after the offset of every chunk limited by CatchUpBatchLimit was committed,
+	// so the progress of catching up can be reported, for example, in logs or metrics.
+	OnCatchUpProgress func(progress CatchUpProgress)
+
+	// AutoBatch enables adjusting the number of messages processed in one batch to the latency of the handler
+	// and the rate of redeliveries, between AutoBatchConfig.MinBatchSize and AutoBatchConfig.MaxBatchSize.
+	// Batches are still limited by CatchUpBatchLimit and the schema adapter (like SubscribeBatchSize).
+	//
+	// If it's nil, the batch size is not adjusted.
+	AutoBatch *AutoBatchConfig
+
+	// FairScheduling enables weighted fair scheduling of the poll cycles of the topics consumed by the subscriber,
+	// and limits of the in-flight messages of the topics, so one busy topic can't starve the others sharing
+	// the same database connections.
+	//
+	// If it's nil, the topics are polled independently.
+	FairScheduling *FairSchedulingConfig
+
+	// ActivityStore may be used to track when the consumer group was last active,
+	// so it's not removed by RemoveIdleConsumerGroups while the subscriber is running.
+	// Errors of the store are logged and don't stop consuming.
+	ActivityStore ConsumerGroupActivityStore
+
+	// ActivityInterval is the minimum interval of marking the consumer group as active in ActivityStore.
+	//
+	// Default value is 1m.
+	ActivityInterval time.Duration
+
+	// LeaseStore enables leader election: only the subscriber holding the consumer group's lease consumes messages,
+	// while other subscribers (usually replicas of the same service) stand by, and take over when the lease
+	// is released or expires. It may be used for consumers which must be strictly single, but highly available.
+	//
+	// The lease is renewed between querying batches, so LeaseDuration must be longer than processing of a batch.
+	// Otherwise, a standby subscriber may take over while the batch is still processed.
+	LeaseStore LeaseStore
+
+	// LeaseDuration is the time after which the lease of a subscriber which stopped renewing it expires.
+	// Standby subscribers try to acquire the lease every PollInterval.
+	//
+	// Default value is 30s.
+	LeaseDuration time.Duration
+
+	// HibernateAfter is the time without new messages after which a topic is hibernated: it's queried
+	// every HibernationInterval instead of PollInterval, reducing the load of subscribing to many mostly idle topics.
+	// The topic wakes up when a query selects messages, or when Subscriber.Wake is called.
+	//
+	// If it's 0, topics are never hibernated.
+	HibernateAfter time.Duration
+
+	// HibernationInterval is the interval between queries of hibernated topics.
+	//
+	// Default value is 30s.
+	HibernationInterval time.Duration
+
+	// GroupCommitMessages enables group commits: the transaction updating the offset is kept open
+	// over the following batches, and committed after at least GroupCommitMessages messages were acked.
+	// It reduces the number of commits (and fsyncs of SQLite) when consuming many small batches,
+	// but blocks other writers of SQLite while the transaction is open.
+	//
+	// The transaction is committed also after GroupCommitInterval, or when no messages were selected.
+	// Messages acked in the transaction are redelivered if it's rolled back after an error,
+	// so both knobs bound the redelivery window. The transaction is committed when the context
+	// of Subscribe is canceled.
+	// Group commits are not used by offsets adapters consuming without transactions.
+	//
+	// If both GroupCommitMessages and GroupCommitInterval are 0, every batch is committed.
+	GroupCommitMessages int
+
+	// GroupCommitInterval enables group commits (see GroupCommitMessages): the transaction is committed
+	// after the first batch acked after the interval since it began.
+	GroupCommitInterval time.Duration
+
+	// ReadYourWrites makes the subscriber query a topic immediately after messages were published to it
+	// by a Publisher in the same process using the same database handle (like the same *sql.DB),
+	// instead of waiting for the next poll. It makes integration tests of outbox flows deterministic.
+	//
+	// Messages published with a transaction are picked up by the next poll, as the publisher doesn't know
+	// when the transaction is committed. The isolation of the offsets adapter still applies: for example,
+	// messages are not visible before the transactions inserted earlier are committed.
+	ReadYourWrites bool
+
+	// PrefetchBatches enables prefetching: while the handler processes a batch, the following batches
+	// are selected in separate read transactions, hiding the latency of queries. At most PrefetchBatches
+	// batches are buffered.
+	//
+	// A prefetched batch is delivered only if the offset acked by the consumer group is still the last offset
+	// before the batch, which is checked with NextOffsetQuery in the subscription transaction, so messages
+	// are delivered and acked in order. Otherwise (for example, when another subscriber of the consumer group
+	// acked messages meanwhile, or a message was not acked), the prefetched batches are discarded.
+	//
+	// Batches are selected with SelectQuery, using the last offset of the previous batch as the next offset.
+	// Offsets adapters without NextOffsetQuery (like PostgreSQLQueueOffsetsAdapter) don't prefetch.
+	// It can't be used with offsets adapters consuming without transactions or schema adapters reordering messages.
+	//
+	// If it's 0, batches are not prefetched.
+	PrefetchBatches int
+
+	// CacheNextOffset makes the subscriber select the batches following the messages it acked itself,
+	// instead of querying the acked offset with NextOffsetQuery in every SelectQuery, halving the queries
+	// of the offsets table of busy topics. The cached offset is discarded when the transaction is rolled back
+	// (for example, after ErrOffsetConflict), when its commit fails, or when the lease of LeaseStore is lost.
+	//
+	// The cached offset is safe only when the subscriber is the only consumer of the consumer group,
+	// so it requires LeaseStore: the offset is cached only while the lease is held. Offsets changed
+	// by an operator (for example, with SetAckedOffset) are noticed when the acked offset is queried again,
+	// every NextOffsetRevalidationInterval. It can't be used with offsets adapters consuming without transactions.
+	CacheNextOffset bool
+
+	// NextOffsetRevalidationInterval is the time after which the offset cached with CacheNextOffset
+	// is queried from the database again.
+	//
+	// Default value is 10s.
+	NextOffsetRevalidationInterval time.Duration
+
+	// StreamRows enables reading the selected messages from the rows of the query one by one, while they are
+	// processed, instead of reading the whole batch first. Only the message being processed is kept in memory,
+	// bounding the memory used with big SubscribeBatchSize or payloads.
+	//
+	// The query is kept open while the messages are processed, and the consumed and ack queries are executed
+	// meanwhile in the same transaction, which must be supported by the driver (like SQLite drivers,
+	// but not pgx or go-sql-driver/mysql). When a transform fails, the preceding messages of the batch
+	// were already delivered, and they are delivered again if the transaction is rolled back.
+	//
+	// It can't be used with QueryTimeout (as canceling the query would close the rows), prefetching,
+	// grouping batches, or schema adapters reordering messages.
+	StreamRows bool
 }
 
 func (c *SubscriberConfig) setDefaults() {
@@ -72,9 +305,37 @@ func (c *SubscriberConfig) setDefaults() {
 	if c.RetryInterval == 0 {
 		c.RetryInterval = time.Second
 	}
+	if c.RedeliveryPolicy == nil {
+		c.RedeliveryPolicy = ConstantRetryPolicy{Interval: c.ResendInterval}
+	}
 	if c.BackoffManager == nil {
 		c.BackoffManager = NewDefaultBackoffManager(c.PollInterval, c.RetryInterval)
 	}
+	if c.EventsBufferSize == 0 {
+		c.EventsBufferSize = 1024
+	}
+	if c.ActivityInterval == 0 {
+		c.ActivityInterval = time.Minute
+	}
+	if c.LeaseDuration == 0 {
+		c.LeaseDuration = time.Second * 30
+	}
+	if c.HibernationInterval == 0 {
+		c.HibernationInterval = time.Second * 30
+	}
+	if c.NextOffsetRevalidationInterval == 0 {
+		c.NextOffsetRevalidationInterval = time.Second * 10
+	}
+	if c.AutoBatch != nil {
+		autoBatch := *c.AutoBatch
+		autoBatch.setDefaults()
+		c.AutoBatch = &autoBatch
+	}
+	if c.FairScheduling != nil {
+		fairScheduling := *c.FairScheduling
+		fairScheduling.setDefaults()
+		c.FairScheduling = &fairScheduling
+	}
 }
 
 func (c SubscriberConfig) validate() error {
@@ -93,12 +354,107 @@ func (c SubscriberConfig) validate() error {
 	if c.RetryInterval <= 0 {
 		return errors.New("resend interval must be a positive duration")
 	}
+	if c.CatchUpBatchLimit < 0 {
+		return errors.New("catch up batch limit must be non-negative")
+	}
+	if c.PollJitter < 0 || c.PollJitter > 1 {
+		return errors.Errorf("poll jitter must be between 0 and 1, got %v", c.PollJitter)
+	}
+	if c.AutoBatch != nil {
+		if err := c.AutoBatch.validate(); err != nil {
+			return errors.Wrap(err, "invalid auto batch config")
+		}
+	}
+	if c.FairScheduling != nil {
+		if err := c.FairScheduling.validate(); err != nil {
+			return errors.Wrap(err, "invalid fair scheduling config")
+		}
+	}
 	if c.SchemaAdapter == nil {
 		return errors.New("schema adapter is nil")
 	}
 	if c.OffsetsAdapter == nil {
 		return errors.New("offsets adapter is nil")
 	}
+	if c.QueryTimeout < 0 {
+		return errors.New("query timeout must be a positive duration")
+	}
+	if c.ActivityInterval < 0 {
+		return errors.New("activity interval must be a positive duration")
+	}
+	if c.LeaseDuration < 0 {
+		return errors.New("lease duration must be a positive duration")
+	}
+	if c.GroupCommitMessages < 0 {
+		return errors.New("group commit messages must be non-negative")
+	}
+	if c.GroupCommitInterval < 0 {
+		return errors.New("group commit interval must be a positive duration")
+	}
+	if c.HibernateAfter < 0 {
+		return errors.New("hibernate after must be a positive duration")
+	}
+	if c.HibernationInterval < 0 {
+		return errors.New("hibernation interval must be a positive duration")
+	}
+	if c.PrefetchBatches < 0 {
+		return errors.New("prefetch batches must be non-negative")
+	}
+	if c.PrefetchBatches > 0 {
+		if _, ok := c.OffsetsAdapter.(NonTransactionalOffsetsAdapter); ok {
+			return errors.New("prefetching can't be used with non-transactional offsets adapter")
+		}
+		if schemaReordersMessages(c.SchemaAdapter) {
+			return errors.New("prefetching can't be used with schema adapter reordering messages")
+		}
+	}
+	if c.NextOffsetRevalidationInterval < 0 {
+		return errors.New("next offset revalidation interval must be a positive duration")
+	}
+	if c.CacheNextOffset {
+		if c.LeaseStore == nil {
+			// Offsets acked by other subscribers of the consumer group would not be noticed.
+			return errors.New("next offset can be cached only by the exclusive subscriber of the consumer group, LeaseStore is required")
+		}
+		if _, ok := c.OffsetsAdapter.(NonTransactionalOffsetsAdapter); ok {
+			return errors.New("next offset can't be cached with non-transactional offsets adapter")
+		}
+	}
+	if c.StreamRows {
+		if c.QueryTimeout > 0 {
+			return errors.New("query timeout can't be used with streaming rows")
+		}
+		if c.PrefetchBatches > 0 {
+			return errors.New("prefetching can't be used with streaming rows")
+		}
+		if c.GroupBatches {
+			return errors.New("grouping batches can't be used with streaming rows")
+		}
+		if schemaReordersMessages(c.SchemaAdapter) {
+			return errors.New("schema adapter reordering messages can't be used with streaming rows")
+		}
+	}
+	if schemaDecodesMetadataLazily(c.SchemaAdapter) {
+		if c.GroupBatches || c.Deduplicator != nil || len(c.Transforms) > 0 {
+			return errors.New("grouping batches, deduplicator and transforms can't be used with lazy metadata")
+		}
+	}
+	if c.GroupBatches {
+		if _, ok := c.SchemaAdapter.(BatchGroupingSchemaAdapter); !ok {
+			return errors.New("schema adapter must implement BatchGroupingSchemaAdapter to group batches")
+		}
+		if schemaReordersMessages(c.SchemaAdapter) {
+			return errors.New("schema adapter reordering messages can't be used with grouping batches")
+		}
+	}
+	if schemaReordersMessages(c.SchemaAdapter) {
+		if _, ok := c.OffsetsAdapter.(NonTransactionalOffsetsAdapter); ok {
+			return errors.New("schema adapter reordering messages can't be used with non-transactional offsets adapter")
+		}
+		if optimisticAdapter, ok := c.OffsetsAdapter.(OptimisticOffsetsAdapter); ok && optimisticAdapter.ConsumedMessageQueryIsConditional() {
+			return errors.New("schema adapter reordering messages can't be used with optimistic offsets adapter")
+		}
+	}
 
 	return nil
 }
@@ -109,20 +465,38 @@ type Subscriber struct {
 	consumerIdBytes  []byte
 	consumerIdString string
 
-	db     Beginner
+	db     TxBeginner
 	config SubscriberConfig
 
 	subscribeWg *sync.WaitGroup
 	closing     chan struct{}
 	closed      bool
 
+	events    *eventEmitter
+	stats     *subscriberStats
+	autoBatch *autoBatcher
+	scheduler *fairScheduler
+	ordering  *orderingValidator
+	wakers    *subscriberWakers
+
 	logger watermill.LoggerAdapter
 }
 
+// NewSubscriber creates a Subscriber consuming the messages with the database/sql handle, like *sql.DB.
 func NewSubscriber(db Beginner, config SubscriberConfig, logger watermill.LoggerAdapter) (*Subscriber, error) {
 	if db == nil {
 		return nil, errors.New("db is nil")
 	}
+
+	return NewSubscriberWithTxBeginner(BeginnerFromStdSQL(db), config, logger)
+}
+
+// NewSubscriberWithTxBeginner creates a Subscriber consuming the messages with the TxBeginner,
+// like the one returned by BeginnerFromPgx.
+func NewSubscriberWithTxBeginner(db TxBeginner, config SubscriberConfig, logger watermill.LoggerAdapter) (*Subscriber, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
 	config.setDefaults()
 	err := config.validate()
 	if err != nil {
@@ -149,9 +523,20 @@ func NewSubscriber(db Beginner, config SubscriberConfig, logger watermill.Logger
 		subscribeWg: &sync.WaitGroup{},
 		closing:     make(chan struct{}),
 
+		events:    newEventEmitter(config.EventsBufferSize),
+		stats:     newSubscriberStats(),
+		autoBatch: newAutoBatcher(config.AutoBatch),
+		scheduler: newFairScheduler(config.FairScheduling),
+		ordering:  newOrderingValidator(config.ValidateOrdering),
+		wakers:    newSubscriberWakers(),
+
 		logger: logger,
 	}
 
+	if config.ReadYourWrites {
+		registerReadYourWritesSubscriber(sub)
+	}
+
 	return sub, nil
 }
 
@@ -165,54 +550,105 @@ func newSubscriberID() ([]byte, string, error) {
 	return idBytes, id, nil
 }
 
+// Subscribe consumes messages of the topic until ctx is canceled or the subscriber is closed.
+// The returned channel is closed when the subscription stops. Messages acked before that are committed,
+// including the pending group commit, and the message being delivered is released, so it's redelivered
+// to the next subscription instead of waiting for its claim to expire.
 func (s *Subscriber) Subscribe(ctx context.Context, topic string) (o <-chan *message.Message, err error) {
+	if err := s.prepareSubscription(ctx, topic); err != nil {
+		return nil, err
+	}
+
+	return s.startConsuming(ctx, topic, nil), nil
+}
+
+// prepareSubscription initializes and verifies the schema of the topic, and executes the before subscribing queries.
+func (s *Subscriber) prepareSubscription(ctx context.Context, topic string) (err error) {
 	if s.closed {
-		return nil, ErrSubscriberClosed
+		return ErrSubscriberClosed
 	}
 
-	if err = validateTopicName(topic); err != nil {
-		return nil, err
+	if err = validateTopic(s.config.SchemaAdapter, topic); err != nil {
+		return err
 	}
 
 	if s.config.InitializeSchema {
 		if err := s.SubscribeInitialize(topic); err != nil {
-			return nil, err
+			return err
+		}
+	}
+
+	if s.config.SchemaIntrospector != nil {
+		err := VerifySchema(ctx, s.db, s.config.SchemaIntrospector, s.config.SchemaAdapter, s.config.OffsetsAdapter, topic)
+		if err != nil {
+			return errors.Wrap(err, "cannot verify schema")
 		}
 	}
 
 	bsq := s.config.OffsetsAdapter.BeforeSubscribingQueries(topic, s.config.ConsumerGroup)
 
 	if len(bsq) >= 1 {
-		err := runInTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		executeBeforeSubscribingQueries := func(ctx context.Context, executor QueryExecutor) error {
 			for _, q := range bsq {
 				s.logger.Debug("Executing before subscribing query", watermill.LogFields{
 					"query": q,
 				})
 
-				_, err := tx.ExecContext(ctx, q.Query, q.Args...)
+				_, err := executor.ExecContext(ctx, q.Query, q.Args...)
 				if err != nil {
 					return errors.Wrap(err, "cannot execute before subscribing query")
 				}
 			}
 			return nil
-		})
+		}
+
+		if s.consumesWithoutTransaction() {
+			err = executeBeforeSubscribingQueries(ctx, s.db)
+		} else {
+			err = runInTx(ctx, s.txProvider(), func(ctx context.Context, tx Tx) error {
+				return executeBeforeSubscribingQueries(ctx, tx)
+			})
+		}
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	// the information about closing the subscriber is propagated through ctx
+	return nil
+}
+
+// startConsuming starts consuming the topic in the background. If before is not nil, it's called first,
+// and the topic is consumed only if it returns true.
+func (s *Subscriber) startConsuming(
+	ctx context.Context,
+	topic string,
+	before func(ctx context.Context, out chan *message.Message) bool,
+) <-chan *message.Message {
+	// the information about closing the subscriber is propagated through ctx,
+	// so the in-flight queries are canceled by the driver, instead of waiting for them to complete
 	ctx, cancel := context.WithCancel(ctx)
 	out := make(chan *message.Message)
 
+	go func() {
+		select {
+		case <-s.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	s.subscribeWg.Add(1)
 	go func() {
-		s.consume(ctx, topic, out)
+		if before == nil || before(ctx, out) {
+			s.consume(ctx, topic, out)
+		} else {
+			s.subscribeWg.Done()
+		}
 		close(out)
 		cancel()
 	}()
 
-	return out, nil
+	return out
 }
 
 func (s *Subscriber) consume(ctx context.Context, topic string, out chan *message.Message) {
@@ -224,6 +660,23 @@ func (s *Subscriber) consume(ctx context.Context, topic string, out chan *messag
 	})
 
 	var sleepTime time.Duration = 0
+	if s.config.DesynchronizeStart {
+		sleepTime = time.Duration(rand.Int63n(int64(s.config.PollInterval)))
+	}
+	var lastActive time.Time
+	lease := &subscriberLease{}
+	defer s.releaseLease(topic, lease, logger)
+
+	commit := &groupCommit{}
+	defer s.commitQueryTx(ctx, topic, commit, logger)
+
+	prefetch := &subscriptionPrefetch{}
+	defer prefetch.stop()
+
+	hibernation := &topicHibernation{}
+	wake := s.wakers.register(topic)
+	defer s.wakers.unregister(topic, wake)
+
 	for {
 		select {
 		case <-s.closing:
@@ -235,20 +688,61 @@ func (s *Subscriber) consume(ctx context.Context, topic string, out chan *messag
 			return
 
 		case <-time.After(sleepTime): // Wait if needed
+
+		case <-wake:
+			s.wakeUp(topic, hibernation, logger)
+		}
+
+		if !s.holdLease(ctx, topic, lease, logger) {
+			// Another subscriber may consume the consumer group until the lease is acquired again.
+			commit.nextOffset.invalidate()
+			sleepTime = s.jitter(s.config.PollInterval)
+			continue
 		}
 
-		noMsg, err := s.query(ctx, topic, out, logger)
-		backoff := s.config.BackoffManager.HandleError(logger, noMsg, err)
+		if s.config.ActivityStore != nil && time.Since(lastActive) >= s.config.ActivityInterval {
+			lastActive = time.Now()
+			s.markActive(ctx, topic, lastActive, logger)
+		}
+
+		releasePoll, ok := s.acquirePoll(ctx, topic)
+		if !ok {
+			continue
+		}
+		noMsg, err := s.query(ctx, topic, out, commit, prefetch, logger)
+		releasePoll()
+		backoff := s.jitter(s.config.BackoffManager.HandleError(logger, noMsg, err))
 		if backoff != 0 {
 			if err != nil {
 				logger = logger.With(watermill.LogFields{"err": err.Error()})
+				s.events.emit(RetryScheduled{Topic: topic, Err: err, Wait: backoff})
 			}
 			logger.Trace("Backing off querying", watermill.LogFields{
 				"wait_time": backoff,
 				"no_msg":    noMsg,
 			})
 		}
-		sleepTime = backoff
+		sleepTime = s.hibernationBackoff(topic, hibernation, noMsg, err, backoff, logger)
+	}
+}
+
+// jitter randomizes the backoff by PollJitter.
+func (s *Subscriber) jitter(backoff time.Duration) time.Duration {
+	if s.config.PollJitter == 0 || backoff <= 0 {
+		return backoff
+	}
+
+	maxJitter := int64(float64(backoff) * s.config.PollJitter)
+	if maxJitter == 0 {
+		return backoff
+	}
+
+	return backoff - time.Duration(maxJitter) + time.Duration(rand.Int63n(2*maxJitter+1))
+}
+
+func (s *Subscriber) markActive(ctx context.Context, topic string, at time.Time, logger watermill.LoggerAdapter) {
+	if err := s.config.ActivityStore.MarkActive(ctx, topic, s.config.ConsumerGroup, at); err != nil {
+		logger.Error("Could not mark consumer group as active", err, nil)
 	}
 }
 
@@ -256,44 +750,215 @@ func (s *Subscriber) query(
 	ctx context.Context,
 	topic string,
 	out chan *message.Message,
+	commit *groupCommit,
+	prefetch *subscriptionPrefetch,
 	logger watermill.LoggerAdapter,
 ) (noMsg bool, err error) {
-	txOptions := &sql.TxOptions{
-		Isolation: s.config.SchemaAdapter.SubscribeIsolationLevel(),
+	if s.consumesWithoutTransaction() {
+		return s.queryWithoutTransaction(ctx, topic, out, logger)
 	}
-	tx, err := s.db.BeginTx(ctx, txOptions)
+
+	// The transaction outlives the subscription context, so messages acked before the context
+	// was canceled are still acked and committed.
+	txCtx := detachedContext{ctx}
+
+	tx, err := s.beginQueryTx(ctx, commit)
 	if err != nil {
-		return false, errors.Wrap(err, "could not begin tx for querying")
+		return false, err
 	}
 
+	var catchUpProgress *CatchUpProgress
+	var ackedMessages int
+	var interrupted bool
+
 	defer func() {
 		if err != nil {
-			rollbackErr := tx.Rollback()
-			if rollbackErr != nil && rollbackErr != sql.ErrTxDone {
-				logger.Error("could not rollback tx for querying message", rollbackErr, watermill.LogFields{
-					"query_err": err,
-				})
+			s.rollbackQueryTx(commit, err, logger)
+			return
+		}
+
+		commit.messages += ackedMessages
+		if catchUpProgress != nil {
+			commit.catchUpProgress = catchUpProgress
+		}
+		if s.commitDue(commit, noMsg) {
+			s.commitQueryTx(ctx, topic, commit, logger)
+		}
+	}()
+
+	selectCtx := context.Context(ctx)
+	if commit.lastAcked != nil {
+		// Canceling the query could abort the transaction with acks of the previous batches.
+		selectCtx = txCtx
+	}
+
+	offsetsAdapter, cachedOffset := s.selectOffsetsAdapter(topic, &commit.nextOffset)
+
+	pollStart := time.Now()
+	var selected *selectedRows
+	if s.config.StreamRows {
+		selected, err = s.streamBatch(selectCtx, tx, topic, offsetsAdapter, logger)
+		if err != nil {
+			return false, err
+		}
+		defer func() {
+			_ = selected.close()
+		}()
+	} else {
+		messageRows, prefetched := s.prefetchedBatch(selectCtx, tx, topic, prefetch, logger)
+		if !prefetched {
+			var noRows bool
+			messageRows, noRows, err = s.selectBatch(selectCtx, tx, topic, offsetsAdapter, logger)
+			if err != nil {
+				return false, err
 			}
-		} else {
-			commitErr := tx.Commit()
-			if commitErr != nil && commitErr != sql.ErrTxDone {
-				logger.Error("could not commit tx for querying message", commitErr, nil)
+			if noRows {
+				return true, nil
 			}
+			s.startPrefetch(ctx, topic, prefetch, messageRows, logger)
+		} else {
+			// The prefetched batch follows the acked offset queried in the transaction.
+			cachedOffset = false
 		}
+
+		selected = newBatchRows(messageRows)
+		s.recordSelected(topic, time.Since(pollStart), selected.count())
+	}
+
+	var lastOffset int64
+	var lastRow Row
+
+	reordered := schemaReordersMessages(s.config.SchemaAdapter)
+	acksEveryMessage := offsetsAdapterAcksEveryMessage(s.config.OffsetsAdapter)
+	ackedOffsets := map[int64]struct{}{}
+	var audited []auditedMessage
+
+	batchProcessed := s.startAutoBatch(topic, logger)
+	defer func() {
+		batchProcessed(selected.count())
 	}()
 
+	for {
+		row, ok, err := selected.next()
+		if err != nil && ctx.Err() != nil {
+			logger.Debug("Batch interrupted, context canceled", watermill.LogFields{"err": err.Error()})
+			interrupted = true
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			break
+		}
+
+		acked, err := s.processMessage(ctx, topic, row, tx, out, logger)
+		if errors.Is(err, errBatchIncomplete) {
+			break
+		}
+		if err != nil && ctx.Err() != nil {
+			logger.Debug("Batch interrupted, context canceled", watermill.LogFields{"err": err.Error()})
+			interrupted = true
+			break
+		}
+		if err != nil {
+			return false, errors.Wrap(err, "could not process message")
+		}
+		if !acked {
+			interrupted = true
+			break
+		}
+		if acksEveryMessage {
+			if err := s.ackMessage(txCtx, tx, topic, row, logger); err != nil {
+				return false, err
+			}
+		}
+
+		// The buffers are released, but the row's offset and extra data remain valid for acking.
+		row.release()
+
+		lastOffset = row.Offset
+		lastRow = row
+		ackedMessages++
+		if reordered {
+			ackedOffsets[row.Offset] = struct{}{}
+		}
+		if s.config.AuditSink != nil {
+			audited = append(audited, auditedMessage{offset: row.Offset, uuid: row.Msg.UUID})
+		}
+		s.validateOrdering(topic, row.Msg, logger)
+	}
+
+	if selected.streamed() {
+		// The rows are closed before acking, so the remaining messages don't hold the statement open.
+		if err := selected.close(); err != nil {
+			return false, err
+		}
+		if selected.noRows {
+			return true, nil
+		}
+		s.recordSelected(topic, selected.polled, selected.count())
+	}
+
+	if reordered && lastOffset != 0 {
+		// Messages were delivered out of the offsets order, so only the offsets below which
+		// all messages were acked can be acked.
+		var ok bool
+		lastRow, ok = lastAckedInOffsetOrder(selected.batch, ackedOffsets)
+		if !ok {
+			return false, s.releaseInterruptedClaim(txCtx, topic, commit, interrupted, logger)
+		}
+	}
+
+	if lastOffset == 0 {
+		return true, s.releaseInterruptedClaim(txCtx, topic, commit, interrupted, logger)
+	}
+
+	if !acksEveryMessage {
+		if err := s.ackMessage(txCtx, tx, topic, lastRow, logger); err != nil {
+			return false, err
+		}
+	}
+	commit.lastAcked = &lastRow
+	commit.audit(audited, lastRow.Offset)
+	commit.nextOffset.acked(lastRow, cachedOffset, pollStart)
+
+	if s.catchUpBatchLimitReached(selected.count()) && lastRow.Offset == selected.lastSelected().Offset {
+		catchUpProgress = &CatchUpProgress{
+			Topic:         topic,
+			ConsumerGroup: s.config.ConsumerGroup,
+			Messages:      selected.count(),
+			LastOffset:    lastRow.Offset,
+		}
+	}
+
+	return false, nil
+}
+
+// selectBatch selects the next batch of messages in the transaction. noRows is true if the schema adapter
+// reported that there are no messages with sql.ErrNoRows.
+func (s *Subscriber) selectBatch(
+	ctx context.Context,
+	tx Tx,
+	topic string,
+	offsetsAdapter OffsetsAdapter,
+	logger watermill.LoggerAdapter,
+) (messageRows []Row, noRows bool, err error) {
 	selectQuery := s.config.SchemaAdapter.SelectQuery(
 		topic,
 		s.config.ConsumerGroup,
-		s.config.OffsetsAdapter,
+		offsetsAdapter,
 	)
 	logger.Trace("Querying message", watermill.LogFields{
 		"query":      selectQuery.Query,
 		"query_args": sqlArgsToLog(selectQuery.Args),
 	})
-	rows, err := tx.QueryContext(ctx, selectQuery.Query, selectQuery.Args...)
+	queryCtx, cancelQuery := s.withQueryTimeout(ctx)
+	defer cancelQuery()
+
+	rows, err := tx.QueryContext(queryCtx, selectQuery.Query, selectQuery.Args...)
 	if err != nil {
-		return false, errors.Wrap(err, "could not query message")
+		return nil, false, errors.Wrap(err, "could not query message")
 	}
 
 	defer func() {
@@ -302,42 +967,230 @@ func (s *Subscriber) query(
 		}
 	}()
 
-	var lastOffset int64
-	var lastRow Row
-
-	messageRows := make([]Row, 0)
+	messageRows = make([]Row, 0)
+	reordered := schemaReordersMessages(s.config.SchemaAdapter)
 
 	for rows.Next() {
 		row, err := s.config.SchemaAdapter.UnmarshalMessage(rows)
 		if errors.Cause(err) == sql.ErrNoRows {
-			return true, nil
+			return nil, true, nil
 		} else if err != nil {
-			return false, errors.Wrap(err, "could not unmarshal message from query")
+			return nil, false, errors.Wrap(err, "could not unmarshal message from query")
+		}
+
+		row, err = s.transformMessage(row)
+		if err != nil {
+			return nil, false, err
 		}
 
 		messageRows = append(messageRows, row)
+		// Reordered batches are limited after all rows are read, so no offset lower than the acked ones is skipped.
+		if !reordered && s.batchLimitReached(topic, len(messageRows)) {
+			break
+		}
 	}
 
-	for _, row := range messageRows {
-		acked, err := s.processMessage(ctx, topic, row, tx, out, logger)
+	if reordered {
+		messageRows = limitReorderedBatch(messageRows, func(messages int) bool {
+			return s.batchLimitReached(topic, messages)
+		})
+	}
+
+	return messageRows, false, nil
+}
+
+// batchLimitReached returns true if the batch can't have more messages because of CatchUpBatchLimit, AutoBatch
+// or FairSchedulingConfig.MaxInFlight.
+func (s *Subscriber) batchLimitReached(topic string, messages int) bool {
+	return s.catchUpBatchLimitReached(messages) || s.autoBatchLimitReached(topic, messages) ||
+		s.inFlightLimitReached(topic, messages)
+}
+
+// queryWithoutTransaction is used instead of query for offsets adapters implementing NonTransactionalOffsetsAdapter.
+// Every message is claimed with ConsumedMessageQuery and acked with AckMessageQuery in separate statements.
+func (s *Subscriber) queryWithoutTransaction(
+	ctx context.Context,
+	topic string,
+	out chan *message.Message,
+	logger watermill.LoggerAdapter,
+) (noMsg bool, err error) {
+	var selected *selectedRows
+	if s.config.StreamRows {
+		selected, err = s.streamBatch(ctx, s.db, topic, s.config.OffsetsAdapter, logger)
+		if err != nil {
+			return false, err
+		}
+		defer func() {
+			_ = selected.close()
+		}()
+	} else {
+		pollStart := time.Now()
+		messageRows, err := s.selectBatchWithoutTransaction(ctx, topic, logger)
+		if err != nil {
+			return false, err
+		}
+
+		selected = newBatchRows(messageRows)
+		s.recordSelected(topic, time.Since(pollStart), selected.count())
+		if selected.count() == 0 {
+			return true, nil
+		}
+	}
+
+	batchProcessed := s.startAutoBatch(topic, logger)
+	defer func() {
+		batchProcessed(selected.count())
+	}()
+
+	var acked int
+	for {
+		row, ok, err := selected.next()
+		if err != nil && ctx.Err() != nil {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			break
+		}
+
+		ok, err = s.processMessage(ctx, topic, row, s.db, out, logger)
+		if errors.Is(err, errBatchIncomplete) {
+			s.releaseMessage(topic, row, logger)
+			return true, nil
+		}
+		if err != nil && ctx.Err() != nil {
+			// The message may have been claimed before the context was canceled.
+			s.releaseMessage(topic, row, logger)
+			return true, nil
+		}
 		if err != nil {
 			return false, errors.Wrap(err, "could not process message")
 		}
-		if !acked {
+		if !ok {
+			s.releaseMessage(topic, row, logger)
 			break
 		}
 
-		lastOffset = row.Offset
-		lastRow = row
+		// The message was handled, so it's acked even if the subscription context was canceled meanwhile.
+		if err := s.ackMessage(detachedContext{ctx}, s.db, topic, row, logger); err != nil {
+			return false, err
+		}
+		s.recordAcked(ctx, topic, []string{row.Msg.UUID}, logger)
+		s.validateOrdering(topic, row.Msg, logger)
+		row.release()
+		acked++
 	}
 
-	if lastOffset == 0 {
-		return true, nil
+	if selected.streamed() {
+		if err := selected.close(); err != nil {
+			return false, err
+		}
+		s.recordSelected(topic, selected.polled, selected.count())
+		if selected.count() == 0 {
+			return true, nil
+		}
+	}
+
+	if acked == selected.count() && s.catchUpBatchLimitReached(selected.count()) {
+		s.reportCatchUpProgress(CatchUpProgress{
+			Topic:         topic,
+			ConsumerGroup: s.config.ConsumerGroup,
+			Messages:      selected.count(),
+			LastOffset:    selected.lastSelected().Offset,
+		}, logger)
+	}
+
+	return false, nil
+}
+
+// selectBatchWithoutTransaction selects the next batch of messages for queryWithoutTransaction.
+func (s *Subscriber) selectBatchWithoutTransaction(
+	ctx context.Context,
+	topic string,
+	logger watermill.LoggerAdapter,
+) ([]Row, error) {
+	selectQuery := s.config.SchemaAdapter.SelectQuery(
+		topic,
+		s.config.ConsumerGroup,
+		s.config.OffsetsAdapter,
+	)
+	logger.Trace("Querying message", watermill.LogFields{
+		"query":      selectQuery.Query,
+		"query_args": sqlArgsToLog(selectQuery.Args),
+	})
+	queryCtx, cancelQuery := s.withQueryTimeout(ctx)
+	defer cancelQuery()
+
+	rows, err := s.db.QueryContext(queryCtx, selectQuery.Query, selectQuery.Args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query message")
+	}
+
+	messageRows := make([]Row, 0)
+
+	for rows.Next() {
+		row, err := s.config.SchemaAdapter.UnmarshalMessage(rows)
+		if err != nil {
+			_ = rows.Close()
+			return nil, errors.Wrap(err, "could not unmarshal message from query")
+		}
+
+		row, err = s.transformMessage(row)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+
+		messageRows = append(messageRows, row)
+		if s.batchLimitReached(topic, len(messageRows)) {
+			break
+		}
+	}
+
+	// Rows are closed before processing, so the connection can be reused for the following queries.
+	if err := rows.Close(); err != nil {
+		return nil, errors.Wrap(err, "could not close rows")
+	}
+
+	return messageRows, nil
+}
+
+// releaseMessage releases the claim of a message which was not acked, so other subscribers don't need
+// to wait for the claim to expire.
+func (s *Subscriber) releaseMessage(topic string, row Row, logger watermill.LoggerAdapter) {
+	releaseQuery := s.config.OffsetsAdapter.(NonTransactionalOffsetsAdapter).ReleaseMessageQuery(
+		topic,
+		row,
+		s.config.ConsumerGroup,
+	)
+	if releaseQuery.IsZero() {
+		return
+	}
+
+	logger.Trace("Executing release message query", watermill.LogFields{
+		"query":      releaseQuery.Query,
+		"query_args": sqlArgsToLog(releaseQuery.Args),
+	})
+
+	// The subscription context may be already canceled at this point.
+	_, err := s.db.ExecContext(context.Background(), releaseQuery.Query, releaseQuery.Args...)
+	if err != nil {
+		logger.Error("Could not release message", err, nil)
 	}
+}
 
+func (s *Subscriber) ackMessage(
+	ctx context.Context,
+	executor QueryExecutor,
+	topic string,
+	row Row,
+	logger watermill.LoggerAdapter,
+) error {
 	ackQuery := s.config.OffsetsAdapter.AckMessageQuery(
 		topic,
-		lastRow,
+		row,
 		s.config.ConsumerGroup,
 	)
 
@@ -346,9 +1199,10 @@ func (s *Subscriber) query(
 		"query_args": sqlArgsToLog(ackQuery.Args),
 	})
 
-	result, err := tx.ExecContext(ctx, ackQuery.Query, ackQuery.Args...)
+	result, err := executor.ExecContext(ctx, ackQuery.Query, ackQuery.Args...)
 	if err != nil {
-		return false, errors.Wrap(err, "could not get args for acking the message")
+		s.events.emit(AckFailed{Topic: topic, UUID: row.Msg.UUID, Err: err})
+		return errors.Wrap(err, "could not get args for acking the message")
 	}
 
 	rowsAffected, _ := result.RowsAffected()
@@ -357,22 +1211,19 @@ func (s *Subscriber) query(
 		"rows_affected": rowsAffected,
 	})
 
-	return false, nil
+	return nil
 }
 
 func (s *Subscriber) processMessage(
 	ctx context.Context,
 	topic string,
 	row Row,
-	tx *sql.Tx,
+	executor QueryExecutor,
 	out chan *message.Message,
 	logger watermill.LoggerAdapter,
 ) (bool, error) {
-	if *s.config.AckDeadline != 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, *s.config.AckDeadline)
-		defer cancel()
-	}
+	consumedCtx, cancel := s.withAckDeadline(ctx)
+	defer cancel()
 
 	consumedQuery := s.config.OffsetsAdapter.ConsumedMessageQuery(
 		topic,
@@ -386,78 +1237,283 @@ func (s *Subscriber) processMessage(
 			"query_args": sqlArgsToLog(consumedQuery.Args),
 		})
 
-		_, err := tx.ExecContext(ctx, consumedQuery.Query, consumedQuery.Args...)
+		result, err := executor.ExecContext(consumedCtx, consumedQuery.Query, consumedQuery.Args...)
 		if err != nil {
 			return false, errors.Wrap(err, "cannot send consumed query")
 		}
 
+		if s.consumedQueryIsConditional() {
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return false, errors.Wrap(err, "cannot get rows affected by consumed query")
+			}
+			if rowsAffected == 0 {
+				return false, ErrOffsetConflict
+			}
+		}
+
 		logger.Trace("Executed query to confirm message consumed", nil)
 	}
 
+	if s.config.GroupBatches {
+		if batchID := row.Msg.Metadata.Get(BatchIDMetadataKey); batchID != "" {
+			return s.deliverBatch(ctx, topic, row, batchID, executor, out, logger)
+		}
+	}
+
+	return s.deliverMessage(ctx, topic, row, executor, out, logger)
+}
+
+// deliverMessage sends the claimed message to the handler and waits until it's acked.
+func (s *Subscriber) deliverMessage(
+	ctx context.Context,
+	topic string,
+	row Row,
+	executor QueryExecutor,
+	out chan *message.Message,
+	logger watermill.LoggerAdapter,
+) (bool, error) {
 	logger = logger.With(watermill.LogFields{
 		"msg_uuid": row.Msg.UUID,
 	})
 	logger.Trace("Received message", nil)
 
-	msgCtx := setTxToContext(ctx, tx)
+	if s.config.Deduplicator != nil {
+		duplicate, err := s.config.Deduplicator.IsDuplicate(ctx, executor, topic, s.config.ConsumerGroup, row.Msg)
+		if err != nil {
+			return false, errors.Wrap(err, "could not check if message is a duplicate")
+		}
+		if duplicate {
+			logger.Debug("Skipping duplicate message", nil)
+			s.events.emit(DuplicateSkipped{Topic: topic, UUID: row.Msg.UUID})
+			return true, nil
+		}
+	}
+
+	var savepoint *messageSavepoint
+
+	msgCtx := contextWithCausality(ctx, row.Msg)
+	msgCtx = setExtraColumnsToContext(msgCtx, row.ExtraColumns)
+	if schemaDecodesMetadataLazily(s.config.SchemaAdapter) {
+		msgCtx = setLazyMetadataToContext(msgCtx, row.Metadata)
+	}
+	if tx, ok := executor.(Tx); ok {
+		msgCtx = setTxToContext(msgCtx, tx)
 
-	return s.sendMessage(msgCtx, row.Msg, out, logger), nil
+		if s.config.UseSavepoints {
+			var err error
+			savepoint, err = beginMessageSavepoint(ctx, tx)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	acked := s.sendMessage(msgCtx, topic, row.Msg, out, savepoint, logger)
+	if err := savepoint.finish(ctx, acked); err != nil {
+		return false, err
+	}
+
+	if acked && s.config.Deduplicator != nil {
+		if err := s.config.Deduplicator.MarkHandled(ctx, executor, topic, s.config.ConsumerGroup, row.Msg); err != nil {
+			return false, errors.Wrap(err, "could not mark message as handled")
+		}
+	}
+
+	return acked, nil
+}
+
+func (s *Subscriber) withAckDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if *s.config.AckDeadline == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, *s.config.AckDeadline)
+}
+
+func (s *Subscriber) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config.QueryTimeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, s.config.QueryTimeout)
+}
+
+func (s *Subscriber) transformMessage(row Row) (Row, error) {
+	for _, transform := range s.config.Transforms {
+		msg, err := transform(row.Msg)
+		if err != nil {
+			return Row{}, errors.Wrapf(err, "could not transform message %s", row.Msg.UUID)
+		}
+
+		row.Msg = msg
+	}
+
+	return row, nil
+}
+
+func (s *Subscriber) consumedQueryIsConditional() bool {
+	optimisticAdapter, ok := s.config.OffsetsAdapter.(OptimisticOffsetsAdapter)
+	return ok && optimisticAdapter.ConsumedMessageQueryIsConditional()
+}
+
+func (s *Subscriber) txProvider() TxProvider {
+	if s.config.TxProvider != nil {
+		return s.config.TxProvider
+	}
+
+	return s.db
+}
+
+func (s *Subscriber) consumesWithoutTransaction() bool {
+	_, ok := s.config.OffsetsAdapter.(NonTransactionalOffsetsAdapter)
+	return ok
 }
 
 // sendMessages sends messages on the output channel.
 func (s *Subscriber) sendMessage(
 	ctx context.Context,
+	topic string,
 	msg *message.Message,
 	out chan *message.Message,
+	savepoint *messageSavepoint,
 	logger watermill.LoggerAdapter,
 ) (acked bool) {
-	msgCtx, cancel := context.WithCancel(ctx)
+	redelivery := &retrier{policy: s.config.RedeliveryPolicy}
+	for {
+		var acked, deadlineExceeded bool
+		msg, acked, deadlineExceeded = s.sendMessageWithinAckDeadline(ctx, topic, msg, out, savepoint, redelivery, logger)
+		if !deadlineExceeded {
+			return acked
+		}
+
+		s.handleAckDeadlineExceeded(topic, msg, logger)
+		if !s.config.NackOnAckDeadline {
+			return false
+		}
+
+		logger.Debug("Message nacked after ack deadline, resending", nil)
+		msg.Nack()
+		if !savepoint.rollback(ctx) {
+			return false
+		}
+		msg = msg.Copy()
+
+		if !s.waitBeforeRedelivery(ctx, redelivery, context.DeadlineExceeded) {
+			return false
+		}
+	}
+}
+
+// errMessageNacked is the error of the attempts to deliver nacked messages, passed to SubscriberConfig.RedeliveryPolicy.
+var errMessageNacked = errors.New("message nacked")
+
+// waitBeforeRedelivery waits before resending the message. It returns false if ctx was canceled
+// or the subscriber was closed meanwhile.
+func (s *Subscriber) waitBeforeRedelivery(ctx context.Context, redelivery *retrier, err error) bool {
+	// Nacked messages are resent even if the policy stopped retrying, as they can't be skipped.
+	wait, _ := redelivery.next(err)
+	if wait <= 0 {
+		return true
+	}
+
+	select {
+	case <-time.After(wait):
+		return true
+	case <-ctx.Done():
+		return false
+	case <-s.closing:
+		return false
+	}
+}
+
+// sendMessageWithinAckDeadline sends the message on the output channel and waits until it's acked
+// or AckDeadline is exceeded. Nacked messages are re-sent within the same ack deadline,
+// so the last sent copy of the message is returned.
+func (s *Subscriber) sendMessageWithinAckDeadline(
+	ctx context.Context,
+	topic string,
+	msg *message.Message,
+	out chan *message.Message,
+	savepoint *messageSavepoint,
+	redelivery *retrier,
+	logger watermill.LoggerAdapter,
+) (sent *message.Message, acked bool, deadlineExceeded bool) {
+	deadlineCtx, cancelDeadline := s.withAckDeadline(ctx)
+	defer cancelDeadline()
+
+	msgCtx, cancel := context.WithCancel(deadlineCtx)
 	msg.SetContext(msgCtx)
 	defer cancel()
 
 ResendLoop:
 	for {
+		var sentAt time.Time
 
 		select {
 		case out <- msg:
+			sentAt = time.Now()
+			s.events.emit(MessageDelivered{Topic: topic, UUID: msg.UUID})
+			s.stats.recordReceived(topic)
 
 		case <-s.closing:
 			logger.Info("Discarding queued message, subscriber closing", nil)
-			return false
+			return msg, false, false
 
-		case <-ctx.Done():
+		case <-deadlineCtx.Done():
 			logger.Info("Discarding queued message, context canceled", nil)
-			return false
+			return msg, false, false
 		}
 
 		select {
 		case <-msg.Acked():
 			logger.Debug("Message acked by subscriber", nil)
-			return true
+			s.events.emit(MessageAcked{Topic: topic, UUID: msg.UUID})
+			s.stats.recordProcessed(topic, true, time.Since(sentAt))
+			return msg, true, false
 
 		case <-msg.Nacked():
 			//message nacked, try resending
 			logger.Debug("Message nacked, resending", nil)
+			s.stats.recordProcessed(topic, false, time.Since(sentAt))
+			if !savepoint.rollback(ctx) {
+				return msg, false, false
+			}
 			msg = msg.Copy()
 			msg.SetContext(msgCtx)
 
-			if s.config.ResendInterval != 0 {
-				time.Sleep(s.config.ResendInterval)
+			if !s.waitBeforeRedelivery(ctx, redelivery, errMessageNacked) {
+				logger.Info("Discarding nacked message, subscription stopped before redelivery", nil)
+				return msg, false, false
 			}
 
 			continue ResendLoop
 
 		case <-s.closing:
 			logger.Info("Discarding queued message, subscriber closing", nil)
-			return false
+			return msg, false, false
 
-		case <-ctx.Done():
-			logger.Info("Discarding queued message, context canceled", nil)
-			return false
+		case <-deadlineCtx.Done():
+			if ctx.Err() != nil {
+				logger.Info("Discarding queued message, context canceled", nil)
+				return msg, false, false
+			}
+
+			return msg, false, true
 		}
 	}
 }
 
+func (s *Subscriber) handleAckDeadlineExceeded(topic string, msg *message.Message, logger watermill.LoggerAdapter) {
+	logger.Info("Message was neither acked nor nacked within ack deadline, the handler may be stuck", watermill.LogFields{
+		"ack_deadline": *s.config.AckDeadline,
+	})
+
+	if s.config.OnAckDeadlineExceeded != nil {
+		s.config.OnAckDeadlineExceeded(topic, msg)
+	}
+}
+
 func (s *Subscriber) Close() error {
 	if s.closed {
 		return nil
@@ -465,12 +1521,23 @@ func (s *Subscriber) Close() error {
 
 	s.closed = true
 
+	if s.config.ReadYourWrites {
+		unregisterReadYourWritesSubscriber(s)
+	}
+
 	close(s.closing)
 	s.subscribeWg.Wait()
+	s.events.close()
 
 	return nil
 }
 
+// Events returns the channel of lifecycle events of the subscriber (see Event).
+// The channel is closed when the subscriber is closed.
+func (s *Subscriber) Events() <-chan Event {
+	return s.events.Events()
+}
+
 func (s *Subscriber) SubscribeInitialize(topic string) error {
 	return initializeSchema(
 		context.Background(),
@@ -0,0 +1,130 @@
+package sql
+
+import (
+	"sync"
+	"time"
+)
+
+// SubscriptionStats are the counters of consuming a topic by Subscriber, returned by Subscriber.Stats.
+// The counters are kept from the first subscription to the topic until the subscriber is closed.
+type SubscriptionStats struct {
+	Topic string
+
+	// Received is the number of messages sent to the output channel, including the messages resent after nacks.
+	Received int64
+
+	// Acked is the number of acked messages.
+	Acked int64
+
+	// Nacked is the number of nacked messages.
+	Nacked int64
+
+	// AverageProcessingTime is the average time between sending a message to the output channel
+	// and acking or nacking it.
+	AverageProcessingTime time.Duration
+
+	// LastPollDuration is the duration of the last query selecting a batch of messages, including reading the rows.
+	LastPollDuration time.Duration
+
+	// LastBatchSize is the number of messages selected by the last query.
+	LastBatchSize int
+
+	// BatchSizeLimit is the current batch size adjusted by SubscriberConfig.AutoBatch.
+	// It's 0 if AutoBatch is not set.
+	BatchSizeLimit int
+}
+
+type subscriberStats struct {
+	topics map[string]*topicSubscriptionStats
+	lock   sync.Mutex
+}
+
+type topicSubscriptionStats struct {
+	stats SubscriptionStats
+
+	processed      int64
+	processingTime time.Duration
+}
+
+func newSubscriberStats() *subscriberStats {
+	return &subscriberStats{
+		topics: map[string]*topicSubscriptionStats{},
+	}
+}
+
+func (s *subscriberStats) topic(topic string) *topicSubscriptionStats {
+	stats, ok := s.topics[topic]
+	if !ok {
+		stats = &topicSubscriptionStats{stats: SubscriptionStats{Topic: topic}}
+		s.topics[topic] = stats
+	}
+
+	return stats
+}
+
+func (s *subscriberStats) recordPoll(topic string, duration time.Duration, batchSize int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := s.topic(topic)
+	stats.stats.LastPollDuration = duration
+	stats.stats.LastBatchSize = batchSize
+}
+
+func (s *subscriberStats) recordReceived(topic string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.topic(topic).stats.Received++
+}
+
+func (s *subscriberStats) recordProcessed(topic string, acked bool, processingTime time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := s.topic(topic)
+	if acked {
+		stats.stats.Acked++
+	} else {
+		stats.stats.Nacked++
+	}
+	stats.processed++
+	stats.processingTime += processingTime
+}
+
+func (s *subscriberStats) snapshotTopic(topic string) SubscriptionStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.topic(topic).stats
+}
+
+func (s *subscriberStats) snapshot() map[string]SubscriptionStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	snapshot := make(map[string]SubscriptionStats, len(s.topics))
+	for topic, stats := range s.topics {
+		topicStats := stats.stats
+		if stats.processed > 0 {
+			topicStats.AverageProcessingTime = stats.processingTime / time.Duration(stats.processed)
+		}
+		snapshot[topic] = topicStats
+	}
+
+	return snapshot
+}
+
+// Stats returns the counters of consuming every subscribed topic, by topics.
+// It may be used for dashboards or for tuning the configuration, like SubscribeBatchSize, at runtime.
+func (s *Subscriber) Stats() map[string]SubscriptionStats {
+	snapshot := s.stats.snapshot()
+	if s.autoBatch != nil {
+		for topic, stats := range snapshot {
+			stats.BatchSizeLimit = s.autoBatch.batchSize(topic)
+			snapshot[topic] = stats
+		}
+	}
+
+	return snapshot
+}
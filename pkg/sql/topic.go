@@ -1,14 +1,44 @@
 package sql
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"regexp"
 
 	"github.com/pkg/errors"
 )
 
+// MaxTopicNameLength is the maximum length of topic names accepted by ValidateTopicName.
+//
+// Databases limit the length of table names further (for example, to 63 bytes in PostgreSQL and 64 in MySQL),
+// see HashedTableNameGenerator for topics which don't fit into the limit with the table name prefix.
+const MaxTopicNameLength = 255
+
 var disallowedTopicCharacters = regexp.MustCompile(`[^A-Za-z0-9\-\$\:\.\_]`)
 
-var ErrInvalidTopicName = errors.New("topic name should not contain characters matched by " + disallowedTopicCharacters.String())
+var (
+	ErrInvalidTopicName = errors.New("topic name should not contain characters matched by " + disallowedTopicCharacters.String())
+	ErrTopicNameTooLong = errors.Errorf("topic name should not be longer than %d characters", MaxTopicNameLength)
+)
+
+// TopicValidatingSchemaAdapter is an optional interface of SchemaAdapter, implemented by adapters
+// which accept topic names other than the ones accepted by ValidateTopicName.
+//
+// Topic names are validated before every use, and the topics of default schema adapters are patched
+// into the queries, so adapters accepting exotic names must quote or map them safely in MessagesTable
+// (and the offsets adapter in MessagesOffsetsTable), for example, with HashedTableNameGenerator.
+type TopicValidatingSchemaAdapter interface {
+	// ValidateTopicName returns an error if the topic name can't be used.
+	ValidateTopicName(topic string) error
+}
+
+// ValidateTopicName checks if the topic name contains only letters, digits and the -$:._ characters,
+// and isn't longer than MaxTopicNameLength.
+//
+// It's used for all topics, unless the schema adapter implements TopicValidatingSchemaAdapter.
+func ValidateTopicName(topic string) error {
+	return validateTopicName(topic)
+}
 
 // validateTopicName checks if the topic name contains any characters which could be unsuitable for the SQL Pub/Sub.
 // Topics are translated into SQL tables and patched into some queries, so this is done to prevent injection as well.
@@ -16,6 +46,56 @@ func validateTopicName(topic string) error {
 	if disallowedTopicCharacters.MatchString(topic) {
 		return errors.Wrap(ErrInvalidTopicName, topic)
 	}
+	if len(topic) > MaxTopicNameLength {
+		return errors.Wrap(ErrTopicNameTooLong, topic)
+	}
 
 	return nil
 }
+
+// validateTopic validates the topic name with the schema adapter, if it implements TopicValidatingSchemaAdapter.
+func validateTopic(schemaAdapter SchemaAdapter, topic string) error {
+	if validatingAdapter, ok := schemaAdapter.(TopicValidatingSchemaAdapter); ok {
+		if err := validatingAdapter.ValidateTopicName(topic); err != nil {
+			return errors.Wrap(err, "invalid topic name")
+		}
+		return nil
+	}
+
+	return validateTopicName(topic)
+}
+
+// HashedTableName returns the name unchanged if it's not longer than maxLength.
+// Otherwise, it's truncated, and a hash of the whole name is appended, so different long names don't collide
+// after being truncated by the database.
+func HashedTableName(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+
+	hash := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(hash[:])[:16]
+	if maxLength <= len(suffix) {
+		return suffix[len(suffix)-maxLength:]
+	}
+
+	return name[:maxLength-len(suffix)] + suffix
+}
+
+// HashedTableNameGenerator returns a function generating quoted table names from the prefix and the topic,
+// which don't exceed maxLength (see HashedTableName). It may be used as GenerateMessagesTableName
+// of schema adapters and GenerateMessagesOffsetsTableName of offsets adapters:
+//
+//	schemaAdapter := sql.DefaultPostgreSQLSchema{
+//		GenerateMessagesTableName: sql.HashedTableNameGenerator("watermill_", 63, sql.QuoteWithDoubleQuotes),
+//	}
+//	offsetsAdapter := sql.DefaultPostgreSQLOffsetsAdapter{
+//		GenerateMessagesOffsetsTableName: sql.HashedTableNameGenerator("watermill_offsets_", 63, sql.QuoteWithDoubleQuotes),
+//	}
+//
+// Topics which already fit into maxLength keep the default table names.
+func HashedTableNameGenerator(prefix string, maxLength int, quote QuoteIdentifierFunc) func(topic string) string {
+	return func(topic string) string {
+		return quote(HashedTableName(prefix+topic, maxLength))
+	}
+}
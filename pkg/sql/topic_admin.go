@@ -0,0 +1,337 @@
+package sql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrTopicNotFound   = errors.New("topic not found")
+)
+
+// TopicAdmin provides the operations used for inspecting and administering topics (for example, by pkg/admin).
+type TopicAdmin interface {
+	// Topics returns all topics with their statistics.
+	Topics(ctx context.Context) ([]TopicStats, error)
+
+	// ConsumerGroups returns the consumer groups of the topic and their lag.
+	ConsumerGroups(ctx context.Context, topic string) ([]ConsumerGroupLag, error)
+
+	// PeekMessages returns at most limit messages of the topic with offsets greater than afterOffset,
+	// without consuming them.
+	PeekMessages(ctx context.Context, topic string, afterOffset int64, limit int) ([]PeekedMessage, error)
+
+	// RequeueParkedMessage publishes the message parked by PoisonPillDetector back to the topic it was consumed from.
+	RequeueParkedMessage(ctx context.Context, parkTopic string, uuid string) error
+}
+
+type TopicStats struct {
+	Topic string
+
+	// Messages is the number of messages stored in the topic.
+	Messages int64
+
+	// LastOffset is the highest offset of the topic's messages.
+	LastOffset int64
+}
+
+type ConsumerGroupLag struct {
+	ConsumerGroup string
+	OffsetAcked   int64
+
+	// Lag is the number of the topic's messages with offsets greater than OffsetAcked.
+	Lag int64
+}
+
+type PeekedMessage struct {
+	Offset int64
+	Msg    *message.Message
+
+	// CreatedAt is the creation time of the message, if the schema adapter selects it (see Row.CreatedAt).
+	CreatedAt time.Time
+
+	// Annotations are the annotations of the message, if the topic admin implements AnnotatingTopicAdmin.
+	Annotations []MessageAnnotation
+
+	// Pinned is true if the message is pinned, if the topic admin implements PinningTopicAdmin.
+	Pinned bool
+}
+
+// SQLiteTopicAdmin is an implementation of TopicAdmin for topics stored with DefaultSQLiteSchema
+// and DefaultSQLiteOffsetsAdapter.
+//
+// Topics are listed by the default names of their tables, so topics with table names generated
+// by GenerateMessagesTableName are not listed, but they can be still inspected by their names.
+type SQLiteTopicAdmin struct {
+	// DB is the database storing the topics. It's required.
+	DB QueryExecutor
+
+	SchemaAdapter  DefaultSQLiteSchema
+	OffsetsAdapter DefaultSQLiteOffsetsAdapter
+
+	// Publisher publishes requeued messages. It's required by RequeueParkedMessage.
+	Publisher message.Publisher
+
+	// PoisonPillStore may be set to the store of PoisonPillDetector, so failures of requeued messages' fingerprints
+	// are reset. Otherwise, requeued messages may be parked again.
+	PoisonPillStore PoisonPillStore
+
+	// ErasingKeys may be set to the encryption keys of the topics, so Erase crypto-shreds messages
+	// instead of deleting them.
+	ErasingKeys ErasingEncryptionKeys
+
+	// AnnotationsTableName may be used to override the name of the table storing annotations of messages
+	// (see Annotate). The name should not be quoted. The table is not listed as a topic.
+	//
+	// Default value is watermill_annotations.
+	AnnotationsTableName string
+
+	// PinsTableName may be used to override the name of the table storing pinned messages (see Pin).
+	// The name should not be quoted. The table is not listed as a topic.
+	//
+	// Default value is watermill_pinned_messages.
+	PinsTableName string
+}
+
+func (a SQLiteTopicAdmin) Topics(ctx context.Context) ([]TopicStats, error) {
+	rows, err := a.DB.QueryContext(
+		ctx,
+		`SELECT "name" FROM "sqlite_master"
+		WHERE "type" = 'table' AND "name" LIKE 'watermill\_%' ESCAPE '\' AND "name" NOT LIKE 'watermill\_offsets\_%' ESCAPE '\'
+		AND "name" != ? AND "name" != ?
+		ORDER BY "name"`,
+		a.annotationsTableName(),
+		a.pinsTableName(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query topics")
+	}
+
+	var topics []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			_ = rows.Close()
+			return nil, errors.Wrap(err, "could not scan topic")
+		}
+
+		topic := strings.TrimPrefix(table, "watermill_")
+		if validateTopicName(topic) == nil {
+			topics = append(topics, topic)
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return nil, errors.Wrap(err, "could not close rows")
+	}
+
+	stats := make([]TopicStats, 0, len(topics))
+	for _, topic := range topics {
+		s := TopicStats{Topic: topic}
+
+		rows, err := a.DB.QueryContext(
+			ctx,
+			`SELECT COUNT(*), COALESCE(MAX("offset"), 0) FROM `+a.SchemaAdapter.MessagesTable(topic),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not query stats of topic %s", topic)
+		}
+		if rows.Next() {
+			err = rows.Scan(&s.Messages, &s.LastOffset)
+		}
+		_ = rows.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not scan stats of topic %s", topic)
+		}
+
+		stats = append(stats, s)
+	}
+
+	return stats, nil
+}
+
+// messagesTopics returns the topics listed by Topics, except for the listed tables without the "offset" and "uuid"
+// columns, like the tables of stores of this package.
+func (a SQLiteTopicAdmin) messagesTopics(ctx context.Context) ([]string, error) {
+	stats, err := a.Topics(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var topics []string
+	for _, s := range stats {
+		table, exists, err := SQLiteSchemaIntrospector{}.InspectTable(ctx, a.DB, unquotedTableName(a.SchemaAdapter.MessagesTable(s.Topic)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not inspect table of topic %s", s.Topic)
+		}
+		if exists && hasColumns(table, "offset", "uuid") {
+			topics = append(topics, s.Topic)
+		}
+	}
+
+	return topics, nil
+}
+
+func hasColumns(table TableSchema, names ...string) bool {
+	for _, name := range names {
+		found := false
+		for _, column := range table.Columns {
+			if strings.EqualFold(column.Name, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (a SQLiteTopicAdmin) ConsumerGroups(ctx context.Context, topic string) ([]ConsumerGroupLag, error) {
+	if err := validateTopicName(topic); err != nil {
+		return nil, err
+	}
+
+	offsetsTable := a.OffsetsAdapter.MessagesOffsetsTable(topic)
+	exists, err := a.tableExists(ctx, strings.Trim(offsetsTable, `"`))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		// The topic was not subscribed yet.
+		return nil, nil
+	}
+
+	rows, err := a.DB.QueryContext(
+		ctx,
+		`SELECT o.consumer_group, o.offset_acked,
+			(SELECT COUNT(*) FROM `+a.SchemaAdapter.MessagesTable(topic)+` m WHERE m."offset" > o.offset_acked)
+		FROM `+offsetsTable+` o
+		ORDER BY o.consumer_group`,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query consumer groups")
+	}
+	defer rows.Close()
+
+	var groups []ConsumerGroupLag
+	for rows.Next() {
+		var g ConsumerGroupLag
+		if err := rows.Scan(&g.ConsumerGroup, &g.OffsetAcked, &g.Lag); err != nil {
+			return nil, errors.Wrap(err, "could not scan consumer group")
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+func (a SQLiteTopicAdmin) PeekMessages(ctx context.Context, topic string, afterOffset int64, limit int) ([]PeekedMessage, error) {
+	if err := validateTopicName(topic); err != nil {
+		return nil, err
+	}
+
+	schemaAdapter := a.SchemaAdapter
+	schemaAdapter.SubscribeBatchSize = limit
+
+	rows, err := readMessagesAfter(ctx, a.DB, schemaAdapter, topic, afterOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	uuids := make([]string, len(rows))
+	for i, row := range rows {
+		uuids[i] = row.Msg.UUID
+	}
+	annotations, err := a.annotations(ctx, topic, uuids)
+	if err != nil {
+		return nil, err
+	}
+	pinned, err := a.pinned(ctx, topic, uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]PeekedMessage, len(rows))
+	for i, row := range rows {
+		messages[i] = PeekedMessage{
+			Offset:      row.Offset,
+			Msg:         row.Msg,
+			CreatedAt:   row.CreatedAt,
+			Annotations: annotations[row.Msg.UUID],
+			Pinned:      pinned[row.Msg.UUID],
+		}
+	}
+
+	return messages, nil
+}
+
+func (a SQLiteTopicAdmin) RequeueParkedMessage(ctx context.Context, parkTopic string, uuid string) error {
+	if a.Publisher == nil {
+		return errors.New("publisher is nil")
+	}
+	if err := validateTopicName(parkTopic); err != nil {
+		return err
+	}
+
+	rows, err := a.DB.QueryContext(
+		ctx,
+		`SELECT "offset", "uuid", `+a.SchemaAdapter.payloadColumn()+`, `+a.SchemaAdapter.metadataColumn(parkTopic)+` FROM `+a.SchemaAdapter.MessagesTable(parkTopic)+` WHERE "uuid" = ?`,
+		uuid,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not query parked message")
+	}
+
+	var parked *message.Message
+	if rows.Next() {
+		row, unmarshalErr := a.SchemaAdapter.UnmarshalMessage(rows)
+		parked, err = row.Msg, unmarshalErr
+	}
+	_ = rows.Close()
+	if err != nil {
+		return errors.Wrap(err, "could not unmarshal parked message")
+	}
+	if parked == nil {
+		return ErrMessageNotFound
+	}
+
+	topic := parked.Metadata.Get(PoisonPillTopicMetadataKey)
+	if topic == "" {
+		return errors.Errorf("message %s was not parked by poison pill detector", uuid)
+	}
+	fingerprint := parked.Metadata.Get(PoisonPillFingerprintMetadataKey)
+
+	msg := parked.Copy()
+	for _, key := range []string{PoisonPillTopicMetadataKey, PoisonPillFingerprintMetadataKey, PoisonPillFailuresMetadataKey} {
+		delete(msg.Metadata, key)
+	}
+	msg.SetContext(ctx)
+
+	if a.PoisonPillStore != nil && fingerprint != "" {
+		if err := a.PoisonPillStore.Reset(ctx, topic, fingerprint); err != nil {
+			return errors.Wrap(err, "could not reset failures of message fingerprint")
+		}
+	}
+
+	if err := a.Publisher.Publish(topic, msg); err != nil {
+		return errors.Wrap(err, "could not requeue message")
+	}
+
+	return nil
+}
+
+func (a SQLiteTopicAdmin) tableExists(ctx context.Context, table string) (bool, error) {
+	rows, err := a.DB.QueryContext(ctx, `SELECT 1 FROM "sqlite_master" WHERE "type" = 'table' AND "name" = ?`, table)
+	if err != nil {
+		return false, errors.Wrap(err, "could not query table")
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
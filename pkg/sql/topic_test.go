@@ -2,9 +2,11 @@ package sql_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
 	"github.com/ThreeDotsLabs/watermill/message"
 
@@ -30,3 +32,84 @@ func TestValidateTopicName(t *testing.T) {
 	require.Error(t, err)
 	assert.Equal(t, sql.ErrInvalidTopicName, errors.Cause(err))
 }
+
+// exoticTopicsSchema accepts topic names with slashes, which are quoted by the generated table names.
+type exoticTopicsSchema struct {
+	sql.DefaultSQLiteSchema
+}
+
+func (s exoticTopicsSchema) ValidateTopicName(topic string) error {
+	if strings.ContainsAny(topic, `"`+"\x00") {
+		return errors.New("topic contains quote")
+	}
+	return nil
+}
+
+func TestValidateTopicName_schemaAdapter(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+
+	schemaAdapter := exoticTopicsSchema{
+		DefaultSQLiteSchema: sql.DefaultSQLiteSchema{
+			GenerateMessagesTableName: sql.HashedTableNameGenerator("watermill_", 63, sql.QuoteWithDoubleQuotes),
+		},
+	}
+	offsetsAdapter := sql.DefaultSQLiteOffsetsAdapter{
+		GenerateMessagesOffsetsTableName: sql.HashedTableNameGenerator("watermill_offsets_", 63, sql.QuoteWithDoubleQuotes),
+	}
+
+	publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+		SchemaAdapter:        schemaAdapter,
+		AutoInitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+
+	subscriber, err := sql.NewSubscriberWithTxBeginner(db, sql.SubscriberConfig{
+		SchemaAdapter:    schemaAdapter,
+		OffsetsAdapter:   offsetsAdapter,
+		InitializeSchema: true,
+	}, logger)
+	require.NoError(t, err)
+	defer subscriber.Close()
+
+	topic := "orders/eu/" + strings.Repeat("x", 100) + "/" + watermill.NewShortUUID()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, topic)
+	require.NoError(t, err)
+
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	require.NoError(t, publisher.Publish(topic, msg))
+
+	select {
+	case received := <-messages:
+		assert.Equal(t, msg.UUID, received.UUID)
+		received.Ack()
+	case <-ctx.Done():
+		t.Fatal("Didn't receive any messages")
+	}
+
+	err = publisher.Publish(`orders"eu`, msg)
+	assert.ErrorContains(t, err, "topic contains quote")
+}
+
+func TestValidateTopicName_tooLong(t *testing.T) {
+	assert.NoError(t, sql.ValidateTopicName(strings.Repeat("x", sql.MaxTopicNameLength)))
+	assert.Equal(t, sql.ErrTopicNameTooLong, errors.Cause(sql.ValidateTopicName(strings.Repeat("x", sql.MaxTopicNameLength+1))))
+	assert.Equal(t, sql.ErrInvalidTopicName, errors.Cause(sql.ValidateTopicName("orders/eu")))
+}
+
+func TestHashedTableName(t *testing.T) {
+	assert.Equal(t, "watermill_orders", sql.HashedTableName("watermill_orders", 63))
+
+	long := "watermill_offsets_" + strings.Repeat("x", 60)
+	hashed := sql.HashedTableName(long, 63)
+	assert.Len(t, hashed, 63)
+	assert.True(t, strings.HasPrefix(hashed, "watermill_offsets_xxx"))
+	assert.NotEqual(t, hashed, sql.HashedTableName(long+"y", 63))
+
+	generate := sql.HashedTableNameGenerator("watermill_", 20, sql.QuoteWithBackticks)
+	assert.Equal(t, "`watermill_orders`", generate("orders"))
+	assert.Len(t, generate("orders_of_all_customers"), 22)
+}
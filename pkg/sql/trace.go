@@ -0,0 +1,189 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// TracedMessage is a message returned by SQLiteTopicAdmin.Trace.
+type TracedMessage struct {
+	Topic  string
+	Offset int64
+	Msg    *message.Message
+
+	CreatedAt time.Time
+
+	// CorrelationID and CausationID are the causality metadata of the message (see CorrelationIDMetadataKey
+	// and CausationIDMetadataKey).
+	CorrelationID string
+	CausationID   string
+}
+
+// Trace returns the messages of all topics related to the correlation ID, like everything that happened for an order:
+// the messages with the correlation ID (see CorrelationIDMetadataKey), the message with the correlation ID as UUID
+// (like the request of Requester), and the messages caused by them (see CausationIDMetadataKey), transitively,
+// even if they don't have the correlation ID.
+//
+// Messages are ordered by causation, so every message follows the message which caused it,
+// and otherwise by creation time, topic and offset. Topics are listed with Topics.
+//
+// The metadata of all messages of the topics is scanned, so Trace is intended for debugging and support,
+// not for querying messages while handling them.
+func (a SQLiteTopicAdmin) Trace(ctx context.Context, correlationID string) ([]TracedMessage, error) {
+	if correlationID == "" {
+		return nil, errors.New("correlation id is empty")
+	}
+
+	topics, err := a.messagesTopics(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var traced []TracedMessage
+	seen := map[string]struct{}{}
+	add := func(messages []TracedMessage) []string {
+		var added []string
+		for _, msg := range messages {
+			key := msg.Topic + "\x00" + msg.Msg.UUID
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			traced = append(traced, msg)
+			added = append(added, msg.Msg.UUID)
+		}
+		return added
+	}
+
+	var causes []string
+	for _, topic := range topics {
+		messages, err := a.traceTopic(
+			ctx,
+			topic,
+			`json_extract(`+a.SchemaAdapter.metadataExpression(topic)+`, '$.`+CorrelationIDMetadataKey+`') = ? OR "uuid" = ?`,
+			correlationID, correlationID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		causes = append(causes, add(messages)...)
+	}
+
+	// Messages caused by the traced messages are followed until no new messages are found.
+	for len(causes) > 0 {
+		causesJSON, err := json.Marshal(causes)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not marshal causation ids")
+		}
+
+		causes = nil
+		for _, topic := range topics {
+			messages, err := a.traceTopic(
+				ctx,
+				topic,
+				`json_extract(`+a.SchemaAdapter.metadataExpression(topic)+`, '$.`+CausationIDMetadataKey+`') IN (SELECT "value" FROM json_each(?))`,
+				string(causesJSON),
+			)
+			if err != nil {
+				return nil, err
+			}
+			causes = append(causes, add(messages)...)
+		}
+	}
+
+	return orderTracedMessages(traced), nil
+}
+
+func (a SQLiteTopicAdmin) traceTopic(ctx context.Context, topic string, where string, args ...any) ([]TracedMessage, error) {
+	schemaAdapter := a.SchemaAdapter
+	schemaAdapter.SelectCreatedAt = true
+	schemaAdapter.LazyMetadata = false
+	schemaAdapter.PooledBuffers = false
+
+	rows, err := a.DB.QueryContext(
+		ctx,
+		`SELECT "offset", "uuid", `+schemaAdapter.payloadColumn()+`, `+schemaAdapter.metadataColumn(topic)+`, "created_at" FROM `+schemaAdapter.MessagesTable(topic)+`
+		WHERE `+where+`
+		ORDER BY "offset"`,
+		args...,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not query messages of topic %s", topic)
+	}
+	defer rows.Close()
+
+	var messages []TracedMessage
+	for rows.Next() {
+		row, err := schemaAdapter.UnmarshalMessage(rows)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not unmarshal message of topic %s", topic)
+		}
+
+		messages = append(messages, TracedMessage{
+			Topic:         topic,
+			Offset:        row.Offset,
+			Msg:           row.Msg,
+			CreatedAt:     row.CreatedAt,
+			CorrelationID: row.Msg.Metadata.Get(CorrelationIDMetadataKey),
+			CausationID:   row.Msg.Metadata.Get(CausationIDMetadataKey),
+		})
+	}
+
+	return messages, rows.Err()
+}
+
+// orderTracedMessages orders the messages, so every message follows its cause, and otherwise by creation time,
+// topic and offset. Creation times have seconds precision by default (see CreatedAtPrecision),
+// so they don't order causes and effects created within the same second.
+func orderTracedMessages(messages []TracedMessage) []TracedMessage {
+	uuids := map[string]struct{}{}
+	for _, msg := range messages {
+		uuids[msg.Msg.UUID] = struct{}{}
+	}
+
+	before := func(a, b TracedMessage) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Offset < b.Offset
+	}
+
+	ordered := make([]TracedMessage, 0, len(messages))
+	orderedUUIDs := map[string]struct{}{}
+	remaining := messages
+	for len(remaining) > 0 {
+		next := -1
+		for i, msg := range remaining {
+			_, causeTraced := uuids[msg.CausationID]
+			_, causeOrdered := orderedUUIDs[msg.CausationID]
+			if causeTraced && !causeOrdered && msg.CausationID != msg.Msg.UUID {
+				continue
+			}
+			if next == -1 || before(msg, remaining[next]) {
+				next = i
+			}
+		}
+		if next == -1 {
+			// The causation IDs form a cycle, so the earliest message is taken.
+			next = 0
+			for i, msg := range remaining {
+				if before(msg, remaining[next]) {
+					next = i
+				}
+			}
+		}
+
+		ordered = append(ordered, remaining[next])
+		orderedUUIDs[remaining[next].Msg.UUID] = struct{}{}
+		remaining = append(remaining[:next:next], remaining[next+1:]...)
+	}
+
+	return ordered
+}
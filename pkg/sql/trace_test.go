@@ -0,0 +1,57 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteTopicAdmin_Trace(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "trace.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	publisher := newCheckpointPublisher(t, db, sql.DefaultSQLiteSchema{})
+
+	newMessage := func(correlationID string, causationID string) *message.Message {
+		msg := message.NewMessage(watermill.NewUUID(), nil)
+		msg.SetContext(sql.ContextWithCausationID(sql.ContextWithCorrelationID(ctx, correlationID), causationID))
+		return msg
+	}
+
+	// The effects are published before their causes to other topics, so they're ordered by causation.
+	placed := newMessage("order-1", "")
+	paid := newMessage("order-1", placed.UUID)
+	shipped := newMessage("", paid.UUID)
+	require.NoError(t, publisher.Publish("shipping", shipped))
+	require.NoError(t, publisher.Publish("payments", paid))
+	require.NoError(t, publisher.Publish("orders", placed, newMessage("order-2", "")))
+	require.NoError(t, publisher.Publish("shipping", newMessage("", watermill.NewUUID())))
+	require.NoError(t, sql.SQLiteIdempotencyStore{}.InitializeSchema(ctx, db))
+
+	admin := sql.SQLiteTopicAdmin{DB: db}
+	traced, err := admin.Trace(ctx, "order-1")
+	require.NoError(t, err)
+
+	var chain []string
+	for _, msg := range traced {
+		chain = append(chain, msg.Topic+"/"+msg.Msg.UUID)
+	}
+	assert.Equal(t, []string{"orders/" + placed.UUID, "payments/" + paid.UUID, "shipping/" + shipped.UUID}, chain)
+	assert.Equal(t, "order-1", traced[1].CorrelationID)
+	assert.Equal(t, placed.UUID, traced[1].CausationID)
+	assert.False(t, traced[0].CreatedAt.IsZero())
+
+	traced, err = admin.Trace(ctx, "missing")
+	require.NoError(t, err)
+	assert.Empty(t, traced)
+}
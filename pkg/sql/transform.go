@@ -0,0 +1,10 @@
+package sql
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// TransformFunc transforms a consumed message before it's sent to the handler.
+//
+// It may modify the message in place, or return a new one. The returned message must not be nil.
+type TransformFunc func(msg *message.Message) (*message.Message, error)
@@ -5,14 +5,114 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 )
 
+// RunInTxOptions configures RunInTx. Retries of the transaction are scheduled by RetryPolicy,
+// which is built from MaxRetries, RetryInterval and MaxRetryInterval when it's not set.
+type RunInTxOptions struct {
+	// TxOptions are passed to BeginTx, for example, to use the serializable isolation level.
+	TxOptions *sql.TxOptions
+
+	// RetryPolicy decides the waits between the retries of the transaction after retryable errors,
+	// and when to stop retrying. MaxRetries, RetryInterval and MaxRetryInterval are ignored when it's set.
+	//
+	// By default, it's an ExponentialRetryPolicy configured by MaxRetries, RetryInterval and MaxRetryInterval.
+	RetryPolicy RetryPolicy
+
+	// MaxRetries is the maximum number of retries of the transaction after a retryable error.
+	// Negative value disables retries.
+	//
+	// Default value is 10.
+	MaxRetries int
+
+	// RetryInterval is the wait before the first retry. It's doubled with every retry, up to MaxRetryInterval.
+	//
+	// Default value is 10ms.
+	RetryInterval time.Duration
+
+	// MaxRetryInterval is the maximum wait between retries.
+	//
+	// Default value is 1s.
+	MaxRetryInterval time.Duration
+
+	// IsRetryable decides which errors are retried.
+	//
+	// Default value is IsRetryableTxError.
+	IsRetryable func(err error) bool
+}
+
+func (o *RunInTxOptions) setDefaults() {
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 10
+	}
+	if o.RetryInterval == 0 {
+		o.RetryInterval = time.Millisecond * 10
+	}
+	if o.MaxRetryInterval == 0 {
+		o.MaxRetryInterval = time.Second
+	}
+	if o.IsRetryable == nil {
+		o.IsRetryable = IsRetryableTxError
+	}
+	if o.RetryPolicy == nil {
+		o.RetryPolicy = ExponentialRetryPolicy{
+			InitialInterval: o.RetryInterval,
+			MaxInterval:     o.MaxRetryInterval,
+			MaxRetries:      o.MaxRetries,
+		}
+	}
+}
+
+// RunInTx runs fn in a transaction, which is committed if fn returns nil, and rolled back otherwise.
+//
+// When the transaction fails with a retryable error (a deadlock, a serialization failure or a busy SQLite database,
+// see IsRetryableTxError), it's rolled back and fn is called again in a new transaction, after the wait
+// of RunInTxOptions.RetryPolicy (an exponential backoff by default).
+// fn may be called multiple times, so it shouldn't have side effects outside the transaction.
+func RunInTx(
+	ctx context.Context,
+	txProvider TxProvider,
+	options RunInTxOptions,
+	fn func(ctx context.Context, tx Tx) error,
+) error {
+	options.setDefaults()
+
+	retries := retrier{policy: options.RetryPolicy}
+	for {
+		err := runInTxWithOptions(ctx, txProvider, options.TxOptions, fn)
+		if err == nil || !options.IsRetryable(err) {
+			return err
+		}
+
+		wait, retry := retries.next(err)
+		if !retry {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
 func runInTx(
 	ctx context.Context,
-	db Beginner,
-	fn func(ctx context.Context, tx *sql.Tx) error,
+	txProvider TxProvider,
+	fn func(ctx context.Context, tx Tx) error,
+) error {
+	return runInTxWithOptions(ctx, txProvider, nil, fn)
+}
+
+func runInTxWithOptions(
+	ctx context.Context,
+	txProvider TxProvider,
+	txOptions *sql.TxOptions,
+	fn func(ctx context.Context, tx Tx) error,
 ) (err error) {
-	tx, err := db.BeginTx(ctx, nil)
+	tx, err := txProvider.BeginTx(ctx, txOptions)
 	if err != nil {
 		return fmt.Errorf("could not begin transaction: %w", err)
 	}
@@ -0,0 +1,26 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TxProvider provides the transactions used by the Publisher and the Subscriber,
+// instead of beginning them with the database handle.
+//
+// It's useful for frameworks which manage a transaction per request: the provider may return
+// the transaction of the request found in ctx. The package calls Commit or Rollback of the returned Tx
+// when it's done with it, so a transaction managed by the framework should be returned wrapped,
+// for example using a savepoint, or with Commit deferred until the request is finished.
+//
+// TxBeginner implements TxProvider.
+type TxProvider interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+}
+
+// TxProviderFunc is a function implementing TxProvider.
+type TxProviderFunc func(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+
+func (f TxProviderFunc) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	return f(ctx, opts)
+}
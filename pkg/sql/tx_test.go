@@ -0,0 +1,107 @@
+package sql_test
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunInTx(t *testing.T) {
+	sqlDB, err := stdSQL.Open("sqlite", filepath.Join(t.TempDir(), "tx.sqlite")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	_, err = sqlDB.Exec(`CREATE TABLE counter (value INTEGER NOT NULL)`)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO counter (value) VALUES (0)`)
+	require.NoError(t, err)
+
+	faultyDB, err := sql.NewFaultyDB(sql.BeginnerFromStdSQL(sqlDB), sql.FaultyDBConfig{BusyProbability: 0.2, Seed: 1})
+	require.NoError(t, err)
+
+	options := sql.RunInTxOptions{
+		MaxRetries:       100,
+		RetryInterval:    time.Millisecond,
+		MaxRetryInterval: time.Millisecond * 10,
+	}
+
+	var calls int
+	for i := 0; i < 10; i++ {
+		err := sql.RunInTx(context.Background(), faultyDB, options, func(ctx context.Context, tx sql.Tx) error {
+			calls++
+			_, err := tx.ExecContext(ctx, `UPDATE counter SET value = value + 1`)
+			return err
+		})
+		require.NoError(t, err)
+	}
+
+	var value int
+	require.NoError(t, sqlDB.QueryRow(`SELECT value FROM counter`).Scan(&value))
+	assert.Equal(t, 10, value, "failed transactions should be rolled back")
+	assert.Greater(t, calls, 10, "busy transactions should be retried")
+
+	calls = 0
+	err = sql.RunInTx(context.Background(), faultyDB, options, func(ctx context.Context, tx sql.Tx) error {
+		calls++
+		return errors.New("invalid input")
+	})
+	assert.EqualError(t, err, "invalid input")
+	assert.Equal(t, 1, calls, "non-retryable errors should not be retried")
+
+	calls = 0
+	err = sql.RunInTx(context.Background(), sql.BeginnerFromStdSQL(sqlDB), sql.RunInTxOptions{MaxRetries: 2}, func(ctx context.Context, tx sql.Tx) error {
+		calls++
+		return sql.ErrInjectedBusy
+	})
+	assert.ErrorIs(t, err, sql.ErrInjectedBusy)
+	assert.Equal(t, 3, calls)
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	assert.False(t, sql.IsRetryableTxError(nil))
+	assert.False(t, sql.IsRetryableTxError(errors.New("syntax error")))
+	assert.True(t, sql.IsRetryableTxError(errors.New("Error 1213: Deadlock found when trying to get lock")))
+	assert.True(t, sql.IsRetryableTxError(errors.New("ERROR: could not serialize access due to read/write dependencies among transactions (SQLSTATE 40001)")))
+	assert.True(t, sql.IsRetryableTxError(sql.ErrInjectedBusy))
+
+	assert.True(t, sql.IsRetryableTxError(errors.New("TransactionContext Error: Failed to commit: write-write conflict on key: \"workers\"")))
+	assert.True(t, sql.IsRetryableTxError(fmt.Errorf("could not commit: %w", errors.New("TransactionContext Error: Conflict on tuple deletion!"))))
+	assert.True(t, sql.IsRetryableTxError(fmt.Errorf("could not process message: %w", sql.ErrOffsetConflict)))
+
+	assert.False(t, sql.IsRetryableTxError(errors.New("UNIQUE constraint failed: watermill_orders.uuid")))
+	assert.False(t, sql.IsRetryableTxError(errors.New(`Constraint Error: Duplicate key "uuid: 1" violates primary key constraint. ON CONFLICT clause`)))
+	assert.False(t, sql.IsRetryableTxError(errors.New("order conflicts with the current state")))
+}
+
+func TestPublisher_txProviderRetried(t *testing.T) {
+	db := sql.BeginnerFromStdSQL(newSQLite(t))
+	topic := "tx_provider_" + watermill.NewShortUUID()
+
+	var begun int
+	publisher, err := sql.NewPublisherWithExecutor(db, sql.PublisherConfig{
+		SchemaAdapter:        sql.DefaultSQLiteSchema{},
+		AutoInitializeSchema: true,
+		TxProvider: sql.TxProviderFunc(func(ctx context.Context, opts *stdSQL.TxOptions) (sql.Tx, error) {
+			begun++
+			if begun == 1 {
+				return nil, sql.ErrInjectedBusy
+			}
+			return db.BeginTx(ctx, opts)
+		}),
+	}, logger)
+	require.NoError(t, err)
+
+	// The transaction is retried without a deduplicator, like the transactions deduplicating messages.
+	require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), nil)))
+	assert.Equal(t, 2, begun)
+}
@@ -0,0 +1,170 @@
+package sql
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// ErrUnitOfWorkDone is returned when messages are published with a UnitOfWork which was already flushed or discarded.
+var ErrUnitOfWorkDone = errors.New("unit of work is already flushed or discarded")
+
+const unitOfWorkContextKey contextKey = "unit_of_work"
+
+// UnitOfWork collects messages published while handling a request, and publishes them in the caller's transaction
+// when it's committed (see Flush), so the domain code can publish messages without passing the transaction around.
+// Collected messages are dropped when the transaction is rolled back (see Discard).
+//
+// UnitOfWork implements message.Publisher. It may be passed in the context with WithUnitOfWork.
+// RunInUnitOfWork runs a function in a transaction, flushing the unit of work before committing it.
+type UnitOfWork struct {
+	config PublisherConfig
+	logger watermill.LoggerAdapter
+
+	published []unitOfWorkMessages
+	done      bool
+	lock      sync.Mutex
+}
+
+type unitOfWorkMessages struct {
+	topic    string
+	messages message.Messages
+}
+
+// NewUnitOfWork creates a UnitOfWork, which publishes the messages with a Publisher created with the config.
+// The messages are published in a transaction, so the config can't use AutoInitializeSchema.
+func NewUnitOfWork(config PublisherConfig, logger watermill.LoggerAdapter) (*UnitOfWork, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+	if config.AutoInitializeSchema {
+		return nil, errors.New("unit of work can't use AutoInitializeSchema, as it publishes in a transaction")
+	}
+
+	if logger == nil {
+		logger = watermill.NopLogger{}
+	}
+
+	return &UnitOfWork{
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// Publish collects the messages, which are published when the unit of work is flushed.
+func (u *UnitOfWork) Publish(topic string, messages ...*message.Message) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.done {
+		return ErrUnitOfWorkDone
+	}
+
+	u.published = append(u.published, unitOfWorkMessages{topic: topic, messages: messages})
+	return nil
+}
+
+// Messages returns the number of collected messages.
+func (u *UnitOfWork) Messages() int {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	var count int
+	for _, published := range u.published {
+		count += len(published.messages)
+	}
+
+	return count
+}
+
+// Flush publishes the collected messages with tx, in the order they were collected.
+// It should be called just before committing the transaction. The unit of work can't be used after flushing it.
+func (u *UnitOfWork) Flush(ctx context.Context, tx QueryExecutor) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.done {
+		return ErrUnitOfWorkDone
+	}
+	u.done = true
+
+	if len(u.published) == 0 {
+		return nil
+	}
+
+	publisher, err := NewPublisherWithExecutor(tx, u.config, u.logger)
+	if err != nil {
+		return errors.Wrap(err, "could not create publisher")
+	}
+	defer publisher.Close()
+
+	for _, published := range u.published {
+		for _, msg := range published.messages {
+			msg.SetContext(ctx)
+		}
+
+		if err := publisher.Publish(published.topic, published.messages...); err != nil {
+			return errors.Wrapf(err, "could not publish messages to topic %s", published.topic)
+		}
+	}
+
+	u.published = nil
+	return nil
+}
+
+// Discard drops the collected messages, for example, when the transaction was rolled back.
+// The unit of work can't be used after discarding it.
+func (u *UnitOfWork) Discard() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.done = true
+	u.published = nil
+}
+
+// Close discards the messages which were not flushed.
+func (u *UnitOfWork) Close() error {
+	u.Discard()
+	return nil
+}
+
+// WithUnitOfWork returns the context carrying the unit of work (see UnitOfWorkFromContext).
+func WithUnitOfWork(ctx context.Context, unitOfWork *UnitOfWork) context.Context {
+	return context.WithValue(ctx, unitOfWorkContextKey, unitOfWork)
+}
+
+// UnitOfWorkFromContext returns the unit of work set with WithUnitOfWork or by RunInUnitOfWork.
+func UnitOfWorkFromContext(ctx context.Context) (*UnitOfWork, bool) {
+	unitOfWork, ok := ctx.Value(unitOfWorkContextKey).(*UnitOfWork)
+	return unitOfWork, ok
+}
+
+// RunInUnitOfWork runs fn in a transaction (see RunInTx) with a new UnitOfWork, which is also set in the context
+// passed to fn. Messages published with the unit of work are flushed in the transaction before it's committed,
+// and discarded if fn returns an error. Retried transactions start with a new unit of work.
+func RunInUnitOfWork(
+	ctx context.Context,
+	txProvider TxProvider,
+	config PublisherConfig,
+	logger watermill.LoggerAdapter,
+	options RunInTxOptions,
+	fn func(ctx context.Context, tx Tx, unitOfWork *UnitOfWork) error,
+) error {
+	return RunInTx(ctx, txProvider, options, func(ctx context.Context, tx Tx) error {
+		unitOfWork, err := NewUnitOfWork(config, logger)
+		if err != nil {
+			return err
+		}
+		defer unitOfWork.Discard()
+
+		if err := fn(WithUnitOfWork(ctx, unitOfWork), tx, unitOfWork); err != nil {
+			return err
+		}
+
+		return unitOfWork.Flush(ctx, tx)
+	})
+}
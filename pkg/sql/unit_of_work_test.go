@@ -0,0 +1,70 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunInUnitOfWork(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := newSQLite(t)
+	db := sql.BeginnerFromStdSQL(sqlDB)
+	topic := "unit_of_work_" + watermill.NewShortUUID()
+
+	config := sql.PublisherConfig{SchemaAdapter: sql.DefaultSQLiteSchema{}}
+	for _, q := range config.SchemaAdapter.SchemaInitializingQueries(topic) {
+		_, err := db.ExecContext(ctx, q.Query, q.Args...)
+		require.NoError(t, err)
+	}
+
+	countMessages := func() int {
+		var count int
+		err := sqlDB.QueryRowContext(ctx, `SELECT COUNT(*) FROM "watermill_`+topic+`"`).Scan(&count)
+		require.NoError(t, err)
+		return count
+	}
+
+	placeOrder := func(ctx context.Context) error {
+		unitOfWork, ok := sql.UnitOfWorkFromContext(ctx)
+		require.True(t, ok)
+		return unitOfWork.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte("{}")))
+	}
+
+	err := sql.RunInUnitOfWork(ctx, db, config, logger, sql.RunInTxOptions{}, func(ctx context.Context, tx sql.Tx, unitOfWork *sql.UnitOfWork) error {
+		require.NoError(t, placeOrder(ctx))
+		require.NoError(t, placeOrder(ctx))
+		assert.Equal(t, 2, unitOfWork.Messages())
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, countMessages())
+
+	errRejected := errors.New("order rejected")
+	err = sql.RunInUnitOfWork(ctx, db, config, logger, sql.RunInTxOptions{}, func(ctx context.Context, tx sql.Tx, unitOfWork *sql.UnitOfWork) error {
+		require.NoError(t, placeOrder(ctx))
+		return errRejected
+	})
+	assert.ErrorIs(t, err, errRejected)
+	assert.Equal(t, 2, countMessages())
+}
+
+func TestUnitOfWork_Discard(t *testing.T) {
+	unitOfWork, err := sql.NewUnitOfWork(sql.PublisherConfig{SchemaAdapter: sql.DefaultSQLiteSchema{}}, logger)
+	require.NoError(t, err)
+
+	require.NoError(t, unitOfWork.Publish("orders", message.NewMessage(watermill.NewUUID(), nil)))
+	unitOfWork.Discard()
+
+	assert.Equal(t, 0, unitOfWork.Messages())
+	assert.ErrorIs(t, unitOfWork.Publish("orders", message.NewMessage(watermill.NewUUID(), nil)), sql.ErrUnitOfWorkDone)
+
+	_, err = sql.NewUnitOfWork(sql.PublisherConfig{SchemaAdapter: sql.DefaultSQLiteSchema{}, AutoInitializeSchema: true}, logger)
+	assert.Error(t, err)
+}
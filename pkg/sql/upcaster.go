@@ -0,0 +1,106 @@
+package sql
+
+import (
+	"strconv"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// SchemaVersionMetadataKey is the metadata key containing the version of the message's payload schema.
+//
+// The version is stored together with the rest of the metadata, so it's available for all schema adapters,
+// and existing messages tables don't need to be migrated.
+const SchemaVersionMetadataKey = "schema_version"
+
+// SchemaVersion returns the version of the message's payload schema.
+// Messages published without a version have the version 1.
+func SchemaVersion(msg *message.Message) (int, error) {
+	version := msg.Metadata.Get(SchemaVersionMetadataKey)
+	if version == "" {
+		return 1, nil
+	}
+
+	parsed, err := strconv.Atoi(version)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid schema version of message %s", msg.UUID)
+	}
+
+	return parsed, nil
+}
+
+// SetSchemaVersion sets the version of the message's payload schema.
+func SetSchemaVersion(msg *message.Message, version int) {
+	msg.Metadata.Set(SchemaVersionMetadataKey, strconv.Itoa(version))
+}
+
+// Upcaster migrates the payload of a message from one schema version to the next one.
+// It may modify the message in place, or return a new one.
+type Upcaster func(msg *message.Message) (*message.Message, error)
+
+type upcasterKey struct {
+	messageType string
+	fromVersion int
+}
+
+// UpcasterRegistry migrates payloads of consumed messages from older schema versions to the current one.
+//
+// It's a standard need of event-sourced systems replaying old events: handlers only need to support
+// the current payload version, while older messages are migrated on read, step by step.
+// UpcasterRegistry should be added to the subscriber with SubscriberConfig.Transforms.
+//
+// Upcasters should be registered before consuming, as the registry is not safe for concurrent registrations.
+type UpcasterRegistry struct {
+	typeMetadataKey string
+	upcasters       map[upcasterKey]Upcaster
+}
+
+// NewUpcasterRegistry creates a new UpcasterRegistry.
+//
+// typeMetadataKey is the metadata key containing the type of the message, as the versions of different
+// message types are independent (for example, "name" used by the cqrs component).
+// If it's empty, all messages share one schema.
+func NewUpcasterRegistry(typeMetadataKey string) *UpcasterRegistry {
+	return &UpcasterRegistry{
+		typeMetadataKey: typeMetadataKey,
+		upcasters:       map[upcasterKey]Upcaster{},
+	}
+}
+
+// Register registers the upcaster migrating messages of the type from fromVersion to fromVersion+1.
+func (r *UpcasterRegistry) Register(messageType string, fromVersion int, upcaster Upcaster) {
+	r.upcasters[upcasterKey{messageType, fromVersion}] = upcaster
+}
+
+// Upcast migrates the message to the latest version, for which the upcasters are registered.
+func (r *UpcasterRegistry) Upcast(msg *message.Message) (*message.Message, error) {
+	var messageType string
+	if r.typeMetadataKey != "" {
+		messageType = msg.Metadata.Get(r.typeMetadataKey)
+	}
+
+	version, err := SchemaVersion(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		upcaster, ok := r.upcasters[upcasterKey{messageType, version}]
+		if !ok {
+			return msg, nil
+		}
+
+		msg, err = upcaster(msg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not upcast message from version %d", version)
+		}
+
+		version++
+		SetSchemaVersion(msg, version)
+	}
+}
+
+// Transform returns the TransformFunc upcasting consumed messages.
+func (r *UpcasterRegistry) Transform() TransformFunc {
+	return r.Upcast
+}
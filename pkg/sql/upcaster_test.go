@@ -0,0 +1,77 @@
+package sql_test
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-sql/v3/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpcasterRegistry(t *testing.T) {
+	registry := sql.NewUpcasterRegistry("name")
+	registry.Register("UserCreated", 1, func(msg *message.Message) (*message.Message, error) {
+		msg.Payload = append(msg.Payload, "-v2"...)
+		return msg, nil
+	})
+	registry.Register("UserCreated", 2, func(msg *message.Message) (*message.Message, error) {
+		msg.Payload = append(msg.Payload, "-v3"...)
+		return msg, nil
+	})
+
+	testCases := []struct {
+		Name            string
+		MessageType     string
+		Version         int
+		ExpectedPayload string
+		ExpectedVersion int
+	}{
+		{
+			Name:            "unversioned",
+			MessageType:     "UserCreated",
+			ExpectedPayload: "payload-v2-v3",
+			ExpectedVersion: 3,
+		},
+		{
+			Name:            "older_version",
+			MessageType:     "UserCreated",
+			Version:         2,
+			ExpectedPayload: "payload-v3",
+			ExpectedVersion: 3,
+		},
+		{
+			Name:            "current_version",
+			MessageType:     "UserCreated",
+			Version:         3,
+			ExpectedPayload: "payload",
+			ExpectedVersion: 3,
+		},
+		{
+			Name:            "other_type",
+			MessageType:     "UserDeleted",
+			ExpectedPayload: "payload",
+			ExpectedVersion: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			msg := message.NewMessage(watermill.NewUUID(), []byte("payload"))
+			msg.Metadata.Set("name", tc.MessageType)
+			if tc.Version != 0 {
+				sql.SetSchemaVersion(msg, tc.Version)
+			}
+
+			upcasted, err := registry.Upcast(msg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.ExpectedPayload, string(upcasted.Payload))
+
+			version, err := sql.SchemaVersion(upcasted)
+			require.NoError(t, err)
+			assert.Equal(t, tc.ExpectedVersion, version)
+		})
+	}
+}